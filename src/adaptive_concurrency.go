@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Default adaptive concurrency settings
+const (
+	defaultConcurrencyInitialLimit  = 20
+	defaultConcurrencyMinLimit      = 1
+	defaultConcurrencyMaxLimit      = 1000
+	defaultConcurrencyTolerance     = 2.0
+	defaultConcurrencyBackoffRatio  = 0.9
+	defaultConcurrencyBaselineReset = 30000
+	// concurrencySmoothing is the weight of a new limit estimate against the current limit
+	concurrencySmoothing = 0.2
+)
+
+// errConcurrencyLimited is returned for upstream requests rejected by the adaptive concurrency limit
+var errConcurrencyLimited = errors.New("backend concurrency limit reached")
+
+// AdaptiveConcurrencyConfig represents the adaptive in-flight limit of each backend instance. The limit grows
+// while the latency stays close to the lowest latency observed, and shrinks when the latency rises or the
+// backend fails, so an overloaded backend gets fewer requests without hand-tuned numbers.
+type AdaptiveConcurrencyConfig struct {
+	Enabled bool `json:"enabled"`
+	// InitialLimit is the in-flight limit before any latency is observed
+	InitialLimit int `json:"initial_limit"`
+	// MinLimit and MaxLimit bound the in-flight limit
+	MinLimit int `json:"min_limit"`
+	MaxLimit int `json:"max_limit"`
+	// Tolerance is how many times the lowest observed latency a request may take before the limit shrinks
+	Tolerance float64 `json:"tolerance"`
+	// BackoffRatio multiplies the limit when a request fails or the backend answers 429, 503 or 504
+	BackoffRatio float64 `json:"backoff_ratio"`
+	// BaselineReset is the interval in milliseconds after which the lowest observed latency is measured
+	// again, so the baseline follows backends whose latency changes permanently
+	BaselineReset int `json:"baseline_reset"`
+}
+
+// withDefaults returns the configuration with default values applied
+func (c AdaptiveConcurrencyConfig) withDefaults() AdaptiveConcurrencyConfig {
+	if c.MinLimit <= 0 {
+		c.MinLimit = defaultConcurrencyMinLimit
+	}
+	if c.MaxLimit <= 0 {
+		c.MaxLimit = defaultConcurrencyMaxLimit
+	}
+	if c.MaxLimit < c.MinLimit {
+		c.MaxLimit = c.MinLimit
+	}
+	if c.InitialLimit <= 0 {
+		c.InitialLimit = defaultConcurrencyInitialLimit
+	}
+	c.InitialLimit = min(max(c.InitialLimit, c.MinLimit), c.MaxLimit)
+	if c.Tolerance < 1 {
+		c.Tolerance = defaultConcurrencyTolerance
+	}
+	if c.BackoffRatio <= 0 || c.BackoffRatio >= 1 {
+		c.BackoffRatio = defaultConcurrencyBackoffRatio
+	}
+	if c.BaselineReset <= 0 {
+		c.BaselineReset = defaultConcurrencyBaselineReset
+	}
+	return c
+}
+
+// concurrencyLimiter tracks the in-flight requests and the adaptive limit of a single backend instance
+type concurrencyLimiter struct {
+	mu          sync.Mutex
+	config      AdaptiveConcurrencyConfig
+	limit       float64
+	inFlight    int
+	baseline    time.Duration
+	baselineEnd time.Time
+	now         func() time.Time
+}
+
+// acquire reserves an in-flight slot, returning false if the limit is reached
+func (l *concurrencyLimiter) acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.inFlight >= int(l.limit) {
+		return false
+	}
+	l.inFlight++
+	return true
+}
+
+// release frees an in-flight slot and adjusts the limit to the outcome of the request
+func (l *concurrencyLimiter) release(latency time.Duration, dropped, ignored bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	inFlight := l.inFlight
+	l.inFlight--
+	if ignored {
+		return
+	}
+
+	// Back off multiplicatively when the backend fails or sheds load
+	if dropped {
+		l.setLimit(l.limit * l.config.BackoffRatio)
+		return
+	}
+
+	// Track the lowest latency as the baseline of an unloaded backend
+	now := l.now()
+	if now.After(l.baselineEnd) {
+		l.baseline = latency
+		l.baselineEnd = now.Add(time.Duration(l.config.BaselineReset) * time.Millisecond)
+	} else if latency < l.baseline {
+		l.baseline = latency
+	}
+	if latency <= 0 {
+		return
+	}
+
+	// Scale the limit by how far the latency exceeds the tolerated baseline, leaving room to grow
+	gradient := math.Max(0.5, math.Min(1, l.config.Tolerance*float64(l.baseline)/float64(latency)))
+	estimate := l.limit*gradient + math.Sqrt(l.limit)
+
+	// Do not grow while the limit is not used, it says nothing about the backend capacity
+	if estimate > l.limit && float64(inFlight) < l.limit/2 {
+		return
+	}
+	l.setLimit(l.limit*(1-concurrencySmoothing) + estimate*concurrencySmoothing)
+}
+
+// setLimit sets the limit within the configured bounds
+func (l *concurrencyLimiter) setLimit(limit float64) {
+	l.limit = math.Min(math.Max(limit, float64(l.config.MinLimit)), float64(l.config.MaxLimit))
+}
+
+// Limit returns the current in-flight limit
+func (l *concurrencyLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// AdaptiveConcurrency limits the in-flight requests of each backend instance of an endpoint
+type AdaptiveConcurrency struct {
+	mu        sync.Mutex
+	route     string
+	config    AdaptiveConcurrencyConfig
+	limiters  map[string]*concurrencyLimiter
+	telemetry *TelemetryManager
+	now       func() time.Time
+}
+
+// NewAdaptiveConcurrency creates a new AdaptiveConcurrency for the given endpoint route
+func NewAdaptiveConcurrency(route string, config AdaptiveConcurrencyConfig, telemetry *TelemetryManager) *AdaptiveConcurrency {
+	return &AdaptiveConcurrency{
+		route:     route,
+		config:    config.withDefaults(),
+		limiters:  make(map[string]*concurrencyLimiter),
+		telemetry: telemetry,
+		now:       time.Now,
+	}
+}
+
+// limiter returns the limiter of a backend host, creating it on first use
+func (a *AdaptiveConcurrency) limiter(host string) *concurrencyLimiter {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	limiter, ok := a.limiters[host]
+	if !ok {
+		limiter = &concurrencyLimiter{
+			config: a.config,
+			limit:  float64(a.config.InitialLimit),
+			now:    a.now,
+		}
+		a.limiters[host] = limiter
+	}
+	return limiter
+}
+
+// Limits returns the current in-flight limit of each backend host
+func (a *AdaptiveConcurrency) Limits() map[string]int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	limits := make(map[string]int, len(a.limiters))
+	for host, limiter := range a.limiters {
+		limits[host] = limiter.Limit()
+	}
+	return limits
+}
+
+// concurrencyTransport rejects upstream requests above the adaptive limit of their backend instance
+type concurrencyTransport struct {
+	next        http.RoundTripper
+	concurrency *AdaptiveConcurrency
+}
+
+// RoundTrip sends the request if the backend instance is below its limit, and adjusts the limit to the outcome
+func (t *concurrencyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	limiter := t.concurrency.limiter(req.URL.Host)
+	if !limiter.acquire() {
+		LogWarn("Backend concurrency limit reached", map[string]interface{}{
+			"path":    req.URL.Path,
+			"route":   t.concurrency.route,
+			"backend": req.URL.Host,
+			"limit":   limiter.Limit(),
+		})
+		if t.concurrency.telemetry != nil {
+			t.concurrency.telemetry.RecordConcurrencyRejected(req.Context(), t.concurrency.route, req.URL.Host)
+		}
+		return nil, errConcurrencyLimited
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+
+	// Requests canceled by the client say nothing about the backend
+	ignored := errors.Is(req.Context().Err(), context.Canceled)
+	dropped := err != nil
+	if resp != nil {
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			dropped = true
+		}
+	}
+	limiter.release(time.Since(start), dropped, ignored)
+	return resp, err
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestConcurrencyLimiter tests that the limit grows at the baseline latency and shrinks under load and failures
+func TestConcurrencyLimiter(t *testing.T) {
+	now := time.Now()
+	concurrency := NewAdaptiveConcurrency("/api", AdaptiveConcurrencyConfig{InitialLimit: 10, MinLimit: 2, MaxLimit: 50}, nil)
+	concurrency.now = func() time.Time { return now }
+	limiter := concurrency.limiter("backend:8080")
+
+	// Requests at the baseline latency with the limit in use grow the limit
+	for i := 0; i < 20; i++ {
+		acquired := 0
+		for limiter.acquire() {
+			acquired++
+		}
+		for j := 0; j < acquired; j++ {
+			limiter.release(10*time.Millisecond, false, false)
+		}
+	}
+	grown := limiter.Limit()
+	if grown <= 10 {
+		t.Fatalf("expected the limit to grow above 10, got %d", grown)
+	}
+
+	// The limit does not grow while it is not used
+	limiter.acquire()
+	limiter.release(10*time.Millisecond, false, false)
+	if limiter.Limit() != grown {
+		t.Errorf("expected the limit to stay at %d while unused, got %d", grown, limiter.Limit())
+	}
+
+	// Latency well above the baseline shrinks the limit
+	for i := 0; i < 20; i++ {
+		limiter.acquire()
+		limiter.release(100*time.Millisecond, false, false)
+	}
+	shrunk := limiter.Limit()
+	if shrunk >= grown {
+		t.Errorf("expected the limit to shrink below %d, got %d", grown, shrunk)
+	}
+
+	// Failures back off down to the minimum limit
+	for i := 0; i < 50; i++ {
+		limiter.acquire()
+		limiter.release(0, true, false)
+	}
+	if limiter.Limit() != 2 {
+		t.Errorf("expected the limit to back off to 2, got %d", limiter.Limit())
+	}
+}
+
+// TestAdaptiveConcurrencyRejects tests that requests above the limit are shed with 503 without reaching the backend
+func TestAdaptiveConcurrencyRejects(t *testing.T) {
+	release := make(chan struct{})
+	received := make(chan struct{}, 2)
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		<-release
+	}))
+	defer backendServer.Close()
+
+	handler := NewProxy(Endpoint{
+		Path:                "/api",
+		Backend:             backendServer.URL,
+		Retry:               RetryConfig{MaxRetries: 2},
+		AdaptiveConcurrency: AdaptiveConcurrencyConfig{Enabled: true, InitialLimit: 1, MaxLimit: 1},
+	}, false, nil).Handler()
+
+	done := make(chan int)
+	go func() {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api", nil))
+		done <- rr.Code
+	}()
+	<-received
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503 above the limit, got %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("expected a Retry-After header")
+	}
+	if len(received) != 0 {
+		t.Error("expected the rejected request not to reach the backend")
+	}
+
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("expected the request within the limit to succeed, got %d", code)
+	}
+}
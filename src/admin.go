@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AdminConfig represents the configuration of the admin API
+type AdminConfig struct {
+	Enabled bool `json:"enabled"`
+	// Token is the bearer token required for admin requests, the admin API cannot be enabled without one
+	Token string `json:"token"`
+	// Listeners restricts the admin API to the named listeners (empty means all listeners)
+	Listeners []string `json:"listeners"`
+	// DrainGracePeriod is the time in milliseconds between failing readiness and closing the listeners on drain
+	DrainGracePeriod int `json:"drain_grace_period"`
+	// Dashboard serves a web dashboard of the routes, endpoint rates, backend health and recent errors
+	Dashboard bool `json:"dashboard"`
+}
+
+// RegisterAdminEndpoints registers the admin API endpoints
+func (g *Gateway) RegisterAdminEndpoints() {
+	if !g.config.Admin.Enabled {
+		return
+	}
+
+	LogInfo("Registering admin endpoints", map[string]interface{}{
+		"listeners": g.config.Admin.Listeners,
+	})
+
+	g.handleAdmin("/admin/drain", g.handleDrain)
+	g.handleAdmin("/admin/capture", g.handleCapture)
+	g.handleAdmin("/admin/chaos", g.handleChaos)
+	g.handleAdmin("/admin/cache", g.handleCacheStats)
+	g.handleAdmin("/admin/cache/purge", g.handleCachePurge)
+	g.handleAdmin("/admin/slo", g.handleSLO)
+	g.handleAdmin("/admin/certificates", g.handleCertificates)
+	g.handleAdmin("/admin/certificates/reload", g.handleCertificateReload)
+	g.handleAdmin("/admin/signed-urls", g.handleSignURL)
+	g.handleAdmin("/admin/route-test", g.handleRouteTest)
+	g.handleAdmin("/admin/config", g.handleConfig)
+	g.handleAdmin("/admin/quotas", g.handleQuotas)
+	g.handleAdmin("/admin/lockouts", g.handleLockouts)
+	g.handleAdmin("/admin/blue-green", g.handleBlueGreen)
+	g.handleAdmin("/admin/connections", g.handleConnections)
+
+	// The dashboard page holds no data and is served without the token, which it sends to the data endpoint
+	if g.dashboard != nil {
+		g.handle("/admin/dashboard", SecurityHeadersMiddleware(g.securityHeaders(nil), http.HandlerFunc(g.handleDashboard)), g.config.Admin.Listeners)
+		g.handleAdmin("/admin/dashboard/data", g.handleDashboardData)
+	}
+}
+
+// validateAdmin checks that the enabled admin API requires a token, as it controls the whole gateway and is
+// served on all listeners unless restricted
+func validateAdmin(config AdminConfig) error {
+	if config.Enabled && config.Token == "" {
+		return errors.New("admin token is required when the admin API is enabled")
+	}
+	return nil
+}
+
+// handleAdmin registers an admin endpoint on the admin listeners, requiring the admin token
+func (g *Gateway) handleAdmin(path string, handler http.HandlerFunc) {
+	g.handle(path, SecurityHeadersMiddleware(g.securityHeaders(nil), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startTime := time.Now()
+
+		// Log the admin request
+		LogRequest(r, g.config.Debug)
+
+		// Create a logging response writer
+		lrw := NewLoggingResponseWriter(w)
+
+		// Reject banned clients before checking the admin token, so it cannot be guessed
+		var client string
+		var banned time.Duration
+		if g.authLockout != nil {
+			client = g.authLockout.client(r)
+			banned = g.authLockout.Banned(client)
+		}
+		if banned > 0 {
+			g.authLockout.reject(lrw, banned)
+		} else if !g.adminAuthorized(r) {
+			LogAudit("Unauthorized admin request", map[string]interface{}{
+				"path":        r.URL.Path,
+				"method":      r.Method,
+				"remote_addr": r.RemoteAddr,
+			})
+			http.Error(lrw, "Unauthorized", http.StatusUnauthorized)
+			if g.authLockout != nil {
+				g.authLockout.record(r, client, "admin", http.StatusUnauthorized)
+			}
+		} else {
+			handler(lrw, r)
+		}
+
+		// Log the response
+		duration := time.Since(startTime)
+		LogResponse(lrw, r, duration.String(), g.config.Debug)
+	})), g.config.Admin.Listeners)
+}
+
+// adminAuthorized checks the bearer token of an admin request
+func (g *Gateway) adminAuthorized(r *http.Request) bool {
+	if g.config.Admin.Token == "" {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(g.config.Admin.Token)) == 1
+}
+
+// writeJSON writes a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		LogError("Failed to encode response", err, nil)
+	}
+}
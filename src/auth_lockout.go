@@ -0,0 +1,273 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Default auth lockout settings
+const (
+	defaultAuthLockoutWindow      = 60000
+	defaultAuthLockoutBanDuration = 60000
+	defaultAuthLockoutMaxBan      = 3600000
+	defaultMaxLockoutClients      = 10000
+)
+
+// AuthLockoutConfig represents the temporary bans of the clients failing authentication repeatedly
+type AuthLockoutConfig struct {
+	// MaxFailures is the number of authentication failures of a client within the window after which it is
+	// banned (0 disables lockouts)
+	MaxFailures int `json:"max_failures"`
+	// Window is the time in milliseconds the failures are counted in (default 60000)
+	Window int `json:"window"`
+	// BanDuration is the duration in milliseconds of the first ban of a client, doubled for each further ban
+	// (default 60000)
+	BanDuration int `json:"ban_duration"`
+	// MaxBanDuration caps the ban duration in milliseconds; a client without failures for as long is forgiven
+	// its previous bans (default 3600000)
+	MaxBanDuration int `json:"max_ban_duration"`
+	// TrustForwardedFor identifies clients by the first X-Forwarded-For address, only safe behind a trusted
+	// load balancer
+	TrustForwardedFor bool `json:"trust_forwarded_for"`
+	// MaxClients is the number of clients whose failures are tracked at once (default 10000)
+	MaxClients int `json:"max_clients"`
+}
+
+// enabled checks whether lockouts are configured
+func (c AuthLockoutConfig) enabled() bool {
+	return c.MaxFailures > 0
+}
+
+// withDefaults returns the configuration with the defaults of the unset settings
+func (c AuthLockoutConfig) withDefaults() AuthLockoutConfig {
+	if c.Window <= 0 {
+		c.Window = defaultAuthLockoutWindow
+	}
+	if c.BanDuration <= 0 {
+		c.BanDuration = defaultAuthLockoutBanDuration
+	}
+	if c.MaxBanDuration <= 0 {
+		c.MaxBanDuration = defaultAuthLockoutMaxBan
+	}
+	if c.MaxBanDuration < c.BanDuration {
+		c.MaxBanDuration = c.BanDuration
+	}
+	if c.MaxClients <= 0 {
+		c.MaxClients = defaultMaxLockoutClients
+	}
+	return c
+}
+
+// lockoutState is the authentication failure history of a client
+type lockoutState struct {
+	failures    int
+	windowStart time.Time
+	lastFailure time.Time
+	bans        int
+	bannedUntil time.Time
+}
+
+// ClientLockout reports a tracked client
+type ClientLockout struct {
+	Client      string     `json:"client"`
+	Failures    int        `json:"failures"`
+	Bans        int        `json:"bans"`
+	BannedUntil *time.Time `json:"banned_until,omitempty"`
+}
+
+// AuthLockout bans the clients whose requests fail authentication repeatedly, i.e. are answered with 401 by
+// the gateway or a backend. Failures are counted per client IP in a fixed window.
+type AuthLockout struct {
+	config    AuthLockoutConfig
+	telemetry *TelemetryManager
+	now       func() time.Time
+
+	mu      sync.Mutex
+	clients map[string]*lockoutState
+}
+
+// NewAuthLockout creates a new AuthLockout
+func NewAuthLockout(config AuthLockoutConfig, telemetry *TelemetryManager) *AuthLockout {
+	return &AuthLockout{
+		config:    config.withDefaults(),
+		telemetry: telemetry,
+		now:       time.Now,
+		clients:   make(map[string]*lockoutState),
+	}
+}
+
+// client returns the client IP of a request
+func (l *AuthLockout) client(r *http.Request) string {
+	if ip := ClientIP(r, l.config.TrustForwardedFor); ip != nil {
+		return ip.String()
+	}
+	return r.RemoteAddr
+}
+
+// Banned returns the remaining ban of a client, zero if it is not banned
+func (l *AuthLockout) Banned(client string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state, ok := l.clients[client]
+	if !ok {
+		return 0
+	}
+	return max(state.bannedUntil.Sub(l.now()), 0)
+}
+
+// Fail counts an authentication failure of a client and returns the duration of the ban it triggered, zero
+// if the client stays below the threshold
+func (l *AuthLockout) Fail(client string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	state, ok := l.clients[client]
+	if !ok {
+		if len(l.clients) >= l.config.MaxClients {
+			l.evict(now)
+		}
+		if len(l.clients) >= l.config.MaxClients {
+			return 0
+		}
+		state = &lockoutState{}
+		l.clients[client] = state
+	}
+
+	if now.Sub(state.windowStart) >= time.Duration(l.config.Window)*time.Millisecond {
+		state.windowStart = now
+		state.failures = 0
+	}
+	state.failures++
+	state.lastFailure = now
+	if state.failures < l.config.MaxFailures || now.Before(state.bannedUntil) {
+		return 0
+	}
+
+	// Double the ban of each further lockout of the client, up to the maximum
+	ban := time.Duration(l.config.BanDuration) * time.Millisecond
+	maxBan := time.Duration(l.config.MaxBanDuration) * time.Millisecond
+	for i := 0; i < state.bans && ban < maxBan; i++ {
+		ban *= 2
+	}
+	ban = min(ban, maxBan)
+	state.bans++
+	state.failures = 0
+	state.bannedUntil = now.Add(ban)
+	return ban
+}
+
+// evict removes the clients that are not banned and failed no authentication for the maximum ban duration,
+// the caller must hold the lock
+func (l *AuthLockout) evict(now time.Time) {
+	forgiven := time.Duration(l.config.MaxBanDuration) * time.Millisecond
+	for client, state := range l.clients {
+		if !now.Before(state.bannedUntil) && now.Sub(state.lastFailure) >= forgiven {
+			delete(l.clients, client)
+		}
+	}
+}
+
+// Clients returns the tracked clients, sorted by client
+func (l *AuthLockout) Clients() []ClientLockout {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.evict(now)
+	clients := make([]ClientLockout, 0, len(l.clients))
+	for client, state := range l.clients {
+		lockout := ClientLockout{Client: client, Failures: state.failures, Bans: state.bans}
+		if now.Before(state.bannedUntil) {
+			bannedUntil := state.bannedUntil
+			lockout.BannedUntil = &bannedUntil
+		}
+		clients = append(clients, lockout)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].Client < clients[j].Client
+	})
+	return clients
+}
+
+// Reset lifts the ban and forgets the failures of a client, of all clients if client is empty
+func (l *AuthLockout) Reset(client string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if client == "" {
+		l.clients = make(map[string]*lockoutState)
+		return
+	}
+	delete(l.clients, client)
+}
+
+// reject answers a request of a banned client with 429 and the remaining ban in Retry-After
+func (l *AuthLockout) reject(w http.ResponseWriter, remaining time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(remaining.Seconds())+1))
+	http.Error(w, "Too many authentication failures", http.StatusTooManyRequests)
+}
+
+// record counts the failure of a request answered with 401 and logs the ban it triggered
+func (l *AuthLockout) record(r *http.Request, client, route string, status int) {
+	if status != http.StatusUnauthorized {
+		return
+	}
+	ban := l.Fail(client)
+	if l.telemetry != nil {
+		l.telemetry.RecordAuthFailure(r.Context(), route, ban > 0)
+	}
+	if ban > 0 {
+		LogAudit("Client locked out after authentication failures", map[string]interface{}{
+			"client_ip":    client,
+			"route":        route,
+			"max_failures": l.config.MaxFailures,
+			"ban_duration": ban.String(),
+			"user_agent":   r.UserAgent(),
+		})
+	}
+}
+
+// Middleware answers the requests of banned clients with 429 before any authentication and counts the
+// requests answered with 401 as failures of their client
+func (l *AuthLockout) Middleware(endpoint Endpoint, next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := l.client(r)
+		if remaining := l.Banned(client); remaining > 0 {
+			l.reject(w, remaining)
+			return
+		}
+		lrw := NewLoggingResponseWriter(w)
+		lrw.bodyLimit = 0
+		next.ServeHTTP(lrw, r)
+		l.record(r, client, metricsRoute(endpoint), lrw.statusCode)
+	})
+}
+
+// handleLockouts reports the clients with authentication failures (GET) and lifts the ban of a client
+// (DELETE ?client=) or of all clients
+func (g *Gateway) handleLockouts(w http.ResponseWriter, r *http.Request) {
+	if g.authLockout == nil {
+		http.Error(w, "Auth lockouts are not configured", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, g.authLockout.Clients())
+	case http.MethodDelete:
+		client := r.URL.Query().Get("client")
+		g.authLockout.Reset(client)
+		LogAudit("Auth lockout reset", map[string]interface{}{"client": client})
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
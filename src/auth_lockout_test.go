@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestAuthLockoutBans tests that clients are banned after the maximum failures with doubling ban durations
+func TestAuthLockoutBans(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	lockout := NewAuthLockout(AuthLockoutConfig{MaxFailures: 3, BanDuration: 1000, MaxBanDuration: 3000}, nil)
+	lockout.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ban := lockout.Fail("203.0.113.7"); ban != 0 {
+			t.Fatalf("failure %d: expected no ban, got %v", i+1, ban)
+		}
+	}
+	for _, expected := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second} {
+		if ban := lockout.Fail("203.0.113.7"); ban != expected {
+			t.Fatalf("expected a ban of %v, got %v", expected, ban)
+		}
+		if remaining := lockout.Banned("203.0.113.7"); remaining != expected {
+			t.Errorf("expected %v remaining, got %v", expected, remaining)
+		}
+		if remaining := lockout.Banned("203.0.113.8"); remaining != 0 {
+			t.Errorf("expected other clients not to be banned, got %v", remaining)
+		}
+		now = now.Add(expected)
+		lockout.Fail("203.0.113.7")
+		lockout.Fail("203.0.113.7")
+	}
+
+	// A client without failures for the maximum ban duration is forgiven its bans
+	now = now.Add(3 * time.Second)
+	if clients := lockout.Clients(); len(clients) != 0 {
+		t.Errorf("expected the client to be forgiven, got %v", clients)
+	}
+}
+
+// TestAuthLockoutMiddleware tests that 401 responses are counted and banned clients rejected with 429
+func TestAuthLockoutMiddleware(t *testing.T) {
+	lockout := NewAuthLockout(AuthLockoutConfig{MaxFailures: 2}, nil)
+	calls := 0
+	handler := lockout.Middleware(Endpoint{Path: "/api/"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("Authorization") == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		}
+	}))
+	serve := func(authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/", nil)
+		req.RemoteAddr = "203.0.113.7:4711"
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	serve("Bearer token")
+	serve("")
+	serve("")
+	rr := serve("Bearer token")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("expected 429 with Retry-After, got %d %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+	if calls != 3 {
+		t.Errorf("expected banned requests not to reach the handler, got %d calls", calls)
+	}
+
+	lockout.Reset("203.0.113.7")
+	if rr := serve("Bearer token"); rr.Code != http.StatusOK {
+		t.Errorf("expected 200 after the reset, got %d", rr.Code)
+	}
+}
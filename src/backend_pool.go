@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Default outlier detection settings
+const (
+	defaultOutlierConsecutiveFailures = 5
+	defaultOutlierMinRequests         = 20
+	defaultOutlierInterval            = 10000
+	defaultOutlierEjectionTime        = 30000
+	defaultOutlierMaxEjectionPercent  = 50
+)
+
+// OutlierDetectionConfig represents the passive health checking of backend instances
+type OutlierDetectionConfig struct {
+	Enabled bool `json:"enabled"`
+	// ConsecutiveFailures ejects an instance after this many consecutive failures
+	ConsecutiveFailures int `json:"consecutive_failures"`
+	// ErrorRateThreshold ejects an instance when its error rate within the interval exceeds this ratio
+	ErrorRateThreshold float64 `json:"error_rate_threshold"`
+	// MinRequests is the minimum number of requests within the interval before the error rate is evaluated
+	MinRequests int `json:"min_requests"`
+	// Interval is the error rate measurement interval in milliseconds
+	Interval int `json:"interval"`
+	// EjectionTime is the time in milliseconds an ejected instance is kept out of the pool
+	EjectionTime int `json:"ejection_time"`
+	// MaxEjectionPercent is the maximum percentage of instances that may be ejected at the same time
+	MaxEjectionPercent int `json:"max_ejection_percent"`
+}
+
+// withDefaults returns the configuration with default values applied
+func (c OutlierDetectionConfig) withDefaults() OutlierDetectionConfig {
+	if c.ConsecutiveFailures <= 0 {
+		c.ConsecutiveFailures = defaultOutlierConsecutiveFailures
+	}
+	if c.MinRequests <= 0 {
+		c.MinRequests = defaultOutlierMinRequests
+	}
+	if c.Interval <= 0 {
+		c.Interval = defaultOutlierInterval
+	}
+	if c.EjectionTime <= 0 {
+		c.EjectionTime = defaultOutlierEjectionTime
+	}
+	if c.MaxEjectionPercent <= 0 {
+		c.MaxEjectionPercent = defaultOutlierMaxEjectionPercent
+	}
+	return c
+}
+
+// backendInstance tracks the health of a single backend instance
+type backendInstance struct {
+	url                 string
+	host                string
+	consecutiveFailures int
+	requests            int
+	failures            int
+	intervalStart       time.Time
+	ejectedUntil        time.Time
+}
+
+// BackendPool balances requests across backend instances and ejects misbehaving ones
+type BackendPool struct {
+	mu        sync.Mutex
+	route     string
+	instances []*backendInstance
+	next      int
+	config    OutlierDetectionConfig
+	telemetry *TelemetryManager
+	notifier  *Notifier
+	now       func() time.Time
+}
+
+// NewBackendPool creates a new BackendPool for the given backend URLs
+func NewBackendPool(route string, backends []string, config OutlierDetectionConfig, telemetry *TelemetryManager) *BackendPool {
+	pool := &BackendPool{
+		route:     route,
+		config:    config.withDefaults(),
+		telemetry: telemetry,
+		now:       time.Now,
+	}
+	for _, backend := range backends {
+		instance := &backendInstance{url: backend}
+		if parsed, err := url.Parse(backend); err == nil {
+			instance.host = parsed.Host
+		}
+		pool.instances = append(pool.instances, instance)
+	}
+	return pool
+}
+
+// Next returns the next available backend instance in round-robin order.
+// If all instances are ejected, the next instance is returned anyway.
+func (p *BackendPool) Next() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.instances) == 0 {
+		return ""
+	}
+	if instance := p.nextAvailable(nil); instance != nil {
+		return instance.url
+	}
+
+	instance := p.instances[p.next%len(p.instances)]
+	p.next = (p.next + 1) % len(p.instances)
+	return instance.url
+}
+
+// NextExcluding returns the next available backend instance in round-robin order whose host is not one of
+// the given hosts, e.g. the instances a request was already sent to, or an empty string if there is none.
+// The round-robin position is kept, so retries do not shift the instances of the next requests.
+func (p *BackendPool) NextExcluding(hosts []string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	next := p.next
+	defer func() { p.next = next }()
+	if instance := p.nextAvailable(hosts); instance != nil {
+		return instance.url
+	}
+	return ""
+}
+
+// nextAvailable returns the next instance that is not ejected and whose host is not excluded, advancing the
+// round-robin position past it. The caller must hold the lock.
+func (p *BackendPool) nextAvailable(excluded []string) *backendInstance {
+	now := p.now()
+	for i := 0; i < len(p.instances); i++ {
+		instance := p.instances[(p.next+i)%len(p.instances)]
+		if containsString(excluded, instance.host) {
+			continue
+		}
+		if p.restore(instance, now) || instance.ejectedUntil.IsZero() {
+			p.next = (p.next + i + 1) % len(p.instances)
+			return instance
+		}
+	}
+	return nil
+}
+
+// serves checks whether one of the instances of the pool serves the given host
+func (p *BackendPool) serves(host string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, instance := range p.instances {
+		if instance.host == host {
+			return true
+		}
+	}
+	return false
+}
+
+// restore brings an ejected instance back into the pool once its ejection time has passed
+func (p *BackendPool) restore(instance *backendInstance, now time.Time) bool {
+	if instance.ejectedUntil.IsZero() || now.Before(instance.ejectedUntil) {
+		return false
+	}
+
+	instance.ejectedUntil = time.Time{}
+	instance.consecutiveFailures = 0
+	instance.requests, instance.failures = 0, 0
+	LogInfo("Backend instance restored", map[string]interface{}{
+		"route":    p.route,
+		"instance": instance.url,
+	})
+	return true
+}
+
+// BackendStatus reports the health of a backend instance
+type BackendStatus struct {
+	URL string `json:"url"`
+	// Monitored is set if outlier detection tracks the instance, Ejected while it is ejected
+	Monitored    bool   `json:"monitored"`
+	Ejected      bool   `json:"ejected"`
+	EjectedUntil string `json:"ejected_until,omitempty"`
+}
+
+// Statuses returns the health of the backend instances
+func (p *BackendPool) Statuses() []BackendStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	statuses := make([]BackendStatus, 0, len(p.instances))
+	for _, instance := range p.instances {
+		status := BackendStatus{URL: instance.url, Monitored: p.config.Enabled}
+		if !instance.ejectedUntil.IsZero() && now.Before(instance.ejectedUntil) {
+			status.Ejected = true
+			status.EjectedUntil = instance.ejectedUntil.UTC().Format(time.RFC3339)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Report records the outcome of a request to the instance serving the given host
+func (p *BackendPool) Report(ctx context.Context, host string, failed bool) {
+	if !p.config.Enabled {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var instance *backendInstance
+	for _, candidate := range p.instances {
+		if candidate.host == host {
+			instance = candidate
+			break
+		}
+	}
+	if instance == nil || !instance.ejectedUntil.IsZero() {
+		return
+	}
+
+	// Start a new error rate interval if needed
+	now := p.now()
+	if now.Sub(instance.intervalStart) > time.Duration(p.config.Interval)*time.Millisecond {
+		instance.intervalStart = now
+		instance.requests, instance.failures = 0, 0
+	}
+
+	instance.requests++
+	if !failed {
+		instance.consecutiveFailures = 0
+		return
+	}
+	instance.failures++
+	instance.consecutiveFailures++
+
+	reason := ""
+	if instance.consecutiveFailures >= p.config.ConsecutiveFailures {
+		reason = "consecutive_failures"
+	} else if p.config.ErrorRateThreshold > 0 && instance.requests >= p.config.MinRequests &&
+		float64(instance.failures)/float64(instance.requests) >= p.config.ErrorRateThreshold {
+		reason = "error_rate"
+	}
+	if reason == "" {
+		return
+	}
+
+	// Never eject more than the allowed share of instances
+	ejected := 0
+	for _, candidate := range p.instances {
+		if !candidate.ejectedUntil.IsZero() && now.Before(candidate.ejectedUntil) {
+			ejected++
+		}
+	}
+	if (ejected+1)*100 > len(p.instances)*p.config.MaxEjectionPercent {
+		return
+	}
+
+	instance.ejectedUntil = now.Add(time.Duration(p.config.EjectionTime) * time.Millisecond)
+	LogWarn("Backend instance ejected", map[string]interface{}{
+		"route":                p.route,
+		"instance":             instance.url,
+		"reason":               reason,
+		"consecutive_failures": instance.consecutiveFailures,
+		"requests":             instance.requests,
+		"failures":             instance.failures,
+		"ejection_time":        p.config.EjectionTime,
+	})
+	p.notifier.Notify(Event{
+		Type:    EventBackendEjected,
+		Message: "Backend instance ejected",
+		Details: map[string]interface{}{
+			"route":         p.route,
+			"instance":      instance.url,
+			"reason":        reason,
+			"ejection_time": p.config.EjectionTime,
+		},
+	})
+	if p.telemetry != nil {
+		p.telemetry.RecordEjection(ctx, p.route, instance.url, reason)
+	}
+}
+
+// outlierTransport reports the outcome of every upstream attempt to the backend pool
+type outlierTransport struct {
+	next http.RoundTripper
+	pool *BackendPool
+}
+
+// RoundTrip sends the request and reports connection errors and 5xx responses as failures
+func (t *outlierTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if req.Context().Err() == nil {
+		failed := err != nil || resp.StatusCode >= http.StatusInternalServerError
+		t.pool.Report(req.Context(), req.URL.Host, failed)
+	}
+	return resp, err
+}
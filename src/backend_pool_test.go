@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestBackendPoolOutlierDetection tests the ejection and restoration of failing backend instances
+func TestBackendPoolOutlierDetection(t *testing.T) {
+	now := time.Unix(1000, 0)
+	pool := NewBackendPool("/api", []string{"http://a:80", "http://b:80", "http://c:80", "http://d:80"}, OutlierDetectionConfig{
+		Enabled:             true,
+		ConsecutiveFailures: 3,
+		EjectionTime:        1000,
+	}, nil)
+	pool.now = func() time.Time { return now }
+
+	// Two failures do not eject the instance
+	pool.Report(context.Background(), "a:80", true)
+	pool.Report(context.Background(), "a:80", true)
+	if got := pick(pool, 4); got["http://a:80"] != 1 {
+		t.Errorf("Expected instance a in rotation, got %v", got)
+	}
+
+	// A success resets the consecutive failures
+	pool.Report(context.Background(), "a:80", false)
+	pool.Report(context.Background(), "a:80", true)
+	pool.Report(context.Background(), "a:80", true)
+	if got := pick(pool, 4); got["http://a:80"] != 1 {
+		t.Errorf("Expected instance a in rotation after success, got %v", got)
+	}
+
+	// The third consecutive failure ejects the instance
+	pool.Report(context.Background(), "a:80", true)
+	if got := pick(pool, 6); got["http://a:80"] != 0 {
+		t.Errorf("Expected instance a to be ejected, got %v", got)
+	}
+
+	// At most half of the instances may be ejected
+	for i := 0; i < 3; i++ {
+		pool.Report(context.Background(), "b:80", true)
+		pool.Report(context.Background(), "c:80", true)
+	}
+	if got := pick(pool, 4); got["http://b:80"] != 0 || got["http://c:80"] != 2 {
+		t.Errorf("Expected only instance b to be ejected in addition to a, got %v", got)
+	}
+
+	// Ejected instances return after the ejection time
+	now = now.Add(1001 * time.Millisecond)
+	if got := pick(pool, 4); got["http://a:80"] != 1 || got["http://b:80"] != 1 {
+		t.Errorf("Expected ejected instances to be restored, got %v", got)
+	}
+}
+
+// TestBackendPoolErrorRate tests the ejection of instances exceeding the error rate threshold
+func TestBackendPoolErrorRate(t *testing.T) {
+	pool := NewBackendPool("/api", []string{"http://a:80", "http://b:80"}, OutlierDetectionConfig{
+		Enabled:            true,
+		ErrorRateThreshold: 0.5,
+		MinRequests:        4,
+	}, nil)
+
+	pool.Report(context.Background(), "a:80", true)
+	pool.Report(context.Background(), "a:80", false)
+	pool.Report(context.Background(), "a:80", true)
+	if got := pick(pool, 2); got["http://a:80"] != 1 {
+		t.Errorf("Expected instance a in rotation below the minimum requests, got %v", got)
+	}
+
+	pool.Report(context.Background(), "a:80", true)
+	if got := pick(pool, 2); got["http://a:80"] != 0 {
+		t.Errorf("Expected instance a to be ejected, got %v", got)
+	}
+}
+
+// TestProxyHandlerOutlierDetection tests that the proxy stops sending requests to a failing instance
+func TestProxyHandlerOutlierDetection(t *testing.T) {
+	badRequests := 0
+	badServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		badRequests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer badServer.Close()
+	goodServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("OK"))
+	}))
+	defer goodServer.Close()
+
+	proxy := NewProxy(Endpoint{
+		Path:     "/api",
+		Backends: []string{badServer.URL, goodServer.URL},
+		OutlierDetection: OutlierDetectionConfig{
+			Enabled:             true,
+			ConsecutiveFailures: 2,
+		},
+	}, false, nil)
+	handler := proxy.Handler()
+
+	for i := 0; i < 10; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api", nil))
+	}
+
+	if badRequests != 2 {
+		t.Errorf("Expected the failing instance to receive 2 requests, got %d", badRequests)
+	}
+}
+
+// pick returns how often each instance is selected in the given number of picks
+func pick(pool *BackendPool, n int) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		counts[pool.Next()]++
+	}
+	return counts
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BenchOptions configures a load test
+type BenchOptions struct {
+	// Target is the base URL of the gateway under test
+	Target string
+	// Path is the request path
+	Path    string
+	Method  string
+	Headers http.Header
+	Body    string
+	// RPS is the request rate
+	RPS int
+	// Duration is the duration of the load test
+	Duration time.Duration
+	// Concurrency is the maximum number of requests in flight, requests beyond it are dropped
+	Concurrency int
+	Timeout     time.Duration
+}
+
+// BenchResult reports the outcome of a load test
+type BenchResult struct {
+	Requests    int
+	Succeeded   int
+	Failed      int
+	Dropped     int
+	StatusCodes map[string]int
+	Duration    time.Duration
+	RPS         float64
+	Min         time.Duration
+	P50         time.Duration
+	P90         time.Duration
+	P99         time.Duration
+	Max         time.Duration
+}
+
+// Bench sends requests at a constant rate to the target and measures the latencies
+func Bench(ctx context.Context, options BenchOptions) (BenchResult, error) {
+	if options.RPS <= 0 || options.Duration <= 0 {
+		return BenchResult{}, errors.New("rps and duration must be positive")
+	}
+	if options.Concurrency <= 0 {
+		options.Concurrency = 1000
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = options.Concurrency
+	client := &http.Client{Transport: transport, Timeout: options.Timeout}
+	defer transport.CloseIdleConnections()
+
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		latencies []time.Duration
+		result    = BenchResult{StatusCodes: map[string]int{}}
+	)
+	slots := make(chan struct{}, options.Concurrency)
+
+	// Send the requests at a constant rate, independently of the response times
+	ctx, cancel := context.WithTimeout(ctx, options.Duration)
+	defer cancel()
+	ticker := time.NewTicker(time.Second / time.Duration(options.RPS))
+	defer ticker.Stop()
+
+	startTime := time.Now()
+	for ctx.Err() == nil {
+		select {
+		case <-ctx.Done():
+			continue
+		case <-ticker.C:
+		}
+
+		select {
+		case slots <- struct{}{}:
+		default:
+			mu.Lock()
+			result.Dropped++
+			mu.Unlock()
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			var body io.Reader
+			if options.Body != "" {
+				body = strings.NewReader(options.Body)
+			}
+			req, err := http.NewRequest(options.Method, options.Target+options.Path, body)
+			if err != nil {
+				mu.Lock()
+				result.Requests++
+				result.Failed++
+				mu.Unlock()
+				return
+			}
+			for key, values := range options.Headers {
+				req.Header[key] = values
+			}
+
+			requestStart := time.Now()
+			resp, err := client.Do(req)
+			if err == nil {
+				_, _ = io.Copy(io.Discard, resp.Body)
+				_ = resp.Body.Close()
+			}
+			latency := time.Since(requestStart)
+
+			mu.Lock()
+			defer mu.Unlock()
+			result.Requests++
+			if err != nil {
+				result.Failed++
+				result.StatusCodes["error"]++
+				return
+			}
+			result.StatusCodes[strconv.Itoa(resp.StatusCode)]++
+			if resp.StatusCode >= 400 {
+				result.Failed++
+			} else {
+				result.Succeeded++
+			}
+			latencies = append(latencies, latency)
+		}()
+	}
+	wg.Wait()
+	result.Duration = time.Since(startTime)
+
+	// Compute the latency percentiles
+	result.RPS = float64(result.Requests) / result.Duration.Seconds()
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	if len(latencies) > 0 {
+		result.Min = latencies[0]
+		result.P50 = percentile(latencies, 50)
+		result.P90 = percentile(latencies, 90)
+		result.P99 = percentile(latencies, 99)
+		result.Max = latencies[len(latencies)-1]
+	}
+
+	return result, nil
+}
+
+// percentile returns the given percentile of sorted durations
+func percentile(sorted []time.Duration, p int) time.Duration {
+	index := (len(sorted)*p+99)/100 - 1
+	if index < 0 {
+		index = 0
+	}
+	return sorted[index]
+}
+
+// RunBenchCommand runs the bench subcommand with the given arguments.
+// Unless a target is given, the load goes through an in-process gateway built from the configuration.
+func RunBenchCommand(args []string) error {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	configFile := flags.String("config", "", "Path to configuration file")
+	target := flags.String("target", "", "Base URL of a running gateway (defaults to an in-process gateway)")
+	path := flags.String("endpoint", "", "Request path, e.g. /api/users")
+	method := flags.String("method", "GET", "Request method")
+	body := flags.String("body", "", "Request body")
+	rps := flags.Int("rps", 100, "Requests per second")
+	duration := flags.Duration("duration", 10*time.Second, "Duration of the load test")
+	concurrency := flags.Int("concurrency", 1000, "Maximum number of requests in flight")
+	timeout := flags.Duration("timeout", 30*time.Second, "Request timeout")
+	var headerFlags stringList
+	flags.Var(&headerFlags, "header", "Header added to every request, as \"Name: value\" (repeatable)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *path == "" {
+		return errors.New("-endpoint is required")
+	}
+
+	headers := http.Header{}
+	for _, header := range headerFlags {
+		name, value, ok := strings.Cut(header, ":")
+		if !ok {
+			return fmt.Errorf("invalid header: %s", header)
+		}
+		headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	// Serve the configured routes from an in-process gateway
+	if *target == "" {
+		configManager := NewConfigManager()
+		config := configManager.LoadDefault()
+		if *configFile != "" {
+			var err error
+			config, err = configManager.LoadFromFile(*configFile)
+			if err != nil {
+				return err
+			}
+		}
+
+		gateway := NewGateway(config, nil)
+		if err := gateway.Initialize(); err != nil {
+			return err
+		}
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return fmt.Errorf("failed to start in-process gateway: %w", err)
+		}
+		server := &http.Server{Handler: gateway.mux}
+		go func() { _ = server.Serve(listener) }()
+		defer server.Close()
+		*target = "http://" + listener.Addr().String()
+	}
+
+	LogInfo("Starting load test", map[string]interface{}{
+		"target":   *target,
+		"endpoint": *path,
+		"rps":      *rps,
+		"duration": duration.String(),
+	})
+
+	// Keep the request logs of the in-process gateway out of the report
+	SetLogOutput(io.Discard)
+	result, err := Bench(context.Background(), BenchOptions{
+		Target:      strings.TrimSuffix(*target, "/"),
+		Path:        *path,
+		Method:      *method,
+		Headers:     headers,
+		Body:        *body,
+		RPS:         *rps,
+		Duration:    *duration,
+		Concurrency: *concurrency,
+		Timeout:     *timeout,
+	})
+	SetLogOutput(os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	LogInfo("Load test finished", map[string]interface{}{
+		"requests":     result.Requests,
+		"succeeded":    result.Succeeded,
+		"failed":       result.Failed,
+		"dropped":      result.Dropped,
+		"status_codes": result.StatusCodes,
+		"rps":          fmt.Sprintf("%.1f", result.RPS),
+		"latency_min":  result.Min.String(),
+		"latency_p50":  result.P50.String(),
+		"latency_p90":  result.P90.String(),
+		"latency_p99":  result.P99.String(),
+		"latency_max":  result.Max.String(),
+	})
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestBench tests that the load test sends requests at the configured rate and reports latencies
+func TestBench(t *testing.T) {
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Bench") != "1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}))
+	defer backendServer.Close()
+
+	result, err := Bench(context.Background(), BenchOptions{
+		Target:   backendServer.URL,
+		Path:     "/api/users",
+		Method:   "GET",
+		Headers:  http.Header{"X-Bench": {"1"}},
+		RPS:      100,
+		Duration: 300 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Bench() error = %v", err)
+	}
+
+	if result.Requests < 20 || result.Requests > 31 {
+		t.Errorf("Expected about 30 requests, got %d", result.Requests)
+	}
+	if result.Succeeded != result.Requests || result.StatusCodes["200"] != result.Requests {
+		t.Errorf("Expected all requests to succeed, got %+v", result)
+	}
+	if result.P50 < time.Millisecond || result.P50 > result.P99 || result.P99 > result.Max {
+		t.Errorf("Unexpected latency percentiles %+v", result)
+	}
+
+	if _, err := Bench(context.Background(), BenchOptions{Target: backendServer.URL}); err == nil {
+		t.Error("Expected error without rps and duration")
+	}
+}
+
+// TestPercentile tests the nearest-rank percentile computation
+func TestPercentile(t *testing.T) {
+	sorted := []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	tests := []struct {
+		p        int
+		expected time.Duration
+	}{
+		{0, 1},
+		{50, 5},
+		{90, 9},
+		{99, 10},
+		{100, 10},
+	}
+	for _, tt := range tests {
+		if got := percentile(sorted, tt.p); got != tt.expected {
+			t.Errorf("percentile(%d) = %v, want %v", tt.p, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Blue/green target groups
+const (
+	BlueGreenBlue  = "blue"
+	BlueGreenGreen = "green"
+)
+
+// Default blue/green guard settings
+const (
+	defaultBlueGreenGuardWindow  = 60000
+	defaultBlueGreenMaxErrorRate = 0.1
+	defaultBlueGreenMinRequests  = 20
+)
+
+// BlueGreenConfig represents the blue and green target groups of an endpoint, one of them receiving the traffic
+type BlueGreenConfig struct {
+	// Blue and Green list the backend instances of the target groups, balanced in round-robin order
+	Blue  []string `json:"blue"`
+	Green []string `json:"green"`
+	// Active is the group receiving the traffic at startup: blue (default) or green
+	Active string `json:"active"`
+	// GuardWindow is the duration in milliseconds after a switchover during which the error rate is watched (default 60000)
+	GuardWindow int `json:"guard_window"`
+	// MaxErrorRate is the share of server errors during the guard window that rolls the switchover back (default 0.1)
+	MaxErrorRate float64 `json:"max_error_rate"`
+	// MinRequests is the number of requests during the guard window before the error rate is considered (default 20)
+	MinRequests int `json:"min_requests"`
+}
+
+// enabled reports whether both target groups are configured
+func (c BlueGreenConfig) enabled() bool {
+	return len(c.Blue) > 0 && len(c.Green) > 0
+}
+
+// withDefaults returns the configuration with default values applied
+func (c BlueGreenConfig) withDefaults() BlueGreenConfig {
+	if c.Active != BlueGreenGreen {
+		c.Active = BlueGreenBlue
+	}
+	if c.GuardWindow <= 0 {
+		c.GuardWindow = defaultBlueGreenGuardWindow
+	}
+	if c.MaxErrorRate <= 0 {
+		c.MaxErrorRate = defaultBlueGreenMaxErrorRate
+	}
+	if c.MinRequests <= 0 {
+		c.MinRequests = defaultBlueGreenMinRequests
+	}
+	return c
+}
+
+// BlueGreen routes the requests of an endpoint to its active target group and rolls a switchover back
+// if the error rate of the new group spikes during the guard window
+type BlueGreen struct {
+	mu         sync.Mutex
+	route      string
+	config     BlueGreenConfig
+	pools      map[string]*BackendPool
+	active     string
+	previous   string
+	switchedAt time.Time
+	requests   int
+	errors     int
+	notifier   *Notifier
+	now        func() time.Time
+}
+
+// BlueGreenStatus reports the active target group of an endpoint and the guard of the last switchover
+type BlueGreenStatus struct {
+	Endpoint   string          `json:"endpoint"`
+	Active     string          `json:"active"`
+	Backends   []BackendStatus `json:"backends"`
+	SwitchedAt string          `json:"switched_at,omitempty"`
+	// Guarded reports whether the switchover is still in its guard window, with the requests and errors seen so far
+	Guarded  bool `json:"guarded"`
+	Requests int  `json:"requests,omitempty"`
+	Errors   int  `json:"errors,omitempty"`
+}
+
+// NewBlueGreen creates a new BlueGreen for the target groups of an endpoint
+func NewBlueGreen(route string, config BlueGreenConfig, outlierDetection OutlierDetectionConfig, telemetry *TelemetryManager) *BlueGreen {
+	config = config.withDefaults()
+	return &BlueGreen{
+		route:  route,
+		config: config,
+		pools: map[string]*BackendPool{
+			BlueGreenBlue:  NewBackendPool(route, config.Blue, outlierDetection, telemetry),
+			BlueGreenGreen: NewBackendPool(route, config.Green, outlierDetection, telemetry),
+		},
+		active: config.Active,
+		now:    time.Now,
+	}
+}
+
+// Next returns the next backend instance of the active target group
+func (b *BlueGreen) Next() string {
+	b.mu.Lock()
+	pool := b.pools[b.active]
+	b.mu.Unlock()
+	return pool.Next()
+}
+
+// Switch makes the given target group receive the traffic and starts the guard window.
+// It reports false if the group is unknown.
+func (b *BlueGreen) Switch(target string) bool {
+	if target != BlueGreenBlue && target != BlueGreenGreen {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if target == b.active {
+		return true
+	}
+	b.previous = b.active
+	b.active = target
+	b.switchedAt = b.now()
+	b.requests = 0
+	b.errors = 0
+	return true
+}
+
+// guarded reports whether the last switchover is in its guard window, the lock must be held
+func (b *BlueGreen) guarded(now time.Time) bool {
+	return b.previous != "" && now.Before(b.switchedAt.Add(time.Duration(b.config.GuardWindow)*time.Millisecond))
+}
+
+// Record counts a response of the active target group during the guard window and rolls the switchover
+// back if the error rate exceeds the maximum
+func (b *BlueGreen) Record(status int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.guarded(b.now()) {
+		return
+	}
+	b.requests++
+	if status >= 500 {
+		b.errors++
+	}
+	errorRate := float64(b.errors) / float64(b.requests)
+	if b.requests < b.config.MinRequests || errorRate <= b.config.MaxErrorRate {
+		return
+	}
+
+	// Roll back, the guard ends with it
+	failed := b.active
+	b.active = b.previous
+	b.previous = ""
+	details := map[string]interface{}{
+		"route":      b.route,
+		"failed":     failed,
+		"active":     b.active,
+		"requests":   b.requests,
+		"errors":     b.errors,
+		"error_rate": errorRate,
+	}
+	LogError("Blue/green switchover rolled back", nil, details)
+	b.notifier.Notify(Event{Type: EventBlueGreenRollback, Message: "Blue/green switchover rolled back", Details: details})
+}
+
+// Middleware records the responses of the endpoint for the guard of the last switchover
+func (b *BlueGreen) Middleware(endpoint Endpoint, next http.Handler) http.Handler {
+	if b == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lrw := NewLoggingResponseWriter(w)
+		lrw.bodyLimit = 0
+		next.ServeHTTP(lrw, r)
+		b.Record(lrw.statusCode)
+	})
+}
+
+// Status returns the active target group, its backend instances and the guard of the last switchover
+func (b *BlueGreen) Status() BlueGreenStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BlueGreenStatus{
+		Endpoint: b.route,
+		Active:   b.active,
+		Backends: b.pools[b.active].Statuses(),
+	}
+	if !b.switchedAt.IsZero() {
+		status.SwitchedAt = b.switchedAt.UTC().Format(time.RFC3339)
+	}
+	if b.guarded(b.now()) {
+		status.Guarded = true
+		status.Requests = b.requests
+		status.Errors = b.errors
+	}
+	return status
+}
+
+// blueGreenSwitch is the body of a switchover request
+type blueGreenSwitch struct {
+	Endpoint string `json:"endpoint"`
+	Target   string `json:"target"`
+}
+
+// handleBlueGreen lists the target groups of the blue/green endpoints or switches one of them
+func (g *Gateway) handleBlueGreen(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		statuses := []BlueGreenStatus{}
+		for _, proxy := range g.proxies {
+			if blueGreen := proxy.Current().blueGreen; blueGreen != nil {
+				statuses = append(statuses, blueGreen.Status())
+			}
+		}
+		sort.Slice(statuses, func(i, j int) bool { return statuses[i].Endpoint < statuses[j].Endpoint })
+		writeJSON(w, http.StatusOK, statuses)
+	case http.MethodPost:
+		var request blueGreenSwitch
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid switchover: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		proxy, ok := g.proxies[request.Endpoint]
+		if ok {
+			proxy = proxy.Current()
+		}
+		if !ok || proxy.blueGreen == nil {
+			http.Error(w, "Blue/green endpoint not found", http.StatusNotFound)
+			return
+		}
+		if !proxy.blueGreen.Switch(request.Target) {
+			http.Error(w, "Invalid switchover: the target must be blue or green", http.StatusBadRequest)
+			return
+		}
+		LogAudit("Blue/green switchover", map[string]interface{}{
+			"endpoint":    request.Endpoint,
+			"target":      request.Target,
+			"remote_addr": r.RemoteAddr,
+		})
+		writeJSON(w, http.StatusOK, proxy.blueGreen.Status())
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
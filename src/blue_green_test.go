@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestBlueGreenSwitch tests that the admin switchover routes the requests to the other target group
+func TestBlueGreenSwitch(t *testing.T) {
+	blue := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("blue"))
+	}))
+	defer blue.Close()
+	green := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("green"))
+	}))
+	defer green.Close()
+
+	gateway := NewGateway(Config{
+		Endpoints: []Endpoint{{Path: "/api/", BlueGreen: BlueGreenConfig{Blue: []string{blue.URL}, Green: []string{green.URL}}}},
+		Admin:     AdminConfig{Enabled: true, Token: "secret"},
+	}, nil)
+	gateway.RegisterEndpoints()
+	gateway.RegisterAdminEndpoints()
+
+	get := func() string {
+		rr := httptest.NewRecorder()
+		gateway.mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/a", nil))
+		return rr.Body.String()
+	}
+	if body := get(); body != "blue" {
+		t.Fatalf("expected the blue group to be active, got %q", body)
+	}
+
+	switchTo := func(endpoint, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/admin/blue-green", strings.NewReader(`{"endpoint":"`+endpoint+`","target":"`+target+`"}`))
+		req.Header.Set("Authorization", "Bearer secret")
+		rr := httptest.NewRecorder()
+		gateway.mux.ServeHTTP(rr, req)
+		return rr
+	}
+	if rr := switchTo("/other/", "green"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for an unknown endpoint, got %d", rr.Code)
+	}
+	if rr := switchTo("/api/", "red"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an unknown group, got %d", rr.Code)
+	}
+	rr := switchTo("/api/", "green")
+	var status BlueGreenStatus
+	if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("unexpected switchover response %d %q", rr.Code, rr.Body.String())
+	}
+	if status.Active != BlueGreenGreen || !status.Guarded || len(status.Backends) != 1 || status.Backends[0].URL != green.URL {
+		t.Errorf("expected the guarded green group, got %+v", status)
+	}
+	if body := get(); body != "green" {
+		t.Errorf("expected the green group after the switchover, got %q", body)
+	}
+
+	req := httptest.NewRequest("GET", "/admin/blue-green", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr = httptest.NewRecorder()
+	gateway.mux.ServeHTTP(rr, req)
+	var statuses []BlueGreenStatus
+	if err := json.Unmarshal(rr.Body.Bytes(), &statuses); err != nil || len(statuses) != 1 || statuses[0].Requests != 1 {
+		t.Errorf("expected the status of the endpoint with one guarded request, got %q", rr.Body.String())
+	}
+}
+
+// TestBlueGreenRollback tests that a switchover is rolled back when the error rate spikes during the guard window only
+func TestBlueGreenRollback(t *testing.T) {
+	b := NewBlueGreen("/api/", BlueGreenConfig{
+		Blue:         []string{"http://blue"},
+		Green:        []string{"http://green"},
+		GuardWindow:  1000,
+		MaxErrorRate: 0.5,
+		MinRequests:  4,
+	}, OutlierDetectionConfig{}, nil)
+	now := time.Unix(1000, 0)
+	b.now = func() time.Time { return now }
+
+	// Errors are not counted before a switchover
+	b.Record(http.StatusBadGateway)
+	if b.Next() != "http://blue" || b.Status().Guarded {
+		t.Fatalf("expected the unguarded blue group, got %+v", b.Status())
+	}
+
+	b.Switch(BlueGreenGreen)
+	for _, status := range []int{200, 502, 502} {
+		b.Record(status)
+	}
+	if b.Next() != "http://green" {
+		t.Fatal("expected no rollback below the minimum requests")
+	}
+	b.Record(502)
+	if status := b.Status(); status.Active != BlueGreenBlue || status.Guarded {
+		t.Fatalf("expected a rollback to the blue group, got %+v", status)
+	}
+
+	// Errors after the guard window are ignored
+	b.Switch(BlueGreenGreen)
+	now = now.Add(time.Second)
+	for i := 0; i < 10; i++ {
+		b.Record(502)
+	}
+	if b.Next() != "http://green" {
+		t.Error("expected no rollback after the guard window")
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// Request body buffering policies
+const (
+	RequestBufferingStream = "stream"
+	RequestBufferingBuffer = "buffer"
+)
+
+// defaultMaxBufferedBodyBytes is the maximum size of a buffered request body if none is configured
+const defaultMaxBufferedBodyBytes = 10 * 1024 * 1024
+
+// RequestBodyConfig represents how request bodies are passed to the backend
+type RequestBodyConfig struct {
+	// Buffering is stream (default), passing the body through as it is received, or buffer, reading the whole
+	// body first so it can be retried and sent with a Content-Length
+	Buffering string `json:"buffering"`
+	// MaxBytes is the maximum body size, larger requests are rejected with 413 (unlimited when streaming
+	// if 0, 10 MiB when buffering)
+	MaxBytes int64 `json:"max_bytes"`
+	// Multipart configures the constraints on multipart/form-data uploads
+	Multipart MultipartConfig `json:"multipart"`
+}
+
+// maxBytes returns the maximum body size, 0 meaning unlimited
+func (c RequestBodyConfig) maxBytes() int64 {
+	if c.MaxBytes <= 0 && c.Buffering == RequestBufferingBuffer {
+		return defaultMaxBufferedBodyBytes
+	}
+	return c.MaxBytes
+}
+
+// applyRequestBodyPolicy limits the size of the request body, validates multipart uploads and buffers the
+// body if configured
+func applyRequestBodyPolicy(w http.ResponseWriter, r *http.Request, config RequestBodyConfig) error {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+
+	if limit := config.maxBytes(); limit > 0 {
+		if r.ContentLength > limit {
+			return &http.MaxBytesError{Limit: limit}
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+	}
+	applyMultipartConstraints(r, config.Multipart)
+
+	if config.Buffering != RequestBufferingBuffer {
+		return nil
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.TransferEncoding = nil
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return nil
+}
+
+// requestBodyErrorStatus returns the status of a request failing to read the request body
+func requestBodyErrorStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return http.StatusRequestEntityTooLarge
+	}
+	var multipartErr *MultipartError
+	if errors.As(err, &multipartErr) {
+		return multipartErr.Status
+	}
+	return http.StatusBadRequest
+}
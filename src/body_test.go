@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// TestRequestBodyLimit tests that bodies above the maximum size are rejected with 413
+func TestRequestBodyLimit(t *testing.T) {
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+	}))
+	defer backendServer.Close()
+
+	for _, buffering := range []string{RequestBufferingStream, RequestBufferingBuffer} {
+		handler := NewProxy(Endpoint{
+			Path:        "/upload",
+			Backend:     backendServer.URL,
+			RequestBody: RequestBodyConfig{Buffering: buffering, MaxBytes: 1024},
+		}, false, nil).Handler()
+
+		// Declared length above the maximum
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("POST", "/upload", bytes.NewReader(make([]byte, 2048))))
+		if rr.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: expected status 413 for a declared length above the maximum, got %d", buffering, rr.Code)
+		}
+
+		// Chunked body exceeding the maximum while it is read
+		req := httptest.NewRequest("POST", "/upload", io.MultiReader(bytes.NewReader(make([]byte, 2048))))
+		req.ContentLength = -1
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: expected status 413 for a chunked body above the maximum, got %d", buffering, rr.Code)
+		}
+
+		// Bodies within the maximum are proxied
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("POST", "/upload", bytes.NewReader(make([]byte, 512))))
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: expected status 200, got %d", buffering, rr.Code)
+		}
+	}
+}
+
+// TestRequestBodyBuffering tests that buffered bodies are sent with a Content-Length and can be retried
+func TestRequestBodyBuffering(t *testing.T) {
+	var attempts atomic.Int32
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(strconv.FormatInt(r.ContentLength, 10) + " " + string(body)))
+	}))
+	defer backendServer.Close()
+
+	handler := NewProxy(Endpoint{
+		Path:        "/upload",
+		Backend:     backendServer.URL,
+		RequestBody: RequestBodyConfig{Buffering: RequestBufferingBuffer},
+		Retry:       RetryConfig{MaxRetries: 1, RetryOn: []int{http.StatusServiceUnavailable}},
+	}, false, nil).Handler()
+
+	req := httptest.NewRequest("PUT", "/upload", io.MultiReader(strings.NewReader("payload")))
+	req.ContentLength = -1
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || rr.Body.String() != "7 payload" {
+		t.Errorf("Expected the buffered body to be retried with a Content-Length, got %d %q", rr.Code, rr.Body.String())
+	}
+}
+
+// TestDebugLoggingStreamsRequestBody tests that debug logging only reads the beginning of large request bodies
+func TestDebugLoggingStreamsRequestBody(t *testing.T) {
+	var received atomic.Int64
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := io.Copy(io.Discard, r.Body)
+		received.Store(n)
+	}))
+	defer backendServer.Close()
+
+	var logs bytes.Buffer
+	SetLogOutput(&logs)
+	defer SetLogOutput(os.Stdout)
+
+	size := int64(3 * maxLoggedBodyBytes)
+	handler := NewProxy(Endpoint{Path: "/upload", Backend: backendServer.URL}, true, nil).Handler()
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/upload", strings.NewReader(strings.Repeat("a", int(size)))))
+	if rr.Code != http.StatusOK || received.Load() != size {
+		t.Errorf("Expected the whole body of %d bytes to be proxied, got %d %d", size, rr.Code, received.Load())
+	}
+	if logs.Len() > 3*maxLoggedBodyBytes {
+		t.Errorf("Expected only the beginning of the body to be logged, got %d bytes of logs", logs.Len())
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"sync"
+)
+
+// proxyBufferSize is the size of the buffers used to copy response bodies, the size io.Copy allocates
+const proxyBufferSize = 32 * 1024
+
+// maxPooledLogBufferSize is the capacity above which log buffers are not returned to the pool,
+// so an occasional huge entry does not stay in memory
+const maxPooledLogBufferSize = 256 * 1024
+
+// bufferPool is a sync.Pool-backed httputil.BufferPool reusing the buffers of response body copies
+type bufferPool struct {
+	pool sync.Pool
+}
+
+// newBufferPool creates a new bufferPool of buffers of the given size
+func newBufferPool(size int) *bufferPool {
+	return &bufferPool{pool: sync.Pool{
+		New: func() interface{} {
+			buf := make([]byte, size)
+			return &buf
+		},
+	}}
+}
+
+// Get returns a buffer from the pool
+func (p *bufferPool) Get() []byte {
+	return *p.pool.Get().(*[]byte)
+}
+
+// Put returns a buffer to the pool
+func (p *bufferPool) Put(buf []byte) {
+	p.pool.Put(&buf)
+}
+
+// proxyBuffers is shared by the reverse proxies of all endpoints
+var proxyBuffers = newBufferPool(proxyBufferSize)
+
+// logBuffers holds the buffers log entries are encoded into
+var logBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 1024)
+		return &buf
+	},
+}
+
+// getLogBuffer returns an empty buffer from the log buffer pool
+func getLogBuffer() *[]byte {
+	buf := logBuffers.Get().(*[]byte)
+	*buf = (*buf)[:0]
+	return buf
+}
+
+// putLogBuffer returns a buffer to the log buffer pool unless it grew too large
+func putLogBuffer(buf *[]byte) {
+	if cap(*buf) > maxPooledLogBufferSize {
+		return
+	}
+	logBuffers.Put(buf)
+}
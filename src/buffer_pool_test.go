@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestLogJSONPooledBuffer tests that log entries encoded in pooled buffers are complete lines
+func TestLogJSONPooledBuffer(t *testing.T) {
+	var buf bytes.Buffer
+	SetLogOutput(&buf)
+	defer SetLogOutput(os.Stdout)
+
+	LogInfo("first", map[string]interface{}{"body": strings.Repeat("x", 2*maxPooledLogBufferSize)})
+	LogInfo("second", nil)
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 log lines, got %d", len(lines))
+	}
+	for i, message := range []string{"first", "second"} {
+		var entry LogEntry
+		if err := json.Unmarshal([]byte(lines[i]), &entry); err != nil || entry.Message != message {
+			t.Errorf("expected entry %q, got %q (%v)", message, lines[i], err)
+		}
+	}
+}
+
+// BenchmarkCopyBuffer compares copying response bodies with pooled and freshly allocated buffers
+func BenchmarkCopyBuffer(b *testing.B) {
+	body := bytes.Repeat([]byte("x"), 256*1024)
+
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf := proxyBuffers.Get()
+			_, _ = io.CopyBuffer(io.Discard, bytes.NewReader(body), buf)
+			proxyBuffers.Put(buf)
+		}
+	})
+	b.Run("allocated", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf := make([]byte, proxyBufferSize)
+			_, _ = io.CopyBuffer(io.Discard, bytes.NewReader(body), buf)
+		}
+	})
+}
+
+// BenchmarkLogJSON compares encoding log entries into pooled buffers with marshaling and printing them
+func BenchmarkLogJSON(b *testing.B) {
+	SetLogOutput(io.Discard)
+	defer SetLogOutput(os.Stdout)
+	additional := map[string]interface{}{"path": "/api/users", "backend": "http://backend:8080", "attempt": 1}
+
+	b.Run("encoded", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			LogInfo("Retrying upstream request", additional)
+		}
+	})
+	b.Run("marshaled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			jsonBytes, _ := json.Marshal(LogEntry{Level: "info", Message: "Retrying upstream request", Type: "log", Additional: additional})
+			_, _ = fmt.Fprintln(io.Discard, string(jsonBytes))
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				LogInfo("Retrying upstream request", additional)
+			}
+		})
+	})
+}
+
+// BenchmarkProxyResponse measures proxying a large response body through an endpoint
+func BenchmarkProxyResponse(b *testing.B) {
+	SetLogOutput(io.Discard)
+	defer SetLogOutput(os.Stdout)
+
+	body := bytes.Repeat([]byte("x"), 256*1024)
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(body)
+	}))
+	defer backendServer.Close()
+
+	handler := NewProxy(Endpoint{Path: "/download", Backend: backendServer.URL}, false, nil).Handler()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/download", nil))
+		if rr.Code != http.StatusOK {
+			b.Fatalf("expected status 200, got %d", rr.Code)
+		}
+	}
+}
@@ -0,0 +1,708 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default response cache settings
+const (
+	defaultCacheMaxEntries    = 10000
+	defaultCacheMaxBodyBytes  = 1024 * 1024
+	defaultSurrogateKeyHeader = "Surrogate-Key"
+)
+
+// CacheConfig represents the configuration of the response cache shared by all endpoints
+type CacheConfig struct {
+	// MaxEntries is the maximum number of cached responses, the least recently used are evicted first
+	MaxEntries int `json:"max_entries"`
+	// SurrogateKeyHeader is the backend response header tagging cached responses with
+	// space-separated surrogate keys for purging (default Surrogate-Key)
+	SurrogateKeyHeader string `json:"surrogate_key_header"`
+}
+
+// EndpointCacheConfig represents the caching of the responses of an endpoint
+type EndpointCacheConfig struct {
+	Enabled bool `json:"enabled"`
+	// TTL is the freshness lifetime in milliseconds of responses without Cache-Control max-age or Expires
+	TTL int `json:"ttl"`
+	// StaleWhileRevalidate is the time in milliseconds a stale response may be served while it is
+	// revalidated in the background, unless the backend sends a stale-while-revalidate directive
+	StaleWhileRevalidate int `json:"stale_while_revalidate"`
+	// MaxBodyBytes is the maximum size of a cached response body (default 1 MiB)
+	MaxBodyBytes int `json:"max_body_bytes"`
+	// CacheCookies caches the responses of requests with cookies, which bypass the cache otherwise, for
+	// backends whose responses do not depend on the cookies
+	CacheCookies bool `json:"cache_cookies"`
+}
+
+// cacheableStatusCodes lists the status codes of responses that may be cached
+var cacheableStatusCodes = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusGone:                 true,
+}
+
+// uncachedHeaders lists the response headers that are not stored with a cached response
+var uncachedHeaders = []string{
+	"Age", "Connection", "Keep-Alive", "Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade", "X-Cache",
+}
+
+// cacheEntry is a cached response. Entries are never modified once stored.
+type cacheEntry struct {
+	key        string
+	path       string
+	status     int
+	header     http.Header
+	body       []byte
+	storedAt   time.Time
+	freshUntil time.Time
+	staleUntil time.Time
+	// vary holds the request header values the response varies on
+	vary map[string]string
+	// surrogateKeys are the keys the response was tagged with by the backend
+	surrogateKeys []string
+}
+
+// ResponseCache is an LRU cache of backend responses honoring the HTTP caching headers
+type ResponseCache struct {
+	mu                 sync.Mutex
+	maxEntries         int
+	surrogateKeyHeader string
+	entries            map[string]*list.Element
+	lru                *list.List
+	// surrogates maps a surrogate key to the cache keys of the responses tagged with it
+	surrogates   map[string]map[string]bool
+	revalidating map[string]bool
+	telemetry    *TelemetryManager
+	now          func() time.Time
+}
+
+// NewResponseCache creates a new ResponseCache
+func NewResponseCache(config CacheConfig, telemetry *TelemetryManager) *ResponseCache {
+	maxEntries := config.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultCacheMaxEntries
+	}
+	surrogateKeyHeader := config.SurrogateKeyHeader
+	if surrogateKeyHeader == "" {
+		surrogateKeyHeader = defaultSurrogateKeyHeader
+	}
+	return &ResponseCache{
+		maxEntries:         maxEntries,
+		surrogateKeyHeader: surrogateKeyHeader,
+		entries:            make(map[string]*list.Element),
+		lru:                list.New(),
+		surrogates:         make(map[string]map[string]bool),
+		revalidating:       make(map[string]bool),
+		telemetry:          telemetry,
+		now:                time.Now,
+	}
+}
+
+// cacheKey returns the cache key of a request to an endpoint
+func cacheKey(endpoint Endpoint, r *http.Request) string {
+	uri := r.URL.RequestURI()
+
+	// Query parameters stripped by the query policy do not vary the response
+	if endpoint.QueryPolicy.enabled() {
+		u := *r.URL
+		query := u.Query()
+		if len(endpoint.QueryPolicy.strip(query, nil)) > 0 {
+			u.RawQuery = query.Encode()
+			uri = u.RequestURI()
+		}
+	}
+	return r.Method + " " + r.Host + uri
+}
+
+// get returns the cached response for a request, or nil if there is none or it varies
+func (c *ResponseCache) get(key string, r *http.Request) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := element.Value.(*cacheEntry)
+	for name, value := range entry.vary {
+		if r.Header.Get(name) != value {
+			return nil
+		}
+	}
+	c.lru.MoveToFront(element)
+	return entry
+}
+
+// fallback returns the cached response of a request to an endpoint, even if stale, to answer in place of
+// a failed backend response
+func (c *ResponseCache) fallback(endpoint Endpoint, r *http.Request) *cacheEntry {
+	if c == nil || !endpoint.Cache.Enabled || r.Method != http.MethodGet {
+		return nil
+	}
+	return c.get(cacheKey(endpoint, r), r)
+}
+
+// set stores a response, evicting the least recently used ones beyond the maximum
+func (c *ResponseCache) set(entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[entry.key]; ok {
+		c.removeElement(element)
+	}
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	for _, surrogateKey := range entry.surrogateKeys {
+		if c.surrogates[surrogateKey] == nil {
+			c.surrogates[surrogateKey] = make(map[string]bool)
+		}
+		c.surrogates[surrogateKey][entry.key] = true
+	}
+
+	for c.lru.Len() > c.maxEntries {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+// remove removes a cached response
+func (c *ResponseCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.removeElement(element)
+	}
+}
+
+// removeElement removes a cached response and its surrogate keys, the caller must hold the lock
+func (c *ResponseCache) removeElement(element *list.Element) {
+	entry := element.Value.(*cacheEntry)
+	c.lru.Remove(element)
+	delete(c.entries, entry.key)
+	for _, surrogateKey := range entry.surrogateKeys {
+		delete(c.surrogates[surrogateKey], entry.key)
+		if len(c.surrogates[surrogateKey]) == 0 {
+			delete(c.surrogates, surrogateKey)
+		}
+	}
+}
+
+// Len returns the number of cached responses
+func (c *ResponseCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// PurgeSurrogateKeys removes the responses tagged with any of the surrogate keys and returns their number
+func (c *ResponseCache) PurgeSurrogateKeys(surrogateKeys []string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	purged := 0
+	for _, surrogateKey := range surrogateKeys {
+		for key := range c.surrogates[surrogateKey] {
+			if element, ok := c.entries[key]; ok {
+				c.removeElement(element)
+				purged++
+			}
+		}
+	}
+	return purged
+}
+
+// PurgePaths removes the responses for the given request paths, or for all paths starting with
+// the prefix if it is not empty, and returns their number
+func (c *ResponseCache) PurgePaths(paths []string, prefix string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	purged := 0
+	for element := c.lru.Front(); element != nil; {
+		next := element.Next()
+		entry := element.Value.(*cacheEntry)
+		if containsString(paths, entry.path) || (prefix != "" && strings.HasPrefix(entry.path, prefix)) {
+			c.removeElement(element)
+			purged++
+		}
+		element = next
+	}
+	return purged
+}
+
+// PurgeAll removes all cached responses and returns their number
+func (c *ResponseCache) PurgeAll() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	purged := c.lru.Len()
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.surrogates = make(map[string]map[string]bool)
+	return purged
+}
+
+// Middleware caches the GET responses of an endpoint with caching enabled
+func (c *ResponseCache) Middleware(endpoint Endpoint, next http.Handler) http.Handler {
+	if !endpoint.Cache.Enabled {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Only cache anonymous GET requests, as responses to cookies or to an identity forwarded by the gateway,
+		// e.g. the OIDC identity headers, may be personalized without Cache-Control private; range requests are
+		// streamed from the backend and protocol upgrades are spliced to it
+		requestDirectives := parseCacheControl(r.Header.Get("Cache-Control"))
+		anonymous := !authenticatedCaller(r) && r.Header.Get("Authorization") == "" &&
+			(endpoint.Cache.CacheCookies || r.Header.Get("Cookie") == "")
+		if _, noStore := requestDirectives["no-store"]; noStore || r.Method != http.MethodGet || !anonymous ||
+			r.Header.Get("Range") != "" || r.Header.Get("Upgrade") != "" {
+			c.record(r, endpoint, "bypass")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := cacheKey(endpoint, r)
+		entry := c.get(key, r)
+		_, noCache := requestDirectives["no-cache"]
+		now := c.now()
+
+		switch {
+		case entry != nil && !noCache && now.Before(entry.freshUntil):
+			c.serve(w, r, entry, "HIT")
+			c.record(r, endpoint, "hit")
+		case entry != nil && !noCache && now.Before(entry.staleUntil):
+			c.serve(w, r, entry, "STALE")
+			c.record(r, endpoint, "stale")
+			c.revalidateInBackground(endpoint, key, entry, r, next)
+		default:
+			c.fetch(endpoint, key, entry, w, r, next)
+		}
+	})
+}
+
+// record records the outcome of a cache lookup
+func (c *ResponseCache) record(r *http.Request, endpoint Endpoint, result string) {
+	if c.telemetry != nil {
+		c.telemetry.RecordCacheResult(r.Context(), metricsRoute(endpoint), result)
+	}
+}
+
+// serve writes a cached response, answering conditional requests of the client with 304
+func (c *ResponseCache) serve(w http.ResponseWriter, r *http.Request, entry *cacheEntry, result string) {
+	header := w.Header()
+	for key, values := range entry.header {
+		header[key] = append([]string(nil), values...)
+	}
+	header.Set("Age", strconv.Itoa(int(c.now().Sub(entry.storedAt).Seconds())))
+	header.Set("X-Cache", result)
+
+	if notModified(r, entry.header) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(entry.status)
+	_, _ = w.Write(entry.body)
+}
+
+// notModified checks whether the validators of a conditional request match the response headers
+func notModified(r *http.Request, header http.Header) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etagMatches(ifNoneMatch, header.Get("ETag"))
+	}
+	if ifModifiedSince := r.Header.Get("If-Modified-Since"); ifModifiedSince != "" {
+		since, err := http.ParseTime(ifModifiedSince)
+		if err != nil {
+			return false
+		}
+		lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+		return err == nil && !lastModified.After(since)
+	}
+	return false
+}
+
+// etagMatches checks whether an If-None-Match header matches an entity tag using weak comparison
+func etagMatches(ifNoneMatch, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// conditionalRequest returns the request with the validators of the cached response added,
+// and whether any were added. Requests that are already conditional are left unchanged.
+func conditionalRequest(r *http.Request, entry *cacheEntry) (*http.Request, bool) {
+	if entry == nil || r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != "" {
+		return r, false
+	}
+
+	etag, lastModified := entry.header.Get("ETag"), entry.header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return r, false
+	}
+
+	r = r.Clone(r.Context())
+	if etag != "" {
+		r.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		r.Header.Set("If-Modified-Since", lastModified)
+	}
+	return r, true
+}
+
+// fetch forwards the request to the backend, revalidating the cached response if there is one,
+// and stores the response if it is cacheable
+func (c *ResponseCache) fetch(endpoint Endpoint, key string, entry *cacheEntry, w http.ResponseWriter, r *http.Request, next http.Handler) {
+	upstreamRequest, conditional := conditionalRequest(r, entry)
+	headerBefore := w.Header().Clone()
+
+	cw := &cacheWriter{
+		ResponseWriter: w,
+		intercept:      conditional,
+		limit:          maxBodyBytes(endpoint),
+		stripHeader:    c.surrogateKeyHeader,
+	}
+	next.ServeHTTP(cw, upstreamRequest)
+
+	// Serve the cached response if the backend confirmed it is still valid
+	if cw.notModified {
+		for key := range w.Header() {
+			delete(w.Header(), key)
+		}
+		for key, values := range headerBefore {
+			w.Header()[key] = values
+		}
+		refreshed := c.refresh(endpoint, entry, cw.header)
+		c.serve(w, r, refreshed, "REVALIDATED")
+		c.record(r, endpoint, "revalidated")
+		return
+	}
+
+	c.record(r, endpoint, "miss")
+	if !cw.overflow {
+		if stored := c.newEntry(endpoint, key, r, cw.status, cw.header, cw.body.Bytes()); stored != nil {
+			c.set(stored)
+		}
+	}
+}
+
+// revalidateInBackground revalidates a stale response without blocking the client
+func (c *ResponseCache) revalidateInBackground(endpoint Endpoint, key string, entry *cacheEntry, r *http.Request, next http.Handler) {
+	c.mu.Lock()
+	if c.revalidating[key] {
+		c.mu.Unlock()
+		return
+	}
+	c.revalidating[key] = true
+	c.mu.Unlock()
+
+	// Detach the request from the client connection, which is done once the stale response is served
+	r = r.Clone(context.WithoutCancel(r.Context()))
+	r.Body = http.NoBody
+
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.revalidating, key)
+			c.mu.Unlock()
+		}()
+
+		upstreamRequest, _ := conditionalRequest(r, entry)
+		cw := &cacheWriter{
+			ResponseWriter: &discardResponseWriter{header: http.Header{}},
+			intercept:      true,
+			limit:          maxBodyBytes(endpoint),
+			stripHeader:    c.surrogateKeyHeader,
+		}
+		next.ServeHTTP(cw, upstreamRequest)
+
+		if cw.notModified {
+			c.refresh(endpoint, entry, cw.header)
+			return
+		}
+		if stored := c.newEntry(endpoint, key, r, cw.status, cw.header, cw.body.Bytes()); stored != nil && !cw.overflow {
+			c.set(stored)
+		} else {
+			c.remove(key)
+		}
+	}()
+}
+
+// refresh stores a revalidated copy of a cached response, updated with the headers of the 304 response
+func (c *ResponseCache) refresh(endpoint Endpoint, entry *cacheEntry, notModifiedHeader http.Header) *cacheEntry {
+	header := entry.header.Clone()
+	for _, name := range []string{"Cache-Control", "Date", "ETag", "Expires", "Last-Modified", "Vary"} {
+		if value := notModifiedHeader.Values(name); len(value) > 0 {
+			header[name] = value
+		}
+	}
+
+	refreshed := &cacheEntry{
+		key:           entry.key,
+		path:          entry.path,
+		status:        entry.status,
+		header:        header,
+		body:          entry.body,
+		vary:          entry.vary,
+		surrogateKeys: entry.surrogateKeys,
+	}
+	c.setLifetime(endpoint, refreshed)
+	c.set(refreshed)
+	return refreshed
+}
+
+// newEntry creates a cache entry for a response, or returns nil if the response may not be cached
+func (c *ResponseCache) newEntry(endpoint Endpoint, key string, r *http.Request, status int, header http.Header, body []byte) *cacheEntry {
+	directives := parseCacheControl(header.Get("Cache-Control"))
+	_, noStore := directives["no-store"]
+	_, private := directives["private"]
+	if !cacheableStatusCodes[status] || noStore || private || header.Get("Set-Cookie") != "" || header.Get("Vary") == "*" ||
+		header.Get("Trailer") != "" {
+		return nil
+	}
+
+	entry := &cacheEntry{
+		key:    key,
+		path:   r.URL.Path,
+		status: status,
+		header: header.Clone(),
+		body:   append([]byte(nil), body...),
+		vary:   make(map[string]string),
+	}
+	for _, name := range uncachedHeaders {
+		entry.header.Del(name)
+	}
+	for _, value := range header.Values(c.surrogateKeyHeader) {
+		entry.surrogateKeys = append(entry.surrogateKeys, strings.Fields(value)...)
+	}
+	entry.header.Del(c.surrogateKeyHeader)
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				entry.vary[name] = r.Header.Get(name)
+			}
+		}
+	}
+
+	c.setLifetime(endpoint, entry)
+
+	// Responses that are neither fresh nor servable stale are only useful with validators
+	if !entry.staleUntil.After(entry.storedAt) && header.Get("ETag") == "" && header.Get("Last-Modified") == "" {
+		return nil
+	}
+	return entry
+}
+
+// setLifetime computes the freshness and stale-while-revalidate lifetimes of an entry from its headers
+func (c *ResponseCache) setLifetime(endpoint Endpoint, entry *cacheEntry) {
+	now := c.now()
+	directives := parseCacheControl(entry.header.Get("Cache-Control"))
+
+	ttl := time.Duration(endpoint.Cache.TTL) * time.Millisecond
+	if seconds, ok := directiveSeconds(directives, "s-maxage"); ok {
+		ttl = seconds
+	} else if seconds, ok := directiveSeconds(directives, "max-age"); ok {
+		ttl = seconds
+	} else if expires := entry.header.Get("Expires"); expires != "" {
+		ttl = 0
+		if expiresAt, err := http.ParseTime(expires); err == nil {
+			ttl = expiresAt.Sub(now)
+		}
+	}
+	if _, ok := directives["no-cache"]; ok {
+		ttl = 0
+	}
+
+	swr := time.Duration(endpoint.Cache.StaleWhileRevalidate) * time.Millisecond
+	if seconds, ok := directiveSeconds(directives, "stale-while-revalidate"); ok {
+		swr = seconds
+	} else if _, ok := directives["must-revalidate"]; ok {
+		swr = 0
+	}
+
+	entry.storedAt = now
+	entry.freshUntil = now.Add(max(ttl, 0))
+	entry.staleUntil = entry.freshUntil.Add(max(swr, 0))
+}
+
+// parseCacheControl parses a Cache-Control header into its directives
+func parseCacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for _, directive := range strings.Split(value, ",") {
+		name, argument, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if name != "" {
+			directives[strings.ToLower(name)] = strings.Trim(argument, `"`)
+		}
+	}
+	return directives
+}
+
+// directiveSeconds returns the duration of a Cache-Control directive given in seconds
+func directiveSeconds(directives map[string]string, name string) (time.Duration, bool) {
+	value, ok := directives[name]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// maxBodyBytes returns the maximum size of a cached response body of an endpoint
+func maxBodyBytes(endpoint Endpoint) int {
+	if endpoint.Cache.MaxBodyBytes > 0 {
+		return endpoint.Cache.MaxBodyBytes
+	}
+	return defaultCacheMaxBodyBytes
+}
+
+// CachePurgeRequest selects the cached responses to remove
+type CachePurgeRequest struct {
+	SurrogateKeys []string `json:"surrogate_keys"`
+	Paths         []string `json:"paths"`
+	Prefix        string   `json:"prefix"`
+	All           bool     `json:"all"`
+}
+
+// handleCacheStats returns the number of cached responses
+func (g *Gateway) handleCacheStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{
+		"entries":     g.cache.Len(),
+		"max_entries": g.cache.maxEntries,
+	})
+}
+
+// handleCachePurge removes cached responses by surrogate key, path or path prefix on POST or PURGE
+func (g *Gateway) handleCachePurge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != "PURGE" {
+		w.Header().Set("Allow", "POST, PURGE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request CachePurgeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid purge request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !request.All && len(request.SurrogateKeys) == 0 && len(request.Paths) == 0 && request.Prefix == "" {
+		http.Error(w, "Invalid purge request: surrogate keys, paths, a prefix or all is required", http.StatusBadRequest)
+		return
+	}
+
+	// Purge the selected responses
+	purged := 0
+	if request.All {
+		purged = g.cache.PurgeAll()
+	} else {
+		purged = g.cache.PurgeSurrogateKeys(request.SurrogateKeys)
+		if len(request.Paths) > 0 || request.Prefix != "" {
+			purged += g.cache.PurgePaths(request.Paths, request.Prefix)
+		}
+	}
+
+	LogAudit("Cache purged", map[string]interface{}{
+		"request":     request,
+		"purged":      purged,
+		"remote_addr": r.RemoteAddr,
+	})
+	writeJSON(w, http.StatusOK, map[string]int{"purged": purged})
+}
+
+// cacheWriter is a wrapper around http.ResponseWriter that records the response for caching.
+// If intercept is set, 304 responses to the validators added by the cache are not passed to the client.
+// The stripHeader response header is recorded but not passed to the client.
+type cacheWriter struct {
+	http.ResponseWriter
+	intercept   bool
+	stripHeader string
+	status      int
+	wroteHeader bool
+	notModified bool
+	header      http.Header
+	body        bytes.Buffer
+	limit       int
+	overflow    bool
+}
+
+// WriteHeader records the status code and marks responses passed to the client as cache misses
+func (w *cacheWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = code
+	w.header = w.ResponseWriter.Header().Clone()
+	if w.intercept && code == http.StatusNotModified {
+		w.notModified = true
+		return
+	}
+	w.ResponseWriter.Header().Del(w.stripHeader)
+	if w.ResponseWriter.Header().Get("X-Cache") != "FALLBACK" {
+		w.ResponseWriter.Header().Set("X-Cache", "MISS")
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write records the response body up to the limit
+func (w *cacheWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.notModified {
+		return len(b), nil
+	}
+	if w.body.Len()+len(b) > w.limit {
+		w.overflow = true
+		w.body.Reset()
+	} else if !w.overflow {
+		w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying ResponseWriter so http.ResponseController can reach it
+func (w *cacheWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// discardResponseWriter is a ResponseWriter discarding the response, used for background requests
+type discardResponseWriter struct {
+	header http.Header
+}
+
+// Header returns the response headers
+func (w *discardResponseWriter) Header() http.Header {
+	return w.header
+}
+
+// Write discards the response body
+func (w *discardResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// WriteHeader discards the status code
+func (w *discardResponseWriter) WriteHeader(int) {}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestResponseCache tests fresh hits, stale-while-revalidate and conditional revalidation
+func TestResponseCache(t *testing.T) {
+	var requests, conditionalRequests atomic.Int32
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Cache-Control", "max-age=1, stale-while-revalidate=30")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditionalRequests.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = w.Write([]byte("users"))
+	}))
+	defer backendServer.Close()
+
+	gateway := NewGateway(Config{
+		Endpoints: []Endpoint{{Path: "/api/users", Backend: backendServer.URL, Cache: EndpointCacheConfig{Enabled: true}}},
+	}, nil)
+	var mu sync.Mutex
+	now := time.Unix(1000, 0)
+	gateway.cache.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+	gateway.RegisterEndpoints()
+
+	serve := func(header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/users", nil)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		rr := httptest.NewRecorder()
+		gateway.mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := serve(nil); rr.Header().Get("X-Cache") != "MISS" || rr.Body.String() != "users" {
+		t.Errorf("Expected a cache miss, got %q %q", rr.Header().Get("X-Cache"), rr.Body.String())
+	}
+	if rr := serve(nil); rr.Header().Get("X-Cache") != "HIT" || rr.Body.String() != "users" || requests.Load() != 1 {
+		t.Errorf("Expected a cache hit, got %q %q after %d requests", rr.Header().Get("X-Cache"), rr.Body.String(), requests.Load())
+	}
+
+	// Clients with a matching validator get a 304
+	if rr := serve(http.Header{"If-None-Match": {`"v1"`}}); rr.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for a matching If-None-Match, got %v", rr.Code)
+	}
+
+	// Stale responses are served while they are revalidated in the background
+	advance(2 * time.Second)
+	if rr := serve(nil); rr.Header().Get("X-Cache") != "STALE" || rr.Body.String() != "users" {
+		t.Errorf("Expected a stale response, got %q %q", rr.Header().Get("X-Cache"), rr.Body.String())
+	}
+	waitFor(t, func() bool { return conditionalRequests.Load() == 1 })
+	waitFor(t, func() bool { return serve(nil).Header().Get("X-Cache") == "HIT" })
+
+	// Responses beyond the stale-while-revalidate window are revalidated before they are served
+	advance(time.Minute)
+	if rr := serve(nil); rr.Header().Get("X-Cache") != "REVALIDATED" || rr.Code != http.StatusOK || rr.Body.String() != "users" {
+		t.Errorf("Expected a revalidated response, got %q %v %q", rr.Header().Get("X-Cache"), rr.Code, rr.Body.String())
+	}
+	if conditionalRequests.Load() != 2 {
+		t.Errorf("Expected 2 conditional backend requests, got %d", conditionalRequests.Load())
+	}
+
+	// Authenticated requests bypass the cache
+	before := requests.Load()
+	serve(http.Header{"Authorization": {"Bearer token"}})
+	if requests.Load() != before+1 {
+		t.Error("Expected authenticated requests to bypass the cache")
+	}
+
+	// Requests with cookies bypass the cache, their responses may be personalized
+	before = requests.Load()
+	if rr := serve(http.Header{"Cookie": {"session=abc"}}); requests.Load() != before+1 || rr.Header().Get("X-Cache") != "" {
+		t.Errorf("Expected requests with cookies to bypass the cache, got %q", rr.Header().Get("X-Cache"))
+	}
+}
+
+// TestResponseCacheAuthenticatedCaller tests that the responses to callers identified by the authentication are
+// not cached, even when their credentials are neither an Authorization nor a Cookie header
+func TestResponseCacheAuthenticatedCaller(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-User-ID", r.Header.Get("X-Api-Key"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte(r.Header.Get("X-User-ID")))
+	}))
+	defer backendServer.Close()
+
+	extAuthz, err := NewExtAuthz(ExtAuthzConfig{URL: authServer.URL, AllowedHeaders: []string{"X-Api-Key"}, UpstreamHeaders: []string{"X-User-ID"}})
+	if err != nil {
+		t.Fatalf("Failed to create external authorization: %v", err)
+	}
+	gateway := NewGateway(Config{
+		Endpoints: []Endpoint{{Path: "/api/profile", Backend: backendServer.URL, Cache: EndpointCacheConfig{Enabled: true}}},
+	}, nil)
+	gateway.Use(extAuthz.Middleware)
+	gateway.RegisterEndpoints()
+
+	for _, user := range []string{"alice", "bob"} {
+		req := httptest.NewRequest("GET", "/api/profile", nil)
+		req.Header.Set("X-Api-Key", user)
+		rr := httptest.NewRecorder()
+		gateway.mux.ServeHTTP(rr, req)
+		if rr.Body.String() != user || rr.Header().Get("X-Cache") != "" {
+			t.Errorf("Expected the response for %s to bypass the cache, got %q %q", user, rr.Header().Get("X-Cache"), rr.Body.String())
+		}
+	}
+}
+
+// TestResponseCacheNewEntry tests which responses are stored and for how long
+func TestResponseCacheNewEntry(t *testing.T) {
+	cache := NewResponseCache(CacheConfig{}, nil)
+	now := time.Unix(1000, 0)
+	cache.now = func() time.Time { return now }
+	req := httptest.NewRequest("GET", "/api", nil)
+	req.Header.Set("Accept-Language", "de")
+	endpoint := Endpoint{Cache: EndpointCacheConfig{Enabled: true, TTL: 5000}}
+
+	tests := []struct {
+		name       string
+		status     int
+		header     http.Header
+		stored     bool
+		freshUntil time.Time
+	}{
+		{"configured TTL", 200, http.Header{}, true, now.Add(5 * time.Second)},
+		{"max-age", 200, http.Header{"Cache-Control": {"max-age=60"}}, true, now.Add(time.Minute)},
+		{"s-maxage wins", 200, http.Header{"Cache-Control": {"max-age=60, s-maxage=10"}}, true, now.Add(10 * time.Second)},
+		{"expires", 200, http.Header{"Expires": {now.Add(time.Hour).UTC().Format(http.TimeFormat)}}, true, now.Add(time.Hour)},
+		{"no-cache with validator", 200, http.Header{"Cache-Control": {"no-cache"}, "Etag": {`"x"`}}, true, now},
+		{"no-cache without validator", 200, http.Header{"Cache-Control": {"no-cache"}}, false, time.Time{}},
+		{"no-store", 200, http.Header{"Cache-Control": {"no-store"}}, false, time.Time{}},
+		{"private", 200, http.Header{"Cache-Control": {"private, max-age=60"}}, false, time.Time{}},
+		{"set-cookie", 200, http.Header{"Set-Cookie": {"session=1"}}, false, time.Time{}},
+		{"uncacheable status", 500, http.Header{}, false, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := cache.newEntry(endpoint, "key", req, tt.status, tt.header, []byte("body"))
+			if (entry != nil) != tt.stored {
+				t.Fatalf("newEntry() stored = %v, want %v", entry != nil, tt.stored)
+			}
+			if entry != nil && !entry.freshUntil.Equal(tt.freshUntil) {
+				t.Errorf("freshUntil = %v, want %v", entry.freshUntil, tt.freshUntil)
+			}
+		})
+	}
+
+	// Responses vary on the listed request headers
+	entry := cache.newEntry(endpoint, "key", req, 200, http.Header{"Vary": {"Accept-Language"}}, []byte("body"))
+	cache.set(entry)
+	if cache.get("key", req) == nil {
+		t.Error("Expected a cached response for the same Accept-Language")
+	}
+	other := httptest.NewRequest("GET", "/api", nil)
+	other.Header.Set("Accept-Language", "en")
+	if cache.get("key", other) != nil {
+		t.Error("Expected no cached response for another Accept-Language")
+	}
+}
+
+// TestCachePurge tests purging cached responses by surrogate key and path through the admin API
+func TestCachePurge(t *testing.T) {
+	var requests atomic.Int32
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Surrogate-Key", "users user-"+r.URL.Query().Get("id"))
+		_, _ = w.Write([]byte("user"))
+	}))
+	defer backendServer.Close()
+
+	gateway := NewGateway(Config{
+		Endpoints: []Endpoint{{Path: "/api/users", Backend: backendServer.URL, Cache: EndpointCacheConfig{Enabled: true}}},
+		Admin:     AdminConfig{Enabled: true},
+	}, nil)
+	gateway.RegisterEndpoints()
+	gateway.RegisterAdminEndpoints()
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		gateway.mux.ServeHTTP(rr, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rr
+	}
+
+	rr := serve("GET", "/api/users?id=1", "")
+	if rr.Header().Get("Surrogate-Key") != "" {
+		t.Errorf("Expected the surrogate key header to be stripped, got %q", rr.Header().Get("Surrogate-Key"))
+	}
+	serve("GET", "/api/users?id=2", "")
+	if gateway.cache.Len() != 2 {
+		t.Fatalf("Expected 2 cached responses, got %d", gateway.cache.Len())
+	}
+
+	if rr := serve("PURGE", "/admin/cache/purge", `{}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an empty purge request, got %v", rr.Code)
+	}
+
+	rr = serve("PURGE", "/admin/cache/purge", `{"surrogate_keys": ["user-1"]}`)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"purged":1`) {
+		t.Errorf("Expected 1 purged response, got %v %s", rr.Code, rr.Body.String())
+	}
+	if rr := serve("GET", "/api/users?id=2", ""); rr.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("Expected other responses to stay cached, got %q", rr.Header().Get("X-Cache"))
+	}
+	if rr := serve("GET", "/api/users?id=1", ""); rr.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("Expected a miss after purging, got %q", rr.Header().Get("X-Cache"))
+	}
+
+	rr = serve("POST", "/admin/cache/purge", `{"prefix": "/api/"}`)
+	if !strings.Contains(rr.Body.String(), `"purged":2`) || gateway.cache.Len() != 0 {
+		t.Errorf("Expected all responses to be purged by prefix, got %s", rr.Body.String())
+	}
+	if len(gateway.cache.surrogates) != 0 {
+		t.Errorf("Expected the surrogate key index to be empty, got %v", gateway.cache.surrogates)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+// callerHeadersKey is the context key of the caller headers removed from the requests before the authentication
+type callerHeadersKey struct{}
+
+// authenticatedCallerKey is the context key flagging the requests whose caller was identified by the authentication
+type authenticatedCallerKey struct{}
+
+// withAuthenticatedCaller flags the request as coming from a caller identified by the authentication, so responses
+// personalized with the identity it forwards upstream are not shared with other callers
+func withAuthenticatedCaller(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), authenticatedCallerKey{}, true))
+}
+
+// authenticatedCaller returns whether the caller of the request was identified by the authentication
+func authenticatedCaller(r *http.Request) bool {
+	authenticated, _ := r.Context().Value(authenticatedCallerKey{}).(bool)
+	return authenticated
+}
+
+// CallerIdentityMiddleware removes the headers identifying the caller from the requests before the
+// authentication middlewares run, so their values can only have been set by the authentication, e.g. an
+// ext_authz upstream header or an OIDC identity header
+func CallerIdentityMiddleware(headers []string, next http.Handler) http.Handler {
+	if len(headers) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, header := range headers {
+			r.Header.Del(header)
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), callerHeadersKey{}, headers)))
+	})
+}
+
+// callerIdentity returns the caller identified by a header set by the authentication. Headers whose client
+// copies were not removed by CallerIdentityMiddleware are not trusted and identify no caller.
+func callerIdentity(r *http.Request, header string) string {
+	if header == "" {
+		return ""
+	}
+	headers, _ := r.Context().Value(callerHeadersKey{}).([]string)
+	if !containsString(headers, header) {
+		return ""
+	}
+	return r.Header.Get(header)
+}
+
+// callerHeaders returns the headers identifying the callers of an endpoint
+func (g *Gateway) callerHeaders(endpoint Endpoint) []string {
+	var headers []string
+	if endpoint.TimeoutOverride.MaxTimeout > 0 && endpoint.TimeoutOverride.CallerHeader != "" {
+		headers = append(headers, endpoint.TimeoutOverride.CallerHeader)
+	}
+	if g.shedder.config.CallerHeader != "" && !containsString(headers, g.shedder.config.CallerHeader) {
+		headers = append(headers, g.shedder.config.CallerHeader)
+	}
+	if g.quotas != nil && g.quotas.config.TenantHeader != "" && !containsString(headers, g.quotas.config.TenantHeader) {
+		headers = append(headers, g.quotas.config.TenantHeader)
+	}
+	// The signed identity headers must not be forged by clients on the endpoints whose authentication does not
+	// set them, e.g. the OIDC identity headers on endpoints without oidc_login
+	if g.config.IdentitySigning.enabled() {
+		signed := append(authenticationHeaders(g.config), g.config.IdentitySigning.Headers...)
+		headers = append(headers, signedIdentityHeaders(signed, endpoint)...)
+	}
+	return headers
+}
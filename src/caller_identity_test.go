@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestCallerIdentity tests that only the caller headers set after the client copies were removed identify callers
+func TestCallerIdentity(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Auth-Subject", "spoofed")
+	if caller := callerIdentity(req, "X-Auth-Subject"); caller != "" {
+		t.Errorf("Expected a header not removed from the client request to be untrusted, got %q", caller)
+	}
+
+	var inbound, authenticated string
+	CallerIdentityMiddleware([]string{"X-Auth-Subject"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inbound = callerIdentity(r, "X-Auth-Subject")
+		r.Header.Set("X-Auth-Subject", "batch-job")
+		authenticated = callerIdentity(r, "X-Auth-Subject")
+	})).ServeHTTP(httptest.NewRecorder(), req)
+	if inbound != "" {
+		t.Errorf("Expected the client copy of the caller header to be removed, got %q", inbound)
+	}
+	if authenticated != "batch-job" {
+		t.Errorf("Expected the caller set by the authentication, got %q", authenticated)
+	}
+}
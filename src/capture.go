@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Request capture limits
+const (
+	captureMaxBodyBytes = 64 * 1024
+	captureMaxExchanges = 100
+)
+
+// CaptureFilter selects the requests to capture
+type CaptureFilter struct {
+	// Path is the path prefix of the requests to capture (all paths if empty)
+	Path string `json:"path"`
+	// Method is the method of the requests to capture (all methods if empty)
+	Method string `json:"method"`
+	// Header is the name of a header the requests to capture must have
+	Header string `json:"header"`
+	// HeaderValue is the value the header must have (any value if empty)
+	HeaderValue string `json:"header_value"`
+	// Count is the number of requests to capture
+	Count int `json:"count"`
+}
+
+// Matches checks whether a request matches the filter
+func (f CaptureFilter) Matches(r *http.Request) bool {
+	if f.Path != "" && !strings.HasPrefix(r.URL.Path, f.Path) {
+		return false
+	}
+	if f.Method != "" && r.Method != f.Method {
+		return false
+	}
+	if f.Header != "" {
+		values, ok := r.Header[http.CanonicalHeaderKey(f.Header)]
+		if !ok || (f.HeaderValue != "" && !containsString(values, f.HeaderValue)) {
+			return false
+		}
+	}
+	return true
+}
+
+// CapturedRequest is the request part of a captured exchange
+type CapturedRequest struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers"`
+	Body    string      `json:"body,omitempty"`
+}
+
+// CapturedResponse is the response part of a captured exchange
+type CapturedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Headers    http.Header `json:"headers"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// CapturedExchange is a captured request/response pair
+type CapturedExchange struct {
+	Timestamp string           `json:"@timestamp"`
+	Route     string           `json:"route"`
+	Duration  string           `json:"duration"`
+	TraceID   string           `json:"trace_id,omitempty"`
+	Request   CapturedRequest  `json:"request"`
+	Response  CapturedResponse `json:"response"`
+}
+
+// RequestCapture records the request/response pairs of requests matching a filter
+type RequestCapture struct {
+	active    atomic.Bool
+	mu        sync.Mutex
+	filter    CaptureFilter
+	remaining int
+	exchanges []CapturedExchange
+}
+
+// Start replaces the capture filter and discards the previously captured exchanges
+func (c *RequestCapture) Start(filter CaptureFilter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.filter = filter
+	c.remaining = filter.Count
+	c.exchanges = nil
+	c.active.Store(filter.Count > 0)
+}
+
+// Stop stops capturing and discards the captured exchanges
+func (c *RequestCapture) Stop() {
+	c.Start(CaptureFilter{})
+}
+
+// Exchanges returns the captured exchanges and the number of requests still to be captured
+func (c *RequestCapture) Exchanges() ([]CapturedExchange, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]CapturedExchange{}, c.exchanges...), c.remaining
+}
+
+// reserve claims one of the remaining captures if the request matches the filter
+func (c *RequestCapture) reserve(r *http.Request) bool {
+	if !c.active.Load() {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.remaining <= 0 || !c.filter.Matches(r) {
+		return false
+	}
+	c.remaining--
+	if c.remaining == 0 {
+		c.active.Store(false)
+	}
+	return true
+}
+
+// record stores a captured exchange, keeping at most captureMaxExchanges
+func (c *RequestCapture) record(exchange CapturedExchange) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.exchanges = append(c.exchanges, exchange)
+	if len(c.exchanges) > captureMaxExchanges {
+		c.exchanges = c.exchanges[len(c.exchanges)-captureMaxExchanges:]
+	}
+}
+
+// Middleware captures the matching requests of an endpoint
+func (c *RequestCapture) Middleware(endpoint Endpoint, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !c.reserve(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		exchange, _, _ := captureExchange(endpoint, w, r, next)
+		c.record(exchange)
+	})
+}
+
+// captureExchange serves the request and returns the captured exchange, its start time and its duration
+func captureExchange(endpoint Endpoint, w http.ResponseWriter, r *http.Request, next http.Handler) (CapturedExchange, time.Time, time.Duration) {
+	startTime := time.Now()
+	exchange := CapturedExchange{
+		Timestamp: startTime.UTC().Format(time.RFC3339),
+		Route:     endpoint.Path,
+		Request: CapturedRequest{
+			Method:  r.Method,
+			URL:     r.URL.String(),
+			Headers: redactHeaders(r.Header),
+		},
+	}
+	exchange.TraceID, _ = traceIDs(r.Context())
+
+	// Capture the beginning of the request body and restore it
+	if r.Body != nil && r.Body != http.NoBody {
+		body, err := io.ReadAll(io.LimitReader(r.Body, captureMaxBodyBytes))
+		if err == nil {
+			exchange.Request.Body = string(body)
+			r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		}
+	}
+
+	cw := &captureResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+	next.ServeHTTP(cw, r)
+
+	duration := time.Since(startTime)
+	exchange.Duration = duration.String()
+	exchange.Response = CapturedResponse{
+		StatusCode: cw.statusCode,
+		Headers:    redactHeaders(w.Header()),
+		Body:       cw.body.String(),
+	}
+	return exchange, startTime, duration
+}
+
+// redactHeaders returns a copy of the headers with credentials redacted
+func redactHeaders(header http.Header) http.Header {
+	redacted := header.Clone()
+	for _, key := range []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"} {
+		if _, ok := redacted[key]; ok {
+			redacted[key] = []string{"[REDACTED]"}
+		}
+	}
+	return redacted
+}
+
+// readCloser combines a reader with the closer of the original body
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// captureResponseWriter is a wrapper around http.ResponseWriter that records the status code
+// and the beginning of the response body
+type captureResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+// WriteHeader records the status code
+func (w *captureResponseWriter) WriteHeader(code int) {
+	w.statusCode = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write records the beginning of the response body
+func (w *captureResponseWriter) Write(b []byte) (int, error) {
+	if remaining := captureMaxBodyBytes - w.body.Len(); remaining > 0 {
+		w.body.Write(b[:min(len(b), remaining)])
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying ResponseWriter so http.ResponseController can reach it
+func (w *captureResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// handleCapture starts a capture on POST, returns the captured exchanges on GET and stops the capture on DELETE
+func (g *Gateway) handleCapture(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		exchanges, remaining := g.capture.Exchanges()
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"remaining": remaining,
+			"exchanges": exchanges,
+		})
+	case http.MethodPost:
+		var filter CaptureFilter
+		if err := json.NewDecoder(r.Body).Decode(&filter); err != nil || filter.Count <= 0 {
+			http.Error(w, "Invalid capture filter: a positive count is required", http.StatusBadRequest)
+			return
+		}
+		g.capture.Start(filter)
+		LogAudit("Request capture started", map[string]interface{}{
+			"filter":      filter,
+			"remote_addr": r.RemoteAddr,
+		})
+		writeJSON(w, http.StatusAccepted, filter)
+	case http.MethodDelete:
+		g.capture.Stop()
+		LogAudit("Request capture stopped", map[string]interface{}{
+			"remote_addr": r.RemoteAddr,
+		})
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
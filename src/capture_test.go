@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestGatewayRequestCapture tests capturing matching requests through the admin API
+func TestGatewayRequestCapture(t *testing.T) {
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend", "users")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": 1}`))
+	}))
+	defer backendServer.Close()
+
+	gateway := NewGateway(Config{
+		Endpoints: []Endpoint{{Path: "/api/users", Backend: backendServer.URL}},
+		Admin:     AdminConfig{Enabled: true},
+	}, nil)
+	gateway.RegisterEndpoints()
+	gateway.RegisterAdminEndpoints()
+
+	serve := func(method, path, body string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		rr := httptest.NewRecorder()
+		gateway.mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := serve("POST", "/admin/capture", `{"path": "/api", "header": "X-Debug", "count": 1}`, nil); rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202 when starting a capture, got %v", rr.Code)
+	}
+
+	serve("POST", "/api/users", `{"name": "skipped"}`, nil)
+	debugHeader := http.Header{"X-Debug": {"1"}, "Authorization": {"Bearer secret"}}
+	rr := serve("POST", "/api/users", `{"name": "captured"}`, debugHeader)
+	if rr.Code != http.StatusCreated || rr.Body.String() != `{"id": 1}` {
+		t.Errorf("Captured request was not proxied unchanged: %v %q", rr.Code, rr.Body.String())
+	}
+	serve("POST", "/api/users", `{"name": "over limit"}`, debugHeader)
+
+	var result struct {
+		Remaining int                `json:"remaining"`
+		Exchanges []CapturedExchange `json:"exchanges"`
+	}
+	rr = serve("GET", "/admin/capture", "", nil)
+	if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode captured exchanges: %v", err)
+	}
+
+	if result.Remaining != 0 || len(result.Exchanges) != 1 {
+		t.Fatalf("Expected one captured exchange, got %+v", result)
+	}
+	exchange := result.Exchanges[0]
+	if exchange.Request.Body != `{"name": "captured"}` {
+		t.Errorf("Unexpected captured request body %q", exchange.Request.Body)
+	}
+	if exchange.Request.Headers.Get("Authorization") != "[REDACTED]" {
+		t.Errorf("Expected the Authorization header to be redacted, got %q", exchange.Request.Headers.Get("Authorization"))
+	}
+	if exchange.Response.StatusCode != http.StatusCreated || exchange.Response.Body != `{"id": 1}` ||
+		exchange.Response.Headers.Get("X-Backend") != "users" {
+		t.Errorf("Unexpected captured response %+v", exchange.Response)
+	}
+	if exchange.Route != "/api/users" || exchange.TraceID == "" {
+		t.Errorf("Expected route and trace ID, got %q %q", exchange.Route, exchange.TraceID)
+	}
+
+	if rr := serve("DELETE", "/admin/capture", "", nil); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 when stopping the capture, got %v", rr.Code)
+	}
+}
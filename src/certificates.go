@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Default certificate monitoring settings
+const (
+	defaultCertificateWarningDays   = 30
+	defaultCertificateCheckInterval = 3600000
+)
+
+// CertificateMonitoringConfig represents the monitoring of listener and upstream certificate expiry
+type CertificateMonitoringConfig struct {
+	// WarningDays is the number of days before expiry from which warnings are logged (default 30)
+	WarningDays int `json:"warning_days"`
+	// CheckInterval is the interval in milliseconds at which the certificates are checked (default 3600000)
+	CheckInterval int `json:"check_interval"`
+}
+
+// CertificateStatus reports the expiry of a listener or upstream certificate
+type CertificateStatus struct {
+	// Kind is listener or upstream
+	Kind string `json:"kind"`
+	// Name is the listener name or the upstream host
+	Name            string    `json:"name"`
+	Subject         string    `json:"subject"`
+	NotAfter        time.Time `json:"not_after"`
+	DaysUntilExpiry float64   `json:"days_until_expiry"`
+}
+
+// monitoredCertificate is a certificate whose expiry is monitored
+type monitoredCertificate struct {
+	kind, name, subject string
+	notAfter            time.Time
+	// warned is set once a warning has been logged for the certificate
+	warned bool
+}
+
+// CertificateMonitor tracks the expiry of listener and upstream certificates and warns before they expire
+type CertificateMonitor struct {
+	mu        sync.Mutex
+	config    CertificateMonitoringConfig
+	certs     map[string]*monitoredCertificate
+	notifier  *Notifier
+	telemetry *TelemetryManager
+	now       func() time.Time
+}
+
+// NewCertificateMonitor creates a new CertificateMonitor
+func NewCertificateMonitor(config CertificateMonitoringConfig, telemetry *TelemetryManager, notifier *Notifier) *CertificateMonitor {
+	if config.WarningDays <= 0 {
+		config.WarningDays = defaultCertificateWarningDays
+	}
+	if config.CheckInterval <= 0 {
+		config.CheckInterval = defaultCertificateCheckInterval
+	}
+	m := &CertificateMonitor{
+		config:    config,
+		certs:     make(map[string]*monitoredCertificate),
+		notifier:  notifier,
+		telemetry: telemetry,
+		now:       time.Now,
+	}
+
+	// Export the days until expiry as a gauge
+	if telemetry != nil {
+		if err := telemetry.RegisterCertificateExpiryGauge(m.Certificates); err != nil {
+			LogError("Failed to register certificate expiry gauge", err, nil)
+		}
+	}
+	return m
+}
+
+// ObserveFile monitors the first certificate of a PEM file
+func (m *CertificateMonitor) ObserveFile(kind, name, certFile string) error {
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return fmt.Errorf("failed to read certificate: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return fmt.Errorf("no certificate found in %s", certFile)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	m.Observe(kind, name, cert)
+	return nil
+}
+
+// Observe monitors a certificate, replacing the previous certificate of the same kind and name
+func (m *CertificateMonitor) Observe(kind, name string, cert *x509.Certificate) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := kind + " " + name
+	if existing, ok := m.certs[key]; ok && existing.notAfter.Equal(cert.NotAfter) {
+		return
+	}
+	monitored := &monitoredCertificate{kind: kind, name: name, subject: cert.Subject.String(), notAfter: cert.NotAfter}
+	m.certs[key] = monitored
+	m.check(monitored)
+}
+
+// check logs a warning if a certificate expires within the warning period, the caller must hold the lock
+func (m *CertificateMonitor) check(cert *monitoredCertificate) {
+	remaining := cert.notAfter.Sub(m.now())
+	if cert.warned || remaining > time.Duration(m.config.WarningDays)*24*time.Hour {
+		return
+	}
+	cert.warned = true
+
+	details := map[string]interface{}{
+		"kind":              cert.kind,
+		"name":              cert.name,
+		"subject":           cert.subject,
+		"not_after":         cert.notAfter.UTC().Format(time.RFC3339),
+		"days_until_expiry": int(remaining.Hours() / 24),
+	}
+	message := "Certificate expires soon"
+	if remaining <= 0 {
+		message = "Certificate expired"
+	}
+	LogWarn(message, details)
+	m.notifier.Notify(Event{Type: EventCertificateExpiring, Message: message, Details: details})
+}
+
+// Run checks the certificates periodically until the context is canceled
+func (m *CertificateMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(m.config.CheckInterval) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.mu.Lock()
+			for _, cert := range m.certs {
+				m.check(cert)
+			}
+			m.mu.Unlock()
+		}
+	}
+}
+
+// Certificates returns the expiry of the monitored certificates
+func (m *CertificateMonitor) Certificates() []CertificateStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	statuses := make([]CertificateStatus, 0, len(m.certs))
+	for _, cert := range m.certs {
+		statuses = append(statuses, CertificateStatus{
+			Kind:            cert.kind,
+			Name:            cert.name,
+			Subject:         cert.subject,
+			NotAfter:        cert.notAfter,
+			DaysUntilExpiry: cert.notAfter.Sub(now).Hours() / 24,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Kind != statuses[j].Kind {
+			return statuses[i].Kind < statuses[j].Kind
+		}
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// certificateTransport is a round tripper monitoring the certificates presented by upstream servers
+type certificateTransport struct {
+	next    http.RoundTripper
+	monitor *CertificateMonitor
+}
+
+// RoundTrip sends the request and monitors the certificate of the upstream server
+func (t *certificateTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err == nil && resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		t.monitor.Observe("upstream", req.URL.Host, resp.TLS.PeerCertificates[0])
+	}
+	return resp, err
+}
+
+// handleCertificates returns the expiry of the monitored certificates
+func (g *Gateway) handleCertificates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, g.certificates.Certificates())
+}
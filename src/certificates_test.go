@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestCertificateMonitor tests monitoring listener certificates from files and upstream certificates
+func TestCertificateMonitor(t *testing.T) {
+	// Create a listener certificate expiring in 10 days
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "gateway.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(10 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(t.TempDir(), "cert.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	monitor := NewCertificateMonitor(CertificateMonitoringConfig{}, nil, nil)
+	if err := monitor.ObserveFile("listener", "public", certFile); err != nil {
+		t.Fatalf("ObserveFile() error = %v", err)
+	}
+	if err := monitor.ObserveFile("listener", "other", filepath.Join(t.TempDir(), "missing.pem")); err == nil {
+		t.Error("Expected error for a missing certificate file")
+	}
+
+	// Upstream certificates are observed on responses
+	backendServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backendServer.Close()
+	client := &http.Client{Transport: &certificateTransport{next: backendServer.Client().Transport, monitor: monitor}}
+	resp, err := client.Get(backendServer.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	certs := monitor.Certificates()
+	if len(certs) != 2 || certs[0].Kind != "listener" || certs[1].Kind != "upstream" {
+		t.Fatalf("Expected a listener and an upstream certificate, got %+v", certs)
+	}
+	if days := certs[0].DaysUntilExpiry; days < 9.9 || days > 10 || certs[0].Subject != "CN=gateway.example.com" {
+		t.Errorf("Unexpected listener certificate %+v", certs[0])
+	}
+	if !monitor.certs["listener public"].warned || monitor.certs["upstream "+resp.Request.URL.Host].warned {
+		t.Error("Expected a warning for the listener certificate only")
+	}
+}
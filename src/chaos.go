@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultChaosDuration is the lifetime of a fault without an explicit duration
+const defaultChaosDuration = 60000
+
+// ChaosFault is a fault injected into the requests of an endpoint for a limited time
+type ChaosFault struct {
+	ID int `json:"id"`
+	// Endpoint is the path of the endpoint the fault applies to (all endpoints if empty)
+	Endpoint string `json:"endpoint"`
+	// Latency is the delay in milliseconds added to the requests
+	Latency int `json:"latency"`
+	// ErrorRate is the share of requests answered with ErrorStatus instead of being proxied
+	ErrorRate float64 `json:"error_rate"`
+	// ErrorStatus is the status code of the injected errors (default 503)
+	ErrorStatus int `json:"error_status"`
+	// Duration is the lifetime of the fault in milliseconds (default 60000)
+	Duration  int       `json:"duration"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ChaosInjector injects latency and errors into endpoint requests for game-day exercises
+type ChaosInjector struct {
+	active atomic.Bool
+	mu     sync.Mutex
+	faults []ChaosFault
+	nextID int
+	now    func() time.Time
+}
+
+// NewChaosInjector creates a new ChaosInjector without faults
+func NewChaosInjector() *ChaosInjector {
+	return &ChaosInjector{now: time.Now}
+}
+
+// Add adds a fault and returns it with its ID and expiry
+func (c *ChaosInjector) Add(fault ChaosFault) ChaosFault {
+	if fault.Duration <= 0 {
+		fault.Duration = defaultChaosDuration
+	}
+	if fault.ErrorStatus == 0 {
+		fault.ErrorStatus = http.StatusServiceUnavailable
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextID++
+	fault.ID = c.nextID
+	fault.ExpiresAt = c.now().Add(time.Duration(fault.Duration) * time.Millisecond)
+	c.faults = append(c.faults, fault)
+	c.active.Store(true)
+	return fault
+}
+
+// Remove removes the fault with the given ID, or all faults if the ID is 0
+func (c *ChaosInjector) Remove(id int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := false
+	faults := c.faults[:0]
+	for _, fault := range c.faults {
+		if id == 0 || fault.ID == id {
+			removed = true
+			continue
+		}
+		faults = append(faults, fault)
+	}
+	c.faults = faults
+	c.active.Store(len(c.faults) > 0)
+	return removed
+}
+
+// Faults returns the faults that have not expired yet
+func (c *ChaosInjector) Faults() []ChaosFault {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire()
+	return append([]ChaosFault{}, c.faults...)
+}
+
+// expire removes the expired faults, the caller must hold the lock
+func (c *ChaosInjector) expire() {
+	now := c.now()
+	faults := c.faults[:0]
+	for _, fault := range c.faults {
+		if now.Before(fault.ExpiresAt) {
+			faults = append(faults, fault)
+			continue
+		}
+		LogInfo("Chaos fault expired", map[string]interface{}{
+			"id":       fault.ID,
+			"endpoint": fault.Endpoint,
+		})
+	}
+	c.faults = faults
+	c.active.Store(len(c.faults) > 0)
+}
+
+// faultsFor returns the active faults of an endpoint
+func (c *ChaosInjector) faultsFor(path string) []ChaosFault {
+	if !c.active.Load() {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire()
+
+	var faults []ChaosFault
+	for _, fault := range c.faults {
+		if fault.Endpoint == "" || fault.Endpoint == path {
+			faults = append(faults, fault)
+		}
+	}
+	return faults
+}
+
+// Middleware injects the active faults into the requests of an endpoint
+func (c *ChaosInjector) Middleware(endpoint Endpoint, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, fault := range c.faultsFor(endpoint.Path) {
+			if fault.Latency > 0 {
+				if err := sleepContext(r.Context(), time.Duration(fault.Latency)*time.Millisecond); err != nil {
+					return
+				}
+			}
+			if fault.ErrorRate > 0 && rand.Float64() < fault.ErrorRate {
+				LogInfo("Chaos error injected", map[string]interface{}{
+					"id":          fault.ID,
+					"path":        r.URL.Path,
+					"status_code": fault.ErrorStatus,
+				})
+				http.Error(w, "Injected fault", fault.ErrorStatus)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleChaos adds a fault on POST, lists the active faults on GET and removes faults on DELETE
+func (g *Gateway) handleChaos(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, g.chaos.Faults())
+	case http.MethodPost:
+		var fault ChaosFault
+		if err := json.NewDecoder(r.Body).Decode(&fault); err != nil {
+			http.Error(w, "Invalid fault: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if fault.Latency < 0 || fault.ErrorRate < 0 || fault.ErrorRate > 1 || (fault.Latency == 0 && fault.ErrorRate == 0) ||
+			(fault.ErrorStatus != 0 && (fault.ErrorStatus < 400 || fault.ErrorStatus > 599)) {
+			http.Error(w, "Invalid fault: a latency or an error rate between 0 and 1 with an error status code is required", http.StatusBadRequest)
+			return
+		}
+		fault = g.chaos.Add(fault)
+		LogAudit("Chaos fault added", map[string]interface{}{
+			"fault":       fault,
+			"remote_addr": r.RemoteAddr,
+		})
+		writeJSON(w, http.StatusCreated, fault)
+	case http.MethodDelete:
+		id := 0
+		if value := r.URL.Query().Get("id"); value != "" {
+			var err error
+			if id, err = strconv.Atoi(value); err != nil || id <= 0 {
+				http.Error(w, "Invalid fault ID", http.StatusBadRequest)
+				return
+			}
+		}
+		if !g.chaos.Remove(id) && id != 0 {
+			http.Error(w, "Fault not found", http.StatusNotFound)
+			return
+		}
+		LogAudit("Chaos faults removed", map[string]interface{}{
+			"id":          id,
+			"remote_addr": r.RemoteAddr,
+		})
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
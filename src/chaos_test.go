@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestGatewayChaos tests injecting faults through the admin API
+func TestGatewayChaos(t *testing.T) {
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("OK"))
+	}))
+	defer backendServer.Close()
+
+	gateway := NewGateway(Config{
+		Endpoints: []Endpoint{
+			{Path: "/api/users", Backend: backendServer.URL},
+			{Path: "/api/orders", Backend: backendServer.URL},
+		},
+		Admin: AdminConfig{Enabled: true},
+	}, nil)
+	gateway.RegisterEndpoints()
+	gateway.RegisterAdminEndpoints()
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		gateway.mux.ServeHTTP(rr, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rr
+	}
+
+	if rr := serve("POST", "/admin/chaos", `{"endpoint": "/api/users", "error_rate": 2}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid error rate, got %v", rr.Code)
+	}
+
+	rr := serve("POST", "/admin/chaos", `{"endpoint": "/api/users", "error_rate": 1, "error_status": 500}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 when adding a fault, got %v", rr.Code)
+	}
+	var fault ChaosFault
+	_ = json.NewDecoder(rr.Body).Decode(&fault)
+
+	if rr := serve("GET", "/api/users", ""); rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected injected 500, got %v", rr.Code)
+	}
+	if rr := serve("GET", "/api/orders", ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected other endpoints to be unaffected, got %v", rr.Code)
+	}
+
+	// Latency applies to all endpoints without an endpoint
+	serve("POST", "/admin/chaos", `{"latency": 50}`)
+	startTime := time.Now()
+	if rr := serve("GET", "/api/orders", ""); rr.Code != http.StatusOK || time.Since(startTime) < 50*time.Millisecond {
+		t.Errorf("Expected a delayed 200, got %v after %v", rr.Code, time.Since(startTime))
+	}
+
+	var faults []ChaosFault
+	_ = json.NewDecoder(serve("GET", "/admin/chaos", "").Body).Decode(&faults)
+	if len(faults) != 2 {
+		t.Errorf("Expected 2 active faults, got %+v", faults)
+	}
+
+	if rr := serve("DELETE", "/admin/chaos?id=99", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown fault, got %v", rr.Code)
+	}
+	serve("DELETE", "/admin/chaos?id=1", "")
+	if rr := serve("GET", "/api/users", ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected 200 after removing the fault, got %v", rr.Code)
+	}
+}
+
+// TestChaosInjectorExpiry tests that faults expire automatically
+func TestChaosInjectorExpiry(t *testing.T) {
+	now := time.Unix(1000, 0)
+	chaos := NewChaosInjector()
+	chaos.now = func() time.Time { return now }
+
+	chaos.Add(ChaosFault{Endpoint: "/api", Latency: 10, Duration: 1000})
+	if faults := chaos.faultsFor("/api"); len(faults) != 1 {
+		t.Fatalf("Expected an active fault, got %+v", faults)
+	}
+
+	now = now.Add(time.Second)
+	if faults := chaos.faultsFor("/api"); len(faults) != 0 {
+		t.Errorf("Expected the fault to expire, got %+v", faults)
+	}
+	if chaos.active.Load() {
+		t.Error("Expected the injector to be inactive without faults")
+	}
+}
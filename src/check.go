@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultCheckTimeout is the time to wait for a backend to accept a connection during the self-test
+const defaultCheckTimeout = 3 * time.Second
+
+// CheckResult is the outcome of one self-test check
+type CheckResult struct {
+	Name   string
+	Detail string
+	Error  error
+}
+
+// RunSelfCheck validates the endpoints, binds and releases the listeners and optionally connects to the
+// backends, without serving traffic
+func RunSelfCheck(config Config, pingBackends bool) []CheckResult {
+	results := []CheckResult{{
+		Name:   "config",
+		Detail: fmt.Sprintf("%d endpoints", len(config.Endpoints)),
+	}}
+
+	// Validate the endpoints and their routes
+	mux := http.NewServeMux()
+	for _, endpoint := range config.Endpoints {
+		results = append(results, CheckResult{
+			Name:  "endpoint " + endpoint.Host + endpoint.Path,
+			Error: checkEndpoint(mux, endpoint),
+		})
+	}
+
+	// Bind the listeners
+	listenerConfigs := config.Listeners
+	if len(listenerConfigs) == 0 {
+		listenerConfigs = []ListenerConfig{{Address: fmt.Sprintf(":%d", config.Port)}}
+	}
+	for _, listenerConfig := range listenerConfigs {
+		results = append(results, checkListener(listenerConfig, config.ReusePort))
+	}
+
+	if pingBackends {
+		results = append(results, checkBackends(config.Endpoints, defaultCheckTimeout)...)
+	}
+	return results
+}
+
+// checkEndpoint checks the path and backends of an endpoint and that its route does not conflict with another one
+func checkEndpoint(mux *http.ServeMux, endpoint Endpoint) error {
+	if _, err := compiledPathTemplate(endpoint.Path); err != nil {
+		return err
+	}
+	if err := validatePathMode(endpoint); err != nil {
+		return err
+	}
+	for _, backend := range endpointBackends(endpoint) {
+		if _, err := url.Parse(backend); err != nil {
+			return fmt.Errorf("invalid backend: %w", err)
+		}
+	}
+
+	if err := registerPattern(mux, endpoint.Host+muxPattern(endpoint.Path), http.NotFoundHandler()); err != nil {
+		// Keep the first line of the conflict description
+		message, _, _ := strings.Cut(err.Error(), "\n")
+		return fmt.Errorf("invalid route: %s", strings.TrimSuffix(message, ":"))
+	}
+	return nil
+}
+
+// checkListener binds the listener address, loads its certificate and releases the address
+func checkListener(listenerConfig ListenerConfig, reusePort bool) CheckResult {
+	result := CheckResult{
+		Name:   "listener " + listenerConfig.ListenerName(),
+		Detail: listenerConfig.Address,
+	}
+	if listenerConfig.TLS.Enabled() {
+		if _, err := NewCertificateStore(listenerConfig.ListenerName(), listenerConfig.TLS, nil, nil); err != nil {
+			result.Error = err
+			return result
+		}
+	}
+	listener, err := Listen(listenerConfig.Address, reusePort)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+	_ = listener.Close()
+	return result
+}
+
+// checkBackends connects to the distinct backend hosts of the endpoints concurrently
+func checkBackends(endpoints []Endpoint, timeout time.Duration) []CheckResult {
+	var addresses []string
+	seen := make(map[string]bool)
+	for _, endpoint := range endpoints {
+		for _, backend := range endpointBackends(endpoint) {
+			address := backendAddress(backend)
+			if address == "" || seen[address] {
+				continue
+			}
+			seen[address] = true
+			addresses = append(addresses, address)
+		}
+	}
+
+	results := make([]CheckResult, len(addresses))
+	var wg sync.WaitGroup
+	for i, address := range addresses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			results[i] = CheckResult{Name: "backend " + address}
+			conn, err := net.DialTimeout("tcp", address, timeout)
+			if err != nil {
+				results[i].Error = err
+				return
+			}
+			_ = conn.Close()
+			results[i].Detail = time.Since(start).Round(time.Millisecond).String()
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// endpointBackends returns the backend URLs of an endpoint
+func endpointBackends(endpoint Endpoint) []string {
+	if endpoint.BlueGreen.enabled() {
+		return append(append([]string{}, endpoint.BlueGreen.Blue...), endpoint.BlueGreen.Green...)
+	}
+	if len(endpoint.Backends) > 0 {
+		return endpoint.Backends
+	}
+	if endpoint.Backend == "" {
+		return nil
+	}
+	return []string{endpoint.Backend}
+}
+
+// backendAddress returns the host:port address of a backend URL, defaulting the port from the scheme
+func backendAddress(backend string) string {
+	backendURL, err := url.Parse(backend)
+	if err != nil || backendURL.Hostname() == "" {
+		return ""
+	}
+	port := backendURL.Port()
+	if port == "" {
+		port = "80"
+		if backendURL.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(backendURL.Hostname(), port)
+}
+
+// WriteCheckReport prints the self-test results and reports whether all checks passed
+func WriteCheckReport(w io.Writer, results []CheckResult) bool {
+	failed := 0
+	for _, result := range results {
+		status := "OK  "
+		if result.Error != nil {
+			status = "FAIL"
+			failed++
+		}
+		line := status + "  " + result.Name
+		if result.Detail != "" {
+			line += " (" + result.Detail + ")"
+		}
+		if result.Error != nil {
+			line += ": " + result.Error.Error()
+		}
+		_, _ = fmt.Fprintln(w, line)
+	}
+
+	if failed > 0 {
+		_, _ = fmt.Fprintf(w, "Check failed: %d of %d checks failed\n", failed, len(results))
+		return false
+	}
+	_, _ = fmt.Fprintf(w, "Check passed: %d checks\n", len(results))
+	return true
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestRunSelfCheck tests that the self-test reports invalid endpoints, busy listeners and unreachable backends
+func TestRunSelfCheck(t *testing.T) {
+	backendServer := httptest.NewServer(http.NotFoundHandler())
+	defer backendServer.Close()
+
+	// Find a closed port for an unreachable backend
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddress := closed.Addr().String()
+	closed.Close()
+
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	config := Config{
+		Endpoints: []Endpoint{
+			{Path: "/api/users", Backend: backendServer.URL},
+			{Path: "/api/orders", Backend: "http://" + closedAddress},
+			{Path: "/api/users", Backend: backendServer.URL},
+			{Path: "/api/:id([)", Backend: backendServer.URL},
+		},
+		Listeners: []ListenerConfig{
+			{Name: "public", Address: "127.0.0.1:0"},
+			{Name: "busy", Address: busy.Addr().String()},
+		},
+	}
+
+	var report bytes.Buffer
+	if WriteCheckReport(&report, RunSelfCheck(config, true)) {
+		t.Fatal("expected the check to fail")
+	}
+	lines := strings.Split(strings.TrimSuffix(report.String(), "\n"), "\n")
+	expected := []string{
+		"OK    config (4 endpoints)",
+		"OK    endpoint /api/users",
+		"OK    endpoint /api/orders",
+		"FAIL  endpoint /api/users: invalid route: pattern \"/api/users\"",
+		"FAIL  endpoint /api/:id([): invalid constraint",
+		"OK    listener public (127.0.0.1:0)",
+		"FAIL  listener busy",
+		"OK    backend " + strings.TrimPrefix(backendServer.URL, "http://"),
+		"FAIL  backend " + closedAddress,
+		"Check failed: 4 of 9 checks failed",
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d report lines, got:\n%s", len(expected), report.String())
+	}
+	for i, prefix := range expected {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("expected line %d to start with %q, got %q", i, prefix, lines[i])
+		}
+	}
+
+	// Without the failing parts the check passes
+	config.Endpoints = config.Endpoints[:1]
+	config.Listeners = config.Listeners[:1]
+	report.Reset()
+	if !WriteCheckReport(&report, RunSelfCheck(config, false)) {
+		t.Errorf("expected the check to pass, got:\n%s", report.String())
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIP returns the IP address of the client that sent the request.
+// When trustForwardedFor is set, the first address of the X-Forwarded-For header is preferred,
+// which is only safe when the gateway runs behind a trusted load balancer.
+func ClientIP(r *http.Request, trustForwardedFor bool) net.IP {
+	if trustForwardedFor {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first := strings.TrimSpace(strings.Split(forwarded, ",")[0])
+			if ip := net.ParseIP(first); ip != nil {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
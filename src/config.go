@@ -6,6 +6,76 @@ type Config struct {
 	Port      int             `json:"port"`
 	Debug     bool            `json:"debug"`
 	Telemetry TelemetryConfig `json:"telemetry"`
+	// Defaults are endpoint settings inherited by all endpoints of the configuration files that do not set them
+	Defaults *Endpoint `json:"defaults"`
+	// Vars are the variables referenced as ${name} in the backend URLs and header values of the endpoints
+	Vars map[string]string `json:"vars"`
+	// Logging configures the log output
+	Logging LoggingConfig `json:"logging"`
+	// OpenAPI serves the OpenAPI document of the endpoints and a UI to browse it
+	OpenAPI OpenAPIConfig `json:"openapi"`
+	// ReusePort enables SO_REUSEPORT so a new gateway process can bind the port during upgrades
+	ReusePort bool `json:"reuse_port"`
+	// Listeners configures the listeners; if empty, a single listener is started on Port
+	Listeners []ListenerConfig `json:"listeners"`
+	// Socket configures the TCP keep-alive and TCP_NODELAY options of the client connections
+	Socket SocketConfig `json:"socket"`
+	// ConnectionLimits limits the client connections accepted by the listeners, in total and per client IP
+	ConnectionLimits ConnectionLimitsConfig `json:"connection_limits"`
+	// Retry configures the default retry policy and the global retry budget
+	Retry RetryConfig `json:"retry"`
+	// Kubernetes configures the Ingress / Gateway API controller mode
+	Kubernetes KubernetesConfig `json:"kubernetes"`
+	// ShutdownTimeout is the time in milliseconds to wait for in-flight requests on shutdown
+	ShutdownTimeout int `json:"shutdown_timeout"`
+	// SecurityHeaders configures the security headers injected into all responses
+	SecurityHeaders SecurityHeadersConfig `json:"security_headers"`
+	// GatewayHeaders configures the Via and X-Gateway headers and the backend headers removed from responses
+	GatewayHeaders GatewayHeadersConfig `json:"gateway_headers"`
+	// LoadShedding sheds low priority requests first when the gateway is overloaded
+	LoadShedding LoadSheddingConfig `json:"load_shedding"`
+	// Quotas enforces daily request and byte quotas per tenant
+	Quotas TenantQuotaConfig `json:"quotas"`
+	// RouteCache caches the endpoint and path parameters resolved for request paths
+	RouteCache RouteCacheConfig `json:"route_cache"`
+	// WAF configures the request filtering rules applied before proxying
+	WAF WAFConfig `json:"waf"`
+	// OPA configures the authorization of requests by an Open Policy Agent policy
+	OPA OPAConfig `json:"opa"`
+	// ExtAuthz configures the authorization of requests by an external authorization service
+	ExtAuthz ExtAuthzConfig `json:"ext_authz"`
+	// JWT configures the validation of the bearer tokens of the endpoints with jwt_auth
+	JWT JWTConfig `json:"jwt"`
+	// OIDC configures the OpenID Connect login of browser users for the endpoints with oidc_login
+	OIDC OIDCConfig `json:"oidc"`
+	// IdentitySigning signs the identity headers forwarded to the backends
+	IdentitySigning IdentitySigningConfig `json:"identity_signing"`
+	// AuthLockout bans the clients whose requests fail authentication repeatedly
+	AuthLockout AuthLockoutConfig `json:"auth_lockout"`
+	// GeoIP configures geo lookups and geo-based rules
+	GeoIP GeoIPConfig `json:"geoip"`
+	// Admin configures the admin API
+	Admin AdminConfig `json:"admin"`
+	// SignedURLs configures the signing of time-limited URLs for the endpoints with signed_urls
+	SignedURLs SignedURLConfig `json:"signed_urls"`
+	// Cache configures the response cache shared by the endpoints with caching enabled
+	Cache CacheConfig `json:"cache"`
+	// Notifications configures the webhooks notified of operational events
+	Notifications NotificationsConfig `json:"notifications"`
+	// Certificates configures the monitoring of listener and upstream certificate expiry
+	Certificates CertificateMonitoringConfig `json:"certificates"`
+	// Recording configures the recording of sampled traffic to a HAR file
+	Recording RecordingConfig `json:"recording"`
+	// DefaultBackend is the backend URL the requests not matched by any route are forwarded to
+	DefaultBackend string `json:"default_backend"`
+	// NotFoundResponse is the custom response to requests not matched by any route without a default backend
+	NotFoundResponse CustomResponseConfig `json:"not_found"`
+	// MethodNotAllowedResponse is the custom response to requests with a method an endpoint does not allow
+	MethodNotAllowedResponse CustomResponseConfig `json:"method_not_allowed"`
+
+	// decryptedValues are the plaintexts of the encrypted values, masked wherever they appear in the printed
+	// configuration, e.g. copied by the defaults or a variable reference
+	decryptedValues []string
 }
 
 // TelemetryConfig represents OpenTelemetry configuration
@@ -14,6 +84,58 @@ type TelemetryConfig struct {
 	MetricsURL    string `json:"metrics_url"`
 	ServiceName   string `json:"service_name"`
 	ExportTimeout int    `json:"export_timeout"`
+	// Exporters lists the enabled metric exporters, prometheus and/or otlp. By default the Prometheus endpoint
+	// is served and metrics are pushed over OTLP when a metrics URL or OTEL_EXPORTER_OTLP_*ENDPOINT is set.
+	Exporters []string `json:"exporters"`
+	// Protocol is the OTLP protocol, http/protobuf (default) or grpc
+	Protocol string `json:"protocol"`
+	// Headers are sent with the OTLP exports, e.g. for authentication
+	Headers map[string]string `json:"headers"`
+	// BearerToken is sent as Authorization header with the OTLP exports
+	BearerToken string `json:"bearer_token"`
+	// TLS configures the TLS connection to the collector for https metrics URLs
+	TLS OTLPTLSConfig `json:"tls"`
+	// ExportInterval is the interval in milliseconds at which metrics are exported (default 5000)
+	ExportInterval int `json:"export_interval"`
+	// Retry configures the retrying of failed exports
+	Retry OTLPRetryConfig `json:"retry"`
+	// MetricAttributes adds attributes taken from request headers or token claims to the request metrics
+	MetricAttributes []MetricAttributeConfig `json:"metric_attributes"`
+}
+
+// ListenerConfig represents a listener the gateway serves on
+type ListenerConfig struct {
+	Name    string    `json:"name"`
+	Address string    `json:"address"`
+	TLS     TLSConfig `json:"tls"`
+	// Passthrough routes the TLS connections of the listener by SNI to backends terminating TLS themselves,
+	// instead of serving the endpoints
+	Passthrough PassthroughConfig `json:"passthrough"`
+}
+
+// ListenerName returns the listener name, defaulting to its address
+func (l ListenerConfig) ListenerName() string {
+	if l.Name != "" {
+		return l.Name
+	}
+	return l.Address
+}
+
+// TLSConfig represents the TLS settings of a listener
+type TLSConfig struct {
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	// Certificates maps server names, e.g. api.example.com or *.example.com, to the certificates selected by
+	// SNI; the certificate of cert_file is served for the other names
+	Certificates map[string]CertificateFiles `json:"certificates"`
+	// ReloadInterval is the interval in milliseconds at which the certificate files are checked for changes
+	// (default 10000, negative disables the checks)
+	ReloadInterval int `json:"reload_interval"`
+}
+
+// Enabled reports whether TLS is configured
+func (t TLSConfig) Enabled() bool {
+	return (t.CertFile != "" && t.KeyFile != "") || len(t.Certificates) > 0
 }
 
 // Endpoint represents a backend service endpoint configuration
@@ -26,6 +148,96 @@ type Endpoint struct {
 	QueryParams map[string]string `json:"query_params"`
 	// HasPathParams indicates if the path contains parameters (e.g., /api/users/:id)
 	HasPathParams bool `json:"has_path_params"`
+	// Labels are free-form annotations such as team or tier, added to the request metrics and log entries
+	Labels map[string]string `json:"labels"`
+	// PathMode is how the request path maps to the backend path: append (default) appends it to the backend
+	// path, replace replaces the part matched by the endpoint path with the backend path, and template uses
+	// the backend path with its :name segments replaced by the path parameters
+	PathMode string `json:"path_mode"`
+	// SecurityHeaders overrides the global security headers for this endpoint (empty value removes a header)
+	SecurityHeaders map[string]string `json:"security_headers"`
+	// Geo configures per-endpoint geo rules and geo-based backend routing
+	Geo EndpointGeoConfig `json:"geo"`
+	// ProxyURL is the egress proxy used for upstream connections (defaults to HTTP_PROXY/HTTPS_PROXY)
+	ProxyURL string `json:"proxy_url"`
+	// Listeners restricts the endpoint to the named listeners (empty means all listeners)
+	Listeners []string `json:"listeners"`
+	// Host restricts the endpoint to requests for the given host name
+	Host string `json:"host"`
+	// Retry overrides the global retry policy; setting a budget gives the endpoint its own retry budget
+	Retry RetryConfig `json:"retry"`
+	// Backends lists backend instances balanced in round-robin order, used instead of Backend when set
+	Backends []string `json:"backends"`
+	// OutlierDetection configures the passive health checking of the backend instances
+	OutlierDetection OutlierDetectionConfig `json:"outlier_detection"`
+	// AdaptiveConcurrency limits the in-flight requests of each backend instance based on the observed latency
+	AdaptiveConcurrency AdaptiveConcurrencyConfig `json:"adaptive_concurrency"`
+	// Debug enables verbose request and response logging for this endpoint only
+	Debug bool `json:"debug"`
+	// Cache configures the caching of the endpoint responses
+	Cache EndpointCacheConfig `json:"cache"`
+	// GenerateETag adds ETags to successful GET responses without a validator and answers If-None-Match with 304
+	GenerateETag bool `json:"generate_etag"`
+	// Upgrades are the protocols clients may switch the connection to with an Upgrade header, e.g. websocket
+	// or a name/version; other offered protocols are removed (default websocket, * allows any)
+	Upgrades []string `json:"upgrades"`
+	// SLO configures the service level objective tracking of the endpoint
+	SLO EndpointSLOConfig `json:"slo"`
+	// RequestBody configures whether request bodies are streamed or buffered and their maximum size
+	RequestBody RequestBodyConfig `json:"request_body"`
+	// SignedURLs requires requests to carry a valid, unexpired signed URL
+	SignedURLs bool `json:"signed_urls"`
+	// JWTAuth requires requests to carry a valid bearer token
+	JWTAuth bool `json:"jwt_auth"`
+	// ClaimHeaders maps the claims of the validated bearer token to the headers forwarded upstream, e.g. sub
+	// to X-User-ID; client supplied values of the headers are removed
+	ClaimHeaders map[string]string `json:"claim_headers"`
+	// AuthOptional forwards the requests without credentials to an endpoint with jwt_auth with the X-Auth:
+	// anonymous header instead of rejecting them; invalid credentials are still rejected
+	AuthOptional bool `json:"auth_optional"`
+	// OIDCLogin requires browser users to log in with the configured OpenID Connect provider
+	OIDCLogin bool `json:"oidc_login"`
+	// XMLTranslation translates JSON requests into XML for the backend and XML responses back into JSON
+	XMLTranslation XMLTranslationConfig `json:"xml_translation"`
+	// GraphQL enforces depth, complexity and rate limits on the GraphQL operations of the endpoint
+	GraphQL GraphQLConfig `json:"graphql"`
+	// RateLimit limits the requests to the endpoint per second, with separate read and write budgets
+	RateLimit RateLimitConfig `json:"rate_limit"`
+	// TimeoutOverride lets trusted callers request a longer timeout with the X-Timeout-Ms header
+	TimeoutOverride TimeoutOverrideConfig `json:"timeout_override"`
+	// SlowRequestThreshold is the duration in milliseconds above which requests are logged as slow (0 disables it)
+	SlowRequestThreshold int `json:"slow_request_threshold"`
+	// GatewayHeaders replaces the global gateway identification headers settings for this endpoint
+	GatewayHeaders *GatewayHeadersConfig `json:"gateway_headers"`
+	// Priority is the priority of the endpoint requests under overload: low, normal (default), high or critical
+	Priority string `json:"priority"`
+	// Experiment assigns the clients to the variants of an A/B experiment, sent upstream in a header
+	Experiment ExperimentConfig `json:"experiment"`
+	// BlueGreen routes the requests to the active one of a blue and a green group of backend instances,
+	// switched with the admin API
+	BlueGreen BlueGreenConfig `json:"blue_green"`
+	// ErrorStatuses overrides the status answered when the backend gives no response, by failure class:
+	// timeout (default 504), connection_refused, dns_error, tls_error and upstream_error (default 502)
+	ErrorStatuses map[string]int `json:"error_statuses"`
+	// MethodNotAllowed replaces the global method not allowed response for this endpoint
+	MethodNotAllowed *CustomResponseConfig `json:"method_not_allowed"`
+	// Schedule lists changes of the upstream settings applied automatically from a point in time
+	Schedule []ScheduledChange `json:"schedule"`
+	// QueryPolicy restricts the client query parameters forwarded to the backend
+	QueryPolicy QueryPolicyConfig `json:"query_policy"`
+	// QueryTransform renames the client query parameters and adds defaults before the backend call
+	QueryTransform QueryTransformConfig `json:"query_transform"`
+	// FieldFiltering filters the JSON responses to the fields listed by the client in a query parameter
+	FieldFiltering FieldFilteringConfig `json:"field_filtering"`
+	// Pagination normalizes the list responses of the backend into the gateway pagination envelope
+	Pagination PaginationConfig `json:"pagination"`
+	// Masking masks, hashes or drops the sensitive fields of the JSON responses so they never leave the gateway
+	Masking []MaskingRule `json:"masking"`
+	// StatusMappings replaces the backend responses with some statuses, by backend status, e.g. 404 with 204
+	StatusMappings map[int]StatusMapping `json:"status_mappings"`
+
+	// unmatched marks the endpoint of the default backend, whose metrics are labeled with the unmatched route
+	unmatched bool
 }
 
 // ExtractPathParams extracts path parameters from a request URL based on the endpoint path pattern
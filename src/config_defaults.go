@@ -0,0 +1,52 @@
+package main
+
+import "fmt"
+
+// configDefaultsKey is the configuration key of the endpoint settings inherited by all endpoints
+const configDefaultsKey = "defaults"
+
+// endpointIdentityKeys are the endpoint fields identifying an endpoint, which cannot have a default
+var endpointIdentityKeys = []string{"path", "method", "host"}
+
+// applyEndpointDefaults merges each endpoint of a configuration document into the defaults, so the endpoints
+// inherit the default settings they do not set. Objects such as the headers are merged key by key and a null
+// value removes an inherited setting, as for overlays.
+func applyEndpointDefaults(document map[string]interface{}) error {
+	defaults, ok := document[configDefaultsKey].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	for _, key := range endpointIdentityKeys {
+		if _, ok := defaults[key]; ok {
+			return fmt.Errorf("invalid config defaults: the endpoint %s cannot have a default", key)
+		}
+	}
+
+	endpoints, _ := document["endpoints"].([]interface{})
+	for i, endpoint := range endpoints {
+		if _, ok := endpoint.(map[string]interface{}); ok {
+			endpoints[i] = mergeConfigValue(copyConfigValue(defaults), endpoint)
+		}
+	}
+	return nil
+}
+
+// copyConfigValue returns a deep copy of a configuration document value
+func copyConfigValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(value))
+		for key, v := range value {
+			copied[key] = copyConfigValue(v)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(value))
+		for i, v := range value {
+			copied[i] = copyConfigValue(v)
+		}
+		return copied
+	default:
+		return value
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestEndpointDefaults tests that the endpoints inherit the defaults they do not set or remove
+func TestEndpointDefaults(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfigFile(t, dir, "config.json", `{
+		"defaults": {"timeout": 5000, "retry": {"max_retries": 2}, "headers": {"X-Team": "core", "X-Debug": "1"}, "generate_etag": true},
+		"endpoints": [
+			{"path": "/api/users", "backend": "http://users"},
+			{"path": "/api/orders", "backend": "http://orders", "timeout": 30000, "headers": {"X-Team": "orders", "X-Debug": null}, "generate_etag": false}
+		]
+	}`)
+	config, err := NewConfigManager().LoadFromFile(path)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	users, orders := config.Endpoints[0], config.Endpoints[1]
+	if users.Timeout != 5000 || users.Retry.MaxRetries != 2 || !users.GenerateETag || users.Headers["X-Team"] != "core" || users.Headers["X-Debug"] != "1" {
+		t.Errorf("expected the users endpoint to inherit the defaults, got %+v", users)
+	}
+	if orders.Timeout != 30000 || orders.Retry.MaxRetries != 2 || orders.GenerateETag {
+		t.Errorf("expected the orders endpoint to override the defaults, got %+v", orders)
+	}
+	if len(orders.Headers) != 1 || orders.Headers["X-Team"] != "orders" {
+		t.Errorf("expected the orders headers merged into the default headers, got %v", orders.Headers)
+	}
+
+	// The endpoints are identified by their own path, method and host
+	path = writeConfigFile(t, dir, "invalid.json", `{"defaults": {"host": "api.example.com"}, "endpoints": []}`)
+	if _, err := NewConfigManager().LoadFromFile(path); err == nil || !strings.Contains(err.Error(), "host") {
+		t.Errorf("expected an error for a default host, got %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// configIncludeKey is the configuration key listing the files included into a configuration file
+const configIncludeKey = "include"
+
+// readConfigDocument reads a JSON configuration file and the files it includes as a generic document,
+// keeping numbers as written. The files are validated against the configuration schema, in strict mode their
+// unknown keys are rejected as well.
+func readConfigDocument(filePath string, strict bool) (map[string]interface{}, error) {
+	return loadConfigDocument(filePath, strict, nil)
+}
+
+// loadConfigDocument reads a configuration file and resolves its includes. A file holding an array is an
+// endpoint fragment. The included files are merged in order like overlays, then the including file is merged
+// on top so it can override them.
+func loadConfigDocument(filePath string, strict bool, including []string) (map[string]interface{}, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve config file %s: %w", filePath, err)
+	}
+	if containsString(including, absPath) {
+		return nil, fmt.Errorf("config file %s includes itself through %s", filePath, strings.Join(including, " -> "))
+	}
+
+	// Parse the configuration file
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file: %w", err)
+	}
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", filePath, err)
+	}
+	var document map[string]interface{}
+	switch value := value.(type) {
+	case map[string]interface{}:
+		document = value
+	case []interface{}:
+		document = map[string]interface{}{"endpoints": value}
+	default:
+		return nil, fmt.Errorf("config file %s must hold an object or an array of endpoints", filePath)
+	}
+
+	// Validate the file against the configuration schema
+	schema := ConfigSchema()
+	if _, ok := value.([]interface{}); ok {
+		schema = endpointsSchema()
+	}
+	if err := validateConfigFile(filePath, data, schema, strict); err != nil {
+		return nil, err
+	}
+
+	includeValue, ok := document[configIncludeKey]
+	if !ok {
+		return document, nil
+	}
+	delete(document, configIncludeKey)
+	patterns, err := configIncludePatterns(includeValue)
+	if err != nil {
+		return nil, fmt.Errorf("invalid include in config file %s: %w", filePath, err)
+	}
+
+	// Merge the included files, then the including file
+	merged := make(map[string]interface{})
+	for _, pattern := range patterns {
+		files, err := configIncludeFiles(filepath.Dir(filePath), pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include in config file %s: %w", filePath, err)
+		}
+		for _, file := range files {
+			included, err := loadConfigDocument(file, strict, append(including, absPath))
+			if err != nil {
+				return nil, err
+			}
+			merged = mergeConfigDocuments(merged, included)
+		}
+	}
+	return mergeConfigDocuments(merged, document), nil
+}
+
+// configIncludePatterns returns the include patterns of a configuration file, a string or an array of strings
+func configIncludePatterns(value interface{}) ([]string, error) {
+	switch value := value.(type) {
+	case string:
+		return []string{value}, nil
+	case []interface{}:
+		patterns := make([]string, 0, len(value))
+		for _, pattern := range value {
+			pattern, ok := pattern.(string)
+			if !ok {
+				return nil, fmt.Errorf("include entries must be strings")
+			}
+			patterns = append(patterns, pattern)
+		}
+		return patterns, nil
+	default:
+		return nil, fmt.Errorf("include must be a string or an array of strings")
+	}
+}
+
+// configIncludeFiles returns the files an include pattern refers to, relative to the directory of the
+// including file. A directory includes its .json files and a glob may match no file, but a plain file must exist.
+func configIncludeFiles(dir, pattern string) ([]string, error) {
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(dir, pattern)
+	}
+	if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+		pattern = filepath.Join(pattern, "*.json")
+	}
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+	}
+	if len(files) == 0 && !strings.ContainsAny(pattern, "*?[") {
+		return nil, fmt.Errorf("included file %s not found", pattern)
+	}
+	return files, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestConfigInclude tests that included files and endpoint fragments are composed into the configuration
+func TestConfigInclude(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "endpoints"), 0o700); err != nil {
+		t.Fatalf("failed to create the fragment directory: %v", err)
+	}
+	writeConfigFile(t, dir, "endpoints/orders.json", `[{"path": "/api/orders", "backend": "http://orders"}]`)
+	writeConfigFile(t, dir, "endpoints/users.json", `{"endpoints": [{"path": "/api/users", "backend": "http://users"}]}`)
+	writeConfigFile(t, dir, "endpoints/README.md", `not a fragment`)
+	writeConfigFile(t, dir, "admin.json", `{"admin": {"enabled": true, "token": "included"}, "port": 9000}`)
+	main := writeConfigFile(t, dir, "config.json", `{
+		"include": ["admin.json", "endpoints"],
+		"port": 8080,
+		"endpoints": [{"path": "/health", "backend": "http://health"}]
+	}`)
+
+	config, err := NewConfigManager().LoadFromFile(main)
+	if err != nil {
+		t.Fatalf("failed to load the configuration: %v", err)
+	}
+	if config.Port != 8080 || config.Admin.Token != "included" {
+		t.Errorf("expected the including file to override the included ones, got port %d admin %+v", config.Port, config.Admin)
+	}
+	var paths []string
+	for _, endpoint := range config.Endpoints {
+		paths = append(paths, endpoint.Path)
+	}
+	if strings.Join(paths, ",") != "/api/orders,/api/users,/health" {
+		t.Errorf("expected the fragment endpoints in file order, got %v", paths)
+	}
+}
+
+// TestConfigIncludeErrors tests that include cycles and missing files are reported
+func TestConfigIncludeErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFile(t, dir, "a.json", `{"include": "b.json"}`)
+	writeConfigFile(t, dir, "b.json", `{"include": ["a.json"]}`)
+	writeConfigFile(t, dir, "missing.json", `{"include": ["nothing.json", "fragments/*.json"]}`)
+	writeConfigFile(t, dir, "empty.json", `{"include": "fragments/*.json", "port": 8080}`)
+
+	if _, err := NewConfigManager().LoadFromFile(filepath.Join(dir, "a.json")); err == nil || !strings.Contains(err.Error(), "includes itself") {
+		t.Errorf("expected an include cycle error, got %v", err)
+	}
+	if _, err := NewConfigManager().LoadFromFile(filepath.Join(dir, "missing.json")); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected a missing file error, got %v", err)
+	}
+	config, err := NewConfigManager().LoadFromFile(filepath.Join(dir, "empty.json"))
+	if err != nil || config.Port != 8080 {
+		t.Errorf("expected a glob matching no file to be allowed, got %v", err)
+	}
+}
@@ -3,35 +3,65 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"os"
 )
 
 // ConfigManager handles loading and managing configuration
-type ConfigManager struct{}
+type ConfigManager struct {
+	// Strict rejects configuration files with unknown keys, which are usually typos (enabled by default)
+	Strict bool
+}
 
 // NewConfigManager creates a new ConfigManager
 func NewConfigManager() *ConfigManager {
-	return &ConfigManager{}
+	return &ConfigManager{Strict: true}
 }
 
-// LoadFromFile loads the API gateway configuration from a JSON file
+// LoadFromFile loads the API gateway configuration from a JSON file and the files it includes
 func (cm *ConfigManager) LoadFromFile(filePath string) (Config, error) {
-	// Read the configuration file
-	file, err := os.Open(filePath)
+	return cm.LoadWithOverlays(filePath, nil)
+}
+
+// LoadWithOverlays loads a base configuration file with environment overlays applied in order, see
+// mergeConfigDocuments for the merge semantics
+func (cm *ConfigManager) LoadWithOverlays(filePath string, overlays []string) (Config, error) {
+	// Merge the overlays into the base document
+	document, err := readConfigDocument(filePath, cm.Strict)
+	if err != nil {
+		return Config{}, err
+	}
+	for _, overlay := range overlays {
+		overlayDocument, err := readConfigDocument(overlay, cm.Strict)
+		if err != nil {
+			return Config{}, err
+		}
+		document = mergeConfigDocuments(document, overlayDocument)
+	}
+
+	// Decrypt the encrypted values once the overlays may have replaced them
+	decrypted, err := decryptConfigDocument(document)
 	if err != nil {
-		return Config{}, fmt.Errorf("failed to open config file: %w", err)
+		return Config{}, err
+	}
+
+	// Let the endpoints inherit the defaults
+	if err := applyEndpointDefaults(document); err != nil {
+		return Config{}, err
 	}
-	defer func(file *os.File) {
-		_ = file.Close()
-	}(file)
 
-	// Parse the JSON configuration
-	var config Config
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&config); err != nil {
-		return Config{}, fmt.Errorf("failed to parse config file: %w", err)
+	// Parse the merged configuration
+	data, err := json.Marshal(document)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to merge config files: %w", err)
+	}
+	config := Config{decryptedValues: decrypted}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return Config{}, fmt.Errorf("failed to parse merged config: %w", err)
 	}
 
+	// Resolve the variable references
+	if err := ResolveConfigVars(&config); err != nil {
+		return Config{}, err
+	}
 	return config, nil
 }
 
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+)
+
+// overlayArrayKeys are the fields identifying the entries of the configuration arrays merged entry by entry,
+// the entries of other arrays are replaced as a whole
+var overlayArrayKeys = map[string][]string{
+	"endpoints": {"host", "method", "path"},
+	"listeners": {"name"},
+}
+
+// mergeConfigDocuments merges an overlay into a base configuration document. Objects are merged key by key,
+// a null value removes the key, the endpoints and listeners are merged entry by entry and any other value
+// replaces the base value.
+func mergeConfigDocuments(base, overlay map[string]interface{}) map[string]interface{} {
+	for key, value := range overlay {
+		if value == nil {
+			delete(base, key)
+			continue
+		}
+		if keyFields, ok := overlayArrayKeys[key]; ok {
+			baseEntries, baseOK := base[key].([]interface{})
+			overlayEntries, overlayOK := value.([]interface{})
+			if baseOK && overlayOK {
+				base[key] = mergeConfigEntries(baseEntries, overlayEntries, keyFields)
+				continue
+			}
+		}
+		base[key] = mergeConfigValue(base[key], value)
+	}
+	return base
+}
+
+// mergeConfigValue merges an overlay value into a base value
+func mergeConfigValue(base, overlay interface{}) interface{} {
+	baseObject, baseOK := base.(map[string]interface{})
+	overlayObject, overlayOK := overlay.(map[string]interface{})
+	if !baseOK || !overlayOK {
+		return overlay
+	}
+	for key, value := range overlayObject {
+		if value == nil {
+			delete(baseObject, key)
+			continue
+		}
+		baseObject[key] = mergeConfigValue(baseObject[key], value)
+	}
+	return baseObject
+}
+
+// mergeConfigEntries merges the entries of an overlay array into the base entries with the same key fields and
+// appends the others
+func mergeConfigEntries(base, overlay []interface{}, keyFields []string) []interface{} {
+	index := make(map[string]int, len(base))
+	for i, entry := range base {
+		if key, ok := configEntryKey(entry, keyFields); ok {
+			index[key] = i
+		}
+	}
+	for _, entry := range overlay {
+		key, ok := configEntryKey(entry, keyFields)
+		if i, found := index[key]; ok && found {
+			base[i] = mergeConfigValue(base[i], entry)
+			continue
+		}
+		base = append(base, entry)
+	}
+	return base
+}
+
+// configEntryKey returns the key of an array entry made of its key fields
+func configEntryKey(entry interface{}, keyFields []string) (string, bool) {
+	object, ok := entry.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	values := make([]string, len(keyFields))
+	for i, field := range keyFields {
+		value, _ := object[field].(string)
+		if field == "method" {
+			value = strings.ToUpper(value)
+		}
+		values[i] = value
+	}
+	return strings.Join(values, "\x00"), true
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfigFile writes a configuration file to a temporary directory
+func writeConfigFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+// TestLoadWithOverlays tests that overlays are merged into the base configuration
+func TestLoadWithOverlays(t *testing.T) {
+	dir := t.TempDir()
+	base := writeConfigFile(t, dir, "base.json", `{
+		"port": 8080,
+		"debug": true,
+		"admin": {"enabled": true, "token": "dev"},
+		"endpoints": [
+			{"path": "/api/users", "method": "GET", "backend": "http://localhost:3000", "timeout": 5000, "headers": {"X-Env": "dev", "X-Debug": "1"}},
+			{"path": "/api/users", "method": "POST", "backend": "http://localhost:3000"}
+		]
+	}`)
+	prod := writeConfigFile(t, dir, "prod.json", `{
+		"port": 80,
+		"debug": null,
+		"admin": {"token": "prod"},
+		"endpoints": [
+			{"path": "/api/users", "method": "get", "backend": "http://users.prod", "headers": {"X-Env": "prod", "X-Debug": null}},
+			{"path": "/api/orders", "backend": "http://orders.prod"}
+		]
+	}`)
+	region := writeConfigFile(t, dir, "region.json", `{"port": 8443}`)
+
+	config, err := NewConfigManager().LoadWithOverlays(base, []string{prod, region})
+	if err != nil {
+		t.Fatalf("failed to load the configuration: %v", err)
+	}
+	if config.Port != 8443 || config.Debug {
+		t.Errorf("expected the last overlay to win and null to remove the key, got port %d debug %v", config.Port, config.Debug)
+	}
+	if !config.Admin.Enabled || config.Admin.Token != "prod" {
+		t.Errorf("expected the objects to be merged, got %+v", config.Admin)
+	}
+	if len(config.Endpoints) != 3 {
+		t.Fatalf("expected 3 endpoints, got %+v", config.Endpoints)
+	}
+
+	get := config.Endpoints[0]
+	if get.Method != "get" || get.Backend != "http://users.prod" || get.Timeout != 5000 {
+		t.Errorf("expected the matching endpoint to be merged, got %+v", get)
+	}
+	if len(get.Headers) != 1 || get.Headers["X-Env"] != "prod" {
+		t.Errorf("expected the headers to be merged, got %v", get.Headers)
+	}
+	if config.Endpoints[1].Backend != "http://localhost:3000" || config.Endpoints[2].Path != "/api/orders" {
+		t.Errorf("expected the other endpoints to be kept and new ones appended, got %+v", config.Endpoints)
+	}
+}
+
+// TestLoadWithOverlaysInvalid tests that an invalid overlay is reported with its file
+func TestLoadWithOverlaysInvalid(t *testing.T) {
+	dir := t.TempDir()
+	base := writeConfigFile(t, dir, "base.json", `{"port": 8080}`)
+	overlay := writeConfigFile(t, dir, "broken.json", `{"port": }`)
+
+	_, err := NewConfigManager().LoadWithOverlays(base, []string{overlay})
+	if err == nil || !strings.Contains(err.Error(), "broken.json") {
+		t.Errorf("expected an error naming the overlay, got %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// maskedConfigValue replaces the secret values of a printed configuration
+const maskedConfigValue = "********"
+
+// secretConfigKeys are the key segments marking a configuration value or header as secret
+var secretConfigKeys = map[string]bool{
+	"secret":        true,
+	"password":      true,
+	"passwd":        true,
+	"authorization": true,
+	"apikey":        true,
+	"credentials":   true,
+}
+
+// EffectiveConfig returns the configuration with the defaults of the enabled features applied, as the gateway
+// runs with it
+func EffectiveConfig(config Config) Config {
+	if config.ShutdownTimeout <= 0 {
+		config.ShutdownTimeout = int(defaultShutdownTimeout.Milliseconds())
+	}
+	if config.OpenAPI.Enabled {
+		config.OpenAPI = config.OpenAPI.withDefaults()
+	}
+	if len(config.Logging.Sinks) > 0 {
+		sinks := make([]LogSinkConfig, len(config.Logging.Sinks))
+		for i, sink := range config.Logging.Sinks {
+			sinks[i] = sink.withDefaults()
+		}
+		config.Logging.Sinks = sinks
+	}
+
+	endpoints := make([]Endpoint, len(config.Endpoints))
+	for i, endpoint := range config.Endpoints {
+		if endpoint.OutlierDetection.Enabled {
+			endpoint.OutlierDetection = endpoint.OutlierDetection.withDefaults()
+		}
+		if endpoint.AdaptiveConcurrency.Enabled {
+			endpoint.AdaptiveConcurrency = endpoint.AdaptiveConcurrency.withDefaults()
+		}
+		if endpoint.SLO.Target > 0 {
+			endpoint.SLO = endpoint.SLO.withDefaults()
+		}
+		if endpoint.XMLTranslation.Enabled {
+			endpoint.XMLTranslation = endpoint.XMLTranslation.withDefaults()
+		}
+		endpoints[i] = endpoint
+	}
+	config.Endpoints = endpoints
+	return config
+}
+
+// MaskedConfig returns the configuration as a JSON document with the secret values masked: values of keys
+// such as token, client_secret or Authorization, passwords in URLs and the decrypted values wherever they appear
+func MaskedConfig(config Config) (map[string]interface{}, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	var document map[string]interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	maskConfigValue(document, config.decryptedValues)
+	return document, nil
+}
+
+// maskConfigValue masks the secret values of a JSON value in place, and the decrypted values within any string
+func maskConfigValue(value interface{}, decrypted []string) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range value {
+			if text, ok := nested.(string); ok && text != "" && isSecretConfigKey(key) {
+				value[key] = maskedConfigValue
+				continue
+			}
+			value[key] = maskConfigValue(nested, decrypted)
+		}
+	case []interface{}:
+		for i, nested := range value {
+			value[i] = maskConfigValue(nested, decrypted)
+		}
+	case string:
+		for _, plaintext := range decrypted {
+			value = strings.ReplaceAll(value, plaintext, maskedConfigValue)
+		}
+		return maskURLPassword(value)
+	}
+	return value
+}
+
+// isSecretConfigKey checks whether a configuration key or header name holds a secret: a segment such as
+// secret or password, a last segment token (but not token_file), an API key header or a cookie header
+func isSecretConfigKey(key string) bool {
+	segments := strings.FieldsFunc(strings.ToLower(key), func(r rune) bool {
+		return r == '_' || r == '-'
+	})
+	for i, segment := range segments {
+		if secretConfigKeys[segment] || (segment == "api" && i+1 < len(segments) && segments[i+1] == "key") {
+			return true
+		}
+	}
+	if len(segments) > 0 && segments[len(segments)-1] == "token" {
+		return true
+	}
+	key = strings.ToLower(key)
+	return key == "cookie" || key == "set-cookie"
+}
+
+// maskURLPassword masks the password of a URL with credentials
+func maskURLPassword(value string) string {
+	if !strings.Contains(value, "@") || !strings.Contains(value, "://") {
+		return value
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	if _, ok := u.User.Password(); !ok {
+		return value
+	}
+	// Keep the URL as written apart from the password, which url.URL.String would escape
+	start := strings.Index(value, "://") + len("://")
+	at := start + strings.LastIndex(strings.SplitN(value[start:], "/", 2)[0], "@")
+	userinfo := value[start:at]
+	if colon := strings.Index(userinfo, ":"); colon >= 0 {
+		userinfo = userinfo[:colon]
+	}
+	return value[:start] + userinfo + ":" + maskedConfigValue + value[at:]
+}
+
+// WriteEffectiveConfig writes the effective configuration with its secrets masked as indented JSON
+func WriteEffectiveConfig(w io.Writer, config Config) error {
+	document, err := MaskedConfig(EffectiveConfig(config))
+	if err != nil {
+		return fmt.Errorf("failed to encode the configuration: %w", err)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(document)
+}
+
+// RunConfigCommand runs the config subcommand with the given arguments. config print writes the effective
+// configuration with the same flags as the gateway, config schema writes the JSON Schema of the configuration files
+// and config encrypt encrypts a value read from stdin with the config key.
+func RunConfigCommand(args []string) error {
+	if len(args) > 0 && args[0] == "schema" {
+		return WriteConfigSchema(os.Stdout)
+	}
+	if len(args) > 0 && args[0] == "encrypt" {
+		return runConfigEncrypt(args[1:], os.Stdin, os.Stdout)
+	}
+	if len(args) == 0 || args[0] != "print" {
+		return errors.New("usage: config print [-config file] [-overlay file]... [-port port] [-debug] [-strict=false] | config schema | config encrypt [-generate-key]")
+	}
+	flags := flag.NewFlagSet("config print", flag.ContinueOnError)
+	configFile := flags.String("config", "", "Path to configuration file")
+	var overlays stringList
+	flags.Var(&overlays, "overlay", "Path to a configuration overlay merged into the configuration file (repeatable)")
+	port := flags.Int("port", 0, "Port to listen on (overrides config)")
+	debug := flags.Bool("debug", false, "Enable debug mode (overrides config)")
+	strict := flags.Bool("strict", true, "Reject configuration files with unknown fields")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	configManager := NewConfigManager()
+	configManager.Strict = *strict
+	config := configManager.LoadDefault()
+	if *configFile != "" {
+		var err error
+		config, err = configManager.LoadWithOverlays(*configFile, overlays)
+		if err != nil {
+			return err
+		}
+	} else if len(overlays) > 0 {
+		return errors.New("configuration overlays require a configuration file")
+	}
+	if *port > 0 {
+		config.Port = *port
+	}
+	if *debug {
+		config.Debug = true
+	}
+	return WriteEffectiveConfig(os.Stdout, config)
+}
+
+// handleConfig serves the effective configuration of the gateway with its secrets masked
+func (g *Gateway) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	document, err := MaskedConfig(EffectiveConfig(g.config))
+	if err != nil {
+		http.Error(w, "Failed to encode the configuration", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, document)
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// configSchemaDialect is the JSON Schema version of the configuration schema
+const configSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// JSONSchema is the subset of JSON Schema describing the configuration format
+type JSONSchema struct {
+	Schema      string `json:"$schema,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Type is the JSON type of the value, any value is valid if empty
+	Type       string                 `json:"type,omitempty"`
+	Properties map[string]*JSONSchema `json:"properties,omitempty"`
+	// AdditionalProperties is false for objects with a fixed set of keys or the schema of the map values
+	AdditionalProperties interface{}   `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema   `json:"items,omitempty"`
+	AnyOf                []*JSONSchema `json:"anyOf,omitempty"`
+}
+
+var (
+	configSchemaOnce     sync.Once
+	configSchema         *JSONSchema
+	endpointsSchemaValue *JSONSchema
+)
+
+// ConfigSchema returns the JSON Schema of the configuration files, generated from the configuration types
+func ConfigSchema() *JSONSchema {
+	configSchemaOnce.Do(func() {
+		configSchema = jsonSchemaOf(reflect.TypeOf(Config{}))
+		configSchema.Schema = configSchemaDialect
+		configSchema.Title = "SurfBoard configuration"
+		configSchema.Properties["$schema"] = &JSONSchema{Type: "string", Description: "JSON Schema of the file, for editors"}
+		configSchema.Properties[configIncludeKey] = &JSONSchema{
+			Description: "Files, globs or directories included into the configuration, relative to the file",
+			AnyOf:       []*JSONSchema{{Type: "string"}, {Type: "array", Items: &JSONSchema{Type: "string"}}},
+		}
+		endpointsSchemaValue = configSchema.Properties["endpoints"]
+	})
+	return configSchema
+}
+
+// WriteConfigSchema writes the JSON Schema of the configuration files as indented JSON
+func WriteConfigSchema(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(ConfigSchema())
+}
+
+// endpointsSchema returns the JSON Schema of the endpoint fragment files
+func endpointsSchema() *JSONSchema {
+	ConfigSchema()
+	return endpointsSchemaValue
+}
+
+// jsonSchemaOf generates the JSON Schema of the values decoded into a type
+func jsonSchemaOf(t reflect.Type) *JSONSchema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		schema := &JSONSchema{Type: "object", Properties: make(map[string]*JSONSchema), AdditionalProperties: false}
+		addJSONSchemaFields(schema, t)
+		return schema
+	case reflect.Map:
+		return &JSONSchema{Type: "object", AdditionalProperties: jsonSchemaOf(t.Elem())}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &JSONSchema{Type: "string"}
+		}
+		return &JSONSchema{Type: "array", Items: jsonSchemaOf(t.Elem())}
+	case reflect.String:
+		return &JSONSchema{Type: "string"}
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: "number"}
+	default:
+		return &JSONSchema{}
+	}
+}
+
+// addJSONSchemaFields adds the fields of a struct to an object schema by their JSON name, with the fields of
+// embedded structs promoted
+func addJSONSchemaFields(schema *JSONSchema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				addJSONSchemaFields(schema, embedded)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if _, ok := schema.Properties[name]; !ok {
+			schema.Properties[name] = jsonSchemaOf(field.Type)
+		}
+	}
+}
+
+// property returns the schema of an object key, matched case-insensitively like encoding/json does. It
+// returns false if the object does not allow the key.
+func (s *JSONSchema) property(key string) (*JSONSchema, bool) {
+	if property, ok := s.Properties[key]; ok {
+		return property, true
+	}
+	for name, property := range s.Properties {
+		if strings.EqualFold(name, key) {
+			return property, true
+		}
+	}
+	switch additional := s.AdditionalProperties.(type) {
+	case *JSONSchema:
+		return additional, true
+	case bool:
+		return &JSONSchema{}, additional
+	}
+	return &JSONSchema{}, true
+}
+
+// configValidator walks the tokens of a configuration file against the configuration schema
+type configValidator struct {
+	file    string
+	data    []byte
+	decoder *json.Decoder
+	// strict reports the keys no option is read from, which encoding/json silently ignores
+	strict bool
+	errs   []error
+}
+
+// validateConfigFile validates a configuration file against a schema and reports the violations with their
+// line and column. Null is valid for any value, as overlays remove keys with it.
+func validateConfigFile(file string, data []byte, schema *JSONSchema, strict bool) error {
+	v := &configValidator{file: file, data: data, decoder: json.NewDecoder(bytes.NewReader(data)), strict: strict}
+	v.decoder.UseNumber()
+	if err := v.value(schema, ""); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", file, err)
+	}
+	return errors.Join(v.errs...)
+}
+
+// value validates the next value of the token stream
+func (v *configValidator) value(schema *JSONSchema, path string) error {
+	token, err := v.decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return nil
+	}
+	if len(schema.AnyOf) > 0 {
+		schema = &JSONSchema{}
+	}
+
+	delim, ok := token.(json.Delim)
+	if !ok {
+		if actual := jsonTokenType(token); !jsonTypeMatches(schema.Type, actual, token) {
+			v.errorf(path, "expected %s, got %s", schema.Type, actual)
+		}
+		return nil
+	}
+	actual := "object"
+	if delim == '[' {
+		actual = "array"
+	}
+	if !jsonTypeMatches(schema.Type, actual, token) {
+		v.errorf(path, "expected %s, got %s", schema.Type, actual)
+		schema = &JSONSchema{}
+	}
+
+	for i := 0; v.decoder.More(); i++ {
+		if delim == '[' {
+			items := schema.Items
+			if items == nil {
+				items = &JSONSchema{}
+			}
+			if err := v.value(items, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		token, err := v.decoder.Token()
+		if err != nil {
+			return err
+		}
+		key := joinConfigPath(path, fmt.Sprint(token))
+		property, ok := schema.property(fmt.Sprint(token))
+		if !ok && v.strict {
+			v.errorf(key, "unknown field")
+		}
+		if err := v.value(property, key); err != nil {
+			return err
+		}
+	}
+
+	// Consume the closing delimiter
+	_, err = v.decoder.Token()
+	return err
+}
+
+// errorf records a violation at the last token read
+func (v *configValidator) errorf(path, format string, args ...interface{}) {
+	line, column := v.position()
+	v.errs = append(v.errs, fmt.Errorf("%s:%d:%d: %s %q", v.file, line, column, fmt.Sprintf(format, args...), path))
+}
+
+// position returns the line and column of the start of the last token read
+func (v *configValidator) position() (int, int) {
+	offset := int(v.decoder.InputOffset())
+	if offset > 0 && v.data[offset-1] == '"' {
+		// Find the opening quote of a string
+		for offset--; offset > 0; offset-- {
+			if v.data[offset-1] == '"' && (offset < 2 || v.data[offset-2] != '\\') {
+				offset--
+				break
+			}
+		}
+	} else if offset > 0 && (v.data[offset-1] == '{' || v.data[offset-1] == '[') {
+		offset--
+	} else {
+		for offset > 0 && !strings.ContainsRune(" \t\r\n,:[{", rune(v.data[offset-1])) {
+			offset--
+		}
+	}
+	lineStart := bytes.LastIndexByte(v.data[:offset], '\n') + 1
+	return bytes.Count(v.data[:offset], []byte("\n")) + 1, offset - lineStart + 1
+}
+
+// jsonTokenType returns the JSON type of a scalar token
+func jsonTokenType(token json.Token) string {
+	switch token.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	default:
+		return "number"
+	}
+}
+
+// jsonTypeMatches checks whether a value of a JSON type is valid for a schema type
+func jsonTypeMatches(expected, actual string, token json.Token) bool {
+	switch {
+	case expected == "" || expected == actual:
+		return true
+	case expected == "integer" && actual == "number":
+		_, err := token.(json.Number).Int64()
+		return err == nil
+	case expected == "number" && actual == "number":
+		return true
+	}
+	return false
+}
+
+// joinConfigPath appends a key to the path of a configuration value
+func joinConfigPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestConfigSchemaFile tests that the published schema matches the configuration types
+func TestConfigSchemaFile(t *testing.T) {
+	published, err := os.ReadFile(filepath.Join("..", "config.schema.json"))
+	if err != nil {
+		t.Fatalf("failed to read the published schema: %v", err)
+	}
+	var generated bytes.Buffer
+	if err := WriteConfigSchema(&generated); err != nil {
+		t.Fatalf("failed to generate the schema: %v", err)
+	}
+	if !bytes.Equal(published, generated.Bytes()) {
+		t.Error("config.schema.json is outdated, regenerate it with: go run ./src config schema > config.schema.json")
+	}
+
+	endpoint := ConfigSchema().Properties["endpoints"].Items
+	if endpoint.Properties["timeout"].Type != "integer" || endpoint.Properties["headers"].AdditionalProperties.(*JSONSchema).Type != "string" {
+		t.Errorf("unexpected endpoint schema %+v", endpoint.Properties)
+	}
+}
+
+// TestValidateConfigFile tests that values of the wrong type are reported with their line and column
+func TestValidateConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfigFile(t, dir, "config.json", `{
+  "$schema": "./config.schema.json",
+  "port": "8080",
+  "debug": null,
+  "endpoints": [
+    {"path": "/api/users", "timeout": 1.5, "headers": {"X-Retry": 3}},
+    {"path": "/api/orders", "timeout": 1000, "method": ["GET"]}
+  ],
+  "telemetry": {"enabled": "yes"}
+}`)
+
+	// Type violations are reported without strict mode as well
+	configManager := NewConfigManager()
+	configManager.Strict = false
+	_, err := configManager.LoadFromFile(path)
+	if err == nil {
+		t.Fatal("expected the invalid values to be rejected")
+	}
+	for _, expected := range []string{
+		`config.json:3:11: expected integer, got string "port"`,
+		`config.json:6:39: expected integer, got number "endpoints[0].timeout"`,
+		`config.json:6:67: expected string, got number "endpoints[0].headers.X-Retry"`,
+		`config.json:7:56: expected string, got array "endpoints[1].method"`,
+		`config.json:9:28: expected boolean, got string "telemetry.enabled"`,
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q in %v", expected, err)
+		}
+	}
+	if strings.Contains(err.Error(), "debug") || strings.Contains(err.Error(), "$schema") {
+		t.Errorf("expected null values and $schema to be valid, got %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// encryptedValuePrefix marks the encrypted string values of the configuration files
+const encryptedValuePrefix = "enc:v1:"
+
+// Environment variables providing the key the configuration values are encrypted with, checked in order
+const (
+	configKeyEnv        = "SURFBOARD_CONFIG_KEY"
+	configKeyFileEnv    = "SURFBOARD_CONFIG_KEY_FILE"
+	configKeyCommandEnv = "SURFBOARD_CONFIG_KEY_COMMAND"
+)
+
+// configKey returns the base64 encoded 256-bit key of the encrypted configuration values from the
+// environment: the key itself, a file holding it or a command printing it, e.g. a KMS decrypt call
+func configKey() ([]byte, error) {
+	var encoded string
+	switch {
+	case os.Getenv(configKeyEnv) != "":
+		encoded = os.Getenv(configKeyEnv)
+	case os.Getenv(configKeyFileEnv) != "":
+		data, err := os.ReadFile(os.Getenv(configKeyFileEnv))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config key: %w", err)
+		}
+		encoded = string(data)
+	case os.Getenv(configKeyCommandEnv) != "":
+		cmd := exec.Command("sh", "-c", os.Getenv(configKeyCommandEnv))
+		cmd.Stderr = os.Stderr
+		output, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("config key command failed: %w", err)
+		}
+		encoded = string(output)
+	default:
+		return nil, fmt.Errorf("encrypted config values require %s, %s or %s", configKeyEnv, configKeyFileEnv, configKeyCommandEnv)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("config key must be 32 bytes encoded in base64")
+	}
+	return key, nil
+}
+
+// configCipher returns the AES-256-GCM cipher of a key
+func configCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptConfigValue encrypts a configuration value with a key, returning the enc:v1: value to write into
+// the configuration file
+func EncryptConfigValue(value string, key []byte) (string, error) {
+	aead, err := configCipher(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), nil)
+	return encryptedValuePrefix + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// decryptConfigValue decrypts an enc:v1: configuration value
+func decryptConfigValue(aead cipher.AEAD, value string) (string, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(value, encryptedValuePrefix))
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errors.New("malformed encrypted value")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errors.New("encrypted value cannot be decrypted with the config key")
+	}
+	return string(plaintext), nil
+}
+
+// decryptConfigDocument replaces the encrypted string values of a configuration document with their
+// plaintext, returning the decrypted values. The key is only read from the environment if the document holds
+// encrypted values.
+func decryptConfigDocument(document map[string]interface{}) ([]string, error) {
+	var aead cipher.AEAD
+	var decrypted []string
+	var walk func(value interface{}, path string) (interface{}, error)
+	walk = func(value interface{}, path string) (interface{}, error) {
+		switch value := value.(type) {
+		case map[string]interface{}:
+			for key, child := range value {
+				decrypted, err := walk(child, joinConfigPath(path, key))
+				if err != nil {
+					return nil, err
+				}
+				value[key] = decrypted
+			}
+		case []interface{}:
+			for i, child := range value {
+				decrypted, err := walk(child, fmt.Sprintf("%s[%d]", path, i))
+				if err != nil {
+					return nil, err
+				}
+				value[i] = decrypted
+			}
+		case string:
+			if !strings.HasPrefix(value, encryptedValuePrefix) {
+				return value, nil
+			}
+			if aead == nil {
+				key, err := configKey()
+				if err != nil {
+					return nil, err
+				}
+				if aead, err = configCipher(key); err != nil {
+					return nil, err
+				}
+			}
+			plaintext, err := decryptConfigValue(aead, value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decrypt %s: %w", path, err)
+			}
+			if plaintext != "" && !containsString(decrypted, plaintext) {
+				decrypted = append(decrypted, plaintext)
+			}
+			return plaintext, nil
+		}
+		return value, nil
+	}
+	if _, err := walk(document, ""); err != nil {
+		return nil, err
+	}
+	return decrypted, nil
+}
+
+// runConfigEncrypt encrypts the value read from stdin with the config key of the environment, or generates a
+// new key with -generate-key
+func runConfigEncrypt(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) > 0 && args[0] == "-generate-key" {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintln(stdout, base64.StdEncoding.EncodeToString(key))
+		return err
+	}
+	if len(args) > 0 {
+		return errors.New("usage: config encrypt [-generate-key] < value")
+	}
+
+	key, err := configKey()
+	if err != nil {
+		return err
+	}
+	value, err := io.ReadAll(stdin)
+	if err != nil {
+		return err
+	}
+	encrypted, err := EncryptConfigValue(strings.TrimSuffix(string(value), "\n"), key)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(stdout, encrypted)
+	return err
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// TestEncryptedConfigValues tests that the encrypted values are decrypted with the key of the environment
+func TestEncryptedConfigValues(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	t.Setenv(configKeyEnv, base64.StdEncoding.EncodeToString(key))
+	secret, err := EncryptConfigValue("jwt-secret", key)
+	if err != nil {
+		t.Fatalf("EncryptConfigValue() error = %v", err)
+	}
+	apiKey, err := EncryptConfigValue("api-key", key)
+	if err != nil {
+		t.Fatalf("EncryptConfigValue() error = %v", err)
+	}
+
+	dir := t.TempDir()
+	path := writeConfigFile(t, dir, "config.json", `{
+		"jwt": {"enabled": true, "secret": "`+secret+`"},
+		"vars": {"api_key": "`+apiKey+`"},
+		"endpoints": [{"path": "/api/", "backend": "http://api:8080", "headers": {"X-Api-Key": "${api_key}"}}]
+	}`)
+	config, err := NewConfigManager().LoadFromFile(path)
+	if err != nil {
+		t.Fatalf("failed to load the configuration: %v", err)
+	}
+	if config.JWT.Secret != "jwt-secret" || config.Endpoints[0].Headers["X-Api-Key"] != "api-key" {
+		t.Errorf("expected the decrypted values, got %q and %v", config.JWT.Secret, config.Endpoints[0].Headers)
+	}
+
+	// Values encrypted with another key are reported with their path
+	t.Setenv(configKeyEnv, base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{8}, 32)))
+	_, err = NewConfigManager().LoadFromFile(path)
+	if err == nil || !(strings.Contains(err.Error(), "jwt.secret") || strings.Contains(err.Error(), "vars.api_key")) {
+		t.Errorf("expected a decryption error naming the value, got %v", err)
+	}
+	t.Setenv(configKeyEnv, "")
+	if _, err := NewConfigManager().LoadFromFile(path); err == nil || !strings.Contains(err.Error(), configKeyEnv) {
+		t.Errorf("expected an error asking for the key, got %v", err)
+	}
+}
+
+// TestEncryptedConfigValuesMasked tests that the decrypted values are masked in the printed configuration
+// under keys that do not look secret, and wherever variables or defaults copied them
+func TestEncryptedConfigValuesMasked(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	t.Setenv(configKeyEnv, base64.StdEncoding.EncodeToString(key))
+	tenant, err := EncryptConfigValue("tenant-7f3a", key)
+	if err != nil {
+		t.Fatalf("EncryptConfigValue() error = %v", err)
+	}
+	region, err := EncryptConfigValue("eu-hidden-1", key)
+	if err != nil {
+		t.Fatalf("EncryptConfigValue() error = %v", err)
+	}
+
+	dir := t.TempDir()
+	path := writeConfigFile(t, dir, "config.json", `{
+		"vars": {"tenant": "`+tenant+`"},
+		"defaults": {"headers": {"X-Region": "`+region+`"}},
+		"endpoints": [{"path": "/api/", "backend": "http://api:8080/${tenant}/", "headers": {"X-Tenant": "${tenant}"}}]
+	}`)
+	config, err := NewConfigManager().LoadFromFile(path)
+	if err != nil {
+		t.Fatalf("failed to load the configuration: %v", err)
+	}
+	var printed bytes.Buffer
+	if err := WriteEffectiveConfig(&printed, config); err != nil {
+		t.Fatalf("WriteEffectiveConfig() error = %v", err)
+	}
+	if strings.Contains(printed.String(), "tenant-7f3a") || strings.Contains(printed.String(), "eu-hidden-1") {
+		t.Errorf("expected the decrypted values to be masked, got %s", printed.String())
+	}
+	if !strings.Contains(printed.String(), `"http://api:8080/`+maskedConfigValue+`/"`) {
+		t.Errorf("expected the variable reference to be masked in the backend URL, got %s", printed.String())
+	}
+}
+
+// TestConfigEncryptCommand tests that config encrypt output decrypts to the value read from stdin
+func TestConfigEncryptCommand(t *testing.T) {
+	var generated bytes.Buffer
+	if err := runConfigEncrypt([]string{"-generate-key"}, nil, &generated); err != nil {
+		t.Fatalf("runConfigEncrypt() error = %v", err)
+	}
+	t.Setenv(configKeyEnv, strings.TrimSpace(generated.String()))
+
+	var encrypted bytes.Buffer
+	if err := runConfigEncrypt(nil, strings.NewReader("s3cret\n"), &encrypted); err != nil {
+		t.Fatalf("runConfigEncrypt() error = %v", err)
+	}
+	document := map[string]interface{}{"admin": map[string]interface{}{"token": strings.TrimSpace(encrypted.String())}}
+	decrypted, err := decryptConfigDocument(document)
+	if err != nil {
+		t.Fatalf("decryptConfigDocument() error = %v", err)
+	}
+	if token := document["admin"].(map[string]interface{})["token"]; token != "s3cret" || len(decrypted) != 1 {
+		t.Errorf("expected the decrypted token, got %v and %v", token, decrypted)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestStrictConfig tests that unknown keys are reported with their file, line, column and path
+func TestStrictConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFile(t, dir, "fragment.json", `[
+	{"path": "/api/orders", "backend": "http://orders", "timout": 1000}
+]`)
+	path := writeConfigFile(t, dir, "config.json", `{
+	"include": "fragment.json",
+	"port": 8080,
+	"endpoints": [
+		{
+			"path": "/api/users",
+			"Backend": "http://users",
+			"quer_params": {"page": "1"},
+			"headers": {"X-Any-Header": "kept"}
+		}
+	],
+	"admin": {"enabled": true, "tokn": "secret"}
+}`)
+
+	_, err := NewConfigManager().LoadFromFile(path)
+	if err == nil {
+		t.Fatal("expected the unknown fields to be rejected")
+	}
+	for _, expected := range []string{
+		filepath.Join(dir, "config.json") + `:8:4: unknown field "endpoints[0].quer_params"`,
+		`:12:29: unknown field "admin.tokn"`,
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q in %v", expected, err)
+		}
+	}
+	if strings.Contains(err.Error(), "Backend") || strings.Contains(err.Error(), "X-Any-Header") {
+		t.Errorf("expected case-insensitive field names and map keys to be accepted, got %v", err)
+	}
+
+	// The included files are checked as well
+	correctPath := writeConfigFile(t, dir, "correct.json", `{"include": "fragment.json", "port": 8080}`)
+	_, err = NewConfigManager().LoadFromFile(correctPath)
+	if err == nil || !strings.Contains(err.Error(), `fragment.json:2:54: unknown field "[0].timout"`) {
+		t.Errorf("expected the fragment typo to be reported, got %v", err)
+	}
+
+	// Unknown keys are ignored when strict mode is disabled
+	configManager := NewConfigManager()
+	configManager.Strict = false
+	config, err := configManager.LoadFromFile(path)
+	if err != nil || len(config.Endpoints) != 2 || config.Endpoints[1].Backend != "http://users" {
+		t.Errorf("expected the configuration to load without strict mode, got %+v %v", config.Endpoints, err)
+	}
+}
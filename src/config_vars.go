@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// configVarPattern matches the ${name} variable references of the configuration
+var configVarPattern = regexp.MustCompile(`\$\{([A-Za-z0-9_.-]+)\}`)
+
+// ResolveConfigVars replaces the ${name} references to the configuration variables in the backend URLs and
+// header values of the endpoints and their scheduled changes and in the default backend. A reference to an undefined variable is an error.
+func ResolveConfigVars(config *Config) error {
+	var undefined []string
+	resolve := func(value string) string {
+		return configVarPattern.ReplaceAllStringFunc(value, func(reference string) string {
+			name := configVarPattern.FindStringSubmatch(reference)[1]
+			resolved, ok := config.Vars[name]
+			if !ok {
+				if !containsString(undefined, name) {
+					undefined = append(undefined, name)
+				}
+				return reference
+			}
+			return resolved
+		})
+	}
+
+	resolveAll := func(values []string) []string {
+		if len(values) == 0 {
+			return values
+		}
+		resolved := make([]string, len(values))
+		for i, value := range values {
+			resolved[i] = resolve(value)
+		}
+		return resolved
+	}
+
+	resolveValues := func(values map[string]string) map[string]string {
+		if len(values) == 0 {
+			return values
+		}
+		resolved := make(map[string]string, len(values))
+		for name, value := range values {
+			resolved[name] = resolve(value)
+		}
+		return resolved
+	}
+
+	config.DefaultBackend = resolve(config.DefaultBackend)
+	for i := range config.Endpoints {
+		endpoint := &config.Endpoints[i]
+		endpoint.Backend = resolve(endpoint.Backend)
+		endpoint.Backends = resolveAll(endpoint.Backends)
+		endpoint.BlueGreen.Blue = resolveAll(endpoint.BlueGreen.Blue)
+		endpoint.BlueGreen.Green = resolveAll(endpoint.BlueGreen.Green)
+		endpoint.Headers = resolveValues(endpoint.Headers)
+		for j := range endpoint.Schedule {
+			change := &endpoint.Schedule[j]
+			change.Backend = resolve(change.Backend)
+			change.Backends = resolveAll(change.Backends)
+			change.Headers = resolveValues(change.Headers)
+		}
+	}
+
+	if len(undefined) > 0 {
+		sort.Strings(undefined)
+		return fmt.Errorf("undefined config variables: %v", undefined)
+	}
+	return nil
+}
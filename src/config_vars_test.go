@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestConfigVars tests that the variables are substituted in the backend URLs and header values
+func TestConfigVars(t *testing.T) {
+	dir := t.TempDir()
+	base := writeConfigFile(t, dir, "base.json", `{
+		"vars": {"users_svc": "http://users:8080", "tenant": "acme"},
+		"default_backend": "${users_svc}/legacy",
+		"endpoints": [
+			{"path": "/api/users/:id", "backend": "${users_svc}/users/:id", "headers": {"X-Tenant": "${tenant}", "X-Literal": "$tenant"}},
+			{"path": "/api/pool/", "backends": ["${users_svc}", "http://users-2:8080"]}
+		]
+	}`)
+	prod := writeConfigFile(t, dir, "prod.json", `{"vars": {"users_svc": "https://users.prod"}}`)
+
+	config, err := NewConfigManager().LoadWithOverlays(base, []string{prod})
+	if err != nil {
+		t.Fatalf("failed to load the configuration: %v", err)
+	}
+	if config.DefaultBackend != "https://users.prod/legacy" || config.Endpoints[0].Backend != "https://users.prod/users/:id" {
+		t.Errorf("expected the overlay variable in the backend URLs, got %q and %q", config.DefaultBackend, config.Endpoints[0].Backend)
+	}
+	if config.Endpoints[0].Headers["X-Tenant"] != "acme" || config.Endpoints[0].Headers["X-Literal"] != "$tenant" {
+		t.Errorf("unexpected headers %v", config.Endpoints[0].Headers)
+	}
+	if strings.Join(config.Endpoints[1].Backends, ",") != "https://users.prod,http://users-2:8080" {
+		t.Errorf("unexpected backends %v", config.Endpoints[1].Backends)
+	}
+}
+
+// TestConfigVarsUndefined tests that references to undefined variables are reported
+func TestConfigVarsUndefined(t *testing.T) {
+	config := Config{
+		Vars:      map[string]string{"known": "http://known"},
+		Endpoints: []Endpoint{{Path: "/a", Backend: "${orders_svc}/a", Headers: map[string]string{"X-Key": "${api_key}"}}},
+	}
+	err := ResolveConfigVars(&config)
+	if err == nil || err.Error() != "undefined config variables: [api_key orders_svc]" {
+		t.Errorf("expected the undefined variables to be reported, got %v", err)
+	}
+}
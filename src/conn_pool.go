@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"sync"
+)
+
+// ConnectionPoolStats are the statistics of the upstream connections to a backend instance. Idle connections
+// are only tracked for HTTP/1, HTTP/2 connections are shared by concurrent requests instead.
+type ConnectionPoolStats struct {
+	Backend string `json:"backend"`
+	// Open and Idle are the connections currently open and waiting in the idle pool
+	Open int64 `json:"open"`
+	Idle int64 `json:"idle"`
+	// Created and Closed are the connections created and closed since the start
+	Created int64 `json:"created"`
+	Closed  int64 `json:"closed"`
+	// Requests is the number of requests sent and Reused the number of them sent on an existing connection
+	Requests int64 `json:"requests"`
+	Reused   int64 `json:"reused"`
+	// ReuseRatio is the share of the requests sent on an existing connection
+	ReuseRatio float64 `json:"reuse_ratio"`
+}
+
+// EndpointConnectionStats are the upstream connection statistics of an endpoint
+type EndpointConnectionStats struct {
+	Endpoint string `json:"endpoint"`
+	// MaxIdleConnsPerHost is the number of idle connections kept for each backend instance
+	MaxIdleConnsPerHost int                   `json:"max_idle_conns_per_host"`
+	Backends            []ConnectionPoolStats `json:"backends"`
+}
+
+// connectionPool tracks the connections of an upstream transport by backend instance
+type connectionPool struct {
+	mu        sync.Mutex
+	route     string
+	backends  map[string]*ConnectionPoolStats
+	telemetry *TelemetryManager
+}
+
+// newConnectionPool creates a connectionPool tracking the connections dialed by a transport
+func newConnectionPool(route string, transport *http.Transport, telemetry *TelemetryManager) *connectionPool {
+	pool := &connectionPool{
+		route:     route,
+		backends:  make(map[string]*ConnectionPoolStats),
+		telemetry: telemetry,
+	}
+	dial := transport.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &trackedConn{Conn: conn, pool: pool}, nil
+	}
+	return pool
+}
+
+// trackedConn is an upstream connection reporting its use and close to its pool. Its backend is set by the
+// first request sent on it, its state is guarded by the mutex of the pool.
+type trackedConn struct {
+	net.Conn
+	pool    *connectionPool
+	backend string
+	idle    bool
+	closed  bool
+}
+
+// Close closes the connection and records it
+func (c *trackedConn) Close() error {
+	c.pool.closed(c)
+	return c.Conn.Close()
+}
+
+// stats returns the statistics of a backend instance, the pool mutex must be held
+func (p *connectionPool) stats(backend string) *ConnectionPoolStats {
+	stats, ok := p.backends[backend]
+	if !ok {
+		stats = &ConnectionPoolStats{Backend: backend}
+		p.backends[backend] = stats
+	}
+	return stats
+}
+
+// acquired records a request sent on a connection
+func (p *connectionPool) acquired(c *trackedConn, backend string, reused bool) {
+	p.mu.Lock()
+	created, wasIdle := false, c.idle
+	if c.backend == "" {
+		c.backend = backend
+		created = !c.closed
+	}
+	backend = c.backend
+	stats := p.stats(backend)
+	stats.Requests++
+	if reused {
+		stats.Reused++
+	}
+	if created {
+		stats.Created++
+		stats.Open++
+	}
+	if wasIdle {
+		c.idle = false
+		stats.Idle--
+	}
+	p.mu.Unlock()
+
+	if p.telemetry != nil {
+		p.telemetry.RecordConnectionAcquired(context.Background(), p.route, backend, reused, created, wasIdle)
+	}
+}
+
+// released records a connection returned to the idle pool
+func (p *connectionPool) released(c *trackedConn) {
+	p.mu.Lock()
+	if c.idle || c.closed || c.backend == "" {
+		p.mu.Unlock()
+		return
+	}
+	c.idle = true
+	backend := c.backend
+	p.stats(backend).Idle++
+	p.mu.Unlock()
+
+	if p.telemetry != nil {
+		p.telemetry.RecordConnectionIdle(context.Background(), p.route, backend, 1)
+	}
+}
+
+// closed records a closed connection
+func (p *connectionPool) closed(c *trackedConn) {
+	p.mu.Lock()
+	if c.closed {
+		p.mu.Unlock()
+		return
+	}
+	c.closed = true
+	backend, wasIdle := c.backend, c.idle
+	c.idle = false
+	if backend != "" {
+		stats := p.stats(backend)
+		stats.Open--
+		stats.Closed++
+		if wasIdle {
+			stats.Idle--
+		}
+	}
+	p.mu.Unlock()
+
+	if p.telemetry != nil && backend != "" {
+		p.telemetry.RecordConnectionClosed(context.Background(), p.route, backend, wasIdle)
+	}
+}
+
+// Stats returns the statistics of the backend instances sorted by backend
+func (p *connectionPool) Stats() []ConnectionPoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := make([]ConnectionPoolStats, 0, len(p.backends))
+	for _, backend := range p.backends {
+		s := *backend
+		if s.Requests > 0 {
+			s.ReuseRatio = float64(s.Reused) / float64(s.Requests)
+		}
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Backend < stats[j].Backend })
+	return stats
+}
+
+// trackedConnOf returns the tracked connection under a connection handed to a request, or nil
+func trackedConnOf(conn net.Conn) *trackedConn {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	tracked, _ := conn.(*trackedConn)
+	return tracked
+}
+
+// connectionPoolTransport is a round tripper recording the connections the requests are sent on
+type connectionPoolTransport struct {
+	next http.RoundTripper
+	pool *connectionPool
+}
+
+// RoundTrip records the connection of the request and its return to the idle pool
+func (t *connectionPoolTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var mu sync.Mutex
+	var conn *trackedConn
+	backend := req.URL.Host
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			tracked := trackedConnOf(info.Conn)
+			if tracked == nil {
+				return
+			}
+			mu.Lock()
+			conn = tracked
+			mu.Unlock()
+			t.pool.acquired(tracked, backend, info.Reused)
+		},
+		PutIdleConn: func(err error) {
+			mu.Lock()
+			tracked := conn
+			mu.Unlock()
+			if err == nil && tracked != nil {
+				t.pool.released(tracked)
+			}
+		},
+	}
+	return t.next.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+}
+
+// handleConnections serves the upstream connection statistics of the endpoints
+func (g *Gateway) handleConnections(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	stats := []EndpointConnectionStats{}
+	for path, proxy := range g.proxies {
+		proxy = proxy.Current()
+		if proxy.connections == nil {
+			continue
+		}
+		stats = append(stats, EndpointConnectionStats{
+			Endpoint:            path,
+			MaxIdleConnsPerHost: maxIdleConnsPerHost(proxy.transport),
+			Backends:            proxy.connections.Stats(),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Endpoint < stats[j].Endpoint })
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// maxIdleConnsPerHost returns the number of idle connections a transport keeps for each host
+func maxIdleConnsPerHost(transport *http.Transport) int {
+	if transport.MaxIdleConnsPerHost > 0 {
+		return transport.MaxIdleConnsPerHost
+	}
+	return http.DefaultMaxIdleConnsPerHost
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestConnectionPoolStats tests that the upstream keep-alive connections are counted per backend
+func TestConnectionPoolStats(t *testing.T) {
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer backendServer.Close()
+
+	proxy := NewProxy(Endpoint{Path: "/", Backend: backendServer.URL}, false, nil)
+	handler := proxy.Handler()
+	for i := 0; i < 3; i++ {
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest("GET", "/", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rr.Code)
+		}
+	}
+
+	stats := proxy.connections.Stats()
+	backend := strings.TrimPrefix(backendServer.URL, "http://")
+	if len(stats) != 1 || stats[0].Backend != backend {
+		t.Fatalf("expected the statistics of %s, got %+v", backend, stats)
+	}
+	s := stats[0]
+	if s.Created != 1 || s.Open != 1 || s.Idle != 1 || s.Requests != 3 || s.Reused != 2 {
+		t.Errorf("expected one reused idle connection, got %+v", s)
+	}
+
+	proxy.transport.CloseIdleConnections()
+	s = proxy.connections.Stats()[0]
+	if s.Closed != 1 || s.Open != 0 || s.Idle != 0 {
+		t.Errorf("expected the idle connection to be closed, got %+v", s)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// ConnectionLimitsConfig represents the limits on the client connections accepted by the listeners
+type ConnectionLimitsConfig struct {
+	// MaxConnections is the number of connections open at once over all listeners; further connections wait
+	// in the listen backlog until one is closed (0 is unlimited)
+	MaxConnections int `json:"max_connections"`
+	// MaxConnectionsPerIP is the number of connections a client IP may have open at once; further connections
+	// are closed as soon as they are accepted (0 is unlimited)
+	MaxConnectionsPerIP int `json:"max_connections_per_ip"`
+}
+
+// enabled reports whether any connection limit is configured
+func (c ConnectionLimitsConfig) enabled() bool {
+	return c.MaxConnections > 0 || c.MaxConnectionsPerIP > 0
+}
+
+// ConnectionLimiter limits the client connections of all listeners, in total and per client IP
+type ConnectionLimiter struct {
+	config    ConnectionLimitsConfig
+	slots     chan struct{}
+	telemetry *TelemetryManager
+
+	mu    sync.Mutex
+	perIP map[string]int
+}
+
+// NewConnectionLimiter creates a new ConnectionLimiter
+func NewConnectionLimiter(config ConnectionLimitsConfig, telemetry *TelemetryManager) *ConnectionLimiter {
+	limiter := &ConnectionLimiter{
+		config:    config,
+		telemetry: telemetry,
+		perIP:     make(map[string]int),
+	}
+	if config.MaxConnections > 0 {
+		limiter.slots = make(chan struct{}, config.MaxConnections)
+	}
+	return limiter
+}
+
+// Listener returns a listener accepting the connections of a listener within the limits
+func (l *ConnectionLimiter) Listener(listener net.Listener) net.Listener {
+	return &limitedListener{Listener: listener, limiter: l, done: make(chan struct{})}
+}
+
+// acquireIP counts a connection of a client IP and reports whether it is within the per-IP limit
+func (l *ConnectionLimiter) acquireIP(ip string) bool {
+	if l.config.MaxConnectionsPerIP <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.perIP[ip] >= l.config.MaxConnectionsPerIP {
+		return false
+	}
+	l.perIP[ip]++
+	return true
+}
+
+// releaseIP uncounts a closed connection of a client IP
+func (l *ConnectionLimiter) releaseIP(ip string) {
+	if l.config.MaxConnectionsPerIP <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.perIP[ip]--; l.perIP[ip] <= 0 {
+		delete(l.perIP, ip)
+	}
+}
+
+// limitedListener is a listener whose connections are limited by a ConnectionLimiter
+type limitedListener struct {
+	net.Listener
+	limiter   *ConnectionLimiter
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Accept waits for a free connection slot, then accepts the next connection whose client IP is within its
+// limit. Connections over the per-IP limit are closed right away.
+func (l *limitedListener) Accept() (net.Conn, error) {
+	for {
+		if l.limiter.slots != nil {
+			select {
+			case l.limiter.slots <- struct{}{}:
+			case <-l.done:
+				return nil, net.ErrClosed
+			}
+		}
+
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			l.releaseSlot()
+			return nil, err
+		}
+
+		ip := remoteIP(conn)
+		if !l.limiter.acquireIP(ip) {
+			_ = conn.Close()
+			l.releaseSlot()
+			if l.limiter.telemetry != nil {
+				l.limiter.telemetry.RecordRejectedConnection(context.Background(), "per_ip")
+			}
+			continue
+		}
+		return &limitedConn{Conn: conn, release: func() {
+			l.limiter.releaseIP(ip)
+			l.releaseSlot()
+		}}, nil
+	}
+}
+
+// releaseSlot frees the connection slot taken by a closed or rejected connection
+func (l *limitedListener) releaseSlot() {
+	if l.limiter.slots != nil {
+		<-l.limiter.slots
+	}
+}
+
+// Close closes the listener, unblocking an Accept waiting for a connection slot
+func (l *limitedListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// limitedConn is a connection releasing its limits once closed
+type limitedConn struct {
+	net.Conn
+	releaseOnce sync.Once
+	release     func()
+}
+
+// Close closes the connection and releases its limits
+func (c *limitedConn) Close() error {
+	err := c.Conn.Close()
+	c.releaseOnce.Do(c.release)
+	return err
+}
+
+// remoteIP returns the IP address of the client of a connection
+func remoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
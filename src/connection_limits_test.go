@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// TestConnectionLimits tests that the listeners limit the connections in total and per client IP
+func TestConnectionLimits(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := NewConnectionLimiter(ConnectionLimitsConfig{MaxConnections: 2, MaxConnectionsPerIP: 1}, nil)
+	listener := limiter.Listener(inner)
+	defer listener.Close()
+
+	accepted := make(chan net.Conn, 4)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				close(accepted)
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	// A second connection of the same client IP is closed right away
+	first, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	served := <-accepted
+	second, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	_ = second.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := second.Read(make([]byte, 1)); err == nil || isTimeout(err) {
+		t.Errorf("expected the second connection to be closed, got %v", err)
+	}
+	select {
+	case conn := <-accepted:
+		t.Fatalf("expected no other connection to be accepted, got %v", conn.RemoteAddr())
+	default:
+	}
+
+	// Closing the first connection frees the IP
+	_ = served.Close()
+	third, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer third.Close()
+	select {
+	case <-accepted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the connection to be accepted once the first one is closed")
+	}
+
+	// Closing the listener unblocks Accept
+	_ = listener.Close()
+	if _, ok := <-accepted; ok {
+		t.Error("expected Accept to fail once the listener is closed")
+	}
+}
+
+// TestConnectionLimitsTotal tests that connections over the total limit wait until a connection is closed
+func TestConnectionLimitsTotal(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := NewConnectionLimiter(ConnectionLimitsConfig{MaxConnections: 1}, nil).Listener(inner)
+	defer listener.Close()
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+	}
+	served := <-accepted
+	select {
+	case <-accepted:
+		t.Fatal("expected the second connection to wait")
+	case <-time.After(100 * time.Millisecond):
+	}
+	_ = served.Close()
+	select {
+	case <-accepted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the second connection to be accepted once the first one is closed")
+	}
+}
+
+// isTimeout reports whether an error is a network timeout
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Dashboard settings
+const (
+	// dashboardBuckets is the number of one second buckets the dashboard rates are computed over
+	dashboardBuckets = 60
+	// dashboardRecentErrors is the number of recent errors kept for the dashboard
+	dashboardRecentErrors = 50
+)
+
+// dashboardContentSecurityPolicy allows the inline script and style of the dashboard page
+const dashboardContentSecurityPolicy = "default-src 'none'; script-src 'unsafe-inline'; style-src 'unsafe-inline'; connect-src 'self'; frame-ancestors 'none'"
+
+// dashboardPage is the single page dashboard served on the admin listeners
+//
+//go:embed dashboard.html
+var dashboardPage []byte
+
+// dashboardBucket counts the requests of an endpoint during one second
+type dashboardBucket struct {
+	second   int64
+	requests int64
+	errors   int64
+	latency  time.Duration
+}
+
+// DashboardError is a recent request answered with a server error
+type DashboardError struct {
+	Time     string `json:"time"`
+	Endpoint string `json:"endpoint"`
+	Method   string `json:"method"`
+	Path     string `json:"path"`
+	Status   int    `json:"status"`
+	TraceID  string `json:"trace_id,omitempty"`
+}
+
+// DashboardStats tracks the request rate, latency and error rate of the endpoints and their recent errors
+type DashboardStats struct {
+	mu      sync.Mutex
+	windows map[string]*[dashboardBuckets]dashboardBucket
+	errors  []DashboardError
+	next    int
+	now     func() time.Time
+}
+
+// NewDashboardStats creates a new DashboardStats
+func NewDashboardStats() *DashboardStats {
+	return &DashboardStats{
+		windows: make(map[string]*[dashboardBuckets]dashboardBucket),
+		now:     time.Now,
+	}
+}
+
+// Middleware records the outcome and latency of the requests of an endpoint
+func (d *DashboardStats) Middleware(endpoint Endpoint, next http.Handler) http.Handler {
+	if d == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startTime := time.Now()
+		lrw := NewLoggingResponseWriter(w)
+		lrw.bodyLimit = 0
+		next.ServeHTTP(lrw, r)
+		d.Record(endpoint.Host+endpoint.Path, r, lrw.statusCode, time.Since(startTime))
+	})
+}
+
+// Record records a request of an endpoint, identified by its host and path, keeping it as a recent error if it failed with a server error
+func (d *DashboardStats) Record(route string, r *http.Request, status int, latency time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	window, ok := d.windows[route]
+	if !ok {
+		window = &[dashboardBuckets]dashboardBucket{}
+		d.windows[route] = window
+	}
+	second := now.Unix()
+	bucket := &window[second%dashboardBuckets]
+	if bucket.second != second {
+		*bucket = dashboardBucket{second: second}
+	}
+	bucket.requests++
+	bucket.latency += latency
+	if status < 500 {
+		return
+	}
+	bucket.errors++
+
+	recent := DashboardError{
+		Time:     now.UTC().Format(time.RFC3339),
+		Endpoint: route,
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		Status:   status,
+	}
+	recent.TraceID, _ = traceIDs(r.Context())
+	if len(d.errors) < dashboardRecentErrors {
+		d.errors = append(d.errors, recent)
+	} else {
+		d.errors[d.next] = recent
+	}
+	d.next = (d.next + 1) % dashboardRecentErrors
+}
+
+// DashboardEndpoint reports an endpoint of the route table with its rates over the last minute
+type DashboardEndpoint struct {
+	Path      string          `json:"path"`
+	Method    string          `json:"method,omitempty"`
+	Host      string          `json:"host,omitempty"`
+	Listeners []string        `json:"listeners,omitempty"`
+	Backends  []BackendStatus `json:"backends"`
+	Requests  int64           `json:"requests"`
+	RPS       float64         `json:"rps"`
+	// LatencyMs is the average latency in milliseconds and ErrorRate the share of server errors
+	LatencyMs float64 `json:"latency_ms"`
+	ErrorRate float64 `json:"error_rate"`
+}
+
+// DashboardData is the state shown by the dashboard
+type DashboardData struct {
+	Time         string              `json:"time"`
+	InFlight     int64               `json:"in_flight"`
+	Draining     bool                `json:"draining"`
+	Endpoints    []DashboardEndpoint `json:"endpoints"`
+	RecentErrors []DashboardError    `json:"recent_errors"`
+}
+
+// endpoint fills in the request rates of an endpoint over the last minute
+func (d *DashboardStats) endpoint(entry *DashboardEndpoint, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	window, ok := d.windows[entry.Host+entry.Path]
+	if !ok {
+		return
+	}
+	var failed int64
+	var latency time.Duration
+	oldest := now.Unix() - dashboardBuckets
+	for _, bucket := range window {
+		if bucket.second > oldest {
+			entry.Requests += bucket.requests
+			failed += bucket.errors
+			latency += bucket.latency
+		}
+	}
+	entry.RPS = float64(entry.Requests) / dashboardBuckets
+	if entry.Requests > 0 {
+		entry.LatencyMs = float64(latency.Microseconds()) / 1000 / float64(entry.Requests)
+		entry.ErrorRate = float64(failed) / float64(entry.Requests)
+	}
+}
+
+// recentErrors returns the recent errors, the latest first
+func (d *DashboardStats) recentErrors() []DashboardError {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	recent := make([]DashboardError, 0, len(d.errors))
+	for i := 1; i <= len(d.errors); i++ {
+		recent = append(recent, d.errors[(d.next-i+len(d.errors))%len(d.errors)])
+	}
+	return recent
+}
+
+// dashboardData collects the route table, the endpoint rates, the backend health and the recent errors
+func (g *Gateway) dashboardData() DashboardData {
+	now := g.dashboard.now()
+	data := DashboardData{
+		Time:         now.UTC().Format(time.RFC3339),
+		InFlight:     g.inFlight.Load(),
+		Draining:     g.draining.Load(),
+		Endpoints:    make([]DashboardEndpoint, 0, len(g.routes)),
+		RecentErrors: g.dashboard.recentErrors(),
+	}
+	for _, route := range g.routes {
+		endpoint := route.proxy.Current().endpoint
+		entry := DashboardEndpoint{
+			Path:      endpoint.Path,
+			Method:    endpoint.Method,
+			Host:      endpoint.Host,
+			Listeners: endpoint.Listeners,
+			Backends:  route.proxy.BackendStatuses(),
+		}
+		g.dashboard.endpoint(&entry, now)
+		data.Endpoints = append(data.Endpoints, entry)
+	}
+	sort.Slice(data.Endpoints, func(i, j int) bool {
+		if data.Endpoints[i].Host != data.Endpoints[j].Host {
+			return data.Endpoints[i].Host < data.Endpoints[j].Host
+		}
+		return data.Endpoints[i].Path < data.Endpoints[j].Path
+	})
+	return data
+}
+
+// handleDashboard serves the dashboard page. The page holds no data, it asks for the admin token and
+// polls the data endpoint with it.
+func (g *Gateway) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// The page only runs its inline script and loads its data from the admin API
+	w.Header().Set("Content-Security-Policy", dashboardContentSecurityPolicy)
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(dashboardPage)
+}
+
+// handleDashboardData serves the state shown by the dashboard
+func (g *Gateway) handleDashboardData(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, g.dashboardData())
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDashboard tests that the dashboard reports the endpoint rates, backend health and recent errors
+func TestDashboard(t *testing.T) {
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/fail") {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer backendServer.Close()
+
+	gateway := NewGateway(Config{
+		Endpoints: []Endpoint{
+			{Path: "/api/", Backend: backendServer.URL},
+			{Path: "/pool/", Backends: []string{backendServer.URL}, OutlierDetection: OutlierDetectionConfig{Enabled: true}},
+		},
+		Admin: AdminConfig{Enabled: true, Token: "secret", Dashboard: true},
+	}, nil)
+	now := time.Unix(1000, 0)
+	gateway.dashboard.now = func() time.Time { return now }
+	gateway.RegisterEndpoints()
+	gateway.RegisterAdminEndpoints()
+
+	for _, path := range []string{"/api/a", "/api/b", "/api/c", "/api/fail"} {
+		gateway.mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	// The page is served without the token, the data requires it
+	rr := httptest.NewRecorder()
+	gateway.mux.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/dashboard", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "dashboard/data") {
+		t.Fatalf("expected the dashboard page, got %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	gateway.mux.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/dashboard/data", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 without a token, got %d", rr.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/admin/dashboard/data", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr = httptest.NewRecorder()
+	gateway.mux.ServeHTTP(rr, req)
+	var data DashboardData
+	if err := json.Unmarshal(rr.Body.Bytes(), &data); err != nil {
+		t.Fatalf("invalid dashboard data %q: %v", rr.Body.String(), err)
+	}
+	if len(data.Endpoints) != 2 {
+		t.Fatalf("expected 2 endpoints, got %+v", data.Endpoints)
+	}
+
+	api := data.Endpoints[0]
+	if api.Path != "/api/" || api.Requests != 4 || api.ErrorRate != 0.25 || api.RPS != 4.0/dashboardBuckets {
+		t.Errorf("unexpected endpoint stats %+v", api)
+	}
+	if len(api.Backends) != 1 || api.Backends[0].URL != backendServer.URL || api.Backends[0].Monitored {
+		t.Errorf("expected an unmonitored backend, got %+v", api.Backends)
+	}
+	pool := data.Endpoints[1]
+	if pool.Requests != 0 || len(pool.Backends) != 1 || !pool.Backends[0].Monitored || pool.Backends[0].Ejected {
+		t.Errorf("expected a healthy monitored backend without requests, got %+v", pool)
+	}
+	if len(data.RecentErrors) != 1 || data.RecentErrors[0].Path != "/api/fail" || data.RecentErrors[0].Status != http.StatusBadGateway {
+		t.Errorf("expected the failed request as recent error, got %+v", data.RecentErrors)
+	}
+
+	// The requests leave the window after a minute
+	now = now.Add(dashboardBuckets * time.Second)
+	entry := DashboardEndpoint{Path: "/api/"}
+	gateway.dashboard.endpoint(&entry, now)
+	if entry.Requests != 0 {
+		t.Errorf("expected no requests in the window, got %d", entry.Requests)
+	}
+}
+
+// TestDashboardRecentErrors tests that only the latest errors are kept, the latest first
+func TestDashboardRecentErrors(t *testing.T) {
+	stats := NewDashboardStats()
+	for i := 0; i < dashboardRecentErrors+10; i++ {
+		stats.Record("/api/", httptest.NewRequest("GET", "/api/"+string(rune('a'+i%26)), nil), 500+i, time.Millisecond)
+	}
+	recent := stats.recentErrors()
+	if len(recent) != dashboardRecentErrors {
+		t.Fatalf("expected %d recent errors, got %d", dashboardRecentErrors, len(recent))
+	}
+	if recent[0].Status != 500+dashboardRecentErrors+9 || recent[len(recent)-1].Status != 510 {
+		t.Errorf("expected the latest errors first, got %d to %d", recent[0].Status, recent[len(recent)-1].Status)
+	}
+}
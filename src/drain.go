@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// defaultDrainGracePeriod is the time between failing readiness and closing the listeners
+const defaultDrainGracePeriod = 10 * time.Second
+
+// DrainStatus reports the progress of a connection drain
+type DrainStatus struct {
+	Draining  bool       `json:"draining"`
+	Drained   bool       `json:"drained"`
+	InFlight  int64      `json:"in_flight"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+}
+
+// trackInFlight counts the requests being served by the given handler
+func (g *Gateway) trackInFlight(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.inFlight.Add(1)
+		defer g.inFlight.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Ready reports whether the gateway accepts new traffic
+func (g *Gateway) Ready() bool {
+	return !g.draining.Load()
+}
+
+// Drain fails readiness immediately, closes the listeners not serving the admin API after the
+// grace period and waits for their in-flight requests to complete until the shutdown timeout.
+// It returns false if a drain is already in progress.
+func (g *Gateway) Drain(gracePeriod time.Duration) bool {
+	if !g.draining.CompareAndSwap(false, true) {
+		return false
+	}
+
+	startedAt := time.Now()
+	g.mu.Lock()
+	g.drainStartedAt = startedAt
+	g.mu.Unlock()
+
+	LogInfo("Draining gateway", map[string]interface{}{
+		"grace_period": gracePeriod.String(),
+		"in_flight":    g.inFlight.Load(),
+	})
+
+	go func() {
+		// Give load balancers time to notice the failing readiness
+		time.Sleep(gracePeriod)
+
+		// Stop accepting new connections and wait for the in-flight requests, keeping the admin listeners open
+		// so the drain progress can still be queried
+		g.mu.Lock()
+		var servers []*http.Server
+		for i, server := range g.servers {
+			if !containsString(g.config.Admin.Listeners, g.serverNames[i]) {
+				servers = append(servers, server)
+			}
+		}
+		passthroughs := append([]*PassthroughServer(nil), g.passthroughs...)
+		g.mu.Unlock()
+
+		LogInfo("Closing listeners for drain", map[string]interface{}{
+			"listeners": len(servers) + len(passthroughs),
+			"in_flight": g.inFlight.Load(),
+		})
+		timeout := time.Duration(g.config.ShutdownTimeout) * time.Millisecond
+		if timeout <= 0 {
+			timeout = defaultShutdownTimeout
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		for _, server := range servers {
+			if err := server.Shutdown(ctx); err != nil {
+				LogError("Error draining listener", err, nil)
+			}
+		}
+		for _, passthrough := range passthroughs {
+			if err := passthrough.Shutdown(ctx); err != nil {
+				LogError("Error draining listener", err, nil)
+			}
+		}
+
+		LogInfo("Drain complete", map[string]interface{}{
+			"duration": time.Since(startedAt).String(),
+		})
+		close(g.drainDone)
+	}()
+
+	return true
+}
+
+// DrainStatus returns the progress of the connection drain
+func (g *Gateway) DrainStatus() DrainStatus {
+	status := DrainStatus{
+		Draining: g.draining.Load(),
+		InFlight: g.inFlight.Load(),
+	}
+
+	select {
+	case <-g.drainDone:
+		status.Drained = true
+	default:
+	}
+
+	g.mu.Lock()
+	if !g.drainStartedAt.IsZero() {
+		startedAt := g.drainStartedAt
+		status.StartedAt = &startedAt
+	}
+	g.mu.Unlock()
+
+	return status
+}
+
+// handleDrain starts a drain on POST and reports the drain progress. Drains require dedicated admin
+// listeners, as a drain closing the listener of the admin API could no longer be followed.
+func (g *Gateway) handleDrain(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, g.DrainStatus())
+	case http.MethodPost:
+		if len(g.config.Admin.Listeners) == 0 {
+			http.Error(w, "Drain requires admin.listeners to serve the admin API on dedicated listeners", http.StatusConflict)
+			return
+		}
+		gracePeriod := defaultDrainGracePeriod
+		if g.config.Admin.DrainGracePeriod > 0 {
+			gracePeriod = time.Duration(g.config.Admin.DrainGracePeriod) * time.Millisecond
+		}
+		if g.Drain(gracePeriod) {
+			LogAudit("Drain requested", map[string]interface{}{
+				"remote_addr": r.RemoteAddr,
+			})
+		}
+		writeJSON(w, http.StatusAccepted, g.DrainStatus())
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestGatewayDrain tests that a drain fails readiness, closes the public listener and waits for in-flight requests
+func TestGatewayDrain(t *testing.T) {
+	release := make(chan struct{})
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		_, _ = w.Write([]byte("OK"))
+	}))
+	defer backendServer.Close()
+
+	gateway := NewGateway(Config{
+		Endpoints: []Endpoint{{Path: "/slow", Backend: backendServer.URL}},
+		Listeners: []ListenerConfig{
+			{Name: "public", Address: "127.0.0.1:0"},
+			{Name: "admin", Address: "127.0.0.1:0"},
+		},
+		Admin: AdminConfig{
+			Enabled:          true,
+			Token:            "secret",
+			Listeners:        []string{"admin"},
+			DrainGracePeriod: 50,
+		},
+	}, nil)
+	gateway.RegisterEndpoints()
+	gateway.RegisterReadinessCheck()
+	gateway.RegisterAdminEndpoints()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- gateway.Start()
+	}()
+
+	// Wait for the gateway to start listening
+	var publicAddr, adminAddr string
+	waitFor(t, func() bool {
+		gateway.mu.Lock()
+		defer gateway.mu.Unlock()
+		if len(gateway.listeners) < 2 {
+			return false
+		}
+		publicAddr, adminAddr = gateway.listeners[0].Addr().String(), gateway.listeners[1].Addr().String()
+		return true
+	})
+
+	// Start a request that is in flight during the drain
+	slowCh := make(chan int, 1)
+	go func() {
+		resp, err := http.Get("http://" + publicAddr + "/slow")
+		if err != nil {
+			slowCh <- 0
+			return
+		}
+		_ = resp.Body.Close()
+		slowCh <- resp.StatusCode
+	}()
+	waitFor(t, func() bool { return gateway.inFlight.Load() == 1 })
+
+	drain := func(method, token string) (int, DrainStatus) {
+		req, _ := http.NewRequest(method, "http://"+adminAddr+"/admin/drain", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Admin request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var status DrainStatus
+		_ = json.NewDecoder(resp.Body).Decode(&status)
+		return resp.StatusCode, status
+	}
+
+	if code, _ := drain("POST", "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a wrong admin token, got %v", code)
+	}
+	if code, status := drain("POST", "secret"); code != http.StatusAccepted || !status.Draining {
+		t.Errorf("Expected drain to start, got %v %+v", code, status)
+	}
+
+	// Readiness fails immediately
+	rr := httptest.NewRecorder()
+	gateway.mux.ServeHTTP(rr, httptest.NewRequest("GET", "/ready", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected readiness to fail while draining, got %v", rr.Code)
+	}
+
+	// New connections are refused after the grace period
+	waitFor(t, func() bool {
+		conn, err := net.Dial("tcp", publicAddr)
+		if err != nil {
+			return true
+		}
+		_ = conn.Close()
+		return false
+	})
+
+	if _, status := drain("GET", "secret"); status.Drained || status.InFlight != 1 {
+		t.Errorf("Expected one in-flight request, got %+v", status)
+	}
+
+	// The in-flight request completes and the drain finishes
+	close(release)
+	if code := <-slowCh; code != http.StatusOK {
+		t.Errorf("Expected in-flight request to complete with 200, got %v", code)
+	}
+	waitFor(t, func() bool {
+		_, status := drain("GET", "secret")
+		return status.Drained && status.InFlight == 0
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_ = gateway.Shutdown(ctx)
+	if err := <-errCh; err != http.ErrServerClosed {
+		t.Errorf("Start() error = %v, want %v", err, http.ErrServerClosed)
+	}
+}
+
+// TestDrainWithoutAdminListeners tests that a drain is refused when the admin API shares the listeners it would close
+func TestDrainWithoutAdminListeners(t *testing.T) {
+	gateway := NewGateway(Config{Admin: AdminConfig{Enabled: true, Token: "secret"}}, nil)
+	gateway.RegisterAdminEndpoints()
+
+	req := httptest.NewRequest("POST", "/admin/drain", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr := httptest.NewRecorder()
+	gateway.mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected 409 without dedicated admin listeners, got %v", rr.Code)
+	}
+	if !gateway.Ready() {
+		t.Error("Expected the gateway to stay ready")
+	}
+}
+
+// waitFor polls the condition until it is true or fails the test after a timeout
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// RouteTestRequest is a request to evaluate through the admin API without proxying it
+type RouteTestRequest struct {
+	Method string `json:"method"`
+	// Path is the request path, with an optional query
+	Path    string            `json:"path"`
+	Host    string            `json:"host"`
+	Headers map[string]string `json:"headers"`
+	// Listener is the name of the listener receiving the request (default the listener serving all endpoints)
+	Listener string `json:"listener"`
+}
+
+// RouteTestResult describes how the gateway would handle a request
+type RouteTestResult struct {
+	Matched bool `json:"matched"`
+	// Pattern is the mux pattern the request matched, which may belong to a gateway route such as /health
+	Pattern       string            `json:"pattern,omitempty"`
+	Endpoint      *RouteTestTarget  `json:"endpoint,omitempty"`
+	PathParams    map[string]string `json:"path_params,omitempty"`
+	MethodAllowed bool              `json:"method_allowed"`
+	// Middlewares are the middlewares the request passes through, the outermost first
+	Middlewares          []string `json:"middlewares,omitempty"`
+	PreBackendCallbacks  int      `json:"pre_backend_callbacks"`
+	PostBackendCallbacks int      `json:"post_backend_callbacks"`
+	// BackendURLs are the resolved upstream URLs, one per backend instance
+	BackendURLs []string `json:"backend_urls,omitempty"`
+}
+
+// RouteTestTarget identifies the endpoint a request matched
+type RouteTestTarget struct {
+	Path     string   `json:"path"`
+	Method   string   `json:"method,omitempty"`
+	Host     string   `json:"host,omitempty"`
+	Backend  string   `json:"backend,omitempty"`
+	Backends []string `json:"backends,omitempty"`
+}
+
+// handleRouteTest evaluates which endpoint, middlewares and backend URL a request would use, without proxying it
+func (g *Gateway) handleRouteTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request RouteTestRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid route test request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !strings.HasPrefix(request.Path, "/") {
+		http.Error(w, "Invalid route test request: a path starting with / is required", http.StatusBadRequest)
+		return
+	}
+	if request.Method == "" {
+		request.Method = http.MethodGet
+	}
+
+	mux := g.mux
+	if request.Listener != "" {
+		listenerMux, ok := g.listenerMuxes[request.Listener]
+		if !ok {
+			http.Error(w, "Invalid route test request: unknown listener "+request.Listener, http.StatusBadRequest)
+			return
+		}
+		mux = listenerMux
+	}
+
+	// Build the request as the listener would receive it
+	testRequest, err := http.NewRequestWithContext(r.Context(), request.Method, request.Path, nil)
+	if err != nil {
+		http.Error(w, "Invalid route test request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	testRequest.Host = request.Host
+	for name, value := range request.Headers {
+		testRequest.Header.Set(name, value)
+	}
+
+	writeJSON(w, http.StatusOK, g.evaluateRoute(mux, testRequest))
+}
+
+// evaluateRoute resolves the endpoint of a request on a mux and describes how it would be handled
+func (g *Gateway) evaluateRoute(mux *http.ServeMux, r *http.Request) RouteTestResult {
+	_, pattern := mux.Handler(r)
+	result := RouteTestResult{Pattern: pattern}
+	route, ok := g.routes[pattern]
+	if !ok || route.proxy == nil {
+		return result
+	}
+
+	// The route reports the upstream settings of the scheduled changes in effect
+	proxy := route.proxy.Current()
+	endpoint := proxy.endpoint
+	params, matched := route.template.Match(r.URL.Path)
+	if !matched {
+		// The constraints of the path parameters reject the request
+		return result
+	}
+	result.Matched = true
+	result.Endpoint = &RouteTestTarget{
+		Path:     endpoint.Path,
+		Method:   endpoint.Method,
+		Host:     endpoint.Host,
+		Backend:  endpoint.Backend,
+		Backends: endpoint.Backends,
+	}
+	result.PathParams = params
+	result.MethodAllowed = endpoint.Method == "" || endpoint.Method == r.Method
+	result.Middlewares = g.endpointMiddlewares(route.proxy.endpoint, route.template)
+	result.PreBackendCallbacks = len(proxy.preBackendCallbacks)
+	result.PostBackendCallbacks = len(proxy.postBackendCallbacks)
+
+	// Resolve the upstream URL as the proxy director does, without running the callbacks
+	for _, backend := range endpointBackends(endpoint) {
+		backendURL, err := url.Parse(backend)
+		if err != nil {
+			continue
+		}
+		upstream := r.Clone(r.Context())
+		httputil.NewSingleHostReverseProxy(backendURL).Director(upstream)
+		proxy.rewriteBackendURL(upstream.URL, backendURL, r)
+		result.BackendURLs = append(result.BackendURLs, upstream.URL.String())
+	}
+	return result
+}
+
+// endpointMiddlewares names the middlewares newEndpointHandler wraps the endpoint proxy with, the outermost first
+func (g *Gateway) endpointMiddlewares(endpoint Endpoint, template *PathTemplate) []string {
+	middlewares := []string{"trace_context"}
+	if len(endpoint.Labels) > 0 {
+		middlewares = append(middlewares, "labels")
+	}
+	if template.constrained {
+		middlewares = append(middlewares, "path_constraints")
+	}
+	if len(g.securityHeaders(endpoint.SecurityHeaders)) > 0 {
+		middlewares = append(middlewares, "security_headers")
+	}
+	gatewayHeaders := g.config.GatewayHeaders
+	if endpoint.GatewayHeaders != nil {
+		gatewayHeaders = *endpoint.GatewayHeaders
+	}
+	if gatewayHeaders.enabled() {
+		middlewares = append(middlewares, "gateway_headers")
+	}
+	if g.dashboard != nil {
+		middlewares = append(middlewares, "dashboard")
+	}
+	if endpoint.SLO.Target > 0 {
+		middlewares = append(middlewares, "slo")
+	}
+	middlewares = append(middlewares, "capture", "chaos")
+	if endpoint.SignedURLs {
+		middlewares = append(middlewares, "signed_urls")
+	}
+	if len(endpoint.Experiment.Variants) > 0 {
+		middlewares = append(middlewares, "experiment")
+	}
+	if g.authLockout != nil {
+		middlewares = append(middlewares, "auth_lockout")
+	}
+	if len(g.callerHeaders(endpoint)) > 0 {
+		middlewares = append(middlewares, "caller_identity")
+	}
+	for _, middleware := range g.middlewares {
+		middlewares = append(middlewares, middlewareName(middleware))
+	}
+	if endpoint.RateLimit.enabled() {
+		middlewares = append(middlewares, "rate_limit")
+	}
+	if g.shedder.config.MaxInFlight > 0 {
+		middlewares = append(middlewares, "load_shedding")
+	}
+	if g.quotas != nil {
+		middlewares = append(middlewares, "quotas")
+	}
+	if endpoint.GraphQL.Enabled {
+		middlewares = append(middlewares, "graphql")
+	}
+	if endpoint.Cache.Enabled {
+		middlewares = append(middlewares, "cache")
+	}
+	if endpoint.GenerateETag {
+		middlewares = append(middlewares, "etag")
+	}
+	if endpoint.BlueGreen.enabled() {
+		middlewares = append(middlewares, "blue_green")
+	}
+	return middlewares
+}
+
+// middlewareName returns the name of a middleware function, e.g. WAF.Middleware for a method value
+func middlewareName(middleware Middleware) string {
+	name := runtime.FuncForPC(reflect.ValueOf(middleware).Pointer()).Name()
+	name = strings.TrimSuffix(name, "-fm")
+	// Drop the package path and name
+	name = name[strings.LastIndex(name, "/")+1:]
+	name = name[strings.Index(name, ".")+1:]
+	return strings.NewReplacer("(*", "", ")", "").Replace(name)
+}
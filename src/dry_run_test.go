@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestRouteTest tests that the route test resolves the endpoint, middlewares and backend URL without proxying
+func TestRouteTest(t *testing.T) {
+	proxied := false
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = true
+	}))
+	defer backendServer.Close()
+
+	gateway := NewGateway(Config{
+		Endpoints: []Endpoint{
+			{
+				Path:        "/api/users/:id([0-9]+)",
+				Method:      "GET",
+				Backend:     backendServer.URL + "/v2/users/:id",
+				PathMode:    PathModeTemplate,
+				QueryParams: map[string]string{"source": "gateway"},
+				Cache:       EndpointCacheConfig{Enabled: true},
+			},
+		},
+		Admin: AdminConfig{Enabled: true},
+	}, nil)
+	waf, err := NewWAF(WAFConfig{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gateway.Use(waf.Middleware)
+	gateway.RegisterPreBackendCallbacks(func(r *http.Request) *http.Request { return r })
+	gateway.RegisterEndpoints()
+	gateway.RegisterAdminEndpoints()
+
+	routeTest := func(body string) (int, RouteTestResult) {
+		rr := httptest.NewRecorder()
+		gateway.mux.ServeHTTP(rr, httptest.NewRequest("POST", "/admin/route-test", strings.NewReader(body)))
+		var result RouteTestResult
+		if rr.Code == http.StatusOK {
+			if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rr.Code, result
+	}
+
+	status, result := routeTest(`{"method": "POST", "path": "/api/users/42?expand=true"}`)
+	if status != http.StatusOK || !result.Matched {
+		t.Fatalf("expected the endpoint to match, got %d %+v", status, result)
+	}
+	if result.Endpoint.Path != "/api/users/:id([0-9]+)" || result.PathParams["id"] != "42" || result.MethodAllowed {
+		t.Errorf("unexpected match %+v", result)
+	}
+	expectedURL := backendServer.URL + "/v2/users/42?expand=true&source=gateway"
+	if len(result.BackendURLs) != 1 || result.BackendURLs[0] != expectedURL {
+		t.Errorf("expected backend URL %s, got %v", expectedURL, result.BackendURLs)
+	}
+	expectedMiddlewares := []string{"trace_context", "path_constraints", "capture", "chaos", "WAF.Middleware", "cache"}
+	if !slices.Equal(result.Middlewares, expectedMiddlewares) {
+		t.Errorf("expected middlewares %v, got %v", expectedMiddlewares, result.Middlewares)
+	}
+	if result.PreBackendCallbacks != 1 || result.PostBackendCallbacks != 0 {
+		t.Errorf("expected 1 pre-backend callback, got %d and %d", result.PreBackendCallbacks, result.PostBackendCallbacks)
+	}
+	if proxied {
+		t.Error("expected the request not to be proxied")
+	}
+
+	// Requests rejected by the path constraints or not served by an endpoint do not match
+	for _, body := range []string{`{"path": "/api/users/abc"}`, `{"path": "/health"}`, `{"path": "/unknown"}`} {
+		if status, result := routeTest(body); status != http.StatusOK || result.Matched {
+			t.Errorf("%s: expected no match, got %d %+v", body, status, result)
+		}
+	}
+
+	// Invalid requests are rejected
+	for _, body := range []string{`{"path": "api"}`, `{"path": "/", "method": "GE T"}`, `{"path": "/", "listener": "internal"}`, `{`} {
+		if status, _ := routeTest(body); status != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", body, status)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// endpointLabelsKey is the context key for the labels of the endpoint serving a request
+type endpointLabelsKey struct{}
+
+// EndpointLabelsFromContext returns the labels of the endpoint serving a request
+func EndpointLabelsFromContext(ctx context.Context) map[string]string {
+	labels, _ := ctx.Value(endpointLabelsKey{}).(map[string]string)
+	return labels
+}
+
+// EndpointLabelsMiddleware attaches the labels of an endpoint to its requests, so they are added to the
+// request metrics as attributes and to the request and response log entries
+func EndpointLabelsMiddleware(endpoint Endpoint, next http.Handler) http.Handler {
+	if len(endpoint.Labels) == 0 {
+		return next
+	}
+
+	// Sort the attributes once so the metric series are stable
+	names := make([]string, 0, len(endpoint.Labels))
+	for name := range endpoint.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	attrs := make([]attribute.KeyValue, len(names))
+	for i, name := range names {
+		attrs[i] = attribute.String(name, endpoint.Labels[name])
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), endpointLabelsKey{}, endpoint.Labels)
+		next.ServeHTTP(w, r.WithContext(WithMetricAttributes(ctx, attrs...)))
+	})
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// TestEndpointLabels tests that the endpoint labels are added to the metric attributes and the log entries
+func TestEndpointLabels(t *testing.T) {
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backendServer.Close()
+
+	var attrs []attribute.KeyValue
+	gateway := NewGateway(Config{
+		Endpoints: []Endpoint{
+			{Path: "/api/", Backend: backendServer.URL, Labels: map[string]string{"team": "payments", "tier": "1"}},
+			{Path: "/other/", Backend: backendServer.URL},
+		},
+	}, nil)
+	gateway.Use(func(endpoint Endpoint, next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attrs = MetricAttributesFromContext(r.Context())
+			next.ServeHTTP(w, r)
+		})
+	})
+	gateway.RegisterEndpoints()
+
+	var buf bytes.Buffer
+	SetLogOutput(&buf)
+	defer SetLogOutput(os.Stdout)
+
+	gateway.mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/users", nil))
+	if len(attrs) != 2 || attrs[0] != attribute.String("team", "payments") || attrs[1] != attribute.String("tier", "1") {
+		t.Errorf("expected the labels as metric attributes, got %v", attrs)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if (strings.Contains(line, `"type":"request"`) || strings.Contains(line, `"type":"response"`)) &&
+			!strings.Contains(line, `"labels":{"team":"payments","tier":"1"}`) {
+			t.Errorf("expected the labels in the log entry, got %s", line)
+		}
+	}
+
+	buf.Reset()
+	gateway.mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/other/x", nil))
+	if len(attrs) != 0 || strings.Contains(buf.String(), `"labels"`) {
+		t.Errorf("expected no labels for an endpoint without labels, got %v %s", attrs, buf.String())
+	}
+}
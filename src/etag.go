@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxETagBodyBytes is the maximum size of a response body buffered to generate an ETag
+const maxETagBodyBytes = 1024 * 1024
+
+// ETagMiddleware generates strong ETags for the successful GET responses of an endpoint with
+// generate_etag enabled whose backend sends no validator nor trailers, and answers matching If-None-Match
+// requests with 304
+func ETagMiddleware(endpoint Endpoint, next http.Handler) http.Handler {
+	if !endpoint.GenerateETag {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ew := &etagWriter{ResponseWriter: w}
+		next.ServeHTTP(ew, r)
+		if !ew.buffering {
+			return
+		}
+
+		// Answer with 304 if the client already has the response
+		etag := computeETag(ew.body.Bytes())
+		w.Header().Set("ETag", etag)
+		if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, etag) {
+			w.Header().Del("Content-Length")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("Content-Length", strconv.Itoa(ew.body.Len()))
+		w.WriteHeader(ew.status)
+		if _, err := w.Write(ew.body.Bytes()); err != nil {
+			LogError("Failed to write response", err, map[string]interface{}{
+				"path": r.URL.Path,
+			})
+		}
+	})
+}
+
+// computeETag returns a strong entity tag for a response body
+func computeETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagWriter is a wrapper around http.ResponseWriter that buffers the responses an ETag can be
+// generated for. Other responses, and responses growing beyond the limit, are passed through.
+type etagWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	buffering   bool
+	body        bytes.Buffer
+}
+
+// WriteHeader starts buffering the response if an ETag can be generated for it
+func (w *etagWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = code
+
+	header := w.ResponseWriter.Header()
+	contentLength, err := strconv.Atoi(header.Get("Content-Length"))
+	w.buffering = code == http.StatusOK && header.Get("ETag") == "" &&
+		!strings.HasPrefix(header.Get("Content-Type"), "text/event-stream") && header.Get("Trailer") == "" &&
+		(err != nil || contentLength <= maxETagBodyBytes)
+	if !w.buffering {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+// Write buffers the response body, or passes it through once it exceeds the limit
+func (w *etagWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.buffering {
+		return w.ResponseWriter.Write(b)
+	}
+	if w.body.Len()+len(b) <= maxETagBodyBytes {
+		return w.body.Write(b)
+	}
+
+	// Pass the buffered body through without an ETag
+	w.buffering = false
+	w.ResponseWriter.WriteHeader(w.status)
+	if _, err := w.ResponseWriter.Write(w.body.Bytes()); err != nil {
+		return 0, err
+	}
+	w.body.Reset()
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush flushes the response unless it is buffered
+func (w *etagWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.buffering {
+		_ = http.NewResponseController(w.ResponseWriter).Flush()
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter so http.ResponseController can reach it
+func (w *etagWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
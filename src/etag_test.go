@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestETagMiddleware tests generating ETags and answering If-None-Match with 304
+func TestETagMiddleware(t *testing.T) {
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/versioned":
+			w.Header().Set("ETag", `"backend"`)
+		case "/api/large":
+			_, _ = w.Write([]byte(strings.Repeat("x", maxETagBodyBytes+1)))
+			return
+		case "/api/missing":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("users"))
+	}))
+	defer backendServer.Close()
+
+	gateway := NewGateway(Config{
+		Endpoints: []Endpoint{
+			{Path: "/api/", Backend: backendServer.URL, GenerateETag: true},
+		},
+	}, nil)
+	gateway.RegisterEndpoints()
+
+	serve := func(path, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rr := httptest.NewRecorder()
+		gateway.mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve("/api/users", "")
+	etag := rr.Header().Get("ETag")
+	if rr.Code != http.StatusOK || rr.Body.String() != "users" || etag != computeETag([]byte("users")) {
+		t.Fatalf("Expected 200 with a generated ETag, got %v %q %q", rr.Code, rr.Body.String(), etag)
+	}
+	if rr := serve("/api/users", etag); rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+		t.Errorf("Expected 304 for a matching If-None-Match, got %v %q", rr.Code, rr.Body.String())
+	}
+	if rr := serve("/api/users", `"other"`); rr.Code != http.StatusOK {
+		t.Errorf("Expected 200 for another ETag, got %v", rr.Code)
+	}
+
+	// Backend validators, errors and large responses are passed through
+	if rr := serve("/api/versioned", ""); rr.Header().Get("ETag") != `"backend"` {
+		t.Errorf("Expected the backend ETag, got %q", rr.Header().Get("ETag"))
+	}
+	if rr := serve("/api/missing", ""); rr.Code != http.StatusNotFound || rr.Header().Get("ETag") != "" {
+		t.Errorf("Expected 404 without an ETag, got %v %q", rr.Code, rr.Header().Get("ETag"))
+	}
+	if rr := serve("/api/large", ""); rr.Body.Len() != maxETagBodyBytes+1 || rr.Header().Get("ETag") != "" {
+		t.Errorf("Expected the large response without an ETag, got %d bytes %q", rr.Body.Len(), rr.Header().Get("ETag"))
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// defaultExperimentHeader is the default header carrying the assigned variant upstream
+const defaultExperimentHeader = "X-Experiment"
+
+// ExperimentVariant represents a variant of an experiment and its share of the clients
+type ExperimentVariant struct {
+	Name string `json:"name"`
+	// Weight is the share of the clients assigned to the variant, relative to the weights of the other variants
+	Weight int `json:"weight"`
+}
+
+// ExperimentConfig represents an A/B experiment assigning the clients of an endpoint to variants
+type ExperimentConfig struct {
+	// Name identifies the experiment, clients are assigned independently in each experiment
+	Name string `json:"name"`
+	// Variants are the variants of the experiment, the experiment is disabled if empty
+	Variants []ExperimentVariant `json:"variants"`
+	// BucketBy identifies the client: ip (default), cookie:<name> or header:<name>. Clients without the
+	// cookie or header are identified by their IP address.
+	BucketBy string `json:"bucket_by"`
+	// TrustForwardedFor identifies clients by the first X-Forwarded-For address
+	TrustForwardedFor bool `json:"trust_forwarded_for"`
+	// Header is the request header the variant is sent upstream in (default X-Experiment)
+	Header string `json:"header"`
+}
+
+// Experiment deterministically assigns the clients of an endpoint to the variants of an experiment
+type Experiment struct {
+	config      ExperimentConfig
+	totalWeight int
+	telemetry   *TelemetryManager
+}
+
+// NewExperiment creates a new Experiment and validates its variants
+func NewExperiment(config ExperimentConfig, telemetry *TelemetryManager) (*Experiment, error) {
+	if config.Name == "" {
+		return nil, fmt.Errorf("experiment without a name")
+	}
+	e := &Experiment{config: config, telemetry: telemetry}
+	for _, variant := range config.Variants {
+		if variant.Name == "" || variant.Weight < 0 {
+			return nil, fmt.Errorf("experiment %s: variants need a name and a non-negative weight", config.Name)
+		}
+		e.totalWeight += variant.Weight
+	}
+	if e.totalWeight == 0 {
+		return nil, fmt.Errorf("experiment %s: the variant weights must not all be 0", config.Name)
+	}
+	if source, name, _ := strings.Cut(config.BucketBy, ":"); config.BucketBy != "" && config.BucketBy != "ip" &&
+		((source != "cookie" && source != "header") || name == "") {
+		return nil, fmt.Errorf("experiment %s: invalid bucket_by %s (must be ip, cookie:<name> or header:<name>)", config.Name, config.BucketBy)
+	}
+	if e.config.Header == "" {
+		e.config.Header = defaultExperimentHeader
+	}
+	return e, nil
+}
+
+// clientKey returns the value identifying the client of a request
+func (e *Experiment) clientKey(r *http.Request) string {
+	source, name, _ := strings.Cut(e.config.BucketBy, ":")
+	switch source {
+	case "cookie":
+		if cookie, err := r.Cookie(name); err == nil && cookie.Value != "" {
+			return cookie.Value
+		}
+	case "header":
+		if value := r.Header.Get(name); value != "" {
+			return value
+		}
+	}
+	if ip := ClientIP(r, e.config.TrustForwardedFor); ip != nil {
+		return ip.String()
+	}
+	return r.RemoteAddr
+}
+
+// Assign returns the variant of a client, the same for every request of the client
+func (e *Experiment) Assign(r *http.Request) string {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(e.config.Name))
+	_, _ = hash.Write([]byte{0})
+	_, _ = hash.Write([]byte(e.clientKey(r)))
+	bucket := int(hash.Sum32() % uint32(e.totalWeight))
+	for _, variant := range e.config.Variants {
+		if bucket < variant.Weight {
+			return variant.Name
+		}
+		bucket -= variant.Weight
+	}
+	return e.config.Variants[len(e.config.Variants)-1].Name
+}
+
+// Middleware sends the variant of the client upstream, replacing any client supplied value, and adds it to
+// the request metrics
+func (e *Experiment) Middleware(endpoint Endpoint, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		variant := e.Assign(r)
+		r.Header.Set(e.config.Header, variant)
+		if e.telemetry != nil {
+			e.telemetry.RecordExperimentAssignment(r.Context(), metricsRoute(endpoint), e.config.Name, variant)
+		}
+		ctx := WithMetricAttributes(r.Context(),
+			attribute.String("experiment.name", e.config.Name),
+			attribute.String("experiment.variant", variant),
+		)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ExperimentMiddleware assigns the clients of an endpoint with an experiment to its variants
+func ExperimentMiddleware(endpoint Endpoint, telemetry *TelemetryManager, next http.Handler) http.Handler {
+	if len(endpoint.Experiment.Variants) == 0 {
+		return next
+	}
+	experiment, err := NewExperiment(endpoint.Experiment, telemetry)
+	if err != nil {
+		LogError("Invalid experiment, no variant assigned", err, map[string]interface{}{
+			"path": endpoint.Path,
+		})
+		return next
+	}
+	return experiment.Middleware(endpoint, next)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestExperimentAssignment tests that clients are assigned deterministically and in proportion to the weights
+func TestExperimentAssignment(t *testing.T) {
+	experiment, err := NewExperiment(ExperimentConfig{
+		Name:     "checkout",
+		Variants: []ExperimentVariant{{Name: "control", Weight: 80}, {Name: "v2", Weight: 20}},
+		BucketBy: "cookie:session",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 2000; i++ {
+		req := httptest.NewRequest("GET", "/checkout", nil)
+		req.AddCookie(&http.Cookie{Name: "session", Value: fmt.Sprintf("session-%d", i)})
+		variant := experiment.Assign(req)
+		if again := experiment.Assign(req); again != variant {
+			t.Fatalf("expected the same variant for the same client, got %s and %s", variant, again)
+		}
+		counts[variant]++
+	}
+	if counts["v2"] < 300 || counts["v2"] > 500 || counts["control"]+counts["v2"] != 2000 {
+		t.Errorf("expected about 20%% of the clients in v2, got %v", counts)
+	}
+
+	for _, config := range []ExperimentConfig{
+		{Variants: []ExperimentVariant{{Name: "a", Weight: 1}}},
+		{Name: "x", Variants: []ExperimentVariant{{Name: "a", Weight: 0}}},
+		{Name: "x", Variants: []ExperimentVariant{{Name: "a", Weight: 1}}, BucketBy: "query:id"},
+	} {
+		if _, err := NewExperiment(config, nil); err == nil {
+			t.Errorf("expected %+v to be rejected", config)
+		}
+	}
+}
+
+// TestExperimentMiddleware tests that the variant replaces the client supplied header upstream
+func TestExperimentMiddleware(t *testing.T) {
+	var received []string
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Values("X-Variant")
+	}))
+	defer backendServer.Close()
+
+	gateway := NewGateway(Config{Endpoints: []Endpoint{{
+		Path:    "/api/",
+		Backend: backendServer.URL,
+		Experiment: ExperimentConfig{
+			Name:     "search",
+			Variants: []ExperimentVariant{{Name: "only", Weight: 1}, {Name: "never", Weight: 0}},
+			BucketBy: "header:X-User-Id",
+			Header:   "X-Variant",
+		},
+	}}}, nil)
+	gateway.RegisterEndpoints()
+
+	req := httptest.NewRequest("GET", "/api/search", nil)
+	req.Header.Set("X-User-Id", "42")
+	req.Header.Set("X-Variant", "forged")
+	gateway.mux.ServeHTTP(httptest.NewRecorder(), req)
+	if len(received) != 1 || received[0] != "only" {
+		t.Errorf("expected the assigned variant upstream, got %v", received)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Default external authorization settings
+const (
+	defaultExtAuthzTimeout     = 1000
+	maxExtAuthzDeniedBodyBytes = 64 * 1024
+)
+
+// defaultExtAuthzAllowedHeaders are the request headers sent to the authorization service if none are configured
+var defaultExtAuthzAllowedHeaders = []string{"Authorization", "Cookie"}
+
+// ExtAuthzConfig represents the authorization of requests by an external HTTP service, in the style of
+// the Envoy ext_authz HTTP service
+type ExtAuthzConfig struct {
+	Enabled bool `json:"enabled"`
+	// URL is the URL of the authorization service, the request path is appended to it
+	URL string `json:"url"`
+	// AllowedHeaders are the request headers sent to the authorization service (default Authorization and Cookie)
+	AllowedHeaders []string `json:"allowed_headers"`
+	// UpstreamHeaders are the headers of an allowing response added to the upstream request, e.g. X-User-ID
+	UpstreamHeaders []string `json:"upstream_headers"`
+	// ClientHeaders are the headers of a denying response returned to the client in addition to
+	// Content-Type, WWW-Authenticate and Location
+	ClientHeaders []string `json:"client_headers"`
+	// Timeout is the timeout in milliseconds of an authorization request (default 1000)
+	Timeout int `json:"timeout"`
+	// FailOpen allows requests when the authorization service cannot be reached
+	FailOpen bool `json:"fail_open"`
+	// StatusOnError is the status returned when the authorization service cannot be reached (default 403)
+	StatusOnError int `json:"status_on_error"`
+}
+
+// ExtAuthz authorizes requests by calling an external authorization service
+type ExtAuthz struct {
+	config ExtAuthzConfig
+	client *http.Client
+}
+
+// NewExtAuthz creates a new ExtAuthz
+func NewExtAuthz(config ExtAuthzConfig) (*ExtAuthz, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("external authorization URL is required")
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultExtAuthzTimeout
+	}
+	if config.StatusOnError == 0 {
+		config.StatusOnError = http.StatusForbidden
+	}
+	if len(config.AllowedHeaders) == 0 {
+		config.AllowedHeaders = defaultExtAuthzAllowedHeaders
+	}
+	config.URL = strings.TrimSuffix(config.URL, "/")
+
+	return &ExtAuthz{
+		config: config,
+		client: &http.Client{
+			Timeout: time.Duration(config.Timeout) * time.Millisecond,
+			// Redirects of the authorization service are returned to the client, e.g. to a login page
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}, nil
+}
+
+// check sends the authorization request for a request, using the same method and path
+func (a *ExtAuthz) check(r *http.Request) (*http.Response, error) {
+	checkURL := a.config.URL + r.URL.Path
+	if r.URL.RawQuery != "" {
+		checkURL += "?" + r.URL.RawQuery
+	}
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, checkURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range a.config.AllowedHeaders {
+		for _, value := range r.Header.Values(name) {
+			req.Header.Add(name, value)
+		}
+	}
+	req.Header.Set("X-Forwarded-Host", r.Host)
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+	req.Header.Set("X-Forwarded-Proto", proto)
+
+	return a.client.Do(req)
+}
+
+// Middleware proxies the requests allowed by the authorization service and returns its response for denied ones
+func (a *ExtAuthz) Middleware(endpoint Endpoint, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Clients must not be able to send the headers set by the authorization service
+		for _, name := range a.config.UpstreamHeaders {
+			r.Header.Del(name)
+		}
+
+		resp, err := a.check(r)
+		if err != nil {
+			LogError("External authorization failed", err, map[string]interface{}{
+				"path":      r.URL.Path,
+				"fail_open": a.config.FailOpen,
+			})
+			if a.config.FailOpen {
+				next.ServeHTTP(w, r)
+				return
+			}
+			http.Error(w, http.StatusText(a.config.StatusOnError), a.config.StatusOnError)
+			return
+		}
+		defer resp.Body.Close()
+
+		// A 2xx response allows the request, adding the configured headers to the upstream request. The caller
+		// is identified when the authorization service sets any of them.
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			identified := false
+			for _, name := range a.config.UpstreamHeaders {
+				for _, value := range resp.Header.Values(name) {
+					r.Header.Add(name, value)
+					identified = true
+				}
+			}
+			if identified {
+				r = withAuthenticatedCaller(r)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		LogAudit("Request denied by external authorization", map[string]interface{}{
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"route":       endpoint.Path,
+			"status_code": resp.StatusCode,
+			"remote_addr": r.RemoteAddr,
+			"user_agent":  r.UserAgent(),
+		})
+
+		// Return the denying response to the client
+		for _, name := range append([]string{"Content-Type", "WWW-Authenticate", "Location"}, a.config.ClientHeaders...) {
+			for _, value := range resp.Header.Values(name) {
+				w.Header().Add(name, value)
+			}
+		}
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, io.LimitReader(resp.Body, maxExtAuthzDeniedBodyBytes))
+	})
+}
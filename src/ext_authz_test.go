@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestExtAuthz tests that the decision of the external authorization service is honored
+func TestExtAuthz(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/users" || r.URL.RawQuery != "page=2" || r.Method != http.MethodPost {
+			t.Errorf("Unexpected authorization request %s %s", r.Method, r.URL)
+		}
+		if r.Header.Get("X-Other") != "" {
+			t.Error("Headers that are not allowed must not be sent to the authorization service")
+		}
+		if r.Header.Get("Authorization") != "Bearer valid" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.Header().Set("X-Internal", "secret")
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte("invalid token"))
+			return
+		}
+		w.Header().Set("X-User-ID", "42")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	extAuthz, err := NewExtAuthz(ExtAuthzConfig{URL: authServer.URL, UpstreamHeaders: []string{"X-User-ID"}})
+	if err != nil {
+		t.Fatalf("Failed to create external authorization: %v", err)
+	}
+	var userID string
+	var authenticated bool
+	handler := extAuthz.Middleware(Endpoint{Path: "/api/users"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID = r.Header.Get("X-User-ID")
+		authenticated = authenticatedCaller(r)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Allowed request, the client supplied identity header is replaced
+	req := httptest.NewRequest("POST", "/api/users?page=2", nil)
+	req.Header.Set("Authorization", "Bearer valid")
+	req.Header.Set("X-User-ID", "1")
+	req.Header.Set("X-Other", "value")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || userID != "42" || !authenticated {
+		t.Errorf("Expected status 200 with authenticated user 42, got %d with user %q", rr.Code, userID)
+	}
+
+	// Denied request, the response of the authorization service is returned
+	req = httptest.NewRequest("POST", "/api/users?page=2", nil)
+	req.Header.Set("Authorization", "Bearer invalid")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized || rr.Body.String() != "invalid token" {
+		t.Errorf("Expected status 401 with the service body, got %d %q", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("WWW-Authenticate") != "Bearer" || rr.Header().Get("X-Internal") != "" {
+		t.Errorf("Unexpected denied response headers: %v", rr.Header())
+	}
+}
+
+// TestExtAuthzUnavailable tests the handling of an unreachable authorization service
+func TestExtAuthzUnavailable(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	extAuthz, _ := NewExtAuthz(ExtAuthzConfig{URL: "http://127.0.0.1:1", StatusOnError: http.StatusServiceUnavailable})
+	rr := httptest.NewRecorder()
+	extAuthz.Middleware(Endpoint{}, next).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", rr.Code)
+	}
+
+	extAuthz, _ = NewExtAuthz(ExtAuthzConfig{URL: "http://127.0.0.1:1", FailOpen: true})
+	rr = httptest.NewRecorder()
+	extAuthz.Middleware(Endpoint{}, next).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200 with fail_open, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// defaultFieldsParam is the query parameter listing the response fields if none is configured
+const defaultFieldsParam = "fields"
+
+// FieldFilteringConfig represents the partial responses of an endpoint: clients list the fields they need
+// in a query parameter, e.g. fields=id,owner.name, and the JSON responses are filtered to these fields
+type FieldFilteringConfig struct {
+	Enabled bool `json:"enabled"`
+	// Param is the query parameter listing the fields (default fields), it is not sent to the backend
+	Param string `json:"param"`
+}
+
+// param returns the query parameter listing the fields
+func (c FieldFilteringConfig) param() string {
+	if c.Param == "" {
+		return defaultFieldsParam
+	}
+	return c.Param
+}
+
+// requested returns the fields requested by the client, nil if the response is not filtered
+func (c FieldFilteringConfig) requested(r *http.Request) fieldTree {
+	if !c.Enabled {
+		return nil
+	}
+	return parseFields(r.URL.Query().Get(c.param()))
+}
+
+// fieldTree is a set of requested fields, each with the requested fields of its value; a field without
+// subfields is requested whole
+type fieldTree map[string]fieldTree
+
+// parseFields parses a comma separated list of dotted field paths, e.g. id,owner.name
+func parseFields(fields string) fieldTree {
+	var tree fieldTree
+	for _, path := range strings.Split(fields, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		if tree == nil {
+			tree = fieldTree{}
+		}
+		node := tree
+		names := strings.Split(path, ".")
+		for i, name := range names {
+			child, ok := node[name]
+			if ok && child == nil {
+				// The field is already requested whole
+				break
+			}
+			if i == len(names)-1 {
+				node[name] = nil
+				break
+			}
+			if !ok {
+				child = fieldTree{}
+				node[name] = child
+			}
+			node = child
+		}
+	}
+	return tree
+}
+
+// filter returns the value with only the requested fields of its objects, arrays are filtered element by element
+func (t fieldTree) filter(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		filtered := make(map[string]interface{}, len(t))
+		for name, subfields := range t {
+			if fieldValue, ok := v[name]; ok {
+				if subfields == nil {
+					filtered[name] = fieldValue
+				} else {
+					filtered[name] = subfields.filter(fieldValue)
+				}
+			}
+		}
+		return filtered
+	case []interface{}:
+		filtered := make([]interface{}, len(v))
+		for i, element := range v {
+			filtered[i] = t.filter(element)
+		}
+		return filtered
+	default:
+		return value
+	}
+}
+
+// filterResponseFields filters a successful JSON response to the fields requested by the client
+func filterResponseFields(resp *http.Response, fields fieldTree) error {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil
+	}
+	document, ok, err := readJSONResponse(resp)
+	if untransformable(err) {
+		return nil
+	}
+	if err != nil || !ok {
+		return err
+	}
+	return replaceJSONResponse(resp, fields.filter(document))
+}
+
+// isJSONMediaType reports whether a media type is JSON
+func isJSONMediaType(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// readJSONResponse decodes the body of a JSON response, decompressing it if needed. The body is left
+// unchanged and ok is false if the response is not JSON or is invalid; the errors of ReadResponseBody are
+// returned if it cannot be decoded.
+func readJSONResponse(resp *http.Response) (interface{}, bool, error) {
+	if !isJSONMediaType(mediaTypeOf(resp.Header.Get("Content-Type"))) {
+		return nil, false, nil
+	}
+	data, err := ReadResponseBody(resp)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Keep the numbers as they are written so large integers are not rounded
+	var document interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		return nil, false, nil
+	}
+	return document, true, nil
+}
+
+// replaceJSONResponse replaces the body of a response with a JSON document, without escaping the HTML
+// characters the backend did not escape
+func replaceJSONResponse(resp *http.Response, document interface{}) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(document); err != nil {
+		return err
+	}
+	return SetResponseBody(resp, bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestFieldFiltering tests that JSON responses are filtered to the fields requested by the client
+func TestFieldFiltering(t *testing.T) {
+	var receivedQuery, receivedEncoding string
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedQuery = r.URL.RawQuery
+		receivedEncoding = r.Header.Get("Accept-Encoding")
+		if r.URL.Path == "/text" {
+			_, _ = w.Write([]byte("id,name"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(`[{"id":9007199254740993,"name":"a","owner":{"name":"o","email":"o@example.com"},"tags":["x"]}]`))
+	}))
+	defer backendServer.Close()
+
+	handler := NewProxy(Endpoint{Path: "/", Backend: backendServer.URL, FieldFiltering: FieldFilteringConfig{Enabled: true}}, false, nil).Handler()
+
+	tests := []struct {
+		target   string
+		expected string
+	}{
+		{"/repos?fields=id,owner.name,missing&page=2", `[{"id":9007199254740993,"owner":{"name":"o"}}]`},
+		{"/repos?fields=owner.name,owner", `[{"owner":{"email":"o@example.com","name":"o"}}]`},
+		{"/repos", `[{"id":9007199254740993,"name":"a","owner":{"name":"o","email":"o@example.com"},"tags":["x"]}]`},
+		{"/text?fields=id", "id,name"},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", tt.target, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		handler(rr, req)
+		if rr.Body.String() != tt.expected {
+			t.Errorf("for %s expected %s, got %s", tt.target, tt.expected, rr.Body.String())
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/repos?fields=id&page=2", nil)
+	req.Header.Set("Accept-Encoding", "br")
+	handler(rr, req)
+	if receivedQuery != "page=2" || receivedEncoding == "br" {
+		t.Errorf("expected the fields parameter and client encodings not to be sent, got %q and %q", receivedQuery, receivedEncoding)
+	}
+	if rr.Header().Get("ETag") != "" {
+		t.Errorf("expected the backend ETag of the whole response to be removed, got %q", rr.Header().Get("ETag"))
+	}
+}
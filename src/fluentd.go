@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"time"
+)
+
+// fluentForwarder sends batches of log entries to a Fluentd or Fluent Bit forward input in forward mode
+type fluentForwarder struct {
+	address string
+	tag     string
+	timeout time.Duration
+	conn    net.Conn
+}
+
+// newFluentForwarder creates a fluentForwarder for the given forward input address and tag
+func newFluentForwarder(address, tag string, timeout time.Duration) *fluentForwarder {
+	return &fluentForwarder{
+		address: address,
+		tag:     tag,
+		timeout: timeout,
+	}
+}
+
+// send writes the batch as a forward mode message, reconnecting and retrying once on failure
+func (f *fluentForwarder) send(batch []shippedLog) error {
+	message, err := f.encode(batch)
+	if err != nil {
+		return err
+	}
+	if err := f.write(message); err == nil {
+		return nil
+	}
+	_ = f.close()
+	return f.write(message)
+}
+
+// encode encodes the batch as a [tag, [[time, record], ...]] forward mode message
+func (f *fluentForwarder) encode(batch []shippedLog) ([]byte, error) {
+	message := appendMsgpackArrayHeader(nil, 2)
+	message = appendMsgpackString(message, f.tag)
+	message = appendMsgpackArrayHeader(message, len(batch))
+	for _, entry := range batch {
+		// Decode the log line, keeping numbers as they were encoded
+		decoder := json.NewDecoder(bytes.NewReader(entry.line))
+		decoder.UseNumber()
+		var record map[string]interface{}
+		if err := decoder.Decode(&record); err != nil {
+			return nil, fmt.Errorf("failed to decode log entry: %w", err)
+		}
+
+		message = appendMsgpackArrayHeader(message, 2)
+		message = appendFluentEventTime(message, entry.at)
+		message = appendMsgpack(message, record)
+	}
+	return message, nil
+}
+
+// write writes a message to the forward input, dialing it if needed
+func (f *fluentForwarder) write(message []byte) error {
+	if f.conn == nil {
+		conn, err := net.DialTimeout("tcp", f.address, f.timeout)
+		if err != nil {
+			return err
+		}
+		f.conn = conn
+	}
+	if err := f.conn.SetWriteDeadline(time.Now().Add(f.timeout)); err != nil {
+		return err
+	}
+	_, err := f.conn.Write(message)
+	return err
+}
+
+// close closes the connection to the forward input
+func (f *fluentForwarder) close() error {
+	if f.conn == nil {
+		return nil
+	}
+	err := f.conn.Close()
+	f.conn = nil
+	return err
+}
+
+// appendFluentEventTime appends a Fluentd EventTime, msgpack extension type 0 holding seconds and nanoseconds
+func appendFluentEventTime(dst []byte, t time.Time) []byte {
+	dst = append(dst, 0xd7, 0x00)
+	dst = binary.BigEndian.AppendUint32(dst, uint32(t.Unix()))
+	return binary.BigEndian.AppendUint32(dst, uint32(t.Nanosecond()))
+}
+
+// appendMsgpack appends a value decoded from JSON in msgpack format
+func appendMsgpack(dst []byte, value interface{}) []byte {
+	switch v := value.(type) {
+	case nil:
+		return append(dst, 0xc0)
+	case bool:
+		if v {
+			return append(dst, 0xc3)
+		}
+		return append(dst, 0xc2)
+	case string:
+		return appendMsgpackString(dst, v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return appendMsgpackInt(dst, i)
+		}
+		f, _ := v.Float64()
+		return appendMsgpackFloat(dst, f)
+	case float64:
+		return appendMsgpackFloat(dst, v)
+	case []interface{}:
+		dst = appendMsgpackArrayHeader(dst, len(v))
+		for _, item := range v {
+			dst = appendMsgpack(dst, item)
+		}
+		return dst
+	case map[string]interface{}:
+		dst = appendMsgpackMapHeader(dst, len(v))
+		for key, item := range v {
+			dst = appendMsgpackString(dst, key)
+			dst = appendMsgpack(dst, item)
+		}
+		return dst
+	default:
+		return appendMsgpackString(dst, fmt.Sprint(v))
+	}
+}
+
+// appendMsgpackInt appends an integer as a fixint or int64
+func appendMsgpackInt(dst []byte, i int64) []byte {
+	if i >= -32 && i <= 127 {
+		return append(dst, byte(i))
+	}
+	dst = append(dst, 0xd3)
+	return binary.BigEndian.AppendUint64(dst, uint64(i))
+}
+
+// appendMsgpackFloat appends a float64
+func appendMsgpackFloat(dst []byte, f float64) []byte {
+	dst = append(dst, 0xcb)
+	return binary.BigEndian.AppendUint64(dst, math.Float64bits(f))
+}
+
+// appendMsgpackString appends a string with the smallest fitting header
+func appendMsgpackString(dst []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		dst = append(dst, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		dst = append(dst, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		dst = binary.BigEndian.AppendUint16(append(dst, 0xda), uint16(n))
+	default:
+		dst = binary.BigEndian.AppendUint32(append(dst, 0xdb), uint32(n))
+	}
+	return append(dst, s...)
+}
+
+// appendMsgpackArrayHeader appends the header of an array of n items
+func appendMsgpackArrayHeader(dst []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(dst, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(dst, 0xdc), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(dst, 0xdd), uint32(n))
+	}
+}
+
+// appendMsgpackMapHeader appends the header of a map of n entries
+func appendMsgpackMapHeader(dst []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(dst, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(dst, 0xde), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(dst, 0xdf), uint32(n))
+	}
+}
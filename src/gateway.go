@@ -1,28 +1,168 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// Middleware wraps an endpoint handler with additional processing.
+// The endpoint configuration is passed so middlewares can apply per-endpoint behavior.
+type Middleware func(endpoint Endpoint, next http.Handler) http.Handler
+
 // Gateway is the main API gateway class
 type Gateway struct {
-	config    Config
-	mux       *http.ServeMux
-	proxies   map[string]*Proxy // Map of path to proxy for callback registration
-	telemetry *TelemetryManager
+	config      Config
+	mux         *http.ServeMux
+	proxies     map[string]*Proxy // Map of path to proxy for callback registration
+	telemetry   *TelemetryManager
+	middlewares []Middleware
+	// routes maps the mux patterns of the endpoints to their routes for the route cache
+	routes map[string]endpointRoute
+	// listenerMuxes maps a listener name to the mux serving the endpoints bound to it
+	listenerMuxes map[string]*http.ServeMux
+	// retryBudget is the retry budget shared by endpoints without their own
+	retryBudget *RetryBudget
+	// dynamicMux serves the endpoints managed at runtime
+	dynamicMux atomic.Pointer[http.ServeMux]
+	// catchAll serves the requests not matched by a static route
+	catchAll catchAll
+	// capture records the request/response pairs selected through the admin API
+	capture *RequestCapture
+	// cache stores the responses of the endpoints with caching enabled
+	cache *ResponseCache
+	// signer validates the signed URLs of the endpoints with signed_urls
+	signer *URLSigner
+	// notifier sends operational events to the notification webhooks
+	notifier *Notifier
+	// certificates monitors the expiry of listener and upstream certificates
+	certificates *CertificateMonitor
+	// slo tracks the error budget burn rate of the endpoints with an SLO
+	slo *SLOTracker
+	// dashboard tracks the endpoint rates and recent errors shown by the admin dashboard, nil if disabled
+	dashboard *DashboardStats
+	// chaos injects the faults configured through the admin API
+	chaos *ChaosInjector
+	// shedder sheds low priority requests when the gateway is overloaded
+	shedder *LoadShedder
+	// quotas enforces the daily quotas of the tenants, nil if no tenant is identified
+	quotas *TenantQuotas
+	// connLimiter limits the client connections of the listeners, nil if no limit is configured
+	connLimiter *ConnectionLimiter
+	// authLockout bans the clients failing authentication repeatedly, nil if lockouts are disabled
+	authLockout *AuthLockout
+	// inFlight counts the endpoint requests being served
+	inFlight atomic.Int64
+	// draining is set once a drain has been requested
+	draining  atomic.Bool
+	drainDone chan struct{}
+
+	mu                  sync.Mutex
+	servers             []*http.Server
+	serverNames         []string
+	drainStartedAt      time.Time
+	listeners           []net.Listener
+	certificateStores   []*CertificateStore
+	passthroughs        []*PassthroughServer
+	globalPreCallbacks  []RequestCallback
+	globalPostCallbacks []ResponseCallback
+	// dynamicProxies are the proxies of the endpoints managed at runtime, closed once they are replaced
+	dynamicProxies []*Proxy
+	// methodNotAllowedHandler answers the requests with a method an endpoint does not allow, if set
+	methodNotAllowedHandler http.Handler
+	// registerErrs are the routes that could not be registered, reported by Initialize
+	registerErrs []error
 }
 
 // NewGateway creates a new Gateway with the given configuration and telemetry manager
 func NewGateway(config Config, telemetry *TelemetryManager) *Gateway {
-	return &Gateway{
-		config:    config,
-		mux:       http.NewServeMux(),
-		proxies:   make(map[string]*Proxy),
-		telemetry: telemetry,
+	listenerMuxes := make(map[string]*http.ServeMux)
+	for _, listener := range config.Listeners {
+		listenerMuxes[listener.ListenerName()] = http.NewServeMux()
+	}
+
+	notifier := NewNotifier(config.Notifications)
+	gateway := &Gateway{
+		config:        config,
+		mux:           http.NewServeMux(),
+		proxies:       make(map[string]*Proxy),
+		routes:        make(map[string]endpointRoute),
+		telemetry:     telemetry,
+		listenerMuxes: listenerMuxes,
+		retryBudget:   NewRetryBudget(config.Retry),
+		capture:       &RequestCapture{},
+		chaos:         NewChaosInjector(),
+		cache:         NewResponseCache(config.Cache, telemetry),
+		signer:        NewURLSigner(config.SignedURLs),
+		notifier:      notifier,
+		slo:           NewSLOTracker(config.Endpoints, telemetry, notifier),
+		certificates:  NewCertificateMonitor(config.Certificates, telemetry, notifier),
+		drainDone:     make(chan struct{}),
+	}
+	gateway.shedder = NewLoadShedder(config.LoadShedding, gateway.inFlight.Load, telemetry)
+	if config.Quotas.enabled() {
+		gateway.quotas = NewTenantQuotas(config.Quotas)
+	}
+	if config.ConnectionLimits.enabled() {
+		gateway.connLimiter = NewConnectionLimiter(config.ConnectionLimits, telemetry)
+	}
+	if config.AuthLockout.enabled() {
+		gateway.authLockout = NewAuthLockout(config.AuthLockout, telemetry)
+	}
+	if config.Admin.Enabled && config.Admin.Dashboard {
+		gateway.dashboard = NewDashboardStats()
+	}
+	return gateway
+}
+
+// handle registers a handler on the main mux and on the muxes of the given listeners.
+// If no listeners are given, the handler is registered on all listeners.
+// A route that cannot be registered is logged and reported by Initialize.
+func (g *Gateway) handle(pattern string, handler http.Handler, listeners []string) {
+	if err := registerPattern(g.mux, pattern, handler); err != nil {
+		g.registerFailed(pattern, err)
+		return
+	}
+
+	for _, name := range listeners {
+		if _, ok := g.listenerMuxes[name]; !ok {
+			g.registerFailed(pattern, fmt.Errorf("unknown listener %q", name))
+		}
+	}
+
+	for name, mux := range g.listenerMuxes {
+		if len(listeners) == 0 || containsString(listeners, name) {
+			if err := registerPattern(mux, pattern, handler); err != nil {
+				g.registerFailed(pattern, err)
+			}
+		}
+	}
+}
+
+// registerFailed logs a route that cannot be registered and keeps the error for Initialize
+func (g *Gateway) registerFailed(pattern string, err error) {
+	LogError("Failed to register route", err, map[string]interface{}{
+		"path": pattern,
+	})
+	g.registerErrs = append(g.registerErrs, fmt.Errorf("failed to register route %s: %w", pattern, err))
+}
+
+// containsString checks whether a slice contains the given string
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
 	}
+	return false
 }
 
 // RegisterEndpoints registers all endpoints from the configuration
@@ -33,12 +173,221 @@ func (g *Gateway) RegisterEndpoints() {
 			"path":    endpoint.Path,
 			"backend": endpoint.Backend,
 		})
-		proxy := NewProxy(endpoint, g.config.Debug, g.telemetry)
+		proxy, handler := g.newEndpointHandler(endpoint)
 		g.proxies[endpoint.Path] = proxy
-		g.mux.HandleFunc(endpoint.Path, proxy.Handler())
+		pattern := endpoint.Host + muxPattern(endpoint.Path)
+		if template, err := compiledPathTemplate(endpoint.Path); err == nil {
+			g.routes[pattern] = endpointRoute{template: template, handler: handler, proxy: proxy}
+		}
+		g.handle(pattern, handler, endpoint.Listeners)
 	}
 }
 
+// newEndpointHandler creates the proxy for an endpoint and wraps its handler with the
+// registered middlewares, the first one being the outermost, and the security headers
+// (endpointMiddlewares describes this chain for the route test and must follow its changes)
+func (g *Gateway) newEndpointHandler(endpoint Endpoint) (*Proxy, http.Handler) {
+	// Endpoints without their own retry budget share the global one
+	ownBudget := endpoint.Retry.BudgetRatio > 0 || endpoint.Retry.BudgetMinRetries > 0
+	endpoint.Retry = g.config.Retry.Merge(endpoint.Retry)
+
+	proxy := NewProxy(endpoint, g.config.Debug || endpoint.Debug, g.telemetry)
+	if ownBudget {
+		proxy.SetRetryBudget(NewRetryBudget(endpoint.Retry))
+	} else {
+		proxy.SetRetryBudget(g.retryBudget)
+	}
+	proxy.SetNotifier(g.notifier)
+	proxy.SetCertificateMonitor(g.certificates)
+	proxy.SetResponseCache(g.cache)
+	methodNotAllowed := g.config.MethodNotAllowedResponse
+	if endpoint.MethodNotAllowed != nil {
+		methodNotAllowed = *endpoint.MethodNotAllowed
+	}
+	proxy.SetMethodNotAllowedResponse(methodNotAllowed)
+	proxy.SetMethodNotAllowedHandler(g.methodNotAllowedHandler)
+
+	// Apply the callbacks registered for all endpoints
+	g.mu.Lock()
+	for _, callback := range g.globalPreCallbacks {
+		proxy.AddPreBackendCallback(callback)
+	}
+	for _, callback := range g.globalPostCallbacks {
+		proxy.AddPostBackendCallback(callback)
+	}
+	g.mu.Unlock()
+
+	handler := g.cache.Middleware(endpoint, ETagMiddleware(endpoint, proxy.blueGreen.Middleware(endpoint, proxy.Handler())))
+	if endpoint.GraphQL.Enabled {
+		handler = NewGraphQLGuard(endpoint.GraphQL).Middleware(endpoint, handler)
+	}
+	// Enforce the quotas and shed after the middlewares so the authentication has identified the caller
+	handler = g.quotas.Middleware(endpoint, handler)
+	handler = g.shedder.Middleware(endpoint, handler)
+	if endpoint.RateLimit.enabled() {
+		handler = NewRateLimiter(endpoint.RateLimit, g.shedder.priority, g.telemetry).Middleware(endpoint, handler)
+	}
+	for i := len(g.middlewares) - 1; i >= 0; i-- {
+		handler = g.middlewares[i](endpoint, handler)
+	}
+	// Remove the caller headers sent by clients, only the authentication middlewares may set them
+	handler = CallerIdentityMiddleware(g.callerHeaders(endpoint), handler)
+	// Reject the banned clients before the authentication middlewares see their credentials
+	handler = g.authLockout.Middleware(endpoint, handler)
+	handler = ExperimentMiddleware(endpoint, g.telemetry, handler)
+	handler = g.signer.Middleware(endpoint, handler)
+	handler = g.chaos.Middleware(endpoint, handler)
+	handler = g.capture.Middleware(endpoint, handler)
+	handler = g.slo.Middleware(endpoint, handler)
+	handler = g.dashboard.Middleware(endpoint, handler)
+
+	gatewayHeaders := g.config.GatewayHeaders
+	if endpoint.GatewayHeaders != nil {
+		gatewayHeaders = *endpoint.GatewayHeaders
+	}
+	handler = GatewayHeadersMiddleware(gatewayHeaders, handler)
+
+	handler = SecurityHeadersMiddleware(g.securityHeaders(endpoint.SecurityHeaders), handler)
+
+	// The mux matches any parameter value, the ones not matching the constraints of the path are not found
+	if template, err := compiledPathTemplate(endpoint.Path); err == nil && template.constrained {
+		next := handler
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := template.Match(r.URL.Path); !ok {
+				g.config.NotFoundResponse.write(w, http.StatusNotFound, "404 page not found")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	return proxy, g.trackInFlight(TraceContextMiddleware(EndpointLabelsMiddleware(endpoint, handler)))
+}
+
+// EnableDynamicEndpoints registers a catch-all route serving endpoints that are managed at runtime,
+// e.g. by the Kubernetes controller. Statically configured routes take precedence.
+func (g *Gateway) EnableDynamicEndpoints() {
+	g.registerCatchAll()
+}
+
+// UpdateDynamicEndpoints atomically replaces the endpoints managed at runtime and closes the idle upstream
+// connections of the replaced ones. Endpoints sharing a host and path are served by method; endpoints whose
+// host, path and method were already registered are skipped.
+func (g *Gateway) UpdateDynamicEndpoints(endpoints []Endpoint) {
+	mux := http.NewServeMux()
+	routers := make(map[string]*methodRouter)
+	var proxies []*Proxy
+
+	for _, endpoint := range endpoints {
+		pattern := endpoint.Host + endpoint.Path
+		router, ok := routers[pattern]
+		if !ok {
+			router = &methodRouter{handlers: make(map[string]http.Handler), gateway: g}
+			if err := registerPattern(mux, endpoint.Host+muxPattern(endpoint.Path), router); err != nil {
+				LogError("Skipping dynamic endpoint: invalid route", err, map[string]interface{}{
+					"pattern": pattern,
+					"backend": endpoint.Backend,
+				})
+				continue
+			}
+			routers[pattern] = router
+		}
+		if _, ok := router.handlers[endpoint.Method]; ok {
+			LogError("Skipping dynamic endpoint: route already registered", nil, map[string]interface{}{
+				"pattern": pattern,
+				"method":  endpoint.Method,
+				"backend": endpoint.Backend,
+			})
+			continue
+		}
+
+		proxy, handler := g.newEndpointHandler(endpoint)
+		router.handlers[endpoint.Method] = handler
+		proxies = append(proxies, proxy)
+	}
+
+	g.dynamicMux.Store(mux)
+	g.mu.Lock()
+	replaced := g.dynamicProxies
+	g.dynamicProxies = proxies
+	g.mu.Unlock()
+	for _, proxy := range replaced {
+		proxy.CloseIdleConnections()
+	}
+	LogInfo("Dynamic endpoints updated", map[string]interface{}{
+		"endpoints": len(proxies),
+	})
+}
+
+// methodRouter dispatches the requests of a dynamic route to the endpoint of their method, else to the
+// endpoint of all methods
+type methodRouter struct {
+	handlers map[string]http.Handler
+	gateway  *Gateway
+}
+
+// ServeHTTP serves a request with the endpoint of its method, answering 405 if no endpoint allows it
+func (m *methodRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handler, ok := m.handlers[r.Method]
+	if !ok {
+		handler, ok = m.handlers[""]
+	}
+	if !ok && len(m.handlers) == 1 {
+		// The endpoint answers with its own method not allowed response
+		for _, only := range m.handlers {
+			handler, ok = only, true
+		}
+	}
+	if ok {
+		handler.ServeHTTP(w, r)
+		return
+	}
+
+	methods := make([]string, 0, len(m.handlers))
+	for method := range m.handlers {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	if m.gateway.methodNotAllowedHandler != nil {
+		m.gateway.methodNotAllowedHandler.ServeHTTP(w, r)
+		return
+	}
+	m.gateway.config.MethodNotAllowedResponse.write(w, http.StatusMethodNotAllowed, "Method not allowed")
+}
+
+// registerPattern registers a handler on a mux, converting registration panics into errors
+func registerPattern(mux *http.ServeMux, pattern string, handler http.Handler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	mux.Handle(pattern, handler)
+	return nil
+}
+
+// Use adds a middleware that is applied to all endpoints.
+// Middlewares must be added before Initialize or RegisterEndpoints is called.
+func (g *Gateway) Use(middleware Middleware) {
+	g.middlewares = append(g.middlewares, middleware)
+}
+
+// SetMethodNotAllowedHandler sets the handler answering the requests with a method an endpoint does not
+// allow instead of the configured response, e.g. to render an error page. The Allow header listing the
+// method of the endpoint is set before it is called. It must be set before Initialize or RegisterEndpoints is called.
+func (g *Gateway) SetMethodNotAllowedHandler(handler http.Handler) {
+	g.methodNotAllowedHandler = handler
+}
+
+// securityHeaders returns the security headers to inject for the given per-endpoint overrides,
+// or nil if security headers are disabled
+func (g *Gateway) securityHeaders(overrides map[string]string) map[string]string {
+	if !g.config.SecurityHeaders.Enabled {
+		return nil
+	}
+	return g.config.SecurityHeaders.Resolve(overrides)
+}
+
 // AddPreBackendCallback adds a callback to be executed before the request is sent to the backend
 // for the specified endpoint path
 func (g *Gateway) AddPreBackendCallback(path string, callback RequestCallback) {
@@ -71,6 +420,10 @@ func (g *Gateway) AddPostBackendCallback(path string, callback ResponseCallback)
 
 // RegisterPreBackendCallbacks registers a pre-backend callback for all endpoints
 func (g *Gateway) RegisterPreBackendCallbacks(callback RequestCallback) {
+	g.mu.Lock()
+	g.globalPreCallbacks = append(g.globalPreCallbacks, callback)
+	g.mu.Unlock()
+
 	for path, proxy := range g.proxies {
 		proxy.AddPreBackendCallback(callback)
 		LogInfo("Pre-backend callback registered for endpoint", map[string]interface{}{
@@ -81,6 +434,10 @@ func (g *Gateway) RegisterPreBackendCallbacks(callback RequestCallback) {
 
 // RegisterPostBackendCallbacks registers a post-backend callback for all endpoints
 func (g *Gateway) RegisterPostBackendCallbacks(callback ResponseCallback) {
+	g.mu.Lock()
+	g.globalPostCallbacks = append(g.globalPostCallbacks, callback)
+	g.mu.Unlock()
+
 	for path, proxy := range g.proxies {
 		proxy.AddPostBackendCallback(callback)
 		LogInfo("Post-backend callback registered for endpoint", map[string]interface{}{
@@ -91,7 +448,7 @@ func (g *Gateway) RegisterPostBackendCallbacks(callback ResponseCallback) {
 
 // RegisterHealthCheck adds a health check endpoint
 func (g *Gateway) RegisterHealthCheck() {
-	g.mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+	g.handle("/health", SecurityHeadersMiddleware(g.securityHeaders(nil), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		startTime := time.Now()
 
 		// Log the health check request
@@ -124,7 +481,31 @@ func (g *Gateway) RegisterHealthCheck() {
 				float64(duration.Milliseconds()),
 			)
 		}
-	})
+	})), nil)
+}
+
+// RegisterReadinessCheck adds a readiness check endpoint that fails once the gateway is draining
+func (g *Gateway) RegisterReadinessCheck() {
+	g.handle("/ready", SecurityHeadersMiddleware(g.securityHeaders(nil), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startTime := time.Now()
+
+		// Log the readiness check request
+		LogRequest(r, g.config.Debug)
+
+		// Create a logging response writer
+		lrw := NewLoggingResponseWriter(w)
+
+		// Report the readiness
+		if g.Ready() {
+			writeJSON(lrw, http.StatusOK, map[string]string{"status": "ready"})
+		} else {
+			writeJSON(lrw, http.StatusServiceUnavailable, map[string]string{"status": "draining"})
+		}
+
+		// Log the response
+		duration := time.Since(startTime)
+		LogResponse(lrw, r, duration.String(), g.config.Debug)
+	})), nil)
 }
 
 // RegisterMetricsEndpoint adds a metrics endpoint for Prometheus scraping
@@ -140,7 +521,7 @@ func (g *Gateway) RegisterMetricsEndpoint() {
 	metricsHandler := g.telemetry.GetMetricsHandler()
 
 	// Register the metrics endpoint
-	g.mux.Handle("/metrics", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	g.handle("/metrics", SecurityHeadersMiddleware(g.securityHeaders(nil), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		startTime := time.Now()
 
 		// Log the metrics request
@@ -168,7 +549,7 @@ func (g *Gateway) RegisterMetricsEndpoint() {
 				float64(duration.Milliseconds()),
 			)
 		}
-	}))
+	})), nil)
 }
 
 // Start starts the API gateway server
@@ -213,5 +594,185 @@ func (g *Gateway) Start() error {
 		}
 	}
 
-	return http.ListenAndServe(addr, g.mux)
+	// Use a single listener on the configured port unless listeners are configured explicitly
+	listenerConfigs := g.config.Listeners
+	if len(listenerConfigs) == 0 {
+		listenerConfigs = []ListenerConfig{{Address: addr}}
+	}
+
+	// Use inherited listeners (socket activation or binary upgrade) if there are any
+	inherited, err := InheritedListeners()
+	if err != nil {
+		return err
+	}
+
+	errCh := make(chan error, len(listenerConfigs))
+	for i, listenerConfig := range listenerConfigs {
+		listener, err := g.listen(listenerConfig, inherited, i)
+		if err != nil {
+			_ = g.Shutdown(context.Background())
+			return err
+		}
+
+		// Route the TLS connections of a passthrough listener by SNI, it serves no endpoints
+		if listenerConfig.Passthrough.enabled() {
+			passthrough := NewPassthroughServer(listenerConfig.ListenerName(), listenerConfig.Passthrough)
+			g.mu.Lock()
+			g.passthroughs = append(g.passthroughs, passthrough)
+			g.listeners = append(g.listeners, listener)
+			g.mu.Unlock()
+
+			LogInfo("Starting listener", map[string]interface{}{
+				"name":        listenerConfig.ListenerName(),
+				"address":     listener.Addr().String(),
+				"passthrough": true,
+			})
+			go func(listener net.Listener) {
+				errCh <- passthrough.Serve(g.wrapListener(listener))
+			}(listener)
+			continue
+		}
+
+		// Serve only the endpoints bound to this listener
+		mux := g.mux
+		if listenerMux, ok := g.listenerMuxes[listenerConfig.ListenerName()]; ok {
+			mux = listenerMux
+		}
+		var handler http.Handler = mux
+		if g.config.RouteCache.Enabled {
+			handler = NewRouteCache(g.config.RouteCache, mux, g.routes, g.telemetry)
+		}
+		server := &http.Server{Handler: handler}
+
+		// Serve the certificates from a store selecting them by SNI and reloading them when they rotate
+		var certificateStore *CertificateStore
+		if listenerConfig.TLS.Enabled() {
+			certificateStore, err = NewCertificateStore(listenerConfig.ListenerName(), listenerConfig.TLS, g.certificates, g.telemetry)
+			if err != nil {
+				_ = listener.Close()
+				_ = g.Shutdown(context.Background())
+				return fmt.Errorf("failed to load certificates of listener %s: %w", listenerConfig.ListenerName(), err)
+			}
+			server.TLSConfig = certificateStore.TLSConfig()
+		}
+
+		g.mu.Lock()
+		g.servers = append(g.servers, server)
+		g.serverNames = append(g.serverNames, listenerConfig.ListenerName())
+		g.listeners = append(g.listeners, listener)
+		if certificateStore != nil {
+			g.certificateStores = append(g.certificateStores, certificateStore)
+		}
+		g.mu.Unlock()
+
+		LogInfo("Starting listener", map[string]interface{}{
+			"name":    listenerConfig.ListenerName(),
+			"address": listener.Addr().String(),
+			"tls":     listenerConfig.TLS.Enabled(),
+		})
+
+		listener = g.wrapListener(listener)
+		go func(listener net.Listener, listenerConfig ListenerConfig) {
+			if certificateStore != nil {
+				// Reload the certificates when their files change while the listener is served
+				done := make(chan struct{})
+				go certificateStore.Watch(done)
+				err := server.ServeTLS(listener, "", "")
+				close(done)
+				errCh <- err
+				return
+			}
+			errCh <- server.Serve(listener)
+		}(listener, listenerConfig)
+	}
+
+	// Close inherited listeners that are not configured anymore
+	for i := len(listenerConfigs); i < len(inherited); i++ {
+		_ = inherited[i].Close()
+	}
+
+	// Return as soon as any of the listeners fails, or once all of them have been shut down
+	for range listenerConfigs {
+		if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+	}
+
+	// Let a drain complete before reporting the gateway as stopped
+	if g.draining.Load() {
+		<-g.drainDone
+	}
+	return http.ErrServerClosed
+}
+
+// wrapListener sets the socket options of the connections of a listener and limits them, the listeners kept
+// for binary upgrades stay unwrapped
+func (g *Gateway) wrapListener(listener net.Listener) net.Listener {
+	if g.config.Socket.enabled() {
+		listener = SocketOptionsListener(listener, g.config.Socket)
+	}
+	if g.connLimiter != nil {
+		listener = g.connLimiter.Listener(listener)
+	}
+	return listener
+}
+
+// listen returns the listener for the listener configuration at the given index
+func (g *Gateway) listen(listenerConfig ListenerConfig, inherited []net.Listener, index int) (net.Listener, error) {
+	if index < len(inherited) {
+		LogInfo("Using inherited listener", map[string]interface{}{
+			"name":    listenerConfig.ListenerName(),
+			"address": inherited[index].Addr().String(),
+		})
+		return inherited[index], nil
+	}
+
+	listener, err := Listen(listenerConfig.Address, g.config.ReusePort)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", listenerConfig.Address, err)
+	}
+	return listener, nil
+}
+
+// Shutdown gracefully stops the gateway, waiting for in-flight requests until the context expires
+func (g *Gateway) Shutdown(ctx context.Context) error {
+	g.mu.Lock()
+	servers := append([]*http.Server(nil), g.servers...)
+	passthroughs := append([]*PassthroughServer(nil), g.passthroughs...)
+	g.mu.Unlock()
+
+	var errs []error
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, passthrough := range passthroughs {
+		if err := passthrough.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Upgrade starts a new gateway process that inherits the listening sockets.
+// The current process should shut down gracefully afterwards.
+func (g *Gateway) Upgrade() error {
+	g.mu.Lock()
+	listeners := append([]net.Listener(nil), g.listeners...)
+	g.mu.Unlock()
+
+	if len(listeners) == 0 {
+		return errors.New("gateway is not listening")
+	}
+
+	process, err := StartUpgradedProcess(listeners)
+	if err != nil {
+		return err
+	}
+
+	LogInfo("Started upgraded gateway process", map[string]interface{}{
+		"pid": process.Pid,
+	})
+	return nil
 }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// defaultGatewayName is the name of the gateway in the Via and X-Gateway headers if none is configured
+const defaultGatewayName = "surfboard"
+
+// GatewayHeadersConfig represents the headers identifying the gateway to backends and clients, and the
+// backend-identifying headers removed from responses
+type GatewayHeadersConfig struct {
+	// Name is the name of the gateway in the Via and X-Gateway headers (default surfboard)
+	Name string `json:"name"`
+	// Via adds the gateway to the Via header of requests and responses
+	Via bool `json:"via"`
+	// XGateway sets the X-Gateway header of requests and responses to the gateway name
+	XGateway bool `json:"x_gateway"`
+	// StripResponseHeaders are the response headers removed before responses reach clients,
+	// e.g. Server or X-Powered-By
+	StripResponseHeaders []string `json:"strip_response_headers"`
+}
+
+// enabled reports whether any header is added or removed
+func (c GatewayHeadersConfig) enabled() bool {
+	return c.Via || c.XGateway || len(c.StripResponseHeaders) > 0
+}
+
+// viaValue returns the Via entry of the gateway for a message of the given protocol version
+func (c GatewayHeadersConfig) viaValue(major, minor int) string {
+	version := strconv.Itoa(major)
+	if major < 2 {
+		version += "." + strconv.Itoa(minor)
+	}
+	return version + " " + valueOrDefault(c.Name, defaultGatewayName)
+}
+
+// GatewayHeadersMiddleware wraps a handler so that the gateway identification headers are added to the
+// request and the response, and the configured backend headers are removed from the response
+func GatewayHeadersMiddleware(config GatewayHeadersConfig, next http.Handler) http.Handler {
+	if !config.enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if config.Via {
+			r.Header.Add("Via", config.viaValue(r.ProtoMajor, r.ProtoMinor))
+		}
+		if config.XGateway {
+			r.Header.Set("X-Gateway", valueOrDefault(config.Name, defaultGatewayName))
+		}
+		next.ServeHTTP(&gatewayHeadersWriter{ResponseWriter: w, config: config, request: r}, r)
+	})
+}
+
+// gatewayHeadersWriter is a wrapper around http.ResponseWriter that adds and removes the gateway headers
+// right before the response headers are written
+type gatewayHeadersWriter struct {
+	http.ResponseWriter
+	config      GatewayHeadersConfig
+	request     *http.Request
+	wroteHeader bool
+}
+
+// WriteHeader updates the response headers and writes the status code
+func (w *gatewayHeadersWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		header := w.ResponseWriter.Header()
+		for _, name := range w.config.StripResponseHeaders {
+			header.Del(name)
+		}
+		if w.config.Via {
+			header.Add("Via", w.config.viaValue(w.request.ProtoMajor, w.request.ProtoMinor))
+		}
+		if w.config.XGateway {
+			header.Set("X-Gateway", valueOrDefault(w.config.Name, defaultGatewayName))
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write makes sure the headers are updated before the body is written
+func (w *gatewayHeadersWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying ResponseWriter so http.ResponseController can reach it
+func (w *gatewayHeadersWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestGatewayHeaders tests that the gateway identifies itself to backends and clients, removes backend
+// headers and honors per-endpoint overrides
+func TestGatewayHeaders(t *testing.T) {
+	var via, xGateway string
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		via = r.Header.Get("Via")
+		xGateway = r.Header.Get("X-Gateway")
+		w.Header().Set("Server", "Apache/2.4.1")
+		w.Header().Set("X-Powered-By", "PHP/5.6")
+		w.Header().Set("Via", "1.1 backend-cache")
+		_, _ = w.Write([]byte("OK"))
+	}))
+	defer backendServer.Close()
+
+	gateway := NewGateway(Config{
+		Endpoints: []Endpoint{
+			{Path: "/api", Backend: backendServer.URL},
+			{Path: "/raw", Backend: backendServer.URL, GatewayHeaders: &GatewayHeadersConfig{}},
+		},
+		GatewayHeaders: GatewayHeadersConfig{
+			Name:                 "edge-1",
+			Via:                  true,
+			XGateway:             true,
+			StripResponseHeaders: []string{"Server", "X-Powered-By"},
+		},
+	}, nil)
+	gateway.RegisterEndpoints()
+
+	rr := httptest.NewRecorder()
+	gateway.mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api", nil))
+	if via != "1.1 edge-1" || xGateway != "edge-1" {
+		t.Errorf("expected the upstream Via and X-Gateway headers, got %q and %q", via, xGateway)
+	}
+	if values := rr.Header().Values("Via"); len(values) != 2 || values[1] != "1.1 edge-1" {
+		t.Errorf("expected the gateway to be appended to the response Via header, got %v", values)
+	}
+	if rr.Header().Get("X-Gateway") != "edge-1" || rr.Header().Get("Server") != "" || rr.Header().Get("X-Powered-By") != "" {
+		t.Errorf("unexpected response headers %v", rr.Header())
+	}
+
+	// The endpoint override disables the headers
+	rr = httptest.NewRecorder()
+	gateway.mux.ServeHTTP(rr, httptest.NewRequest("GET", "/raw", nil))
+	if via != "" || rr.Header().Get("Server") == "" || rr.Header().Get("X-Gateway") != "" {
+		t.Errorf("expected no gateway headers for the overridden endpoint, got upstream Via %q and response %v", via, rr.Header())
+	}
+}
@@ -272,3 +272,48 @@ func TestGatewayRegisterCallbacks(t *testing.T) {
 	// sent to/from the backend. In a more comprehensive test, we would need to mock the proxy
 	// and verify that the callbacks are called for all endpoints.
 }
+
+// TestGatewayListenerEndpoints tests that endpoints are only served on the listeners they are bound to
+func TestGatewayListenerEndpoints(t *testing.T) {
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("OK"))
+	}))
+	defer backendServer.Close()
+
+	config := Config{
+		Listeners: []ListenerConfig{
+			{Name: "public", Address: "127.0.0.1:0"},
+			{Name: "internal", Address: "127.0.0.1:0"},
+		},
+		Endpoints: []Endpoint{
+			{Path: "/public", Method: "GET", Backend: backendServer.URL},
+			{Path: "/internal", Method: "GET", Backend: backendServer.URL, Listeners: []string{"internal"}},
+		},
+	}
+
+	gateway := NewGateway(config, nil)
+	gateway.RegisterEndpoints()
+	gateway.RegisterHealthCheck()
+
+	tests := []struct {
+		listener string
+		path     string
+		expected int
+	}{
+		{listener: "public", path: "/public", expected: http.StatusOK},
+		{listener: "public", path: "/internal", expected: http.StatusNotFound},
+		{listener: "public", path: "/health", expected: http.StatusOK},
+		{listener: "internal", path: "/public", expected: http.StatusOK},
+		{listener: "internal", path: "/internal", expected: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.listener+tt.path, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			gateway.listenerMuxes[tt.listener].ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+			if rr.Code != tt.expected {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// GeoIPConfig represents the GeoIP lookup configuration
+type GeoIPConfig struct {
+	Enabled bool `json:"enabled"`
+	// CountryDatabase is the path to a MaxMind country (or city) database
+	CountryDatabase string `json:"country_database"`
+	// ASNDatabase is the path to a MaxMind ASN database
+	ASNDatabase string `json:"asn_database"`
+	// TrustForwardedFor uses the X-Forwarded-For header to determine the client IP
+	TrustForwardedFor bool     `json:"trust_forwarded_for"`
+	AllowCountries    []string `json:"allow_countries"`
+	DenyCountries     []string `json:"deny_countries"`
+	DenyASNs          []uint   `json:"deny_asns"`
+	// MetricLabels adds the client country to request metrics
+	MetricLabels bool `json:"metric_labels"`
+}
+
+// EndpointGeoConfig represents the per-endpoint geo rules
+type EndpointGeoConfig struct {
+	AllowCountries []string `json:"allow_countries"`
+	DenyCountries  []string `json:"deny_countries"`
+	// Backends maps a country code to an alternative backend URL
+	Backends map[string]string `json:"backends"`
+}
+
+// GeoInfo holds the geo attributes of a request
+type GeoInfo struct {
+	Country string
+	ASN     uint
+	ASOrg   string
+}
+
+// geoInfoKey is the context key for the GeoInfo of a request
+type geoInfoKey struct{}
+
+// GeoInfoFromContext returns the GeoInfo attached to the request context, if any
+func GeoInfoFromContext(ctx context.Context) (GeoInfo, bool) {
+	info, ok := ctx.Value(geoInfoKey{}).(GeoInfo)
+	return info, ok
+}
+
+// GeoIP resolves the geo attributes of requests and enforces geo-based rules
+type GeoIP struct {
+	config    GeoIPConfig
+	countryDB *MMDBReader
+	asnDB     *MMDBReader
+}
+
+// NewGeoIP creates a new GeoIP and opens the configured databases
+func NewGeoIP(config GeoIPConfig) (*GeoIP, error) {
+	geo := &GeoIP{config: config}
+
+	var err error
+	if config.CountryDatabase != "" {
+		if geo.countryDB, err = OpenMMDB(config.CountryDatabase); err != nil {
+			return nil, fmt.Errorf("failed to open country database: %w", err)
+		}
+	}
+	if config.ASNDatabase != "" {
+		if geo.asnDB, err = OpenMMDB(config.ASNDatabase); err != nil {
+			return nil, fmt.Errorf("failed to open ASN database: %w", err)
+		}
+	}
+
+	return geo, nil
+}
+
+// Lookup returns the geo attributes of an IP address
+func (g *GeoIP) Lookup(ip net.IP) GeoInfo {
+	var info GeoInfo
+	if ip == nil {
+		return info
+	}
+
+	if g.countryDB != nil {
+		record, err := g.countryDB.Lookup(ip)
+		if err != nil {
+			LogError("GeoIP country lookup failed", err, map[string]interface{}{"ip": ip.String()})
+		}
+		if country, ok := record["country"].(map[string]interface{}); ok {
+			info.Country, _ = country["iso_code"].(string)
+		}
+	}
+
+	if g.asnDB != nil {
+		record, err := g.asnDB.Lookup(ip)
+		if err != nil {
+			LogError("GeoIP ASN lookup failed", err, map[string]interface{}{"ip": ip.String()})
+		}
+		info.ASN = uint(toUint64(record["autonomous_system_number"]))
+		info.ASOrg, _ = record["autonomous_system_organization"].(string)
+	}
+
+	return info
+}
+
+// Allowed checks the geo attributes against the global and per-endpoint rules
+func (g *GeoIP) Allowed(info GeoInfo, endpoint Endpoint) bool {
+	for _, asn := range g.config.DenyASNs {
+		if info.ASN != 0 && info.ASN == asn {
+			return false
+		}
+	}
+	return countryAllowed(info.Country, g.config.AllowCountries, g.config.DenyCountries) &&
+		countryAllowed(info.Country, endpoint.Geo.AllowCountries, endpoint.Geo.DenyCountries)
+}
+
+// countryAllowed checks a country against allow and deny lists.
+// When an allow list is configured, unknown countries are denied.
+func countryAllowed(country string, allow, deny []string) bool {
+	for _, denied := range deny {
+		if strings.EqualFold(country, denied) {
+			return false
+		}
+	}
+	if len(allow) == 0 {
+		return true
+	}
+	for _, allowed := range allow {
+		if strings.EqualFold(country, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware returns a gateway middleware that attaches geo attributes to requests,
+// enforces geo rules and applies geo-based backend routing
+func (g *GeoIP) Middleware(endpoint Endpoint, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := ClientIP(r, g.config.TrustForwardedFor)
+		info := g.Lookup(ip)
+
+		if !g.Allowed(info, endpoint) {
+			LogAudit("Request blocked by geo rules", map[string]interface{}{
+				"client_ip": ip.String(),
+				"country":   info.Country,
+				"asn":       info.ASN,
+				"method":    r.Method,
+				"path":      r.URL.Path,
+			})
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		// Expose the attributes to the backend, replacing any client-supplied values
+		r.Header.Del("X-Geo-Country")
+		r.Header.Del("X-Geo-ASN")
+		if info.Country != "" {
+			r.Header.Set("X-Geo-Country", info.Country)
+		}
+		if info.ASN != 0 {
+			r.Header.Set("X-Geo-ASN", strconv.FormatUint(uint64(info.ASN), 10))
+		}
+
+		ctx := context.WithValue(r.Context(), geoInfoKey{}, info)
+		if g.config.MetricLabels {
+			ctx = WithMetricAttributes(ctx, attribute.String("geo.country", info.Country))
+		}
+
+		// Route to a country-specific backend if one is configured
+		if backend, ok := endpoint.Geo.Backends[info.Country]; ok && info.Country != "" {
+			ctx = WithBackendOverride(ctx, backend)
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// mmdbEncodeString encodes a string in the MaxMind DB data format
+func mmdbEncodeString(s string) []byte {
+	return append([]byte{byte(mmdbString<<5 | len(s))}, s...)
+}
+
+// mmdbEncodeUint16 encodes a uint16 in the MaxMind DB data format
+func mmdbEncodeUint16(v uint16) []byte {
+	return []byte{byte(mmdbUint16<<5 | 2), byte(v >> 8), byte(v)}
+}
+
+// mmdbEncodeMap encodes a map header followed by alternating keys and values
+func mmdbEncodeMap(pairs ...[]byte) []byte {
+	result := []byte{byte(mmdbMap<<5 | len(pairs)/2)}
+	for _, pair := range pairs {
+		result = append(result, pair...)
+	}
+	return result
+}
+
+// buildTestMMDB builds a minimal IPv4 MaxMind DB with a single node:
+// addresses in 0.0.0.0/1 resolve to the given record, all others have no record
+func buildTestMMDB(record []byte) []byte {
+	nodeCount := 1
+	dataPointer := nodeCount + 16
+	tree := []byte{
+		byte(dataPointer >> 16), byte(dataPointer >> 8), byte(dataPointer),
+		byte(nodeCount >> 16), byte(nodeCount >> 8), byte(nodeCount),
+	}
+
+	db := append(tree, make([]byte, 16)...)
+	db = append(db, record...)
+	db = append(db, mmdbMetadataMarker...)
+	db = append(db, mmdbEncodeMap(
+		mmdbEncodeString("node_count"), mmdbEncodeUint16(uint16(nodeCount)),
+		mmdbEncodeString("record_size"), mmdbEncodeUint16(24),
+		mmdbEncodeString("ip_version"), mmdbEncodeUint16(4),
+	)...)
+	return db
+}
+
+// TestMMDBReaderLookup tests the Lookup method of the MMDBReader class
+func TestMMDBReaderLookup(t *testing.T) {
+	reader, err := NewMMDBReader(buildTestMMDB(mmdbEncodeMap(
+		mmdbEncodeString("country"), mmdbEncodeMap(mmdbEncodeString("iso_code"), mmdbEncodeString("DE")),
+	)))
+	if err != nil {
+		t.Fatalf("Failed to create MMDBReader: %v", err)
+	}
+
+	record, err := reader.Lookup(net.ParseIP("10.1.2.3"))
+	if err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+	country, _ := record["country"].(map[string]interface{})
+	if country["iso_code"] != "DE" {
+		t.Errorf("Lookup() country = %v, want DE", record["country"])
+	}
+
+	record, err = reader.Lookup(net.ParseIP("200.1.2.3"))
+	if err != nil || record != nil {
+		t.Errorf("Lookup() = %v, %v, want no record", record, err)
+	}
+}
+
+// TestGeoIPMiddleware tests geo-based blocking and routing
+func TestGeoIPMiddleware(t *testing.T) {
+	reader, err := NewMMDBReader(buildTestMMDB(mmdbEncodeMap(
+		mmdbEncodeString("country"), mmdbEncodeMap(mmdbEncodeString("iso_code"), mmdbEncodeString("DE")),
+	)))
+	if err != nil {
+		t.Fatalf("Failed to create MMDBReader: %v", err)
+	}
+
+	// Create the default and the country-specific backends
+	defaultBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("default"))
+	}))
+	defer defaultBackend.Close()
+	euBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("eu " + r.Header.Get("X-Geo-Country")))
+	}))
+	defer euBackend.Close()
+
+	geoIP := &GeoIP{config: GeoIPConfig{DenyCountries: []string{"XX"}}, countryDB: reader}
+
+	endpoint := Endpoint{
+		Path:    "/test",
+		Backend: defaultBackend.URL,
+		Geo: EndpointGeoConfig{
+			AllowCountries: []string{"DE"},
+			Backends:       map[string]string{"DE": euBackend.URL},
+		},
+	}
+	handler := geoIP.Middleware(endpoint, NewProxy(endpoint, false, nil).Handler())
+
+	// Requests from Germany are routed to the EU backend
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.RemoteAddr = "10.1.2.3:1234"
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || rr.Body.String() != "eu DE" {
+		t.Errorf("handler returned %d %q, want 200 %q", rr.Code, rr.Body.String(), "eu DE")
+	}
+
+	// Requests from unknown countries are rejected by the allow list
+	req = httptest.NewRequest("GET", "/test", nil)
+	req.RemoteAddr = "200.1.2.3:1234"
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultMaxGraphQLBodyBytes is the maximum size of a GraphQL request body if none is configured
+const defaultMaxGraphQLBodyBytes = 1024 * 1024
+
+// GraphQLConfig represents the operation-level limits of a GraphQL endpoint, enforced on the parsed
+// queries before they are proxied to the GraphQL backend
+type GraphQLConfig struct {
+	Enabled bool `json:"enabled"`
+	// MaxDepth is the maximum nesting of fields of an operation (0 is unlimited)
+	MaxDepth int `json:"max_depth"`
+	// MaxComplexity is the maximum complexity of an operation: each field costs 1, and the cost of the
+	// selections of a field with a first, last or limit argument is multiplied by its value (0 is unlimited)
+	MaxComplexity int64 `json:"max_complexity"`
+	// OperationRateLimits maps operation names to their maximum number of requests per minute
+	OperationRateLimits map[string]int `json:"operation_rate_limits"`
+	// PersistedQueries is a JSON file mapping the SHA-256 hashes of the persisted queries to their text
+	PersistedQueries string `json:"persisted_queries"`
+	// PersistedQueriesOnly rejects the queries that are not persisted
+	PersistedQueriesOnly bool `json:"persisted_queries_only"`
+	// MaxBodyBytes is the maximum size of a request body (default 1 MiB)
+	MaxBodyBytes int64 `json:"max_body_bytes"`
+}
+
+// graphQLRequest is a GraphQL request as sent over HTTP, with the automatic persisted query extension
+type graphQLRequest struct {
+	Query         string                 `json:"query,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"`
+	// expanded is set when the query text was added from the persisted queries
+	expanded bool
+}
+
+// persistedQueryHash returns the hash of the persisted query extension of a request
+func (r graphQLRequest) persistedQueryHash() string {
+	persisted, _ := r.Extensions["persistedQuery"].(map[string]interface{})
+	hash, _ := persisted["sha256Hash"].(string)
+	return strings.ToLower(hash)
+}
+
+// graphQLError is a rejection of a GraphQL request
+type graphQLError struct {
+	status     int
+	code       string
+	message    string
+	retryAfter time.Duration
+}
+
+// GraphQLGuard enforces the operation limits of a GraphQL endpoint
+type GraphQLGuard struct {
+	config    GraphQLConfig
+	persisted map[string]string
+	loadErr   error
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	now     func() time.Time
+}
+
+// NewGraphQLGuard creates a new GraphQLGuard, loading the persisted queries if configured
+func NewGraphQLGuard(config GraphQLConfig) *GraphQLGuard {
+	if config.MaxBodyBytes <= 0 {
+		config.MaxBodyBytes = defaultMaxGraphQLBodyBytes
+	}
+	g := &GraphQLGuard{
+		config:  config,
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+	if config.PersistedQueries != "" {
+		g.persisted, g.loadErr = loadPersistedQueries(config.PersistedQueries)
+	} else if config.PersistedQueriesOnly {
+		g.loadErr = fmt.Errorf("persisted queries only without persisted queries")
+	}
+	if g.loadErr != nil {
+		LogError("Invalid GraphQL configuration", g.loadErr, map[string]interface{}{
+			"persisted_queries": config.PersistedQueries,
+		})
+	}
+	return g
+}
+
+// loadPersistedQueries reads the persisted queries, keyed by the lowercase hex SHA-256 of their text
+func loadPersistedQueries(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read persisted queries: %w", err)
+	}
+	var queries map[string]string
+	if err := json.Unmarshal(data, &queries); err != nil {
+		return nil, fmt.Errorf("failed to parse persisted queries: %w", err)
+	}
+	persisted := make(map[string]string, len(queries))
+	for hash, query := range queries {
+		if queryHash(query) != strings.ToLower(hash) {
+			return nil, fmt.Errorf("persisted query %s does not match its hash", hash)
+		}
+		persisted[strings.ToLower(hash)] = query
+	}
+	return persisted, nil
+}
+
+// queryHash returns the lowercase hex SHA-256 of a query
+func queryHash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+// readRequests returns the GraphQL requests of an HTTP request: the query parameters of a GET request,
+// or a single or batched JSON body or an application/graphql body of a POST request
+func (g *GraphQLGuard) readRequests(r *http.Request) ([]graphQLRequest, bool, *graphQLError) {
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		request := graphQLRequest{Query: query.Get("query"), OperationName: query.Get("operationName")}
+		for name, target := range map[string]*map[string]interface{}{"variables": &request.Variables, "extensions": &request.Extensions} {
+			if value := query.Get(name); value != "" {
+				if err := json.Unmarshal([]byte(value), target); err != nil {
+					return nil, false, &graphQLError{status: http.StatusBadRequest, code: "BAD_REQUEST", message: "invalid " + name}
+				}
+			}
+		}
+		return []graphQLRequest{request}, false, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, g.config.MaxBodyBytes+1))
+	if err != nil {
+		return nil, false, &graphQLError{status: requestBodyErrorStatus(err), code: "BAD_REQUEST", message: "failed to read request body"}
+	}
+	if int64(len(body)) > g.config.MaxBodyBytes {
+		return nil, false, &graphQLError{status: http.StatusRequestEntityTooLarge, code: "BAD_REQUEST", message: "request body too large"}
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	if mediaTypeOf(r.Header.Get("Content-Type")) == "application/graphql" {
+		return []graphQLRequest{{Query: string(body)}}, false, nil
+	}
+	// Decode numbers as json.Number so variables keep their precision if the body is rewritten
+	var requests []graphQLRequest
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	batch := len(bytes.TrimSpace(body)) > 0 && bytes.TrimSpace(body)[0] == '['
+	if batch {
+		err = decoder.Decode(&requests)
+	} else {
+		requests = make([]graphQLRequest, 1)
+		err = decoder.Decode(&requests[0])
+	}
+	if err != nil {
+		return nil, false, &graphQLError{status: http.StatusBadRequest, code: "BAD_REQUEST", message: "invalid GraphQL request body"}
+	}
+	return requests, batch, nil
+}
+
+// check validates a GraphQL request, replacing the hash of a persisted query with its text.
+// It returns the name of the operation.
+func (g *GraphQLGuard) check(request *graphQLRequest) (string, *graphQLError) {
+	hash := request.persistedQueryHash()
+	if request.Query == "" && hash != "" {
+		query, ok := g.persisted[hash]
+		if !ok {
+			if g.config.PersistedQueriesOnly {
+				return "", &graphQLError{status: http.StatusForbidden, code: "PERSISTED_QUERY_NOT_ALLOWED", message: "persisted query not allowed"}
+			}
+			// Let the backend answer unknown automatic persisted queries
+			return request.OperationName, nil
+		}
+		request.Query = query
+		request.expanded = true
+	}
+	if request.Query == "" {
+		return "", &graphQLError{status: http.StatusBadRequest, code: "BAD_REQUEST", message: "missing query"}
+	}
+	if g.config.PersistedQueriesOnly {
+		if _, ok := g.persisted[queryHash(request.Query)]; !ok {
+			return "", &graphQLError{status: http.StatusForbidden, code: "PERSISTED_QUERY_NOT_ALLOWED", message: "query is not persisted"}
+		}
+	}
+
+	document, err := parseGraphQL(request.Query)
+	if err != nil {
+		return "", &graphQLError{status: http.StatusBadRequest, code: "GRAPHQL_PARSE_FAILED", message: "invalid query: " + err.Error()}
+	}
+	operation, ok := document.operation(request.OperationName)
+	if !ok {
+		return "", &graphQLError{status: http.StatusBadRequest, code: "BAD_REQUEST", message: "unknown or ambiguous operation"}
+	}
+
+	cost, err := document.measure(operation, request.Variables)
+	if err != nil {
+		return "", &graphQLError{status: http.StatusBadRequest, code: "GRAPHQL_VALIDATION_FAILED", message: err.Error()}
+	}
+	if g.config.MaxDepth > 0 && cost.depth > g.config.MaxDepth {
+		return "", &graphQLError{status: http.StatusBadRequest, code: "QUERY_TOO_DEEP", message: fmt.Sprintf("query depth %d exceeds the maximum of %d", cost.depth, g.config.MaxDepth)}
+	}
+	if g.config.MaxComplexity > 0 && cost.complexity > g.config.MaxComplexity {
+		return "", &graphQLError{status: http.StatusBadRequest, code: "QUERY_TOO_COMPLEX", message: fmt.Sprintf("query complexity %d exceeds the maximum of %d", cost.complexity, g.config.MaxComplexity)}
+	}
+	return operation.name, nil
+}
+
+// operation returns the operation with the given name, or the only operation if no name is given
+func (d *gqlDocument) operation(name string) (gqlOperation, bool) {
+	if name == "" {
+		return d.operations[0], len(d.operations) == 1
+	}
+	for _, operation := range d.operations {
+		if operation.name == name {
+			return operation, true
+		}
+	}
+	return gqlOperation{}, false
+}
+
+// allow takes a token from the bucket of a rate limited operation, returning the time until the next
+// token otherwise. The status of the bucket is reported for the rate limited operations only.
+func (g *GraphQLGuard) allow(operation string) (bool, time.Duration, RateLimitStatus) {
+	limit, ok := g.config.OperationRateLimits[operation]
+	if !ok || limit <= 0 {
+		return true, 0, RateLimitStatus{}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.now()
+	bucket, ok := g.buckets[operation]
+	if !ok {
+		bucket = &tokenBucket{rate: float64(limit) / 60, burst: float64(limit), tokens: float64(limit), updated: now}
+		g.buckets[operation] = bucket
+	}
+	return bucket.take(now)
+}
+
+// writeGraphQLError writes a rejection in the GraphQL response format
+func writeGraphQLError(w http.ResponseWriter, rejection *graphQLError) {
+	if rejection.retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(rejection.retryAfter.Seconds()))))
+	}
+	writeJSON(w, rejection.status, map[string]interface{}{
+		"errors": []map[string]interface{}{{
+			"message":    rejection.message,
+			"extensions": map[string]interface{}{"code": rejection.code},
+		}},
+	})
+}
+
+// Middleware rejects the GraphQL requests exceeding the operation limits before they are proxied
+func (g *GraphQLGuard) Middleware(endpoint Endpoint, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if g.loadErr != nil {
+			http.Error(w, "Invalid GraphQL configuration", http.StatusInternalServerError)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		requests, batch, rejection := g.readRequests(r)
+		var operation string
+		var status RateLimitStatus
+		for i := 0; rejection == nil && i < len(requests); i++ {
+			operation, rejection = g.check(&requests[i])
+			if rejection == nil {
+				ok, retryAfter, operationStatus := g.allow(operation)
+				if operationStatus.Limit > 0 && operationStatus.tighter(status) {
+					status = operationStatus
+				}
+				if !ok {
+					rejection = &graphQLError{status: http.StatusTooManyRequests, code: "RATE_LIMITED", message: "operation " + operation + " is rate limited", retryAfter: retryAfter}
+				}
+			}
+		}
+		// Report the most restrictive limit of the rate limited operations of the request
+		if status.Limit > 0 {
+			setRateLimitHeaders(w.Header(), status)
+		}
+		if rejection != nil {
+			LogAudit("GraphQL request rejected", map[string]interface{}{
+				"path":        r.URL.Path,
+				"route":       endpoint.Path,
+				"operation":   operation,
+				"code":        rejection.code,
+				"reason":      rejection.message,
+				"remote_addr": r.RemoteAddr,
+			})
+			writeGraphQLError(w, rejection)
+			return
+		}
+
+		// Send the text of the persisted queries to the backend
+		expanded := false
+		for _, request := range requests {
+			expanded = expanded || request.expanded
+		}
+		if expanded && r.Method == http.MethodGet {
+			query := r.URL.Query()
+			query.Set("query", requests[0].Query)
+			r.URL.RawQuery = query.Encode()
+		} else if expanded {
+			var body []byte
+			var err error
+			if batch {
+				body, err = json.Marshal(requests)
+			} else {
+				body, err = json.Marshal(requests[0])
+			}
+			if err != nil {
+				http.Error(w, "Bad request", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			r.ContentLength = int64(len(body))
+			r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+			r.TransferEncoding = nil
+			r.GetBody = func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(body)), nil
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// gqlToken kinds
+const (
+	gqlPunct = iota
+	gqlName
+	gqlNumber
+	gqlString
+	gqlEOF
+)
+
+// gqlToken is a lexical token of a GraphQL document
+type gqlToken struct {
+	kind  int
+	value string
+}
+
+// gqlLex splits a GraphQL document into tokens, dropping whitespace, commas and comments
+func gqlLex(source string) ([]gqlToken, error) {
+	var tokens []gqlToken
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(source) && source[i] != '\n' && source[i] != '\r' {
+				i++
+			}
+		case strings.HasPrefix(source[i:], "..."):
+			tokens = append(tokens, gqlToken{gqlPunct, "..."})
+			i += 3
+		case strings.ContainsRune("!$&()/:=@[]{}|", rune(c)):
+			tokens = append(tokens, gqlToken{gqlPunct, string(c)})
+			i++
+		case strings.HasPrefix(source[i:], `"""`):
+			j := i + 3
+			for j < len(source) && !strings.HasPrefix(source[j:], `"""`) {
+				if strings.HasPrefix(source[j:], `\"""`) {
+					j += 3
+				}
+				j++
+			}
+			if j >= len(source) {
+				return nil, fmt.Errorf("unterminated block string")
+			}
+			tokens = append(tokens, gqlToken{gqlString, source[i+3 : j]})
+			i = j + 3
+		case c == '"':
+			j := i + 1
+			for j < len(source) && source[j] != '"' {
+				if source[j] == '\\' {
+					j++
+				}
+				if j < len(source) && (source[j] == '\n' || source[j] == '\r') {
+					return nil, fmt.Errorf("unterminated string")
+				}
+				j++
+			}
+			if j >= len(source) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, gqlToken{gqlString, source[i+1 : j]})
+			i = j + 1
+		case c == '-' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for j < len(source) && strings.IndexByte("0123456789.eE+-", source[j]) >= 0 {
+				j++
+			}
+			tokens = append(tokens, gqlToken{gqlNumber, source[i:j]})
+			i = j
+		case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			j := i + 1
+			for j < len(source) && (source[j] == '_' || (source[j] >= 'a' && source[j] <= 'z') || (source[j] >= 'A' && source[j] <= 'Z') || (source[j] >= '0' && source[j] <= '9')) {
+				j++
+			}
+			tokens = append(tokens, gqlToken{gqlName, source[i:j]})
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	return append(tokens, gqlToken{kind: gqlEOF}), nil
+}
+
+// gqlVariable is a reference to an operation variable in an argument value
+type gqlVariable string
+
+// gqlSelection is a field, fragment spread or inline fragment of a selection set
+type gqlSelection struct {
+	// field is the name of a field, spread the name of a spread fragment, both are empty for inline fragments
+	field  string
+	spread string
+	// limit is the value of a first, last or limit argument: an int64, a gqlVariable or nil
+	limit    interface{}
+	children []gqlSelection
+}
+
+// gqlOperation is an operation definition of a GraphQL document
+type gqlOperation struct {
+	kind       string
+	name       string
+	selections []gqlSelection
+}
+
+// gqlDocument is a parsed GraphQL document
+type gqlDocument struct {
+	operations []gqlOperation
+	fragments  map[string][]gqlSelection
+}
+
+// gqlParser parses GraphQL documents into the parts needed to enforce operation limits
+type gqlParser struct {
+	tokens  []gqlToken
+	pos     int
+	nesting int
+}
+
+// maxGraphQLNesting is the maximum nesting of selection sets accepted by the parser, well above any
+// sensible depth limit, so hostile documents cannot exhaust the stack
+const maxGraphQLNesting = 512
+
+// parseGraphQL parses a GraphQL document
+func parseGraphQL(source string) (*gqlDocument, error) {
+	tokens, err := gqlLex(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &gqlParser{tokens: tokens}
+	document := &gqlDocument{fragments: make(map[string][]gqlSelection)}
+	for p.peek().kind != gqlEOF {
+		token := p.peek()
+		switch {
+		case token.kind == gqlPunct && token.value == "{":
+			selections, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			document.operations = append(document.operations, gqlOperation{kind: "query", selections: selections})
+		case token.kind == gqlName && (token.value == "query" || token.value == "mutation" || token.value == "subscription"):
+			operation, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			document.operations = append(document.operations, operation)
+		case token.kind == gqlName && token.value == "fragment":
+			name, selections, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			document.fragments[name] = selections
+		default:
+			return nil, fmt.Errorf("unexpected %q", token.value)
+		}
+	}
+	if len(document.operations) == 0 {
+		return nil, fmt.Errorf("no operation")
+	}
+	return document, nil
+}
+
+// peek returns the current token
+func (p *gqlParser) peek() gqlToken {
+	return p.tokens[p.pos]
+}
+
+// next returns the current token and advances to the next one
+func (p *gqlParser) next() gqlToken {
+	token := p.tokens[p.pos]
+	if token.kind != gqlEOF {
+		p.pos++
+	}
+	return token
+}
+
+// isPunct reports whether the current token is the given punctuator
+func (p *gqlParser) isPunct(value string) bool {
+	token := p.peek()
+	return token.kind == gqlPunct && token.value == value
+}
+
+// expectPunct consumes the given punctuator
+func (p *gqlParser) expectPunct(value string) error {
+	if !p.isPunct(value) {
+		return fmt.Errorf("expected %q, got %q", value, p.peek().value)
+	}
+	p.pos++
+	return nil
+}
+
+// expectName consumes a name
+func (p *gqlParser) expectName() (string, error) {
+	token := p.next()
+	if token.kind != gqlName {
+		return "", fmt.Errorf("expected a name, got %q", token.value)
+	}
+	return token.value, nil
+}
+
+// operation parses an operation definition
+func (p *gqlParser) operation() (gqlOperation, error) {
+	operation := gqlOperation{kind: p.next().value}
+	if p.peek().kind == gqlName {
+		operation.name = p.next().value
+	}
+	// Variable definitions are not needed, skip them
+	if p.isPunct("(") {
+		if err := p.skipBalanced("(", ")"); err != nil {
+			return operation, err
+		}
+	}
+	if err := p.directives(); err != nil {
+		return operation, err
+	}
+	selections, err := p.selectionSet()
+	operation.selections = selections
+	return operation, err
+}
+
+// fragment parses a fragment definition
+func (p *gqlParser) fragment() (string, []gqlSelection, error) {
+	p.next()
+	name, err := p.expectName()
+	if err != nil {
+		return "", nil, err
+	}
+	if on, err := p.expectName(); err != nil || on != "on" {
+		return "", nil, fmt.Errorf("expected type condition of fragment %s", name)
+	}
+	if _, err := p.expectName(); err != nil {
+		return "", nil, err
+	}
+	if err := p.directives(); err != nil {
+		return "", nil, err
+	}
+	selections, err := p.selectionSet()
+	return name, selections, err
+}
+
+// selectionSet parses a selection set
+func (p *gqlParser) selectionSet() ([]gqlSelection, error) {
+	if err := p.expectPunct("{"); err != nil {
+		return nil, err
+	}
+	p.nesting++
+	defer func() { p.nesting-- }()
+	if p.nesting > maxGraphQLNesting {
+		return nil, fmt.Errorf("selection sets nested deeper than %d", maxGraphQLNesting)
+	}
+	var selections []gqlSelection
+	for !p.isPunct("}") {
+		if p.peek().kind == gqlEOF {
+			return nil, fmt.Errorf("unterminated selection set")
+		}
+		selection, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, selection)
+	}
+	p.pos++
+	return selections, nil
+}
+
+// selection parses a field, fragment spread or inline fragment
+func (p *gqlParser) selection() (gqlSelection, error) {
+	var selection gqlSelection
+	if p.isPunct("...") {
+		p.pos++
+		if token := p.peek(); token.kind == gqlName && token.value != "on" {
+			selection.spread = p.next().value
+			return selection, p.directives()
+		}
+		if p.peek().kind == gqlName {
+			p.pos++
+			if _, err := p.expectName(); err != nil {
+				return selection, err
+			}
+		}
+		if err := p.directives(); err != nil {
+			return selection, err
+		}
+		children, err := p.selectionSet()
+		selection.children = children
+		return selection, err
+	}
+
+	name, err := p.expectName()
+	if err != nil {
+		return selection, err
+	}
+	// The name before a colon is an alias
+	if p.isPunct(":") {
+		p.pos++
+		if name, err = p.expectName(); err != nil {
+			return selection, err
+		}
+	}
+	selection.field = name
+	if p.isPunct("(") {
+		if selection.limit, err = p.arguments(); err != nil {
+			return selection, err
+		}
+	}
+	if err := p.directives(); err != nil {
+		return selection, err
+	}
+	if p.isPunct("{") {
+		selection.children, err = p.selectionSet()
+	}
+	return selection, err
+}
+
+// arguments parses the arguments of a field, returning the value of its first, last or limit argument
+func (p *gqlParser) arguments() (interface{}, error) {
+	p.pos++
+	var limit interface{}
+	for !p.isPunct(")") {
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(":"); err != nil {
+			return nil, err
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		if name == "first" || name == "last" || name == "limit" {
+			limit = value
+		}
+	}
+	p.pos++
+	return limit, nil
+}
+
+// value parses an argument value, returning integers and variables and skipping the others
+func (p *gqlParser) value() (interface{}, error) {
+	token := p.next()
+	switch {
+	case token.kind == gqlPunct && token.value == "$":
+		name, err := p.expectName()
+		return gqlVariable(name), err
+	case token.kind == gqlNumber:
+		if n, err := strconv.ParseInt(token.value, 10, 64); err == nil {
+			return n, nil
+		}
+		return nil, nil
+	case token.kind == gqlName || token.kind == gqlString:
+		return nil, nil
+	case token.kind == gqlPunct && (token.value == "[" || token.value == "{"):
+		p.pos--
+		if token.value == "[" {
+			return nil, p.skipBalanced("[", "]")
+		}
+		return nil, p.skipBalanced("{", "}")
+	}
+	return nil, fmt.Errorf("unexpected %q in value", token.value)
+}
+
+// directives skips the directives at the current position
+func (p *gqlParser) directives() error {
+	for p.isPunct("@") {
+		p.pos++
+		if _, err := p.expectName(); err != nil {
+			return err
+		}
+		if p.isPunct("(") {
+			if _, err := p.arguments(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// skipBalanced skips the tokens from an opening punctuator to the matching closing one
+func (p *gqlParser) skipBalanced(open, close string) error {
+	depth := 0
+	for {
+		token := p.next()
+		switch {
+		case token.kind == gqlEOF:
+			return fmt.Errorf("expected %q", close)
+		case token.kind == gqlPunct && token.value == open:
+			depth++
+		case token.kind == gqlPunct && token.value == close:
+			depth--
+			if depth == 0 {
+				return nil
+			}
+		}
+	}
+}
+
+// maxGraphQLComplexity caps the measured complexity so multiplying nested limits cannot overflow
+const maxGraphQLComplexity = 1 << 40
+
+// gqlCost is the depth and complexity of a selection set
+type gqlCost struct {
+	depth      int
+	complexity int64
+}
+
+// gqlAnalyzer measures the depth and complexity of operations, expanding fragments once
+type gqlAnalyzer struct {
+	document  *gqlDocument
+	variables map[string]interface{}
+	measured  map[string]gqlCost
+	visiting  map[string]bool
+}
+
+// measure returns the depth and complexity of an operation. Each field costs 1, and the complexity of
+// the selections of a field with a first, last or limit argument is multiplied by its value.
+func (d *gqlDocument) measure(operation gqlOperation, variables map[string]interface{}) (gqlCost, error) {
+	analyzer := &gqlAnalyzer{
+		document:  d,
+		variables: variables,
+		measured:  make(map[string]gqlCost),
+		visiting:  make(map[string]bool),
+	}
+	return analyzer.selections(operation.selections)
+}
+
+// selections measures a selection set
+func (a *gqlAnalyzer) selections(selections []gqlSelection) (gqlCost, error) {
+	var cost gqlCost
+	for _, selection := range selections {
+		var child gqlCost
+		var err error
+		if selection.spread != "" {
+			child, err = a.fragment(selection.spread)
+		} else {
+			child, err = a.selections(selection.children)
+		}
+		if err != nil {
+			return cost, err
+		}
+
+		if selection.field == "" {
+			cost.depth = max(cost.depth, child.depth)
+			cost.complexity += child.complexity
+			continue
+		}
+		cost.depth = max(cost.depth, child.depth+1)
+		cost.complexity = min(cost.complexity+1+a.multiplier(selection.limit)*child.complexity, maxGraphQLComplexity)
+	}
+	return cost, nil
+}
+
+// fragment measures a fragment, reusing the result for further spreads of the same fragment
+func (a *gqlAnalyzer) fragment(name string) (gqlCost, error) {
+	if cost, ok := a.measured[name]; ok {
+		return cost, nil
+	}
+	selections, ok := a.document.fragments[name]
+	if !ok {
+		return gqlCost{}, fmt.Errorf("unknown fragment %s", name)
+	}
+	if a.visiting[name] {
+		return gqlCost{}, fmt.Errorf("fragment %s spreads itself", name)
+	}
+	a.visiting[name] = true
+	cost, err := a.selections(selections)
+	a.visiting[name] = false
+	if err == nil {
+		a.measured[name] = cost
+	}
+	return cost, err
+}
+
+// multiplier returns the value of a first, last or limit argument, resolving variables, or 1
+func (a *gqlAnalyzer) multiplier(limit interface{}) int64 {
+	if variable, ok := limit.(gqlVariable); ok {
+		limit = a.variables[string(variable)]
+	}
+	switch v := limit.(type) {
+	case int64:
+		return min(max(v, 1), 1<<20)
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return min(max(n, 1), 1<<20)
+		}
+	case float64:
+		return min(max(int64(v), 1), 1<<20)
+	}
+	return 1
+}
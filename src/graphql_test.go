@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestGraphQLMeasure tests the depth and complexity of parsed operations
+func TestGraphQLMeasure(t *testing.T) {
+	tests := []struct {
+		query      string
+		variables  map[string]interface{}
+		depth      int
+		complexity int64
+	}{
+		{`{ me { name } }`, nil, 2, 2},
+		{`query Users($n: Int = 5) { users(first: $n) { name friends(first: 2) { name } } }`, map[string]interface{}{"n": float64(10)}, 3, 1 + 10*(1+1+2*1)},
+		{`query { ...F } fragment F on Query { a { b { c } } }`, nil, 3, 3},
+		{`# comment
+		query Q { a(filter: {x: [1, 2]}, s: "}") @include(if: true) { ... on A { b } ... @skip(if: false) { c } } }`, nil, 2, 3},
+	}
+	for _, test := range tests {
+		document, err := parseGraphQL(test.query)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", test.query, err)
+		}
+		cost, err := document.measure(document.operations[0], test.variables)
+		if err != nil {
+			t.Fatalf("failed to measure %s: %v", test.query, err)
+		}
+		if cost.depth != test.depth || cost.complexity != test.complexity {
+			t.Errorf("%s: expected depth %d and complexity %d, got %d and %d", test.query, test.depth, test.complexity, cost.depth, cost.complexity)
+		}
+	}
+
+	// Fragment cycles and invalid documents are rejected
+	document, err := parseGraphQL(`{ ...A } fragment A on Q { ...B } fragment B on Q { ...A }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := document.measure(document.operations[0], nil); err == nil {
+		t.Error("expected a fragment cycle to be rejected")
+	}
+	for _, query := range []string{`{ a `, `query { a(x: ) }`, `"unterminated`, strings.Repeat("{a", 1000) + strings.Repeat("}", 1000)} {
+		if _, err := parseGraphQL(query); err == nil {
+			t.Errorf("expected %q to be rejected", query)
+		}
+	}
+}
+
+// TestGraphQLGuard tests that operations exceeding the limits are rejected before reaching the backend
+func TestGraphQLGuard(t *testing.T) {
+	persistedQuery := `query Me { me { name } }`
+	persistedFile := filepath.Join(t.TempDir(), "persisted.json")
+	data, _ := json.Marshal(map[string]string{queryHash(persistedQuery): persistedQuery})
+	if err := os.WriteFile(persistedFile, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var received string
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+		_, _ = io.WriteString(w, `{"data":{}}`)
+	}))
+	defer backendServer.Close()
+
+	config := GraphQLConfig{
+		Enabled:             true,
+		MaxDepth:            3,
+		MaxComplexity:       20,
+		OperationRateLimits: map[string]int{"Search": 1},
+		PersistedQueries:    persistedFile,
+	}
+	endpoint := Endpoint{Path: "/graphql", Backend: backendServer.URL}
+	guard := NewGraphQLGuard(config)
+	now := time.Now()
+	guard.now = func() time.Time { return now }
+	handler := guard.Middleware(endpoint, NewProxy(endpoint, false, nil).Handler())
+
+	post := func(body string) *httptest.ResponseRecorder {
+		received = ""
+		req := httptest.NewRequest("POST", "/graphql", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		expected int
+		code     string
+	}{
+		{"within limits", `{"query":"{ a { b } }"}`, http.StatusOK, ""},
+		{"too deep", `{"query":"{ a { b { c { d } } } }"}`, http.StatusBadRequest, "QUERY_TOO_DEEP"},
+		{"too complex", `{"query":"query($n: Int) { a(first: $n) { b } }","variables":{"n":100}}`, http.StatusBadRequest, "QUERY_TOO_COMPLEX"},
+		{"invalid query", `{"query":"{ a { "}`, http.StatusBadRequest, "GRAPHQL_PARSE_FAILED"},
+		{"batched too deep", `[{"query":"{ a }"},{"query":"{ a { b { c { d } } } }"}]`, http.StatusBadRequest, "QUERY_TOO_DEEP"},
+		{"rate limited operation", `{"query":"query Search { search { id } }"}`, http.StatusOK, ""},
+		{"rate limited operation again", `{"query":"query Search { search { id } }"}`, http.StatusTooManyRequests, "RATE_LIMITED"},
+	}
+	for _, test := range tests {
+		rr := post(test.body)
+		if rr.Code != test.expected {
+			t.Errorf("%s: expected status %d, got %d: %s", test.name, test.expected, rr.Code, rr.Body.String())
+		}
+		if test.code != "" {
+			if !strings.Contains(rr.Body.String(), `"code":"`+test.code+`"`) {
+				t.Errorf("%s: expected error code %s, got %s", test.name, test.code, rr.Body.String())
+			}
+			if received != "" {
+				t.Errorf("%s: expected the backend not to be called", test.name)
+			}
+		}
+	}
+
+	// The rate limit recovers over time
+	now = now.Add(time.Minute)
+	rr := post(`{"query":"query Search { search { id } }"}`)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected the rate limit to recover, got %d", rr.Code)
+	}
+	if limit, remaining, reset := rr.Header().Get("RateLimit-Limit"), rr.Header().Get("RateLimit-Remaining"),
+		rr.Header().Get("RateLimit-Reset"); limit != "1" || remaining != "0" || reset != "60" {
+		t.Errorf("expected RateLimit headers 1, 0 and 60, got %q, %q and %q", limit, remaining, reset)
+	}
+	if rr := post(`{"query":"{ a { b } }"}`); rr.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("expected no RateLimit headers for operations without a rate limit")
+	}
+
+	// Persisted queries are expanded for the backend
+	rr = post(`{"extensions":{"persistedQuery":{"version":1,"sha256Hash":"` + queryHash(persistedQuery) + `"}}}`)
+	if rr.Code != http.StatusOK || !strings.Contains(received, `"query":"query Me { me { name } }"`) {
+		t.Errorf("expected the persisted query to be expanded, got %d and %s", rr.Code, received)
+	}
+
+	// Only persisted queries are allowed with persisted_queries_only
+	config.PersistedQueriesOnly = true
+	handler = NewGraphQLGuard(config).Middleware(endpoint, NewProxy(endpoint, false, nil).Handler())
+	if rr := post(`{"query":"{ a }"}`); rr.Code != http.StatusForbidden {
+		t.Errorf("expected a query that is not persisted to be rejected, got %d", rr.Code)
+	}
+	if rr := post(`{"query":"query Me { me { name } }"}`); rr.Code != http.StatusOK {
+		t.Errorf("expected a persisted query to be allowed, got %d", rr.Code)
+	}
+}
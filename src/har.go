@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Default traffic recording settings
+const (
+	defaultRecordingMaxEntries    = 1000
+	defaultRecordingFlushInterval = 5000
+)
+
+// RecordingConfig represents the configuration of the traffic recording
+type RecordingConfig struct {
+	Enabled bool `json:"enabled"`
+	// File is the HAR file the recorded traffic is written to
+	File string `json:"file"`
+	// SampleRate is the share of requests recorded, between 0 and 1 (default 1)
+	SampleRate float64 `json:"sample_rate"`
+	// MaxEntries is the maximum number of recorded requests, the oldest ones are dropped first
+	MaxEntries int `json:"max_entries"`
+	// FlushInterval is the interval in milliseconds at which the HAR file is rewritten
+	FlushInterval int `json:"flush_interval"`
+}
+
+// HAR is an HTTP Archive (HAR 1.2) document
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog is the root of an HTTP Archive
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+// HARCreator identifies the application that created an HTTP Archive
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry is a recorded request/response pair
+type HAREntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+// HARRequest is the request of a HAR entry
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	Cookies     []HARNameValue `json:"cookies"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARResponse is the response of a HAR entry
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []HARNameValue `json:"headers"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARNameValue is a header or query parameter of a HAR entry
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARPostData is the request body of a HAR entry
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+// HARContent is the response body of a HAR entry
+type HARContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+// HARTimings are the timings of a HAR entry in milliseconds
+type HARTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// harNameValues converts headers or query parameters to HAR name/value pairs
+func harNameValues(values map[string][]string) []HARNameValue {
+	pairs := []HARNameValue{}
+	for name, list := range values {
+		for _, value := range list {
+			pairs = append(pairs, HARNameValue{Name: name, Value: value})
+		}
+	}
+	return pairs
+}
+
+// NewHAREntry converts a captured exchange to a HAR entry
+func NewHAREntry(exchange CapturedExchange, r *http.Request, startTime time.Time, duration time.Duration) HAREntry {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	milliseconds := float64(duration.Microseconds()) / 1000
+
+	entry := HAREntry{
+		StartedDateTime: startTime.UTC().Format(time.RFC3339Nano),
+		Time:            milliseconds,
+		Request: HARRequest{
+			Method:      exchange.Request.Method,
+			URL:         scheme + "://" + r.Host + r.URL.RequestURI(),
+			HTTPVersion: r.Proto,
+			Headers:     harNameValues(exchange.Request.Headers),
+			QueryString: harNameValues(r.URL.Query()),
+			Cookies:     []HARNameValue{},
+			HeadersSize: -1,
+			BodySize:    len(exchange.Request.Body),
+		},
+		Response: HARResponse{
+			Status:      exchange.Response.StatusCode,
+			StatusText:  http.StatusText(exchange.Response.StatusCode),
+			HTTPVersion: r.Proto,
+			Headers:     harNameValues(exchange.Response.Headers),
+			Cookies:     []HARNameValue{},
+			Content: HARContent{
+				Size:     len(exchange.Response.Body),
+				MimeType: exchange.Response.Headers.Get("Content-Type"),
+				Text:     exchange.Response.Body,
+			},
+			RedirectURL: exchange.Response.Headers.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    len(exchange.Response.Body),
+		},
+		Timings: HARTimings{Wait: milliseconds},
+		Comment: exchange.Route,
+	}
+	if exchange.Request.Body != "" {
+		entry.Request.PostData = &HARPostData{
+			MimeType: exchange.Request.Headers.Get("Content-Type"),
+			Text:     exchange.Request.Body,
+		}
+	}
+	return entry
+}
+
+// TrafficRecorder records sampled request/response pairs to a HAR file
+type TrafficRecorder struct {
+	config  RecordingConfig
+	mu      sync.Mutex
+	entries []HAREntry
+	dirty   bool
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewTrafficRecorder creates a new TrafficRecorder and starts writing the HAR file periodically
+func NewTrafficRecorder(config RecordingConfig) (*TrafficRecorder, error) {
+	if config.File == "" {
+		return nil, fmt.Errorf("recording file is required")
+	}
+	if config.SampleRate < 0 || config.SampleRate > 1 {
+		return nil, fmt.Errorf("invalid recording sample rate: %v (must be between 0 and 1)", config.SampleRate)
+	}
+	if config.SampleRate == 0 {
+		config.SampleRate = 1
+	}
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = defaultRecordingMaxEntries
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaultRecordingFlushInterval
+	}
+
+	recorder := &TrafficRecorder{
+		config: config,
+		done:   make(chan struct{}),
+	}
+
+	recorder.wg.Add(1)
+	go func() {
+		defer recorder.wg.Done()
+		ticker := time.NewTicker(time.Duration(config.FlushInterval) * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := recorder.Flush(); err != nil {
+					LogError("Failed to write recorded traffic", err, map[string]interface{}{
+						"file": config.File,
+					})
+				}
+			case <-recorder.done:
+				return
+			}
+		}
+	}()
+
+	return recorder, nil
+}
+
+// Middleware records the sampled requests of an endpoint
+func (t *TrafficRecorder) Middleware(endpoint Endpoint, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if t.config.SampleRate < 1 && rand.Float64() >= t.config.SampleRate {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		exchange, startTime, duration := captureExchange(endpoint, w, r, next)
+		t.add(NewHAREntry(exchange, r, startTime, duration))
+	})
+}
+
+// add stores a HAR entry, dropping the oldest entries beyond the maximum
+func (t *TrafficRecorder) add(entry HAREntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries = append(t.entries, entry)
+	if len(t.entries) > t.config.MaxEntries {
+		t.entries = t.entries[len(t.entries)-t.config.MaxEntries:]
+	}
+	t.dirty = true
+}
+
+// Flush writes the recorded traffic to the HAR file if it changed since the last write
+func (t *TrafficRecorder) Flush() error {
+	t.mu.Lock()
+	if !t.dirty {
+		t.mu.Unlock()
+		return nil
+	}
+	har := HAR{Log: HARLog{
+		Version: "1.2",
+		Creator: HARCreator{Name: "SurfBoard", Version: "1.0"},
+		Entries: append([]HAREntry{}, t.entries...),
+	}}
+	t.dirty = false
+	t.mu.Unlock()
+
+	data, err := json.MarshalIndent(har, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode HAR: %w", err)
+	}
+
+	// Write to a temporary file first so readers never see a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(t.config.File), ".surfboard-har-*")
+	if err != nil {
+		return fmt.Errorf("failed to create HAR file: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write HAR file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write HAR file: %w", err)
+	}
+	return os.Rename(tmp.Name(), t.config.File)
+}
+
+// Close stops the periodic writes and writes the remaining recorded traffic
+func (t *TrafficRecorder) Close() error {
+	close(t.done)
+	t.wg.Wait()
+	return t.Flush()
+}
+
+// LoadHAR reads an HTTP Archive from a file
+func LoadHAR(path string) (*HAR, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HAR file: %w", err)
+	}
+	var har HAR
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, fmt.Errorf("failed to parse HAR file: %w", err)
+	}
+	return &har, nil
+}
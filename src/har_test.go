@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestTrafficRecordingAndReplay tests recording traffic to a HAR file and replaying it against another backend
+func TestTrafficRecordingAndReplay(t *testing.T) {
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			w.WriteHeader(http.StatusCreated)
+		}
+		_, _ = w.Write([]byte("OK"))
+	}))
+	defer backendServer.Close()
+
+	file := filepath.Join(t.TempDir(), "traffic.har")
+	recorder, err := NewTrafficRecorder(RecordingConfig{Enabled: true, File: file})
+	if err != nil {
+		t.Fatalf("Failed to create TrafficRecorder: %v", err)
+	}
+
+	gateway := NewGateway(Config{
+		Endpoints: []Endpoint{{Path: "/api/users", Backend: backendServer.URL}},
+	}, nil)
+	gateway.Use(recorder.Middleware)
+	gateway.RegisterEndpoints()
+
+	gateway.mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/users?page=2", nil))
+	req := httptest.NewRequest("POST", "/api/users", strings.NewReader(`{"name": "test"}`))
+	req.Header.Set("Content-Type", "application/json")
+	gateway.mux.ServeHTTP(httptest.NewRecorder(), req)
+
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	har, err := LoadHAR(file)
+	if err != nil {
+		t.Fatalf("LoadHAR() error = %v", err)
+	}
+	if len(har.Log.Entries) != 2 {
+		t.Fatalf("Expected 2 recorded entries, got %d", len(har.Log.Entries))
+	}
+	if entry := har.Log.Entries[0]; entry.Request.URL != "http://example.com/api/users?page=2" || entry.Response.Status != http.StatusOK {
+		t.Errorf("Unexpected first entry %+v", entry)
+	}
+	if entry := har.Log.Entries[1]; entry.Request.PostData == nil || entry.Request.PostData.Text != `{"name": "test"}` ||
+		entry.Response.Status != http.StatusCreated {
+		t.Errorf("Unexpected second entry %+v", entry)
+	}
+
+	// Replay against a target that only accepts the GET request unchanged
+	var replayedBody string
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer replay" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method == "POST" {
+			body, _ := io.ReadAll(r.Body)
+			replayedBody = string(body)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer targetServer.Close()
+
+	result, err := Replay(har, targetServer.URL, http.Header{"Authorization": {"Bearer replay"}}, http.DefaultClient)
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if result != (ReplayResult{Total: 2, Matched: 1, Mismatched: 1}) {
+		t.Errorf("Unexpected replay result %+v", result)
+	}
+	if replayedBody != `{"name": "test"}` {
+		t.Errorf("Expected the recorded body to be replayed, got %q", replayedBody)
+	}
+}
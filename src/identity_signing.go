@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultSignatureHeader is the header carrying the signature of the identity headers
+const defaultSignatureHeader = "X-Gateway-Signature"
+
+// IdentitySigningConfig represents the signing of the identity headers the gateway forwards to the backends
+type IdentitySigningConfig struct {
+	// Secret is the shared secret the headers are signed with (HMAC-SHA256)
+	Secret string `json:"secret"`
+	// PrivateKeyFile is the PEM file of the PKCS #8 Ed25519 key the headers are signed with instead, so
+	// backends only need the public key
+	PrivateKeyFile string `json:"private_key_file"`
+	// Headers are further headers to sign in addition to the identity headers set by the gateway. Like those,
+	// they are removed from the client requests, so only the authentication may set them.
+	Headers []string `json:"headers"`
+	// SignatureHeader is the header the signature is sent in (default X-Gateway-Signature)
+	SignatureHeader string `json:"signature_header"`
+}
+
+// enabled checks whether a signing key is configured
+func (c IdentitySigningConfig) enabled() bool {
+	return c.Secret != "" || c.PrivateKeyFile != ""
+}
+
+// IdentitySigner signs the identity headers of the requests forwarded to the backends, so they can verify
+// that the headers were set by the gateway and not by another internal client
+type IdentitySigner struct {
+	config     IdentitySigningConfig
+	privateKey ed25519.PrivateKey
+	// headers are the identity headers set for all endpoints, e.g. the OIDC identity headers
+	headers []string
+	now     func() time.Time
+}
+
+// NewIdentitySigner creates a new IdentitySigner signing the given identity headers of all endpoints in
+// addition to the claim headers of each endpoint
+func NewIdentitySigner(config IdentitySigningConfig, headers []string) (*IdentitySigner, error) {
+	if config.Secret != "" && config.PrivateKeyFile != "" {
+		return nil, errors.New("identity signing secret and private_key_file are mutually exclusive")
+	}
+	if config.SignatureHeader == "" {
+		config.SignatureHeader = defaultSignatureHeader
+	}
+	s := &IdentitySigner{
+		config:  config,
+		headers: append(append([]string(nil), headers...), config.Headers...),
+		now:     time.Now,
+	}
+	if config.PrivateKeyFile != "" {
+		data, err := os.ReadFile(config.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read identity signing key: %w", err)
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("identity signing key is not PEM encoded")
+		}
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse identity signing key: %w", err)
+		}
+		privateKey, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("identity signing key is not an Ed25519 key")
+		}
+		s.privateKey = privateKey
+	}
+	return s, nil
+}
+
+// authenticationHeaders returns the identity headers the authentication middlewares set for all endpoints:
+// the ext_authz upstream headers and the OIDC identity headers
+func authenticationHeaders(config Config) []string {
+	var headers []string
+	if config.ExtAuthz.Enabled {
+		headers = append(headers, config.ExtAuthz.UpstreamHeaders...)
+	}
+	if config.OIDC.Enabled {
+		identityHeaders := config.OIDC.IdentityHeaders
+		if len(identityHeaders) == 0 {
+			identityHeaders = defaultOIDCIdentityHeaders
+		}
+		for _, header := range identityHeaders {
+			headers = append(headers, header)
+		}
+	}
+	return headers
+}
+
+// signedHeaders returns the lower case, sorted and deduplicated headers signed for an endpoint
+func (s *IdentitySigner) signedHeaders(endpoint Endpoint) []string {
+	return signedIdentityHeaders(s.headers, endpoint)
+}
+
+// signedIdentityHeaders returns the lower case, sorted and deduplicated headers signed for an endpoint: the
+// given identity headers of all endpoints and the claim headers of the endpoint
+func signedIdentityHeaders(identityHeaders []string, endpoint Endpoint) []string {
+	names := append([]string(nil), identityHeaders...)
+	for _, header := range endpoint.ClaimHeaders {
+		names = append(names, header)
+	}
+	if endpoint.AuthOptional {
+		names = append(names, AuthHeader)
+	}
+
+	seen := make(map[string]bool)
+	headers := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if !seen[name] {
+			seen[name] = true
+			headers = append(headers, name)
+		}
+	}
+	sort.Strings(headers)
+	return headers
+}
+
+// signingInput returns the signed string: the timestamp, the method and a name:value line per header, with
+// absent headers signed as empty so a backend also notices removed headers
+func signingInput(timestamp int64, method string, headers []string, values http.Header) string {
+	var b strings.Builder
+	b.WriteString(strconv.FormatInt(timestamp, 10))
+	b.WriteString("\n")
+	b.WriteString(method)
+	for _, header := range headers {
+		b.WriteString("\n")
+		b.WriteString(header)
+		b.WriteString(":")
+		b.WriteString(strings.Join(values.Values(header), ","))
+	}
+	return b.String()
+}
+
+// Sign sets the signature header of a request over the given headers
+func (s *IdentitySigner) Sign(r *http.Request, headers []string) {
+	timestamp := s.now().Unix()
+	input := []byte(signingInput(timestamp, r.Method, headers, r.Header))
+	var signature []byte
+	if s.privateKey != nil {
+		signature = ed25519.Sign(s.privateKey, input)
+	} else {
+		signature = signHS256(input, s.config.Secret)
+	}
+	r.Header.Set(s.config.SignatureHeader, fmt.Sprintf("t=%d,headers=%s,sig=%s",
+		timestamp, strings.Join(headers, ";"), base64.RawURLEncoding.EncodeToString(signature)))
+}
+
+// Middleware signs the identity headers of the requests once all other middlewares have set them,
+// replacing any signature header sent by the client
+func (s *IdentitySigner) Middleware(endpoint Endpoint, next http.Handler) http.Handler {
+	headers := s.signedHeaders(endpoint)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Sign(r, headers)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signedRequest serves a request through the middleware of a signer and returns the forwarded headers
+func signedRequest(t *testing.T, signer *IdentitySigner, endpoint Endpoint, header http.Header) http.Header {
+	t.Helper()
+	var forwarded http.Header
+	handler := signer.Middleware(endpoint, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Clone()
+	}))
+	req := httptest.NewRequest("GET", "/api/orders", nil)
+	req.Header = header
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	return forwarded
+}
+
+// parseSignature splits a signature header into its parameters
+func parseSignature(t *testing.T, value string) map[string]string {
+	t.Helper()
+	params := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		key, param, ok := strings.Cut(part, "=")
+		if !ok {
+			t.Fatalf("malformed signature header %q", value)
+		}
+		params[key] = param
+	}
+	return params
+}
+
+// TestIdentitySigningHMAC tests that the identity headers of an endpoint are signed with the shared secret
+func TestIdentitySigningHMAC(t *testing.T) {
+	signer, err := NewIdentitySigner(IdentitySigningConfig{Secret: "secret"}, []string{"X-Auth-Email"})
+	if err != nil {
+		t.Fatalf("NewIdentitySigner() error = %v", err)
+	}
+	signer.now = func() time.Time { return time.Unix(1700000000, 0) }
+	endpoint := Endpoint{Path: "/api/", ClaimHeaders: map[string]string{"sub": "X-User-ID"}}
+
+	forwarded := signedRequest(t, signer, endpoint, http.Header{
+		"X-User-Id":           {"user-1"},
+		"X-Gateway-Signature": {"t=1,headers=,sig=forged"},
+	})
+	params := parseSignature(t, forwarded.Get("X-Gateway-Signature"))
+	if params["t"] != "1700000000" || params["headers"] != "x-auth-email;x-user-id" {
+		t.Fatalf("unexpected signature parameters %v", params)
+	}
+	expected := signHS256([]byte("1700000000\nGET\nx-auth-email:\nx-user-id:user-1"), "secret")
+	signature, _ := base64.RawURLEncoding.DecodeString(params["sig"])
+	if !hmac.Equal(signature, expected) {
+		t.Errorf("signature does not verify")
+	}
+}
+
+// TestIdentitySigningEd25519 tests that the identity headers are signed with an Ed25519 key
+func TestIdentitySigningEd25519(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "signing.pem")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := NewIdentitySigner(IdentitySigningConfig{PrivateKeyFile: keyFile, SignatureHeader: "X-Signature"}, nil)
+	if err != nil {
+		t.Fatalf("NewIdentitySigner() error = %v", err)
+	}
+	forwarded := signedRequest(t, signer, Endpoint{Path: "/api/", AuthOptional: true}, http.Header{"X-Auth": {"anonymous"}})
+	params := parseSignature(t, forwarded.Get("X-Signature"))
+	signature, _ := base64.RawURLEncoding.DecodeString(params["sig"])
+	if !ed25519.Verify(publicKey, []byte(params["t"]+"\nGET\nx-auth:anonymous"), signature) {
+		t.Errorf("signature does not verify: %v", params)
+	}
+
+	if _, err := NewIdentitySigner(IdentitySigningConfig{Secret: "secret", PrivateKeyFile: keyFile}, nil); err == nil {
+		t.Error("expected a secret and a private key to be rejected")
+	}
+}
+
+// TestIdentitySigningForgedHeaders tests that identity headers sent by a client to an endpoint whose
+// authentication does not set them are removed before they are signed
+func TestIdentitySigningForgedHeaders(t *testing.T) {
+	forwarded := make(chan http.Header, 1)
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded <- r.Header.Clone()
+	}))
+	defer backendServer.Close()
+
+	config := Config{
+		OIDC:            OIDCConfig{Enabled: true, IdentityHeaders: map[string]string{"email": "X-User-Email"}},
+		IdentitySigning: IdentitySigningConfig{Secret: "secret", Headers: []string{"X-Tenant"}},
+		Endpoints:       []Endpoint{{Path: "/api/", Backend: backendServer.URL}},
+	}
+	signer, err := NewIdentitySigner(config.IdentitySigning, authenticationHeaders(config))
+	if err != nil {
+		t.Fatalf("NewIdentitySigner() error = %v", err)
+	}
+	signer.now = func() time.Time { return time.Unix(1700000000, 0) }
+	gateway := NewGateway(config, nil)
+	gateway.Use(signer.Middleware)
+	gateway.RegisterEndpoints()
+
+	req := httptest.NewRequest("GET", "/api/orders", nil)
+	req.Header.Set("X-User-Email", "admin@example.com")
+	req.Header.Set("X-Tenant", "other-tenant")
+	gateway.mux.ServeHTTP(httptest.NewRecorder(), req)
+
+	header := <-forwarded
+	if header.Get("X-User-Email") != "" || header.Get("X-Tenant") != "" {
+		t.Errorf("Expected the forged identity headers to be removed, got %q and %q", header.Get("X-User-Email"), header.Get("X-Tenant"))
+	}
+	params := parseSignature(t, header.Get("X-Gateway-Signature"))
+	expected := signHS256([]byte("1700000000\nGET\nx-tenant:\nx-user-email:"), "secret")
+	signature, _ := base64.RawURLEncoding.DecodeString(params["sig"])
+	if params["headers"] != "x-tenant;x-user-email" || !hmac.Equal(signature, expected) {
+		t.Errorf("Expected the signature over the empty identity headers, got %v", params)
+	}
+}
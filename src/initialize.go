@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Initialize validates all endpoints, listeners and the admin API and registers the routes of the gateway: the
+// system routes (health, readiness, metrics and admin) first so endpoints cannot shadow them, then the endpoints,
+// the OpenAPI document and the default backend. It returns an error instead of serving a partial route table if
+// an endpoint, a listener or the admin API is invalid or a route cannot be registered.
+func (g *Gateway) Initialize() error {
+	// Validate all endpoints before registering any route
+	var errs []error
+	for _, endpoint := range g.config.Endpoints {
+		if err := g.validateEndpoint(endpoint); err != nil {
+			errs = append(errs, fmt.Errorf("invalid endpoint %s%s: %w", endpoint.Host, endpoint.Path, err))
+		}
+	}
+	for _, listener := range g.config.Listeners {
+		if err := validatePassthrough(listener); err != nil {
+			errs = append(errs, fmt.Errorf("invalid listener %s: %w", listener.ListenerName(), err))
+		}
+	}
+	if err := validateAdmin(g.config.Admin); err != nil {
+		errs = append(errs, fmt.Errorf("invalid admin API: %w", err))
+	}
+	if g.config.DefaultBackend != "" {
+		if err := validateBackendURL(g.config.DefaultBackend); err != nil {
+			errs = append(errs, fmt.Errorf("invalid default backend: %w", err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	g.RegisterHealthCheck()
+	g.RegisterReadinessCheck()
+	g.RegisterMetricsEndpoint()
+	g.RegisterAdminEndpoints()
+	g.RegisterEndpoints()
+	g.RegisterOpenAPI()
+	g.RegisterDefaultBackend()
+	return errors.Join(g.registerErrs...)
+}
+
+// validateEndpoint checks the path, pagination style, masking rules, status mappings, JWT validation, rate
+// limits, upgrade protocols, backend URLs, egress proxy, listeners and scheduled changes of an endpoint
+func (g *Gateway) validateEndpoint(endpoint Endpoint) error {
+	if _, err := compiledPathTemplate(endpoint.Path); err != nil {
+		return err
+	}
+	if err := validatePathMode(endpoint); err != nil {
+		return err
+	}
+	if err := validatePagination(endpoint.Pagination); err != nil {
+		return err
+	}
+	if err := validateMasking(endpoint.Masking); err != nil {
+		return err
+	}
+	if err := validateStatusMappings(endpoint.StatusMappings); err != nil {
+		return err
+	}
+	if err := validateJWTAuth(endpoint, g.config.JWT); err != nil {
+		return err
+	}
+	if err := validateRateLimit(endpoint.RateLimit); err != nil {
+		return err
+	}
+	if err := validateUpgrades(endpoint.Upgrades); err != nil {
+		return err
+	}
+
+	backends := endpointBackends(endpoint)
+	for _, change := range endpoint.Schedule {
+		if _, err := time.Parse(time.RFC3339, change.EffectiveFrom); err != nil {
+			return fmt.Errorf("invalid scheduled change time %q: %w", change.EffectiveFrom, err)
+		}
+		backends = append(backends, endpointBackends(Endpoint{Backend: change.Backend, Backends: change.Backends})...)
+	}
+	for _, backend := range backends {
+		if err := validateBackendURL(backend); err != nil {
+			return err
+		}
+	}
+
+	if _, err := newTransport(endpoint); err != nil {
+		return err
+	}
+	for _, name := range endpoint.Listeners {
+		if _, ok := g.listenerMuxes[name]; !ok {
+			return fmt.Errorf("unknown listener %q", name)
+		}
+		for _, listener := range g.config.Listeners {
+			if listener.ListenerName() == name && listener.Passthrough.enabled() {
+				return fmt.Errorf("listener %q routes TLS connections and serves no endpoints", name)
+			}
+		}
+	}
+	return nil
+}
+
+// validateBackendURL checks that a backend URL is an absolute HTTP or HTTPS URL
+func validateBackendURL(backend string) error {
+	backendURL, err := url.Parse(backend)
+	if err != nil {
+		return fmt.Errorf("invalid backend URL %q: %w", backend, err)
+	}
+	if (backendURL.Scheme != "http" && backendURL.Scheme != "https") || backendURL.Host == "" {
+		return fmt.Errorf("invalid backend URL %q: must be an absolute http or https URL", backend)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestInitialize tests that Initialize registers the system routes and the endpoints
+func TestInitialize(t *testing.T) {
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("backend"))
+	}))
+	defer backendServer.Close()
+
+	gateway := NewGateway(Config{
+		Endpoints: []Endpoint{{Path: "/api/", Backend: backendServer.URL}},
+	}, nil)
+	if err := gateway.Initialize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for path, expected := range map[string]int{"/health": http.StatusOK, "/ready": http.StatusOK, "/api/a": http.StatusOK} {
+		rr := httptest.NewRecorder()
+		gateway.mux.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != expected {
+			t.Errorf("expected status %d for %s, got %d", expected, path, rr.Code)
+		}
+	}
+}
+
+// TestInitializeErrors tests that Initialize fails on invalid endpoints and routes that cannot be registered
+func TestInitializeErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		expected string
+	}{
+		{
+			name:     "relative backend URL",
+			config:   Config{Endpoints: []Endpoint{{Path: "/api/", Backend: "localhost:3000"}}},
+			expected: "invalid endpoint /api/: invalid backend URL",
+		},
+		{
+			name:     "unknown listener",
+			config:   Config{Endpoints: []Endpoint{{Path: "/api/", Backend: "http://localhost:3000", Listeners: []string{"internal"}}}},
+			expected: `unknown listener "internal"`,
+		},
+		{
+			name: "invalid scheduled change",
+			config: Config{Endpoints: []Endpoint{{Path: "/api/", Backend: "http://localhost:3000",
+				Schedule: []ScheduledChange{{EffectiveFrom: "tomorrow", Backend: "http://localhost:3001"}}}}},
+			expected: "invalid scheduled change time",
+		},
+		{
+			name:     "invalid default backend",
+			config:   Config{DefaultBackend: "ftp://legacy"},
+			expected: "invalid default backend",
+		},
+		{
+			name:     "admin API without token",
+			config:   Config{Admin: AdminConfig{Enabled: true}},
+			expected: "admin token is required",
+		},
+		{
+			name:     "shadowed system route",
+			config:   Config{Endpoints: []Endpoint{{Path: "/health", Backend: "http://localhost:3000"}}},
+			expected: "failed to register route /health",
+		},
+		{
+			name: "duplicate route",
+			config: Config{Endpoints: []Endpoint{
+				{Path: "/api/", Method: "GET", Backend: "http://localhost:3000"},
+				{Path: "/api/", Method: "POST", Backend: "http://localhost:3001"},
+			}},
+			expected: "failed to register route /api/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewGateway(tt.config, nil).Initialize()
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("expected an error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
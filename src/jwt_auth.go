@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultJWTLeeway is the default clock skew in milliseconds tolerated for the exp and nbf claims
+const defaultJWTLeeway = 30000
+
+// AuthHeader flags the requests forwarded without credentials to the endpoints with auth_optional
+const AuthHeader = "X-Auth"
+
+// JWTConfig represents the validation of the bearer tokens of the endpoints with jwt_auth
+type JWTConfig struct {
+	Enabled bool `json:"enabled"`
+	// Issuer is the expected iss claim, not checked if empty
+	Issuer string `json:"issuer"`
+	// Audiences are the accepted aud claims, not checked if empty
+	Audiences []string `json:"audiences"`
+	// JWKSURL is the URL of the key set the RS256 signed tokens are verified with
+	JWKSURL string `json:"jwks_url"`
+	// Secret is the shared secret the HS256 signed tokens are verified with
+	Secret string `json:"secret"`
+	// Leeway is the clock skew in milliseconds tolerated for the exp and nbf claims (default 30000)
+	Leeway int `json:"leeway"`
+	// TokenExchange replaces the caller token with an internal token before the request is forwarded
+	TokenExchange TokenExchangeConfig `json:"token_exchange"`
+}
+
+// jwtClaimsKey is the context key for the validated token claims of a request
+type jwtClaimsKey struct{}
+
+// JWTClaimsFromContext returns the validated token claims attached to the request context, if any
+func JWTClaimsFromContext(ctx context.Context) (map[string]interface{}, bool) {
+	claims, ok := ctx.Value(jwtClaimsKey{}).(map[string]interface{})
+	return claims, ok
+}
+
+// JWTAuth validates the bearer tokens of the endpoints with jwt_auth
+type JWTAuth struct {
+	config    JWTConfig
+	keys      *jwksCache
+	exchanger *TokenExchanger
+	now       func() time.Time
+}
+
+// NewJWTAuth creates a new JWTAuth
+func NewJWTAuth(config JWTConfig) (*JWTAuth, error) {
+	if config.JWKSURL == "" && config.Secret == "" {
+		return nil, errors.New("JWT jwks_url or secret is required")
+	}
+	if config.Leeway <= 0 {
+		config.Leeway = defaultJWTLeeway
+	}
+
+	a := &JWTAuth{config: config, now: time.Now}
+	client := &http.Client{Timeout: 10 * time.Second}
+	if config.JWKSURL != "" {
+		a.keys = &jwksCache{url: config.JWKSURL, client: client, now: func() time.Time { return a.now() }}
+	}
+	if config.TokenExchange.Mode != "" {
+		exchanger, err := NewTokenExchanger(config.TokenExchange, func() time.Time { return a.now() })
+		if err != nil {
+			return nil, err
+		}
+		a.exchanger = exchanger
+	}
+	return a, nil
+}
+
+// bearerToken returns the bearer token of the Authorization header of a request
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// Verify verifies the signature, expiry, issuer and audience of a token and returns its claims. Tokens must
+// be signed with RS256 when a key set is configured or with HS256 when a secret is.
+func (a *JWTAuth) Verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.New("malformed token header")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, errors.New("malformed token header")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed token signature")
+	}
+
+	// Only accept the algorithm of the configured key, so a public key is never used as an HMAC secret
+	signed := []byte(parts[0] + "." + parts[1])
+	switch {
+	case header.Alg == "RS256" && a.keys != nil:
+		key, err := a.keys.key(header.Kid)
+		if err != nil {
+			return nil, err
+		}
+		digest := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return nil, errors.New("invalid token signature")
+		}
+	case header.Alg == "HS256" && a.config.Secret != "":
+		if !hmac.Equal(signHS256(signed, a.config.Secret), signature) {
+			return nil, errors.New("invalid token signature")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported token algorithm: %s", header.Alg)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("malformed token payload")
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errors.New("malformed token payload")
+	}
+
+	now := a.now()
+	leeway := time.Duration(a.config.Leeway) * time.Millisecond
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, errors.New("token without expiry")
+	}
+	if now.Add(-leeway).Unix() >= int64(exp) {
+		return nil, errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(leeway).Unix() < int64(nbf) {
+		return nil, errors.New("token not valid yet")
+	}
+	if a.config.Issuer != "" && claims["iss"] != a.config.Issuer {
+		return nil, fmt.Errorf("unexpected token issuer: %v", claims["iss"])
+	}
+	if len(a.config.Audiences) > 0 {
+		accepted := false
+		for _, audience := range a.config.Audiences {
+			accepted = accepted || audienceContains(claims["aud"], audience)
+		}
+		if !accepted {
+			return nil, errors.New("token audience mismatch")
+		}
+	}
+	return claims, nil
+}
+
+// signHS256 returns the HMAC-SHA256 signature of a signing input
+func signHS256(signed []byte, secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(signed)
+	return mac.Sum(nil)
+}
+
+// Middleware rejects the requests to the endpoints with jwt_auth without a valid bearer token with 401. The
+// claims of valid tokens are attached to the request context and set in the claim headers of the endpoint.
+// With auth_optional, requests without credentials are forwarded flagged as anonymous instead, while invalid
+// credentials are still rejected.
+func (a *JWTAuth) Middleware(endpoint Endpoint, next http.Handler) http.Handler {
+	if !endpoint.JWTAuth {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Clients must not be able to send the claim headers or the anonymous flag themselves
+		for _, header := range endpoint.ClaimHeaders {
+			r.Header.Del(header)
+		}
+		r.Header.Del(AuthHeader)
+
+		token, ok := bearerToken(r)
+		if !ok && endpoint.AuthOptional && r.Header.Get("Authorization") == "" {
+			r.Header.Set(AuthHeader, "anonymous")
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		claims, err := a.Verify(token)
+		if err != nil {
+			LogAudit("Request rejected by JWT validation", map[string]interface{}{
+				"method":      r.Method,
+				"path":        r.URL.Path,
+				"route":       endpoint.Path,
+				"reason":      err.Error(),
+				"remote_addr": r.RemoteAddr,
+				"user_agent":  r.UserAgent(),
+			})
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		for claim, header := range endpoint.ClaimHeaders {
+			if value := claimHeaderValue(claims[claim]); value != "" {
+				r.Header.Set(header, value)
+			}
+		}
+		next.ServeHTTP(w, withAuthenticatedCaller(r.WithContext(context.WithValue(r.Context(), jwtClaimsKey{}, claims))))
+	})
+}
+
+// claimHeaderValue returns a claim as a header value, joining the values of array claims with commas
+func claimHeaderValue(claim interface{}) string {
+	values, ok := claim.([]interface{})
+	if !ok {
+		return claimString(claim)
+	}
+	parts := make([]string, 0, len(values))
+	for _, value := range values {
+		if part := claimString(value); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// validateJWTAuth checks that the bearer tokens of an endpoint with jwt_auth are validated and that its
+// claim headers and optional authentication, which only apply with jwt_auth, are valid
+func validateJWTAuth(endpoint Endpoint, config JWTConfig) error {
+	if endpoint.JWTAuth && !config.Enabled {
+		return errors.New("jwt_auth requires jwt.enabled")
+	}
+	if len(endpoint.ClaimHeaders) > 0 && !endpoint.JWTAuth {
+		return errors.New("claim_headers require jwt_auth")
+	}
+	if endpoint.AuthOptional && !endpoint.JWTAuth {
+		return errors.New("auth_optional requires jwt_auth")
+	}
+	for claim, header := range endpoint.ClaimHeaders {
+		if claim == "" || header == "" {
+			return fmt.Errorf("invalid claim header %q: %q", claim, header)
+		}
+	}
+	return nil
+}
+
+// ExchangeMiddleware replaces the validated caller token of the requests to the endpoints with jwt_auth with
+// the internal token of the token exchange, so the backends never see external tokens. It runs after the
+// other middlewares, which still see the caller token.
+func (a *JWTAuth) ExchangeMiddleware(endpoint Endpoint, next http.Handler) http.Handler {
+	if !endpoint.JWTAuth || a.exchanger == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := JWTClaimsFromContext(r.Context())
+		token, hasToken := bearerToken(r)
+		if !ok && !hasToken && endpoint.AuthOptional {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !ok || !hasToken {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		internal, err := a.exchanger.Token(r.Context(), token, claims)
+		if err != nil {
+			LogError("Token exchange failed", err, map[string]interface{}{
+				"path":  r.URL.Path,
+				"route": endpoint.Path,
+			})
+			if errors.Is(err, ErrTokenExchangeRejected) {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			http.Error(w, "Bad Gateway", http.StatusBadGateway)
+			return
+		}
+		r.Header.Set("Authorization", "Bearer "+internal)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// signTestHS256 returns an HS256 token with the given claims
+func signTestHS256(t *testing.T, claims map[string]interface{}, secret string) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signHS256([]byte(signed), secret))
+}
+
+// TestJWTAuth tests the validation of HS256 and RS256 bearer tokens
+func TestJWTAuth(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "key-1",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	defer jwksServer.Close()
+
+	exp := float64(time.Now().Add(time.Hour).Unix())
+	signRS256 := func(claims map[string]interface{}) string {
+		payload, _ := json.Marshal(claims)
+		signed := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","kid":"key-1"}`)) + "." +
+			base64.RawURLEncoding.EncodeToString(payload)
+		digest := sha256.Sum256([]byte(signed))
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+	}
+
+	auth, err := NewJWTAuth(JWTConfig{JWKSURL: jwksServer.URL, Issuer: "https://idp", Audiences: []string{"api"}})
+	if err != nil {
+		t.Fatalf("NewJWTAuth() error = %v", err)
+	}
+	valid := map[string]interface{}{"iss": "https://idp", "aud": []interface{}{"api"}, "sub": "user-1", "exp": exp}
+	if claims, err := auth.Verify(signRS256(valid)); err != nil || claims["sub"] != "user-1" {
+		t.Errorf("expected a valid token, got %v %v", claims, err)
+	}
+	for name, token := range map[string]string{
+		"expired":   signRS256(map[string]interface{}{"iss": "https://idp", "aud": "api", "exp": float64(time.Now().Add(-time.Hour).Unix())}),
+		"no expiry": signRS256(map[string]interface{}{"iss": "https://idp", "aud": "api"}),
+		"issuer":    signRS256(map[string]interface{}{"iss": "https://other", "aud": "api", "exp": exp}),
+		"audience":  signRS256(map[string]interface{}{"iss": "https://idp", "aud": "other", "exp": exp}),
+		"algorithm": signTestHS256(t, valid, "secret"),
+		"malformed": "not-a-token",
+		"signature": signRS256(valid)[:len(signRS256(valid))-4] + "AAAA",
+	} {
+		if _, err := auth.Verify(token); err == nil {
+			t.Errorf("expected the %s token to be rejected", name)
+		}
+	}
+
+	// The middleware rejects requests without a valid token and passes the claims on
+	auth, err = NewJWTAuth(JWTConfig{Secret: "secret"})
+	if err != nil {
+		t.Fatalf("NewJWTAuth() error = %v", err)
+	}
+	var subject interface{}
+	handler := auth.Middleware(Endpoint{Path: "/api/", JWTAuth: true}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := JWTClaimsFromContext(r.Context())
+		subject = claims["sub"]
+	}))
+	for token, expected := range map[string]int{
+		"":                                http.StatusUnauthorized,
+		signTestHS256(t, valid, "other"):  http.StatusUnauthorized,
+		signTestHS256(t, valid, "secret"): http.StatusOK,
+	} {
+		req := httptest.NewRequest("GET", "/api/", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != expected {
+			t.Errorf("expected %d, got %d", expected, rr.Code)
+		}
+	}
+	if subject != "user-1" {
+		t.Errorf("expected the claims in the context, got %v", subject)
+	}
+
+	if _, err := NewJWTAuth(JWTConfig{}); err == nil {
+		t.Error("expected a key to be required")
+	}
+}
+
+// TestTokenExchange tests exchanging the caller tokens at a token endpoint and minting internal tokens
+func TestTokenExchange(t *testing.T) {
+	exchanges := 0
+	stsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		exchanges++
+		if r.FormValue("grant_type") != tokenExchangeGrantType || r.FormValue("audience") != "orders" {
+			http.Error(w, `{"error":"invalid_request"}`, http.StatusBadRequest)
+			return
+		}
+		if r.FormValue("subject_token") == "rejected" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"access_token": "internal-" + r.FormValue("subject_token"), "expires_in": 300})
+	}))
+	defer stsServer.Close()
+
+	secret := "secret"
+	exp := float64(time.Now().Add(time.Hour).Unix())
+	token := signTestHS256(t, map[string]interface{}{"sub": "user-1", "org": "acme", "exp": exp}, secret)
+	auth, err := NewJWTAuth(JWTConfig{Secret: secret, TokenExchange: TokenExchangeConfig{
+		Mode:     TokenExchangeModeExchange,
+		TokenURL: stsServer.URL,
+		Audience: "orders",
+	}})
+	if err != nil {
+		t.Fatalf("NewJWTAuth() error = %v", err)
+	}
+
+	var forwarded string
+	endpoint := Endpoint{Path: "/api/", JWTAuth: true}
+	handler := auth.Middleware(endpoint, auth.ExchangeMiddleware(endpoint, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get("Authorization")
+	})))
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "/api/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK || forwarded != "Bearer internal-"+token {
+			t.Fatalf("expected the exchanged token to be forwarded, got %d %q", rr.Code, forwarded)
+		}
+	}
+	if exchanges != 1 {
+		t.Errorf("expected the exchanged token to be reused, got %d exchanges", exchanges)
+	}
+
+	exchanger, err := NewTokenExchanger(TokenExchangeConfig{Mode: TokenExchangeModeExchange, TokenURL: stsServer.URL, Audience: "orders"}, time.Now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := exchanger.Token(httptest.NewRequest("GET", "/", nil).Context(), "rejected", nil); err == nil {
+		t.Error("expected a rejected exchange to fail")
+	}
+
+	// Minted tokens carry the mapped claims and are signed with the signing secret
+	exchanger, err = NewTokenExchanger(TokenExchangeConfig{
+		Mode:          TokenExchangeModeMint,
+		Issuer:        "gateway",
+		SigningSecret: "internal",
+		Claims:        map[string]string{"sub": "sub", "tenant": "org"},
+	}, time.Now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	minted, err := exchanger.Token(httptest.NewRequest("GET", "/", nil).Context(), token, map[string]interface{}{"sub": "user-1", "org": "acme", "exp": exp})
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	verifier, _ := NewJWTAuth(JWTConfig{Secret: "internal", Issuer: "gateway"})
+	claims, err := verifier.Verify(minted)
+	if err != nil || claims["sub"] != "user-1" || claims["tenant"] != "acme" {
+		t.Errorf("expected a valid minted token with the mapped claims, got %v %v", claims, err)
+	}
+
+	if _, err := NewTokenExchanger(TokenExchangeConfig{Mode: "swap"}, time.Now); err == nil {
+		t.Error("expected an invalid mode to be rejected")
+	}
+}
+
+// TestClaimHeaders tests that the validated claims are forwarded in the claim headers of an endpoint
+func TestClaimHeaders(t *testing.T) {
+	auth, err := NewJWTAuth(JWTConfig{Enabled: true, Secret: "secret"})
+	if err != nil {
+		t.Fatalf("NewJWTAuth() error = %v", err)
+	}
+	endpoint := Endpoint{
+		Path:         "/api/",
+		JWTAuth:      true,
+		ClaimHeaders: map[string]string{"sub": "X-User-ID", "org": "X-Org-ID", "roles": "X-Roles"},
+	}
+	var forwarded http.Header
+	handler := auth.Middleware(endpoint, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Clone()
+	}))
+
+	token := signTestHS256(t, map[string]interface{}{
+		"sub":   "user-1",
+		"roles": []interface{}{"admin", "billing"},
+		"exp":   float64(time.Now().Add(time.Hour).Unix()),
+	}, "secret")
+	req := httptest.NewRequest("GET", "/api/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-User-ID", "spoofed")
+	req.Header.Set("X-Org-ID", "spoofed")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if forwarded.Get("X-User-ID") != "user-1" || forwarded.Get("X-Roles") != "admin,billing" {
+		t.Errorf("expected the claims in the headers, got %v", forwarded)
+	}
+	if _, ok := forwarded["X-Org-Id"]; ok {
+		t.Errorf("expected the client supplied header to be removed, got %v", forwarded.Get("X-Org-ID"))
+	}
+
+	if err := validateJWTAuth(Endpoint{ClaimHeaders: endpoint.ClaimHeaders}, JWTConfig{Enabled: true}); err == nil {
+		t.Error("expected claim headers without jwt_auth to be rejected")
+	}
+	if err := validateJWTAuth(endpoint, JWTConfig{}); err == nil {
+		t.Error("expected jwt_auth without the validation enabled to be rejected")
+	}
+}
+
+// TestOptionalAuth tests that requests without credentials are forwarded as anonymous and invalid ones rejected
+func TestOptionalAuth(t *testing.T) {
+	auth, err := NewJWTAuth(JWTConfig{Enabled: true, Secret: "secret", TokenExchange: TokenExchangeConfig{
+		Mode:          TokenExchangeModeMint,
+		SigningSecret: "internal",
+	}})
+	if err != nil {
+		t.Fatalf("NewJWTAuth() error = %v", err)
+	}
+	endpoint := Endpoint{Path: "/", JWTAuth: true, AuthOptional: true, ClaimHeaders: map[string]string{"sub": "X-User-ID"}}
+	var forwarded http.Header
+	handler := auth.Middleware(endpoint, auth.ExchangeMiddleware(endpoint, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Clone()
+	})))
+
+	valid := signTestHS256(t, map[string]interface{}{"sub": "user-1", "exp": float64(time.Now().Add(time.Hour).Unix())}, "secret")
+	for _, test := range []struct {
+		authorization string
+		status        int
+		anonymous     bool
+	}{
+		{"", http.StatusOK, true},
+		{"Bearer " + valid, http.StatusOK, false},
+		{"Bearer invalid", http.StatusUnauthorized, false},
+		{"Basic dXNlcjpwYXNz", http.StatusUnauthorized, false},
+	} {
+		forwarded = nil
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Auth", "anonymous")
+		req.Header.Set("X-User-ID", "spoofed")
+		if test.authorization != "" {
+			req.Header.Set("Authorization", test.authorization)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != test.status {
+			t.Errorf("%q: expected %d, got %d", test.authorization, test.status, rr.Code)
+			continue
+		}
+		if forwarded == nil {
+			continue
+		}
+		if anonymous := forwarded.Get("X-Auth") == "anonymous"; anonymous != test.anonymous {
+			t.Errorf("%q: expected anonymous %v, got %v", test.authorization, test.anonymous, forwarded)
+		}
+		if test.anonymous && forwarded.Get("X-User-ID") != "" {
+			t.Errorf("expected no identity for anonymous requests, got %v", forwarded)
+		}
+	}
+
+	if err := validateJWTAuth(Endpoint{AuthOptional: true}, JWTConfig{Enabled: true}); err == nil {
+		t.Error("expected auth_optional without jwt_auth to be rejected")
+	}
+}
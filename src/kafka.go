@@ -0,0 +1,380 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Kafka protocol API keys and versions
+const (
+	kafkaProduceAPIKey      = 0
+	kafkaProduceVersion     = 3
+	kafkaMetadataAPIKey     = 3
+	kafkaMetadataVersion    = 1
+	kafkaClientID           = "surfboard"
+	kafkaMaxResponseSize    = 64 * 1024 * 1024
+	kafkaRecordBatchVersion = 2
+)
+
+// kafkaCRC is the Castagnoli CRC-32 table used to checksum record batches
+var kafkaCRC = crc32.MakeTable(crc32.Castagnoli)
+
+// kafkaProducer produces batches of log lines to a Kafka topic, spreading the batches over its partitions
+type kafkaProducer struct {
+	brokers       []string
+	topic         string
+	timeout       time.Duration
+	correlationID int32
+	// Cluster metadata, refreshed after a failure
+	addresses  map[int32]string
+	leaders    map[int32]int32
+	partitions []int32
+	next       int
+	conns      map[int32]net.Conn
+}
+
+// newKafkaProducer creates a kafkaProducer for the given bootstrap brokers and topic
+func newKafkaProducer(brokers []string, topic string, timeout time.Duration) *kafkaProducer {
+	return &kafkaProducer{
+		brokers: brokers,
+		topic:   topic,
+		timeout: timeout,
+		conns:   make(map[int32]net.Conn),
+	}
+}
+
+// send produces the batch to the next partition, refreshing the metadata and retrying once on failure
+func (p *kafkaProducer) send(batch []shippedLog) error {
+	if err := p.produce(batch); err == nil {
+		return nil
+	}
+	p.reset()
+	return p.produce(batch)
+}
+
+// produce sends the batch to the leader of the next partition and waits for its acknowledgement
+func (p *kafkaProducer) produce(batch []shippedLog) error {
+	if len(p.partitions) == 0 {
+		if err := p.refreshMetadata(); err != nil {
+			return err
+		}
+	}
+	partition := p.partitions[p.next%len(p.partitions)]
+	p.next++
+
+	conn, err := p.leaderConn(partition)
+	if err != nil {
+		return err
+	}
+
+	// Build the produce request with acks=1
+	records := appendKafkaRecordBatch(nil, batch)
+	body := appendKafkaInt16(nil, -1) // null transactional id
+	body = appendKafkaInt16(body, 1)
+	body = appendKafkaInt32(body, int32(p.timeout/time.Millisecond))
+	body = appendKafkaInt32(body, 1)
+	body = appendKafkaString(body, p.topic)
+	body = appendKafkaInt32(body, 1)
+	body = appendKafkaInt32(body, partition)
+	body = appendKafkaInt32(body, int32(len(records)))
+	body = append(body, records...)
+
+	response, err := p.roundTrip(conn, kafkaProduceAPIKey, kafkaProduceVersion, body)
+	if err != nil {
+		return err
+	}
+
+	// Check the error code of each partition response
+	r := kafkaReader{buf: response}
+	for topics := r.int32(); topics > 0 && r.err == nil; topics-- {
+		r.string()
+		for partitions := r.int32(); partitions > 0 && r.err == nil; partitions-- {
+			r.int32()
+			if code := r.int16(); code != 0 && r.err == nil {
+				return fmt.Errorf("kafka produce to %s/%d failed with error code %d", p.topic, partition, code)
+			}
+			r.int64()
+			r.int64()
+		}
+	}
+	return r.err
+}
+
+// refreshMetadata fetches the partitions of the topic and their leaders from the first reachable bootstrap broker
+func (p *kafkaProducer) refreshMetadata() error {
+	var lastErr error
+	for _, broker := range p.brokers {
+		conn, err := net.DialTimeout("tcp", broker, p.timeout)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		body := appendKafkaInt32(nil, 1)
+		body = appendKafkaString(body, p.topic)
+		response, err := p.roundTrip(conn, kafkaMetadataAPIKey, kafkaMetadataVersion, body)
+		_ = conn.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return p.parseMetadata(response)
+	}
+	return fmt.Errorf("failed to fetch kafka metadata: %w", lastErr)
+}
+
+// parseMetadata stores the broker addresses and partition leaders of a metadata response
+func (p *kafkaProducer) parseMetadata(response []byte) error {
+	r := kafkaReader{buf: response}
+	addresses := make(map[int32]string)
+	for brokers := r.int32(); brokers > 0 && r.err == nil; brokers-- {
+		nodeID := r.int32()
+		host := r.string()
+		port := r.int32()
+		r.string() // rack
+		addresses[nodeID] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	r.int32() // controller id
+
+	leaders := make(map[int32]int32)
+	var partitions []int32
+	for topics := r.int32(); topics > 0 && r.err == nil; topics-- {
+		topicCode := r.int16()
+		name := r.string()
+		r.int8() // is internal
+		if r.err == nil && name == p.topic && topicCode != 0 {
+			return fmt.Errorf("kafka topic %s is unavailable (error code %d)", name, topicCode)
+		}
+		for count := r.int32(); count > 0 && r.err == nil; count-- {
+			r.int16() // partition error code
+			partition := r.int32()
+			leader := r.int32()
+			r.int32Array() // replicas
+			r.int32Array() // in-sync replicas
+			if name == p.topic && leader >= 0 {
+				leaders[partition] = leader
+				partitions = append(partitions, partition)
+			}
+		}
+	}
+	if r.err != nil {
+		return fmt.Errorf("invalid kafka metadata response: %w", r.err)
+	}
+	if len(partitions) == 0 {
+		return fmt.Errorf("kafka topic %s has no available partitions", p.topic)
+	}
+
+	p.addresses = addresses
+	p.leaders = leaders
+	p.partitions = partitions
+	return nil
+}
+
+// leaderConn returns the connection to the leader of the partition, dialing it if needed
+func (p *kafkaProducer) leaderConn(partition int32) (net.Conn, error) {
+	leader := p.leaders[partition]
+	if conn, ok := p.conns[leader]; ok {
+		return conn, nil
+	}
+	address, ok := p.addresses[leader]
+	if !ok {
+		return nil, fmt.Errorf("unknown kafka broker %d", leader)
+	}
+	conn, err := net.DialTimeout("tcp", address, p.timeout)
+	if err != nil {
+		return nil, err
+	}
+	p.conns[leader] = conn
+	return conn, nil
+}
+
+// roundTrip sends a request and returns the response body following the correlation id
+func (p *kafkaProducer) roundTrip(conn net.Conn, apiKey, apiVersion int16, body []byte) ([]byte, error) {
+	p.correlationID++
+	request := make([]byte, 4, 4+10+len(kafkaClientID)+len(body))
+	request = appendKafkaInt16(request, apiKey)
+	request = appendKafkaInt16(request, apiVersion)
+	request = appendKafkaInt32(request, p.correlationID)
+	request = appendKafkaString(request, kafkaClientID)
+	request = append(request, body...)
+	binary.BigEndian.PutUint32(request, uint32(len(request)-4))
+
+	if err := conn.SetDeadline(time.Now().Add(p.timeout)); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	var size [4]byte
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(size[:])
+	if length < 4 || length > kafkaMaxResponseSize {
+		return nil, fmt.Errorf("invalid kafka response size %d", length)
+	}
+	response := make([]byte, length)
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return nil, err
+	}
+	if correlationID := int32(binary.BigEndian.Uint32(response)); correlationID != p.correlationID {
+		return nil, fmt.Errorf("unexpected kafka correlation id %d", correlationID)
+	}
+	return response[4:], nil
+}
+
+// reset closes the broker connections and forgets the metadata
+func (p *kafkaProducer) reset() {
+	for leader, conn := range p.conns {
+		_ = conn.Close()
+		delete(p.conns, leader)
+	}
+	p.partitions = nil
+}
+
+// close closes the broker connections
+func (p *kafkaProducer) close() error {
+	p.reset()
+	return nil
+}
+
+// appendKafkaRecordBatch appends a v2 record batch holding the log lines as record values
+func appendKafkaRecordBatch(dst []byte, batch []shippedLog) []byte {
+	firstTimestamp := batch[0].at.UnixMilli()
+	maxTimestamp := firstTimestamp
+	for _, entry := range batch {
+		maxTimestamp = max(maxTimestamp, entry.at.UnixMilli())
+	}
+
+	start := len(dst)
+	dst = appendKafkaInt64(dst, 0) // base offset
+	dst = appendKafkaInt32(dst, 0) // batch length, set below
+	dst = appendKafkaInt32(dst, 0) // partition leader epoch
+	dst = append(dst, kafkaRecordBatchVersion)
+	dst = appendKafkaInt32(dst, 0) // crc, set below
+	crcStart := len(dst)
+	dst = appendKafkaInt16(dst, 0) // attributes: no compression
+	dst = appendKafkaInt32(dst, int32(len(batch)-1))
+	dst = appendKafkaInt64(dst, firstTimestamp)
+	dst = appendKafkaInt64(dst, maxTimestamp)
+	dst = appendKafkaInt64(dst, -1) // producer id
+	dst = appendKafkaInt16(dst, -1) // producer epoch
+	dst = appendKafkaInt32(dst, -1) // base sequence
+	dst = appendKafkaInt32(dst, int32(len(batch)))
+
+	var record []byte
+	for i, entry := range batch {
+		record = append(record[:0], 0) // attributes
+		record = binary.AppendVarint(record, entry.at.UnixMilli()-firstTimestamp)
+		record = binary.AppendVarint(record, int64(i))
+		record = binary.AppendVarint(record, -1) // null key
+		record = binary.AppendVarint(record, int64(len(entry.line)))
+		record = append(record, entry.line...)
+		record = binary.AppendVarint(record, 0) // no headers
+		dst = binary.AppendVarint(dst, int64(len(record)))
+		dst = append(dst, record...)
+	}
+
+	binary.BigEndian.PutUint32(dst[start+8:], uint32(len(dst)-start-12))
+	binary.BigEndian.PutUint32(dst[crcStart-4:], crc32.Checksum(dst[crcStart:], kafkaCRC))
+	return dst
+}
+
+// appendKafkaInt16 appends a big-endian int16
+func appendKafkaInt16(dst []byte, v int16) []byte {
+	return binary.BigEndian.AppendUint16(dst, uint16(v))
+}
+
+// appendKafkaInt32 appends a big-endian int32
+func appendKafkaInt32(dst []byte, v int32) []byte {
+	return binary.BigEndian.AppendUint32(dst, uint32(v))
+}
+
+// appendKafkaInt64 appends a big-endian int64
+func appendKafkaInt64(dst []byte, v int64) []byte {
+	return binary.BigEndian.AppendUint64(dst, uint64(v))
+}
+
+// appendKafkaString appends a string prefixed with its int16 length
+func appendKafkaString(dst []byte, s string) []byte {
+	dst = appendKafkaInt16(dst, int16(len(s)))
+	return append(dst, s...)
+}
+
+// errKafkaTruncated is returned when a Kafka response ends before a field
+var errKafkaTruncated = errors.New("truncated kafka response")
+
+// kafkaReader reads the fields of a Kafka response, recording the first error
+type kafkaReader struct {
+	buf []byte
+	err error
+}
+
+// take returns the next n bytes, or nil if the response is too short
+func (r *kafkaReader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.buf) {
+		r.err = errKafkaTruncated
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+// int8 reads an int8
+func (r *kafkaReader) int8() int8 {
+	if b := r.take(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+// int16 reads a big-endian int16
+func (r *kafkaReader) int16() int16 {
+	if b := r.take(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+// int32 reads a big-endian int32
+func (r *kafkaReader) int32() int32 {
+	if b := r.take(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+// int64 reads a big-endian int64
+func (r *kafkaReader) int64() int64 {
+	if b := r.take(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+// string reads a string prefixed with its int16 length, a negative length being a null string
+func (r *kafkaReader) string() string {
+	length := r.int16()
+	if length < 0 {
+		return ""
+	}
+	return string(r.take(int(length)))
+}
+
+// int32Array skips an array of int32
+func (r *kafkaReader) int32Array() {
+	count := r.int32()
+	if count > 0 {
+		r.take(int(count) * 4)
+	}
+}
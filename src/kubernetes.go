@@ -0,0 +1,471 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Default Kubernetes controller settings
+const (
+	defaultIngressClass       = "surfboard"
+	defaultClusterDomain      = "cluster.local"
+	defaultKubernetesResync   = 10000
+	serviceAccountTokenFile   = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	serviceAccountCAFile      = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	ingressClassAnnotationKey = "kubernetes.io/ingress.class"
+)
+
+// KubernetesConfig represents the Kubernetes controller configuration
+type KubernetesConfig struct {
+	Enabled bool `json:"enabled"`
+	// APIServer is the Kubernetes API server URL (defaults to the in-cluster service)
+	APIServer string `json:"api_server"`
+	TokenFile string `json:"token_file"`
+	CAFile    string `json:"ca_file"`
+	// Namespace restricts the watched resources to a namespace (all namespaces if empty)
+	Namespace string `json:"namespace"`
+	// IngressClass selects the Ingress resources handled by the gateway
+	IngressClass string `json:"ingress_class"`
+	// GatewayAPI enables translation of Gateway API HTTPRoute resources
+	GatewayAPI bool `json:"gateway_api"`
+	// GatewayName only accepts HTTPRoutes attached to the named Gateway (all if empty)
+	GatewayName   string `json:"gateway_name"`
+	ClusterDomain string `json:"cluster_domain"`
+	// ResyncInterval is the polling interval in milliseconds
+	ResyncInterval int `json:"resync_interval"`
+	// Timeout is the backend timeout in milliseconds applied to the generated endpoints
+	Timeout int `json:"timeout"`
+}
+
+// k8sMetadata represents the metadata of a Kubernetes object
+type k8sMetadata struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// k8sIngressList represents a list of networking.k8s.io/v1 Ingress resources
+type k8sIngressList struct {
+	Items []k8sIngress `json:"items"`
+}
+
+// k8sIngress represents a networking.k8s.io/v1 Ingress resource
+type k8sIngress struct {
+	Metadata k8sMetadata `json:"metadata"`
+	Spec     struct {
+		IngressClassName string             `json:"ingressClassName"`
+		DefaultBackend   *k8sIngressBackend `json:"defaultBackend"`
+		Rules            []struct {
+			Host string `json:"host"`
+			HTTP *struct {
+				Paths []struct {
+					Path     string            `json:"path"`
+					PathType string            `json:"pathType"`
+					Backend  k8sIngressBackend `json:"backend"`
+				} `json:"paths"`
+			} `json:"http"`
+		} `json:"rules"`
+	} `json:"spec"`
+}
+
+// k8sIngressBackend represents the backend of an Ingress path
+type k8sIngressBackend struct {
+	Service *struct {
+		Name string `json:"name"`
+		Port struct {
+			Number int    `json:"number"`
+			Name   string `json:"name"`
+		} `json:"port"`
+	} `json:"service"`
+}
+
+// k8sHTTPRouteList represents a list of gateway.networking.k8s.io/v1 HTTPRoute resources
+type k8sHTTPRouteList struct {
+	Items []k8sHTTPRoute `json:"items"`
+}
+
+// k8sHTTPRoute represents a gateway.networking.k8s.io/v1 HTTPRoute resource
+type k8sHTTPRoute struct {
+	Metadata k8sMetadata `json:"metadata"`
+	Spec     struct {
+		ParentRefs []struct {
+			Name string `json:"name"`
+		} `json:"parentRefs"`
+		Hostnames []string `json:"hostnames"`
+		Rules     []struct {
+			Matches     []k8sHTTPRouteMatch `json:"matches"`
+			BackendRefs []struct {
+				Kind      string `json:"kind"`
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+				Port      int    `json:"port"`
+			} `json:"backendRefs"`
+		} `json:"rules"`
+	} `json:"spec"`
+}
+
+// k8sHTTPRouteMatch represents a match of an HTTPRoute rule
+type k8sHTTPRouteMatch struct {
+	Path *struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	} `json:"path"`
+	Method string `json:"method"`
+}
+
+// k8sService represents a v1 Service resource
+type k8sService struct {
+	Spec struct {
+		Ports []struct {
+			Name string `json:"name"`
+			Port int    `json:"port"`
+		} `json:"ports"`
+	} `json:"spec"`
+}
+
+// KubernetesController translates Ingress and HTTPRoute resources into gateway endpoints
+type KubernetesController struct {
+	config  KubernetesConfig
+	gateway *Gateway
+	client  *http.Client
+	token   string
+	last    []Endpoint
+}
+
+// NewKubernetesController creates a new KubernetesController using the in-cluster credentials
+// unless an API server, token file or CA file is configured explicitly
+func NewKubernetesController(config KubernetesConfig, gateway *Gateway) (*KubernetesController, error) {
+	if config.APIServer == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, errors.New("kubernetes API server not configured and not running in a cluster")
+		}
+		config.APIServer = "https://" + net.JoinHostPort(host, port)
+	}
+	config.APIServer = strings.TrimSuffix(config.APIServer, "/")
+	if config.TokenFile == "" {
+		config.TokenFile = serviceAccountTokenFile
+	}
+	if config.CAFile == "" {
+		config.CAFile = serviceAccountCAFile
+	}
+	if config.IngressClass == "" {
+		config.IngressClass = defaultIngressClass
+	}
+	if config.ClusterDomain == "" {
+		config.ClusterDomain = defaultClusterDomain
+	}
+	if config.ResyncInterval <= 0 {
+		config.ResyncInterval = defaultKubernetesResync
+	}
+
+	// Trust the cluster CA if it is available
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caData, err := os.ReadFile(config.CAFile); err == nil {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("invalid kubernetes CA file: %s", config.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &KubernetesController{
+		config:  config,
+		gateway: gateway,
+		client:  &http.Client{Transport: transport, Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Run synchronizes the gateway endpoints with the cluster until the context is canceled
+func (c *KubernetesController) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(c.config.ResyncInterval) * time.Millisecond)
+	defer ticker.Stop()
+
+	failing := false
+	for {
+		err := c.Sync(ctx)
+		if err != nil && ctx.Err() == nil {
+			LogError("Kubernetes sync failed", err, nil)
+
+			// Notify once when syncing starts failing
+			if !failing {
+				c.gateway.notifier.Notify(Event{
+					Type:    EventConfigReloadFailed,
+					Message: "Kubernetes sync failed",
+					Details: map[string]interface{}{"error": err.Error()},
+				})
+			}
+		}
+		failing = err != nil
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync fetches the resources from the API server and updates the gateway endpoints if they changed
+func (c *KubernetesController) Sync(ctx context.Context) error {
+	// Reload the token on every sync since projected service account tokens are rotated
+	if token, err := os.ReadFile(c.config.TokenFile); err == nil {
+		c.token = strings.TrimSpace(string(token))
+	}
+
+	endpoints, err := c.ingressEndpoints(ctx)
+	if err != nil {
+		return err
+	}
+
+	if c.config.GatewayAPI {
+		routeEndpoints, err := c.httpRouteEndpoints(ctx)
+		if err != nil {
+			return err
+		}
+		endpoints = append(endpoints, routeEndpoints...)
+	}
+
+	if c.last != nil && reflect.DeepEqual(endpoints, c.last) {
+		return nil
+	}
+	c.last = endpoints
+	c.gateway.UpdateDynamicEndpoints(endpoints)
+	return nil
+}
+
+// ingressEndpoints translates the Ingress resources of the configured class into endpoints
+func (c *KubernetesController) ingressEndpoints(ctx context.Context) ([]Endpoint, error) {
+	var list k8sIngressList
+	if err := c.get(ctx, c.resourcePath("/apis/networking.k8s.io/v1", "ingresses"), &list); err != nil {
+		return nil, fmt.Errorf("failed to list ingresses: %w", err)
+	}
+
+	endpoints := []Endpoint{}
+	for _, ingress := range list.Items {
+		class := ingress.Spec.IngressClassName
+		if class == "" {
+			class = ingress.Metadata.Annotations[ingressClassAnnotationKey]
+		}
+		if class != c.config.IngressClass {
+			continue
+		}
+
+		for _, rule := range ingress.Spec.Rules {
+			if rule.HTTP == nil {
+				continue
+			}
+			if strings.HasPrefix(rule.Host, "*") {
+				LogError("Skipping ingress rule: wildcard hosts are not supported", nil, map[string]interface{}{
+					"ingress": ingress.Metadata.Namespace + "/" + ingress.Metadata.Name,
+					"host":    rule.Host,
+				})
+				continue
+			}
+			for _, path := range rule.HTTP.Paths {
+				backend, err := c.ingressBackendURL(ctx, ingress.Metadata.Namespace, path.Backend)
+				if err != nil {
+					LogError("Skipping ingress path", err, map[string]interface{}{
+						"ingress": ingress.Metadata.Namespace + "/" + ingress.Metadata.Name,
+						"path":    path.Path,
+					})
+					continue
+				}
+				exact := path.PathType == "Exact"
+				endpoints = append(endpoints, c.routeEndpoints(rule.Host, path.Path, exact, "", backend)...)
+			}
+		}
+
+		if ingress.Spec.DefaultBackend != nil {
+			backend, err := c.ingressBackendURL(ctx, ingress.Metadata.Namespace, *ingress.Spec.DefaultBackend)
+			if err == nil {
+				endpoints = append(endpoints, c.routeEndpoints("", "/", false, "", backend)...)
+			}
+		}
+	}
+
+	return endpoints, nil
+}
+
+// httpRouteEndpoints translates the HTTPRoute resources into endpoints
+func (c *KubernetesController) httpRouteEndpoints(ctx context.Context) ([]Endpoint, error) {
+	var list k8sHTTPRouteList
+	if err := c.get(ctx, c.resourcePath("/apis/gateway.networking.k8s.io/v1", "httproutes"), &list); err != nil {
+		return nil, fmt.Errorf("failed to list HTTP routes: %w", err)
+	}
+
+	endpoints := []Endpoint{}
+	for _, route := range list.Items {
+		if !c.attachedToGateway(route) {
+			continue
+		}
+
+		hostnames := route.Spec.Hostnames
+		if len(hostnames) == 0 {
+			hostnames = []string{""}
+		}
+
+		for _, rule := range route.Spec.Rules {
+			if len(rule.BackendRefs) == 0 {
+				continue
+			}
+			// Traffic splitting is not supported, sending all traffic to one of the backends would be wrong
+			if len(rule.BackendRefs) > 1 {
+				LogWarn("Skipping HTTPRoute rule: multiple backends are not supported", map[string]interface{}{
+					"route":     route.Metadata.Name,
+					"namespace": route.Metadata.Namespace,
+					"backends":  len(rule.BackendRefs),
+				})
+				continue
+			}
+			ref := rule.BackendRefs[0]
+			if ref.Kind != "" && ref.Kind != "Service" {
+				continue
+			}
+			namespace := ref.Namespace
+			if namespace == "" {
+				namespace = route.Metadata.Namespace
+			}
+			backend := c.serviceURL(ref.Name, namespace, ref.Port)
+
+			// A rule without matches matches all requests
+			matches := rule.Matches
+			if len(matches) == 0 {
+				matches = []k8sHTTPRouteMatch{{}}
+			}
+
+			for _, hostname := range hostnames {
+				if strings.HasPrefix(hostname, "*") {
+					continue
+				}
+				for _, match := range matches {
+					path, exact := "/", false
+					if match.Path != nil {
+						if match.Path.Type == "RegularExpression" {
+							continue
+						}
+						path, exact = match.Path.Value, match.Path.Type == "Exact"
+					}
+					endpoints = append(endpoints, c.routeEndpoints(hostname, path, exact, match.Method, backend)...)
+				}
+			}
+		}
+	}
+
+	return endpoints, nil
+}
+
+// attachedToGateway checks whether an HTTPRoute is attached to the configured Gateway
+func (c *KubernetesController) attachedToGateway(route k8sHTTPRoute) bool {
+	if c.config.GatewayName == "" {
+		return true
+	}
+	for _, parent := range route.Spec.ParentRefs {
+		if parent.Name == c.config.GatewayName {
+			return true
+		}
+	}
+	return false
+}
+
+// routeEndpoints creates the endpoints for a route. Prefix routes match both the path itself
+// and everything below it.
+func (c *KubernetesController) routeEndpoints(host, path string, exact bool, method, backend string) []Endpoint {
+	if path == "" {
+		path = "/"
+	}
+
+	endpoint := Endpoint{
+		Host:    host,
+		Path:    path,
+		Method:  method,
+		Backend: backend,
+		Timeout: c.config.Timeout,
+	}
+	if exact || strings.HasSuffix(path, "/") {
+		return []Endpoint{endpoint}
+	}
+
+	subtree := endpoint
+	subtree.Path = path + "/"
+	return []Endpoint{endpoint, subtree}
+}
+
+// ingressBackendURL resolves the backend URL of an Ingress backend
+func (c *KubernetesController) ingressBackendURL(ctx context.Context, namespace string, backend k8sIngressBackend) (string, error) {
+	if backend.Service == nil {
+		return "", errors.New("only service backends are supported")
+	}
+
+	port := backend.Service.Port.Number
+	if port == 0 && backend.Service.Port.Name != "" {
+		// Resolve named ports through the Service definition
+		var service k8sService
+		path := fmt.Sprintf("/api/v1/namespaces/%s/services/%s", namespace, backend.Service.Name)
+		if err := c.get(ctx, path, &service); err != nil {
+			return "", fmt.Errorf("failed to resolve service port: %w", err)
+		}
+		for _, servicePort := range service.Spec.Ports {
+			if servicePort.Name == backend.Service.Port.Name {
+				port = servicePort.Port
+			}
+		}
+		if port == 0 {
+			return "", fmt.Errorf("service %s has no port named %s", backend.Service.Name, backend.Service.Port.Name)
+		}
+	}
+
+	return c.serviceURL(backend.Service.Name, namespace, port), nil
+}
+
+// serviceURL returns the cluster-internal URL of a service
+func (c *KubernetesController) serviceURL(name, namespace string, port int) string {
+	host := fmt.Sprintf("%s.%s.svc.%s", name, namespace, c.config.ClusterDomain)
+	if port == 0 {
+		return "http://" + host
+	}
+	return fmt.Sprintf("http://%s:%d", host, port)
+}
+
+// resourcePath returns the API path listing resources, restricted to the configured namespace
+func (c *KubernetesController) resourcePath(group, resource string) string {
+	if c.config.Namespace != "" {
+		return fmt.Sprintf("%s/namespaces/%s/%s", group, c.config.Namespace, resource)
+	}
+	return group + "/" + resource
+}
+
+// get fetches a resource from the API server and decodes it into the target
+func (c *KubernetesController) get(ctx context.Context, path string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.config.APIServer+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status from API server: %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(target)
+}
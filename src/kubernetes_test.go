@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+// TestKubernetesControllerSync tests the translation of Ingress and HTTPRoute resources into endpoints
+func TestKubernetesControllerSync(t *testing.T) {
+	// Create a mock API server
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			t.Errorf("Unexpected Authorization header %q", r.Header.Get("Authorization"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/apis/networking.k8s.io/v1/namespaces/shop/ingresses":
+			_, _ = w.Write([]byte(`{"items": [
+				{"metadata": {"name": "api", "namespace": "shop"},
+				 "spec": {"ingressClassName": "surfboard", "rules": [{"host": "api.example.com", "http": {"paths": [
+					{"path": "/users", "pathType": "Prefix", "backend": {"service": {"name": "users", "port": {"number": 8080}}}},
+					{"path": "/status", "pathType": "Exact", "backend": {"service": {"name": "status", "port": {"name": "http"}}}}
+				 ]}}]}},
+				{"metadata": {"name": "other", "namespace": "shop"},
+				 "spec": {"ingressClassName": "nginx", "rules": [{"http": {"paths": [
+					{"path": "/other", "pathType": "Prefix", "backend": {"service": {"name": "other", "port": {"number": 80}}}}
+				 ]}}]}}
+			]}`))
+		case "/api/v1/namespaces/shop/services/status":
+			_, _ = w.Write([]byte(`{"spec": {"ports": [{"name": "http", "port": 9000}]}}`))
+		case "/apis/gateway.networking.k8s.io/v1/namespaces/shop/httproutes":
+			_, _ = w.Write([]byte(`{"items": [
+				{"metadata": {"name": "orders", "namespace": "shop"},
+				 "spec": {"parentRefs": [{"name": "surfboard"}], "rules": [
+					{"matches": [{"path": {"type": "Exact", "value": "/orders"}, "method": "POST"}],
+					 "backendRefs": [{"name": "orders", "port": 80}]},
+					{"matches": [{"path": {"type": "Exact", "value": "/orders"}, "method": "GET"}],
+					 "backendRefs": [{"name": "order-history", "port": 80}]},
+					{"matches": [{"path": {"type": "Exact", "value": "/carts"}}],
+					 "backendRefs": [{"name": "carts-v1", "port": 80}, {"name": "carts-v2", "port": 80}]}
+				 ]}},
+				{"metadata": {"name": "detached", "namespace": "shop"},
+				 "spec": {"parentRefs": [{"name": "other"}], "rules": [{"backendRefs": [{"name": "detached", "port": 80}]}]}}
+			]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer apiServer.Close()
+
+	gateway := NewGateway(Config{}, nil)
+	controller, err := NewKubernetesController(KubernetesConfig{
+		APIServer:   apiServer.URL,
+		TokenFile:   "/nonexistent",
+		CAFile:      "/nonexistent",
+		Namespace:   "shop",
+		GatewayAPI:  true,
+		GatewayName: "surfboard",
+	}, gateway)
+	if err != nil {
+		t.Fatalf("Failed to create KubernetesController: %v", err)
+	}
+
+	if err := controller.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	expected := []Endpoint{
+		{Host: "api.example.com", Path: "/users", Backend: "http://users.shop.svc.cluster.local:8080"},
+		{Host: "api.example.com", Path: "/users/", Backend: "http://users.shop.svc.cluster.local:8080"},
+		{Host: "api.example.com", Path: "/status", Backend: "http://status.shop.svc.cluster.local:9000"},
+		{Path: "/orders", Method: "POST", Backend: "http://orders.shop.svc.cluster.local:80"},
+		{Path: "/orders", Method: "GET", Backend: "http://order-history.shop.svc.cluster.local:80"},
+	}
+	if !reflect.DeepEqual(controller.last, expected) {
+		t.Errorf("Sync() endpoints = %+v, want %+v", controller.last, expected)
+	}
+}
+
+// TestGatewayDynamicEndpoints tests that dynamic endpoints can be replaced at runtime
+func TestGatewayDynamicEndpoints(t *testing.T) {
+	var closed atomic.Int32
+	backendServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("OK"))
+	}))
+	backendServer.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			closed.Add(1)
+		}
+	}
+	backendServer.Start()
+	defer backendServer.Close()
+	readServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("READ"))
+	}))
+	defer readServer.Close()
+
+	gateway := NewGateway(Config{}, nil)
+	gateway.RegisterHealthCheck()
+	gateway.EnableDynamicEndpoints()
+
+	serveMethod := func(method, host, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Host = host
+		rr := httptest.NewRecorder()
+		gateway.mux.ServeHTTP(rr, req)
+		return rr
+	}
+	serve := func(host, path string) int {
+		return serveMethod("GET", host, path).Code
+	}
+
+	if code := serve("api.example.com", "/users"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 before any update, got %v", code)
+	}
+
+	gateway.UpdateDynamicEndpoints([]Endpoint{
+		{Host: "api.example.com", Path: "/users", Backend: backendServer.URL},
+		{Host: "api.example.com", Path: "/users", Backend: "http://duplicate"},
+		{Path: "/orders", Method: "POST", Backend: backendServer.URL},
+		{Path: "/orders", Method: "GET", Backend: readServer.URL},
+	})
+
+	if code := serve("api.example.com", "/users"); code != http.StatusOK {
+		t.Errorf("Expected 200 for dynamic endpoint, got %v", code)
+	}
+	if code := serve("other.example.com", "/users"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for another host, got %v", code)
+	}
+	if code := serve("api.example.com", "/health"); code != http.StatusOK {
+		t.Errorf("Expected 200 for static health check, got %v", code)
+	}
+
+	// Endpoints sharing a path are served by method
+	if rr := serveMethod("GET", "", "/orders"); rr.Body.String() != "READ" {
+		t.Errorf("Expected the GET endpoint to serve GET requests, got %v %q", rr.Code, rr.Body.String())
+	}
+	if rr := serveMethod("POST", "", "/orders"); rr.Body.String() != "OK" {
+		t.Errorf("Expected the POST endpoint to serve POST requests, got %v %q", rr.Code, rr.Body.String())
+	}
+	if rr := serveMethod("DELETE", "", "/orders"); rr.Code != http.StatusMethodNotAllowed || rr.Header().Get("Allow") != "GET, POST" {
+		t.Errorf("Expected 405 allowing GET and POST, got %v %q", rr.Code, rr.Header().Get("Allow"))
+	}
+
+	// The idle upstream connections of the replaced endpoints are closed
+	gateway.UpdateDynamicEndpoints(nil)
+	if code := serve("api.example.com", "/users"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 after removing the endpoint, got %v", code)
+	}
+	waitFor(t, func() bool { return closed.Load() > 0 })
+}
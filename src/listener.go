@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd socket activation
+const listenFDsStart = 3
+
+// InheritedListeners returns the listeners passed to the process through socket activation.
+// The LISTEN_FDS convention of systemd is used both for systemd socket units and for in-place
+// binary upgrades, where LISTEN_PID is not known in advance and may be omitted.
+func InheritedListeners() ([]net.Listener, error) {
+	countValue := os.Getenv("LISTEN_FDS")
+	if countValue == "" {
+		return nil, nil
+	}
+
+	if pid := os.Getenv("LISTEN_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+
+	count, err := strconv.Atoi(countValue)
+	if err != nil || count < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS value: %s", countValue)
+	}
+
+	// Make sure the file descriptors are not inherited by child processes again
+	_ = os.Unsetenv("LISTEN_FDS")
+	_ = os.Unsetenv("LISTEN_PID")
+	_ = os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]net.Listener, 0, count)
+	for fd := listenFDsStart; fd < listenFDsStart+count; fd++ {
+		file := os.NewFile(uintptr(fd), "listener-"+strconv.Itoa(fd))
+		listener, err := net.FileListener(file)
+		_ = file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to use inherited file descriptor %d: %w", fd, err)
+		}
+		listeners = append(listeners, listener)
+	}
+
+	return listeners, nil
+}
+
+// Listen creates a TCP listener on the given address.
+// With reusePort set, SO_REUSEPORT is enabled so a new gateway process can bind the same port
+// while the old one is still draining.
+func Listen(addr string, reusePort bool) (net.Listener, error) {
+	config := net.ListenConfig{}
+	if reusePort {
+		if reusePortControl == nil {
+			return nil, errors.New("SO_REUSEPORT is not supported on this platform")
+		}
+		config.Control = reusePortControl
+	}
+	return config.Listen(context.Background(), "tcp", addr)
+}
+
+// StartUpgradedProcess starts a new instance of the running binary that inherits the given listeners.
+// The caller is expected to shut down gracefully once the new process has been started.
+func StartUpgradedProcess(listeners []net.Listener) (*os.Process, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine executable: %w", err)
+	}
+
+	files := make([]*os.File, 0, len(listeners))
+	defer func() {
+		for _, file := range files {
+			_ = file.Close()
+		}
+	}()
+	for _, listener := range listeners {
+		fileListener, ok := listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			return nil, fmt.Errorf("listener %s cannot be passed to a child process", listener.Addr())
+		}
+		file, err := fileListener.File()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get listener file descriptor: %w", err)
+		}
+		files = append(files, file)
+	}
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(os.Environ(), "LISTEN_FDS="+strconv.Itoa(len(files)))
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start upgraded process: %w", err)
+	}
+
+	return cmd.Process, nil
+}
+
+// SocketConfig represents the socket options of the accepted client connections
+type SocketConfig struct {
+	// KeepAlive is the idle time in milliseconds before TCP keep-alive probes are sent (default 15000, -1
+	// disables keep-alive probes)
+	KeepAlive int `json:"keep_alive"`
+	// KeepAliveInterval is the time in milliseconds between keep-alive probes (default 15000)
+	KeepAliveInterval int `json:"keep_alive_interval"`
+	// KeepAliveCount is the number of unanswered keep-alive probes after which the connection is closed
+	// (default 9)
+	KeepAliveCount int `json:"keep_alive_count"`
+	// Nagle enables Nagle's algorithm by clearing TCP_NODELAY, trading latency for fewer small packets
+	Nagle bool `json:"nagle"`
+}
+
+// enabled reports whether any socket option differs from the defaults
+func (c SocketConfig) enabled() bool {
+	return c.KeepAlive != 0 || c.KeepAliveInterval != 0 || c.KeepAliveCount != 0 || c.Nagle
+}
+
+// keepAliveConfig returns the TCP keep-alive settings, where 0 keeps the system default
+func (c SocketConfig) keepAliveConfig() net.KeepAliveConfig {
+	if c.KeepAlive < 0 {
+		return net.KeepAliveConfig{Enable: false}
+	}
+	return net.KeepAliveConfig{
+		Enable:   true,
+		Idle:     time.Duration(c.KeepAlive) * time.Millisecond,
+		Interval: time.Duration(c.KeepAliveInterval) * time.Millisecond,
+		Count:    c.KeepAliveCount,
+	}
+}
+
+// SocketOptionsListener returns a listener setting the socket options on the connections it accepts. The
+// options are set after accepting, so they also apply to the connections of inherited listeners.
+func SocketOptionsListener(listener net.Listener, config SocketConfig) net.Listener {
+	return &socketOptionsListener{Listener: listener, config: config}
+}
+
+// socketOptionsListener is a listener setting the socket options of the accepted TCP connections
+type socketOptionsListener struct {
+	net.Listener
+	config SocketConfig
+}
+
+// Accept accepts the next connection and sets its socket options
+func (l *socketOptionsListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		if err := tcpConn.SetKeepAliveConfig(l.config.keepAliveConfig()); err != nil {
+			LogError("Failed to set TCP keep-alive", err, map[string]interface{}{
+				"remote_addr": conn.RemoteAddr().String(),
+			})
+		}
+		if err := tcpConn.SetNoDelay(!l.config.Nagle); err != nil {
+			LogError("Failed to set TCP_NODELAY", err, map[string]interface{}{
+				"remote_addr": conn.RemoteAddr().String(),
+			})
+		}
+	}
+	return conn, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestListenReusePort tests that two listeners can bind the same port with SO_REUSEPORT
+func TestListenReusePort(t *testing.T) {
+	if reusePortControl == nil {
+		t.Skip("SO_REUSEPORT is not supported on this platform")
+	}
+
+	first, err := Listen("127.0.0.1:0", true)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer first.Close()
+
+	second, err := Listen(first.Addr().String(), true)
+	if err != nil {
+		t.Fatalf("Listen() on the same port error = %v", err)
+	}
+	defer second.Close()
+}
+
+// TestInheritedListenersWithoutActivation tests that no listeners are returned without LISTEN_FDS
+func TestInheritedListenersWithoutActivation(t *testing.T) {
+	t.Setenv("LISTEN_FDS", "")
+
+	listeners, err := InheritedListeners()
+	if err != nil || len(listeners) != 0 {
+		t.Errorf("InheritedListeners() = %v, %v, want no listeners", listeners, err)
+	}
+
+	t.Setenv("LISTEN_FDS", "invalid")
+	if _, err := InheritedListeners(); err == nil {
+		t.Error("Expected error for invalid LISTEN_FDS")
+	}
+}
+
+// TestGatewayShutdown tests that the gateway stops serving after a graceful shutdown
+func TestGatewayShutdown(t *testing.T) {
+	gateway := NewGateway(Config{Port: 0}, nil)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- gateway.Start()
+	}()
+
+	// Wait for the gateway to start listening
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		gateway.mu.Lock()
+		listening := len(gateway.listeners) > 0
+		gateway.mu.Unlock()
+		if listening || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := gateway.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	if err := <-errCh; err != http.ErrServerClosed {
+		t.Errorf("Start() error = %v, want %v", err, http.ErrServerClosed)
+	}
+}
+
+// TestSocketOptionsListener tests that the socket options are set on the accepted connections
+func TestSocketOptionsListener(t *testing.T) {
+	inner, err := Listen("127.0.0.1:0", false)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	config := SocketConfig{KeepAlive: 30000, KeepAliveCount: 3, Nagle: true}
+	if !config.enabled() {
+		t.Fatal("expected the socket options to be enabled")
+	}
+	if (SocketConfig{KeepAlive: -1}).keepAliveConfig().Enable {
+		t.Error("expected a negative keep-alive to disable the probes")
+	}
+	listener := SocketOptionsListener(inner, config)
+	defer listener.Close()
+
+	go func() {
+		if conn, err := net.Dial("tcp", inner.Addr().String()); err == nil {
+			defer conn.Close()
+			_, _ = conn.Write([]byte("ping"))
+		}
+	}()
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept() error = %v", err)
+	}
+	defer conn.Close()
+	if _, ok := conn.(*net.TCPConn); !ok {
+		t.Fatalf("expected a TCP connection, got %T", conn)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Errorf("expected to read ping, got %q %v", buf, err)
+	}
+}
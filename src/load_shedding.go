@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+)
+
+// Request priorities, from the first shed to the never shed
+const (
+	PriorityLow      = "low"
+	PriorityNormal   = "normal"
+	PriorityHigh     = "high"
+	PriorityCritical = "critical"
+)
+
+// defaultShedThresholds are the percentages of the gateway capacity above which requests are shed by priority.
+// Critical requests are never shed.
+var defaultShedThresholds = map[string]int{
+	PriorityLow:    50,
+	PriorityNormal: 80,
+	PriorityHigh:   100,
+}
+
+// LoadSheddingConfig represents the shedding of low priority requests when the gateway is overloaded
+type LoadSheddingConfig struct {
+	// MaxInFlight is the capacity of the gateway in concurrent endpoint requests, 0 disables load shedding
+	MaxInFlight int `json:"max_in_flight"`
+	// Thresholds maps the low, normal and high priorities to the percentage of max_in_flight above which
+	// their requests are shed, overriding the defaults of 50, 80 and 100
+	Thresholds map[string]int `json:"thresholds"`
+	// CallerHeader is the header the authentication identifies the caller with, see callerIdentity
+	CallerHeader string `json:"caller_header"`
+	// CallerPriorities maps callers to the priority of their requests, replacing the endpoint priority
+	CallerPriorities map[string]string `json:"caller_priorities"`
+}
+
+// validPriority checks whether a priority is one of the known priorities
+func validPriority(priority string) bool {
+	switch priority {
+	case PriorityLow, PriorityNormal, PriorityHigh, PriorityCritical:
+		return true
+	}
+	return false
+}
+
+// LoadShedder rejects requests by priority when the gateway serves more requests than it is configured for
+type LoadShedder struct {
+	config    LoadSheddingConfig
+	inFlight  func() int64
+	telemetry *TelemetryManager
+}
+
+// NewLoadShedder creates a new LoadShedder measuring the load with the given in-flight request count
+func NewLoadShedder(config LoadSheddingConfig, inFlight func() int64, telemetry *TelemetryManager) *LoadShedder {
+	for caller, priority := range config.CallerPriorities {
+		if !validPriority(priority) {
+			LogError("Invalid caller priority, using the endpoint priority", nil, map[string]interface{}{
+				"caller":   caller,
+				"priority": priority,
+			})
+		}
+	}
+	return &LoadShedder{
+		config:    config,
+		inFlight:  inFlight,
+		telemetry: telemetry,
+	}
+}
+
+// priority returns the priority of a request, the one of its caller if configured or else the one of its endpoint
+func (s *LoadShedder) priority(endpoint Endpoint, r *http.Request) string {
+	if caller := callerIdentity(r, s.config.CallerHeader); caller != "" {
+		if priority := s.config.CallerPriorities[caller]; validPriority(priority) {
+			return priority
+		}
+	}
+	if validPriority(endpoint.Priority) {
+		return endpoint.Priority
+	}
+	return PriorityNormal
+}
+
+// limit returns the number of in-flight requests above which requests of a priority are shed
+func (s *LoadShedder) limit(priority string) (int64, bool) {
+	if priority == PriorityCritical {
+		return 0, false
+	}
+	percent, ok := s.config.Thresholds[priority]
+	if !ok {
+		percent = defaultShedThresholds[priority]
+	}
+	return int64(s.config.MaxInFlight) * int64(percent) / 100, true
+}
+
+// Middleware sheds the requests of an endpoint whose priority limit is exceeded with 503
+func (s *LoadShedder) Middleware(endpoint Endpoint, next http.Handler) http.Handler {
+	if s.config.MaxInFlight <= 0 {
+		return next
+	}
+	if endpoint.Priority != "" && !validPriority(endpoint.Priority) {
+		LogError("Invalid endpoint priority, using normal", nil, map[string]interface{}{
+			"path":     endpoint.Path,
+			"priority": endpoint.Priority,
+		})
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		priority := s.priority(endpoint, r)
+		limit, sheddable := s.limit(priority)
+
+		// The in-flight count includes this request
+		if inFlight := s.inFlight(); sheddable && inFlight > limit {
+			LogWarn("Request shed", map[string]interface{}{
+				"path":      r.URL.Path,
+				"method":    r.Method,
+				"route":     endpoint.Path,
+				"priority":  priority,
+				"in_flight": inFlight,
+				"limit":     limit,
+			})
+			if s.telemetry != nil {
+				s.telemetry.RecordShedRequest(r.Context(), metricsRoute(endpoint), priority)
+			}
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
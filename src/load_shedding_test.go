@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestLoadShedding tests that low priority requests are shed first and critical requests never
+func TestLoadShedding(t *testing.T) {
+	var inFlight int64
+	shedder := NewLoadShedder(LoadSheddingConfig{
+		MaxInFlight:      10,
+		Thresholds:       map[string]int{PriorityHigh: 90},
+		CallerHeader:     "X-Auth-Subject",
+		CallerPriorities: map[string]string{"batch-job": PriorityLow, "checkout": PriorityCritical},
+	}, func() int64 { return inFlight }, nil)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	// The authentication identifies the caller by its bearer token
+	authenticated := func(handler http.Handler) http.Handler {
+		return CallerIdentityMiddleware([]string{"X-Auth-Subject"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if caller, ok := bearerToken(r); ok {
+				r.Header.Set("X-Auth-Subject", caller)
+			}
+			handler.ServeHTTP(w, r)
+		}))
+	}
+	handlers := map[string]http.Handler{
+		"low":      authenticated(shedder.Middleware(Endpoint{Path: "/reports", Priority: PriorityLow}, next)),
+		"normal":   authenticated(shedder.Middleware(Endpoint{Path: "/api"}, next)),
+		"high":     authenticated(shedder.Middleware(Endpoint{Path: "/orders", Priority: PriorityHigh}, next)),
+		"critical": authenticated(shedder.Middleware(Endpoint{Path: "/payments", Priority: PriorityCritical}, next)),
+	}
+
+	tests := []struct {
+		endpoint string
+		caller   string
+		spoofed  string
+		inFlight int64
+		expected int
+	}{
+		{"low", "", "", 5, http.StatusOK},
+		{"low", "", "", 6, http.StatusServiceUnavailable},
+		{"normal", "", "", 6, http.StatusOK},
+		{"normal", "", "", 9, http.StatusServiceUnavailable},
+		{"high", "", "", 9, http.StatusOK},
+		{"high", "", "", 10, http.StatusServiceUnavailable},
+		{"critical", "", "", 1000, http.StatusOK},
+		{"normal", "batch-job", "", 6, http.StatusServiceUnavailable},
+		{"low", "checkout", "", 1000, http.StatusOK},
+		{"low", "", "checkout", 6, http.StatusServiceUnavailable},
+	}
+	for _, test := range tests {
+		inFlight = test.inFlight
+		req := httptest.NewRequest("GET", "/", nil)
+		if test.caller != "" {
+			req.Header.Set("Authorization", "Bearer "+test.caller)
+		}
+		if test.spoofed != "" {
+			req.Header.Set("X-Auth-Subject", test.spoofed)
+		}
+		rr := httptest.NewRecorder()
+		handlers[test.endpoint].ServeHTTP(rr, req)
+		if rr.Code != test.expected {
+			t.Errorf("%s endpoint with caller %q and %d in flight: expected status %d, got %d", test.endpoint, test.caller, test.inFlight, test.expected, rr.Code)
+		}
+		if rr.Code == http.StatusServiceUnavailable && rr.Header().Get("Retry-After") == "" {
+			t.Errorf("%s endpoint: expected a Retry-After header", test.endpoint)
+		}
+	}
+}
+
+// TestLoadSheddingGateway tests that the gateway sheds endpoint requests by its in-flight count
+func TestLoadSheddingGateway(t *testing.T) {
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backendServer.Close()
+
+	gateway := NewGateway(Config{
+		LoadShedding: LoadSheddingConfig{MaxInFlight: 4},
+		Endpoints: []Endpoint{
+			{Path: "/reports", Backend: backendServer.URL, Priority: PriorityLow},
+			{Path: "/payments", Backend: backendServer.URL, Priority: PriorityCritical},
+		},
+	}, nil)
+	gateway.RegisterEndpoints()
+
+	// Simulate requests being served
+	gateway.inFlight.Add(3)
+	for path, expected := range map[string]int{"/reports": http.StatusServiceUnavailable, "/payments": http.StatusOK} {
+		rr := httptest.NewRecorder()
+		gateway.mux.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != expected {
+			t.Errorf("%s: expected status %d, got %d", path, expected, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Log formats
+const (
+	// LogFormatJSON logs the entries with the gateway field names (default)
+	LogFormatJSON = "json"
+	// LogFormatECS logs the entries with Elastic Common Schema field names
+	LogFormatECS = "ecs"
+)
+
+// ecsVersion is the Elastic Common Schema version the ECS log fields follow
+const ecsVersion = "8.11.0"
+
+// ecsLogFormat is set when the log entries are logged with ECS field names
+var ecsLogFormat atomic.Bool
+
+// SetLogFormat sets the format of the log entries, json or ecs
+func SetLogFormat(format string) error {
+	switch format {
+	case "", LogFormatJSON:
+		ecsLogFormat.Store(false)
+	case LogFormatECS:
+		ecsLogFormat.Store(true)
+	default:
+		return fmt.Errorf("invalid log format: %s (must be json or ecs)", format)
+	}
+	return nil
+}
+
+// appendECSLogEntry appends the JSON encoding of a log entry with its fields mapped to ECS names, so
+// Elasticsearch can ingest it without pipeline transforms. Fields without an ECS equivalent are kept
+// under the surfboard namespace.
+func appendECSLogEntry(dst []byte, entry *LogEntry) ([]byte, error) {
+	dst = append(dst, `{"@timestamp":`...)
+	if entry.Timestamp == "" {
+		dst = append(dst, '"')
+		dst = time.Now().UTC().AppendFormat(dst, time.RFC3339)
+		dst = append(dst, '"')
+	} else {
+		dst = appendJSONString(dst, entry.Timestamp)
+	}
+	dst = appendJSONField(dst, "log.level", entry.Level)
+	dst = appendJSONField(dst, "message", entry.Message)
+	dst = appendJSONField(dst, "ecs.version", ecsVersion)
+	dst = append(dst, `,"event.dataset":"surfboard.`...)
+	// Append the escaped type without its opening quote
+	typeStart := len(dst)
+	dst = appendJSONString(dst, entry.Type)
+	dst = append(dst[:typeStart], dst[typeStart+1:]...)
+
+	// HTTP fields
+	dst = appendOptionalField(dst, "http.request.method", entry.Method)
+	dst = appendOptionalField(dst, "url.path", entry.Path)
+	dst = appendOptionalField(dst, "client.address", entry.RemoteAddr)
+	if entry.StatusCode != 0 {
+		dst = append(dst, `,"http.response.status_code":`...)
+		dst = strconv.AppendInt(dst, int64(entry.StatusCode), 10)
+	}
+	if duration, err := time.ParseDuration(entry.Duration); err == nil {
+		dst = append(dst, `,"event.duration":`...)
+		dst = strconv.AppendInt(dst, duration.Nanoseconds(), 10)
+	}
+	if entry.Type == "response" {
+		dst = appendOptionalField(dst, "http.response.body.content", entry.Body)
+	} else {
+		dst = appendOptionalField(dst, "http.request.body.content", entry.Body)
+	}
+	dst = appendOptionalField(dst, "error.message", entry.Error)
+	dst = appendOptionalField(dst, "trace.id", entry.TraceID)
+	dst = appendOptionalField(dst, "span.id", entry.SpanID)
+	if len(entry.Labels) > 0 {
+		dst = append(dst, `,"labels":`...)
+		dst = appendJSONStringMap(dst, entry.Labels)
+	}
+
+	// Gateway fields without an ECS equivalent
+	var err error
+	if len(entry.Headers) > 0 {
+		dst = append(dst, `,"surfboard.headers":`...)
+		if dst, err = appendJSONMap(dst, entry.Headers); err != nil {
+			return nil, err
+		}
+	}
+	dst = appendOptionalField(dst, "surfboard.request_dump", entry.RequestDump)
+	dst = appendOptionalField(dst, "surfboard.backend", entry.Backend)
+	if entry.Attempts != 0 {
+		dst = append(dst, `,"surfboard.attempts":`...)
+		dst = strconv.AppendInt(dst, int64(entry.Attempts), 10)
+	}
+	if len(entry.RetryReasons) > 0 {
+		dst = append(dst, `,"surfboard.retry_reasons":`...)
+		dst = appendJSONStrings(dst, entry.RetryReasons)
+	}
+	if len(entry.Additional) > 0 {
+		dst = append(dst, `,"surfboard.additional":`...)
+		if dst, err = appendJSONMap(dst, entry.Additional); err != nil {
+			return nil, err
+		}
+	}
+	return append(dst, '}'), nil
+}
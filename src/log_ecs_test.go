@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+// TestECSLogFormat tests that log entries are emitted with ECS field names
+func TestECSLogFormat(t *testing.T) {
+	if err := SetLogFormat("logfmt"); err == nil {
+		t.Error("expected an invalid log format to be rejected")
+	}
+	if err := SetLogFormat(LogFormatECS); err != nil {
+		t.Fatal(err)
+	}
+	defer SetLogFormat(LogFormatJSON)
+
+	var buf bytes.Buffer
+	SetLogOutput(&buf)
+	defer SetLogOutput(os.Stdout)
+
+	LogJSON(LogEntry{
+		Timestamp:  "2024-01-01T00:00:00Z",
+		Level:      "info",
+		Message:    "Response: 201 POST /api/users",
+		Type:       "response",
+		Method:     "POST",
+		Path:       "/api/users",
+		StatusCode: 201,
+		Duration:   "1.5ms",
+		Body:       `{"id":1}`,
+		TraceID:    "abc",
+		Backend:    "backend:8080",
+		Attempts:   2,
+		Labels:     map[string]string{"team": "payments"},
+		Additional: map[string]interface{}{"tenant": "acme"},
+	})
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &fields); err != nil {
+		t.Fatalf("invalid log line %q: %v", buf.String(), err)
+	}
+	expected := map[string]interface{}{
+		"@timestamp":                 "2024-01-01T00:00:00Z",
+		"log.level":                  "info",
+		"message":                    "Response: 201 POST /api/users",
+		"ecs.version":                ecsVersion,
+		"event.dataset":              "surfboard.response",
+		"http.request.method":        "POST",
+		"url.path":                   "/api/users",
+		"http.response.status_code":  float64(201),
+		"event.duration":             float64(1500000),
+		"http.response.body.content": `{"id":1}`,
+		"trace.id":                   "abc",
+		"surfboard.backend":          "backend:8080",
+		"surfboard.attempts":         float64(2),
+		"labels":                     map[string]interface{}{"team": "payments"},
+		"surfboard.additional":       map[string]interface{}{"tenant": "acme"},
+	}
+	if len(fields) != len(expected) {
+		t.Errorf("expected %d fields, got %v", len(expected), fields)
+	}
+	for name, value := range expected {
+		if encoded, _ := json.Marshal(fields[name]); !bytes.Equal(encoded, mustMarshal(t, value)) {
+			t.Errorf("expected %s to be %v, got %v", name, value, fields[name])
+		}
+	}
+}
+
+// mustMarshal returns the JSON encoding of a value
+func mustMarshal(t *testing.T, value interface{}) []byte {
+	t.Helper()
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoded
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// appendLogEntry appends the JSON encoding of a log entry to dst. The output is identical to json.Marshal,
+// but the fixed fields and the common value types are encoded without reflection or allocations.
+func appendLogEntry(dst []byte, entry *LogEntry) ([]byte, error) {
+	dst = append(dst, `{"@timestamp":`...)
+	if entry.Timestamp == "" {
+		dst = append(dst, '"')
+		dst = time.Now().UTC().AppendFormat(dst, time.RFC3339)
+		dst = append(dst, '"')
+	} else {
+		dst = appendJSONString(dst, entry.Timestamp)
+	}
+	dst = appendJSONField(dst, "level", entry.Level)
+	dst = appendJSONField(dst, "message", entry.Message)
+	dst = appendJSONField(dst, "type", entry.Type)
+
+	// Fields with omitempty
+	var err error
+	dst = appendOptionalField(dst, "method", entry.Method)
+	dst = appendOptionalField(dst, "path", entry.Path)
+	dst = appendOptionalField(dst, "remote_addr", entry.RemoteAddr)
+	if entry.StatusCode != 0 {
+		dst = append(dst, `,"status_code":`...)
+		dst = strconv.AppendInt(dst, int64(entry.StatusCode), 10)
+	}
+	dst = appendOptionalField(dst, "duration", entry.Duration)
+	if len(entry.Headers) > 0 {
+		dst = append(dst, `,"headers":`...)
+		if dst, err = appendJSONMap(dst, entry.Headers); err != nil {
+			return nil, err
+		}
+	}
+	dst = appendOptionalField(dst, "body", entry.Body)
+	dst = appendOptionalField(dst, "request_dump", entry.RequestDump)
+	dst = appendOptionalField(dst, "error", entry.Error)
+	dst = appendOptionalField(dst, "trace_id", entry.TraceID)
+	dst = appendOptionalField(dst, "span_id", entry.SpanID)
+	dst = appendOptionalField(dst, "backend", entry.Backend)
+	if entry.Attempts != 0 {
+		dst = append(dst, `,"attempts":`...)
+		dst = strconv.AppendInt(dst, int64(entry.Attempts), 10)
+	}
+	if len(entry.RetryReasons) > 0 {
+		dst = append(dst, `,"retry_reasons":`...)
+		dst = appendJSONStrings(dst, entry.RetryReasons)
+	}
+	if len(entry.Labels) > 0 {
+		dst = append(dst, `,"labels":`...)
+		dst = appendJSONStringMap(dst, entry.Labels)
+	}
+	if len(entry.Additional) > 0 {
+		dst = append(dst, `,"additional":`...)
+		if dst, err = appendJSONMap(dst, entry.Additional); err != nil {
+			return nil, err
+		}
+	}
+	return append(dst, '}'), nil
+}
+
+// appendJSONField appends a string field following another field
+func appendJSONField(dst []byte, name, value string) []byte {
+	dst = append(dst, ',', '"')
+	dst = append(dst, name...)
+	dst = append(dst, '"', ':')
+	return appendJSONString(dst, value)
+}
+
+// appendOptionalField appends a string field unless the value is empty
+func appendOptionalField(dst []byte, name, value string) []byte {
+	if value == "" {
+		return dst
+	}
+	return appendJSONField(dst, name, value)
+}
+
+// appendJSONMap appends a map with its keys sorted, as json.Marshal does
+func appendJSONMap(dst []byte, m map[string]interface{}) ([]byte, error) {
+	if m == nil {
+		return append(dst, "null"...), nil
+	}
+	var stack [16]string
+	keys := stack[:0]
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	dst = append(dst, '{')
+	for i, key := range keys {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = appendJSONString(dst, key)
+		dst = append(dst, ':')
+		var err error
+		if dst, err = appendJSONValue(dst, m[key]); err != nil {
+			return nil, err
+		}
+	}
+	return append(dst, '}'), nil
+}
+
+// appendJSONStringMap appends a map of strings with its keys sorted, as json.Marshal does
+func appendJSONStringMap(dst []byte, m map[string]string) []byte {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	dst = append(dst, '{')
+	for i, key := range keys {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = appendJSONString(dst, key)
+		dst = append(dst, ':')
+		dst = appendJSONString(dst, m[key])
+	}
+	return append(dst, '}')
+}
+
+// appendJSONValue appends a value, falling back to json.Marshal for the types not encoded directly
+func appendJSONValue(dst []byte, value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return append(dst, "null"...), nil
+	case string:
+		return appendJSONString(dst, v), nil
+	case bool:
+		return strconv.AppendBool(dst, v), nil
+	case int:
+		return strconv.AppendInt(dst, int64(v), 10), nil
+	case int64:
+		return strconv.AppendInt(dst, v, 10), nil
+	case int32:
+		return strconv.AppendInt(dst, int64(v), 10), nil
+	case uint64:
+		return strconv.AppendUint(dst, v, 10), nil
+	case float64:
+		if !math.IsNaN(v) && !math.IsInf(v, 0) {
+			return appendJSONFloat(dst, v), nil
+		}
+	case []string:
+		if v == nil {
+			return append(dst, "null"...), nil
+		}
+		return appendJSONStrings(dst, v), nil
+	case map[string]interface{}:
+		return appendJSONMap(dst, v)
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return append(dst, encoded...), nil
+}
+
+// appendJSONStrings appends an array of strings
+func appendJSONStrings(dst []byte, values []string) []byte {
+	dst = append(dst, '[')
+	for i, value := range values {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = appendJSONString(dst, value)
+	}
+	return append(dst, ']')
+}
+
+// appendJSONFloat appends a finite float in the format of json.Marshal
+func appendJSONFloat(dst []byte, f float64) []byte {
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	dst = strconv.AppendFloat(dst, f, format, -1, 64)
+	if format == 'e' {
+		// Clean up e-09 to e-9
+		if n := len(dst); n >= 4 && dst[n-4] == 'e' && dst[n-3] == '-' && dst[n-2] == '0' {
+			dst[n-2] = dst[n-1]
+			dst = dst[:n-1]
+		}
+	}
+	return dst
+}
+
+// appendJSONString appends a string escaped as json.Marshal does, HTML characters included
+func appendJSONString(dst []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= 0x20 && b != '"' && b != '\\' && b != '<' && b != '>' && b != '&' {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			switch b {
+			case '\\', '"':
+				dst = append(dst, '\\', b)
+			case '\b':
+				dst = append(dst, '\\', 'b')
+			case '\f':
+				dst = append(dst, '\\', 'f')
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hex[b>>4], hex[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		// U+2028 and U+2029 are valid JSON but break JavaScript parsers
+		if r == '\u2028' || r == '\u2029' {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hex[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestAppendLogEntry tests that log entries are encoded exactly as json.Marshal encodes them
+func TestAppendLogEntry(t *testing.T) {
+	entries := []LogEntry{
+		{Timestamp: "2024-01-01T00:00:00Z", Level: "info", Type: "log"},
+		{
+			Timestamp:    "2024-01-01T00:00:00Z",
+			Level:        "warn",
+			Message:      "Response: 200 GET /api/<users>&\"x\"\\",
+			Type:         "response",
+			Method:       "GET",
+			Path:         "/api/users",
+			RemoteAddr:   "10.0.0.1:1234",
+			StatusCode:   200,
+			Duration:     "1.5ms",
+			Headers:      map[string]interface{}{"Accept": "*/*", "X-Multi": []string{"a", "b"}},
+			Body:         "line\nbreak\ttab\r\b\f\x01 \u2028\u2029 é",
+			RequestDump:  "GET / HTTP/1.1",
+			Error:        "boom",
+			TraceID:      "abc",
+			SpanID:       "def",
+			Backend:      "backend:8080",
+			Attempts:     2,
+			RetryReasons: []string{"status_503"},
+			Labels:       map[string]string{"team": "payments", "tier": "1"},
+			Additional: map[string]interface{}{
+				"string":   "value",
+				"int":      42,
+				"int64":    int64(-7),
+				"float":    1.5,
+				"tiny":     1e-9,
+				"huge":     1e22,
+				"zero":     0.0,
+				"bool":     true,
+				"nil":      nil,
+				"strings":  []string{"x"},
+				"nilslice": []string(nil),
+				"nested":   map[string]interface{}{"b": 1, "a": map[string]string{"k": "v"}},
+				"duration": time.Second,
+				"error":    errors.New("not marshaled"),
+				"interfaces": []interface{}{
+					"a", 1,
+				},
+			},
+		},
+	}
+	for _, entry := range entries {
+		expected, err := json.Marshal(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded, err := appendLogEntry(nil, &entry)
+		if err != nil {
+			t.Fatalf("failed to encode %+v: %v", entry, err)
+		}
+		if !bytes.Equal(encoded, expected) {
+			t.Errorf("expected\n%s\ngot\n%s", expected, encoded)
+		}
+	}
+
+	// Invalid UTF-8 is replaced with the replacement character
+	encoded, err := appendLogEntry(nil, &LogEntry{Body: "a\xffb"})
+	var decoded LogEntry
+	if err != nil || json.Unmarshal(encoded, &decoded) != nil || decoded.Body != "a\ufffdb" {
+		t.Errorf("expected invalid UTF-8 to be replaced, got %s", encoded)
+	}
+
+	// Values json.Marshal rejects are rejected
+	if _, err := appendLogEntry(nil, &LogEntry{Additional: map[string]interface{}{"nan": math.NaN()}}); err == nil {
+		t.Error("expected NaN to be rejected")
+	}
+}
+
+// TestLineWriter tests that concurrently written lines never interleave and are all flushed
+func TestLineWriter(t *testing.T) {
+	var out bytes.Buffer
+	writer := newLineWriter(&out)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			writer.WriteLine([]byte(strings.Repeat(string(rune('a'+i%26)), 10000) + "\n"))
+		}(i)
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 50 {
+		t.Fatalf("expected 50 lines, got %d", len(lines))
+	}
+	for _, line := range lines {
+		if len(line) != 10000 || strings.Trim(line, line[:1]) != "" {
+			t.Fatalf("expected a line of 10000 identical characters, got %d characters", len(line))
+		}
+	}
+}
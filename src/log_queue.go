@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Log queue overflow policies
+const (
+	// LogOverflowDropNewest drops the lines logged while the queue is full (default)
+	LogOverflowDropNewest = "drop_newest"
+	// LogOverflowDropOldest drops the oldest queued line to make room for a new one
+	LogOverflowDropOldest = "drop_oldest"
+)
+
+// defaultLogQueueSize is the default maximum number of queued log lines
+const defaultLogQueueSize = 10000
+
+// LoggingConfig represents the configuration of the log output
+type LoggingConfig struct {
+	// Format is the format of the log entries: json (default) or ecs for Elastic Common Schema field names
+	Format string `json:"format"`
+	// Async writes the log lines from a bounded queue in the background, so a slow log output cannot
+	// stall request handling
+	Async bool `json:"async"`
+	// QueueSize is the maximum number of queued log lines (default 10000)
+	QueueSize int `json:"queue_size"`
+	// Overflow is the policy for lines logged while the queue is full: drop_newest (default) or drop_oldest
+	Overflow string `json:"overflow"`
+	// Sinks ship the structured access and audit logs to Kafka or Fluentd, in addition to the log output
+	Sinks []LogSinkConfig `json:"sinks"`
+}
+
+// logLinesDropped counts the log lines dropped because the queue was full
+var logLinesDropped atomic.Int64
+
+// LogQueue writes log lines from a bounded queue in the background
+type LogQueue struct {
+	lines    chan *[]byte
+	overflow string
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+// logQueue is the queue log lines are sent to, nil if log lines are written synchronously
+var logQueue atomic.Pointer[LogQueue]
+
+// StartLogQueue starts writing log lines asynchronously through a queue
+func StartLogQueue(config LoggingConfig) (*LogQueue, error) {
+	switch config.Overflow {
+	case "":
+		config.Overflow = LogOverflowDropNewest
+	case LogOverflowDropNewest, LogOverflowDropOldest:
+	default:
+		return nil, fmt.Errorf("invalid log overflow policy: %s (must be drop_newest or drop_oldest)", config.Overflow)
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaultLogQueueSize
+	}
+
+	q := &LogQueue{
+		lines:    make(chan *[]byte, config.QueueSize),
+		overflow: config.Overflow,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go q.run()
+	logQueue.Store(q)
+	return q, nil
+}
+
+// enqueue queues a log line, taking ownership of its buffer, and applies the overflow policy if the queue is full
+func (q *LogQueue) enqueue(line *[]byte) {
+	select {
+	case q.lines <- line:
+		return
+	default:
+	}
+
+	if q.overflow == LogOverflowDropOldest {
+		// Make room by dropping the oldest line, unless the writer just did
+		select {
+		case oldest := <-q.lines:
+			putLogBuffer(oldest)
+			logLinesDropped.Add(1)
+		default:
+		}
+		select {
+		case q.lines <- line:
+			return
+		default:
+		}
+	}
+	putLogBuffer(line)
+	logLinesDropped.Add(1)
+}
+
+// run writes the queued lines until the queue is closed, then writes the remaining ones
+func (q *LogQueue) run() {
+	defer close(q.done)
+	for {
+		select {
+		case line := <-q.lines:
+			q.write(line)
+		case <-q.stop:
+			for {
+				select {
+				case line := <-q.lines:
+					q.write(line)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// write writes a line to the log output and returns its buffer to the pool
+func (q *LogQueue) write(line *[]byte) {
+	logMu.Lock()
+	output := logOutput
+	logMu.Unlock()
+	output.WriteLine(*line)
+	putLogBuffer(line)
+}
+
+// Close writes the queued lines and switches back to synchronous logging
+func (q *LogQueue) Close() {
+	q.once.Do(func() {
+		logQueue.CompareAndSwap(q, nil)
+		close(q.stop)
+	})
+	<-q.done
+}
+
+// flushLogQueue writes the queued lines of the running queue, if any
+func flushLogQueue() {
+	if q := logQueue.Load(); q != nil {
+		q.Close()
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// blockingWriter blocks writes until it is released, signaling the first write
+type blockingWriter struct {
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	started  chan struct{}
+	release  chan struct{}
+	startOne sync.Once
+}
+
+// Write blocks until the writer is released
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	w.startOne.Do(func() { close(w.started) })
+	<-w.release
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+// TestLogQueueOverflow tests that a slow log output does not block logging and the overflow policy is applied
+func TestLogQueueOverflow(t *testing.T) {
+	tests := []struct {
+		overflow string
+		expected []string
+	}{
+		{LogOverflowDropNewest, []string{"1", "2", "3"}},
+		{LogOverflowDropOldest, []string{"1", "4", "5"}},
+	}
+	for _, test := range tests {
+		output := &blockingWriter{started: make(chan struct{}), release: make(chan struct{})}
+		SetLogOutput(output)
+		queue, err := StartLogQueue(LoggingConfig{Async: true, QueueSize: 2, Overflow: test.overflow})
+		if err != nil {
+			t.Fatal(err)
+		}
+		dropped := logLinesDropped.Load()
+
+		// The first line blocks the writer, the next ones fill the queue and overflow
+		LogInfo("1", nil)
+		<-output.started
+		for _, message := range []string{"2", "3", "4", "5"} {
+			LogInfo(message, nil)
+		}
+		if n := logLinesDropped.Load() - dropped; n != 2 {
+			t.Errorf("%s: expected 2 dropped lines, got %d", test.overflow, n)
+		}
+
+		close(output.release)
+		queue.Close()
+		var messages []string
+		for _, line := range strings.Split(strings.TrimSpace(output.buf.String()), "\n") {
+			var entry LogEntry
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				t.Fatalf("%s: invalid log line %q", test.overflow, line)
+			}
+			messages = append(messages, entry.Message)
+		}
+		if strings.Join(messages, ",") != strings.Join(test.expected, ",") {
+			t.Errorf("%s: expected lines %v, got %v", test.overflow, test.expected, messages)
+		}
+	}
+	SetLogOutput(os.Stdout)
+
+	if _, err := StartLogQueue(LoggingConfig{Async: true, Overflow: "block"}); err == nil {
+		t.Error("expected an invalid overflow policy to be rejected")
+	}
+}
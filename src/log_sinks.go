@@ -0,0 +1,238 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Log sink types
+const (
+	LogSinkKafka   = "kafka"
+	LogSinkFluentd = "fluentd"
+)
+
+// Default log sink settings
+const (
+	defaultLogSinkBatchSize     = 100
+	defaultLogSinkFlushInterval = 1000
+	defaultLogSinkBufferSize    = 10000
+	defaultLogSinkTimeout       = 5000
+	defaultFluentdTag           = "surfboard"
+)
+
+// defaultLogSinkTypes are the log entry types shipped by default, the access and audit logs
+var defaultLogSinkTypes = []string{"request", "response", "audit"}
+
+// LogSinkConfig represents a destination the structured logs are shipped to, in addition to the log output
+type LogSinkConfig struct {
+	// Type is kafka or fluentd
+	Type string `json:"type"`
+	// Brokers are the host:port addresses of the Kafka bootstrap brokers
+	Brokers []string `json:"brokers"`
+	// Topic is the Kafka topic the log entries are produced to
+	Topic string `json:"topic"`
+	// Address is the host:port address of the Fluentd or Fluent Bit forward input
+	Address string `json:"address"`
+	// Tag is the Fluentd tag of the log entries (default surfboard)
+	Tag string `json:"tag"`
+	// LogTypes are the types of the shipped log entries (default request, response and audit)
+	LogTypes []string `json:"log_types"`
+	// BatchSize is the maximum number of log entries sent at once (default 100)
+	BatchSize int `json:"batch_size"`
+	// FlushInterval is the maximum time in milliseconds a log entry waits to be sent (default 1000)
+	FlushInterval int `json:"flush_interval"`
+	// BufferSize is the maximum number of log entries waiting to be sent, newer ones are dropped (default 10000)
+	BufferSize int `json:"buffer_size"`
+	// Timeout is the connection and write timeout in milliseconds (default 5000)
+	Timeout int `json:"timeout"`
+}
+
+// withDefaults returns the configuration with default values applied
+func (c LogSinkConfig) withDefaults() LogSinkConfig {
+	if len(c.LogTypes) == 0 {
+		c.LogTypes = defaultLogSinkTypes
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = defaultLogSinkBatchSize
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = defaultLogSinkFlushInterval
+	}
+	if c.BufferSize <= 0 {
+		c.BufferSize = defaultLogSinkBufferSize
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultLogSinkTimeout
+	}
+	if c.Tag == "" {
+		c.Tag = defaultFluentdTag
+	}
+	return c
+}
+
+// shippedLog is a log line waiting to be sent to a sink
+type shippedLog struct {
+	line []byte
+	at   time.Time
+}
+
+// logSender sends batches of log lines to a sink
+type logSender interface {
+	send(batch []shippedLog) error
+	close() error
+}
+
+// LogSink ships the log entries of the configured types to a sink in batches from a background goroutine
+type LogSink struct {
+	config  LogSinkConfig
+	sender  logSender
+	entries chan shippedLog
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	// dropped counts the entries dropped because the buffer was full or they could not be sent
+	dropped atomic.Int64
+}
+
+// logSinks are the sinks log entries are shipped to
+var logSinks atomic.Pointer[[]*LogSink]
+
+// NewLogSink creates a LogSink for the given configuration, without starting it
+func NewLogSink(config LogSinkConfig) (*LogSink, error) {
+	config = config.withDefaults()
+	timeout := time.Duration(config.Timeout) * time.Millisecond
+
+	var sender logSender
+	switch config.Type {
+	case LogSinkKafka:
+		if len(config.Brokers) == 0 || config.Topic == "" {
+			return nil, errors.New("kafka log sink requires brokers and a topic")
+		}
+		sender = newKafkaProducer(config.Brokers, config.Topic, timeout)
+	case LogSinkFluentd:
+		if config.Address == "" {
+			return nil, errors.New("fluentd log sink requires an address")
+		}
+		sender = newFluentForwarder(config.Address, config.Tag, timeout)
+	default:
+		return nil, fmt.Errorf("invalid log sink type: %s (must be kafka or fluentd)", config.Type)
+	}
+
+	return &LogSink{
+		config:  config,
+		sender:  sender,
+		entries: make(chan shippedLog, config.BufferSize),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// StartLogSinks starts shipping log entries to the given sinks
+func StartLogSinks(configs []LogSinkConfig) ([]*LogSink, error) {
+	sinks := make([]*LogSink, 0, len(configs))
+	for i, config := range configs {
+		sink, err := NewLogSink(config)
+		if err != nil {
+			return nil, fmt.Errorf("log sink %d: %w", i, err)
+		}
+		sinks = append(sinks, sink)
+	}
+	for _, sink := range sinks {
+		go sink.run()
+	}
+	logSinks.Store(&sinks)
+	return sinks, nil
+}
+
+// StopLogSinks sends the buffered log entries and stops shipping to the running sinks
+func StopLogSinks() {
+	sinks := logSinks.Swap(nil)
+	if sinks == nil {
+		return
+	}
+	for _, sink := range *sinks {
+		sink.Close()
+	}
+}
+
+// shipLog copies a log line of the given type to the running sinks shipping this type
+func shipLog(logType string, line []byte) {
+	sinks := logSinks.Load()
+	if sinks == nil {
+		return
+	}
+	now := time.Now()
+	for _, sink := range *sinks {
+		if !containsString(sink.config.LogTypes, logType) {
+			continue
+		}
+		select {
+		case sink.entries <- shippedLog{line: append([]byte(nil), line...), at: now}:
+		default:
+			sink.dropped.Add(1)
+		}
+	}
+}
+
+// run sends the entries in batches when a batch is full or the flush interval elapses
+func (s *LogSink) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(time.Duration(s.config.FlushInterval) * time.Millisecond)
+	defer ticker.Stop()
+
+	batch := make([]shippedLog, 0, s.config.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.sender.send(batch); err != nil {
+			s.dropped.Add(int64(len(batch)))
+			// Log to the standard logger, shipping this error would loop through the failing sink
+			log.Printf("Failed to ship %d log entries to %s log sink: %v", len(batch), s.config.Type, err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case entry := <-s.entries:
+			batch = append(batch, entry)
+			if len(batch) >= s.config.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-s.stop:
+			for {
+				select {
+				case entry := <-s.entries:
+					batch = append(batch, entry)
+					if len(batch) >= s.config.BatchSize {
+						flush()
+					}
+				default:
+					flush()
+					_ = s.sender.close()
+					return
+				}
+			}
+		}
+	}
+}
+
+// Dropped returns the number of entries dropped because the buffer was full or they could not be sent
+func (s *LogSink) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Close sends the buffered entries and closes the connection to the sink
+func (s *LogSink) Close() {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+)
+
+// fakeKafkaBroker is a single Kafka broker answering metadata and produce requests for one topic of two partitions
+type fakeKafkaBroker struct {
+	listener net.Listener
+	topic    string
+	values   chan string
+}
+
+// newFakeKafkaBroker starts a fakeKafkaBroker
+func newFakeKafkaBroker(t *testing.T, topic string) *fakeKafkaBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker := &fakeKafkaBroker{listener: listener, topic: topic, values: make(chan string, 100)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go broker.serve(t, conn)
+		}
+	}()
+	return broker
+}
+
+// serve answers the requests of a connection
+func (b *fakeKafkaBroker) serve(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		request := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return
+		}
+		r := kafkaReader{buf: request}
+		apiKey := r.int16()
+		r.int16()
+		correlationID := r.int32()
+		r.string()
+
+		response := appendKafkaInt32(make([]byte, 4), correlationID)
+		switch apiKey {
+		case kafkaMetadataAPIKey:
+			host, port, _ := net.SplitHostPort(b.listener.Addr().String())
+			portNumber, _ := strconv.Atoi(port)
+			response = appendKafkaInt32(response, 1)
+			response = appendKafkaInt32(response, 0)
+			response = appendKafkaString(response, host)
+			response = appendKafkaInt32(response, int32(portNumber))
+			response = appendKafkaInt16(response, -1)
+			response = appendKafkaInt32(response, 0)
+			response = appendKafkaInt32(response, 1)
+			response = appendKafkaInt16(response, 0)
+			response = appendKafkaString(response, b.topic)
+			response = append(response, 0)
+			response = appendKafkaInt32(response, 2)
+			for partition := int32(0); partition < 2; partition++ {
+				response = appendKafkaInt16(response, 0)
+				response = appendKafkaInt32(response, partition)
+				response = appendKafkaInt32(response, 0)
+				response = appendKafkaInt32(appendKafkaInt32(response, 1), 0)
+				response = appendKafkaInt32(appendKafkaInt32(response, 1), 0)
+			}
+		case kafkaProduceAPIKey:
+			r.string()
+			r.int16()
+			r.int32()
+			r.int32()
+			topic := r.string()
+			r.int32()
+			partition := r.int32()
+			records := r.take(int(r.int32()))
+			if err := b.readRecordBatch(records); err != nil || r.err != nil {
+				t.Errorf("invalid produce request: %v %v", err, r.err)
+				return
+			}
+			response = appendKafkaInt32(response, 1)
+			response = appendKafkaString(response, topic)
+			response = appendKafkaInt32(response, 1)
+			response = appendKafkaInt32(response, partition)
+			response = appendKafkaInt16(response, 0)
+			response = appendKafkaInt64(response, 0)
+			response = appendKafkaInt64(response, -1)
+			response = appendKafkaInt32(response, 0)
+		}
+		binary.BigEndian.PutUint32(response, uint32(len(response)-4))
+		if _, err := conn.Write(response); err != nil {
+			return
+		}
+	}
+}
+
+// readRecordBatch checks a record batch and sends its record values to the values channel
+func (b *fakeKafkaBroker) readRecordBatch(batch []byte) error {
+	r := kafkaReader{buf: batch}
+	r.int64()
+	if length := r.int32(); int(length) != len(batch)-12 {
+		return errors.New("invalid batch length")
+	}
+	r.int32()
+	if r.int8() != kafkaRecordBatchVersion {
+		return errors.New("invalid magic")
+	}
+	if crc := uint32(r.int32()); crc != crc32.Checksum(r.buf, kafkaCRC) {
+		return errors.New("invalid crc")
+	}
+	r.take(2 + 4 + 8 + 8 + 8 + 2 + 4)
+	count := r.int32()
+	data := r.buf
+	for i := int32(0); i < count; i++ {
+		length, n := binary.Varint(data)
+		record := data[n : n+int(length)]
+		data = data[n+int(length):]
+
+		fields := record[1:]
+		for field := 0; field < 3; field++ {
+			_, n := binary.Varint(fields)
+			fields = fields[n:]
+		}
+		valueLength, n := binary.Varint(fields)
+		b.values <- string(fields[n : n+int(valueLength)])
+	}
+	return r.err
+}
+
+// TestKafkaLogSink tests that access and audit log entries are produced to Kafka
+func TestKafkaLogSink(t *testing.T) {
+	broker := newFakeKafkaBroker(t, "gateway-logs")
+	defer broker.listener.Close()
+
+	var buf bytes.Buffer
+	SetLogOutput(&buf)
+	defer SetLogOutput(os.Stdout)
+
+	if _, err := StartLogSinks([]LogSinkConfig{{
+		Type:    LogSinkKafka,
+		Brokers: []string{broker.listener.Addr().String()},
+		Topic:   "gateway-logs",
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	LogInfo("not shipped", nil)
+	LogJSON(LogEntry{Level: "info", Type: "response", Message: "first", StatusCode: 200})
+	LogJSON(LogEntry{Level: "info", Type: "audit", Message: "second"})
+	StopLogSinks()
+
+	for _, message := range []string{"first", "second"} {
+		var entry LogEntry
+		if err := json.Unmarshal([]byte(<-broker.values), &entry); err != nil || entry.Message != message {
+			t.Errorf("expected shipped entry %q, got %+v (%v)", message, entry, err)
+		}
+	}
+	if len(broker.values) != 0 {
+		t.Errorf("expected only the access and audit entries to be shipped, got %d more", len(broker.values))
+	}
+}
+
+// TestFluentdLogSink tests that log entries are forwarded to Fluentd with their fields and numbers preserved
+func TestFluentdLogSink(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		data, _ := io.ReadAll(conn)
+		received <- data
+	}()
+
+	SetLogOutput(io.Discard)
+	defer SetLogOutput(os.Stdout)
+
+	if _, err := StartLogSinks([]LogSinkConfig{{
+		Type:     LogSinkFluentd,
+		Address:  listener.Addr().String(),
+		Tag:      "gateway.access",
+		LogTypes: []string{"log"},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	LogInfo("forwarded", map[string]interface{}{"attempt": 3, "ratio": 0.5, "ok": true, "tags": []string{"a"}})
+	StopLogSinks()
+
+	message, rest := decodeTestMsgpack(t, <-received)
+	if len(rest) != 0 {
+		t.Fatalf("expected a single forward message, %d bytes remain", len(rest))
+	}
+	forward := message.([]interface{})
+	if forward[0] != "gateway.access" {
+		t.Errorf("expected tag gateway.access, got %v", forward[0])
+	}
+	events := forward[1].([]interface{})
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	record := events[0].([]interface{})[1].(map[string]interface{})
+	additional := record["additional"].(map[string]interface{})
+	if record["message"] != "forwarded" || additional["attempt"] != int64(3) || additional["ratio"] != 0.5 ||
+		additional["ok"] != true || additional["tags"].([]interface{})[0] != "a" {
+		t.Errorf("unexpected record %v", record)
+	}
+}
+
+// TestLogSinkConfig tests that invalid sinks are rejected and unreachable sinks drop their entries
+func TestLogSinkConfig(t *testing.T) {
+	for _, config := range []LogSinkConfig{
+		{Type: "syslog"},
+		{Type: LogSinkKafka, Topic: "logs"},
+		{Type: LogSinkKafka, Brokers: []string{"localhost:9092"}},
+		{Type: LogSinkFluentd},
+	} {
+		if _, err := NewLogSink(config); err == nil {
+			t.Errorf("expected %+v to be rejected", config)
+		}
+	}
+
+	// Find a closed port
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	SetLogOutput(io.Discard)
+	defer SetLogOutput(os.Stdout)
+	sinks, err := StartLogSinks([]LogSinkConfig{{Type: LogSinkFluentd, Address: address}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	LogJSON(LogEntry{Level: "info", Type: "request", Message: "lost"})
+	StopLogSinks()
+	if dropped := sinks[0].Dropped(); dropped != 1 {
+		t.Errorf("expected 1 dropped entry, got %d", dropped)
+	}
+}
+
+// decodeTestMsgpack decodes the msgpack value at the start of data, returning the remaining bytes
+func decodeTestMsgpack(t *testing.T, data []byte) (interface{}, []byte) {
+	t.Helper()
+	if len(data) == 0 {
+		t.Fatal("unexpected end of msgpack data")
+	}
+	b := data[0]
+	data = data[1:]
+	decodeArray := func(n int, data []byte) (interface{}, []byte) {
+		items := make([]interface{}, n)
+		for i := range items {
+			items[i], data = decodeTestMsgpack(t, data)
+		}
+		return items, data
+	}
+	decodeMap := func(n int, data []byte) (interface{}, []byte) {
+		entries := make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			var key, value interface{}
+			key, data = decodeTestMsgpack(t, data)
+			value, data = decodeTestMsgpack(t, data)
+			entries[key.(string)] = value
+		}
+		return entries, data
+	}
+	switch {
+	case b <= 0x7f:
+		return int64(b), data
+	case b >= 0xe0:
+		return int64(int8(b)), data
+	case b&0xf0 == 0x80:
+		return decodeMap(int(b&0x0f), data)
+	case b&0xf0 == 0x90:
+		return decodeArray(int(b&0x0f), data)
+	case b&0xe0 == 0xa0:
+		n := int(b & 0x1f)
+		return string(data[:n]), data[n:]
+	}
+	switch b {
+	case 0xc0:
+		return nil, data
+	case 0xc2:
+		return false, data
+	case 0xc3:
+		return true, data
+	case 0xcb:
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), data[8:]
+	case 0xd3:
+		return int64(binary.BigEndian.Uint64(data)), data[8:]
+	case 0xd7:
+		return data[1:9], data[9:]
+	case 0xd9:
+		n := int(data[0])
+		return string(data[1 : 1+n]), data[1+n:]
+	case 0xda:
+		n := int(binary.BigEndian.Uint16(data))
+		return string(data[2 : 2+n]), data[2+n:]
+	case 0xdc:
+		return decodeArray(int(binary.BigEndian.Uint16(data)), data[2:])
+	case 0xde:
+		return decodeMap(int(binary.BigEndian.Uint16(data)), data[2:])
+	}
+	t.Fatalf("unsupported msgpack type 0x%x", b)
+	return nil, nil
+}
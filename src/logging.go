@@ -1,14 +1,16 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/http/httputil"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -27,28 +29,68 @@ type LogEntry struct {
 	Body        string                 `json:"body,omitempty"`
 	RequestDump string                 `json:"request_dump,omitempty"`
 	Error       string                 `json:"error,omitempty"`
-	Additional  map[string]interface{} `json:"additional,omitempty"`
+	TraceID     string                 `json:"trace_id,omitempty"`
+	SpanID      string                 `json:"span_id,omitempty"`
+	// Backend is the backend instance that served the request, Attempts the number of upstream attempts
+	// and RetryReasons why the retries happened
+	Backend      string   `json:"backend,omitempty"`
+	Attempts     int      `json:"attempts,omitempty"`
+	RetryReasons []string `json:"retry_reasons,omitempty"`
+	// Labels are the labels of the endpoint serving the request
+	Labels     map[string]string      `json:"labels,omitempty"`
+	Additional map[string]interface{} `json:"additional,omitempty"`
 }
 
+// maxLoggedBodyBytes is the maximum number of response body bytes captured for logging
+const maxLoggedBodyBytes = 64 * 1024
+
 // LoggingResponseWriter is a wrapper around http.ResponseWriter that logs the status code
 type LoggingResponseWriter struct {
 	http.ResponseWriter
 	statusCode int
 	body       bytes.Buffer
+	// bodyLimit is the maximum number of body bytes captured, 0 disables capturing
+	bodyLimit int
+	// bytesWritten is the size of the response body and firstWriteAt the time the response started
+	bytesWritten int64
+	firstWriteAt time.Time
 }
 
 // WriteHeader captures the status code for logging
 func (lrw *LoggingResponseWriter) WriteHeader(code int) {
 	lrw.statusCode = code
+	if lrw.firstWriteAt.IsZero() {
+		lrw.firstWriteAt = time.Now()
+	}
 	lrw.ResponseWriter.WriteHeader(code)
 }
 
-// Write captures the response body for logging
+// Write captures the beginning of the response body for logging
 func (lrw *LoggingResponseWriter) Write(b []byte) (int, error) {
+	if lrw.firstWriteAt.IsZero() {
+		lrw.firstWriteAt = time.Now()
+	}
 	// Write to the buffer for logging
-	lrw.body.Write(b)
+	if remaining := lrw.bodyLimit - lrw.body.Len(); remaining > 0 {
+		lrw.body.Write(b[:min(len(b), remaining)])
+	}
 	// Write to the original ResponseWriter
-	return lrw.ResponseWriter.Write(b)
+	n, err := lrw.ResponseWriter.Write(b)
+	lrw.bytesWritten += int64(n)
+	return n, err
+}
+
+// TransferDuration returns the time since the first response byte was written
+func (lrw *LoggingResponseWriter) TransferDuration() time.Duration {
+	if lrw.firstWriteAt.IsZero() {
+		return 0
+	}
+	return time.Since(lrw.firstWriteAt)
+}
+
+// Unwrap returns the underlying ResponseWriter so http.ResponseController can flush streamed responses
+func (lrw *LoggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lrw.ResponseWriter
 }
 
 // GetBody returns the captured response body
@@ -58,26 +100,97 @@ func (lrw *LoggingResponseWriter) GetBody() string {
 
 // NewLoggingResponseWriter creates a new LoggingResponseWriter
 func NewLoggingResponseWriter(w http.ResponseWriter) *LoggingResponseWriter {
-	return &LoggingResponseWriter{w, http.StatusOK, bytes.Buffer{}}
+	return &LoggingResponseWriter{ResponseWriter: w, statusCode: http.StatusOK, bodyLimit: maxLoggedBodyBytes}
+}
+
+// countingReadCloser is a wrapper around a request body that counts the bytes read
+type countingReadCloser struct {
+	io.ReadCloser
+	bytesRead int64
+	// progress is called with the number of bytes of each read, if set
+	progress func(n int64)
+}
+
+// Read counts the bytes read from the body
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.bytesRead += int64(n)
+	if n > 0 && c.progress != nil {
+		c.progress(int64(n))
+	}
+	return n, err
+}
+
+// lineWriter writes log lines to an output through a buffer. Each line is written while holding the lock,
+// so concurrent lines never interleave, and the buffer is flushed once no other line is waiting, so lines
+// written under contention are coalesced into fewer writes and no line stays in the buffer.
+type lineWriter struct {
+	mu      sync.Mutex
+	out     *bufio.Writer
+	pending atomic.Int64
+}
+
+// newLineWriter creates a new lineWriter writing to the given output
+func newLineWriter(w io.Writer) *lineWriter {
+	return &lineWriter{out: bufio.NewWriterSize(w, 64*1024)}
+}
+
+// WriteLine writes a line, which must end with a newline
+func (w *lineWriter) WriteLine(line []byte) {
+	w.pending.Add(1)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, _ = w.out.Write(line)
+	if w.pending.Add(-1) == 0 {
+		_ = w.out.Flush()
+	}
+}
+
+// logOutput is the destination of the log entries
+var (
+	logMu     sync.Mutex
+	logOutput = newLineWriter(os.Stdout)
+)
+
+// SetLogOutput sets the destination of the log entries
+func SetLogOutput(w io.Writer) {
+	logMu.Lock()
+	defer logMu.Unlock()
+	logOutput = newLineWriter(w)
 }
 
 // LogJSON logs a message in JSON format
 func LogJSON(entry LogEntry) {
-	// Set timestamp if not already set
-	if entry.Timestamp == "" {
-		entry.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	// Encode the entry into a pooled buffer
+	buf := getLogBuffer()
+	encode := appendLogEntry
+	if ecsLogFormat.Load() {
+		encode = appendECSLogEntry
 	}
-
-	// Convert to JSON
-	jsonBytes, err := json.Marshal(entry)
+	line, err := encode(*buf, &entry)
 	if err != nil {
 		// Fallback to standard logging if JSON marshaling fails
+		putLogBuffer(buf)
 		log.Printf("Error marshaling log entry to JSON: %v", err)
 		return
 	}
+	// Ship a copy of the entry to the log sinks
+	shipLog(entry.Type, line)
+	*buf = append(line, '\n')
+
+	// Queue the line for the background writer if logging is asynchronous
+	if q := logQueue.Load(); q != nil {
+		q.enqueue(buf)
+		return
+	}
 
 	// Print JSON log entry
-	fmt.Println(string(jsonBytes))
+	logMu.Lock()
+	output := logOutput
+	logMu.Unlock()
+	output.WriteLine(*buf)
+	putLogBuffer(buf)
 }
 
 // LogInfo logs an informational message in JSON format
@@ -106,7 +219,28 @@ func LogError(message string, err error, additional map[string]interface{}) {
 	LogJSON(entry)
 }
 
-// LogFatal logs a fatal error message in JSON format and exits the program
+// LogWarn logs a warning message in JSON format
+func LogWarn(message string, additional map[string]interface{}) {
+	LogJSON(LogEntry{
+		Level:      "warn",
+		Message:    message,
+		Type:       "log",
+		Additional: additional,
+	})
+}
+
+// LogAudit logs a security-relevant decision (e.g. a blocked request) in JSON format
+func LogAudit(message string, additional map[string]interface{}) {
+	LogJSON(LogEntry{
+		Level:      "warn",
+		Message:    message,
+		Type:       "audit",
+		Additional: additional,
+	})
+}
+
+// LogFatal logs a fatal error message in JSON format. It does not exit, the caller decides whether the
+// process stops.
 func LogFatal(message string, err error, additional map[string]interface{}) {
 	entry := LogEntry{
 		Level:      "fatal",
@@ -120,7 +254,6 @@ func LogFatal(message string, err error, additional map[string]interface{}) {
 	}
 
 	LogJSON(entry)
-	os.Exit(1)
 }
 
 // LogRequest logs the details of an HTTP request in JSON format
@@ -134,6 +267,8 @@ func LogRequest(r *http.Request, debug bool) {
 		Path:       r.URL.Path,
 		RemoteAddr: r.RemoteAddr,
 	}
+	entry.TraceID, entry.SpanID = traceIDs(r.Context())
+	entry.Labels = EndpointLabelsFromContext(r.Context())
 
 	// Add debug information if enabled
 	if debug {
@@ -148,28 +283,31 @@ func LogRequest(r *http.Request, debug bool) {
 		}
 		entry.Headers = headers
 
-		// Log request body if present
-		if r.Body != nil {
-			bodyBytes, err := io.ReadAll(r.Body)
+		// Log the beginning of the request body if present, the rest is still streamed to the backend
+		if r.Body != nil && r.Body != http.NoBody {
+			bodyBytes, err := io.ReadAll(io.LimitReader(r.Body, maxLoggedBodyBytes))
 			if err != nil {
 				entry.Error = fmt.Sprintf("Error reading request body: %v", err)
-			} else {
-				// Restore the body for further processing
-				r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+			}
+
+			// Restore the body for further processing
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(bodyBytes), r.Body), r.Body}
 
-				// Log the body if not empty
-				if len(bodyBytes) > 0 {
-					entry.Body = string(bodyBytes)
-				}
+			// Log the body if not empty
+			if len(bodyBytes) > 0 {
+				entry.Body = string(bodyBytes)
 			}
 		}
 
-		// Log request dump for detailed debugging
-		requestDump, err := httputil.DumpRequest(r, true)
+		// Log request dump for detailed debugging, without the body
+		requestDump, err := httputil.DumpRequest(r, false)
 		if err != nil {
 			entry.Error = fmt.Sprintf("Error dumping request: %v", err)
 		} else {
-			entry.RequestDump = string(requestDump)
+			entry.RequestDump = string(requestDump) + entry.Body
 		}
 	}
 
@@ -189,9 +327,21 @@ func LogResponse(lrw *LoggingResponseWriter, r *http.Request, duration string, d
 		StatusCode: lrw.statusCode,
 		Duration:   duration,
 	}
+	entry.TraceID, entry.SpanID = traceIDs(r.Context())
+	entry.Labels = EndpointLabelsFromContext(r.Context())
+	if attempts := UpstreamAttemptsFromContext(r.Context()); attempts != nil {
+		entry.Backend = attempts.Backend
+		entry.Attempts = attempts.Count
+		entry.RetryReasons = attempts.RetryReasons
+	}
 
 	// Add debug information if enabled
 	if debug {
+		// Log the timing breakdown of the last upstream attempt
+		if attempts := UpstreamAttemptsFromContext(r.Context()); attempts != nil && attempts.Count > 0 {
+			entry.Additional = map[string]interface{}{"upstream_timing": attempts.Timing.fields()}
+		}
+
 		// Log response body if present
 		body := lrw.GetBody()
 		if body != "" {
@@ -2,35 +2,120 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
+// defaultShutdownTimeout is the time to wait for in-flight requests when no shutdown timeout is configured
+const defaultShutdownTimeout = 30 * time.Second
+
+// main is the only place deciding the exit of the process, the gateway components return their errors
 func main() {
+	err := run(os.Args[1:])
+	stopped := err != nil && !errors.Is(err, flag.ErrHelp)
+	var failure *runError
+	if stopped && errors.As(err, &failure) {
+		LogFatal(failure.message, failure.err, nil)
+	} else if stopped {
+		LogFatal("Gateway failed", err, nil)
+	}
+
+	// Write the remaining log lines before exiting
+	flushLogQueue()
+	StopLogSinks()
+	if stopped {
+		os.Exit(1)
+	}
+}
+
+// runError is an error stopping the gateway with the message it is logged with
+type runError struct {
+	message string
+	err     error
+}
+
+// Error returns the message with the underlying error
+func (e *runError) Error() string {
+	if e.err == nil {
+		return e.message
+	}
+	return e.message + ": " + e.err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *runError) Unwrap() error {
+	return e.err
+}
+
+// failed returns a runError with the given message and underlying error, which may be nil
+func failed(message string, err error) error {
+	return &runError{message: message, err: err}
+}
+
+// run runs a subcommand or serves the gateway until it is shut down
+func run(args []string) error {
+	// Run subcommands
+	if len(args) > 0 {
+		switch args[0] {
+		case "replay":
+			if err := RunReplayCommand(args[1:]); err != nil {
+				return failed("Replay failed", err)
+			}
+			return nil
+		case "config":
+			if err := RunConfigCommand(args[1:]); err != nil {
+				return failed("Config command failed", err)
+			}
+			return nil
+		case "bench":
+			if err := RunBenchCommand(args[1:]); err != nil {
+				return failed("Load test failed", err)
+			}
+			return nil
+		}
+	}
+
 	// Parse command line flags
-	port := flag.Int("port", 0, "Port to listen on (overrides config)")
-	configFile := flag.String("config", "", "Path to configuration file")
-	debug := flag.Bool("debug", false, "Enable debug mode with verbose logging")
-	flag.Parse()
+	flags := flag.NewFlagSet("SurfBoard", flag.ContinueOnError)
+	port := flags.Int("port", 0, "Port to listen on (overrides config)")
+	configFile := flags.String("config", "", "Path to configuration file")
+	var overlays stringList
+	flags.Var(&overlays, "overlay", "Path to a configuration overlay merged into the configuration file (repeatable)")
+	strict := flags.Bool("strict", true, "Reject configuration files with unknown fields")
+	debug := flags.Bool("debug", false, "Enable debug mode with verbose logging")
+	check := flags.Bool("check", false, "Load the configuration, bind the listeners, print a report and exit")
+	checkBackends := flags.Bool("check-backends", false, "Also connect to the backends with -check")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
 
 	// Create a config manager
 	configManager := NewConfigManager()
+	configManager.Strict = *strict
 
 	// Load configuration
 	var config Config
 	if *configFile != "" {
 		// Load configuration from file
 		var err error
-		config, err = configManager.LoadFromFile(*configFile)
+		config, err = configManager.LoadWithOverlays(*configFile, overlays)
 		if err != nil {
-			LogFatal("Failed to load configuration", err, nil)
+			return failed("Failed to load configuration", err)
 		}
 		LogInfo("Loaded configuration from file", map[string]interface{}{
-			"file": *configFile,
+			"file":     *configFile,
+			"overlays": []string(overlays),
 		})
 	} else {
+		if len(overlays) > 0 {
+			return failed("Configuration overlays require a configuration file", nil)
+		}
+
 		// Use default configuration
 		config = configManager.LoadDefault()
 		LogInfo("Using default configuration", nil)
@@ -47,36 +132,226 @@ func main() {
 		LogInfo("Debug mode enabled", nil)
 	}
 
+	// Run the self-test instead of serving traffic
+	if *check {
+		if !WriteCheckReport(os.Stdout, RunSelfCheck(config, *checkBackends)) {
+			return failed("Self-check failed", nil)
+		}
+		return nil
+	}
+
+	// Select the log format
+	if err := SetLogFormat(config.Logging.Format); err != nil {
+		return failed("Failed to configure logging", err)
+	}
+
+	// Write the log lines in the background if configured, main flushes them on exit
+	if config.Logging.Async {
+		if _, err := StartLogQueue(config.Logging); err != nil {
+			return failed("Failed to initialize asynchronous logging", err)
+		}
+	}
+
+	// Ship the logs to the configured sinks
+	if len(config.Logging.Sinks) > 0 {
+		if _, err := StartLogSinks(config.Logging.Sinks); err != nil {
+			return failed("Failed to initialize log sinks", err)
+		}
+		LogInfo("Log sinks enabled", map[string]interface{}{"sinks": len(config.Logging.Sinks)})
+	}
+
 	// Initialize telemetry
 	telemetry, err := NewTelemetryManager(config.Telemetry)
 	if err != nil {
-		LogFatal("Failed to initialize telemetry", err, nil)
+		return failed("Failed to initialize telemetry", err)
 	}
 	if config.Telemetry.Enabled {
+		prometheusEnabled, otlpEnabled, _ := telemetryExporters(config.Telemetry)
 		LogInfo("Telemetry enabled", map[string]interface{}{
 			"service_name": config.Telemetry.ServiceName,
 			"metrics_url":  config.Telemetry.MetricsURL,
+			"prometheus":   prometheusEnabled,
+			"otlp":         otlpEnabled,
+		})
+	}
+
+	// Create and configure the gateway
+	gateway := NewGateway(config, telemetry)
+
+	// Set up geo lookups
+	if config.GeoIP.Enabled {
+		geoIP, err := NewGeoIP(config.GeoIP)
+		if err != nil {
+			return failed("Failed to initialize GeoIP", err)
+		}
+		gateway.Use(geoIP.Middleware)
+		LogInfo("GeoIP enabled", map[string]interface{}{
+			"country_database": config.GeoIP.CountryDatabase,
+			"asn_database":     config.GeoIP.ASNDatabase,
+		})
+	}
+
+	// Set up request filtering rules
+	if config.WAF.Enabled {
+		waf, err := NewWAF(config.WAF, telemetry)
+		if err != nil {
+			return failed("Failed to initialize WAF", err)
+		}
+		gateway.Use(waf.Middleware)
+		LogInfo("WAF enabled", map[string]interface{}{
+			"rules": len(config.WAF.Rules),
+		})
+	}
+
+	// Set up the validation of bearer tokens, before the authorization
+	var jwtAuth *JWTAuth
+	if config.JWT.Enabled {
+		jwtAuth, err = NewJWTAuth(config.JWT)
+		if err != nil {
+			return failed("Failed to initialize JWT validation", err)
+		}
+		gateway.Use(jwtAuth.Middleware)
+		LogInfo("JWT validation enabled", map[string]interface{}{
+			"issuer":         config.JWT.Issuer,
+			"token_exchange": config.JWT.TokenExchange.Mode,
 		})
 	}
 
+	// Set up policy-based authorization
+	if config.OPA.Enabled {
+		authorizer, err := NewOPAAuthorizer(config.OPA)
+		if err != nil {
+			return failed("Failed to initialize OPA authorization", err)
+		}
+		gateway.Use(authorizer.Middleware)
+		LogInfo("OPA authorization enabled", map[string]interface{}{
+			"url":           config.OPA.URL,
+			"decision_path": config.OPA.DecisionPath,
+		})
+	}
+
+	// Set up external authorization
+	if config.ExtAuthz.Enabled {
+		extAuthz, err := NewExtAuthz(config.ExtAuthz)
+		if err != nil {
+			return failed("Failed to initialize external authorization", err)
+		}
+		gateway.Use(extAuthz.Middleware)
+		LogInfo("External authorization enabled", map[string]interface{}{
+			"url": config.ExtAuthz.URL,
+		})
+	}
+
+	// Set up the OIDC login of browser users
+	if config.OIDC.Enabled {
+		oidcLogin, err := NewOIDCLogin(config.OIDC)
+		if err != nil {
+			return failed("Failed to initialize OIDC login", err)
+		}
+		gateway.Use(oidcLogin.Middleware)
+		gateway.RegisterOIDCCallback(oidcLogin)
+		LogInfo("OIDC login enabled", map[string]interface{}{
+			"issuer":       config.OIDC.Issuer,
+			"redirect_url": config.OIDC.RedirectURL,
+		})
+	}
+
+	// Set up custom metric attributes, after the authentication verified the claims they are taken from
+	if len(config.Telemetry.MetricAttributes) > 0 {
+		metricAttributes, err := NewMetricAttributes(config.Telemetry.MetricAttributes)
+		if err != nil {
+			return failed("Failed to initialize metric attributes", err)
+		}
+		gateway.Use(metricAttributes.Middleware)
+	}
+
+	// Replace the caller tokens with internal tokens once all other middlewares have seen them
+	if jwtAuth != nil && config.JWT.TokenExchange.Mode != "" {
+		gateway.Use(jwtAuth.ExchangeMiddleware)
+	}
+
+	// Sign the identity headers once all authentication middlewares have set them
+	if config.IdentitySigning.enabled() {
+		identitySigner, err := NewIdentitySigner(config.IdentitySigning, authenticationHeaders(config))
+		if err != nil {
+			return failed("Failed to initialize identity header signing", err)
+		}
+		gateway.Use(identitySigner.Middleware)
+		LogInfo("Identity header signing enabled", map[string]interface{}{
+			"signature_header": identitySigner.config.SignatureHeader,
+			"ed25519":          identitySigner.privateKey != nil,
+		})
+	}
+
+	// Set up traffic recording
+	var recorder *TrafficRecorder
+	if config.Recording.Enabled {
+		recorder, err = NewTrafficRecorder(config.Recording)
+		if err != nil {
+			return failed("Failed to initialize traffic recording", err)
+		}
+		gateway.Use(recorder.Middleware)
+		LogInfo("Traffic recording enabled", map[string]interface{}{
+			"file":        config.Recording.File,
+			"sample_rate": config.Recording.SampleRate,
+		})
+	}
+
+	if err := gateway.Initialize(); err != nil {
+		return failed("Failed to initialize gateway routes", err)
+	}
+
 	// Create a context that will be canceled on interrupt
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Set up signal handling for graceful shutdown
+	// Set up signal handling for graceful shutdown, in-place upgrades and certificate reloads
+	signals := []os.Signal{os.Interrupt, syscall.SIGTERM}
+	if upgradeSignal != nil {
+		signals = append(signals, upgradeSignal)
+	}
+	if reloadSignal != nil {
+		signals = append(signals, reloadSignal)
+	}
 	signalCh := make(chan os.Signal, 1)
-	signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(signalCh, signals...)
 	go func() {
-		<-signalCh
-		LogInfo("Received shutdown signal", nil)
-		cancel()
+		for sig := range signalCh {
+			if reloadSignal != nil && sig == reloadSignal {
+				LogInfo("Received certificate reload signal", nil)
+				gateway.ReloadCertificates()
+				continue
+			}
+			if upgradeSignal != nil && sig == upgradeSignal {
+				LogInfo("Received upgrade signal", nil)
+				if err := gateway.Upgrade(); err != nil {
+					LogError("Failed to upgrade gateway", err, nil)
+					continue
+				}
+			} else {
+				LogInfo("Received shutdown signal", nil)
+			}
+			cancel()
+			return
+		}
 	}()
 
-	// Create and configure the gateway
-	gateway := NewGateway(config, telemetry)
-	gateway.RegisterEndpoints()
-	gateway.RegisterHealthCheck()
-	gateway.RegisterMetricsEndpoint()
+	// Start the Kubernetes controller that manages endpoints from Ingress and HTTPRoute resources
+	if config.Kubernetes.Enabled {
+		controller, err := NewKubernetesController(config.Kubernetes, gateway)
+		if err != nil {
+			return failed("Failed to initialize Kubernetes controller", err)
+		}
+		gateway.EnableDynamicEndpoints()
+		go controller.Run(ctx)
+		LogInfo("Kubernetes controller enabled", map[string]interface{}{
+			"ingress_class": config.Kubernetes.IngressClass,
+			"gateway_api":   config.Kubernetes.GatewayAPI,
+		})
+	}
+
+	// Check the certificate expiry periodically
+	go gateway.certificates.Run(ctx)
 
 	// Start the gateway in a goroutine
 	errCh := make(chan error, 1)
@@ -88,13 +363,33 @@ func main() {
 	select {
 	case <-ctx.Done():
 		LogInfo("Shutting down gracefully", nil)
+
+		// Wait for in-flight requests to complete
+		shutdownTimeout := time.Duration(config.ShutdownTimeout) * time.Millisecond
+		if shutdownTimeout <= 0 {
+			shutdownTimeout = defaultShutdownTimeout
+		}
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		if err := gateway.Shutdown(shutdownCtx); err != nil {
+			LogError("Error shutting down gateway", err, nil)
+		}
+		shutdownCancel()
+
+		// Write the remaining recorded traffic
+		if recorder != nil {
+			if err := recorder.Close(); err != nil {
+				LogError("Error writing recorded traffic", err, nil)
+			}
+		}
+
 		// Shutdown telemetry
 		if err := telemetry.Shutdown(context.Background()); err != nil {
 			LogError("Error shutting down telemetry", err, nil)
 		}
 	case err := <-errCh:
-		if err != nil {
-			LogFatal("Failed to start gateway", err, nil)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return failed("Failed to start gateway", err)
 		}
 	}
+	return nil
 }
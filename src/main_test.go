@@ -1,9 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"flag"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -68,6 +73,44 @@ func TestLoggingResponseWriter(t *testing.T) {
 	}
 }
 
+// TestLoggingResponseWriterBodyLimit tests that only the beginning of large bodies is captured
+func TestLoggingResponseWriterBodyLimit(t *testing.T) {
+	rr := httptest.NewRecorder()
+	lrw := NewLoggingResponseWriter(rr)
+	_, _ = lrw.Write(bytes.Repeat([]byte("x"), maxLoggedBodyBytes+10))
+
+	if len(lrw.GetBody()) != maxLoggedBodyBytes || rr.Body.Len() != maxLoggedBodyBytes+10 {
+		t.Errorf("Expected %d captured bytes of %d written, got %d of %d",
+			maxLoggedBodyBytes, maxLoggedBodyBytes+10, len(lrw.GetBody()), rr.Body.Len())
+	}
+
+	lrw = NewLoggingResponseWriter(httptest.NewRecorder())
+	lrw.bodyLimit = 0
+	_, _ = lrw.Write([]byte("body"))
+	if lrw.GetBody() != "" {
+		t.Errorf("Expected no captured body without a limit, got %q", lrw.GetBody())
+	}
+}
+
+// TestTransferAccounting tests counting the request and response body bytes
+func TestTransferAccounting(t *testing.T) {
+	lrw := NewLoggingResponseWriter(httptest.NewRecorder())
+	if lrw.TransferDuration() != 0 {
+		t.Errorf("Expected no transfer duration before the response started, got %v", lrw.TransferDuration())
+	}
+	_, _ = lrw.Write([]byte("hello "))
+	_, _ = lrw.Write([]byte("world"))
+	if lrw.bytesWritten != 11 {
+		t.Errorf("Expected 11 response bytes, got %d", lrw.bytesWritten)
+	}
+
+	body := &countingReadCloser{ReadCloser: io.NopCloser(strings.NewReader("request body"))}
+	_, _ = io.Copy(io.Discard, body)
+	if body.bytesRead != 12 {
+		t.Errorf("Expected 12 request bytes, got %d", body.bytesRead)
+	}
+}
+
 // Test health check endpoint
 func TestHealthCheckEndpoint(t *testing.T) {
 	// Create a request to pass to our handler
@@ -103,3 +146,30 @@ func TestHealthCheckEndpoint(t *testing.T) {
 		t.Errorf("handler returned unexpected body: got %v want %v", response["status"], "ok")
 	}
 }
+
+// TestRunErrors tests that startup failures are returned to main with the message they are logged with
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{"missing configuration file", []string{"-config", "missing.json"}, "Failed to load configuration"},
+		{"overlay without configuration file", []string{"-overlay", "prod.json"}, "Configuration overlays require a configuration file"},
+		{"failed subcommand", []string{"config", "unknown"}, "Config command failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var failure *runError
+			err := run(tt.args)
+			if !errors.As(err, &failure) || failure.message != tt.expected {
+				t.Errorf("expected the failure %q, got %v", tt.expected, err)
+			}
+		})
+	}
+
+	// Asking for the usage is not a failure
+	if err := run([]string{"-h"}); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("expected flag.ErrHelp, got %v", err)
+	}
+}
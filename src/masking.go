@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Masking actions of the sensitive response fields
+const (
+	MaskActionMask = "mask"
+	MaskActionHash = "hash"
+	MaskActionDrop = "drop"
+)
+
+// maskedValue replaces the masked characters of the values
+const maskedValue = "****"
+
+// MaskingRule represents a sensitive field of the responses of an endpoint and how it is masked
+type MaskingRule struct {
+	// Path is the dotted path of the field, e.g. customer.email; arrays are traversed element by element and
+	// * matches any field
+	Path string `json:"path"`
+	// Action is mask (default) replacing the value with ****, hash replacing it with its SHA-256 hash so values
+	// can still be correlated, or drop removing the field
+	Action string `json:"action"`
+	// KeepLast is the number of trailing characters of the value kept by the mask action, e.g. 4 for card numbers
+	KeepLast int `json:"keep_last"`
+}
+
+// action returns the masking action of the rule
+func (m MaskingRule) action() string {
+	if m.Action == "" {
+		return MaskActionMask
+	}
+	return m.Action
+}
+
+// validateMasking checks the masking rules of an endpoint
+func validateMasking(rules []MaskingRule) error {
+	for _, rule := range rules {
+		if rule.Path == "" {
+			return errors.New("masking rule without a path")
+		}
+		switch rule.action() {
+		case MaskActionMask, MaskActionHash, MaskActionDrop:
+		default:
+			return fmt.Errorf("invalid masking action: %s (must be mask, hash or drop)", rule.Action)
+		}
+	}
+	return nil
+}
+
+// maskResponse masks the sensitive fields of a JSON response of any status and returns the number of
+// masked fields by action. JSON responses that cannot be masked, because their content encoding is not
+// supported or they are too large, are rejected with an error so the fields never reach the client.
+func maskResponse(resp *http.Response, rules []MaskingRule) (map[string]int64, error) {
+	document, ok, err := readJSONResponse(resp)
+	if err != nil {
+		return nil, fmt.Errorf("cannot mask response: %w", err)
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	masked := make(map[string]int64)
+	for _, rule := range rules {
+		if count := maskPath(document, strings.Split(rule.Path, "."), rule); count > 0 {
+			masked[rule.action()] += int64(count)
+		}
+	}
+	if len(masked) == 0 {
+		return nil, nil
+	}
+	return masked, replaceJSONResponse(resp, document)
+}
+
+// maskPath masks the fields at a path of a JSON value in place and returns the number of masked fields
+func maskPath(value interface{}, path []string, rule MaskingRule) int {
+	switch v := value.(type) {
+	case []interface{}:
+		count := 0
+		for _, element := range v {
+			count += maskPath(element, path, rule)
+		}
+		return count
+	case map[string]interface{}:
+		names := []string{path[0]}
+		if path[0] == "*" {
+			names = names[:0]
+			for name := range v {
+				names = append(names, name)
+			}
+		}
+		count := 0
+		for _, name := range names {
+			fieldValue, ok := v[name]
+			if !ok {
+				continue
+			}
+			if len(path) > 1 {
+				count += maskPath(fieldValue, path[1:], rule)
+				continue
+			}
+			if rule.action() == MaskActionDrop {
+				delete(v, name)
+			} else {
+				v[name] = rule.mask(fieldValue)
+			}
+			count++
+		}
+		return count
+	default:
+		return 0
+	}
+}
+
+// mask returns the masked or hashed value of a field
+func (m MaskingRule) mask(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	text, ok := value.(string)
+	if !ok {
+		text = fmt.Sprint(value)
+	}
+	if m.action() == MaskActionHash {
+		sum := sha256.Sum256([]byte(text))
+		return hex.EncodeToString(sum[:])
+	}
+	if runes := []rune(text); m.KeepLast > 0 && len(runes) > m.KeepLast {
+		return maskedValue + string(runes[len(runes)-m.KeepLast:])
+	}
+	return maskedValue
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestResponseMasking tests that the sensitive fields of JSON responses are masked, hashed or dropped
+func TestResponseMasking(t *testing.T) {
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/gzip" {
+			w.Header().Set("Content-Encoding", "br")
+		}
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"customers":[{"email":"a@example.com","ssn":"123-45-6789","cards":{"main":{"number":"4111111111111111"}}},{"email":null}],"note":"<ok>"}`))
+	}))
+	defer backendServer.Close()
+
+	endpoint := Endpoint{
+		Path:    "/",
+		Backend: backendServer.URL,
+		Masking: []MaskingRule{
+			{Path: "customers.email", Action: MaskActionHash},
+			{Path: "customers.ssn", Action: MaskActionDrop},
+			{Path: "customers.cards.*.number", KeepLast: 4},
+			{Path: "missing.field"},
+		},
+	}
+	if err := validateMasking(endpoint.Masking); err != nil {
+		t.Fatalf("expected valid rules, got %v", err)
+	}
+	handler := NewProxy(endpoint, false, nil).Handler()
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("GET", "/customers", nil))
+	expected := `{"customers":[{"cards":{"main":{"number":"****1111"}},"email":"08168cd80dfd534ab0f10af10f1303fe00af2d43ab5c1432360d137f8197e17a"},{"email":null}],"note":"<ok>"}`
+	if rr.Code != http.StatusNotFound || rr.Body.String() != expected {
+		t.Errorf("expected the masked response %s, got %d %s", expected, rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("GET", "/gzip", nil))
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("expected a compressed response to be rejected, got %d", rr.Code)
+	}
+
+	if err := validateMasking([]MaskingRule{{Path: "email", Action: "redact"}}); err == nil {
+		t.Error("expected an invalid action to be rejected")
+	}
+}
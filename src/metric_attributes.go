@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// defaultMetricAttributeValue is the value recorded for values missing from the allowlist
+const defaultMetricAttributeValue = "other"
+
+// MetricAttributeConfig represents an extra request metric attribute taken from a header or a JWT claim
+type MetricAttributeConfig struct {
+	// Name is the attribute name, e.g. client_id
+	Name string `json:"name"`
+	// Header is the request header the value is taken from
+	Header string `json:"header"`
+	// Claim is the claim of the bearer token validated by jwt_auth the value is taken from
+	Claim string `json:"claim"`
+	// Values is the allowlist of recorded values, which keeps the metric cardinality bounded
+	Values []string `json:"values"`
+	// Default is the value recorded for missing values and values not in the allowlist (default "other")
+	Default string `json:"default"`
+}
+
+// MetricAttributes adds config-driven attributes to the request metrics
+type MetricAttributes struct {
+	configs []MetricAttributeConfig
+	allowed []map[string]bool
+}
+
+// NewMetricAttributes creates a new MetricAttributes and validates the configured attributes
+func NewMetricAttributes(configs []MetricAttributeConfig) (*MetricAttributes, error) {
+	m := &MetricAttributes{}
+	for _, config := range configs {
+		if config.Name == "" {
+			return nil, fmt.Errorf("metric attribute without a name")
+		}
+		if (config.Header == "") == (config.Claim == "") {
+			return nil, fmt.Errorf("metric attribute %s: exactly one of header and claim is required", config.Name)
+		}
+		if len(config.Values) == 0 {
+			return nil, fmt.Errorf("metric attribute %s: an allowlist of values is required", config.Name)
+		}
+		if config.Default == "" {
+			config.Default = defaultMetricAttributeValue
+		}
+
+		allowed := make(map[string]bool, len(config.Values))
+		for _, value := range config.Values {
+			allowed[value] = true
+		}
+		m.configs = append(m.configs, config)
+		m.allowed = append(m.allowed, allowed)
+	}
+	return m, nil
+}
+
+// Middleware adds the configured attributes to the request metrics. It runs after the authentication, so the
+// claims are only taken from tokens whose signature was verified.
+func (m *MetricAttributes) Middleware(endpoint Endpoint, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := JWTClaimsFromContext(r.Context())
+
+		attrs := make([]attribute.KeyValue, 0, len(m.configs))
+		for i, config := range m.configs {
+			value := r.Header.Get(config.Header)
+			if config.Claim != "" {
+				value = claimString(claims[config.Claim])
+			}
+			if !m.allowed[i][value] {
+				value = config.Default
+			}
+			attrs = append(attrs, attribute.String(config.Name, value))
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithMetricAttributes(r.Context(), attrs...)))
+	})
+}
+
+// unverifiedClaims returns the claims of the bearer token of a request without verifying its signature
+func unverifiedClaims(r *http.Request) map[string]interface{} {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return nil
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil
+	}
+	return claims
+}
+
+// claimString returns a string or number claim as a string
+func claimString(claim interface{}) string {
+	switch value := claim.(type) {
+	case string:
+		return value
+	case float64, bool:
+		return fmt.Sprint(value)
+	default:
+		return ""
+	}
+}
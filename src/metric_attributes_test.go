@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestMetricAttributes tests taking metric attributes from headers and verified token claims
+func TestMetricAttributes(t *testing.T) {
+	metricAttributes, err := NewMetricAttributes([]MetricAttributeConfig{
+		{Name: "client_id", Header: "X-Client-ID", Values: []string{"web", "mobile"}},
+		{Name: "tenant", Claim: "tenant", Values: []string{"acme"}, Default: "unknown"},
+	})
+	if err != nil {
+		t.Fatalf("NewMetricAttributes() error = %v", err)
+	}
+
+	var attributes map[string]string
+	handler := metricAttributes.Middleware(Endpoint{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attributes = make(map[string]string)
+		for _, attr := range MetricAttributesFromContext(r.Context()) {
+			attributes[string(attr.Key)] = attr.Value.AsString()
+		}
+	}))
+
+	token := "header." + base64.RawURLEncoding.EncodeToString([]byte(`{"tenant":"acme"}`)) + ".signature"
+	tests := []struct {
+		name     string
+		header   http.Header
+		claims   map[string]interface{}
+		clientID string
+		tenant   string
+	}{
+		{"allowed values", http.Header{"X-Client-Id": {"web"}}, map[string]interface{}{"tenant": "acme"}, "web", "acme"},
+		{"values outside the allowlist", http.Header{"X-Client-Id": {"curl"}}, map[string]interface{}{"tenant": "globex"}, "other", "unknown"},
+		{"unverified token", http.Header{"Authorization": {"Bearer " + token}}, nil, "other", "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api", nil)
+			req.Header = tt.header
+			if tt.claims != nil {
+				req = req.WithContext(context.WithValue(req.Context(), jwtClaimsKey{}, tt.claims))
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			if attributes["client_id"] != tt.clientID || attributes["tenant"] != tt.tenant {
+				t.Errorf("Expected client_id %q and tenant %q, got %v", tt.clientID, tt.tenant, attributes)
+			}
+		})
+	}
+
+	if _, err := NewMetricAttributes([]MetricAttributeConfig{{Name: "client_id", Header: "X-Client-ID"}}); err == nil {
+		t.Error("Expected error for an attribute without an allowlist")
+	}
+	if _, err := NewMetricAttributes([]MetricAttributeConfig{{Name: "client_id", Values: []string{"web"}}}); err == nil {
+		t.Error("Expected error for an attribute without a header or claim")
+	}
+}
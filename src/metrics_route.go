@@ -0,0 +1,30 @@
+package main
+
+import "net/http"
+
+// UnmatchedRoute is the http.route of the metrics of the requests no endpoint matches, served by the default
+// backend or answered with 404, so their paths never become metric labels
+const UnmatchedRoute = "unmatched"
+
+// otherMethod is the http.method of the metrics of the requests with a non-standard method
+const otherMethod = "_OTHER"
+
+// metricsRoute returns the http.route of the metrics of an endpoint: its path template, e.g. /api/users/:id,
+// never the path of a request
+func metricsRoute(endpoint Endpoint) string {
+	if endpoint.unmatched || endpoint.Path == "" {
+		return UnmatchedRoute
+	}
+	return endpoint.Path
+}
+
+// metricsMethod returns the http.method of the metrics of a request, counting the non-standard methods as
+// _OTHER so clients cannot create metric series with arbitrary methods
+func metricsMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+		http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return otherMethod
+}
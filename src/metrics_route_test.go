@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestMetricsRoute tests that the request metrics are labeled with the route templates, the requests no
+// endpoint matches with the unmatched route, and the non-standard methods with _OTHER
+func TestMetricsRoute(t *testing.T) {
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backendServer.Close()
+
+	telemetry, err := NewTelemetryManager(TelemetryConfig{Enabled: true, ServiceName: "test-service"})
+	if err != nil {
+		t.Fatalf("Failed to create TelemetryManager: %v", err)
+	}
+	defer telemetry.Shutdown(context.Background())
+
+	gateway := NewGateway(Config{
+		Endpoints: []Endpoint{{Path: "/api/users/:id", Backend: backendServer.URL, HasPathParams: true}},
+	}, telemetry)
+	if err := gateway.Initialize(); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	withDefaultBackend := NewGateway(Config{DefaultBackend: backendServer.URL}, telemetry)
+	if err := withDefaultBackend.Initialize(); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+
+	for _, request := range []struct {
+		gateway *Gateway
+		method  string
+		path    string
+		status  int
+	}{
+		{gateway, "GET", "/api/users/42", http.StatusOK},
+		{gateway, "PURGE", "/api/users/43", http.StatusOK},
+		{gateway, "GET", "/unknown/12345", http.StatusNotFound},
+		{withDefaultBackend, "GET", "/legacy/67890", http.StatusOK},
+	} {
+		rr := httptest.NewRecorder()
+		request.gateway.mux.ServeHTTP(rr, httptest.NewRequest(request.method, request.path, nil))
+		if rr.Code != request.status {
+			t.Fatalf("Expected status %d for %s %s, got %d", request.status, request.method, request.path, rr.Code)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	telemetry.GetMetricsHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	metrics := rr.Body.String()
+	for _, expected := range []string{
+		`http_route="/api/users/:id"`,
+		`http_method="_OTHER"`,
+		`http_route="unmatched",http_status_code="404"`,
+		`http_route="unmatched",http_status_code="200"`,
+	} {
+		if !strings.Contains(metrics, expected) {
+			t.Errorf("Expected the metrics to contain %s", expected)
+		}
+	}
+	for _, leaked := range []string{"/api/users/42", "/unknown/12345", "/legacy/67890", "PURGE"} {
+		if strings.Contains(metrics, leaked) {
+			t.Errorf("Expected the metrics not to contain %s", leaked)
+		}
+	}
+}
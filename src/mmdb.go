@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+)
+
+// mmdbMetadataMarker marks the start of the metadata section of a MaxMind DB file
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// MMDBReader reads MaxMind DB (.mmdb) files such as GeoLite2-Country and GeoLite2-ASN
+type MMDBReader struct {
+	buffer     []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	treeSize   uint
+	// ipv4Start is the node of the ::/96 subtree holding the IPv4 addresses of an IPv6 tree, computed once so
+	// the reader is read-only and safe for concurrent lookups
+	ipv4Start uint
+}
+
+// OpenMMDB loads a MaxMind DB file into memory
+func OpenMMDB(filePath string) (*MMDBReader, error) {
+	buffer, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read MaxMind DB file: %w", err)
+	}
+	return NewMMDBReader(buffer)
+}
+
+// NewMMDBReader creates a MMDBReader from the raw contents of a MaxMind DB file
+func NewMMDBReader(buffer []byte) (*MMDBReader, error) {
+	markerIndex := bytes.LastIndex(buffer, mmdbMetadataMarker)
+	if markerIndex < 0 {
+		return nil, errors.New("invalid MaxMind DB file: metadata marker not found")
+	}
+
+	// Decode the metadata map, pointers in the metadata are relative to its start
+	metadataStart := markerIndex + len(mmdbMetadataMarker)
+	decoder := mmdbDecoder{buffer: buffer[metadataStart:]}
+	value, _, err := decoder.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MaxMind DB metadata: %w", err)
+	}
+	metadata, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("invalid MaxMind DB metadata: not a map")
+	}
+
+	reader := &MMDBReader{
+		buffer:     buffer,
+		nodeCount:  uint(toUint64(metadata["node_count"])),
+		recordSize: uint(toUint64(metadata["record_size"])),
+		ipVersion:  uint(toUint64(metadata["ip_version"])),
+	}
+	if reader.recordSize != 24 && reader.recordSize != 28 && reader.recordSize != 32 {
+		return nil, fmt.Errorf("unsupported MaxMind DB record size: %d", reader.recordSize)
+	}
+	reader.treeSize = reader.nodeCount * reader.recordSize / 4
+	if reader.treeSize+16 > uint(markerIndex) {
+		return nil, errors.New("invalid MaxMind DB file: search tree exceeds file size")
+	}
+	if reader.ipVersion == 6 {
+		reader.ipv4Start = reader.ipv4StartNode()
+	}
+
+	return reader, nil
+}
+
+// Lookup returns the record stored for the given IP address, or nil if there is none
+func (m *MMDBReader) Lookup(ip net.IP) (map[string]interface{}, error) {
+	bitCount := 128
+	node := uint(0)
+
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		bitCount = 32
+		if m.ipVersion == 6 {
+			node = m.ipv4Start
+		}
+	} else if m.ipVersion == 4 {
+		return nil, nil
+	}
+
+	for i := 0; i < bitCount && node < m.nodeCount; i++ {
+		bit := uint(ip[i>>3]>>(7-uint(i%8))) & 1
+		node = m.readRecord(node, bit)
+	}
+
+	if node == m.nodeCount {
+		return nil, nil
+	}
+	if node < m.nodeCount {
+		return nil, errors.New("invalid MaxMind DB file: search tree is corrupt")
+	}
+
+	// Resolve the data section offset
+	dataStart := m.treeSize + 16
+	offset := node - m.nodeCount - 16
+	decoder := mmdbDecoder{buffer: m.buffer[dataStart:]}
+	value, _, err := decoder.decode(offset)
+	if err != nil {
+		return nil, err
+	}
+	record, _ := value.(map[string]interface{})
+	return record, nil
+}
+
+// ipv4StartNode returns the node of the ::/96 subtree holding IPv4 addresses in an IPv6 tree
+func (m *MMDBReader) ipv4StartNode() uint {
+	node := uint(0)
+	for i := 0; i < 96 && node < m.nodeCount; i++ {
+		node = m.readRecord(node, 0)
+	}
+	return node
+}
+
+// readRecord reads the left (bit 0) or right (bit 1) record of a search tree node
+func (m *MMDBReader) readRecord(node, bit uint) uint {
+	switch m.recordSize {
+	case 24:
+		offset := node*6 + bit*3
+		b := m.buffer[offset : offset+3]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		offset := node * 7
+		b := m.buffer[offset : offset+7]
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		offset := node*8 + bit*4
+		return uint(binary.BigEndian.Uint32(m.buffer[offset : offset+4]))
+	}
+}
+
+// mmdbDecoder decodes values from the data section of a MaxMind DB file
+type mmdbDecoder struct {
+	buffer []byte
+}
+
+// MaxMind DB data types
+const (
+	mmdbExtended  = 0
+	mmdbPointer   = 1
+	mmdbString    = 2
+	mmdbDouble    = 3
+	mmdbBytes     = 4
+	mmdbUint16    = 5
+	mmdbUint32    = 6
+	mmdbMap       = 7
+	mmdbInt32     = 8
+	mmdbUint64    = 9
+	mmdbUint128   = 10
+	mmdbArray     = 11
+	mmdbContainer = 12
+	mmdbEndMarker = 13
+	mmdbBoolean   = 14
+	mmdbFloat     = 15
+)
+
+// decode decodes the value at the given offset and returns it along with the offset of the next value
+func (d *mmdbDecoder) decode(offset uint) (interface{}, uint, error) {
+	if offset >= uint(len(d.buffer)) {
+		return nil, 0, errors.New("unexpected end of MaxMind DB data")
+	}
+
+	ctrl := d.buffer[offset]
+	offset++
+	dataType := uint(ctrl >> 5)
+
+	// Pointers have their own size encoding
+	if dataType == mmdbPointer {
+		pointer, next, err := d.decodePointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(pointer)
+		return value, next, err
+	}
+
+	if dataType == mmdbExtended {
+		if offset >= uint(len(d.buffer)) {
+			return nil, 0, errors.New("unexpected end of MaxMind DB data")
+		}
+		dataType = 7 + uint(d.buffer[offset])
+		offset++
+	}
+
+	size, offset, err := d.decodeSize(ctrl, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch dataType {
+	case mmdbMap:
+		result := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			var key, value interface{}
+			if key, offset, err = d.decode(offset); err != nil {
+				return nil, 0, err
+			}
+			if value, offset, err = d.decode(offset); err != nil {
+				return nil, 0, err
+			}
+			keyString, ok := key.(string)
+			if !ok {
+				return nil, 0, errors.New("invalid MaxMind DB map key")
+			}
+			result[keyString] = value
+		}
+		return result, offset, nil
+	case mmdbArray:
+		result := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			var value interface{}
+			if value, offset, err = d.decode(offset); err != nil {
+				return nil, 0, err
+			}
+			result = append(result, value)
+		}
+		return result, offset, nil
+	case mmdbBoolean:
+		return size != 0, offset, nil
+	case mmdbContainer, mmdbEndMarker:
+		return nil, offset, nil
+	}
+
+	if offset+size > uint(len(d.buffer)) {
+		return nil, 0, errors.New("unexpected end of MaxMind DB data")
+	}
+	data := d.buffer[offset : offset+size]
+	next := offset + size
+
+	switch dataType {
+	case mmdbString:
+		return string(data), next, nil
+	case mmdbBytes:
+		return append([]byte(nil), data...), next, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, errors.New("invalid MaxMind DB double size")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), next, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, errors.New("invalid MaxMind DB float size")
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(data)), next, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64, mmdbUint128:
+		var value uint64
+		for _, b := range data {
+			value = value<<8 | uint64(b)
+		}
+		return value, next, nil
+	case mmdbInt32:
+		var value uint32
+		for _, b := range data {
+			value = value<<8 | uint32(b)
+		}
+		return int32(value), next, nil
+	}
+
+	return nil, 0, fmt.Errorf("unknown MaxMind DB data type: %d", dataType)
+}
+
+// decodeSize decodes the payload size encoded in the control byte and the following bytes
+func (d *mmdbDecoder) decodeSize(ctrl byte, offset uint) (uint, uint, error) {
+	size := uint(ctrl & 0x1F)
+	if size < 29 {
+		return size, offset, nil
+	}
+
+	extraBytes := size - 28
+	if offset+extraBytes > uint(len(d.buffer)) {
+		return 0, 0, errors.New("unexpected end of MaxMind DB data")
+	}
+	var extra uint
+	for _, b := range d.buffer[offset : offset+extraBytes] {
+		extra = extra<<8 | uint(b)
+	}
+
+	switch size {
+	case 29:
+		return 29 + extra, offset + extraBytes, nil
+	case 30:
+		return 285 + extra, offset + extraBytes, nil
+	default:
+		return 65821 + extra, offset + extraBytes, nil
+	}
+}
+
+// decodePointer decodes a pointer and returns its target and the offset of the next value
+func (d *mmdbDecoder) decodePointer(ctrl byte, offset uint) (uint, uint, error) {
+	pointerSize := uint((ctrl>>3)&0x3) + 1
+	if offset+pointerSize > uint(len(d.buffer)) {
+		return 0, 0, errors.New("unexpected end of MaxMind DB data")
+	}
+
+	var pointer uint
+	if pointerSize != 4 {
+		pointer = uint(ctrl & 0x7)
+	}
+	for _, b := range d.buffer[offset : offset+pointerSize] {
+		pointer = pointer<<8 | uint(b)
+	}
+
+	switch pointerSize {
+	case 2:
+		pointer += 2048
+	case 3:
+		pointer += 526336
+	}
+
+	return pointer, offset + pointerSize, nil
+}
+
+// toUint64 converts a decoded unsigned value to uint64
+func toUint64(value interface{}) uint64 {
+	if v, ok := value.(uint64); ok {
+		return v
+	}
+	return 0
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// MultipartConfig represents the constraints on multipart/form-data request bodies, enforced while the body
+// is streamed to the backend
+type MultipartConfig struct {
+	// MaxFileBytes is the maximum size of a file part, larger files are rejected with 413 (0 is unlimited)
+	MaxFileBytes int64 `json:"max_file_bytes"`
+	// MaxParts is the maximum number of parts, requests with more parts are rejected with 413 (0 is unlimited)
+	MaxParts int `json:"max_parts"`
+	// AllowedContentTypes are the allowed content types of file parts, e.g. image/png or image/*, other files
+	// are rejected with 415 (all are allowed if empty)
+	AllowedContentTypes []string `json:"allowed_content_types"`
+}
+
+// enabled reports whether any constraint is configured
+func (c MultipartConfig) enabled() bool {
+	return c.MaxFileBytes > 0 || c.MaxParts > 0 || len(c.AllowedContentTypes) > 0
+}
+
+// allowsContentType reports whether a file part content type is allowed
+func (c MultipartConfig) allowsContentType(contentType string) bool {
+	if len(c.AllowedContentTypes) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range c.AllowedContentTypes {
+		allowed = strings.ToLower(allowed)
+		if allowed == mediaType || allowed == "*/*" {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// MultipartError is a violation of the multipart constraints of an endpoint
+type MultipartError struct {
+	Status int
+	Reason string
+}
+
+// Error returns the reason of the violation
+func (e *MultipartError) Error() string {
+	return "multipart constraint violated: " + e.Reason
+}
+
+// multipartBoundary returns the boundary of a multipart/form-data request, or an empty string for other requests
+func multipartBoundary(r *http.Request) string {
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		return ""
+	}
+	return params["boundary"]
+}
+
+// applyMultipartConstraints replaces the body of a multipart/form-data request with a stream that validates
+// each part before passing it on. A violation fails the stream with a MultipartError, so the backend never
+// receives the offending part.
+func applyMultipartConstraints(r *http.Request, config MultipartConfig) {
+	boundary := multipartBoundary(r)
+	if !config.enabled() || boundary == "" {
+		return
+	}
+
+	body := r.Body
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(copyMultipart(pw, body, boundary, config))
+	}()
+
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{pr, closerFunc(func() error {
+		pr.Close()
+		return body.Close()
+	})}
+	// The parts are written again with the same boundary, so the size of the body may change
+	r.ContentLength = -1
+	r.Header.Del("Content-Length")
+}
+
+// closerFunc adapts a function to io.Closer
+type closerFunc func() error
+
+// Close calls the function
+func (f closerFunc) Close() error {
+	return f()
+}
+
+// copyMultipart validates the parts of a multipart body while copying them to w
+func copyMultipart(w io.Writer, body io.Reader, boundary string, config MultipartConfig) error {
+	reader := multipart.NewReader(body, boundary)
+	writer := multipart.NewWriter(w)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return err
+	}
+
+	for parts := 1; ; parts++ {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			return writer.Close()
+		}
+		if err != nil {
+			return err
+		}
+
+		// Check the part before any of it is passed on
+		if config.MaxParts > 0 && parts > config.MaxParts {
+			return &MultipartError{Status: http.StatusRequestEntityTooLarge, Reason: fmt.Sprintf("more than %d parts", config.MaxParts)}
+		}
+		isFile := part.FileName() != ""
+		if isFile && !config.allowsContentType(part.Header.Get("Content-Type")) {
+			return &MultipartError{Status: http.StatusUnsupportedMediaType, Reason: fmt.Sprintf("file %q has content type %q", part.FileName(), part.Header.Get("Content-Type"))}
+		}
+
+		dst, err := writer.CreatePart(part.Header)
+		if err != nil {
+			return err
+		}
+		src := io.Reader(part)
+		limited := isFile && config.MaxFileBytes > 0
+		if limited {
+			src = io.LimitReader(part, config.MaxFileBytes)
+		}
+		if _, err := io.Copy(dst, src); err != nil {
+			return err
+		}
+		// A file with bytes left after the limit is too large, the remaining bytes are never passed on
+		if limited {
+			var extra [1]byte
+			if n, _ := io.ReadFull(part, extra[:]); n > 0 {
+				return &MultipartError{Status: http.StatusRequestEntityTooLarge, Reason: fmt.Sprintf("file %q is larger than %d bytes", part.FileName(), config.MaxFileBytes)}
+			}
+		}
+	}
+}
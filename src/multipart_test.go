@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// multipartFile is a file part of a test upload
+type multipartFile struct {
+	name        string
+	contentType string
+	size        int
+}
+
+// newMultipartRequest creates a multipart/form-data request with a form field and the files
+func newMultipartRequest(t *testing.T, files ...multipartFile) *http.Request {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	if err := writer.WriteField("title", "holiday"); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", `form-data; name="file"; filename="`+file.name+`"`)
+		header.Set("Content-Type", file.contentType)
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = part.Write([]byte(strings.Repeat("a", file.size)))
+	}
+	_ = writer.Close()
+
+	req := httptest.NewRequest("POST", "/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+// TestMultipartConstraints tests that multipart uploads violating the constraints are rejected
+// and that the backend never receives the offending files
+func TestMultipartConstraints(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reader, err := r.MultipartReader()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				break
+			}
+			if _, err := io.Copy(io.Discard, part); err != nil {
+				break
+			}
+			mu.Lock()
+			received = append(received, part.FileName())
+			mu.Unlock()
+		}
+	}))
+	defer backendServer.Close()
+
+	for _, buffering := range []string{RequestBufferingStream, RequestBufferingBuffer} {
+		handler := NewProxy(Endpoint{
+			Path:    "/upload",
+			Backend: backendServer.URL,
+			RequestBody: RequestBodyConfig{
+				Buffering: buffering,
+				Multipart: MultipartConfig{
+					MaxFileBytes:        500,
+					MaxParts:            3,
+					AllowedContentTypes: []string{"image/*", "application/pdf"},
+				},
+			},
+		}, false, nil).Handler()
+
+		tests := []struct {
+			name     string
+			files    []multipartFile
+			expected int
+		}{
+			{"allowed files", []multipartFile{{"a.png", "image/png", 500}, {"b.pdf", "application/pdf", 100}}, http.StatusOK},
+			{"file too large", []multipartFile{{"a.png", "image/png", 501}}, http.StatusRequestEntityTooLarge},
+			{"too many parts", []multipartFile{{"a.png", "image/png", 1}, {"b.png", "image/png", 1}, {"c.png", "image/png", 1}}, http.StatusRequestEntityTooLarge},
+			{"disallowed content type", []multipartFile{{"a.exe", "application/octet-stream", 100}}, http.StatusUnsupportedMediaType},
+		}
+		for _, test := range tests {
+			mu.Lock()
+			received = nil
+			mu.Unlock()
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, newMultipartRequest(t, test.files...))
+			if rr.Code != test.expected {
+				t.Errorf("%s: %s: expected status %d, got %d", buffering, test.name, test.expected, rr.Code)
+			}
+
+			mu.Lock()
+			for _, name := range received {
+				if test.expected != http.StatusOK && name == test.files[len(test.files)-1].name {
+					t.Errorf("%s: %s: backend received the rejected file", buffering, test.name)
+				}
+			}
+			mu.Unlock()
+		}
+	}
+
+	// Other bodies are passed through unchanged
+	handler := NewProxy(Endpoint{
+		Path:        "/upload",
+		Backend:     backendServer.URL,
+		RequestBody: RequestBodyConfig{Multipart: MultipartConfig{MaxParts: 1}},
+	}, false, nil).Handler()
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/upload", strings.NewReader(`{"a":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected the backend to reject the JSON body as not multipart, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Operational event types sent to the notification webhooks
+const (
+	EventBackendEjected      = "backend_ejected"
+	EventConfigReloadFailed  = "config_reload_failed"
+	EventSLOBurnRate         = "slo_burn_rate"
+	EventCertificateExpiring = "certificate_expiring"
+	EventBlueGreenRollback   = "blue_green_rollback"
+)
+
+// NotificationsConfig represents the webhooks notified of operational events
+type NotificationsConfig struct {
+	Webhooks []WebhookConfig `json:"webhooks"`
+}
+
+// WebhookConfig represents a webhook receiving operational events
+type WebhookConfig struct {
+	URL string `json:"url"`
+	// Format is the payload format, generic (the event as JSON, default) or slack (an incoming webhook message)
+	Format string `json:"format"`
+	// Events lists the event types sent to the webhook (all events if empty)
+	Events []string `json:"events"`
+	// Headers are added to the webhook requests, e.g. for authentication
+	Headers map[string]string `json:"headers"`
+}
+
+// Event is an operational event such as a backend instance being ejected
+type Event struct {
+	Type      string                 `json:"type"`
+	Timestamp time.Time              `json:"timestamp"`
+	Message   string                 `json:"message"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// Notifier sends operational events to the configured webhooks
+type Notifier struct {
+	webhooks []WebhookConfig
+	client   *http.Client
+}
+
+// NewNotifier creates a new Notifier for the configured webhooks
+func NewNotifier(config NotificationsConfig) *Notifier {
+	for _, webhook := range config.Webhooks {
+		if webhook.Format != "" && webhook.Format != "generic" && webhook.Format != "slack" {
+			LogError("Unknown webhook format, sending generic payloads", nil, map[string]interface{}{
+				"url":    webhook.URL,
+				"format": webhook.Format,
+			})
+		}
+	}
+	return &Notifier{
+		webhooks: config.Webhooks,
+		client:   &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Notify sends an event to the webhooks subscribed to its type in the background
+func (n *Notifier) Notify(event Event) {
+	if n == nil {
+		return
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+
+	for _, webhook := range n.webhooks {
+		if len(webhook.Events) > 0 && !containsString(webhook.Events, event.Type) {
+			continue
+		}
+		go func(webhook WebhookConfig) {
+			if err := postWebhook(n.client, webhook.URL, webhook.Headers, webhookPayload(webhook.Format, event)); err != nil {
+				LogError("Failed to send webhook notification", err, map[string]interface{}{
+					"url":   webhook.URL,
+					"event": event.Type,
+				})
+			}
+		}(webhook)
+	}
+}
+
+// webhookPayload returns the payload of an event in the given webhook format
+func webhookPayload(format string, event Event) interface{} {
+	if format != "slack" {
+		return event
+	}
+
+	// Slack incoming webhooks expect a message text
+	text := fmt.Sprintf("*%s*: %s", event.Type, event.Message)
+	keys := make([]string, 0, len(event.Details))
+	for key := range event.Details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	lines := []string{text}
+	for _, key := range keys {
+		lines = append(lines, fmt.Sprintf("• %s: %v", key, event.Details[key]))
+	}
+	return map[string]string{"text": strings.Join(lines, "\n")}
+}
+
+// postWebhook posts a JSON payload to a webhook URL
+func postWebhook(client *http.Client, webhookURL string, headers map[string]string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// TestNotifier tests sending events to generic and Slack webhooks
+func TestNotifier(t *testing.T) {
+	var mu sync.Mutex
+	received := make(map[string][]map[string]interface{})
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		payload["authorization"] = r.Header.Get("Authorization")
+		mu.Lock()
+		defer mu.Unlock()
+		received[r.URL.Path] = append(received[r.URL.Path], payload)
+	}))
+	defer webhookServer.Close()
+
+	notifier := NewNotifier(NotificationsConfig{Webhooks: []WebhookConfig{
+		{URL: webhookServer.URL + "/generic", Headers: map[string]string{"Authorization": "Bearer secret"}},
+		{URL: webhookServer.URL + "/slack", Format: "slack", Events: []string{EventBackendEjected}},
+	}})
+	notifier.Notify(Event{Type: EventBackendEjected, Message: "Backend instance ejected", Details: map[string]interface{}{"instance": "http://a:80"}})
+	notifier.Notify(Event{Type: EventConfigReloadFailed, Message: "Kubernetes sync failed"})
+
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received["/generic"]) == 2 && len(received["/slack"]) == 1
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, payload := range received["/generic"] {
+		if payload["type"] == "" || payload["timestamp"] == "" || payload["authorization"] != "Bearer secret" {
+			t.Errorf("Unexpected generic payload %v", payload)
+		}
+	}
+	if text := received["/slack"][0]["text"]; text != "*backend_ejected*: Backend instance ejected\n• instance: http://a:80" {
+		t.Errorf("Unexpected Slack message %q", text)
+	}
+
+	// A nil notifier discards events
+	var disabled *Notifier
+	disabled.Notify(Event{Type: EventBackendEjected})
+}
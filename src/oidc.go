@@ -0,0 +1,475 @@
+package main
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Default OIDC login settings
+const (
+	defaultOIDCCookieName      = "surfboard_session"
+	defaultOIDCSessionLifetime = 8 * 3600 * 1000
+	oidcFlowLifetime           = 10 * time.Minute
+)
+
+// defaultOIDCIdentityHeaders maps the ID token claims forwarded upstream if none are configured
+var defaultOIDCIdentityHeaders = map[string]string{
+	"sub":   "X-Auth-Subject",
+	"email": "X-Auth-Email",
+}
+
+// OIDCConfig represents the OpenID Connect login of browser users in front of the endpoints with oidc_login
+type OIDCConfig struct {
+	Enabled bool `json:"enabled"`
+	// Issuer is the issuer URL of the identity provider, used for discovery
+	Issuer       string `json:"issuer"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	// RedirectURL is the callback URL registered at the identity provider, e.g. https://gateway/oauth2/callback
+	RedirectURL string `json:"redirect_url"`
+	// Scopes are the requested scopes (default openid, profile and email)
+	Scopes []string `json:"scopes"`
+	// CookieSecret is the secret the session cookie is encrypted with
+	CookieSecret string `json:"cookie_secret"`
+	// CookieName is the name of the session cookie (default surfboard_session)
+	CookieName string `json:"cookie_name"`
+	// SessionLifetime is the maximum session lifetime in milliseconds (default 8 hours)
+	SessionLifetime int `json:"session_lifetime"`
+	// IdentityHeaders maps ID token claims to the headers forwarded upstream (default sub and email)
+	IdentityHeaders map[string]string `json:"identity_headers"`
+}
+
+// oidcDiscovery is the subset of the provider metadata used by the gateway
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcSession is the content of the encrypted session cookie
+type oidcSession struct {
+	Claims  map[string]string `json:"claims"`
+	Expires int64             `json:"exp"`
+}
+
+// oidcFlow is the content of the encrypted cookie holding the state of a login in progress
+type oidcFlow struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	ReturnTo string `json:"return_to"`
+	Expires  int64  `json:"exp"`
+}
+
+// OIDCLogin authenticates browser users with the OpenID Connect authorization code flow and
+// keeps their identity in an encrypted session cookie
+type OIDCLogin struct {
+	config       OIDCConfig
+	provider     oidcDiscovery
+	callbackPath string
+	secure       bool
+	aead         cipher.AEAD
+	client       *http.Client
+	now          func() time.Time
+	keys         *jwksCache
+}
+
+// NewOIDCLogin creates a new OIDCLogin, discovering the endpoints of the identity provider
+func NewOIDCLogin(config OIDCConfig) (*OIDCLogin, error) {
+	if config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+		return nil, fmt.Errorf("OIDC issuer, client ID and redirect URL are required")
+	}
+	if len(config.CookieSecret) < 16 {
+		return nil, fmt.Errorf("OIDC cookie secret must be at least 16 characters")
+	}
+	redirectURL, err := url.Parse(config.RedirectURL)
+	if err != nil || redirectURL.Path == "" {
+		return nil, fmt.Errorf("invalid OIDC redirect URL: %s", config.RedirectURL)
+	}
+	if config.CookieName == "" {
+		config.CookieName = defaultOIDCCookieName
+	}
+	if config.SessionLifetime <= 0 {
+		config.SessionLifetime = defaultOIDCSessionLifetime
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "profile", "email"}
+	}
+	if len(config.IdentityHeaders) == 0 {
+		config.IdentityHeaders = defaultOIDCIdentityHeaders
+	}
+
+	// Derive the cookie encryption key from the secret
+	key := sha256.Sum256([]byte(config.CookieSecret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &OIDCLogin{
+		config:       config,
+		callbackPath: redirectURL.Path,
+		secure:       redirectURL.Scheme == "https",
+		aead:         aead,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		now:          time.Now,
+	}
+	if err := o.getJSON(strings.TrimSuffix(config.Issuer, "/")+"/.well-known/openid-configuration", &o.provider); err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+	if o.provider.AuthorizationEndpoint == "" || o.provider.TokenEndpoint == "" || o.provider.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC discovery document of %s is incomplete", config.Issuer)
+	}
+	if o.provider.Issuer == "" {
+		o.provider.Issuer = config.Issuer
+	}
+	o.keys = &jwksCache{url: o.provider.JWKSURI, client: o.client, now: func() time.Time { return o.now() }}
+	return o, nil
+}
+
+// getJSON fetches a JSON document from the identity provider
+func (o *OIDCLogin) getJSON(target string, v interface{}) error {
+	resp, err := o.client.Get(target)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", target, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Middleware forwards the identity of logged in users upstream and redirects other browser requests to the
+// identity provider, for the endpoints with oidc_login
+func (o *OIDCLogin) Middleware(endpoint Endpoint, next http.Handler) http.Handler {
+	if !endpoint.OIDCLogin {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Clients must not be able to send the identity headers themselves
+		for _, header := range o.config.IdentityHeaders {
+			r.Header.Del(header)
+		}
+
+		var session oidcSession
+		if cookie, err := r.Cookie(o.config.CookieName); err == nil && o.decrypt(cookie.Value, &session) == nil &&
+			o.now().Unix() < session.Expires {
+			for claim, header := range o.config.IdentityHeaders {
+				if value, ok := session.Claims[claim]; ok {
+					r.Header.Set(header, value)
+				}
+			}
+			removeCookie(r, o.config.CookieName)
+			next.ServeHTTP(w, withAuthenticatedCaller(r))
+			return
+		}
+
+		// Only browser navigations are redirected to the login, API clients get a 401
+		if r.Method != http.MethodGet || !strings.Contains(r.Header.Get("Accept"), "text/html") {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err := o.startLogin(w, r); err != nil {
+			LogError("Failed to start OIDC login", err, map[string]interface{}{
+				"path": r.URL.Path,
+			})
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+	})
+}
+
+// startLogin redirects the browser to the identity provider, keeping the login state in a cookie
+func (o *OIDCLogin) startLogin(w http.ResponseWriter, r *http.Request) error {
+	flow := oidcFlow{
+		State:    randomToken(),
+		Nonce:    randomToken(),
+		Verifier: randomToken() + randomToken(),
+		ReturnTo: r.URL.RequestURI(),
+		Expires:  o.now().Add(oidcFlowLifetime).Unix(),
+	}
+	value, err := o.encrypt(flow)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, o.cookie(o.flowCookieName(), value, int(oidcFlowLifetime.Seconds())))
+
+	challenge := sha256.Sum256([]byte(flow.Verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {o.config.ClientID},
+		"redirect_uri":          {o.config.RedirectURL},
+		"scope":                 {strings.Join(o.config.Scopes, " ")},
+		"state":                 {flow.State},
+		"nonce":                 {flow.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(o.provider.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	http.Redirect(w, r, o.provider.AuthorizationEndpoint+separator+query.Encode(), http.StatusFound)
+	return nil
+}
+
+// CallbackHandler completes the login: it exchanges the authorization code, verifies the ID token and
+// sets the session cookie
+func (o *OIDCLogin) CallbackHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var flow oidcFlow
+		cookie, err := r.Cookie(o.flowCookieName())
+		if err != nil || o.decrypt(cookie.Value, &flow) != nil || o.now().Unix() >= flow.Expires {
+			http.Error(w, "Login expired, please try again", http.StatusBadRequest)
+			return
+		}
+		if r.URL.Query().Get("state") != flow.State {
+			LogAudit("OIDC login with invalid state", map[string]interface{}{
+				"remote_addr": r.RemoteAddr,
+			})
+			http.Error(w, "Invalid login state", http.StatusBadRequest)
+			return
+		}
+		if errorCode := r.URL.Query().Get("error"); errorCode != "" {
+			LogWarn("OIDC login failed", map[string]interface{}{
+				"error":       errorCode,
+				"description": r.URL.Query().Get("error_description"),
+			})
+			http.Error(w, "Login failed", http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := o.exchange(r.URL.Query().Get("code"), flow)
+		if err != nil {
+			LogError("OIDC login failed", err, map[string]interface{}{
+				"remote_addr": r.RemoteAddr,
+			})
+			http.Error(w, "Login failed", http.StatusUnauthorized)
+			return
+		}
+
+		// Keep the identity claims in the session
+		session := oidcSession{
+			Claims:  make(map[string]string, len(o.config.IdentityHeaders)),
+			Expires: o.now().Add(time.Duration(o.config.SessionLifetime) * time.Millisecond).Unix(),
+		}
+		for claim := range o.config.IdentityHeaders {
+			if value := claimString(claims[claim]); value != "" {
+				session.Claims[claim] = value
+			}
+		}
+		value, err := o.encrypt(session)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		http.SetCookie(w, o.cookie(o.config.CookieName, value, o.config.SessionLifetime/1000))
+		http.SetCookie(w, o.cookie(o.flowCookieName(), "", -1))
+
+		LogAudit("OIDC login", map[string]interface{}{
+			"subject":     session.Claims["sub"],
+			"remote_addr": r.RemoteAddr,
+		})
+
+		// Only redirect to local paths to avoid open redirects
+		returnTo := flow.ReturnTo
+		if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") {
+			returnTo = "/"
+		}
+		http.Redirect(w, r, returnTo, http.StatusFound)
+	})
+}
+
+// exchange redeems the authorization code at the token endpoint and returns the verified ID token claims
+func (o *OIDCLogin) exchange(code string, flow oidcFlow) (map[string]interface{}, error) {
+	if code == "" {
+		return nil, errors.New("missing authorization code")
+	}
+	resp, err := o.client.PostForm(o.provider.TokenEndpoint, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {o.config.RedirectURL},
+		"client_id":     {o.config.ClientID},
+		"client_secret": {o.config.ClientSecret},
+		"code_verifier": {flow.Verifier},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("token endpoint returned status %d: %s", resp.StatusCode, body)
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+	claims, err := o.verifyIDToken(tokens.IDToken)
+	if err != nil {
+		return nil, err
+	}
+	if claims["nonce"] != flow.Nonce {
+		return nil, errors.New("ID token nonce mismatch")
+	}
+	return claims, nil
+}
+
+// verifyIDToken verifies the RS256 signature, issuer, audience and expiry of an ID token
+func (o *OIDCLogin) verifyIDToken(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed ID token")
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.New("malformed ID token header")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, errors.New("malformed ID token header")
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unsupported ID token algorithm: %s", header.Alg)
+	}
+
+	key, err := o.keys.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed ID token signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, errors.New("invalid ID token signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("malformed ID token payload")
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errors.New("malformed ID token payload")
+	}
+
+	if claims["iss"] != o.provider.Issuer {
+		return nil, fmt.Errorf("unexpected ID token issuer: %v", claims["iss"])
+	}
+	if !audienceContains(claims["aud"], o.config.ClientID) {
+		return nil, errors.New("ID token audience mismatch")
+	}
+	exp, _ := claims["exp"].(float64)
+	if o.now().Unix() >= int64(exp) {
+		return nil, errors.New("ID token expired")
+	}
+	return claims, nil
+}
+
+// audienceContains checks whether an aud claim, a string or an array, contains the client ID
+func audienceContains(aud interface{}, clientID string) bool {
+	switch value := aud.(type) {
+	case string:
+		return value == clientID
+	case []interface{}:
+		for _, v := range value {
+			if v == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// flowCookieName returns the name of the cookie holding the state of a login in progress
+func (o *OIDCLogin) flowCookieName() string {
+	return o.config.CookieName + "_login"
+}
+
+// cookie creates a session cookie, a negative max age deletes it
+func (o *OIDCLogin) cookie(name, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   o.secure,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// encrypt serializes and encrypts a cookie value
+func (o *OIDCLogin) encrypt(v interface{}) (string, error) {
+	plaintext, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, o.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(o.aead.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+// decrypt decrypts and deserializes a cookie value
+func (o *OIDCLogin) decrypt(value string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(data) < o.aead.NonceSize() {
+		return errors.New("malformed cookie")
+	}
+	plaintext, err := o.aead.Open(nil, data[:o.aead.NonceSize()], data[o.aead.NonceSize():], nil)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(plaintext, v)
+}
+
+// removeCookie removes a cookie from a request so it is not forwarded upstream
+func removeCookie(r *http.Request, name string) {
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, cookie := range cookies {
+		if cookie.Name != name {
+			r.AddCookie(cookie)
+		}
+	}
+}
+
+// randomToken returns a random URL-safe token
+func randomToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// RegisterOIDCCallback adds the endpoint completing OIDC logins at the path of the redirect URL
+func (g *Gateway) RegisterOIDCCallback(login *OIDCLogin) {
+	g.handle(login.callbackPath, SecurityHeadersMiddleware(g.securityHeaders(nil), login.CallbackHandler()), nil)
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeIdentityProvider is an OpenID Connect provider issuing RS256 ID tokens for a fixed subject
+type fakeIdentityProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	// nonce and challenge are the nonce and PKCE code challenge of the last authorization request
+	nonce     string
+	challenge string
+}
+
+func newFakeIdentityProvider(t *testing.T) *fakeIdentityProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &fakeIdentityProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if r.PostFormValue("code") != "valid-code" || base64.RawURLEncoding.EncodeToString(verifier[:]) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"id_token": idp.idToken(t, map[string]interface{}{
+			"iss":   idp.server.URL,
+			"aud":   "gateway",
+			"sub":   "alice",
+			"email": "alice@example.com",
+			"nonce": idp.nonce,
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		})})
+	})
+	idp.server = httptest.NewServer(mux)
+	return idp
+}
+
+// idToken signs the claims as an RS256 JWT
+func (idp *fakeIdentityProvider) idToken(t *testing.T, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// TestOIDCLogin tests the login flow from the redirect to the identity provider to the forwarded identity
+func TestOIDCLogin(t *testing.T) {
+	idp := newFakeIdentityProvider(t)
+	defer idp.server.Close()
+
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("surfboard_session"); err == nil {
+			t.Error("The session cookie must not be forwarded upstream")
+		}
+		_, _ = w.Write([]byte(r.Header.Get("X-Auth-Subject") + " " + r.Header.Get("X-Auth-Email")))
+	}))
+	defer backendServer.Close()
+
+	login, err := NewOIDCLogin(OIDCConfig{
+		Issuer:       idp.server.URL,
+		ClientID:     "gateway",
+		ClientSecret: "secret",
+		RedirectURL:  "http://gateway/oauth2/callback",
+		CookieSecret: "0123456789abcdef",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create OIDC login: %v", err)
+	}
+	gateway := NewGateway(Config{
+		Endpoints: []Endpoint{{Path: "/ui/", Backend: backendServer.URL, OIDCLogin: true}},
+	}, nil)
+	gateway.Use(login.Middleware)
+	gateway.RegisterEndpoints()
+	gateway.RegisterOIDCCallback(login)
+
+	// API clients are rejected
+	rr := httptest.NewRecorder()
+	gateway.mux.ServeHTTP(rr, httptest.NewRequest("GET", "/ui/dashboard", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for API clients, got %d", rr.Code)
+	}
+
+	// Browsers are redirected to the identity provider
+	req := httptest.NewRequest("GET", "/ui/dashboard?tab=1", nil)
+	req.Header.Set("Accept", "text/html")
+	rr = httptest.NewRecorder()
+	gateway.mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusFound {
+		t.Fatalf("Expected redirect to the identity provider, got %d", rr.Code)
+	}
+	location, _ := url.Parse(rr.Header().Get("Location"))
+	if !strings.HasPrefix(location.String(), idp.server.URL+"/authorize") {
+		t.Fatalf("Unexpected login redirect: %s", location)
+	}
+	idp.nonce = location.Query().Get("nonce")
+	idp.challenge = location.Query().Get("code_challenge")
+	flowCookies := rr.Result().Cookies()
+
+	// A callback with an invalid state is rejected
+	req = httptest.NewRequest("GET", "/oauth2/callback?code=valid-code&state=forged", nil)
+	for _, cookie := range flowCookies {
+		req.AddCookie(cookie)
+	}
+	rr = httptest.NewRecorder()
+	gateway.mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid state, got %d", rr.Code)
+	}
+
+	// The callback sets the session cookie and returns to the original page
+	req = httptest.NewRequest("GET", "/oauth2/callback?code=valid-code&state="+location.Query().Get("state"), nil)
+	for _, cookie := range flowCookies {
+		req.AddCookie(cookie)
+	}
+	rr = httptest.NewRecorder()
+	gateway.mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusFound || rr.Header().Get("Location") != "/ui/dashboard?tab=1" {
+		t.Fatalf("Expected redirect to the original page, got %d %s: %s", rr.Code, rr.Header().Get("Location"), rr.Body.String())
+	}
+	var session *http.Cookie
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == "surfboard_session" {
+			session = cookie
+		}
+	}
+	if session == nil || !session.HttpOnly {
+		t.Fatal("Expected an HttpOnly session cookie")
+	}
+
+	// The session identity is forwarded upstream, spoofed identity headers are replaced
+	req = httptest.NewRequest("GET", "/ui/dashboard", nil)
+	req.Header.Set("X-Auth-Subject", "mallory")
+	req.AddCookie(session)
+	rr = httptest.NewRecorder()
+	gateway.mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || rr.Body.String() != "alice alice@example.com" {
+		t.Errorf("Expected the identity to be forwarded, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	// A tampered session cookie is rejected
+	req = httptest.NewRequest("GET", "/ui/dashboard", nil)
+	req.AddCookie(&http.Cookie{Name: "surfboard_session", Value: session.Value[:len(session.Value)-2] + "AA"})
+	rr = httptest.NewRecorder()
+	gateway.mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for a tampered session, got %d", rr.Code)
+	}
+}
+
+// TestOIDCLoginCache tests that the responses personalized with the identity of a session are not cached
+func TestOIDCLoginCache(t *testing.T) {
+	idp := newFakeIdentityProvider(t)
+	defer idp.server.Close()
+
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte(r.Header.Get("X-Auth-Subject")))
+	}))
+	defer backendServer.Close()
+
+	login, err := NewOIDCLogin(OIDCConfig{
+		Issuer:       idp.server.URL,
+		ClientID:     "gateway",
+		ClientSecret: "secret",
+		RedirectURL:  "http://gateway/oauth2/callback",
+		CookieSecret: "0123456789abcdef",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create OIDC login: %v", err)
+	}
+	gateway := NewGateway(Config{
+		Endpoints: []Endpoint{{Path: "/ui/", Backend: backendServer.URL, OIDCLogin: true, Cache: EndpointCacheConfig{Enabled: true}}},
+	}, nil)
+	gateway.Use(login.Middleware)
+	gateway.RegisterEndpoints()
+
+	serve := func(subject string) *httptest.ResponseRecorder {
+		value, err := login.encrypt(oidcSession{
+			Claims:  map[string]string{"sub": subject},
+			Expires: time.Now().Add(time.Hour).Unix(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest("GET", "/ui/profile", nil)
+		req.AddCookie(&http.Cookie{Name: "surfboard_session", Value: value})
+		rr := httptest.NewRecorder()
+		gateway.mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := serve("alice"); rr.Body.String() != "alice" || rr.Header().Get("X-Cache") != "" {
+		t.Errorf("Expected the session request to bypass the cache, got %q %q", rr.Header().Get("X-Cache"), rr.Body.String())
+	}
+	if rr := serve("bob"); rr.Body.String() != "bob" {
+		t.Errorf("Expected the response personalized for bob, got %q", rr.Body.String())
+	}
+}
+
+// TestOIDCVerifyIDToken tests the rejection of ID tokens with an invalid issuer, audience or expiry
+func TestOIDCVerifyIDToken(t *testing.T) {
+	idp := newFakeIdentityProvider(t)
+	defer idp.server.Close()
+
+	login, err := NewOIDCLogin(OIDCConfig{
+		Issuer:       idp.server.URL,
+		ClientID:     "gateway",
+		RedirectURL:  "https://gateway/oauth2/callback",
+		CookieSecret: "0123456789abcdef",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create OIDC login: %v", err)
+	}
+
+	valid := map[string]interface{}{"iss": idp.server.URL, "aud": []string{"other", "gateway"}, "exp": time.Now().Add(time.Hour).Unix()}
+	if _, err := login.verifyIDToken(idp.idToken(t, valid)); err != nil {
+		t.Errorf("Expected valid ID token, got %v", err)
+	}
+
+	tests := map[string]map[string]interface{}{
+		"issuer":   {"iss": "https://evil.example.com", "aud": "gateway", "exp": time.Now().Add(time.Hour).Unix()},
+		"audience": {"iss": idp.server.URL, "aud": "other", "exp": time.Now().Add(time.Hour).Unix()},
+		"expiry":   {"iss": idp.server.URL, "aud": "gateway", "exp": time.Now().Add(-time.Minute).Unix()},
+	}
+	for name, claims := range tests {
+		if _, err := login.verifyIDToken(idp.idToken(t, claims)); err == nil {
+			t.Errorf("Expected ID token with invalid %s to be rejected", name)
+		}
+	}
+
+	// A token signed by another key is rejected
+	other := &fakeIdentityProvider{}
+	other.key, _ = rsa.GenerateKey(rand.Reader, 2048)
+	if _, err := login.verifyIDToken(other.idToken(t, valid)); err == nil {
+		t.Error("Expected ID token with invalid signature to be rejected")
+	}
+}
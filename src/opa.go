@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default OPA settings
+const (
+	defaultOPATimeout     = 1000
+	defaultOPAPolicyID    = "surfboard"
+	maxOPADecisionsCached = 10000
+)
+
+// OPAConfig represents the authorization of requests by an Open Policy Agent server
+type OPAConfig struct {
+	Enabled bool `json:"enabled"`
+	// URL is the base URL of the OPA server, e.g. http://localhost:8181
+	URL string `json:"url"`
+	// DecisionPath is the path of the policy decision below /v1/data, e.g. surfboard/authz
+	DecisionPath string `json:"decision_path"`
+	// PolicyFile is a Rego policy bundled with the gateway and uploaded to the OPA server at startup
+	PolicyFile string `json:"policy_file"`
+	// Timeout is the timeout in milliseconds of a decision request (default 1000)
+	Timeout int `json:"timeout"`
+	// CacheTTL is the time in milliseconds decisions are cached for identical inputs (0 disables caching)
+	CacheTTL int `json:"cache_ttl"`
+	// FailOpen allows requests when the OPA server cannot be reached
+	FailOpen bool `json:"fail_open"`
+}
+
+// OPAInput is the input document of a policy decision
+type OPAInput struct {
+	Method   string                 `json:"method"`
+	Path     string                 `json:"path"`
+	Route    string                 `json:"route"`
+	Host     string                 `json:"host"`
+	Query    map[string][]string    `json:"query"`
+	Headers  map[string]string      `json:"headers"`
+	Claims   map[string]interface{} `json:"claims,omitempty"`
+	ClientIP string                 `json:"client_ip"`
+}
+
+// OPADecision is the outcome of a policy decision
+type OPADecision struct {
+	Allow   bool     `json:"allow"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// opaCachedDecision is a cached decision and its expiry
+type opaCachedDecision struct {
+	decision OPADecision
+	expires  time.Time
+}
+
+// OPAAuthorizer authorizes requests against an OPA policy
+type OPAAuthorizer struct {
+	config OPAConfig
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]opaCachedDecision
+	now   func() time.Time
+}
+
+// NewOPAAuthorizer creates a new OPAAuthorizer, uploading the bundled policy if configured
+func NewOPAAuthorizer(config OPAConfig) (*OPAAuthorizer, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("OPA URL is required")
+	}
+	if config.DecisionPath == "" {
+		return nil, fmt.Errorf("OPA decision path is required")
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultOPATimeout
+	}
+	config.URL = strings.TrimSuffix(config.URL, "/")
+	config.DecisionPath = strings.Trim(config.DecisionPath, "/")
+
+	a := &OPAAuthorizer{
+		config: config,
+		client: &http.Client{Timeout: time.Duration(config.Timeout) * time.Millisecond},
+		cache:  make(map[[sha256.Size]byte]opaCachedDecision),
+		now:    time.Now,
+	}
+
+	if config.PolicyFile != "" {
+		if err := a.uploadPolicy(); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// uploadPolicy uploads the bundled Rego policy to the OPA server
+func (a *OPAAuthorizer) uploadPolicy() error {
+	policy, err := os.ReadFile(a.config.PolicyFile)
+	if err != nil {
+		return fmt.Errorf("failed to read OPA policy: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, a.config.URL+"/v1/policies/"+defaultOPAPolicyID, bytes.NewReader(policy))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload OPA policy: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to upload OPA policy: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// newOPAInput builds the policy input of a request
+func newOPAInput(endpoint Endpoint, r *http.Request) OPAInput {
+	headers := make(map[string]string, len(r.Header))
+	for name := range r.Header {
+		headers[strings.ToLower(name)] = r.Header.Get(name)
+	}
+	var clientIP string
+	if ip := ClientIP(r, false); ip != nil {
+		clientIP = ip.String()
+	}
+	return OPAInput{
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		Route:    endpoint.Path,
+		Host:     r.Host,
+		Query:    r.URL.Query(),
+		Headers:  headers,
+		Claims:   unverifiedClaims(r),
+		ClientIP: clientIP,
+	}
+}
+
+// Decide evaluates the policy for an input, using a cached decision if available
+func (a *OPAAuthorizer) Decide(ctx context.Context, input OPAInput) (OPADecision, error) {
+	body, err := json.Marshal(map[string]interface{}{"input": input})
+	if err != nil {
+		return OPADecision{}, err
+	}
+
+	key := sha256.Sum256(body)
+	if a.config.CacheTTL > 0 {
+		a.mu.Lock()
+		cached, ok := a.cache[key]
+		a.mu.Unlock()
+		if ok && a.now().Before(cached.expires) {
+			return cached.decision, nil
+		}
+	}
+
+	decision, err := a.query(ctx, body)
+	if err != nil {
+		return OPADecision{}, err
+	}
+
+	if a.config.CacheTTL > 0 {
+		a.mu.Lock()
+		// Drop all decisions rather than tracking their age when the cache is full
+		if len(a.cache) >= maxOPADecisionsCached {
+			a.cache = make(map[[sha256.Size]byte]opaCachedDecision)
+		}
+		a.cache[key] = opaCachedDecision{
+			decision: decision,
+			expires:  a.now().Add(time.Duration(a.config.CacheTTL) * time.Millisecond),
+		}
+		a.mu.Unlock()
+	}
+	return decision, nil
+}
+
+// query sends a decision request to the OPA server. The decision result is either a boolean
+// or an object with an allow boolean and optional reasons.
+func (a *OPAAuthorizer) query(ctx context.Context, body []byte) (OPADecision, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.config.URL+"/v1/data/"+a.config.DecisionPath, bytes.NewReader(body))
+	if err != nil {
+		return OPADecision{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return OPADecision{}, fmt.Errorf("OPA request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return OPADecision{}, fmt.Errorf("OPA returned status %d", resp.StatusCode)
+	}
+
+	var response struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return OPADecision{}, fmt.Errorf("invalid OPA response: %w", err)
+	}
+
+	// An undefined decision denies the request
+	if len(response.Result) == 0 {
+		return OPADecision{Reasons: []string{"policy decision is undefined"}}, nil
+	}
+	var allow bool
+	if err := json.Unmarshal(response.Result, &allow); err == nil {
+		return OPADecision{Allow: allow}, nil
+	}
+	var decision struct {
+		Allow   bool            `json:"allow"`
+		Reason  string          `json:"reason"`
+		Reasons json.RawMessage `json:"reasons"`
+	}
+	if err := json.Unmarshal(response.Result, &decision); err != nil {
+		return OPADecision{}, fmt.Errorf("invalid OPA decision: %w", err)
+	}
+	result := OPADecision{Allow: decision.Allow, Reasons: opaReasons(decision.Reasons)}
+	if decision.Reason != "" {
+		result.Reasons = append(result.Reasons, decision.Reason)
+	}
+	return result, nil
+}
+
+// opaReasons returns the deny reasons of a decision, which Rego policies commonly produce as a set
+// (a JSON array) or as an object keyed by rule
+func opaReasons(raw json.RawMessage) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+	var reasons []string
+	if err := json.Unmarshal(raw, &reasons); err == nil {
+		return reasons
+	}
+	var keyed map[string]string
+	if err := json.Unmarshal(raw, &keyed); err == nil {
+		for _, reason := range keyed {
+			reasons = append(reasons, reason)
+		}
+		sort.Strings(reasons)
+	}
+	return reasons
+}
+
+// Middleware denies the requests the OPA policy does not allow
+func (a *OPAAuthorizer) Middleware(endpoint Endpoint, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		input := newOPAInput(endpoint, r)
+		decision, err := a.Decide(r.Context(), input)
+		if err != nil {
+			LogError("OPA authorization failed", err, map[string]interface{}{
+				"path":      r.URL.Path,
+				"fail_open": a.config.FailOpen,
+			})
+			if a.config.FailOpen {
+				next.ServeHTTP(w, r)
+				return
+			}
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		if !decision.Allow {
+			LogAudit("Request denied by OPA policy", map[string]interface{}{
+				"method":        r.Method,
+				"path":          r.URL.Path,
+				"route":         endpoint.Path,
+				"client_ip":     input.ClientIP,
+				"user_agent":    r.UserAgent(),
+				"reasons":       decision.Reasons,
+				"decision_path": a.config.DecisionPath,
+			})
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// TestOPAAuthorizer tests that requests are allowed or denied by the OPA decision
+func TestOPAAuthorizer(t *testing.T) {
+	var decisions atomic.Int32
+	var policy string
+	opaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/v1/policies/surfboard":
+			body, _ := io.ReadAll(r.Body)
+			policy = string(body)
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/data/surfboard/authz":
+			decisions.Add(1)
+			var request struct {
+				Input OPAInput `json:"input"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				t.Errorf("Invalid decision request: %v", err)
+			}
+			if request.Input.Route != "/api/users" {
+				t.Errorf("Expected route /api/users, got %s", request.Input.Route)
+			}
+			if request.Input.Headers["x-role"] == "admin" {
+				_, _ = w.Write([]byte(`{"result": {"allow": true}}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"result": {"allow": false, "reasons": ["admin role required"]}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer opaServer.Close()
+
+	policyFile := filepath.Join(t.TempDir(), "authz.rego")
+	if err := os.WriteFile(policyFile, []byte("package surfboard.authz"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	authorizer, err := NewOPAAuthorizer(OPAConfig{
+		URL:          opaServer.URL,
+		DecisionPath: "surfboard/authz",
+		PolicyFile:   policyFile,
+		CacheTTL:     60000,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create OPA authorizer: %v", err)
+	}
+	if policy != "package surfboard.authz" {
+		t.Errorf("Expected the bundled policy to be uploaded, got %q", policy)
+	}
+
+	handler := authorizer.Middleware(Endpoint{Path: "/api/users"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Allowed request
+	req := httptest.NewRequest("GET", "/api/users", nil)
+	req.Header.Set("X-Role", "admin")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for allowed request, got %d", rr.Code)
+	}
+
+	// Denied request, the second one is served from the decision cache
+	for i := 0; i < 2; i++ {
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/users", nil))
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403 for denied request, got %d", rr.Code)
+		}
+	}
+	if decisions.Load() != 2 {
+		t.Errorf("Expected 2 decision requests with caching, got %d", decisions.Load())
+	}
+}
+
+// TestOPADecisionFormats tests the parsing of boolean and object decisions
+func TestOPADecisionFormats(t *testing.T) {
+	tests := []struct {
+		response string
+		allow    bool
+		reasons  string
+	}{
+		{`{"result": true}`, true, ""},
+		{`{"result": false}`, false, ""},
+		{`{}`, false, "policy decision is undefined"},
+		{`{"result": {"allow": false, "reason": "blocked"}}`, false, "blocked"},
+		{`{"result": {"allow": false, "reasons": {"r1": "b", "r2": "a"}}}`, false, "a,b"},
+	}
+	for _, tt := range tests {
+		opaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(tt.response))
+		}))
+		authorizer, err := NewOPAAuthorizer(OPAConfig{URL: opaServer.URL, DecisionPath: "authz"})
+		if err != nil {
+			t.Fatalf("Failed to create OPA authorizer: %v", err)
+		}
+		decision, err := authorizer.Decide(httptest.NewRequest("GET", "/", nil).Context(), OPAInput{})
+		opaServer.Close()
+		if err != nil {
+			t.Fatalf("Decide(%s) failed: %v", tt.response, err)
+		}
+		if decision.Allow != tt.allow || strings.Join(decision.Reasons, ",") != tt.reasons {
+			t.Errorf("Decide(%s) = %v %v, want %v %s", tt.response, decision.Allow, decision.Reasons, tt.allow, tt.reasons)
+		}
+	}
+}
+
+// TestOPAFailOpen tests the handling of an unreachable OPA server
+func TestOPAFailOpen(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	for _, failOpen := range []bool{false, true} {
+		authorizer, err := NewOPAAuthorizer(OPAConfig{URL: "http://127.0.0.1:1", DecisionPath: "authz", FailOpen: failOpen})
+		if err != nil {
+			t.Fatalf("Failed to create OPA authorizer: %v", err)
+		}
+		rr := httptest.NewRecorder()
+		authorizer.Middleware(Endpoint{}, next).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		want := http.StatusForbidden
+		if failOpen {
+			want = http.StatusOK
+		}
+		if rr.Code != want {
+			t.Errorf("Expected status %d with fail_open=%v, got %d", want, failOpen, rr.Code)
+		}
+	}
+}
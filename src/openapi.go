@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// API documentation UIs
+const (
+	OpenAPIUISwagger = "swagger"
+	OpenAPIUIRedoc   = "redoc"
+)
+
+// Default API documentation settings
+const (
+	defaultOpenAPIPath        = "/openapi.json"
+	defaultOpenAPIUIPath      = "/docs"
+	defaultOpenAPITitle       = "SurfBoard API"
+	defaultOpenAPIVersion     = "1.0.0"
+	defaultSwaggerUIAssetsURL = "https://unpkg.com/swagger-ui-dist@5"
+	defaultRedocAssetsURL     = "https://cdn.redoc.ly/redoc/latest/bundles"
+	openAPIVersion            = "3.0.3"
+)
+
+// openAPIAnyMethods are the operations documented for endpoints accepting any method
+var openAPIAnyMethods = []string{"get", "post", "put", "patch", "delete"}
+
+// OpenAPIConfig represents the OpenAPI document of the endpoints and the UI to browse it
+type OpenAPIConfig struct {
+	Enabled bool `json:"enabled"`
+	// Path serves the OpenAPI document (default /openapi.json)
+	Path string `json:"path"`
+	// Title and Version describe the API in the document (default SurfBoard API and 1.0.0)
+	Title   string `json:"title"`
+	Version string `json:"version"`
+	// UI is the documentation UI served on UIPath: swagger or redoc (empty serves no UI)
+	UI string `json:"ui"`
+	// UIPath serves the documentation UI (default /docs)
+	UIPath string `json:"ui_path"`
+	// AssetsURL is the base URL of the UI scripts and styles, e.g. an internal mirror (default the public CDN)
+	AssetsURL string `json:"assets_url"`
+	// Listeners restricts the document and the UI to the named listeners (empty means all listeners)
+	Listeners []string `json:"listeners"`
+}
+
+// withDefaults returns the configuration with default values applied
+func (c OpenAPIConfig) withDefaults() OpenAPIConfig {
+	if c.Path == "" {
+		c.Path = defaultOpenAPIPath
+	}
+	if c.UIPath == "" {
+		c.UIPath = defaultOpenAPIUIPath
+	}
+	if c.Title == "" {
+		c.Title = defaultOpenAPITitle
+	}
+	if c.Version == "" {
+		c.Version = defaultOpenAPIVersion
+	}
+	if c.AssetsURL == "" {
+		c.AssetsURL = defaultSwaggerUIAssetsURL
+		if c.UI == OpenAPIUIRedoc {
+			c.AssetsURL = defaultRedocAssetsURL
+		}
+	}
+	c.AssetsURL = strings.TrimSuffix(c.AssetsURL, "/")
+	return c
+}
+
+// BuildOpenAPISpec builds the OpenAPI document of the endpoints. Backend URLs are internal and not documented.
+func BuildOpenAPISpec(config OpenAPIConfig, endpoints []Endpoint) map[string]interface{} {
+	config = config.withDefaults()
+	paths := make(map[string]map[string]interface{})
+	for _, endpoint := range endpoints {
+		template, err := compiledPathTemplate(endpoint.Path)
+		if err != nil {
+			continue
+		}
+		path, parameters := openAPIPath(template)
+
+		methods := openAPIAnyMethods
+		if endpoint.Method != "" {
+			methods = []string{strings.ToLower(endpoint.Method)}
+		}
+		item, ok := paths[path]
+		if !ok {
+			item = make(map[string]interface{})
+			paths[path] = item
+		}
+		for _, method := range methods {
+			operation := map[string]interface{}{
+				"summary":   endpoint.Path,
+				"responses": map[string]interface{}{"default": map[string]interface{}{"description": "Backend response"}},
+			}
+			if len(parameters) > 0 {
+				operation["parameters"] = parameters
+			}
+			if endpoint.Host != "" {
+				operation["x-host"] = endpoint.Host
+			}
+			item[method] = operation
+		}
+	}
+
+	return map[string]interface{}{
+		"openapi": openAPIVersion,
+		"info": map[string]interface{}{
+			"title":   config.Title,
+			"version": config.Version,
+		},
+		"paths": paths,
+	}
+}
+
+// openAPIPath converts a path template to an OpenAPI path and its path parameters
+func openAPIPath(template *PathTemplate) (string, []map[string]interface{}) {
+	var parameters []map[string]interface{}
+	parts := make([]string, len(template.segments))
+	for i, segment := range template.segments {
+		if segment.param == "" && !segment.wildcard {
+			parts[i] = segment.literal
+			continue
+		}
+
+		// Unnamed wildcards get a generated name
+		name := segment.param
+		if name == "" {
+			name = fmt.Sprintf("wildcard%d", i)
+		}
+		parts[i] = "{" + name + "}"
+		schema := map[string]interface{}{"type": "string"}
+		if segment.constraint != nil {
+			schema["pattern"] = segment.constraint.String()
+		}
+		parameter := map[string]interface{}{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   schema,
+		}
+		if segment.wildcard && i == len(template.segments)-1 {
+			parameter["description"] = "Rest of the path, may contain slashes"
+		}
+		parameters = append(parameters, parameter)
+	}
+	return strings.Join(parts, "/"), parameters
+}
+
+// openAPIUIPage renders the Swagger UI or Redoc page loading the OpenAPI document
+var openAPIUIPage = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+{{if eq .UI "redoc"}}</head>
+<body>
+<redoc spec-url="{{.SpecURL}}"></redoc>
+<script src="{{.AssetsURL}}/redoc.standalone.js"></script>
+{{else}}<link rel="stylesheet" href="{{.AssetsURL}}/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="{{.AssetsURL}}/swagger-ui-bundle.js"></script>
+<script src="{{.InitURL}}" data-spec-url="{{.SpecURL}}"></script>
+{{end}}</body>
+</html>
+`))
+
+// swaggerUIInitScript starts Swagger UI with the document URL set on its script element, it is served by the
+// gateway because the page allows no inline script
+const swaggerUIInitScript = `window.onload = function () {
+  window.ui = SwaggerUIBundle({ url: document.querySelector("script[data-spec-url]").dataset.specUrl, dom_id: "#swagger-ui" });
+};
+`
+
+// RegisterOpenAPI registers the OpenAPI document of the endpoints and the documentation UI if configured
+func (g *Gateway) RegisterOpenAPI() {
+	if !g.config.OpenAPI.Enabled {
+		return
+	}
+	config := g.config.OpenAPI.withDefaults()
+	spec := BuildOpenAPISpec(config, g.config.Endpoints)
+
+	g.handle(config.Path, SecurityHeadersMiddleware(g.securityHeaders(nil), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		// Let documentation tools hosted elsewhere load the document
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		writeJSON(w, http.StatusOK, spec)
+	})), config.Listeners)
+	LogInfo("OpenAPI document enabled", map[string]interface{}{
+		"path":      config.Path,
+		"endpoints": len(g.config.Endpoints),
+	})
+
+	if config.UI == "" {
+		return
+	}
+	if config.UI != OpenAPIUISwagger && config.UI != OpenAPIUIRedoc {
+		LogError("Invalid OpenAPI UI, no UI served", nil, map[string]interface{}{
+			"ui": config.UI,
+		})
+		return
+	}
+
+	// Scripts and styles may only be loaded from the assets origin
+	assetsOrigin := config.AssetsURL
+	if assetsURL, err := url.Parse(config.AssetsURL); err == nil && assetsURL.Host != "" {
+		assetsOrigin = assetsURL.Scheme + "://" + assetsURL.Host
+	}
+	contentSecurityPolicy := fmt.Sprintf("default-src 'none'; script-src %[1]s 'self'; style-src %[1]s 'unsafe-inline'; "+
+		"img-src %[1]s data:; font-src %[1]s; worker-src blob:; connect-src 'self'; frame-ancestors 'none'", assetsOrigin)
+
+	initPath := strings.TrimSuffix(config.UIPath, "/") + "/swagger-ui-init.js"
+	if config.UI == OpenAPIUISwagger {
+		g.handle(initPath, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+			_, _ = w.Write([]byte(swaggerUIInitScript))
+		}), config.Listeners)
+	}
+
+	g.handle(config.UIPath, SecurityHeadersMiddleware(g.securityHeaders(nil), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", contentSecurityPolicy)
+		err := openAPIUIPage.Execute(w, map[string]string{
+			"Title":     config.Title,
+			"UI":        config.UI,
+			"SpecURL":   config.Path,
+			"AssetsURL": config.AssetsURL,
+			"InitURL":   initPath,
+		})
+		if err != nil {
+			LogError("Failed to render the OpenAPI UI", err, nil)
+		}
+	})), config.Listeners)
+	LogInfo("OpenAPI UI enabled", map[string]interface{}{
+		"ui":   config.UI,
+		"path": config.UIPath,
+	})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestBuildOpenAPISpec tests that the path templates are documented with their path parameters
+func TestBuildOpenAPISpec(t *testing.T) {
+	spec := BuildOpenAPISpec(OpenAPIConfig{Title: "Internal API"}, []Endpoint{
+		{Path: "/api/users/:id([0-9]+)", Method: "GET", Backend: "http://users.internal"},
+		{Path: "/files/*path", Backend: "http://files.internal", Host: "files.example.com"},
+	})
+	body, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatalf("failed to marshal the spec: %v", err)
+	}
+	if strings.Contains(string(body), ".internal") {
+		t.Errorf("expected no backend URLs in the spec, got %s", body)
+	}
+
+	var document struct {
+		OpenAPI string `json:"openapi"`
+		Info    struct {
+			Title string `json:"title"`
+		} `json:"info"`
+		Paths map[string]map[string]struct {
+			Host       string `json:"x-host"`
+			Parameters []struct {
+				Name   string `json:"name"`
+				In     string `json:"in"`
+				Schema struct {
+					Pattern string `json:"pattern"`
+				} `json:"schema"`
+			} `json:"parameters"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(body, &document); err != nil {
+		t.Fatalf("invalid spec %s: %v", body, err)
+	}
+	if document.OpenAPI != openAPIVersion || document.Info.Title != "Internal API" {
+		t.Errorf("unexpected document header %+v", document)
+	}
+
+	users, ok := document.Paths["/api/users/{id}"]
+	if !ok || len(users) != 1 {
+		t.Fatalf("expected a single operation on /api/users/{id}, got %+v", document.Paths)
+	}
+	parameters := users["get"].Parameters
+	if len(parameters) != 1 || parameters[0].Name != "id" || parameters[0].In != "path" || !strings.Contains(parameters[0].Schema.Pattern, "[0-9]+") {
+		t.Errorf("unexpected parameters %+v", parameters)
+	}
+
+	files, ok := document.Paths["/files/{path}"]
+	if !ok || len(files) != len(openAPIAnyMethods) {
+		t.Fatalf("expected every method on /files/{path}, got %+v", document.Paths)
+	}
+	if files["post"].Host != "files.example.com" || files["post"].Parameters[0].Name != "path" {
+		t.Errorf("unexpected operation %+v", files["post"])
+	}
+}
+
+// TestOpenAPIUI tests that the document and the documentation UI are served
+func TestOpenAPIUI(t *testing.T) {
+	gateway := NewGateway(Config{
+		Endpoints: []Endpoint{{Path: "/api/", Backend: "http://localhost:1"}},
+		OpenAPI:   OpenAPIConfig{Enabled: true, UI: OpenAPIUISwagger, AssetsURL: "https://assets.example.com/swagger/"},
+	}, nil)
+	gateway.RegisterEndpoints()
+	gateway.RegisterOpenAPI()
+
+	rr := httptest.NewRecorder()
+	gateway.mux.ServeHTTP(rr, httptest.NewRequest("GET", "/openapi.json", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"/api/"`) {
+		t.Fatalf("expected the document, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("expected the document to be readable cross origin")
+	}
+
+	rr = httptest.NewRecorder()
+	gateway.mux.ServeHTTP(rr, httptest.NewRequest("GET", "/docs", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the UI page, got %d", rr.Code)
+	}
+	page := rr.Body.String()
+	if !strings.Contains(page, "https://assets.example.com/swagger/swagger-ui-bundle.js") || !strings.Contains(page, `data-spec-url="/openapi.json"`) {
+		t.Errorf("expected the page to load Swagger UI with the document, got %s", page)
+	}
+	if csp := rr.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "script-src https://assets.example.com 'self'") {
+		t.Errorf("expected the assets origin to be allowed, got %q", csp)
+	}
+
+	rr = httptest.NewRecorder()
+	gateway.mux.ServeHTTP(rr, httptest.NewRequest("GET", "/docs/swagger-ui-init.js", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "SwaggerUIBundle") {
+		t.Errorf("expected the init script, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	gateway.mux.ServeHTTP(rr, httptest.NewRequest("POST", "/docs", nil))
+	if rr.Code != http.StatusMethodNotAllowed || rr.Header().Get("Allow") != "GET" {
+		t.Errorf("expected status 405, got %d", rr.Code)
+	}
+}
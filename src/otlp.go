@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"google.golang.org/grpc/credentials"
+)
+
+// OTLP export protocols
+const (
+	otlpProtocolHTTP = "http/protobuf"
+	otlpProtocolGRPC = "grpc"
+)
+
+// defaultExportInterval is the interval in milliseconds at which metrics are exported over OTLP
+const defaultExportInterval = 5000
+
+// OTLPTLSConfig represents the TLS settings of the OTLP connection
+type OTLPTLSConfig struct {
+	// CAFile is the CA certificate used to verify the collector certificate (system roots if empty)
+	CAFile string `json:"ca_file"`
+	// CertFile and KeyFile are the client certificate and key for mutual TLS
+	CertFile           string `json:"cert_file"`
+	KeyFile            string `json:"key_file"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+}
+
+// OTLPRetryConfig represents the retrying of failed OTLP exports
+type OTLPRetryConfig struct {
+	Disabled bool `json:"disabled"`
+	// InitialInterval is the delay in milliseconds before the first retry
+	InitialInterval int `json:"initial_interval"`
+	// MaxInterval is the maximum delay in milliseconds between retries
+	MaxInterval int `json:"max_interval"`
+	// MaxElapsedTime is the maximum time in milliseconds spent retrying an export
+	MaxElapsedTime int `json:"max_elapsed_time"`
+}
+
+// otlpProtocol returns the OTLP protocol of the config, falling back to the OTEL_EXPORTER_OTLP_METRICS_PROTOCOL
+// and OTEL_EXPORTER_OTLP_PROTOCOL environment variables
+func otlpProtocol(config TelemetryConfig) string {
+	protocol := config.Protocol
+	for _, name := range []string{"OTEL_EXPORTER_OTLP_METRICS_PROTOCOL", "OTEL_EXPORTER_OTLP_PROTOCOL"} {
+		if protocol == "" {
+			protocol = os.Getenv(name)
+		}
+	}
+	if protocol == "" || protocol == "http" {
+		return otlpProtocolHTTP
+	}
+	return protocol
+}
+
+// otlpEndpointFromEnv returns whether an OTLP endpoint is set in the OTEL_EXPORTER_OTLP_METRICS_ENDPOINT
+// or OTEL_EXPORTER_OTLP_ENDPOINT environment variables
+func otlpEndpointFromEnv() bool {
+	return os.Getenv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != ""
+}
+
+// newOTLPTLSConfig creates the TLS configuration of the OTLP connection
+func newOTLPTLSConfig(config OTLPTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+	if config.CAFile != "" {
+		caData, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read OTLP CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("invalid OTLP CA file: %s", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if config.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load OTLP client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// validateOTLPConfig checks the OTLP protocol and metrics URL
+func validateOTLPConfig(config TelemetryConfig) error {
+	protocol := otlpProtocol(config)
+	if protocol != otlpProtocolHTTP && protocol != otlpProtocolGRPC {
+		return fmt.Errorf("invalid OTLP protocol: %s (must be http/protobuf or grpc)", protocol)
+	}
+	if config.MetricsURL != "" {
+		metricsURL, err := url.Parse(config.MetricsURL)
+		if err != nil {
+			return fmt.Errorf("failed to parse metrics URL: %w", err)
+		}
+		if metricsURL.Scheme != "http" && metricsURL.Scheme != "https" {
+			return fmt.Errorf("invalid metrics URL scheme: %s (must be http or https)", metricsURL.Scheme)
+		}
+	}
+	return nil
+}
+
+// newOTLPExporter creates the OTLP metric exporter. Settings missing from the config are taken from the
+// standard OTEL_EXPORTER_OTLP_* environment variables by the exporter.
+func newOTLPExporter(ctx context.Context, config TelemetryConfig) (sdkmetric.Exporter, error) {
+	if err := validateOTLPConfig(config); err != nil {
+		return nil, err
+	}
+	protocol := otlpProtocol(config)
+
+	// The metrics URL scheme selects whether TLS is used
+	var metricsURL *url.URL
+	if config.MetricsURL != "" {
+		metricsURL, _ = url.Parse(config.MetricsURL)
+	}
+
+	var tlsConfig *tls.Config
+	if config.TLS != (OTLPTLSConfig{}) {
+		var err error
+		if tlsConfig, err = newOTLPTLSConfig(config.TLS); err != nil {
+			return nil, err
+		}
+	}
+
+	headers := make(map[string]string, len(config.Headers)+1)
+	for key, value := range config.Headers {
+		headers[key] = value
+	}
+	if config.BearerToken != "" {
+		headers["Authorization"] = "Bearer " + config.BearerToken
+	}
+
+	if protocol == otlpProtocolGRPC {
+		var options []otlpmetricgrpc.Option
+		if metricsURL != nil {
+			options = append(options, otlpmetricgrpc.WithEndpoint(metricsURL.Host))
+			if metricsURL.Scheme == "http" {
+				options = append(options, otlpmetricgrpc.WithInsecure())
+			}
+		}
+		if tlsConfig != nil {
+			options = append(options, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(tlsConfig)))
+		}
+		if len(headers) > 0 {
+			options = append(options, otlpmetricgrpc.WithHeaders(headers))
+		}
+		if config.ExportTimeout > 0 {
+			options = append(options, otlpmetricgrpc.WithTimeout(time.Duration(config.ExportTimeout)*time.Millisecond))
+		}
+		options = append(options, otlpmetricgrpc.WithRetry(otlpmetricgrpc.RetryConfig(otlpRetryConfig(config.Retry))))
+		return otlpmetricgrpc.New(ctx, options...)
+	}
+
+	var options []otlpmetrichttp.Option
+	if metricsURL != nil {
+		options = append(options, otlpmetrichttp.WithEndpoint(metricsURL.Host))
+		if metricsURL.Scheme == "http" {
+			options = append(options, otlpmetrichttp.WithInsecure())
+		}
+		if path := strings.TrimSuffix(metricsURL.Path, "/"); path != "" {
+			options = append(options, otlpmetrichttp.WithURLPath(path))
+		}
+	}
+	if tlsConfig != nil {
+		options = append(options, otlpmetrichttp.WithTLSClientConfig(tlsConfig))
+	}
+	if len(headers) > 0 {
+		options = append(options, otlpmetrichttp.WithHeaders(headers))
+	}
+	if config.ExportTimeout > 0 {
+		options = append(options, otlpmetrichttp.WithTimeout(time.Duration(config.ExportTimeout)*time.Millisecond))
+	}
+	options = append(options, otlpmetrichttp.WithRetry(otlpmetrichttp.RetryConfig(otlpRetryConfig(config.Retry))))
+	return otlpmetrichttp.New(ctx, options...)
+}
+
+// otlpRetryConfig converts the retry settings to the exporter retry config, keeping the exporter
+// defaults for settings that are not configured
+func otlpRetryConfig(config OTLPRetryConfig) otlpmetrichttp.RetryConfig {
+	retry := otlpmetrichttp.RetryConfig{
+		Enabled:         !config.Disabled,
+		InitialInterval: 5 * time.Second,
+		MaxInterval:     30 * time.Second,
+		MaxElapsedTime:  time.Minute,
+	}
+	if config.InitialInterval > 0 {
+		retry.InitialInterval = time.Duration(config.InitialInterval) * time.Millisecond
+	}
+	if config.MaxInterval > 0 {
+		retry.MaxInterval = time.Duration(config.MaxInterval) * time.Millisecond
+	}
+	if config.MaxElapsedTime > 0 {
+		retry.MaxElapsedTime = time.Duration(config.MaxElapsedTime) * time.Millisecond
+	}
+	return retry
+}
+
+// exportIntervalOptions returns the interval at which metrics are exported over OTLP, falling back to the
+// OTEL_METRIC_EXPORT_INTERVAL environment variable
+func exportIntervalOptions(config TelemetryConfig) []sdkmetric.PeriodicReaderOption {
+	if config.ExportInterval > 0 {
+		return []sdkmetric.PeriodicReaderOption{sdkmetric.WithInterval(time.Duration(config.ExportInterval) * time.Millisecond)}
+	}
+	if os.Getenv("OTEL_METRIC_EXPORT_INTERVAL") != "" {
+		return nil
+	}
+	return []sdkmetric.PeriodicReaderOption{sdkmetric.WithInterval(defaultExportInterval * time.Millisecond)}
+}
+
+// resilientExporter is an OTLP exporter that does not prevent the gateway from starting when the exporter
+// cannot be created. Creating the exporter is retried on every export, and the outcome of the exports is counted.
+type resilientExporter struct {
+	mu       sync.Mutex
+	create   func(ctx context.Context) (sdkmetric.Exporter, error)
+	exporter sdkmetric.Exporter
+	shutdown bool
+	// failing is set while exports fail, so that only changes of the export state are logged
+	failing   bool
+	successes atomic.Int64
+	failures  atomic.Int64
+}
+
+// newResilientExporter creates a resilientExporter for the configured OTLP exporter
+func newResilientExporter(config TelemetryConfig) *resilientExporter {
+	return &resilientExporter{
+		create: func(ctx context.Context) (sdkmetric.Exporter, error) {
+			return newOTLPExporter(ctx, config)
+		},
+	}
+}
+
+// current returns the exporter, creating it if it was not created yet
+func (e *resilientExporter) current(ctx context.Context) (sdkmetric.Exporter, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.exporter != nil || e.shutdown {
+		return e.exporter, nil
+	}
+	exporter, err := e.create(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+	e.exporter = exporter
+	return exporter, nil
+}
+
+// Temporality returns the default temporality, which the OTLP exporters use unless configured otherwise
+func (e *resilientExporter) Temporality(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+	return sdkmetric.DefaultTemporalitySelector(kind)
+}
+
+// Aggregation returns the default aggregation, which the OTLP exporters use unless configured otherwise
+func (e *resilientExporter) Aggregation(kind sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	return sdkmetric.DefaultAggregationSelector(kind)
+}
+
+// Export exports the metrics, creating the exporter first if needed
+func (e *resilientExporter) Export(ctx context.Context, metrics *metricdata.ResourceMetrics) error {
+	exporter, err := e.current(ctx)
+	if err == nil && exporter != nil {
+		err = exporter.Export(ctx, metrics)
+	}
+	e.record(err)
+	return err
+}
+
+// record counts the outcome of an export and logs when exports start failing or recover
+func (e *resilientExporter) record(err error) {
+	if err == nil {
+		e.successes.Add(1)
+	} else {
+		e.failures.Add(1)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err != nil && !e.failing {
+		e.failing = true
+		LogError("Failed to export metrics over OTLP, retrying in the background", err, nil)
+	} else if err == nil && e.failing {
+		e.failing = false
+		LogInfo("Exporting metrics over OTLP recovered", nil)
+	}
+}
+
+// Stats returns the number of successful and failed exports
+func (e *resilientExporter) Stats() (successes, failures int64) {
+	return e.successes.Load(), e.failures.Load()
+}
+
+// ForceFlush flushes the exporter if it was created
+func (e *resilientExporter) ForceFlush(ctx context.Context) error {
+	e.mu.Lock()
+	exporter := e.exporter
+	e.mu.Unlock()
+	if exporter == nil {
+		return nil
+	}
+	return exporter.ForceFlush(ctx)
+}
+
+// Shutdown shuts down the exporter if it was created and stops creating it
+func (e *resilientExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	exporter := e.exporter
+	e.shutdown = true
+	e.mu.Unlock()
+	if exporter == nil {
+		return nil
+	}
+	return exporter.Shutdown(ctx)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// TestOTLPProtocol tests the selection of the OTLP protocol from the config and environment
+func TestOTLPProtocol(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_METRICS_PROTOCOL", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "")
+
+	if protocol := otlpProtocol(TelemetryConfig{}); protocol != otlpProtocolHTTP {
+		t.Errorf("Expected default protocol %s, got %s", otlpProtocolHTTP, protocol)
+	}
+	if protocol := otlpProtocol(TelemetryConfig{Protocol: "grpc"}); protocol != otlpProtocolGRPC {
+		t.Errorf("Expected protocol %s, got %s", otlpProtocolGRPC, protocol)
+	}
+
+	// The environment is used when the config does not set a protocol
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc")
+	if protocol := otlpProtocol(TelemetryConfig{}); protocol != otlpProtocolGRPC {
+		t.Errorf("Expected protocol from environment %s, got %s", otlpProtocolGRPC, protocol)
+	}
+	if protocol := otlpProtocol(TelemetryConfig{Protocol: "http/protobuf"}); protocol != otlpProtocolHTTP {
+		t.Errorf("Expected configured protocol to take precedence, got %s", protocol)
+	}
+}
+
+// TestNewOTLPExporter tests the creation of the OTLP exporter for both protocols
+func TestNewOTLPExporter(t *testing.T) {
+	for _, protocol := range []string{otlpProtocolHTTP, otlpProtocolGRPC} {
+		exporter, err := newOTLPExporter(context.Background(), TelemetryConfig{
+			MetricsURL:  "http://localhost:4318/v1/metrics",
+			Protocol:    protocol,
+			BearerToken: "secret",
+			Headers:     map[string]string{"X-Tenant": "test"},
+			Retry:       OTLPRetryConfig{Disabled: true},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create %s exporter: %v", protocol, err)
+		}
+		exporter.Shutdown(context.Background())
+	}
+
+	if _, err := newOTLPExporter(context.Background(), TelemetryConfig{Protocol: "thrift"}); err == nil {
+		t.Error("Expected error for invalid protocol")
+	}
+	if _, err := newOTLPExporter(context.Background(), TelemetryConfig{
+		MetricsURL: "https://localhost:4318",
+		TLS:        OTLPTLSConfig{CAFile: "missing-ca.pem"},
+	}); err == nil {
+		t.Error("Expected error for missing CA file")
+	}
+}
+
+// TestExportIntervalOptions tests the export interval falls back to the environment
+func TestExportIntervalOptions(t *testing.T) {
+	t.Setenv("OTEL_METRIC_EXPORT_INTERVAL", "")
+	if options := exportIntervalOptions(TelemetryConfig{}); len(options) != 1 {
+		t.Errorf("Expected default interval option, got %d options", len(options))
+	}
+
+	t.Setenv("OTEL_METRIC_EXPORT_INTERVAL", "1000")
+	if options := exportIntervalOptions(TelemetryConfig{}); len(options) != 0 {
+		t.Errorf("Expected interval from environment, got %d options", len(options))
+	}
+	if options := exportIntervalOptions(TelemetryConfig{ExportInterval: 2000}); len(options) != 1 {
+		t.Errorf("Expected configured interval option, got %d options", len(options))
+	}
+}
+
+// fakeExporter is a metric exporter returning a configurable export error
+type fakeExporter struct {
+	err     error
+	exports int
+}
+
+func (e *fakeExporter) Temporality(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+	return sdkmetric.DefaultTemporalitySelector(kind)
+}
+
+func (e *fakeExporter) Aggregation(kind sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	return sdkmetric.DefaultAggregationSelector(kind)
+}
+
+func (e *fakeExporter) Export(ctx context.Context, metrics *metricdata.ResourceMetrics) error {
+	e.exports++
+	return e.err
+}
+
+func (e *fakeExporter) ForceFlush(ctx context.Context) error { return nil }
+
+func (e *fakeExporter) Shutdown(ctx context.Context) error { return nil }
+
+// TestResilientExporter tests the exporter is created in the background and exports are counted
+func TestResilientExporter(t *testing.T) {
+	fake := &fakeExporter{err: errors.New("collector unavailable")}
+	attempts := 0
+	exporter := &resilientExporter{create: func(ctx context.Context) (sdkmetric.Exporter, error) {
+		attempts++
+		if attempts < 2 {
+			return nil, errors.New("connection refused")
+		}
+		return fake, nil
+	}}
+	ctx := context.Background()
+
+	// The first export fails creating the exporter, the second creates it but the export fails
+	if err := exporter.Export(ctx, &metricdata.ResourceMetrics{}); err == nil {
+		t.Error("Expected error when the exporter cannot be created")
+	}
+	if err := exporter.Export(ctx, &metricdata.ResourceMetrics{}); err == nil {
+		t.Error("Expected error when the export fails")
+	}
+
+	// The collector becomes available
+	fake.err = nil
+	if err := exporter.Export(ctx, &metricdata.ResourceMetrics{}); err != nil {
+		t.Errorf("Unexpected export error: %v", err)
+	}
+
+	if attempts != 2 {
+		t.Errorf("Expected the exporter to be created after 2 attempts, got %d", attempts)
+	}
+	if fake.exports != 2 {
+		t.Errorf("Expected 2 exports, got %d", fake.exports)
+	}
+	if successes, failures := exporter.Stats(); successes != 1 || failures != 2 {
+		t.Errorf("Expected 1 success and 2 failures, got %d and %d", successes, failures)
+	}
+
+	// No exporter is created after shutdown
+	exporter = &resilientExporter{create: func(ctx context.Context) (sdkmetric.Exporter, error) {
+		t.Error("Exporter created after shutdown")
+		return fake, nil
+	}}
+	exporter.Shutdown(ctx)
+	exporter.Export(ctx, &metricdata.ResourceMetrics{})
+}
+
+// TestTelemetryStartsWithoutExporter tests the gateway starts when the OTLP exporter cannot be created
+func TestTelemetryStartsWithoutExporter(t *testing.T) {
+	tm, err := NewTelemetryManager(TelemetryConfig{
+		Enabled:        true,
+		ServiceName:    "test-service",
+		MetricsURL:     "https://localhost:4318",
+		TLS:            OTLPTLSConfig{CAFile: "missing-ca.pem"},
+		ExportInterval: 60000,
+	})
+	if err != nil {
+		t.Fatalf("Expected telemetry to start without the OTLP exporter, got %v", err)
+	}
+	tm.Shutdown(context.Background())
+
+	// Invalid configurations still fail
+	if _, err := NewTelemetryManager(TelemetryConfig{Enabled: true, MetricsURL: "http://localhost:4318", Protocol: "thrift"}); err == nil {
+		t.Error("Expected error for invalid protocol")
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Pagination styles of the backends
+const (
+	PaginationPage   = "page"
+	PaginationOffset = "offset"
+	PaginationLink   = "link"
+)
+
+// Default pagination settings
+const (
+	defaultPageParam   = "page"
+	defaultOffsetParam = "offset"
+	defaultLimitParam  = "limit"
+	defaultPageLimit   = 20
+)
+
+// TotalCountHeader is the response header some backends send the total number of items in
+const TotalCountHeader = "X-Total-Count"
+
+// PaginationConfig represents the pagination style of the backend of an endpoint, whose list responses are
+// normalized into the same envelope as those of all other endpoints
+type PaginationConfig struct {
+	// Style is the pagination of the backend: page (page and limit query parameters), offset (offset and
+	// limit query parameters) or link (Link response headers); empty disables the normalization
+	Style string `json:"style"`
+	// PageParam, OffsetParam and LimitParam are the query parameters of the backend (default page, offset and limit)
+	PageParam   string `json:"page_param"`
+	OffsetParam string `json:"offset_param"`
+	LimitParam  string `json:"limit_param"`
+	// DefaultLimit is the page size of the backend when the client sends no limit (default 20)
+	DefaultLimit int `json:"default_limit"`
+	// ItemsField is the field of the backend response holding the items, empty if the response is the array
+	ItemsField string `json:"items_field"`
+	// TotalField is the field of the backend response holding the total number of items, the X-Total-Count
+	// header is used otherwise
+	TotalField string `json:"total_field"`
+}
+
+// withDefaults returns the configuration with the defaults applied
+func (c PaginationConfig) withDefaults() PaginationConfig {
+	if c.PageParam == "" {
+		c.PageParam = defaultPageParam
+	}
+	if c.OffsetParam == "" {
+		c.OffsetParam = defaultOffsetParam
+	}
+	if c.LimitParam == "" {
+		c.LimitParam = defaultLimitParam
+	}
+	if c.DefaultLimit <= 0 {
+		c.DefaultLimit = defaultPageLimit
+	}
+	return c
+}
+
+// validatePagination checks the pagination style of an endpoint
+func validatePagination(config PaginationConfig) error {
+	switch config.Style {
+	case "", PaginationPage, PaginationOffset, PaginationLink:
+		return nil
+	}
+	return fmt.Errorf("invalid pagination style: %s (must be page, offset or link)", config.Style)
+}
+
+// PaginatedResponse is the envelope list responses are normalized into
+type PaginatedResponse struct {
+	Data       []interface{}  `json:"data"`
+	Pagination PaginationInfo `json:"pagination"`
+}
+
+// PaginationInfo describes the page of a normalized list response. Next and Prev are gateway URLs of the
+// adjacent pages, omitted on the first and last page.
+type PaginationInfo struct {
+	Offset *int   `json:"offset,omitempty"`
+	Limit  *int   `json:"limit,omitempty"`
+	Total  *int64 `json:"total,omitempty"`
+	Next   string `json:"next,omitempty"`
+	Prev   string `json:"prev,omitempty"`
+}
+
+// normalizePagination replaces a successful JSON list response with the pagination envelope. Responses
+// without the items are left unchanged.
+func normalizePagination(resp *http.Response, r *http.Request, config PaginationConfig) error {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil
+	}
+	config = config.withDefaults()
+	document, ok, err := readJSONResponse(resp)
+	if untransformable(err) {
+		return nil
+	}
+	if err != nil || !ok {
+		return err
+	}
+
+	// Find the items and the total number of items
+	items, isList := document.([]interface{})
+	var total *int64
+	if object, isObject := document.(map[string]interface{}); isObject && config.ItemsField != "" {
+		items, isList = object[config.ItemsField].([]interface{})
+		if number, isNumber := object[config.TotalField].(json.Number); isNumber {
+			if value, err := number.Int64(); err == nil {
+				total = &value
+			}
+		}
+	}
+	if !isList {
+		return nil
+	}
+	if total == nil {
+		if value, err := strconv.ParseInt(resp.Header.Get(TotalCountHeader), 10, 64); err == nil {
+			total = &value
+		}
+	}
+
+	envelope := PaginatedResponse{Data: items, Pagination: PaginationInfo{Total: total}}
+	if envelope.Data == nil {
+		envelope.Data = []interface{}{}
+	}
+	if config.Style == PaginationLink {
+		links := parseLinkHeader(resp.Header.Get("Link"))
+		envelope.Pagination.Next = gatewayPageURL(r, links["next"])
+		envelope.Pagination.Prev = gatewayPageURL(r, links["prev"])
+		resp.Header.Del("Link")
+	} else {
+		config.paginate(&envelope.Pagination, r, len(items))
+	}
+	return replaceJSONResponse(resp, envelope)
+}
+
+// paginate sets the offset, limit and adjacent pages of a response with the page or offset style from the
+// query parameters of the request
+func (c PaginationConfig) paginate(info *PaginationInfo, r *http.Request, count int) {
+	query := r.URL.Query()
+	limit := c.DefaultLimit
+	if value, err := strconv.Atoi(query.Get(c.LimitParam)); err == nil && value > 0 {
+		limit = value
+	}
+	offset := 0
+	if c.Style == PaginationPage {
+		if page, err := strconv.Atoi(query.Get(c.PageParam)); err == nil && page > 1 {
+			offset = (page - 1) * limit
+		}
+	} else if value, err := strconv.Atoi(query.Get(c.OffsetParam)); err == nil && value > 0 {
+		offset = value
+	}
+	info.Offset, info.Limit = &offset, &limit
+
+	// Without a total, a full page may be followed by another one
+	hasNext := count >= limit
+	if info.Total != nil {
+		hasNext = int64(offset+count) < *info.Total
+	}
+	pageURL := func(offset int) string {
+		pageQuery := r.URL.Query()
+		if c.Style == PaginationPage {
+			pageQuery.Set(c.PageParam, strconv.Itoa(offset/limit+1))
+		} else {
+			pageQuery.Set(c.OffsetParam, strconv.Itoa(offset))
+		}
+		return (&url.URL{Path: r.URL.Path, RawQuery: pageQuery.Encode()}).String()
+	}
+	if hasNext && count > 0 {
+		info.Next = pageURL(offset + limit)
+	}
+	if offset > 0 {
+		info.Prev = pageURL(max(offset-limit, 0))
+	}
+}
+
+// parseLinkHeader returns the URLs of a Link header by relation type, e.g. next and prev
+func parseLinkHeader(header string) map[string]string {
+	links := make(map[string]string)
+	for _, link := range strings.Split(header, ",") {
+		target, params, _ := strings.Cut(link, ";")
+		target = strings.TrimSpace(target)
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(name, "rel") {
+				for _, rel := range strings.Fields(strings.Trim(value, `"`)) {
+					links[strings.ToLower(rel)] = target[1 : len(target)-1]
+				}
+			}
+		}
+	}
+	return links
+}
+
+// gatewayPageURL maps the URL of a backend page to the gateway URL of the request with the query of the page
+func gatewayPageURL(r *http.Request, backendPageURL string) string {
+	if backendPageURL == "" {
+		return ""
+	}
+	pageURL, err := url.Parse(backendPageURL)
+	if err != nil {
+		return ""
+	}
+	return (&url.URL{Path: r.URL.Path, RawQuery: pageURL.RawQuery}).String()
+}
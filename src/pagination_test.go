@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestPaginationNormalization tests that the pagination styles of the backends are normalized into the same envelope
+func TestPaginationNormalization(t *testing.T) {
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/pages":
+			_, _ = w.Write([]byte(`{"results":[{"id":3},{"id":4}],"count":5}`))
+		case "/offsets":
+			w.Header().Set(TotalCountHeader, "3")
+			_, _ = w.Write([]byte(`[{"id":3}]`))
+		case "/links":
+			w.Header().Set("Link", `<http://backend/v1/links?cursor=c3>; rel="next", <http://backend/v1/links?cursor=c1>; rel="prev"`)
+			_, _ = w.Write([]byte(`[{"id":3}]`))
+		case "/object":
+			_, _ = w.Write([]byte(`{"id":1}`))
+		}
+	}))
+	defer backendServer.Close()
+
+	tests := []struct {
+		target   string
+		config   PaginationConfig
+		expected string
+	}{
+		{
+			"/pages?page=2&limit=2",
+			PaginationConfig{Style: PaginationPage, ItemsField: "results", TotalField: "count"},
+			`{"data":[{"id":3},{"id":4}],"pagination":{"offset":2,"limit":2,"total":5,"next":"/pages?limit=2&page=3","prev":"/pages?limit=2&page=1"}}`,
+		},
+		{
+			"/offsets?start=2",
+			PaginationConfig{Style: PaginationOffset, OffsetParam: "start", DefaultLimit: 1},
+			`{"data":[{"id":3}],"pagination":{"offset":2,"limit":1,"total":3,"prev":"/offsets?start=1"}}`,
+		},
+		{
+			"/links?cursor=c2",
+			PaginationConfig{Style: PaginationLink},
+			`{"data":[{"id":3}],"pagination":{"next":"/links?cursor=c3","prev":"/links?cursor=c1"}}`,
+		},
+		{
+			"/object",
+			PaginationConfig{Style: PaginationPage},
+			`{"id":1}`,
+		},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		NewProxy(Endpoint{Path: "/", Backend: backendServer.URL, Pagination: tt.config}, false, nil).Handler()(rr, httptest.NewRequest("GET", tt.target, nil))
+		if rr.Body.String() != tt.expected {
+			t.Errorf("for %s expected %s, got %s", tt.target, tt.expected, rr.Body.String())
+		}
+		if rr.Header().Get("Link") != "" {
+			t.Errorf("for %s expected the Link header to be removed", tt.target)
+		}
+	}
+}
+
+// TestParseLinkHeader tests the parsing of Link headers
+func TestParseLinkHeader(t *testing.T) {
+	links := parseLinkHeader(`<https://api/items?page=3>; rel="next last", <https://api/items?page=1>;rel=prev, invalid; rel="first"`)
+	if links["next"] != "https://api/items?page=3" || links["last"] != "https://api/items?page=3" || links["prev"] != "https://api/items?page=1" {
+		t.Errorf("unexpected links %v", links)
+	}
+	if _, ok := links["first"]; ok {
+		t.Errorf("expected the invalid link to be ignored, got %v", links)
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default TLS passthrough settings
+const (
+	defaultPassthroughHandshakeTimeout = 5000
+	defaultPassthroughConnectTimeout   = 5000
+)
+
+// PassthroughConfig represents the routing of the TLS connections of a listener by SNI to backends that
+// terminate TLS themselves
+type PassthroughConfig struct {
+	// Routes maps server names, e.g. db.example.com or *.example.com, to the backend address (host:port) the
+	// connections for the name are forwarded to
+	Routes map[string]string `json:"routes"`
+	// DefaultBackend is the backend address of the connections without a server name or with one without a
+	// route; they are closed if empty
+	DefaultBackend string `json:"default_backend"`
+	// HandshakeTimeout is the time in milliseconds a client has to send its TLS ClientHello (default 5000)
+	HandshakeTimeout int `json:"handshake_timeout"`
+	// ConnectTimeout is the timeout in milliseconds of the backend connections (default 5000)
+	ConnectTimeout int `json:"connect_timeout"`
+}
+
+// enabled checks whether the listener routes TLS connections instead of serving HTTP
+func (c PassthroughConfig) enabled() bool {
+	return len(c.Routes) > 0 || c.DefaultBackend != ""
+}
+
+// withDefaults returns the configuration with the defaults of the unset settings and the server names of the
+// routes in lower case
+func (c PassthroughConfig) withDefaults() PassthroughConfig {
+	if c.HandshakeTimeout <= 0 {
+		c.HandshakeTimeout = defaultPassthroughHandshakeTimeout
+	}
+	if c.ConnectTimeout <= 0 {
+		c.ConnectTimeout = defaultPassthroughConnectTimeout
+	}
+	routes := make(map[string]string, len(c.Routes))
+	for serverName, backend := range c.Routes {
+		routes[strings.ToLower(serverName)] = backend
+	}
+	c.Routes = routes
+	return c
+}
+
+// backend returns the backend address of a server name: the backend of the exact name, else of the wildcard
+// name matching it, else the default backend
+func (c PassthroughConfig) backend(serverName string) (string, bool) {
+	serverName = strings.ToLower(strings.TrimSuffix(serverName, "."))
+	if serverName != "" {
+		if backend, ok := c.Routes[serverName]; ok {
+			return backend, true
+		}
+		if _, parent, ok := strings.Cut(serverName, "."); ok {
+			if backend, ok := c.Routes["*."+parent]; ok {
+				return backend, true
+			}
+		}
+	}
+	return c.DefaultBackend, c.DefaultBackend != ""
+}
+
+// validatePassthrough checks the server names and backend addresses of a listener routing TLS connections,
+// which cannot terminate TLS itself
+func validatePassthrough(listener ListenerConfig) error {
+	config := listener.Passthrough
+	if !config.enabled() {
+		return nil
+	}
+	if listener.TLS.Enabled() {
+		return errors.New("tls and passthrough are mutually exclusive")
+	}
+	for serverName, backend := range config.Routes {
+		if serverName == "" || strings.Contains(strings.TrimPrefix(serverName, "*."), "*") {
+			return fmt.Errorf("invalid passthrough server name %q", serverName)
+		}
+		if err := validateBackendAddress(backend); err != nil {
+			return err
+		}
+	}
+	if config.DefaultBackend != "" {
+		return validateBackendAddress(config.DefaultBackend)
+	}
+	return nil
+}
+
+// validateBackendAddress checks that a passthrough backend is a host:port address
+func validateBackendAddress(address string) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || host == "" || port == "" {
+		return fmt.Errorf("invalid passthrough backend %q: must be a host:port address", address)
+	}
+	return nil
+}
+
+// errClientHelloRead aborts the handshake reading the ClientHello of a connection
+var errClientHelloRead = errors.New("client hello read")
+
+// readOnlyConn feeds a TLS server handshake from a reader and fails its writes, so the handshake parses the
+// ClientHello of a client without answering it
+type readOnlyConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+// Read reads from the reader instead of the connection
+func (c readOnlyConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// Write discards the writes of the handshake
+func (c readOnlyConn) Write(b []byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+// readClientHello reads the ClientHello of a TLS connection and returns the server name it requests and the
+// bytes read, which must be replayed to the backend
+func readClientHello(conn net.Conn) (string, []byte, error) {
+	var read bytes.Buffer
+	var serverName string
+	received := false
+	err := tls.Server(readOnlyConn{Conn: conn, reader: io.TeeReader(conn, &read)}, &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverName = hello.ServerName
+			received = true
+			return nil, errClientHelloRead
+		},
+	}).Handshake()
+	if !received {
+		return "", nil, fmt.Errorf("no TLS ClientHello received: %w", err)
+	}
+	return serverName, read.Bytes(), nil
+}
+
+// PassthroughServer forwards the TLS connections of a listener to the backend of the server name they
+// request, without terminating TLS, so the backends keep their own certificates and client authentication
+type PassthroughServer struct {
+	name   string
+	config PassthroughConfig
+	dialer *net.Dialer
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// NewPassthroughServer creates a new PassthroughServer for the listener with the given name
+func NewPassthroughServer(name string, config PassthroughConfig) *PassthroughServer {
+	config = config.withDefaults()
+	return &PassthroughServer{
+		name:   name,
+		config: config,
+		dialer: &net.Dialer{Timeout: time.Duration(config.ConnectTimeout) * time.Millisecond},
+		conns:  make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve accepts the connections of a listener until the server is shut down, returning http.ErrServerClosed
+// like an http.Server
+func (s *PassthroughServer) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = listener.Close()
+		return http.ErrServerClosed
+	}
+	s.listener = listener
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return http.ErrServerClosed
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return http.ErrServerClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+				s.wg.Done()
+			}()
+			s.serveConn(conn)
+		}()
+	}
+}
+
+// serveConn forwards a connection to the backend of the server name of its ClientHello
+func (s *PassthroughServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+	start := time.Now()
+	fields := map[string]interface{}{
+		"listener":    s.name,
+		"remote_addr": conn.RemoteAddr().String(),
+	}
+
+	// Read the ClientHello within the handshake timeout, so idle connections do not hold the listener
+	_ = conn.SetReadDeadline(start.Add(time.Duration(s.config.HandshakeTimeout) * time.Millisecond))
+	serverName, hello, err := readClientHello(conn)
+	if err != nil {
+		fields["error"] = err.Error()
+		LogWarn("Passthrough connection without TLS ClientHello", fields)
+		return
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+	fields["server_name"] = serverName
+
+	backend, ok := s.config.backend(serverName)
+	if !ok {
+		LogWarn("No passthrough route for server name", fields)
+		return
+	}
+	fields["backend"] = backend
+
+	upstream, err := s.dialer.Dial("tcp", backend)
+	if err != nil {
+		LogError("Passthrough backend connection failed", err, fields)
+		return
+	}
+	defer upstream.Close()
+	if _, err := upstream.Write(hello); err != nil {
+		LogError("Passthrough backend connection failed", err, fields)
+		return
+	}
+
+	// Splice the connections until both directions are closed
+	var sent int64
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sent, _ = io.Copy(upstream, conn)
+		closeWrite(upstream)
+	}()
+	received, _ := io.Copy(conn, upstream)
+	closeWrite(conn)
+	<-done
+
+	fields["bytes_sent"] = sent + int64(len(hello))
+	fields["bytes_received"] = received
+	fields["duration_ms"] = time.Since(start).Milliseconds()
+	LogInfo("Passthrough connection closed", fields)
+}
+
+// closeWrite closes the sending side of a connection, or the whole connection if it cannot be half-closed
+func closeWrite(conn net.Conn) {
+	if c, ok := conn.(interface{ CloseWrite() error }); ok {
+		_ = c.CloseWrite()
+		return
+	}
+	_ = conn.Close()
+}
+
+// Shutdown stops accepting connections and waits for the forwarded connections to close until the context
+// expires, then closes them
+func (s *PassthroughServer) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		s.mu.Lock()
+		for conn := range s.conns {
+			_ = conn.Close()
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
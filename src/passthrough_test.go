@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestPassthroughListener tests that a passthrough listener routes the TLS connections by SNI to backends
+// terminating TLS themselves
+func TestPassthroughListener(t *testing.T) {
+	backend := func(name string) *httptest.Server {
+		return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, name+" "+r.TLS.ServerName)
+		}))
+	}
+	apiServer := backend("api")
+	defer apiServer.Close()
+	dbServer := backend("db")
+	defer dbServer.Close()
+
+	gateway := NewGateway(Config{
+		Listeners: []ListenerConfig{{
+			Name:    "sni",
+			Address: "127.0.0.1:0",
+			Passthrough: PassthroughConfig{
+				Routes: map[string]string{
+					"API.example.com":  strings.TrimPrefix(apiServer.URL, "https://"),
+					"*.db.example.com": strings.TrimPrefix(dbServer.URL, "https://"),
+				},
+			},
+		}},
+	}, nil)
+	if err := gateway.Initialize(); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- gateway.Start()
+	}()
+
+	// Wait for the gateway to start listening
+	deadline := time.Now().Add(2 * time.Second)
+	var address string
+	for address == "" && time.Now().Before(deadline) {
+		gateway.mu.Lock()
+		if len(gateway.listeners) > 0 {
+			address = gateway.listeners[0].Addr().String()
+		}
+		gateway.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	get := func(serverName string) (string, error) {
+		// Close the connection afterwards, the spliced connections are only closed by the clients and backends
+		transport := &http.Transport{TLSClientConfig: &tls.Config{ServerName: serverName, InsecureSkipVerify: true}}
+		defer transport.CloseIdleConnections()
+		client := &http.Client{Timeout: 2 * time.Second, Transport: transport}
+		resp, err := client.Get("https://" + address + "/")
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	if body, err := get("api.example.com"); err != nil || body != "api api.example.com" {
+		t.Errorf("Expected the api backend to terminate TLS, got %q %v", body, err)
+	}
+	if body, err := get("eu.db.example.com"); err != nil || body != "db eu.db.example.com" {
+		t.Errorf("Expected the wildcard route to the db backend, got %q %v", body, err)
+	}
+	if _, err := get("other.example.com"); err == nil {
+		t.Error("Expected the connection for a server name without a route to be closed")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := gateway.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if err := <-errCh; err != http.ErrServerClosed {
+		t.Errorf("Start() error = %v, want %v", err, http.ErrServerClosed)
+	}
+}
+
+// TestValidatePassthrough tests the validation of the passthrough listeners and of the endpoints bound to them
+func TestValidatePassthrough(t *testing.T) {
+	tests := []struct {
+		name     string
+		listener ListenerConfig
+		wantErr  bool
+	}{
+		{"routes", ListenerConfig{Passthrough: PassthroughConfig{Routes: map[string]string{"*.example.com": "10.0.0.1:443"}}}, false},
+		{"default backend", ListenerConfig{Passthrough: PassthroughConfig{DefaultBackend: "backend:8443"}}, false},
+		{"backend without port", ListenerConfig{Passthrough: PassthroughConfig{Routes: map[string]string{"a.example.com": "10.0.0.1"}}}, true},
+		{"inner wildcard", ListenerConfig{Passthrough: PassthroughConfig{Routes: map[string]string{"a.*.com": "10.0.0.1:443"}}}, true},
+		{"with tls", ListenerConfig{
+			TLS:         TLSConfig{CertFile: "cert.pem", KeyFile: "key.pem"},
+			Passthrough: PassthroughConfig{DefaultBackend: "backend:8443"},
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validatePassthrough(tt.listener); (err != nil) != tt.wantErr {
+				t.Errorf("validatePassthrough() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	gateway := NewGateway(Config{
+		Listeners: []ListenerConfig{{Name: "sni", Address: ":8443", Passthrough: PassthroughConfig{DefaultBackend: "backend:8443"}}},
+		Endpoints: []Endpoint{{Path: "/api", Backend: "http://backend", Listeners: []string{"sni"}}},
+	}, nil)
+	if err := gateway.Initialize(); err == nil {
+		t.Error("Expected an endpoint bound to a passthrough listener to be rejected")
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Backend path modes, mapping the request path to the backend path
+const (
+	// PathModeAppend appends the request path to the backend path (default)
+	PathModeAppend = "append"
+	// PathModeReplace replaces the part of the request path matched by the endpoint path with the backend path
+	PathModeReplace = "replace"
+	// PathModeTemplate uses the backend path as a template, replacing its :name segments with the path parameters
+	PathModeTemplate = "template"
+)
+
+// validatePathMode checks the path mode of an endpoint against its path and backends
+func validatePathMode(endpoint Endpoint) error {
+	switch endpoint.PathMode {
+	case "", PathModeAppend, PathModeReplace:
+		return nil
+	case PathModeTemplate:
+		template, err := CompilePathTemplate(endpoint.Path)
+		if err != nil {
+			return err
+		}
+		params := make(map[string]bool)
+		for _, segment := range template.segments {
+			if segment.param != "" {
+				params[segment.param] = true
+			}
+		}
+		for _, backend := range append([]string{endpoint.Backend}, endpoint.Backends...) {
+			backendURL, err := url.Parse(backend)
+			if err != nil {
+				continue
+			}
+			for _, segment := range strings.Split(backendURL.Path, "/") {
+				if name, ok := strings.CutPrefix(segment, ":"); ok && !params[name] {
+					return fmt.Errorf("backend path parameter :%s is not a parameter of the endpoint path %s", name, endpoint.Path)
+				}
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid path mode: %s (must be append, replace or template)", endpoint.PathMode)
+}
+
+// warnDoublePath warns about endpoints in append mode whose backend path repeats the endpoint path,
+// which sends e.g. /api/users to /api/users/api/users
+func warnDoublePath(endpoint Endpoint) {
+	if endpoint.PathMode != "" && endpoint.PathMode != PathModeAppend {
+		return
+	}
+	backendURL, err := url.Parse(endpoint.Backend)
+	if err != nil || strings.Trim(backendURL.Path, "/") == "" || strings.Trim(endpoint.Path, "/") == "" {
+		return
+	}
+	if strings.HasSuffix(strings.TrimSuffix(backendURL.Path, "/"), strings.TrimSuffix(endpoint.Path, "/")) {
+		LogWarn("Backend path repeats the endpoint path and the request path is appended to it, set path_mode to replace or template", map[string]interface{}{
+			"path":    endpoint.Path,
+			"backend": endpoint.Backend,
+		})
+	}
+}
+
+// mapBackendPath returns the backend path of a request with the given path parameters in the replace
+// and template modes
+func (e *Endpoint) mapBackendPath(backendPath, requestPath string, params map[string]string) string {
+	switch e.PathMode {
+	case PathModeReplace:
+		// Keep the segments after the ones matched by the endpoint path, parameters included,
+		// and the ones matched by a trailing wildcard
+		matched := len(strings.Split(strings.TrimSuffix(e.Path, "/"), "/"))
+		if strings.HasPrefix(e.Path[strings.LastIndex(e.Path, "/")+1:], "*") {
+			matched--
+		}
+		segments := strings.Split(requestPath, "/")
+		if len(segments) <= matched {
+			if backendPath == "" {
+				return "/"
+			}
+			return backendPath
+		}
+		return strings.TrimSuffix(backendPath, "/") + "/" + strings.Join(segments[matched:], "/")
+	case PathModeTemplate:
+		segments := strings.Split(backendPath, "/")
+		for i, segment := range segments {
+			if name, ok := strings.CutPrefix(segment, ":"); ok {
+				segments[i] = params[name]
+			}
+		}
+		return strings.Join(segments, "/")
+	}
+	return backendPath
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestPathModes tests how request paths map to the backend path in each mode
+func TestPathModes(t *testing.T) {
+	var received string
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.URL.Path
+	}))
+	defer backendServer.Close()
+
+	tests := []struct {
+		name        string
+		endpoint    Endpoint
+		requestPath string
+		expected    string
+	}{
+		{"append", Endpoint{Path: "/api/", Backend: backendServer.URL + "/v1"}, "/api/users", "/v1/api/users"},
+		{"append by default repeats the path", Endpoint{Path: "/users", Backend: backendServer.URL + "/users"}, "/users", "/users/users"},
+		{"replace", Endpoint{Path: "/users", Backend: backendServer.URL + "/users", PathMode: PathModeReplace}, "/users", "/users"},
+		{"replace subtree", Endpoint{Path: "/api/users/", Backend: backendServer.URL + "/v2/people", PathMode: PathModeReplace}, "/api/users/42/profile", "/v2/people/42/profile"},
+		{"replace keeps the trailing slash", Endpoint{Path: "/api/users/", Backend: backendServer.URL + "/v2/people", PathMode: PathModeReplace}, "/api/users/", "/v2/people/"},
+		{"replace with an empty backend path", Endpoint{Path: "/legacy/", Backend: backendServer.URL, PathMode: PathModeReplace}, "/legacy/index.html", "/index.html"},
+		{"replace with parameters", Endpoint{Path: "/api/:tenant/files/", Backend: backendServer.URL + "/storage", PathMode: PathModeReplace}, "/api/acme/files/a.txt", "/storage/a.txt"},
+		{"template", Endpoint{Path: "/api/users/:id", Backend: backendServer.URL + "/people/:id/profile", PathMode: PathModeTemplate}, "/api/users/42", "/people/42/profile"},
+	}
+	for _, test := range tests {
+		received = ""
+		rr := httptest.NewRecorder()
+		NewProxy(test.endpoint, false, nil).Handler().ServeHTTP(rr, httptest.NewRequest("GET", test.requestPath, nil))
+		if rr.Code != http.StatusOK || received != test.expected {
+			t.Errorf("%s: expected backend path %s, got %s (status %d)", test.name, test.expected, received, rr.Code)
+		}
+	}
+}
+
+// TestValidatePathMode tests that invalid path modes and unknown template parameters are rejected
+func TestValidatePathMode(t *testing.T) {
+	tests := []struct {
+		endpoint Endpoint
+		valid    bool
+	}{
+		{Endpoint{Path: "/a", Backend: "http://b/a"}, true},
+		{Endpoint{Path: "/a", Backend: "http://b/a", PathMode: "prefix"}, false},
+		{Endpoint{Path: "/a/:id", Backend: "http://b/items/:id", PathMode: PathModeTemplate}, true},
+		{Endpoint{Path: "/a/:id", Backend: "http://b/items/:name", PathMode: PathModeTemplate}, false},
+		{Endpoint{Path: "/a/:id", Backends: []string{"http://b/items/:id", "http://c/items/:key"}, PathMode: PathModeTemplate}, false},
+	}
+	for _, test := range tests {
+		if err := validatePathMode(test.endpoint); (err == nil) != test.valid {
+			t.Errorf("%+v: expected valid %v, got %v", test.endpoint, test.valid, err)
+		}
+	}
+
+	// Endpoints with an invalid path mode are not proxied
+	rr := httptest.NewRecorder()
+	NewProxy(Endpoint{Path: "/a", Backend: "http://localhost", PathMode: "prefix"}, false, nil).Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/a", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500 for an invalid path mode, got %d", rr.Code)
+	}
+}
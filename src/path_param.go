@@ -1,38 +1,179 @@
 package main
 
 import (
+	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 )
 
-// PathParamExtractor extracts path parameters from URLs
-type PathParamExtractor struct{}
+// pathSegment is a precompiled segment of a path template
+type pathSegment struct {
+	// literal is the segment text if it is neither a parameter nor a wildcard
+	literal string
+	// param is the name of a :name parameter or of a *name wildcard
+	param string
+	// constraint restricts the values of a :name(regex) parameter
+	constraint *regexp.Regexp
+	// wildcard matches any segment, or the rest of the path as the last segment
+	wildcard bool
+}
 
-// Extract extracts path parameters from a request URL based on the pattern path
-// For example, if the pattern path is "/api/users/:id" and the request path is "/api/users/123",
-// this function will return a map with "id" -> "123"
-func (p PathParamExtractor) Extract(patternPath, requestPath string) map[string]string {
-	params := make(map[string]string)
+// PathTemplate is an endpoint path pattern compiled into segment matchers, e.g. /api/users/:id([0-9]+)
+// or /files/*path
+type PathTemplate struct {
+	pattern  string
+	segments []pathSegment
+	// dynamic is set if the template has parameters or wildcards, constrained if some parameters have a regex
+	dynamic     bool
+	constrained bool
+}
 
-	// Split the paths into segments
-	patternSegments := strings.Split(patternPath, "/")
-	requestSegments := strings.Split(requestPath, "/")
+// CompilePathTemplate compiles a path pattern. Segments may be literals, :name parameters, :name(regex)
+// parameters whose value must fully match the regex, * wildcards matching any segment, and as the last
+// segment * or *name wildcards matching the rest of the path.
+func CompilePathTemplate(pattern string) (*PathTemplate, error) {
+	template := &PathTemplate{pattern: pattern}
+	parts := strings.Split(pattern, "/")
+	for i, part := range parts {
+		var segment pathSegment
+		switch {
+		case strings.HasPrefix(part, ":"):
+			name, constraint, hasConstraint := strings.Cut(part[1:], "(")
+			if name == "" {
+				return nil, fmt.Errorf("path parameter without a name in %s", pattern)
+			}
+			segment.param = name
+			if hasConstraint {
+				if !strings.HasSuffix(constraint, ")") {
+					return nil, fmt.Errorf("unterminated constraint of path parameter :%s in %s", name, pattern)
+				}
+				re, err := regexp.Compile("^(?:" + strings.TrimSuffix(constraint, ")") + ")$")
+				if err != nil {
+					return nil, fmt.Errorf("invalid constraint of path parameter :%s: %w", name, err)
+				}
+				segment.constraint = re
+				template.constrained = true
+			}
+			template.dynamic = true
+		case strings.HasPrefix(part, "*"):
+			if part != "*" && i != len(parts)-1 {
+				return nil, fmt.Errorf("named wildcard %s must be the last segment of %s", part, pattern)
+			}
+			segment.param = part[1:]
+			segment.wildcard = true
+			template.dynamic = true
+		default:
+			segment.literal = part
+		}
+		template.segments = append(template.segments, segment)
+	}
+	return template, nil
+}
 
-	// If the paths have different number of segments, return empty map
-	if len(patternSegments) != len(requestSegments) {
-		return params
+// Match checks whether a request path matches the template and returns its parameters
+func (t *PathTemplate) Match(requestPath string) (map[string]string, bool) {
+	var params map[string]string
+	setParam := func(name, value string) {
+		if name == "" {
+			return
+		}
+		if params == nil {
+			params = make(map[string]string)
+		}
+		params[name] = value
 	}
 
-	// Compare each segment and extract parameters
-	for i, patternSegment := range patternSegments {
-		if i < len(requestSegments) {
-			// Check if this segment is a parameter (starts with ":")
-			if strings.HasPrefix(patternSegment, ":") {
-				paramName := patternSegment[1:] // Remove the ":" prefix
-				paramValue := requestSegments[i]
-				params[paramName] = paramValue
+	rest := requestPath
+	for i, segment := range t.segments {
+		last := i == len(t.segments)-1
+		if last && segment.wildcard {
+			setParam(segment.param, rest)
+			return params, true
+		}
+
+		value, remainder, more := strings.Cut(rest, "/")
+		if more == last {
+			// The request path has more or fewer segments than the template
+			return nil, false
+		}
+		switch {
+		case segment.wildcard:
+		case segment.param != "":
+			if segment.constraint != nil && !segment.constraint.MatchString(value) {
+				return nil, false
 			}
+			setParam(segment.param, value)
+		case segment.literal != value:
+			return nil, false
+		}
+		rest = remainder
+	}
+	return params, true
+}
+
+// muxPattern returns the http.ServeMux pattern routing the requests of the template, with a {name}
+// wildcard for each parameter and wildcard segment. Regex constraints are not part of the pattern.
+func (t *PathTemplate) muxPattern() string {
+	if !t.dynamic {
+		return t.pattern
+	}
+	parts := make([]string, len(t.segments))
+	for i, segment := range t.segments {
+		switch {
+		case segment.wildcard && i == len(t.segments)-1:
+			parts[i] = "{p" + strconv.Itoa(i) + "...}"
+		case segment.wildcard || segment.param != "":
+			// Parameter names may not be valid wildcard names, they are extracted by the template
+			parts[i] = "{p" + strconv.Itoa(i) + "}"
+		default:
+			parts[i] = segment.literal
 		}
 	}
+	return strings.Join(parts, "/")
+}
+
+// pathTemplates caches the compiled templates by pattern
+var pathTemplates sync.Map
+
+// compiledPathTemplate returns the compiled template of a pattern, compiling it on first use
+func compiledPathTemplate(pattern string) (*PathTemplate, error) {
+	if template, ok := pathTemplates.Load(pattern); ok {
+		return template.(*PathTemplate), nil
+	}
+	template, err := CompilePathTemplate(pattern)
+	if err != nil {
+		return nil, err
+	}
+	pathTemplates.Store(pattern, template)
+	return template, nil
+}
+
+// muxPattern returns the http.ServeMux pattern of an endpoint path, or the path itself if it is invalid
+func muxPattern(path string) string {
+	template, err := compiledPathTemplate(path)
+	if err != nil {
+		return path
+	}
+	return template.muxPattern()
+}
+
+// PathParamExtractor extracts path parameters from URLs
+type PathParamExtractor struct{}
 
+// Extract extracts path parameters from a request URL based on the pattern path
+// For example, if the pattern path is "/api/users/:id" and the request path is "/api/users/123",
+// this function will return a map with "id" -> "123".
+// The pattern is compiled on first use, and an empty map is returned if the request path does not match it.
+func (p PathParamExtractor) Extract(patternPath, requestPath string) map[string]string {
+	template, err := compiledPathTemplate(patternPath)
+	if err != nil {
+		return map[string]string{}
+	}
+	params, ok := template.Match(requestPath)
+	if !ok || params == nil {
+		return map[string]string{}
+	}
 	return params
 }
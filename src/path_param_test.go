@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// TestPathTemplateMatch tests matching request paths against compiled path templates
+func TestPathTemplateMatch(t *testing.T) {
+	tests := []struct {
+		pattern     string
+		requestPath string
+		matched     bool
+		params      map[string]string
+	}{
+		{"/api/users", "/api/users", true, nil},
+		{"/api/users", "/api/posts", false, nil},
+		{"/api/users/:id", "/api/users/123", true, map[string]string{"id": "123"}},
+		{"/api/users/:id", "/api/users/123/extra", false, nil},
+		{"/api/users/:id", "/api/users", false, nil},
+		{"/api/users/:id/posts/:postId", "/api/users/1/posts/2", true, map[string]string{"id": "1", "postId": "2"}},
+		{"/api/users/:id([0-9]+)", "/api/users/123", true, map[string]string{"id": "123"}},
+		{"/api/users/:id([0-9]+)", "/api/users/me", false, nil},
+		{"/api/users/:id([0-9]+)", "/api/users/12a", false, nil},
+		{"/api/*/status", "/api/orders/status", true, nil},
+		{"/api/*/status", "/api/orders/items/status", false, nil},
+		{"/files/*path", "/files/a/b/c.txt", true, map[string]string{"path": "a/b/c.txt"}},
+		{"/files/*path", "/files/", true, map[string]string{"path": ""}},
+		{"/files/*path", "/files", false, nil},
+		{"/static/*", "/static/css/app.css", true, nil},
+	}
+	for _, test := range tests {
+		template, err := CompilePathTemplate(test.pattern)
+		if err != nil {
+			t.Fatalf("failed to compile %s: %v", test.pattern, err)
+		}
+		params, matched := template.Match(test.requestPath)
+		if matched != test.matched || !reflect.DeepEqual(params, test.params) {
+			t.Errorf("%s with %s: expected %v and %v, got %v and %v", test.pattern, test.requestPath, test.matched, test.params, matched, params)
+		}
+	}
+
+	// Invalid templates are rejected
+	for _, pattern := range []string{"/api/:", "/api/:id([0-9]+", "/api/:id([)", "/files/*path/meta"} {
+		if _, err := CompilePathTemplate(pattern); err == nil {
+			t.Errorf("expected %s to be rejected", pattern)
+		}
+	}
+}
+
+// TestMuxPattern tests the http.ServeMux patterns of endpoint paths
+func TestMuxPattern(t *testing.T) {
+	tests := map[string]string{
+		"/api/users":                  "/api/users",
+		"/api/":                       "/api/",
+		"/api/users/:id":              "/api/users/{p3}",
+		"/api/users/:user-id([0-9]+)": "/api/users/{p3}",
+		"/api/*/status":               "/api/{p2}/status",
+		"/files/*path":                "/files/{p2...}",
+		"/api/:":                      "/api/:",
+	}
+	for path, expected := range tests {
+		if pattern := muxPattern(path); pattern != expected {
+			t.Errorf("%s: expected %s, got %s", path, expected, pattern)
+		}
+	}
+}
+
+// TestPathTemplateRouting tests that endpoints with path parameters are routed and their constraints enforced
+func TestPathTemplateRouting(t *testing.T) {
+	var received string
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.URL.Path
+	}))
+	defer backendServer.Close()
+
+	gateway := NewGateway(Config{
+		Endpoints: []Endpoint{
+			{Path: "/api/users/:id([0-9]+)", Backend: backendServer.URL + "/people/:id", PathMode: PathModeTemplate},
+			{Path: "/files/*path", Backend: backendServer.URL + "/storage", PathMode: PathModeReplace},
+		},
+	}, nil)
+	gateway.RegisterEndpoints()
+
+	tests := []struct {
+		path     string
+		expected int
+		backend  string
+	}{
+		{"/api/users/42", http.StatusOK, "/people/42"},
+		{"/api/users/me", http.StatusNotFound, ""},
+		{"/files/docs/report.pdf", http.StatusOK, "/storage/docs/report.pdf"},
+	}
+	for _, test := range tests {
+		received = ""
+		rr := httptest.NewRecorder()
+		gateway.mux.ServeHTTP(rr, httptest.NewRequest("GET", test.path, nil))
+		if rr.Code != test.expected || received != test.backend {
+			t.Errorf("%s: expected status %d and backend path %q, got %d and %q", test.path, test.expected, test.backend, rr.Code, received)
+		}
+	}
+}
+
+// BenchmarkExtract measures extracting the parameters of a request path with a precompiled template
+func BenchmarkExtract(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		PathParamExtractor{}.Extract("/api/users/:id([0-9]+)/posts/:postId", "/api/users/123/posts/456")
+	}
+}
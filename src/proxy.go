@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,6 +19,15 @@ type RequestCallback func(req *http.Request) *http.Request
 // ResponseCallback is a function that can modify a response before it's sent back to the client
 type ResponseCallback func(resp *http.Response, req *http.Request) *http.Response
 
+// backendOverrideKey is the context key for a backend URL overriding the endpoint backend
+type backendOverrideKey struct{}
+
+// WithBackendOverride returns a context that makes the proxy forward the request to the given backend
+// instead of the configured endpoint backend
+func WithBackendOverride(ctx context.Context, backend string) context.Context {
+	return context.WithValue(ctx, backendOverrideKey{}, backend)
+}
+
 // Proxy handles the proxying of requests to backend services
 type Proxy struct {
 	endpoint             Endpoint
@@ -22,31 +35,311 @@ type Proxy struct {
 	preBackendCallbacks  []RequestCallback
 	postBackendCallbacks []ResponseCallback
 	telemetry            *TelemetryManager
+	transport            *http.Transport
+	transportErr         error
+	overrideTransport    *http.Transport
+	pathErr              error
+	methodNotAllowed     CustomResponseConfig
+	retryBudget          *RetryBudget
+	pool                 *BackendPool
+	blueGreen            *BlueGreen
+	concurrency          *AdaptiveConcurrency
+	certificates         *CertificateMonitor
+	cache                *ResponseCache
+	connections          *connectionPool
+	// scheduled are the proxies of the scheduled changes of the endpoint and applied the number of them in effect
+	scheduled []scheduledProxy
+	applied   atomic.Int64
+	now       func() time.Time
+
+	// methodNotAllowedHandler replaces the method not allowed response if set
+	methodNotAllowedHandler http.Handler
 }
 
 // NewProxy creates a new Proxy for the given endpoint
 func NewProxy(endpoint Endpoint, debug bool, telemetry *TelemetryManager) *Proxy {
+	transport, err := newTransport(endpoint)
+	if err != nil {
+		LogError("Invalid upstream transport configuration", err, map[string]interface{}{
+			"path":      endpoint.Path,
+			"proxy_url": endpoint.ProxyURL,
+		})
+	}
+
+	// Balance across backend instances if more than one is configured
+	var pool *BackendPool
+	if len(endpoint.Backends) > 0 {
+		pool = NewBackendPool(metricsRoute(endpoint), endpoint.Backends, endpoint.OutlierDetection, telemetry)
+	}
+
+	// Route to the active target group if blue and green groups are configured
+	var blueGreen *BlueGreen
+	if endpoint.BlueGreen.enabled() {
+		blueGreen = NewBlueGreen(endpoint.Path, endpoint.BlueGreen, endpoint.OutlierDetection, telemetry)
+	}
+
+	// Limit the in-flight requests of each backend instance if configured
+	var concurrency *AdaptiveConcurrency
+	if endpoint.AdaptiveConcurrency.Enabled {
+		concurrency = NewAdaptiveConcurrency(metricsRoute(endpoint), endpoint.AdaptiveConcurrency, telemetry)
+	}
+
+	// Compile the endpoint path and check how request paths map to the backend path
+	_, pathErr := compiledPathTemplate(endpoint.Path)
+	if pathErr == nil {
+		pathErr = validatePathMode(endpoint)
+	}
+	if pathErr != nil {
+		LogError("Invalid backend path configuration", pathErr, map[string]interface{}{
+			"path":      endpoint.Path,
+			"path_mode": endpoint.PathMode,
+		})
+	} else {
+		warnDoublePath(endpoint)
+	}
+
+	// Track the upstream connections by backend instance
+	var connections *connectionPool
+	if transport != nil {
+		connections = newConnectionPool(metricsRoute(endpoint), transport, telemetry)
+	}
+
+	// Requests of trusted callers overriding the timeout use a transport without the response header timeout
+	var overrideTransport *http.Transport
+	if endpoint.TimeoutOverride.MaxTimeout > 0 && transport != nil {
+		overrideTransport = newOverrideTransport(transport)
+	}
+
+	// Prepare the scheduled changes, they keep the blue/green state of the endpoint
+	scheduled := newScheduledProxies(endpoint, debug, telemetry)
+	for _, change := range scheduled {
+		if change.proxy.blueGreen != nil {
+			change.proxy.blueGreen = blueGreen
+		}
+	}
+
 	return &Proxy{
 		endpoint:             endpoint,
 		debug:                debug,
 		preBackendCallbacks:  []RequestCallback{},
 		postBackendCallbacks: []ResponseCallback{},
 		telemetry:            telemetry,
+		transport:            transport,
+		transportErr:         err,
+		overrideTransport:    overrideTransport,
+		pathErr:              pathErr,
+		pool:                 pool,
+		blueGreen:            blueGreen,
+		concurrency:          concurrency,
+		connections:          connections,
+		scheduled:            scheduled,
+		now:                  time.Now,
+	}
+}
+
+// newTransport creates the HTTP transport used to connect to the endpoint backend.
+// Upstream connections go through the endpoint proxy URL if one is configured,
+// otherwise the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables are honored.
+func newTransport(endpoint Endpoint) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+
+	// Set timeout for the request
+	if endpoint.Timeout > 0 {
+		transport.ResponseHeaderTimeout = time.Duration(endpoint.Timeout) * time.Millisecond
 	}
+
+	// Use the configured egress proxy, HTTPS backends are tunneled through it with CONNECT
+	if endpoint.ProxyURL != "" {
+		proxyURL, err := url.Parse(endpoint.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse proxy URL: %w", err)
+		}
+		if proxyURL.Scheme != "http" && proxyURL.Scheme != "https" && proxyURL.Scheme != "socks5" {
+			return nil, fmt.Errorf("invalid proxy URL scheme: %s (must be http, https or socks5)", proxyURL.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	return transport, nil
+}
+
+// SetRetryBudget sets the budget limiting the retries of this proxy, which may be shared with other proxies
+func (p *Proxy) SetRetryBudget(budget *RetryBudget) {
+	p.each(func(proxy *Proxy) { proxy.retryBudget = budget })
+}
+
+// SetNotifier sets the notifier receiving the operational events of the proxy
+func (p *Proxy) SetNotifier(notifier *Notifier) {
+	p.each(func(proxy *Proxy) {
+		if proxy.pool != nil {
+			proxy.pool.notifier = notifier
+		}
+		if proxy.blueGreen != nil {
+			proxy.blueGreen.notifier = notifier
+		}
+	})
+}
+
+// SetMethodNotAllowedResponse sets the custom response to requests with a method the endpoint does not allow
+func (p *Proxy) SetMethodNotAllowedResponse(response CustomResponseConfig) {
+	p.each(func(proxy *Proxy) { proxy.methodNotAllowed = response })
+}
+
+// SetMethodNotAllowedHandler sets the handler answering requests with a method the endpoint does not allow
+// instead of the method not allowed response. The Allow header is already set when it is called.
+func (p *Proxy) SetMethodNotAllowedHandler(handler http.Handler) {
+	p.each(func(proxy *Proxy) { proxy.methodNotAllowedHandler = handler })
+}
+
+// SetCertificateMonitor sets the monitor tracking the expiry of the upstream certificates
+func (p *Proxy) SetCertificateMonitor(monitor *CertificateMonitor) {
+	p.each(func(proxy *Proxy) { proxy.certificates = monitor })
+}
+
+// SetResponseCache sets the response cache the cached fallbacks of the status mappings are served from
+func (p *Proxy) SetResponseCache(cache *ResponseCache) {
+	p.each(func(proxy *Proxy) { proxy.cache = cache })
+}
+
+// roundTripper returns the round tripper used for upstream requests over the given transport, retrying,
+// reporting to outlier detection and limiting the backend concurrency if configured
+func (p *Proxy) roundTripper(base *http.Transport) http.RoundTripper {
+	var transport http.RoundTripper = base
+	if p.connections != nil {
+		transport = &connectionPoolTransport{next: transport, pool: p.connections}
+	}
+	transport = &attemptTransport{next: transport}
+	if p.certificates != nil {
+		transport = &certificateTransport{next: transport, monitor: p.certificates}
+	}
+	if p.pool != nil {
+		transport = &outlierTransport{next: transport, pool: p.pool}
+	}
+	if p.concurrency != nil {
+		transport = &concurrencyTransport{next: transport, concurrency: p.concurrency}
+	}
+
+	if p.endpoint.Retry.MaxRetries <= 0 {
+		return transport
+	}
+	return &retryTransport{
+		next:      transport,
+		config:    p.endpoint.Retry,
+		budget:    p.retryBudget,
+		telemetry: p.telemetry,
+		route:     metricsRoute(p.endpoint),
+		pool:      p.pool,
+	}
+}
+
+// CloseIdleConnections closes the idle upstream connections of the proxy and of its scheduled changes, e.g.
+// once the endpoint was replaced
+func (p *Proxy) CloseIdleConnections() {
+	p.each(func(proxy *Proxy) {
+		if proxy.transport != nil {
+			proxy.transport.CloseIdleConnections()
+		}
+		if proxy.overrideTransport != nil {
+			proxy.overrideTransport.CloseIdleConnections()
+		}
+	})
 }
 
 // AddPreBackendCallback adds a callback to be executed before the request is sent to the backend
 func (p *Proxy) AddPreBackendCallback(callback RequestCallback) {
-	p.preBackendCallbacks = append(p.preBackendCallbacks, callback)
+	p.each(func(proxy *Proxy) { proxy.preBackendCallbacks = append(proxy.preBackendCallbacks, callback) })
 }
 
 // AddPostBackendCallback adds a callback to be executed after the response is received from the backend
 func (p *Proxy) AddPostBackendCallback(callback ResponseCallback) {
-	p.postBackendCallbacks = append(p.postBackendCallbacks, callback)
+	p.each(func(proxy *Proxy) { proxy.postBackendCallbacks = append(proxy.postBackendCallbacks, callback) })
+}
+
+// BackendStatuses returns the health of the backend instances of the endpoint
+func (p *Proxy) BackendStatuses() []BackendStatus {
+	if current := p.Current(); current != p {
+		return current.BackendStatuses()
+	}
+	if p.blueGreen != nil {
+		return p.blueGreen.Status().Backends
+	}
+	if p.pool != nil {
+		return p.pool.Statuses()
+	}
+	if p.endpoint.Backend == "" {
+		return []BackendStatus{}
+	}
+	return []BackendStatus{{URL: p.endpoint.Backend}}
+}
+
+// rewriteBackendURL maps the path, path parameters and query parameters of a request to the URL of an
+// upstream request whose target has already been set to the backend URL
+func (p *Proxy) rewriteBackendURL(target *url.URL, backendURL *url.URL, r *http.Request) {
+	// Strip the client query parameters the endpoint does not forward
+	if p.endpoint.QueryPolicy.enabled() {
+		q := target.Query()
+		if stripped := p.endpoint.QueryPolicy.strip(q, backendURL.Query()); len(stripped) > 0 {
+			target.RawQuery = q.Encode()
+			if p.debug {
+				LogInfo("Query parameters stripped", map[string]interface{}{
+					"path":   r.URL.Path,
+					"params": stripped,
+				})
+			}
+		}
+	}
+
+	// Rename the client query parameters and add the missing defaults
+	if len(p.endpoint.QueryTransform.Rename) > 0 || len(p.endpoint.QueryTransform.Defaults) > 0 {
+		q := target.Query()
+		p.endpoint.QueryTransform.apply(q, p.pathParams(r))
+		target.RawQuery = q.Encode()
+	}
+
+	// Map the request path to the backend path, the default mode appends it
+	if p.endpoint.PathMode == PathModeReplace || p.endpoint.PathMode == PathModeTemplate {
+		target.Path = p.endpoint.mapBackendPath(backendURL.Path, r.URL.Path, p.pathParams(r))
+		target.RawPath = ""
+	}
+
+	// Handle path parameters if needed
+	if p.endpoint.HasPathParams {
+		// Replace path parameters in the backend URL
+		for paramName, paramValue := range p.pathParams(r) {
+			target.Path = strings.Replace(target.Path, ":"+paramName, paramValue, -1)
+
+			// Also add as query parameter for backends that might need it
+			q := target.Query()
+			q.Set(paramName, paramValue)
+			target.RawQuery = q.Encode()
+		}
+	}
+
+	// Add custom query parameters, whose values may contain path parameters
+	q := target.Query()
+	if p.endpoint.FieldFiltering.Enabled {
+		q.Del(p.endpoint.FieldFiltering.param())
+	}
+	if len(p.endpoint.QueryParams) > 0 {
+		params := p.pathParams(r)
+		for key, value := range p.endpoint.QueryParams {
+			q.Set(key, expandPathParams(value, params))
+		}
+	}
+	target.RawQuery = q.Encode()
 }
 
 // Handler returns an http.HandlerFunc that handles the proxying of requests
 func (p *Proxy) Handler() http.HandlerFunc {
+	if len(p.scheduled) > 0 {
+		return p.scheduledHandler()
+	}
+	return p.handler()
+}
+
+// handler returns the http.HandlerFunc proxying the requests with the settings of this proxy
+func (p *Proxy) handler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		startTime := time.Now()
 
@@ -60,15 +353,46 @@ func (p *Proxy) Handler() http.HandlerFunc {
 				"expected_method": p.endpoint.Method,
 				"path":            r.URL.Path,
 			})
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			w.Header().Set("Allow", p.endpoint.Method)
+			if p.methodNotAllowedHandler != nil {
+				p.methodNotAllowedHandler.ServeHTTP(w, r)
+				return
+			}
+			p.methodNotAllowed.write(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		// Make sure the upstream transport is usable
+		if p.transportErr != nil {
+			LogError("Invalid upstream transport configuration", p.transportErr, map[string]interface{}{
+				"path": r.URL.Path,
+			})
+			http.Error(w, "Invalid upstream configuration", http.StatusInternalServerError)
+			return
+		}
+		if p.pathErr != nil {
+			LogError("Invalid backend path configuration", p.pathErr, map[string]interface{}{
+				"path": r.URL.Path,
+			})
+			http.Error(w, "Invalid upstream configuration", http.StatusInternalServerError)
 			return
 		}
 
+		// Determine the backend, middlewares may override the configured one
+		backend := p.endpoint.Backend
+		if override, ok := r.Context().Value(backendOverrideKey{}).(string); ok {
+			backend = override
+		} else if p.blueGreen != nil {
+			backend = p.blueGreen.Next()
+		} else if p.pool != nil {
+			backend = p.pool.Next()
+		}
+
 		// Parse the backend URL
-		backendURL, err := url.Parse(p.endpoint.Backend)
+		backendURL, err := url.Parse(backend)
 		if err != nil {
 			LogError("Invalid backend URL", err, map[string]interface{}{
-				"backend_url": p.endpoint.Backend,
+				"backend_url": backend,
 				"path":        r.URL.Path,
 			})
 			http.Error(w, "Invalid backend URL", http.StatusInternalServerError)
@@ -78,6 +402,9 @@ func (p *Proxy) Handler() http.HandlerFunc {
 		// Create a reverse proxy
 		proxy := httputil.NewSingleHostReverseProxy(backendURL)
 
+		// Filter the response to the fields requested by the client
+		fields := p.endpoint.FieldFiltering.requested(r)
+
 		// Set up the director function to modify the request
 		originalDirector := proxy.Director
 		proxy.Director = func(req *http.Request) {
@@ -86,27 +413,13 @@ func (p *Proxy) Handler() http.HandlerFunc {
 			// Set the Host header to the backend host
 			req.Host = backendURL.Host
 
-			// Handle path parameters if needed
+			// Map the request path and parameters to the backend URL
+			p.rewriteBackendURL(req.URL, backendURL, r)
 			if p.endpoint.HasPathParams {
-				// Extract path parameters from the request URL
-				pathParams := p.endpoint.ExtractPathParams(r.URL.Path)
-
-				// Replace path parameters in the backend URL
-				backendPath := req.URL.Path
-				for paramName, paramValue := range pathParams {
-					backendPath = strings.Replace(backendPath, ":"+paramName, paramValue, -1)
-
-					// Also add as query parameter for backends that might need it
-					q := req.URL.Query()
-					q.Set(paramName, paramValue)
-					req.URL.RawQuery = q.Encode()
-				}
-				req.URL.Path = backendPath
-
 				LogInfo("Path parameters extracted", map[string]interface{}{
-					"path_params":  pathParams,
+					"path_params":  p.pathParams(r),
 					"path":         r.URL.Path,
-					"backend_path": backendPath,
+					"backend_path": req.URL.Path,
 				})
 			}
 
@@ -115,12 +428,23 @@ func (p *Proxy) Handler() http.HandlerFunc {
 				req.Header.Set(key, value)
 			}
 
-			// Add custom query parameters
-			q := req.URL.Query()
-			for key, value := range p.endpoint.QueryParams {
-				q.Set(key, value)
+			// Only offer the backend the protocol upgrades the endpoint allows
+			filterUpgrade(p.endpoint, req)
+
+			// Forward the request trailers, which the server only fills into the map of the incoming request once
+			// its body is read, so the outgoing request must share the map and be sent chunked
+			if len(r.Trailer) > 0 {
+				req.Trailer = r.Trailer
+				req.ContentLength = -1
 			}
-			req.URL.RawQuery = q.Encode()
+
+			// The response is masked, filtered or normalized, so ask for it uncompressed to save decoding it
+			if fields != nil || p.endpoint.Pagination.Style != "" || len(p.endpoint.Masking) > 0 {
+				req.Header.Del("Accept-Encoding")
+			}
+
+			// Propagate the trace context to the backend
+			InjectTraceContext(req)
 
 			// Execute pre-backend callbacks
 			for _, callback := range p.preBackendCallbacks {
@@ -135,15 +459,64 @@ func (p *Proxy) Handler() http.HandlerFunc {
 			}
 		}
 
-		// Set timeout for the request
-		if p.endpoint.Timeout > 0 {
-			proxy.Transport = &http.Transport{
-				ResponseHeaderTimeout: time.Duration(p.endpoint.Timeout) * time.Millisecond,
-			}
+		// Use the shared upstream transport so connections are reused across requests
+		proxy.Transport = p.roundTripper(p.transport)
+
+		// Reuse the buffers of response body copies across requests
+		proxy.BufferPool = proxyBuffers
+
+		// Honor the timeout requested by trusted callers, which replaces the endpoint timeouts
+		timeout, overridden := p.endpoint.TimeoutOverride.requested(r)
+		if overridden {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+			proxy.Transport = p.roundTripper(p.overrideTransport)
+			LogInfo("Timeout override honored", map[string]interface{}{
+				"path":    r.URL.Path,
+				"caller":  callerIdentity(r, p.endpoint.TimeoutOverride.CallerHeader),
+				"timeout": timeout.Milliseconds(),
+			})
+		} else {
+			r.Header.Del(TimeoutOverrideHeader)
+		}
+
+		// Limit the total time spent on all attempts
+		if p.endpoint.Retry.Deadline > 0 && !overridden {
+			ctx, cancel := context.WithTimeout(r.Context(), time.Duration(p.endpoint.Retry.Deadline)*time.Millisecond)
+			defer cancel()
+			r = r.WithContext(ctx)
 		}
 
 		// Set up the ModifyResponse function to execute post-backend callbacks
 		proxy.ModifyResponse = func(resp *http.Response) error {
+			// Translate XML responses back into JSON before the callbacks see them
+			if p.endpoint.XMLTranslation.Enabled {
+				if err := translateResponseToJSON(resp, p.endpoint.XMLTranslation); err != nil {
+					return err
+				}
+			}
+
+			// Mask the sensitive fields before the other transformations and the callbacks see them
+			if len(p.endpoint.Masking) > 0 {
+				masked, err := maskResponse(resp, p.endpoint.Masking)
+				if err != nil {
+					return err
+				}
+				if p.telemetry != nil {
+					for action, count := range masked {
+						p.telemetry.RecordMaskedFields(r.Context(), metricsRoute(p.endpoint), action, count)
+					}
+				}
+			}
+
+			// Normalize the pagination of list responses into the gateway envelope
+			if p.endpoint.Pagination.Style != "" {
+				if err := normalizePagination(resp, r, p.endpoint.Pagination); err != nil {
+					return err
+				}
+			}
+
 			// Execute post-backend callbacks
 			for _, callback := range p.postBackendCallbacks {
 				resp = callback(resp, r)
@@ -156,38 +529,130 @@ func (p *Proxy) Handler() http.HandlerFunc {
 					"status_code": resp.StatusCode,
 				})
 			}
+
+			// Filter the response fields after the callbacks so they see the whole response
+			if fields != nil {
+				if err := filterResponseFields(resp, fields); err != nil {
+					return err
+				}
+			}
+
+			// Remap the backend status last so a cached fallback is not transformed again
+			if mapping, ok := p.endpoint.StatusMappings[resp.StatusCode]; ok {
+				p.remapStatus(resp, r, mapping)
+			}
 			return nil
 		}
 
 		// Handle errors
 		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-			LogError("Proxy error", err, map[string]interface{}{
-				"path":    r.URL.Path,
-				"method":  r.Method,
-				"backend": p.endpoint.Backend,
+			// Requests above the backend concurrency limit are shed without reaching the backend
+			if errors.Is(err, errConcurrencyLimited) {
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+				return
+			}
+			// Requests rejected while their body is streamed get the status of the body policy
+			var maxBytesErr *http.MaxBytesError
+			var multipartErr *MultipartError
+			if errors.As(err, &maxBytesErr) || errors.As(err, &multipartErr) {
+				LogError("Proxy error", err, map[string]interface{}{
+					"path":    r.URL.Path,
+					"method":  r.Method,
+					"backend": backend,
+				})
+				status := requestBodyErrorStatus(err)
+				http.Error(w, http.StatusText(status), status)
+				return
+			}
+			p.writeProxyError(w, r, backend, err)
+		}
+
+		// Record the backend instance and attempts for logging and metrics
+		ctx, attempts := WithUpstreamAttempts(r.Context())
+		r = r.WithContext(ctx)
+
+		// Limit the request body, and buffer it if configured
+		if err := applyRequestBodyPolicy(w, r, p.endpoint.RequestBody); err != nil {
+			status := requestBodyErrorStatus(err)
+			LogError("Failed to read request body", err, map[string]interface{}{
+				"path":   r.URL.Path,
+				"method": r.Method,
 			})
-			http.Error(w, "Proxy error", http.StatusBadGateway)
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+
+		// Translate JSON requests into XML for the backend
+		if p.endpoint.XMLTranslation.Enabled {
+			if err := translateRequestToXML(r, p.endpoint.XMLTranslation); err != nil {
+				status := requestBodyErrorStatus(err)
+				LogError("Failed to translate request body", err, map[string]interface{}{
+					"path":   r.URL.Path,
+					"method": r.Method,
+				})
+				http.Error(w, http.StatusText(status), status)
+				return
+			}
+		}
+
+		// Count the request body bytes sent to the backend, reporting the upload progress
+		requestBody := &countingReadCloser{ReadCloser: http.NoBody}
+		if r.Body != nil && r.Body != http.NoBody {
+			requestBody.ReadCloser = r.Body
+			r.Body = requestBody
+			if p.telemetry != nil {
+				ctx := r.Context()
+				requestBody.progress = func(n int64) {
+					p.telemetry.RecordUploadProgress(ctx, metricsRoute(p.endpoint), n)
+				}
+				p.telemetry.RecordActiveUpload(ctx, metricsRoute(p.endpoint), 1)
+				defer p.telemetry.RecordActiveUpload(ctx, metricsRoute(p.endpoint), -1)
+			}
 		}
 
-		// Create a logging response writer to capture the status code
+		// Create a logging response writer to capture the status code, and the body in debug mode only
+		// so large downloads are streamed without buffering
 		lrw := NewLoggingResponseWriter(w)
+		if !p.debug {
+			lrw.bodyLimit = 0
+		}
 
 		// Serve the request
 		proxy.ServeHTTP(lrw, r)
 
+		// The client may go away while the response is transferred
+		if attempts.FailureClass == "" && errors.Is(r.Context().Err(), context.Canceled) {
+			p.clientCanceled(r, backend, CancelPhaseResponse)
+		}
+
 		// Log the response
 		duration := time.Since(startTime)
 		LogResponse(lrw, r, duration.String(), p.debug)
+		p.logSlowRequest(lrw, r, duration, attempts)
 
 		// Record metrics if telemetry is enabled
 		if p.telemetry != nil {
 			p.telemetry.RecordRequest(
 				r.Context(),
-				p.endpoint.Path,
+				metricsRoute(p.endpoint),
 				r.Method,
 				lrw.statusCode,
 				float64(duration.Milliseconds()),
 			)
+			p.telemetry.RecordTransfer(
+				r.Context(),
+				metricsRoute(p.endpoint),
+				r.Method,
+				lrw.statusCode,
+				requestBody.bytesRead,
+				lrw.bytesWritten,
+				float64(lrw.TransferDuration().Milliseconds()),
+			)
+			if attempts.Count > 0 {
+				p.telemetry.RecordUpstreamAttempts(r.Context(), metricsRoute(p.endpoint), attempts.Backend, attempts.Count)
+				p.telemetry.RecordUpstreamTiming(r.Context(), attempts.Backend, attempts.Timing)
+			}
 		}
 	}
 }
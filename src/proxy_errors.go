@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+// Failure classes of the upstream requests that got no response
+const (
+	FailureTimeout           = "timeout"
+	FailureConnectionRefused = "connection_refused"
+	FailureDNS               = "dns_error"
+	FailureTLS               = "tls_error"
+	FailureClientCanceled    = "client_canceled"
+	FailureUpstream          = "upstream_error"
+)
+
+// Phases of a request in which the client cancels it
+const (
+	CancelPhaseUpstream = "upstream"
+	CancelPhaseResponse = "response"
+)
+
+// StatusClientClosedRequest is the status logged for requests canceled by the client before the backend
+// answered; it is never seen by the client
+const StatusClientClosedRequest = 499
+
+// defaultFailureStatuses are the statuses answered for each failure class
+var defaultFailureStatuses = map[string]int{
+	FailureTimeout:           http.StatusGatewayTimeout,
+	FailureConnectionRefused: http.StatusBadGateway,
+	FailureDNS:               http.StatusBadGateway,
+	FailureTLS:               http.StatusBadGateway,
+	FailureClientCanceled:    StatusClientClosedRequest,
+	FailureUpstream:          http.StatusBadGateway,
+}
+
+// classifyProxyError returns the failure class of an upstream request error of a request
+func classifyProxyError(r *http.Request, err error) string {
+	// The client going away cancels the upstream request
+	if errors.Is(err, context.Canceled) && r.Context().Err() != nil {
+		return FailureClientCanceled
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return FailureTimeout
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return FailureConnectionRefused
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return FailureDNS
+	}
+	var recordErr tls.RecordHeaderError
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &recordErr) || errors.As(err, &certErr) || errors.As(err, &unknownAuthorityErr) || errors.As(err, &hostnameErr) {
+		return FailureTLS
+	}
+	return FailureUpstream
+}
+
+// failureStatus returns the status answered for a failure class, the endpoint may override the defaults
+func (e Endpoint) failureStatus(class string) int {
+	if status, ok := e.ErrorStatuses[class]; ok && status >= 400 && status <= 599 {
+		return status
+	}
+	return defaultFailureStatuses[class]
+}
+
+// writeProxyError classifies an upstream request error, logs it and answers with the status of its class.
+// Requests canceled by the client are logged without an error since the backend did not fail.
+func (p *Proxy) writeProxyError(w http.ResponseWriter, r *http.Request, backend string, err error) {
+	class := classifyProxyError(r, err)
+	if attempts := UpstreamAttemptsFromContext(r.Context()); attempts != nil {
+		attempts.FailureClass = class
+	}
+
+	status := p.endpoint.failureStatus(class)
+	if class == FailureClientCanceled {
+		p.clientCanceled(r, backend, CancelPhaseUpstream)
+		w.WriteHeader(status)
+		return
+	}
+	LogError("Proxy error", err, map[string]interface{}{
+		"path":          r.URL.Path,
+		"method":        r.Method,
+		"backend":       backend,
+		"failure_class": class,
+	})
+	http.Error(w, http.StatusText(status), status)
+}
+
+// clientCanceled logs and counts a request abandoned by the client in the given phase. The upstream request
+// shares the context of the client request, so it is canceled with it.
+func (p *Proxy) clientCanceled(r *http.Request, backend, phase string) {
+	if attempts := UpstreamAttemptsFromContext(r.Context()); attempts != nil {
+		attempts.FailureClass = FailureClientCanceled
+	}
+	LogInfo("Client canceled request", map[string]interface{}{
+		"path":    r.URL.Path,
+		"method":  r.Method,
+		"backend": backend,
+		"phase":   phase,
+	})
+	if p.telemetry != nil {
+		p.telemetry.RecordClientCanceled(r.Context(), metricsRoute(p.endpoint), r.Method, phase)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestClassifyProxyError tests the failure classes of the upstream request errors
+func TestClassifyProxyError(t *testing.T) {
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		err      error
+		expected string
+	}{
+		{"deadline", context.Background(), context.DeadlineExceeded, FailureTimeout},
+		{"network timeout", context.Background(), &net.OpError{Op: "dial", Err: os.ErrDeadlineExceeded}, FailureTimeout},
+		{"connection refused", context.Background(), &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, FailureConnectionRefused},
+		{"dns", context.Background(), &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "users"}}, FailureDNS},
+		{"client canceled", canceledCtx, context.Canceled, FailureClientCanceled},
+		{"canceled upstream", context.Background(), context.Canceled, FailureUpstream},
+		{"other", context.Background(), errors.New("unexpected EOF"), FailureUpstream},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api", nil).WithContext(tt.ctx)
+			if class := classifyProxyError(r, tt.err); class != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, class)
+			}
+		})
+	}
+}
+
+// TestProxyErrorStatus tests the status answered when the backend refuses the connection and its override
+func TestProxyErrorStatus(t *testing.T) {
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	backendURL := backendServer.URL
+	backendServer.Close()
+
+	rr := httptest.NewRecorder()
+	NewProxy(Endpoint{Path: "/api", Backend: backendURL}, false, nil).Handler()(rr, httptest.NewRequest("GET", "/api", nil))
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("expected status 502, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	endpoint := Endpoint{Path: "/api", Backend: backendURL, ErrorStatuses: map[string]int{FailureConnectionRefused: http.StatusServiceUnavailable}}
+	NewProxy(endpoint, false, nil).Handler()(rr, httptest.NewRequest("GET", "/api", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected the overridden status 503, got %d", rr.Code)
+	}
+}
+
+// TestClientCanceledRequest tests that a client going away cancels the upstream request promptly and is not
+// answered as a proxy error
+func TestClientCanceledRequest(t *testing.T) {
+	upstreamCanceled := make(chan struct{})
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(upstreamCanceled)
+	}))
+	defer backendServer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	rr := httptest.NewRecorder()
+	start := time.Now()
+	NewProxy(Endpoint{Path: "/api", Backend: backendServer.URL}, false, nil).Handler()(rr, httptest.NewRequest("GET", "/api", nil).WithContext(ctx))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the request to end with the client, took %v", elapsed)
+	}
+	select {
+	case <-upstreamCanceled:
+	case <-time.After(time.Second):
+		t.Fatal("expected the upstream request to be canceled")
+	}
+	if rr.Code != StatusClientClosedRequest {
+		t.Errorf("expected status 499, got %d", rr.Code)
+	}
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 // TestProxyHandlerDirectly tests the Handler method of the Proxy class directly
@@ -350,3 +353,169 @@ func TestProxyHandlerWithPostBackendCallback(t *testing.T) {
 		t.Errorf("handler returned unexpected body: got %v want %v", rr.Body.String(), expectedBody)
 	}
 }
+
+// TestProxyHandlerWithEgressProxy tests that upstream requests are sent through the configured egress proxy
+func TestProxyHandlerWithEgressProxy(t *testing.T) {
+	// Create a mock egress proxy that answers on behalf of the backend
+	var proxiedURL string
+	egressProxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxiedURL = r.URL.String()
+		_, _ = fmt.Fprint(w, "Hello from egress proxy")
+	}))
+	defer egressProxy.Close()
+
+	endpoint := Endpoint{
+		Path:     "/test",
+		Method:   "GET",
+		Backend:  "http://backend.internal/users",
+		ProxyURL: egressProxy.URL,
+	}
+
+	proxy := NewProxy(endpoint, false, nil)
+
+	rr := httptest.NewRecorder()
+	proxy.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/test", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if !strings.HasPrefix(proxiedURL, "http://backend.internal/users") {
+		t.Errorf("Egress proxy received URL %q, want absolute backend URL", proxiedURL)
+	}
+
+	// An invalid proxy URL is reported when the endpoint is called
+	endpoint.ProxyURL = "ftp://proxy.internal"
+	rr = httptest.NewRecorder()
+	NewProxy(endpoint, false, nil).Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/test", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusInternalServerError)
+	}
+}
+
+// TestProxyRangeRequests tests that range requests and partial content pass through the gateway
+func TestProxyRangeRequests(t *testing.T) {
+	content := strings.Repeat("0123456789", 1000)
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Unix(1000, 0), strings.NewReader(content))
+	}))
+	defer backendServer.Close()
+
+	gateway := NewGateway(Config{
+		Endpoints: []Endpoint{{Path: "/files/file.bin", Backend: backendServer.URL, Cache: EndpointCacheConfig{Enabled: true, TTL: 60000}}},
+	}, nil)
+	gateway.RegisterEndpoints()
+	gatewayServer := httptest.NewServer(gateway.mux)
+	defer gatewayServer.Close()
+
+	req, _ := http.NewRequest("GET", gatewayServer.URL+"/files/file.bin", nil)
+	req.Header.Set("Range", "bytes=10-19")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Range request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		t.Fatalf("Expected 206, got %v", resp.StatusCode)
+	}
+	if resp.Header.Get("Content-Range") != "bytes 10-19/10000" || resp.Header.Get("Accept-Ranges") != "bytes" {
+		t.Errorf("Unexpected range headers %q %q", resp.Header.Get("Content-Range"), resp.Header.Get("Accept-Ranges"))
+	}
+	if string(body) != content[10:20] {
+		t.Errorf("Expected partial body %q, got %q", content[10:20], body)
+	}
+	if gateway.cache.Len() != 0 {
+		t.Errorf("Expected range requests to bypass the cache, got %d entries", gateway.cache.Len())
+	}
+}
+
+// TestProxyStreamsResponses tests that response bodies reach the client before the backend completes them
+func TestProxyStreamsResponses(t *testing.T) {
+	release := make(chan struct{})
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("first\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		_, _ = w.Write([]byte("second\n"))
+	}))
+	defer backendServer.Close()
+	defer close(release)
+
+	gateway := NewGateway(Config{
+		Endpoints: []Endpoint{{Path: "/download", Backend: backendServer.URL}},
+	}, nil)
+	gateway.RegisterEndpoints()
+	gatewayServer := httptest.NewServer(gateway.mux)
+	defer gatewayServer.Close()
+
+	resp, err := http.Get(gatewayServer.URL + "/download")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// The first chunk arrives while the backend is still blocked
+	line := make(chan string, 1)
+	go func() {
+		first, _ := bufio.NewReader(resp.Body).ReadString('\n')
+		line <- first
+	}()
+	select {
+	case first := <-line:
+		if first != "first\n" {
+			t.Errorf("Expected the first chunk, got %q", first)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the response to be streamed, but it was buffered")
+	}
+}
+
+// TestProxyForwardsTrailers tests that request and response trailers are forwarded, also through the
+// middlewares buffering responses
+func TestProxyForwardsTrailers(t *testing.T) {
+	requestTrailer := make(chan string, 1)
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		requestTrailer <- r.Trailer.Get("X-Checksum")
+		w.Header().Set("Trailer", "Grpc-Status")
+		_, _ = w.Write([]byte("hello"))
+		w.Header().Set("Grpc-Status", "0")
+	}))
+	defer backendServer.Close()
+
+	gateway := NewGateway(Config{
+		Endpoints: []Endpoint{{
+			Path:         "/stream",
+			Backend:      backendServer.URL,
+			GenerateETag: true,
+			Cache:        EndpointCacheConfig{Enabled: true, TTL: 60000},
+		}},
+	}, nil)
+	gateway.RegisterEndpoints()
+	gatewayServer := httptest.NewServer(gateway.mux)
+	defer gatewayServer.Close()
+
+	req, _ := http.NewRequest("GET", gatewayServer.URL+"/stream", strings.NewReader("payload"))
+	req.ContentLength = -1
+	req.Trailer = http.Header{"X-Checksum": {"abc"}}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if got := <-requestTrailer; got != "abc" {
+		t.Errorf("Expected the request trailer at the backend, got %q", got)
+	}
+	if string(body) != "hello" {
+		t.Errorf("Expected body hello, got %q", body)
+	}
+	if got := resp.Trailer.Get("Grpc-Status"); got != "0" {
+		t.Errorf("Expected the response trailer, got %q (trailers %v)", got, resp.Trailer)
+	}
+	if gateway.cache.Len() != 0 {
+		t.Errorf("Expected responses with trailers to bypass the cache, got %d entries", gateway.cache.Len())
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// QueryPolicyConfig restricts the client query parameters forwarded to the backend, protecting it from
+// cache-busting and parameter pollution. Names ending with * match all parameters with the prefix, e.g. utm_*.
+type QueryPolicyConfig struct {
+	// Allow lists the only client query parameters forwarded to the backend, all others are stripped
+	Allow []string `json:"allow"`
+	// Deny lists client query parameters stripped before forwarding, e.g. tracking parameters
+	Deny []string `json:"deny"`
+}
+
+// enabled reports whether the policy strips any query parameter
+func (c QueryPolicyConfig) enabled() bool {
+	return len(c.Allow) > 0 || len(c.Deny) > 0
+}
+
+// allows reports whether a query parameter is forwarded to the backend
+func (c QueryPolicyConfig) allows(name string) bool {
+	if matchesQueryParam(c.Deny, name) {
+		return false
+	}
+	return len(c.Allow) == 0 || matchesQueryParam(c.Allow, name)
+}
+
+// strip removes the query parameters not forwarded to the backend, except those of the backend URL itself,
+// and returns their names
+func (c QueryPolicyConfig) strip(query url.Values, backendQuery url.Values) []string {
+	var stripped []string
+	for name := range query {
+		if _, ok := backendQuery[name]; ok || c.allows(name) {
+			continue
+		}
+		query.Del(name)
+		stripped = append(stripped, name)
+	}
+	return stripped
+}
+
+// matchesQueryParam reports whether a query parameter name matches one of the names or name prefixes
+func matchesQueryParam(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if pattern == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestQueryPolicy tests that only the query parameters allowed by the policy reach the backend
+func TestQueryPolicy(t *testing.T) {
+	var received string
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.URL.RawQuery
+	}))
+	defer backendServer.Close()
+
+	tests := []struct {
+		name     string
+		policy   QueryPolicyConfig
+		expected string
+	}{
+		{"no policy", QueryPolicyConfig{}, "api_key=k&page=2&q=go&utm_source=mail"},
+		{"allow", QueryPolicyConfig{Allow: []string{"q", "page"}}, "api_key=k&page=2&q=go"},
+		{"deny prefix", QueryPolicyConfig{Deny: []string{"utm_*"}}, "api_key=k&page=2&q=go"},
+		{"allow and deny", QueryPolicyConfig{Allow: []string{"*"}, Deny: []string{"q", "utm_*"}}, "api_key=k&page=2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoint := Endpoint{
+				Path:        "/search",
+				Backend:     backendServer.URL + "?api_key=k",
+				QueryParams: map[string]string{"page": "2"},
+				QueryPolicy: tt.policy,
+			}
+			NewProxy(endpoint, false, nil).Handler()(httptest.NewRecorder(), httptest.NewRequest("GET", "/search?q=go&utm_source=mail&page=9", nil))
+			if received != tt.expected {
+				t.Errorf("expected query %q, got %q", tt.expected, received)
+			}
+		})
+	}
+}
+
+// TestQueryPolicyCacheKey tests that stripped query parameters do not bust the response cache
+func TestQueryPolicyCacheKey(t *testing.T) {
+	endpoint := Endpoint{QueryPolicy: QueryPolicyConfig{Deny: []string{"utm_*", "_"}}}
+	key := cacheKey(endpoint, httptest.NewRequest("GET", "/search?q=go", nil))
+	if busted := cacheKey(endpoint, httptest.NewRequest("GET", "/search?q=go&_=1712&utm_source=mail", nil)); busted != key {
+		t.Errorf("expected the cache key %q, got %q", key, busted)
+	}
+	if other := cacheKey(endpoint, httptest.NewRequest("GET", "/search?q=rust", nil)); other == key {
+		t.Error("expected allowed query parameters to vary the cache key")
+	}
+}
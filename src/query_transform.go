@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// QueryTransformConfig represents the changes made to the query parameters of a request before it is sent
+// to the backend
+type QueryTransformConfig struct {
+	// Rename maps client query parameter names to the names sent to the backend, e.g. {"q": "query"}
+	Rename map[string]string `json:"rename"`
+	// Defaults are query parameters added when the client did not send them. Values may contain :name path
+	// parameters, e.g. {"owner": ":user"}.
+	Defaults map[string]string `json:"defaults"`
+}
+
+// apply renames the query parameters and adds the missing defaults
+func (c QueryTransformConfig) apply(query url.Values, params map[string]string) {
+	// Rename all parameters at once so renames do not chain
+	renamed := url.Values{}
+	for from, to := range c.Rename {
+		if values, ok := query[from]; ok && to != "" {
+			renamed[to] = values
+			query.Del(from)
+		}
+	}
+	for name, values := range renamed {
+		query[name] = values
+	}
+
+	for name, value := range c.Defaults {
+		if _, ok := query[name]; !ok {
+			query.Set(name, expandPathParams(value, params))
+		}
+	}
+}
+
+// expandPathParams replaces the :name path parameters in a value, the longest names first so :id does
+// not replace the start of :idx
+func expandPathParams(value string, params map[string]string) string {
+	if len(params) == 0 || !strings.Contains(value, ":") {
+		return value
+	}
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+	for _, name := range names {
+		value = strings.ReplaceAll(value, ":"+name, params[name])
+	}
+	return value
+}
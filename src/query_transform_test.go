@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestQueryTransform tests the renaming of query parameters, the defaults and the path parameters in values
+func TestQueryTransform(t *testing.T) {
+	var received string
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.URL.RawQuery
+	}))
+	defer backendServer.Close()
+
+	endpoint := Endpoint{
+		Path:        "/users/:user/repos",
+		Backend:     backendServer.URL,
+		PathMode:    PathModeReplace,
+		QueryParams: map[string]string{"tenant": "t-:user"},
+		QueryPolicy: QueryPolicyConfig{Deny: []string{"debug"}},
+		QueryTransform: QueryTransformConfig{
+			Rename:   map[string]string{"q": "query", "query": "legacy", "debug": "verbose"},
+			Defaults: map[string]string{"page_size": "20", "owner": ":user"},
+		},
+	}
+	handler := NewProxy(endpoint, false, nil).Handler()
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"", "owner=alice&page_size=20&tenant=t-alice"},
+		{"q=go&query=old&debug=1", "legacy=old&owner=alice&page_size=20&query=go&tenant=t-alice"},
+		{"page_size=50&owner=bob", "owner=bob&page_size=50&tenant=t-alice"},
+	}
+	for _, tt := range tests {
+		handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/alice/repos?"+tt.query, nil))
+		if received != tt.expected {
+			t.Errorf("for %q expected query %q, got %q", tt.query, tt.expected, received)
+		}
+	}
+}
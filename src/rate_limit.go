@@ -0,0 +1,457 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitStatus is the state of a rate limit after a request, reported to clients in the RateLimit headers
+// so they can throttle themselves before they are rejected
+type RateLimitStatus struct {
+	// Limit is the number of requests of the quota
+	Limit int
+	// Remaining is the number of requests left in the quota
+	Remaining int
+	// Reset is the time until the quota is fully available again
+	Reset time.Duration
+}
+
+// tighter reports whether the status leaves fewer requests than another one, which is reported instead
+func (s RateLimitStatus) tighter(other RateLimitStatus) bool {
+	return other.Limit == 0 || s.Remaining < other.Remaining || (s.Remaining == other.Remaining && s.Reset > other.Reset)
+}
+
+// setRateLimitHeaders sets the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers of the IETF
+// RateLimit header fields draft, the reset in whole seconds
+func setRateLimitHeaders(header http.Header, status RateLimitStatus) {
+	header.Set("RateLimit-Limit", strconv.Itoa(status.Limit))
+	header.Set("RateLimit-Remaining", strconv.Itoa(max(status.Remaining, 0)))
+	header.Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(status.Reset.Seconds()))))
+}
+
+// RateLimitBudget represents a token bucket of requests per second
+type RateLimitBudget struct {
+	// RequestsPerSecond is the sustained rate of requests (0 is unlimited)
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	// Burst is the number of requests allowed at once above the rate (default the rate per second, at least 1)
+	Burst int `json:"burst"`
+}
+
+// limited checks whether the budget limits requests
+func (b RateLimitBudget) limited() bool {
+	return b.RequestsPerSecond > 0
+}
+
+// Rate limit algorithms
+const (
+	RateLimitTokenBucket = "token_bucket"
+	RateLimitSpikeArrest = "spike_arrest"
+)
+
+// RateLimitConfig represents the rate limits of an endpoint over all its clients, with separate budgets for
+// reads and writes since writes are usually much more expensive for the backend
+type RateLimitConfig struct {
+	// Algorithm is token_bucket (default), allowing bursts up to the burst size, or spike_arrest, spacing the
+	// allowed requests evenly at the rate so the backend never sees a burst
+	Algorithm string `json:"algorithm"`
+	// Read is the budget of the GET, HEAD and OPTIONS requests
+	Read RateLimitBudget `json:"read"`
+	// Write is the budget of the requests with other methods
+	Write RateLimitBudget `json:"write"`
+	// Methods maps methods to their own budget, replacing the read or write budget
+	Methods map[string]RateLimitBudget `json:"methods"`
+	// Queue lets the requests over the limit wait briefly for the budget instead of rejecting them
+	Queue RateLimitQueueConfig `json:"queue"`
+}
+
+// RateLimitQueueConfig represents the queuing of the requests over a rate limit, let through by priority
+type RateLimitQueueConfig struct {
+	// MaxWait is the time in milliseconds a request waits for the budget before it is rejected (0 disables
+	// queuing)
+	MaxWait int `json:"max_wait"`
+	// MaxQueued is the number of requests waiting at once per budget (default 100); when the queue is full, a
+	// request takes the place of the newest waiting request of a lower priority, if any, else it is rejected
+	MaxQueued int `json:"max_queued"`
+}
+
+// enabled checks whether any budget limits requests
+func (c RateLimitConfig) enabled() bool {
+	if c.Read.limited() || c.Write.limited() {
+		return true
+	}
+	for _, budget := range c.Methods {
+		if budget.limited() {
+			return true
+		}
+	}
+	return false
+}
+
+// budget returns the name and the budget of the requests of a method
+func (c RateLimitConfig) budget(method string) (string, RateLimitBudget) {
+	if budget, ok := c.Methods[method]; ok {
+		return method, budget
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return "read", c.Read
+	default:
+		return "write", c.Write
+	}
+}
+
+// validateRateLimit checks the budgets of the rate limits of an endpoint
+func validateRateLimit(config RateLimitConfig) error {
+	if config.Algorithm != "" && config.Algorithm != RateLimitTokenBucket && config.Algorithm != RateLimitSpikeArrest {
+		return fmt.Errorf("invalid rate limit algorithm %q (must be token_bucket or spike_arrest)", config.Algorithm)
+	}
+	budgets := map[string]RateLimitBudget{"read": config.Read, "write": config.Write}
+	for method, budget := range config.Methods {
+		if method == "" || strings.ToUpper(method) != method {
+			return fmt.Errorf("invalid rate limit method %q: must be upper case", method)
+		}
+		budgets[method] = budget
+	}
+	if config.Queue.MaxWait < 0 || config.Queue.MaxQueued < 0 {
+		return errors.New("invalid rate limit queue: max_wait and max_queued must not be negative")
+	}
+	for name, budget := range budgets {
+		if budget.RequestsPerSecond < 0 || budget.Burst < 0 {
+			return fmt.Errorf("invalid %s rate limit: requests_per_second and burst must not be negative", name)
+		}
+	}
+	return nil
+}
+
+// rateBucket tracks the requests taken from a rate limit budget
+type rateBucket interface {
+	// take takes a request if allowed, returning the time until the next request is allowed otherwise, and
+	// the status of the budget
+	take(now time.Time) (bool, time.Duration, RateLimitStatus)
+	// status returns the time until the next request is allowed and the status of the budget, without taking
+	// a request
+	status(now time.Time) (time.Duration, RateLimitStatus)
+}
+
+// tokenBucket is the token bucket of a rate limit budget
+type tokenBucket struct {
+	rate    float64
+	burst   float64
+	tokens  float64
+	updated time.Time
+}
+
+// newTokenBucket creates a full token bucket for a budget
+func newTokenBucket(budget RateLimitBudget, now time.Time) *tokenBucket {
+	burst := float64(budget.Burst)
+	if burst <= 0 {
+		burst = math.Max(1, math.Ceil(budget.RequestsPerSecond))
+	}
+	return &tokenBucket{rate: budget.RequestsPerSecond, burst: burst, tokens: burst, updated: now}
+}
+
+// take takes a token if available, returning the time until the next token otherwise, and the status of the
+// bucket
+func (b *tokenBucket) take(now time.Time) (bool, time.Duration, RateLimitStatus) {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.updated).Seconds()*b.rate)
+	b.updated = now
+	if b.tokens < 1 {
+		retryAfter, status := b.status(now)
+		return false, retryAfter, status
+	}
+	b.tokens--
+	_, status := b.status(now)
+	return true, 0, status
+}
+
+// status returns the time until the next token and the status of the bucket refilled until now
+func (b *tokenBucket) status(now time.Time) (time.Duration, RateLimitStatus) {
+	tokens := math.Min(b.burst, b.tokens+now.Sub(b.updated).Seconds()*b.rate)
+	var retryAfter time.Duration
+	if tokens < 1 {
+		retryAfter = time.Duration((1 - tokens) / b.rate * float64(time.Second))
+	}
+	return retryAfter, RateLimitStatus{
+		Limit:     int(b.burst),
+		Remaining: int(tokens),
+		Reset:     time.Duration((b.burst - tokens) / b.rate * float64(time.Second)),
+	}
+}
+
+// spikeArrest spaces the requests of a rate limit budget evenly at its rate: a request is only allowed once
+// the interval since the previous one has passed, whatever the number of requests over a longer window
+type spikeArrest struct {
+	interval time.Duration
+	next     time.Time
+}
+
+// newSpikeArrest creates a spike arrest for a budget, allowing a request right away
+func newSpikeArrest(budget RateLimitBudget) *spikeArrest {
+	return &spikeArrest{interval: time.Duration(float64(time.Second) / budget.RequestsPerSecond)}
+}
+
+// take allows a request if the interval since the previous allowed request has passed
+func (s *spikeArrest) take(now time.Time) (bool, time.Duration, RateLimitStatus) {
+	if now.Before(s.next) {
+		wait := s.next.Sub(now)
+		return false, wait, RateLimitStatus{Limit: 1, Remaining: 0, Reset: wait}
+	}
+	s.next = now.Add(s.interval)
+	return true, 0, RateLimitStatus{Limit: 1, Remaining: 0, Reset: s.interval}
+}
+
+// status returns the time until the interval since the previous allowed request has passed
+func (s *spikeArrest) status(now time.Time) (time.Duration, RateLimitStatus) {
+	if now.Before(s.next) {
+		wait := s.next.Sub(now)
+		return wait, RateLimitStatus{Limit: 1, Remaining: 0, Reset: wait}
+	}
+	return 0, RateLimitStatus{Limit: 1, Remaining: 1}
+}
+
+// defaultMaxQueuedRequests is the default number of requests waiting at once for a rate limit budget
+const defaultMaxQueuedRequests = 100
+
+// priorityRanks orders the request priorities for the rate limit queue
+var priorityRanks = map[string]int{
+	PriorityLow:      0,
+	PriorityNormal:   1,
+	PriorityHigh:     2,
+	PriorityCritical: 3,
+}
+
+// queuedRequest is a request waiting for its rate limit budget
+type queuedRequest struct {
+	rank int
+	seq  uint64
+	// admitted receives the status of the budget once the request is let through
+	admitted chan RateLimitStatus
+	// rejected is closed when a request of a higher priority takes the place of the request in the full queue
+	rejected chan struct{}
+}
+
+// rateQueue holds the requests waiting for a rate limit budget, let through by priority, then in arrival order
+type rateQueue struct {
+	waiting []*queuedRequest
+	// timer lets the next request through once the budget allows it, nil if none is scheduled
+	timer *time.Timer
+}
+
+// remove removes a request from the queue and reports whether it was still waiting
+func (q *rateQueue) remove(request *queuedRequest) bool {
+	for i, waiting := range q.waiting {
+		if waiting == request {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// first returns the request let through next: the oldest of the highest priority
+func (q *rateQueue) first() *queuedRequest {
+	var first *queuedRequest
+	for _, waiting := range q.waiting {
+		if first == nil || waiting.rank > first.rank || (waiting.rank == first.rank && waiting.seq < first.seq) {
+			first = waiting
+		}
+	}
+	return first
+}
+
+// last returns the request rejected first when the queue is full: the newest of the lowest priority
+func (q *rateQueue) last() *queuedRequest {
+	var last *queuedRequest
+	for _, waiting := range q.waiting {
+		if last == nil || waiting.rank < last.rank || (waiting.rank == last.rank && waiting.seq > last.seq) {
+			last = waiting
+		}
+	}
+	return last
+}
+
+// RateLimiter enforces the rate limits of an endpoint
+type RateLimiter struct {
+	config    RateLimitConfig
+	telemetry *TelemetryManager
+	// priority returns the priority of a request, nil if all requests have the normal priority
+	priority func(Endpoint, *http.Request) string
+	now      func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]rateBucket
+	queues  map[string]*rateQueue
+	seq     uint64
+}
+
+// NewRateLimiter creates a new RateLimiter, queuing the requests by the priority returned by the given
+// function, if any
+func NewRateLimiter(config RateLimitConfig, priority func(Endpoint, *http.Request) string, telemetry *TelemetryManager) *RateLimiter {
+	if config.Queue.MaxQueued <= 0 {
+		config.Queue.MaxQueued = defaultMaxQueuedRequests
+	}
+	return &RateLimiter{
+		config:    config,
+		telemetry: telemetry,
+		priority:  priority,
+		now:       time.Now,
+		buckets:   make(map[string]rateBucket),
+		queues:    make(map[string]*rateQueue),
+	}
+}
+
+// allow takes a request of a method from its budget, returning the budget name, whether the request is
+// allowed, the time until the next request is otherwise, and the status of the budget, if limited. Requests
+// are not allowed while others wait for the budget, so they cannot overtake them.
+func (l *RateLimiter) allow(method string) (string, bool, time.Duration, RateLimitStatus) {
+	name, budget := l.config.budget(method)
+	if !budget.limited() {
+		return name, true, 0, RateLimitStatus{}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	bucket, ok := l.buckets[name]
+	if !ok {
+		if l.config.Algorithm == RateLimitSpikeArrest {
+			bucket = newSpikeArrest(budget)
+		} else {
+			bucket = newTokenBucket(budget, now)
+		}
+		l.buckets[name] = bucket
+	}
+	if queue, ok := l.queues[name]; ok && len(queue.waiting) > 0 {
+		retryAfter, status := bucket.status(now)
+		return name, false, retryAfter, status
+	}
+	allowed, retryAfter, status := bucket.take(now)
+	return name, allowed, retryAfter, status
+}
+
+// wait queues a request of the given priority rank for a budget until the budget lets it through, the
+// maximum wait passes or the request is canceled, and returns whether it was let through, the time until the
+// next request is allowed otherwise, and the status of the budget
+func (l *RateLimiter) wait(ctx context.Context, name string, rank int) (bool, time.Duration, RateLimitStatus) {
+	l.mu.Lock()
+	queue, ok := l.queues[name]
+	if !ok {
+		queue = &rateQueue{}
+		l.queues[name] = queue
+	}
+	if len(queue.waiting) >= l.config.Queue.MaxQueued {
+		// Only a request of a higher priority takes the place of a waiting one
+		last := queue.last()
+		if last.rank >= rank {
+			retryAfter, status := l.buckets[name].status(l.now())
+			l.mu.Unlock()
+			return false, retryAfter, status
+		}
+		queue.remove(last)
+		close(last.rejected)
+	}
+	l.seq++
+	request := &queuedRequest{
+		rank:     rank,
+		seq:      l.seq,
+		admitted: make(chan RateLimitStatus, 1),
+		rejected: make(chan struct{}),
+	}
+	queue.waiting = append(queue.waiting, request)
+	if queue.timer == nil {
+		l.dispatch(name, queue)
+	}
+	l.mu.Unlock()
+
+	timer := time.NewTimer(time.Duration(l.config.Queue.MaxWait) * time.Millisecond)
+	defer timer.Stop()
+	select {
+	case status := <-request.admitted:
+		return true, 0, status
+	case <-request.rejected:
+		return l.rejected(name)
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	waiting := queue.remove(request)
+	l.mu.Unlock()
+	if !waiting {
+		// Let through while giving up, the budget is already taken
+		select {
+		case status := <-request.admitted:
+			return true, 0, status
+		case <-request.rejected:
+		}
+	}
+	return l.rejected(name)
+}
+
+// rejected returns the result of wait for a request of a budget that is not let through
+func (l *RateLimiter) rejected(name string) (bool, time.Duration, RateLimitStatus) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	retryAfter, status := l.buckets[name].status(l.now())
+	return false, retryAfter, status
+}
+
+// dispatch lets the queued requests of a budget through while the budget allows, then schedules the next
+// dispatch for when it allows the next request. The caller must hold the lock.
+func (l *RateLimiter) dispatch(name string, queue *rateQueue) {
+	queue.timer = nil
+	for len(queue.waiting) > 0 {
+		allowed, retryAfter, status := l.buckets[name].take(l.now())
+		if !allowed {
+			queue.timer = time.AfterFunc(max(retryAfter, time.Millisecond), func() {
+				l.mu.Lock()
+				defer l.mu.Unlock()
+				l.dispatch(name, queue)
+			})
+			return
+		}
+		first := queue.first()
+		queue.remove(first)
+		first.admitted <- status
+	}
+}
+
+// rank returns the priority rank of a request in the queue
+func (l *RateLimiter) rank(endpoint Endpoint, r *http.Request) int {
+	if l.priority != nil {
+		if rank, ok := priorityRanks[l.priority(endpoint, r)]; ok {
+			return rank
+		}
+	}
+	return priorityRanks[PriorityNormal]
+}
+
+// Middleware answers the requests exceeding the budget of their method with 429, unless they are let through
+// after waiting in the queue, and reports the state of the budget in the RateLimit headers of all responses
+func (l *RateLimiter) Middleware(endpoint Endpoint, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		budget, allowed, retryAfter, status := l.allow(r.Method)
+		if !allowed && l.config.Queue.MaxWait > 0 {
+			allowed, retryAfter, status = l.wait(r.Context(), budget, l.rank(endpoint, r))
+		}
+		if status.Limit > 0 {
+			setRateLimitHeaders(w.Header(), status)
+		}
+		if !allowed {
+			if l.telemetry != nil {
+				l.telemetry.RecordRateLimited(r.Context(), metricsRoute(endpoint), budget)
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(max(int(math.Ceil(retryAfter.Seconds())), 1)))
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
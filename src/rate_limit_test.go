@@ -0,0 +1,195 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestRateLimitBudgets tests that reads, writes and methods with their own budget are limited separately
+func TestRateLimitBudgets(t *testing.T) {
+	limiter := NewRateLimiter(RateLimitConfig{
+		Read:    RateLimitBudget{RequestsPerSecond: 3},
+		Write:   RateLimitBudget{RequestsPerSecond: 1},
+		Methods: map[string]RateLimitBudget{"DELETE": {RequestsPerSecond: 0.5, Burst: 2}},
+	}, nil, nil)
+	now := time.Unix(1700000000, 0)
+	limiter.now = func() time.Time { return now }
+	handler := limiter.Middleware(Endpoint{Path: "/api/"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func(method string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(method, "/api/orders", nil))
+		return rr
+	}
+
+	for i := 0; i < 3; i++ {
+		if rr := serve("GET"); rr.Code != http.StatusOK {
+			t.Fatalf("read %d: expected 200, got %d", i+1, rr.Code)
+		}
+	}
+	rr := serve("HEAD")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected the fourth read to be rejected with Retry-After 1, got %d %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+	if rr := serve("POST"); rr.Code != http.StatusOK {
+		t.Errorf("expected the write budget to be separate, got %d", rr.Code)
+	}
+	if rr := serve("PUT"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the second write to be rejected, got %d", rr.Code)
+	}
+	serve("DELETE")
+	rr = serve("DELETE")
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected the DELETE burst to allow two requests, got %d", rr.Code)
+	}
+	if limit, remaining, reset := rr.Header().Get("RateLimit-Limit"), rr.Header().Get("RateLimit-Remaining"),
+		rr.Header().Get("RateLimit-Reset"); limit != "2" || remaining != "0" || reset != "4" {
+		t.Errorf("expected RateLimit headers 2, 0 and 4, got %q, %q and %q", limit, remaining, reset)
+	}
+
+	// The budgets refill at their rate
+	now = now.Add(time.Second)
+	if rr := serve("GET"); rr.Code != http.StatusOK || rr.Header().Get("RateLimit-Remaining") != "2" {
+		t.Errorf("expected the read budget to refill, got %d with %q remaining", rr.Code, rr.Header().Get("RateLimit-Remaining"))
+	}
+}
+
+// TestValidateRateLimit tests that invalid budgets are rejected
+func TestValidateRateLimit(t *testing.T) {
+	if err := validateRateLimit(RateLimitConfig{Write: RateLimitBudget{RequestsPerSecond: -1}}); err == nil {
+		t.Error("expected a negative rate to be rejected")
+	}
+	if err := validateRateLimit(RateLimitConfig{Methods: map[string]RateLimitBudget{"post": {RequestsPerSecond: 1}}}); err == nil {
+		t.Error("expected a lower case method to be rejected")
+	}
+	if err := validateRateLimit(RateLimitConfig{Read: RateLimitBudget{RequestsPerSecond: 1000}, Write: RateLimitBudget{RequestsPerSecond: 50}}); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+// TestRateLimitSpikeArrest tests that spike arrest spaces the allowed requests evenly at the rate
+func TestRateLimitSpikeArrest(t *testing.T) {
+	limiter := NewRateLimiter(RateLimitConfig{Algorithm: RateLimitSpikeArrest, Read: RateLimitBudget{RequestsPerSecond: 10, Burst: 10}}, nil, nil)
+	now := time.Unix(1700000000, 0)
+	limiter.now = func() time.Time { return now }
+
+	if _, allowed, _, _ := limiter.allow("GET"); !allowed {
+		t.Fatal("expected the first request to be allowed")
+	}
+	// The burst does not apply, the next request must wait for the 100ms interval
+	now = now.Add(40 * time.Millisecond)
+	_, allowed, retryAfter, status := limiter.allow("GET")
+	if allowed || retryAfter != 60*time.Millisecond || status.Remaining != 0 {
+		t.Errorf("expected the request to wait 60ms, got allowed %v after %v", allowed, retryAfter)
+	}
+	now = now.Add(60 * time.Millisecond)
+	if _, allowed, _, _ := limiter.allow("GET"); !allowed {
+		t.Error("expected the request to be allowed after the interval")
+	}
+
+	// A quiet period does not build up a burst
+	now = now.Add(time.Minute)
+	limiter.allow("GET")
+	if _, allowed, _, _ := limiter.allow("GET"); allowed {
+		t.Error("expected back to back requests to be limited after a quiet period")
+	}
+
+	if err := validateRateLimit(RateLimitConfig{Algorithm: "leaky"}); err == nil {
+		t.Error("expected an unknown algorithm to be rejected")
+	}
+}
+
+// queuedRequests returns the number of requests waiting for a budget of a rate limiter
+func queuedRequests(limiter *RateLimiter, budget string) int {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	if queue, ok := limiter.queues[budget]; ok {
+		return len(queue.waiting)
+	}
+	return 0
+}
+
+// waitForQueued waits until the given number of requests wait for a budget of a rate limiter
+func waitForQueued(t *testing.T, limiter *RateLimiter, budget string, count int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for queuedRequests(limiter, budget) != count {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d queued requests, got %d", count, queuedRequests(limiter, budget))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestRateLimitQueue tests that requests over the limit wait for the budget by priority within the maximum wait
+func TestRateLimitQueue(t *testing.T) {
+	config := RateLimitConfig{
+		Read:  RateLimitBudget{RequestsPerSecond: 4, Burst: 1},
+		Queue: RateLimitQueueConfig{MaxWait: 2000, MaxQueued: 2},
+	}
+	priority := func(endpoint Endpoint, r *http.Request) string {
+		return r.Header.Get("X-Priority")
+	}
+	limiter := NewRateLimiter(config, priority, nil)
+	served := make(chan string, 10)
+	handler := limiter.Middleware(Endpoint{Path: "/api/"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served <- r.Header.Get("X-Priority")
+	}))
+	serve := func(priority string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/orders", nil)
+		req.Header.Set("X-Priority", priority)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	async := func(priority string) <-chan *httptest.ResponseRecorder {
+		done := make(chan *httptest.ResponseRecorder, 1)
+		go func() { done <- serve(priority) }()
+		return done
+	}
+
+	if rr := serve(PriorityNormal); rr.Code != http.StatusOK {
+		t.Fatalf("expected the first request to be served, got %d", rr.Code)
+	}
+	<-served
+
+	// Queued requests are let through by priority
+	low := async(PriorityLow)
+	waitForQueued(t, limiter, "read", 1)
+	normal := async(PriorityNormal)
+	waitForQueued(t, limiter, "read", 2)
+
+	// A high priority request takes the place of the low priority one in the full queue
+	high := async(PriorityHigh)
+	if rr := <-low; rr.Code != http.StatusTooManyRequests || rr.Header().Get("RateLimit-Limit") != "1" {
+		t.Errorf("expected the low priority request to be rejected with RateLimit headers, got %d %v", rr.Code, rr.Header())
+	}
+	if rr := serve(PriorityLow); rr.Code != http.StatusTooManyRequests || rr.Header().Get("RateLimit-Limit") != "1" {
+		t.Errorf("expected a low priority request not to be queued in the full queue, got %d %v", rr.Code, rr.Header())
+	}
+	for _, done := range []<-chan *httptest.ResponseRecorder{high, normal} {
+		if rr := <-done; rr.Code != http.StatusOK || rr.Header().Get("RateLimit-Limit") != "1" {
+			t.Errorf("expected the queued request to be served with RateLimit headers, got %d %v", rr.Code, rr.Header())
+		}
+	}
+	if first, second := <-served, <-served; first != PriorityHigh || second != PriorityNormal {
+		t.Errorf("expected the high priority request first, got %s then %s", first, second)
+	}
+
+	// Requests are rejected once they waited for the maximum wait
+	config.Read.RequestsPerSecond = 0.1
+	config.Queue.MaxWait = 20
+	limiter = NewRateLimiter(config, nil, nil)
+	handler = limiter.Middleware(Endpoint{Path: "/api/"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve(PriorityNormal)
+	if rr := serve(PriorityNormal); rr.Code != http.StatusTooManyRequests || rr.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("expected the request to be rejected after the maximum wait with RateLimit headers, got %d %v", rr.Code, rr.Header())
+	}
+	if rr := serve(PriorityNormal); rr.Header().Get("Retry-After") == "1" {
+		t.Errorf("expected the Retry-After of the budget after the maximum wait, got %q", rr.Header().Get("Retry-After"))
+	}
+	if queued := queuedRequests(limiter, "read"); queued != 0 {
+		t.Errorf("expected the rejected request to leave the queue, got %d queued", queued)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// skippedReplayHeaders lists the request headers that are not replayed because they are connection specific
+// or were redacted when recording
+var skippedReplayHeaders = map[string]bool{
+	"Host":                true,
+	"Content-Length":      true,
+	"Connection":          true,
+	"Transfer-Encoding":   true,
+	"Accept-Encoding":     true,
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+}
+
+// ReplayResult summarizes a traffic replay
+type ReplayResult struct {
+	Total      int `json:"total"`
+	Matched    int `json:"matched"`
+	Mismatched int `json:"mismatched"`
+	Errors     int `json:"errors"`
+}
+
+// Replay re-sends the recorded requests of an HTTP Archive against the target URL and compares
+// the response status codes with the recorded ones. The headers are added to every request,
+// e.g. to provide credentials that were redacted when recording.
+func Replay(har *HAR, target string, headers http.Header, client *http.Client) (ReplayResult, error) {
+	targetURL, err := url.Parse(target)
+	if err != nil || targetURL.Host == "" {
+		return ReplayResult{}, fmt.Errorf("invalid replay target: %s", target)
+	}
+
+	result := ReplayResult{}
+	for i, entry := range har.Log.Entries {
+		result.Total++
+
+		recordedURL, err := url.Parse(entry.Request.URL)
+		if err != nil {
+			LogError("Skipping recorded request: invalid URL", err, map[string]interface{}{
+				"index": i,
+				"url":   entry.Request.URL,
+			})
+			result.Errors++
+			continue
+		}
+
+		// Send the request to the target, keeping the recorded path and query
+		requestURL := *targetURL
+		requestURL.Path = strings.TrimSuffix(targetURL.Path, "/") + recordedURL.Path
+		requestURL.RawQuery = recordedURL.RawQuery
+
+		var body io.Reader
+		if entry.Request.PostData != nil {
+			body = strings.NewReader(entry.Request.PostData.Text)
+		}
+		req, err := http.NewRequest(entry.Request.Method, requestURL.String(), body)
+		if err != nil {
+			LogError("Skipping recorded request", err, map[string]interface{}{
+				"index": i,
+				"url":   entry.Request.URL,
+			})
+			result.Errors++
+			continue
+		}
+		for _, header := range entry.Request.Headers {
+			if !skippedReplayHeaders[http.CanonicalHeaderKey(header.Name)] {
+				req.Header.Add(header.Name, header.Value)
+			}
+		}
+		for key, values := range headers {
+			req.Header[key] = values
+		}
+
+		startTime := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			LogError("Replayed request failed", err, map[string]interface{}{
+				"index":  i,
+				"method": req.Method,
+				"url":    requestURL.String(),
+			})
+			result.Errors++
+			continue
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+
+		fields := map[string]interface{}{
+			"index":           i,
+			"method":          req.Method,
+			"url":             requestURL.String(),
+			"status_code":     resp.StatusCode,
+			"recorded_status": entry.Response.Status,
+			"duration":        time.Since(startTime).String(),
+			"recorded_time":   entry.Time,
+		}
+		if resp.StatusCode != entry.Response.Status {
+			LogWarn("Replayed response differs from the recording", fields)
+			result.Mismatched++
+			continue
+		}
+		LogInfo("Replayed request", fields)
+		result.Matched++
+	}
+
+	return result, nil
+}
+
+// RunReplayCommand runs the replay subcommand with the given arguments
+func RunReplayCommand(args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	file := flags.String("file", "", "Path to the recorded HAR file")
+	target := flags.String("target", "", "Base URL the recorded requests are sent to")
+	timeout := flags.Int("timeout", 30000, "Request timeout in milliseconds")
+	var headerFlags stringList
+	flags.Var(&headerFlags, "header", "Header added to every request, as \"Name: value\" (repeatable)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" || *target == "" {
+		return fmt.Errorf("both -file and -target are required")
+	}
+
+	headers := http.Header{}
+	for _, header := range headerFlags {
+		name, value, ok := strings.Cut(header, ":")
+		if !ok {
+			return fmt.Errorf("invalid header: %s", header)
+		}
+		headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	har, err := LoadHAR(*file)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{
+		Timeout: time.Duration(*timeout) * time.Millisecond,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	result, err := Replay(har, *target, headers, client)
+	if err != nil {
+		return err
+	}
+
+	LogInfo("Replay finished", map[string]interface{}{
+		"file":       *file,
+		"target":     *target,
+		"total":      result.Total,
+		"matched":    result.Matched,
+		"mismatched": result.Mismatched,
+		"errors":     result.Errors,
+	})
+	if result.Mismatched > 0 || result.Errors > 0 {
+		return fmt.Errorf("%d of %d replayed requests differ from the recording", result.Mismatched+result.Errors, result.Total)
+	}
+	return nil
+}
+
+// stringList is a flag value collecting repeated string flags
+type stringList []string
+
+// String returns the flag values
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+// Set adds a flag value
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
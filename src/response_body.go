@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxTransformedBodyBytes is the largest response body, before and after decoding, edited by the gateway
+// and the body callbacks
+const maxTransformedBodyBytes = 10 * 1024 * 1024
+
+// ErrResponseBodyTooLarge is returned for response bodies larger than the transformation limit
+var ErrResponseBodyTooLarge = errors.New("response body too large to transform")
+
+// ErrUnsupportedContentEncoding is returned for response bodies with a content encoding other than gzip or deflate
+var ErrUnsupportedContentEncoding = errors.New("unsupported content encoding")
+
+// untransformable reports whether an error only means that a response body cannot be edited, in which case
+// the response is sent unchanged
+func untransformable(err error) bool {
+	return errors.Is(err, ErrResponseBodyTooLarge) || errors.Is(err, ErrUnsupportedContentEncoding)
+}
+
+// BodyTransform edits a decoded response body and returns the new body
+type BodyTransform func(body []byte, resp *http.Response, req *http.Request) ([]byte, error)
+
+// DecodedBodyCallback returns a post-backend callback running a transform on the response body decoded from
+// its content encoding. The new body is encoded again and its Content-Length fixed. Responses whose body
+// cannot be decoded, or the transform fails on, are sent unchanged.
+func DecodedBodyCallback(transform BodyTransform) ResponseCallback {
+	return func(resp *http.Response, req *http.Request) *http.Response {
+		body, err := ReadResponseBody(resp)
+		if err == nil {
+			body, err = transform(body, resp, req)
+		}
+		if err == nil {
+			err = SetResponseBody(resp, body)
+		}
+		if err != nil {
+			LogError("Response body transform failed, response sent unchanged", err, map[string]interface{}{
+				"path":   req.URL.Path,
+				"method": req.Method,
+			})
+		}
+		return resp
+	}
+}
+
+// responseEncoding returns the content encoding of a response, empty for identity
+func responseEncoding(resp *http.Response) string {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if encoding == "identity" {
+		return ""
+	}
+	return encoding
+}
+
+// ReadResponseBody reads a response body decoded from its gzip or deflate content encoding. The response
+// keeps its encoded body, so it is sent unchanged unless SetResponseBody replaces it. An error is returned
+// for other encodings and for bodies larger than 10 MB.
+func ReadResponseBody(resp *http.Response) ([]byte, error) {
+	encoding := responseEncoding(resp)
+	if encoding != "" && encoding != "gzip" && encoding != "deflate" {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedContentEncoding, encoding)
+	}
+
+	// Read the encoded body, restoring the part read if it is too large
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxTransformedBodyBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxTransformedBodyBytes {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(data), resp.Body), resp.Body}
+		return nil, ErrResponseBodyTooLarge
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	if encoding == "" {
+		return data, nil
+	}
+
+	// Decode the body, limiting its decoded size too
+	var decoder io.ReadCloser
+	if encoding == "gzip" {
+		decoder, err = gzip.NewReader(bytes.NewReader(data))
+	} else {
+		decoder, err = zlib.NewReader(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s response body: %w", encoding, err)
+	}
+	defer decoder.Close()
+	decoded, err := io.ReadAll(io.LimitReader(decoder, maxTransformedBodyBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s response body: %w", encoding, err)
+	}
+	if len(decoded) > maxTransformedBodyBytes {
+		return nil, ErrResponseBodyTooLarge
+	}
+	return decoded, nil
+}
+
+// SetResponseBody replaces a response body, encoded with the content encoding of the response, and fixes
+// its Content-Length. The ETag of the backend is removed since it identifies the previous body.
+func SetResponseBody(resp *http.Response, body []byte) error {
+	encoding := responseEncoding(resp)
+	if encoding != "" {
+		var buf bytes.Buffer
+		var encoder io.WriteCloser
+		switch encoding {
+		case "gzip":
+			encoder = gzip.NewWriter(&buf)
+		case "deflate":
+			encoder = zlib.NewWriter(&buf)
+		default:
+			return fmt.Errorf("%w: %s", ErrUnsupportedContentEncoding, encoding)
+		}
+		if _, err := encoder.Write(body); err != nil {
+			return err
+		}
+		if err := encoder.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Header.Del("ETag")
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// TestDecodedBodyCallback tests that body callbacks edit the decoded body of compressed responses
+func TestDecodedBodyCallback(t *testing.T) {
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		switch r.URL.Path {
+		case "/gzip":
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			_, _ = gz.Write([]byte("hello internal"))
+			_ = gz.Close()
+		case "/br":
+			w.Header().Set("Content-Encoding", "br")
+			_, _ = w.Write([]byte("opaque internal"))
+		default:
+			_, _ = w.Write([]byte("plain internal"))
+		}
+	}))
+	defer backendServer.Close()
+
+	proxy := NewProxy(Endpoint{Path: "/", Backend: backendServer.URL}, false, nil)
+	proxy.AddPostBackendCallback(DecodedBodyCallback(func(body []byte, resp *http.Response, req *http.Request) ([]byte, error) {
+		return bytes.ReplaceAll(body, []byte("internal"), []byte("public world")), nil
+	}))
+	handler := proxy.Handler()
+
+	tests := []struct {
+		path     string
+		expected string
+		etag     string
+	}{
+		{"/gzip", "hello public world", ""},
+		{"/plain", "plain public world", ""},
+		{"/br", "opaque internal", `"v1"`},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.Header.Set("Accept-Encoding", "gzip, br")
+		handler(rr, req)
+
+		body := rr.Body.Bytes()
+		if rr.Header().Get("Content-Length") != strconv.Itoa(len(body)) {
+			t.Errorf("for %s expected the Content-Length %d, got %s", tt.path, len(body), rr.Header().Get("Content-Length"))
+		}
+		if rr.Header().Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				t.Fatalf("for %s expected a gzip body: %v", tt.path, err)
+			}
+			body, _ = io.ReadAll(gz)
+		}
+		if string(body) != tt.expected || rr.Header().Get("ETag") != tt.etag {
+			t.Errorf("for %s expected %q with ETag %q, got %q with %q", tt.path, tt.expected, tt.etag, body, rr.Header().Get("ETag"))
+		}
+	}
+}
+
+// TestReadResponseBodyLimit tests that a body decoding to more than the limit is not read
+func TestReadResponseBodyLimit(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, _ = gz.Write(make([]byte, maxTransformedBodyBytes+1))
+	_ = gz.Close()
+	compressed := buf.Bytes()
+
+	resp := &http.Response{Header: http.Header{"Content-Encoding": {"gzip"}}, Body: io.NopCloser(bytes.NewReader(compressed))}
+	if _, err := ReadResponseBody(resp); !errors.Is(err, ErrResponseBodyTooLarge) {
+		t.Errorf("expected ErrResponseBodyTooLarge, got %v", err)
+	}
+	if sent, _ := io.ReadAll(resp.Body); !bytes.Equal(sent, compressed) {
+		t.Error("expected the compressed body to be sent unchanged")
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Default retry budget settings
+const (
+	defaultRetryBudgetWindow  = 10000
+	retryBudgetBucketsPerSpan = 10
+)
+
+// RetryConfig represents the retry policy and the limits protecting backends from retry storms
+type RetryConfig struct {
+	// MaxRetries is the maximum number of retries per request
+	MaxRetries int `json:"max_retries"`
+	// RetryOn lists the upstream status codes triggering a retry (connection errors always do)
+	RetryOn []int `json:"retry_on"`
+	// Backoff is the delay in milliseconds between attempts
+	Backoff int `json:"backoff"`
+	// Deadline is the total time budget in milliseconds for all attempts of a request
+	Deadline int `json:"deadline"`
+	// BudgetRatio is the maximum ratio of retries to requests within the budget window (e.g. 0.2)
+	BudgetRatio float64 `json:"budget_ratio"`
+	// BudgetMinRetries is the number of retries always allowed within the budget window
+	BudgetMinRetries int `json:"budget_min_retries"`
+	// BudgetWindow is the budget window in milliseconds
+	BudgetWindow int `json:"budget_window"`
+}
+
+// Merge returns the retry configuration with the non-zero values of the override applied
+func (c RetryConfig) Merge(override RetryConfig) RetryConfig {
+	if override.MaxRetries != 0 {
+		c.MaxRetries = override.MaxRetries
+	}
+	if len(override.RetryOn) > 0 {
+		c.RetryOn = override.RetryOn
+	}
+	if override.Backoff != 0 {
+		c.Backoff = override.Backoff
+	}
+	if override.Deadline != 0 {
+		c.Deadline = override.Deadline
+	}
+	if override.BudgetRatio != 0 {
+		c.BudgetRatio = override.BudgetRatio
+	}
+	if override.BudgetMinRetries != 0 {
+		c.BudgetMinRetries = override.BudgetMinRetries
+	}
+	if override.BudgetWindow != 0 {
+		c.BudgetWindow = override.BudgetWindow
+	}
+	return c
+}
+
+// retryBucket counts the requests and retries of a time slice of the budget window
+type retryBucket struct {
+	start    time.Time
+	requests int
+	retries  int
+}
+
+// RetryBudget limits the share of retries among all requests within a sliding window
+type RetryBudget struct {
+	mu             sync.Mutex
+	ratio          float64
+	minRetries     int
+	bucketDuration time.Duration
+	buckets        []retryBucket
+	now            func() time.Time
+}
+
+// NewRetryBudget creates a new RetryBudget, or nil if the configuration has no budget
+func NewRetryBudget(config RetryConfig) *RetryBudget {
+	if config.BudgetRatio <= 0 && config.BudgetMinRetries <= 0 {
+		return nil
+	}
+
+	window := config.BudgetWindow
+	if window <= 0 {
+		window = defaultRetryBudgetWindow
+	}
+
+	return &RetryBudget{
+		ratio:          config.BudgetRatio,
+		minRetries:     config.BudgetMinRetries,
+		bucketDuration: time.Duration(window) * time.Millisecond / retryBudgetBucketsPerSpan,
+		buckets:        make([]retryBucket, retryBudgetBucketsPerSpan),
+		now:            time.Now,
+	}
+}
+
+// currentBucket returns the bucket for the current time slice, resetting it if it is stale
+func (b *RetryBudget) currentBucket() *retryBucket {
+	start := b.now().Truncate(b.bucketDuration)
+	bucket := &b.buckets[(start.UnixNano()/int64(b.bucketDuration))%int64(len(b.buckets))]
+	if !bucket.start.Equal(start) {
+		*bucket = retryBucket{start: start}
+	}
+	return bucket
+}
+
+// RecordRequest records a request in the budget window
+func (b *RetryBudget) RecordRequest() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.currentBucket().requests++
+}
+
+// AllowRetry checks whether a retry fits in the budget and records it if so
+func (b *RetryBudget) AllowRetry() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	current := b.currentBucket()
+	windowStart := current.start.Add(-time.Duration(len(b.buckets)-1) * b.bucketDuration)
+
+	requests, retries := 0, 0
+	for _, bucket := range b.buckets {
+		if !bucket.start.Before(windowStart) {
+			requests += bucket.requests
+			retries += bucket.retries
+		}
+	}
+
+	if float64(retries+1) > b.ratio*float64(requests)+float64(b.minRetries) {
+		return false
+	}
+	current.retries++
+	return true
+}
+
+// retryTransport retries failed upstream attempts within the retry budget, on another instance of the backend
+// pool if any
+type retryTransport struct {
+	next      http.RoundTripper
+	config    RetryConfig
+	budget    *RetryBudget
+	telemetry *TelemetryManager
+	route     string
+	pool      *BackendPool
+}
+
+// RoundTrip sends the request, retrying on connection errors and configured status codes
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.budget.RecordRequest()
+
+	var tried []string
+	for attempt := 1; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+
+		reason := t.retryReason(resp, err)
+		if reason == "" || attempt > t.config.MaxRetries || !isRetryable(req) || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		if !t.budget.AllowRetry() {
+			LogWarn("Retry budget exhausted", map[string]interface{}{
+				"path":    req.URL.Path,
+				"route":   t.route,
+				"attempt": attempt,
+				"reason":  reason,
+			})
+			if t.telemetry != nil {
+				t.telemetry.RecordRetry(req.Context(), t.route, reason, false)
+			}
+			return resp, err
+		}
+
+		// Discard the failed response before retrying
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			_ = resp.Body.Close()
+		}
+
+		LogInfo("Retrying upstream request", map[string]interface{}{
+			"path":    req.URL.Path,
+			"route":   t.route,
+			"attempt": attempt,
+			"reason":  reason,
+		})
+		if t.telemetry != nil {
+			t.telemetry.RecordRetry(req.Context(), t.route, reason, true)
+		}
+		UpstreamAttemptsFromContext(req.Context()).retried(reason)
+
+		if err := sleepContext(req.Context(), time.Duration(t.config.Backoff)*time.Millisecond); err != nil {
+			return nil, err
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		// Send the retry to an instance of the pool the request was not sent to yet
+		if t.pool != nil && t.pool.serves(req.URL.Host) {
+			tried = append(tried, req.URL.Host)
+			if backend := t.pool.NextExcluding(tried); backend != "" {
+				req = retryOnInstance(req, backend)
+			}
+		}
+	}
+}
+
+// retryOnInstance returns a copy of an upstream request sent to another backend instance
+func retryOnInstance(req *http.Request, backend string) *http.Request {
+	backendURL, err := url.Parse(backend)
+	if err != nil {
+		return req
+	}
+	retry := req.Clone(req.Context())
+	// Keep the Host header if it was not set to the backend host, e.g. to preserve the client host
+	if retry.Host == retry.URL.Host {
+		retry.Host = backendURL.Host
+	}
+	retry.URL.Scheme, retry.URL.Host = backendURL.Scheme, backendURL.Host
+	return retry
+}
+
+// retryReason returns why an attempt should be retried, or an empty string if it should not
+func (t *retryTransport) retryReason(resp *http.Response, err error) string {
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, errConcurrencyLimited) {
+			return ""
+		}
+		return "connection_error"
+	}
+	for _, status := range t.config.RetryOn {
+		if resp.StatusCode == status {
+			return "status_" + strconv.Itoa(status)
+		}
+	}
+	return ""
+}
+
+// isRetryable checks whether a request is idempotent and its body can be replayed
+func isRetryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// sleepContext waits for the given duration or until the context is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
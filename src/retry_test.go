@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestRetryBudget tests that the retry budget limits the share of retries within the window
+func TestRetryBudget(t *testing.T) {
+	now := time.Unix(1000, 0)
+	budget := NewRetryBudget(RetryConfig{BudgetRatio: 0.2, BudgetMinRetries: 1, BudgetWindow: 10000})
+	budget.now = func() time.Time { return now }
+
+	for i := 0; i < 10; i++ {
+		budget.RecordRequest()
+	}
+
+	// 10 requests allow 0.2 * 10 + 1 = 3 retries
+	for i := 0; i < 3; i++ {
+		if !budget.AllowRetry() {
+			t.Fatalf("AllowRetry() = false for retry %d, want true", i+1)
+		}
+	}
+	if budget.AllowRetry() {
+		t.Error("AllowRetry() = true after the budget was used up, want false")
+	}
+
+	// Once the window has passed, the budget is available again
+	now = now.Add(11 * time.Second)
+	if !budget.AllowRetry() {
+		t.Error("AllowRetry() = false after the window passed, want true")
+	}
+
+	// A nil budget allows all retries
+	var unlimited *RetryBudget
+	if !unlimited.AllowRetry() {
+		t.Error("AllowRetry() on nil budget = false, want true")
+	}
+}
+
+// TestProxyHandlerRetries tests that failed upstream attempts are retried
+func TestProxyHandlerRetries(t *testing.T) {
+	var attempts atomic.Int32
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("OK"))
+	}))
+	defer backendServer.Close()
+
+	endpoint := Endpoint{
+		Path:    "/test",
+		Method:  "GET",
+		Backend: backendServer.URL,
+		Retry:   RetryConfig{MaxRetries: 2, RetryOn: []int{http.StatusServiceUnavailable}, Deadline: 5000},
+	}
+
+	rr := httptest.NewRecorder()
+	NewProxy(endpoint, false, nil).Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/test", nil))
+	if rr.Code != http.StatusOK || attempts.Load() != 3 {
+		t.Errorf("handler returned %v after %d attempts, want 200 after 3 attempts", rr.Code, attempts.Load())
+	}
+
+	// With an exhausted budget, the failed response is returned without retrying
+	attempts.Store(0)
+	proxy := NewProxy(endpoint, false, nil)
+	proxy.SetRetryBudget(NewRetryBudget(RetryConfig{BudgetRatio: 0.0001}))
+
+	rr = httptest.NewRecorder()
+	proxy.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/test", nil))
+	if rr.Code != http.StatusServiceUnavailable || attempts.Load() != 1 {
+		t.Errorf("handler returned %v after %d attempts, want 503 after 1 attempt", rr.Code, attempts.Load())
+	}
+}
+
+// TestProxyHandlerRetriesOtherInstance tests that retries are sent to the instances of the pool a request was
+// not sent to yet, and the failures reported to the instance that failed
+func TestProxyHandlerRetriesOtherInstance(t *testing.T) {
+	var badRequests, goodRequests atomic.Int32
+	badServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		badRequests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer badServer.Close()
+	goodServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		goodRequests.Add(1)
+		_, _ = w.Write([]byte("OK"))
+	}))
+	defer goodServer.Close()
+
+	proxy := NewProxy(Endpoint{
+		Path:             "/test",
+		Backends:         []string{badServer.URL, goodServer.URL},
+		Retry:            RetryConfig{MaxRetries: 1, RetryOn: []int{http.StatusServiceUnavailable}},
+		OutlierDetection: OutlierDetectionConfig{Enabled: true, ConsecutiveFailures: 100},
+	}, false, nil)
+	handler := proxy.Handler()
+
+	for i := 0; i < 4; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/test", nil))
+		if rr.Code != http.StatusOK {
+			t.Errorf("request %d: expected the retry on the other instance to succeed, got %v", i, rr.Code)
+		}
+	}
+	if badRequests.Load() != 2 || goodRequests.Load() != 4 {
+		t.Errorf("expected 2 requests to the failing and 4 to the healthy instance, got %d and %d", badRequests.Load(), goodRequests.Load())
+	}
+
+	proxy.pool.mu.Lock()
+	defer proxy.pool.mu.Unlock()
+	if failures := proxy.pool.instances[0].failures; failures != 2 {
+		t.Errorf("expected 2 failures reported to the failing instance, got %d", failures)
+	}
+	if failures := proxy.pool.instances[1].failures; failures != 0 {
+		t.Errorf("expected no failures reported to the healthy instance, got %d", failures)
+	}
+}
+
+// TestProxyLogsUpstreamAttempts tests that the response log records the backend, attempts and retry reasons
+func TestProxyLogsUpstreamAttempts(t *testing.T) {
+	var attempts atomic.Int32
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("OK"))
+	}))
+	defer backendServer.Close()
+
+	var logs bytes.Buffer
+	SetLogOutput(&logs)
+	defer SetLogOutput(os.Stdout)
+
+	proxy := NewProxy(Endpoint{
+		Path:    "/test",
+		Backend: backendServer.URL,
+		Retry:   RetryConfig{MaxRetries: 2, RetryOn: []int{http.StatusServiceUnavailable}},
+	}, false, nil)
+	rr := httptest.NewRecorder()
+	proxy.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/test", nil))
+
+	var entry LogEntry
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		if err := json.Unmarshal([]byte(line), &entry); err == nil && entry.Type == "response" {
+			break
+		}
+	}
+	backendURL, _ := url.Parse(backendServer.URL)
+	if entry.Backend != backendURL.Host || entry.Attempts != 2 {
+		t.Errorf("Expected backend %s after 2 attempts, got %s after %d attempts", backendURL.Host, entry.Backend, entry.Attempts)
+	}
+	if len(entry.RetryReasons) != 1 || entry.RetryReasons[0] != "status_503" {
+		t.Errorf("Expected retry reason status_503, got %v", entry.RetryReasons)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// upgradeSignal is not available on this platform
+var upgradeSignal os.Signal
+
+// reloadSignal is not available on this platform
+var reloadSignal os.Signal
+
+// reusePortControl is not available on this platform
+var reusePortControl func(network, address string, conn syscall.RawConn) error
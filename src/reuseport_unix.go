@@ -0,0 +1,28 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// upgradeSignal triggers an in-place binary upgrade
+var upgradeSignal os.Signal = syscall.SIGUSR2
+
+// reloadSignal reloads the listener certificates
+var reloadSignal os.Signal = syscall.SIGHUP
+
+// reusePortControl enables SO_REUSEPORT on a listening socket
+var reusePortControl = func(network, address string, conn syscall.RawConn) error {
+	var sockErr error
+	err := conn.Control(func(fd uintptr) {
+		sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
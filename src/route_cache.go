@@ -0,0 +1,170 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+// defaultRouteCacheMaxEntries is the default maximum number of cached route resolutions
+const defaultRouteCacheMaxEntries = 10000
+
+// RouteCacheConfig represents the cache of the routes resolved for request paths
+type RouteCacheConfig struct {
+	Enabled bool `json:"enabled"`
+	// MaxEntries is the maximum number of cached request paths, the least recently used are evicted first
+	MaxEntries int `json:"max_entries"`
+}
+
+// endpointRoute is the compiled path template, the handler and the proxy of an endpoint registered on the mux
+type endpointRoute struct {
+	template *PathTemplate
+	handler  http.Handler
+	proxy    *Proxy
+}
+
+// routeMatch is the endpoint resolved for a request path. Matches are never modified once cached.
+type routeMatch struct {
+	key     string
+	handler http.Handler
+	// route is the path of the matched endpoint and params its path parameters
+	route  string
+	params map[string]string
+}
+
+// routeMatchKey is the context key of the route resolved for a request
+type routeMatchKey struct{}
+
+// RouteParamsFromContext returns the path parameters resolved for a request of the given endpoint path.
+// The returned map must not be modified.
+func RouteParamsFromContext(ctx context.Context, route string) (map[string]string, bool) {
+	match, ok := ctx.Value(routeMatchKey{}).(*routeMatch)
+	if !ok || match.route != route {
+		return nil, false
+	}
+	return match.params, true
+}
+
+// pathParams returns the path parameters of a request, resolved by the route cache or extracted from its path
+func (p *Proxy) pathParams(r *http.Request) map[string]string {
+	if params, ok := RouteParamsFromContext(r.Context(), p.endpoint.Path); ok {
+		return params
+	}
+	return p.endpoint.ExtractPathParams(r.URL.Path)
+}
+
+// RouteCache is an LRU cache of the endpoint and path parameters resolved for each request host and path.
+// Requests not resolved to an endpoint, e.g. redirects, health checks and unmatched requests, are not cached.
+type RouteCache struct {
+	mu         sync.Mutex
+	mux        *http.ServeMux
+	routes     map[string]endpointRoute
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List
+	telemetry  *TelemetryManager
+}
+
+// NewRouteCache creates a new RouteCache resolving routes with the given mux. Routes maps the mux
+// patterns of the endpoints to their routes.
+func NewRouteCache(config RouteCacheConfig, mux *http.ServeMux, routes map[string]endpointRoute, telemetry *TelemetryManager) *RouteCache {
+	maxEntries := config.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultRouteCacheMaxEntries
+	}
+	return &RouteCache{
+		mux:        mux,
+		routes:     routes,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		telemetry:  telemetry,
+	}
+}
+
+// ServeHTTP serves a request with the handler of its cached route, resolving and caching it on a miss
+func (c *RouteCache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// CONNECT requests are routed on their host only
+	if r.Method == http.MethodConnect {
+		c.mux.ServeHTTP(w, r)
+		return
+	}
+
+	key := r.Host + " " + r.URL.EscapedPath()
+	match, hit := c.get(key)
+	if c.telemetry != nil {
+		c.telemetry.RecordRouteCacheResult(r.Context(), hit)
+	}
+	if !hit {
+		handler, pattern := c.mux.Handler(r)
+		if match = c.resolve(key, r, pattern); match == nil {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		c.set(match)
+	}
+	match.handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), routeMatchKey{}, match)))
+}
+
+// resolve returns the endpoint matched by a request with the given mux pattern, or nil if the request
+// is not served by an endpoint
+func (c *RouteCache) resolve(key string, r *http.Request, pattern string) *routeMatch {
+	route, ok := c.routes[pattern]
+	if !ok || !isCleanPath(r.URL.Path) {
+		return nil
+	}
+	// The mux also returns the pattern of the endpoint when it redirects to it
+	params, ok := route.template.Match(r.URL.Path)
+	if !ok {
+		return nil
+	}
+	return &routeMatch{key: key, handler: route.handler, route: route.template.pattern, params: params}
+}
+
+// isCleanPath checks whether a request path is already clean, the mux redirects the other ones
+func isCleanPath(requestPath string) bool {
+	cleaned := path.Clean(requestPath)
+	if strings.HasSuffix(requestPath, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned == requestPath
+}
+
+// get returns the cached route of a key
+func (c *RouteCache) get(key string) (*routeMatch, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return element.Value.(*routeMatch), true
+}
+
+// set stores a resolved route, evicting the least recently used ones beyond the maximum
+func (c *RouteCache) set(match *routeMatch) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[match.key]; ok {
+		c.lru.Remove(element)
+	}
+	c.entries[match.key] = c.lru.PushFront(match)
+	for c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*routeMatch).key)
+	}
+}
+
+// Len returns the number of cached routes
+func (c *RouteCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
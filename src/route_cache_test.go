@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// TestRouteCache tests that the endpoints resolved for request paths are cached with their path parameters
+func TestRouteCache(t *testing.T) {
+	var received string
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.URL.Path
+	}))
+	defer backendServer.Close()
+
+	gateway := NewGateway(Config{
+		Endpoints: []Endpoint{
+			{Path: "/api/users/:id([0-9]+)", Backend: backendServer.URL + "/people/:id", PathMode: PathModeTemplate},
+			{Path: "/api/orders", Backend: backendServer.URL},
+		},
+	}, nil)
+	gateway.RegisterEndpoints()
+	gateway.RegisterHealthCheck()
+	cache := NewRouteCache(RouteCacheConfig{Enabled: true, MaxEntries: 2}, gateway.mux, gateway.routes, nil)
+
+	serve := func(path string) int {
+		received = ""
+		rr := httptest.NewRecorder()
+		cache.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		return rr.Code
+	}
+
+	// Hits use the cached path parameters
+	for i := 0; i < 2; i++ {
+		if code := serve("/api/users/42"); code != http.StatusOK || received != "/people/42" {
+			t.Errorf("expected /api/users/42 to be proxied to /people/42, got %d and %q", code, received)
+		}
+	}
+	if cache.Len() != 1 {
+		t.Errorf("expected 1 cached route, got %d", cache.Len())
+	}
+
+	// Requests not served by an endpoint are not cached
+	for _, path := range []string{"/health", "/api/users/me", "/api/orders/../orders", "/unknown"} {
+		serve(path)
+	}
+	if cache.Len() != 1 {
+		t.Errorf("expected only endpoint routes to be cached, got %d", cache.Len())
+	}
+
+	// The least recently used routes are evicted
+	serve("/api/orders")
+	serve("/api/users/7")
+	if cache.Len() != 2 {
+		t.Errorf("expected the cache to be limited to 2 routes, got %d", cache.Len())
+	}
+	if _, ok := cache.get(" /api/users/42"); ok {
+		t.Error("expected the least recently used route to be evicted")
+	}
+}
+
+// BenchmarkRouteCache compares serving requests through the route cache with resolving them with the mux
+func BenchmarkRouteCache(b *testing.B) {
+	SetLogOutput(io.Discard)
+	defer SetLogOutput(os.Stdout)
+
+	gateway := NewGateway(Config{}, nil)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, path := range []string{"/api/users", "/api/users/:id([0-9]+)", "/api/users/:id/posts/:postId", "/api/orders/:id", "/files/*path"} {
+		template, _ := compiledPathTemplate(path)
+		gateway.routes[muxPattern(path)] = endpointRoute{template: template, handler: handler}
+		gateway.mux.Handle(muxPattern(path), handler)
+	}
+	cache := NewRouteCache(RouteCacheConfig{Enabled: true}, gateway.mux, gateway.routes, nil)
+	req := httptest.NewRequest("GET", "/api/users/123/posts/456", nil)
+
+	b.Run("cached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			cache.ServeHTTP(httptest.NewRecorder(), req)
+		}
+	})
+	b.Run("mux", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			gateway.mux.ServeHTTP(httptest.NewRecorder(), req)
+			PathParamExtractor{}.Extract("/api/users/:id/posts/:postId", req.URL.Path)
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"time"
+)
+
+// ScheduledChange represents a change of the upstream settings of an endpoint applied automatically from
+// a point in time, e.g. a new backend taking over at a cutover time
+type ScheduledChange struct {
+	// EffectiveFrom is the RFC 3339 time the change applies from, e.g. 2024-05-01T03:00:00Z
+	EffectiveFrom string `json:"effective_from"`
+	// Backend and Backends replace the backend instances of the endpoint, and its blue/green groups
+	Backend  string   `json:"backend"`
+	Backends []string `json:"backends"`
+	// Headers and QueryParams are added to the ones of the endpoint, replacing those with the same name
+	Headers     map[string]string `json:"headers"`
+	QueryParams map[string]string `json:"query_params"`
+	// Timeout replaces the backend timeout of the endpoint in milliseconds
+	Timeout int `json:"timeout"`
+}
+
+// apply returns the endpoint with the change applied
+func (c ScheduledChange) apply(endpoint Endpoint) Endpoint {
+	if c.Backend != "" || len(c.Backends) > 0 {
+		endpoint.Backend = c.Backend
+		endpoint.Backends = c.Backends
+		endpoint.BlueGreen = BlueGreenConfig{}
+	}
+	endpoint.Headers = mergeStringMaps(endpoint.Headers, c.Headers)
+	endpoint.QueryParams = mergeStringMaps(endpoint.QueryParams, c.QueryParams)
+	if c.Timeout > 0 {
+		endpoint.Timeout = c.Timeout
+	}
+	return endpoint
+}
+
+// mergeStringMaps returns a copy of base with the values of overrides added, base itself is not modified
+func mergeStringMaps(base, overrides map[string]string) map[string]string {
+	if len(overrides) == 0 {
+		return base
+	}
+	merged := make(map[string]string, len(base)+len(overrides))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range overrides {
+		merged[key] = value
+	}
+	return merged
+}
+
+// scheduledProxy is the proxy of an endpoint with the scheduled changes up to one of them applied
+type scheduledProxy struct {
+	from  time.Time
+	proxy *Proxy
+}
+
+// newScheduledProxies creates a proxy for each point in time the scheduled changes of an endpoint apply
+// from, in chronological order. Changes with an invalid time are logged and ignored.
+func newScheduledProxies(endpoint Endpoint, debug bool, telemetry *TelemetryManager) []scheduledProxy {
+	type change struct {
+		from   time.Time
+		change ScheduledChange
+	}
+	var changes []change
+	for _, scheduled := range endpoint.Schedule {
+		from, err := time.Parse(time.RFC3339, scheduled.EffectiveFrom)
+		if err != nil {
+			LogError("Invalid scheduled change time, change ignored", err, map[string]interface{}{
+				"path":           endpoint.Path,
+				"effective_from": scheduled.EffectiveFrom,
+			})
+			continue
+		}
+		changes = append(changes, change{from: from, change: scheduled})
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].from.Before(changes[j].from) })
+
+	// Each change applies on top of the earlier ones
+	var proxies []scheduledProxy
+	version := endpoint
+	version.Schedule = nil
+	for _, c := range changes {
+		version = c.change.apply(version)
+		proxies = append(proxies, scheduledProxy{from: c.from, proxy: NewProxy(version, debug, telemetry)})
+	}
+	return proxies
+}
+
+// Current returns the proxy of the endpoint with the scheduled changes applied that are effective now,
+// the proxy itself if there are none
+func (p *Proxy) Current() *Proxy {
+	if len(p.scheduled) == 0 {
+		return p
+	}
+	now := p.now()
+	current, applied := p, int64(0)
+	for i, scheduled := range p.scheduled {
+		if !now.Before(scheduled.from) {
+			current, applied = scheduled.proxy, int64(i+1)
+		}
+	}
+
+	// Log the first request the change applies to
+	if p.applied.Swap(applied) < applied {
+		LogInfo("Scheduled endpoint change applied", map[string]interface{}{
+			"path":           p.endpoint.Path,
+			"effective_from": p.scheduled[applied-1].from.UTC().Format(time.RFC3339),
+			"backend":        current.endpoint.Backend,
+			"backends":       current.endpoint.Backends,
+		})
+	}
+	return current
+}
+
+// each calls fn for the proxy and the proxies of its scheduled changes
+func (p *Proxy) each(fn func(proxy *Proxy)) {
+	fn(p)
+	for _, scheduled := range p.scheduled {
+		fn(scheduled.proxy)
+	}
+}
+
+// scheduledHandler returns a handler sending each request to the proxy of the changes effective at the time
+func (p *Proxy) scheduledHandler() http.HandlerFunc {
+	handlers := map[*Proxy]http.HandlerFunc{p: p.handler()}
+	for _, scheduled := range p.scheduled {
+		handlers[scheduled.proxy] = scheduled.proxy.handler()
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		handlers[p.Current()](w, r)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestScheduledChanges tests that the scheduled changes of an endpoint apply from their time, on top of the earlier ones
+func TestScheduledChanges(t *testing.T) {
+	newBackend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(name + " " + r.Header.Get("X-Tenant") + " " + r.Header.Get("X-Version")))
+		}))
+	}
+	oldBackend, newBackendServer := newBackend("old"), newBackend("new")
+	defer oldBackend.Close()
+	defer newBackendServer.Close()
+
+	proxy := NewProxy(Endpoint{
+		Path:    "/api/",
+		Backend: oldBackend.URL,
+		Headers: map[string]string{"X-Tenant": "acme", "X-Version": "1"},
+		Schedule: []ScheduledChange{
+			{EffectiveFrom: "2024-05-01T05:00:00+02:00", Headers: map[string]string{"X-Version": "3"}},
+			{EffectiveFrom: "2024-05-01T02:00:00Z", Backend: newBackendServer.URL, Headers: map[string]string{"X-Version": "2"}},
+			{EffectiveFrom: "tomorrow", Backend: "http://invalid"},
+		},
+	}, false, nil)
+	if len(proxy.scheduled) != 2 {
+		t.Fatalf("expected the invalid change to be ignored, got %d changes", len(proxy.scheduled))
+	}
+
+	var callbacks int
+	proxy.AddPreBackendCallback(func(req *http.Request) *http.Request {
+		callbacks++
+		return req
+	})
+	handler := proxy.Handler()
+
+	tests := []struct {
+		now      string
+		expected string
+	}{
+		{"2024-05-01T01:59:59Z", "old acme 1"},
+		{"2024-05-01T02:00:00Z", "new acme 2"},
+		{"2024-05-01T03:00:00Z", "new acme 3"},
+	}
+	for _, tt := range tests {
+		now, _ := time.Parse(time.RFC3339, tt.now)
+		proxy.now = func() time.Time { return now }
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest("GET", "/api/a", nil))
+		if rr.Body.String() != tt.expected {
+			t.Errorf("at %s expected %q, got %q", tt.now, tt.expected, rr.Body.String())
+		}
+	}
+	if callbacks != len(tests) {
+		t.Errorf("expected the callback to run for every change, got %d calls", callbacks)
+	}
+	if statuses := proxy.BackendStatuses(); len(statuses) != 1 || statuses[0].URL != newBackendServer.URL {
+		t.Errorf("expected the backend of the changes in effect, got %+v", statuses)
+	}
+}
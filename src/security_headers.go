@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+)
+
+// Default values for the security headers injected when a header is not configured explicitly
+const (
+	defaultHSTS                  = "max-age=31536000; includeSubDomains"
+	defaultContentTypeOptions    = "nosniff"
+	defaultFrameOptions          = "DENY"
+	defaultContentSecurityPolicy = "default-src 'none'; frame-ancestors 'none'"
+	defaultReferrerPolicy        = "no-referrer"
+)
+
+// SecurityHeadersConfig represents the security headers injected into all responses
+type SecurityHeadersConfig struct {
+	Enabled               bool              `json:"enabled"`
+	HSTS                  string            `json:"hsts"`
+	ContentTypeOptions    string            `json:"content_type_options"`
+	FrameOptions          string            `json:"frame_options"`
+	ContentSecurityPolicy string            `json:"content_security_policy"`
+	ReferrerPolicy        string            `json:"referrer_policy"`
+	Custom                map[string]string `json:"custom"`
+}
+
+// Resolve returns the final set of security headers for an endpoint.
+// Empty configuration values fall back to the defaults, and per-endpoint overrides
+// replace the global values. An override with an empty value removes the header.
+func (c SecurityHeadersConfig) Resolve(overrides map[string]string) map[string]string {
+	headers := map[string]string{
+		"Strict-Transport-Security": valueOrDefault(c.HSTS, defaultHSTS),
+		"X-Content-Type-Options":    valueOrDefault(c.ContentTypeOptions, defaultContentTypeOptions),
+		"X-Frame-Options":           valueOrDefault(c.FrameOptions, defaultFrameOptions),
+		"Content-Security-Policy":   valueOrDefault(c.ContentSecurityPolicy, defaultContentSecurityPolicy),
+		"Referrer-Policy":           valueOrDefault(c.ReferrerPolicy, defaultReferrerPolicy),
+	}
+
+	// Add custom headers
+	for key, value := range c.Custom {
+		headers[http.CanonicalHeaderKey(key)] = value
+	}
+
+	// Apply per-endpoint overrides
+	for key, value := range overrides {
+		key = http.CanonicalHeaderKey(key)
+		if value == "" {
+			delete(headers, key)
+			continue
+		}
+		headers[key] = value
+	}
+
+	return headers
+}
+
+// valueOrDefault returns value if it is not empty, otherwise the default value
+func valueOrDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// SecurityHeadersMiddleware wraps a handler so that the given headers are added to every response.
+// Headers already set by the handler (e.g. copied from the backend response) are left untouched.
+func SecurityHeadersMiddleware(headers map[string]string, next http.Handler) http.Handler {
+	if len(headers) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&securityHeadersWriter{ResponseWriter: w, headers: headers}, r)
+	})
+}
+
+// securityHeadersWriter is a wrapper around http.ResponseWriter that injects security headers
+// right before the response headers are written
+type securityHeadersWriter struct {
+	http.ResponseWriter
+	headers     map[string]string
+	wroteHeader bool
+}
+
+// WriteHeader injects the missing security headers and writes the status code
+func (w *securityHeadersWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		header := w.ResponseWriter.Header()
+		for key, value := range w.headers {
+			if header.Get(key) == "" {
+				header.Set(key, value)
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write makes sure the security headers are written before the body
+func (w *securityHeadersWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying ResponseWriter so http.ResponseController can reach it
+func (w *securityHeadersWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
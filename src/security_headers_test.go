@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestSecurityHeadersResolve tests the Resolve method of the SecurityHeadersConfig struct
+func TestSecurityHeadersResolve(t *testing.T) {
+	config := SecurityHeadersConfig{
+		Enabled:      true,
+		FrameOptions: "SAMEORIGIN",
+		Custom:       map[string]string{"permissions-policy": "geolocation=()"},
+	}
+
+	headers := config.Resolve(map[string]string{
+		"Content-Security-Policy": "",
+		"Referrer-Policy":         "same-origin",
+	})
+
+	expected := map[string]string{
+		"Strict-Transport-Security": defaultHSTS,
+		"X-Content-Type-Options":    defaultContentTypeOptions,
+		"X-Frame-Options":           "SAMEORIGIN",
+		"Referrer-Policy":           "same-origin",
+		"Permissions-Policy":        "geolocation=()",
+	}
+
+	if len(headers) != len(expected) {
+		t.Errorf("Resolve() returned %d headers, want %d: %v", len(headers), len(expected), headers)
+	}
+	for key, value := range expected {
+		if headers[key] != value {
+			t.Errorf("Resolve()[%s] = %q, want %q", key, headers[key], value)
+		}
+	}
+}
+
+// TestGatewaySecurityHeaders tests that security headers are injected into proxied and system responses
+func TestGatewaySecurityHeaders(t *testing.T) {
+	// Create a mock backend server that sets its own frame options
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Frame-Options", "SAMEORIGIN")
+		_, _ = w.Write([]byte("OK"))
+	}))
+	defer backendServer.Close()
+
+	config := Config{
+		Endpoints: []Endpoint{
+			{
+				Path:            "/test",
+				Method:          "GET",
+				Backend:         backendServer.URL,
+				SecurityHeaders: map[string]string{"Strict-Transport-Security": ""},
+			},
+		},
+		SecurityHeaders: SecurityHeadersConfig{Enabled: true},
+	}
+
+	gateway := NewGateway(config, nil)
+	gateway.RegisterEndpoints()
+	gateway.RegisterHealthCheck()
+
+	// Check the proxied endpoint
+	rr := httptest.NewRecorder()
+	gateway.mux.ServeHTTP(rr, httptest.NewRequest("GET", "/test", nil))
+
+	if got := rr.Header().Get("X-Content-Type-Options"); got != defaultContentTypeOptions {
+		t.Errorf("X-Content-Type-Options = %q, want %q", got, defaultContentTypeOptions)
+	}
+	if got := rr.Header().Get("X-Frame-Options"); got != "SAMEORIGIN" {
+		t.Errorf("X-Frame-Options = %q, want backend value %q", got, "SAMEORIGIN")
+	}
+	if got := rr.Header().Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("Strict-Transport-Security = %q, want it removed by the endpoint override", got)
+	}
+
+	// Check the health check endpoint
+	rr = httptest.NewRecorder()
+	gateway.mux.ServeHTTP(rr, httptest.NewRequest("GET", "/health", nil))
+
+	if got := rr.Header().Get("Strict-Transport-Security"); got != defaultHSTS {
+		t.Errorf("Strict-Transport-Security = %q, want %q", got, defaultHSTS)
+	}
+}
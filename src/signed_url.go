@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Default signed URL settings
+const (
+	defaultSignedURLExpiresParam   = "expires"
+	defaultSignedURLSignatureParam = "signature"
+	defaultSignedURLMaxTTL         = 24 * 3600 * 1000
+)
+
+// SignedURLConfig represents the time-limited signed URLs granting temporary access to the endpoints with signed_urls
+type SignedURLConfig struct {
+	// Secret is the HMAC key the URLs are signed with
+	Secret string `json:"secret"`
+	// ExpiresParam and SignatureParam are the names of the query parameters carrying the expiry (Unix time in
+	// seconds) and the signature (default expires and signature)
+	ExpiresParam   string `json:"expires_param"`
+	SignatureParam string `json:"signature_param"`
+	// MaxTTL is the maximum lifetime in milliseconds of the URLs signed through the admin API (default 1 day)
+	MaxTTL int `json:"max_ttl"`
+}
+
+// URLSigner signs and validates time-limited URLs
+type URLSigner struct {
+	config SignedURLConfig
+	now    func() time.Time
+}
+
+// NewURLSigner creates a new URLSigner
+func NewURLSigner(config SignedURLConfig) *URLSigner {
+	if config.ExpiresParam == "" {
+		config.ExpiresParam = defaultSignedURLExpiresParam
+	}
+	if config.SignatureParam == "" {
+		config.SignatureParam = defaultSignedURLSignatureParam
+	}
+	if config.MaxTTL <= 0 {
+		config.MaxTTL = defaultSignedURLMaxTTL
+	}
+	return &URLSigner{config: config, now: time.Now}
+}
+
+// signature computes the signature of a path, query and expiry: the unpadded base64url encoded HMAC-SHA256 of
+// the path, a newline, the expiry in Unix seconds, a newline and the canonical query
+func (s *URLSigner) signature(path string, query url.Values, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(s.config.Secret))
+	mac.Write([]byte(path + "\n" + strconv.FormatInt(expires, 10) + "\n" + s.canonicalQuery(query)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// canonicalQuery returns the query without the expiry and signature parameters, encoded with the parameters
+// sorted by name, so clients cannot change a parameter of a signed URL
+func (s *URLSigner) canonicalQuery(query url.Values) string {
+	signed := make(url.Values, len(query))
+	for name, values := range query {
+		if name != s.config.ExpiresParam && name != s.config.SignatureParam {
+			signed[name] = values
+		}
+	}
+	return signed.Encode()
+}
+
+// Sign returns the path with the expiry and signature query parameters, keeping and signing the existing query
+func (s *URLSigner) Sign(rawURL string, expires time.Time) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Set(s.config.SignatureParam, s.signature(u.Path, query, expires.Unix()))
+	query.Set(s.config.ExpiresParam, strconv.FormatInt(expires.Unix(), 10))
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// Validate checks the signature and expiry of a request, returning a reason if it is invalid
+func (s *URLSigner) Validate(r *http.Request) string {
+	query := r.URL.Query()
+	signature := query.Get(s.config.SignatureParam)
+	expires, err := strconv.ParseInt(query.Get(s.config.ExpiresParam), 10, 64)
+	if signature == "" || err != nil {
+		return "missing signature"
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.signature(r.URL.Path, query, expires))) {
+		return "invalid signature"
+	}
+	if s.now().Unix() >= expires {
+		return "expired"
+	}
+	return ""
+}
+
+// Middleware rejects requests without a valid signed URL for the endpoints with signed_urls, and removes the
+// signature parameters before the request is proxied
+func (s *URLSigner) Middleware(endpoint Endpoint, next http.Handler) http.Handler {
+	if !endpoint.SignedURLs {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.config.Secret == "" {
+			LogError("Signed URLs required without a secret", nil, map[string]interface{}{
+				"path": endpoint.Path,
+			})
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if reason := s.Validate(r); reason != "" {
+			LogAudit("Request with invalid signed URL", map[string]interface{}{
+				"path":        r.URL.Path,
+				"reason":      reason,
+				"remote_addr": r.RemoteAddr,
+			})
+			http.Error(w, "Forbidden: "+reason+" URL", http.StatusForbidden)
+			return
+		}
+
+		query := r.URL.Query()
+		query.Del(s.config.ExpiresParam)
+		query.Del(s.config.SignatureParam)
+		r.URL.RawQuery = query.Encode()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SignURLRequest is a request to sign a URL through the admin API
+type SignURLRequest struct {
+	// URL is the path, with an optional query, to sign
+	URL string `json:"url"`
+	// TTL is the lifetime of the signed URL in milliseconds
+	TTL int `json:"ttl"`
+}
+
+// handleSignURL signs a URL for temporary access
+func (g *Gateway) handleSignURL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if g.signer.config.Secret == "" {
+		http.Error(w, "Signed URLs are not configured", http.StatusNotFound)
+		return
+	}
+
+	var request SignURLRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid sign request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.URL == "" || request.TTL <= 0 || request.TTL > g.signer.config.MaxTTL {
+		http.Error(w, "Invalid sign request: a URL and a TTL up to "+strconv.Itoa(g.signer.config.MaxTTL)+" ms are required", http.StatusBadRequest)
+		return
+	}
+
+	expires := g.signer.now().Add(time.Duration(request.TTL) * time.Millisecond)
+	signed, err := g.signer.Sign(request.URL, expires)
+	if err != nil {
+		http.Error(w, "Invalid sign request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"url":     signed,
+		"expires": expires.UTC().Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSignedURLs tests that endpoints with signed_urls only serve valid, unexpired signed URLs
+func TestSignedURLs(t *testing.T) {
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.RawQuery))
+	}))
+	defer backendServer.Close()
+
+	gateway := NewGateway(Config{
+		Endpoints:  []Endpoint{{Path: "/downloads/", Backend: backendServer.URL, SignedURLs: true}},
+		SignedURLs: SignedURLConfig{Secret: "secret"},
+		Admin:      AdminConfig{Enabled: true},
+	}, nil)
+	now := time.Unix(1000, 0)
+	gateway.signer.now = func() time.Time { return now }
+	gateway.RegisterEndpoints()
+	gateway.RegisterAdminEndpoints()
+
+	// Sign a URL through the admin API
+	rr := httptest.NewRecorder()
+	gateway.mux.ServeHTTP(rr, httptest.NewRequest("POST", "/admin/signed-urls", strings.NewReader(`{"url": "/downloads/report.pdf?version=2", "ttl": 60000}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 signing a URL, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var signed struct {
+		URL string `json:"url"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&signed); err != nil {
+		t.Fatal(err)
+	}
+
+	// The signed URL is served without the signature parameters
+	rr = httptest.NewRecorder()
+	gateway.mux.ServeHTTP(rr, httptest.NewRequest("GET", signed.URL, nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "version=2" {
+		t.Errorf("Expected status 200 with the original query, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{"unsigned", "/downloads/report.pdf"},
+		{"other path", strings.Replace(signed.URL, "report.pdf", "secret.pdf", 1)},
+		{"extended expiry", strings.Replace(signed.URL, "expires=1060", "expires=9999", 1)},
+		{"changed query parameter", strings.Replace(signed.URL, "version=2", "version=3", 1)},
+		{"added query parameter", signed.URL + "&admin=true"},
+	}
+	for _, tt := range tests {
+		rr = httptest.NewRecorder()
+		gateway.mux.ServeHTTP(rr, httptest.NewRequest("GET", tt.url, nil))
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("%s: expected status 403, got %d", tt.name, rr.Code)
+		}
+	}
+
+	// The URL expires
+	now = now.Add(time.Minute)
+	rr = httptest.NewRecorder()
+	gateway.mux.ServeHTTP(rr, httptest.NewRequest("GET", signed.URL, nil))
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "expired") {
+		t.Errorf("Expected expired URL to be rejected, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	// TTLs above the maximum are rejected
+	rr = httptest.NewRecorder()
+	gateway.mux.ServeHTTP(rr, httptest.NewRequest("POST", "/admin/signed-urls", strings.NewReader(`{"url": "/downloads/a", "ttl": 999999999}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a TTL above the maximum, got %d", rr.Code)
+	}
+}
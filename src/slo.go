@@ -0,0 +1,246 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Default SLO settings
+const (
+	defaultSLOWindow            = 3600000
+	defaultSLOBurnRateThreshold = 14.4
+	// sloMinRequests is the minimum number of requests in the window before burn rate alerts fire
+	sloMinRequests = 20
+	// sloBuckets is the number of buckets the SLO window is divided into
+	sloBuckets = 60
+)
+
+// EndpointSLOConfig represents the service level objective of an endpoint
+type EndpointSLOConfig struct {
+	// Target is the share of good requests to achieve, e.g. 0.999 (SLO tracking is disabled if 0)
+	Target float64 `json:"target"`
+	// LatencyThreshold is the duration in milliseconds above which a request counts as bad (0 disables it)
+	LatencyThreshold int `json:"latency_threshold"`
+	// Window is the time window in milliseconds over which the burn rate is computed (default 3600000)
+	Window int `json:"window"`
+	// BurnRateThreshold is the burn rate above which an alert fires (default 14.4)
+	BurnRateThreshold float64 `json:"burn_rate_threshold"`
+	// WebhookURL receives a JSON notification when an alert fires or resolves
+	WebhookURL string `json:"webhook_url"`
+}
+
+// withDefaults returns the SLO config with defaults applied
+func (c EndpointSLOConfig) withDefaults() EndpointSLOConfig {
+	if c.Window <= 0 {
+		c.Window = defaultSLOWindow
+	}
+	if c.BurnRateThreshold <= 0 {
+		c.BurnRateThreshold = defaultSLOBurnRateThreshold
+	}
+	return c
+}
+
+// SLOStatus reports the current state of an endpoint SLO
+type SLOStatus struct {
+	Endpoint     string  `json:"endpoint"`
+	Target       float64 `json:"target"`
+	Requests     int64   `json:"requests"`
+	BadRequests  int64   `json:"bad_requests"`
+	Availability float64 `json:"availability"`
+	BurnRate     float64 `json:"burn_rate"`
+	Alerting     bool    `json:"alerting"`
+}
+
+// sloBucket counts the requests of a part of the SLO window
+type sloBucket struct {
+	start     time.Time
+	good, bad int64
+}
+
+// sloWindow tracks the requests of an endpoint over the SLO window
+type sloWindow struct {
+	config   EndpointSLOConfig
+	buckets  [sloBuckets]sloBucket
+	alerting bool
+}
+
+// SLOTracker tracks the error budget burn rate of endpoints with an SLO and alerts when it is too high
+type SLOTracker struct {
+	mu        sync.Mutex
+	windows   map[string]*sloWindow
+	telemetry *TelemetryManager
+	notifier  *Notifier
+	client    *http.Client
+	now       func() time.Time
+}
+
+// NewSLOTracker creates a new SLOTracker for the endpoints with an SLO
+func NewSLOTracker(endpoints []Endpoint, telemetry *TelemetryManager, notifier *Notifier) *SLOTracker {
+	t := &SLOTracker{
+		windows:   make(map[string]*sloWindow),
+		telemetry: telemetry,
+		notifier:  notifier,
+		client:    &http.Client{Timeout: 5 * time.Second},
+		now:       time.Now,
+	}
+	for _, endpoint := range endpoints {
+		if endpoint.SLO.Target > 0 {
+			t.windows[endpoint.Path] = &sloWindow{config: endpoint.SLO.withDefaults()}
+		}
+	}
+
+	// Export the burn rates as a gauge
+	if telemetry != nil && len(t.windows) > 0 {
+		if err := telemetry.RegisterBurnRateGauge(t.BurnRates); err != nil {
+			LogError("Failed to register SLO burn rate gauge", err, nil)
+		}
+	}
+	return t
+}
+
+// Middleware records whether the requests of an endpoint with an SLO meet it
+func (t *SLOTracker) Middleware(endpoint Endpoint, next http.Handler) http.Handler {
+	if endpoint.SLO.Target <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startTime := time.Now()
+		lrw := NewLoggingResponseWriter(w)
+		lrw.bodyLimit = 0
+		next.ServeHTTP(lrw, r)
+
+		// Server errors and slow requests consume the error budget
+		good := lrw.statusCode < 500
+		if threshold := endpoint.SLO.LatencyThreshold; threshold > 0 && time.Since(startTime) > time.Duration(threshold)*time.Millisecond {
+			good = false
+		}
+		t.Record(endpoint.Path, good)
+	})
+}
+
+// Record records a good or bad request of an endpoint and fires or resolves its burn rate alert
+func (t *SLOTracker) Record(path string, good bool) {
+	t.mu.Lock()
+	window, ok := t.windows[path]
+	if !ok {
+		t.mu.Unlock()
+		return
+	}
+
+	// Count the request in the bucket of the current time, resetting buckets of a previous window
+	now := t.now()
+	bucketSize := time.Duration(window.config.Window) * time.Millisecond / sloBuckets
+	start := now.Truncate(bucketSize)
+	bucket := &window.buckets[(start.UnixNano()/int64(bucketSize))%sloBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = sloBucket{start: start}
+	}
+	if good {
+		bucket.good++
+	} else {
+		bucket.bad++
+	}
+
+	status := t.status(path, window, now)
+	firing := status.Requests >= sloMinRequests && status.BurnRate >= window.config.BurnRateThreshold
+	changed := firing != window.alerting
+	window.alerting = firing
+	status.Alerting = firing
+	t.mu.Unlock()
+
+	if changed {
+		t.alert(window.config, status)
+	}
+}
+
+// status computes the SLO status of an endpoint, the caller must hold the lock
+func (t *SLOTracker) status(path string, window *sloWindow, now time.Time) SLOStatus {
+	status := SLOStatus{Endpoint: path, Target: window.config.Target, Availability: 1, Alerting: window.alerting}
+	windowStart := now.Add(-time.Duration(window.config.Window) * time.Millisecond)
+	for _, bucket := range window.buckets {
+		if bucket.start.After(windowStart) {
+			status.Requests += bucket.good + bucket.bad
+			status.BadRequests += bucket.bad
+		}
+	}
+
+	// The burn rate is the error rate relative to the error rate the SLO allows
+	if status.Requests > 0 {
+		errorRate := float64(status.BadRequests) / float64(status.Requests)
+		status.Availability = 1 - errorRate
+		if budget := 1 - window.config.Target; budget > 0 {
+			status.BurnRate = errorRate / budget
+		}
+	}
+	return status
+}
+
+// Statuses returns the SLO status of all endpoints with an SLO
+func (t *SLOTracker) Statuses() []SLOStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	statuses := make([]SLOStatus, 0, len(t.windows))
+	for path, window := range t.windows {
+		statuses = append(statuses, t.status(path, window, now))
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Endpoint < statuses[j].Endpoint })
+	return statuses
+}
+
+// BurnRates returns the current burn rate of all endpoints with an SLO
+func (t *SLOTracker) BurnRates() map[string]float64 {
+	burnRates := make(map[string]float64)
+	for _, status := range t.Statuses() {
+		burnRates[status.Endpoint] = status.BurnRate
+	}
+	return burnRates
+}
+
+// alert logs a fired or resolved burn rate alert and sends it to the notification webhooks and the SLO webhook
+func (t *SLOTracker) alert(config EndpointSLOConfig, status SLOStatus) {
+	state, message := "resolved", "SLO burn rate recovered"
+	details := map[string]interface{}{
+		"endpoint":     status.Endpoint,
+		"burn_rate":    status.BurnRate,
+		"availability": status.Availability,
+		"target":       status.Target,
+	}
+	if status.Alerting {
+		state, message = "firing", "SLO error budget burning too fast"
+		LogWarn(message, details)
+	} else {
+		LogInfo(message, details)
+	}
+	details["state"] = state
+	t.notifier.Notify(Event{Type: EventSLOBurnRate, Message: message, Details: details})
+
+	if config.WebhookURL == "" {
+		return
+	}
+	go func() {
+		if err := postWebhook(t.client, config.WebhookURL, nil, map[string]interface{}{
+			"event":  EventSLOBurnRate,
+			"state":  state,
+			"status": status,
+		}); err != nil {
+			LogError("Failed to send SLO alert", err, map[string]interface{}{
+				"endpoint": status.Endpoint,
+			})
+		}
+	}()
+}
+
+// handleSLO returns the SLO status of all endpoints with an SLO
+func (g *Gateway) handleSLO(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, g.slo.Statuses())
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestSLOTracker tests the burn rate computation and the alerts sent to the webhook
+func TestSLOTracker(t *testing.T) {
+	var mu sync.Mutex
+	var states []string
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			State string `json:"state"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		mu.Lock()
+		defer mu.Unlock()
+		states = append(states, payload.State)
+	}))
+	defer webhookServer.Close()
+
+	tracker := NewSLOTracker([]Endpoint{
+		{Path: "/api/users", SLO: EndpointSLOConfig{Target: 0.99, Window: 60000, BurnRateThreshold: 5, WebhookURL: webhookServer.URL}},
+	}, nil, nil)
+	now := time.Unix(1000, 0)
+	tracker.now = func() time.Time { return now }
+
+	// 10% errors burn the 1% error budget 10 times too fast
+	for i := 0; i < 100; i++ {
+		tracker.Record("/api/users", i%10 != 0)
+	}
+	status := tracker.Statuses()[0]
+	if status.Requests != 100 || status.BadRequests != 10 || status.BurnRate < 9.99 || status.BurnRate > 10.01 || !status.Alerting {
+		t.Fatalf("Unexpected SLO status %+v", status)
+	}
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(states) == 1 && states[0] == "firing"
+	})
+
+	// The alert resolves once the errors have left the window
+	now = now.Add(time.Minute)
+	tracker.Record("/api/users", true)
+	if status := tracker.Statuses()[0]; status.Requests != 1 || status.BurnRate != 0 || status.Alerting {
+		t.Errorf("Expected the errors to leave the window, got %+v", status)
+	}
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(states) == 2 && states[1] == "resolved"
+	})
+}
+
+// TestSLOMiddleware tests that server errors and slow requests count as bad requests
+func TestSLOMiddleware(t *testing.T) {
+	endpoint := Endpoint{Path: "/api", SLO: EndpointSLOConfig{Target: 0.9, LatencyThreshold: 20}}
+	tracker := NewSLOTracker([]Endpoint{endpoint}, nil, nil)
+
+	handler := tracker.Middleware(endpoint, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("case") {
+		case "error":
+			w.WriteHeader(http.StatusBadGateway)
+		case "slow":
+			time.Sleep(30 * time.Millisecond)
+		case "client_error":
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	for _, c := range []string{"ok", "error", "slow", "client_error"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api?case="+c, nil))
+	}
+
+	if status := tracker.Statuses()[0]; status.Requests != 4 || status.BadRequests != 2 {
+		t.Errorf("Expected 2 bad requests of 4, got %+v", status)
+	}
+}
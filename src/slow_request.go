@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// logSlowRequest logs a request exceeding the slow request threshold of the endpoint with a breakdown
+// of where the time was spent, and counts it
+func (p *Proxy) logSlowRequest(lrw *LoggingResponseWriter, r *http.Request, duration time.Duration, attempts *UpstreamAttempts) {
+	threshold := time.Duration(p.endpoint.SlowRequestThreshold) * time.Millisecond
+	if threshold <= 0 || duration <= threshold {
+		return
+	}
+
+	// The gateway time is what is left besides waiting for the backend and transferring the response,
+	// e.g. the middlewares and reading a buffered request body
+	transfer := lrw.TransferDuration()
+	gateway := max(duration-attempts.Duration-transfer, 0)
+	LogWarn("Slow request", map[string]interface{}{
+		"path":          r.URL.Path,
+		"route":         p.endpoint.Path,
+		"method":        r.Method,
+		"status_code":   lrw.statusCode,
+		"duration_ms":   duration.Milliseconds(),
+		"threshold_ms":  threshold.Milliseconds(),
+		"upstream_ms":   attempts.Duration.Milliseconds(),
+		"transfer_ms":   transfer.Milliseconds(),
+		"gateway_ms":    gateway.Milliseconds(),
+		"backend":       attempts.Backend,
+		"attempts":      attempts.Count,
+		"retry_reasons": attempts.RetryReasons,
+	})
+
+	if p.telemetry != nil {
+		p.telemetry.RecordSlowRequest(r.Context(), metricsRoute(p.endpoint), r.Method)
+	}
+}
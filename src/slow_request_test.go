@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSlowRequestLogging tests that requests above the threshold are logged with a timing breakdown
+func TestSlowRequestLogging(t *testing.T) {
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("slow") != "" {
+			time.Sleep(60 * time.Millisecond)
+		}
+		_, _ = w.Write([]byte("OK"))
+	}))
+	defer backendServer.Close()
+
+	var logs bytes.Buffer
+	SetLogOutput(&logs)
+	defer SetLogOutput(os.Stdout)
+
+	handler := NewProxy(Endpoint{
+		Path:                 "/test",
+		Backend:              backendServer.URL,
+		SlowRequestThreshold: 50,
+	}, false, nil).Handler()
+
+	slowEntries := func() []LogEntry {
+		var entries []LogEntry
+		for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+			var entry LogEntry
+			if err := json.Unmarshal([]byte(line), &entry); err == nil && entry.Message == "Slow request" {
+				entries = append(entries, entry)
+			}
+		}
+		return entries
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/test", nil))
+	if entries := slowEntries(); len(entries) != 0 {
+		t.Fatalf("expected a fast request not to be logged as slow, got %v", entries)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/test?slow=1", nil))
+	entries := slowEntries()
+	if len(entries) != 1 {
+		t.Fatalf("expected one slow request entry, got %d", len(entries))
+	}
+	entry := entries[0]
+	if entry.Level != "warn" || entry.Additional["route"] != "/test" || entry.Additional["attempts"] != float64(1) {
+		t.Errorf("unexpected slow request entry: %+v", entry)
+	}
+	if upstream, _ := entry.Additional["upstream_ms"].(float64); upstream < 50 {
+		t.Errorf("expected the upstream time to account for the backend latency, got %v", entry.Additional["upstream_ms"])
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// StatusMapping represents the response answered to the client in place of a backend response with a given
+// status, e.g. 204 for a backend 404 or the cached response for a backend 503
+type StatusMapping struct {
+	// Status is the status answered to the client (the backend status if 0)
+	Status int `json:"status"`
+	// Body replaces the backend response body; the body is dropped if the status does not allow one, e.g. 204
+	Body string `json:"body"`
+	// ContentType is the content type of the body (default text/plain; charset=utf-8)
+	ContentType string `json:"content_type"`
+	// Fallback answers with the cached response of the request instead, even if stale, when the endpoint
+	// caches its responses and one is cached; the mapping applies otherwise
+	Fallback bool `json:"fallback"`
+}
+
+// validateStatusMappings checks the status mappings of an endpoint
+func validateStatusMappings(mappings map[int]StatusMapping) error {
+	for upstream, mapping := range mappings {
+		if upstream < 100 || upstream > 599 {
+			return fmt.Errorf("invalid mapped backend status %d", upstream)
+		}
+		if mapping.Status != 0 && (mapping.Status < 200 || mapping.Status > 599) {
+			return fmt.Errorf("invalid status %d mapped from %d", mapping.Status, upstream)
+		}
+	}
+	return nil
+}
+
+// remapStatus replaces a backend response with the response of its status mapping
+func (p *Proxy) remapStatus(resp *http.Response, r *http.Request, mapping StatusMapping) {
+	upstreamStatus := resp.StatusCode
+
+	// Answer with the cached response, which must not be stored again by the client or the cache
+	if mapping.Fallback {
+		if entry := p.cache.fallback(p.endpoint, r); entry != nil {
+			resp.Body.Close()
+			resp.StatusCode = entry.status
+			resp.Status = fmt.Sprintf("%d %s", entry.status, http.StatusText(entry.status))
+			resp.Header = entry.header.Clone()
+			resp.Header.Set("Age", strconv.Itoa(int(time.Since(entry.storedAt).Seconds())))
+			resp.Header.Set("Cache-Control", "no-store")
+			resp.Header.Set("X-Cache", "FALLBACK")
+			resp.Body = io.NopCloser(bytes.NewReader(entry.body))
+			resp.ContentLength = int64(len(entry.body))
+			resp.Header.Set("Content-Length", strconv.Itoa(len(entry.body)))
+			LogWarn("Cached fallback served for backend response", map[string]interface{}{
+				"path":            r.URL.Path,
+				"method":          r.Method,
+				"upstream_status": upstreamStatus,
+			})
+			return
+		}
+	}
+
+	if mapping.Status != 0 {
+		resp.StatusCode = mapping.Status
+		resp.Status = fmt.Sprintf("%d %s", mapping.Status, http.StatusText(mapping.Status))
+	}
+	switch {
+	case !bodyAllowedForStatus(resp.StatusCode):
+		resp.Body.Close()
+		resp.Body = http.NoBody
+		resp.ContentLength = 0
+		resp.Header.Del("Content-Length")
+		resp.Header.Del("Content-Type")
+		resp.Header.Del("Content-Encoding")
+	case mapping.Body != "":
+		contentType := mapping.ContentType
+		if contentType == "" {
+			contentType = defaultCustomResponseContentType
+		}
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader([]byte(mapping.Body)))
+		resp.ContentLength = int64(len(mapping.Body))
+		resp.Header.Set("Content-Length", strconv.Itoa(len(mapping.Body)))
+		resp.Header.Set("Content-Type", contentType)
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("ETag")
+	}
+	if p.debug {
+		LogInfo("Backend status remapped", map[string]interface{}{
+			"path":            r.URL.Path,
+			"method":          r.Method,
+			"upstream_status": upstreamStatus,
+			"status":          resp.StatusCode,
+		})
+	}
+}
+
+// bodyAllowedForStatus reports whether a response with the given status may have a body
+func bodyAllowedForStatus(status int) bool {
+	return !(status >= 100 && status <= 199) && status != http.StatusNoContent && status != http.StatusNotModified
+}
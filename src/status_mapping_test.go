@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// TestStatusMappings tests that backend statuses are remapped, and answered with the cached response if configured
+func TestStatusMappings(t *testing.T) {
+	var failing atomic.Bool
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/missing":
+			http.Error(w, "not found", http.StatusNotFound)
+		case r.URL.Path == "/teapot":
+			w.WriteHeader(http.StatusTeapot)
+		case failing.Load():
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		default:
+			w.Header().Set("Cache-Control", "max-age=0")
+			w.Header().Set("ETag", `"v1"`)
+			_, _ = w.Write([]byte("report"))
+		}
+	}))
+	defer backendServer.Close()
+
+	endpoint := Endpoint{
+		Path:    "/",
+		Backend: backendServer.URL,
+		Cache:   EndpointCacheConfig{Enabled: true},
+		StatusMappings: map[int]StatusMapping{
+			http.StatusNotFound:           {Status: http.StatusNoContent},
+			http.StatusTeapot:             {Status: http.StatusBadGateway, Body: `{"error":"upstream"}`, ContentType: "application/json"},
+			http.StatusServiceUnavailable: {Fallback: true, Body: "try later"},
+		},
+	}
+	if err := validateStatusMappings(endpoint.StatusMappings); err != nil {
+		t.Fatalf("expected valid mappings, got %v", err)
+	}
+	proxy := NewProxy(endpoint, false, nil)
+	cache := NewResponseCache(CacheConfig{}, nil)
+	proxy.SetResponseCache(cache)
+	handler := cache.Middleware(endpoint, proxy.Handler())
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", target, nil))
+		return rr
+	}
+
+	if rr := serve("/missing"); rr.Code != http.StatusNoContent || rr.Body.Len() != 0 {
+		t.Errorf("expected 204 without a body, got %d %q", rr.Code, rr.Body.String())
+	}
+	if rr := serve("/teapot"); rr.Code != http.StatusBadGateway || rr.Body.String() != `{"error":"upstream"}` || rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected the mapped 502 body, got %d %q", rr.Code, rr.Body.String())
+	}
+	if rr := serve("/report"); rr.Code != http.StatusOK {
+		t.Fatalf("expected the report, got %d", rr.Code)
+	}
+
+	failing.Store(true)
+	rr := serve("/report")
+	if rr.Code != http.StatusOK || rr.Body.String() != "report" || rr.Header().Get("X-Cache") != "FALLBACK" || rr.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("expected the cached fallback, got %d %q with X-Cache %q", rr.Code, rr.Body.String(), rr.Header().Get("X-Cache"))
+	}
+	if rr := serve("/other"); rr.Code != http.StatusServiceUnavailable || rr.Body.String() != "try later" {
+		t.Errorf("expected the mapping without a cached response, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	if err := validateStatusMappings(map[int]StatusMapping{404: {Status: 99}}); err == nil {
+		t.Error("expected an invalid status to be rejected")
+	}
+}
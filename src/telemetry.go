@@ -4,13 +4,11 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"net/url"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
 	"go.opentelemetry.io/otel/exporters/prometheus"
 	"go.opentelemetry.io/otel/metric"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
@@ -18,6 +16,12 @@ import (
 	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 )
 
+// Metric exporters
+const (
+	exporterPrometheus = "prometheus"
+	exporterOTLP       = "otlp"
+)
+
 // TelemetryManager handles OpenTelemetry metrics
 type TelemetryManager struct {
 	config           TelemetryConfig
@@ -26,6 +30,32 @@ type TelemetryManager struct {
 	requestCounter   metric.Int64Counter
 	latencyHistogram metric.Float64Histogram
 	errorCounter     metric.Int64Counter
+	wafHitCounter    metric.Int64Counter
+	retryCounter     metric.Int64Counter
+	ejectionCounter  metric.Int64Counter
+	cacheCounter     metric.Int64Counter
+	requestSize      metric.Int64Histogram
+	responseSize     metric.Int64Histogram
+	transferDuration metric.Float64Histogram
+	upstreamAttempts metric.Int64Histogram
+	uploadBytes      metric.Int64Counter
+	activeUploads    metric.Int64UpDownCounter
+	slowRequests     metric.Int64Counter
+	upstreamTiming   metric.Float64Histogram
+	limitRejections  metric.Int64Counter
+	shedRequests     metric.Int64Counter
+	routeCache       metric.Int64Counter
+	experiments      metric.Int64Counter
+	clientCanceled   metric.Int64Counter
+	maskedFields     metric.Int64Counter
+	connAcquired     metric.Int64Counter
+	connClosed       metric.Int64Counter
+	connOpen         metric.Int64UpDownCounter
+	connIdle         metric.Int64UpDownCounter
+	rejectedConns    metric.Int64Counter
+	certReloads      metric.Int64Counter
+	authFailures     metric.Int64Counter
+	rateLimited      metric.Int64Counter
 	promHandler      http.Handler
 }
 
@@ -41,48 +71,41 @@ func NewTelemetryManager(config TelemetryConfig) (*TelemetryManager, error) {
 		semconv.ServiceName(config.ServiceName),
 	)
 
-	// Create Prometheus exporter
-	promExporter, err := prometheus.New()
+	prometheusEnabled, otlpEnabled, err := telemetryExporters(config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create Prometheus exporter: %w", err)
+		return nil, err
 	}
+	options := []sdkmetric.Option{sdkmetric.WithResource(res)}
 
-	// Create OTLP exporter for remote metrics collection
-	// Parse the metrics URL to extract host and port
-	metricsURL, err := url.Parse(config.MetricsURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse metrics URL: %w", err)
+	// Create Prometheus exporter for scraping
+	var promHandler http.Handler
+	if prometheusEnabled {
+		promExporter, err := prometheus.New()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Prometheus exporter: %w", err)
+		}
+		options = append(options, sdkmetric.WithReader(promExporter))
+		promHandler = promhttp.Handler()
 	}
 
-	// Validate URL scheme (must be http or https)
-	if metricsURL.Scheme != "http" && metricsURL.Scheme != "https" {
-		return nil, fmt.Errorf("invalid metrics URL scheme: %s (must be http or https)", metricsURL.Scheme)
+	// Create OTLP exporter for remote metrics collection
+	// The exporter is created on the first export, so an unavailable collector does not prevent startup
+	var otlpExporter *resilientExporter
+	if otlpEnabled {
+		if err := validateOTLPConfig(config); err != nil {
+			return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+		otlpExporter = newResilientExporter(config)
+		if _, err := otlpExporter.current(context.Background()); err != nil {
+			LogError("Failed to create OTLP exporter, retrying in the background", err, nil)
+		}
+		options = append(options, sdkmetric.WithReader(
+			sdkmetric.NewPeriodicReader(otlpExporter, exportIntervalOptions(config)...),
+		))
 	}
 
-	// Extract host and port (without path)
-	endpoint := metricsURL.Host
-
-	otlpExporter, err := otlpmetrichttp.New(
-		context.Background(),
-		otlpmetrichttp.WithEndpoint(endpoint),
-		otlpmetrichttp.WithInsecure(),
-		otlpmetrichttp.WithTimeout(time.Duration(config.ExportTimeout)*time.Millisecond),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
-	}
-
-	// Create meter provider with both exporters
-	meterProvider := sdkmetric.NewMeterProvider(
-		sdkmetric.WithReader(promExporter),
-		sdkmetric.WithReader(
-			sdkmetric.NewPeriodicReader(
-				otlpExporter,
-				sdkmetric.WithInterval(5*time.Second),
-			),
-		),
-		sdkmetric.WithResource(res),
-	)
+	// Create meter provider with the enabled exporters
+	meterProvider := sdkmetric.NewMeterProvider(options...)
 
 	// Set global meter provider
 	otel.SetMeterProvider(meterProvider)
@@ -116,8 +139,248 @@ func NewTelemetryManager(config TelemetryConfig) (*TelemetryManager, error) {
 		return nil, fmt.Errorf("failed to create error counter: %w", err)
 	}
 
-	// Create Prometheus HTTP handler
-	promHandler := promhttp.Handler()
+	wafHitCounter, err := meter.Int64Counter(
+		"waf.rule.hits",
+		metric.WithDescription("Number of requests matched by WAF rules"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create WAF hit counter: %w", err)
+	}
+
+	retryCounter, err := meter.Int64Counter(
+		"http.upstream.retries",
+		metric.WithDescription("Number of upstream retries, including retries rejected by the retry budget"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create retry counter: %w", err)
+	}
+
+	ejectionCounter, err := meter.Int64Counter(
+		"http.upstream.ejections",
+		metric.WithDescription("Number of backend instances ejected by outlier detection"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ejection counter: %w", err)
+	}
+
+	cacheCounter, err := meter.Int64Counter(
+		"http.cache.requests",
+		metric.WithDescription("Number of requests to endpoints with caching enabled by cache result"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache counter: %w", err)
+	}
+
+	requestSize, err := meter.Int64Histogram(
+		"http.request.body.size",
+		metric.WithDescription("HTTP request body size in bytes"),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request size histogram: %w", err)
+	}
+
+	responseSize, err := meter.Int64Histogram(
+		"http.response.body.size",
+		metric.WithDescription("HTTP response body size in bytes"),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create response size histogram: %w", err)
+	}
+
+	transferDuration, err := meter.Float64Histogram(
+		"http.response.transfer.duration",
+		metric.WithDescription("Time in milliseconds from the first response byte to the end of the response"),
+		metric.WithUnit("ms"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transfer duration histogram: %w", err)
+	}
+
+	upstreamAttempts, err := meter.Int64Histogram(
+		"http.upstream.attempts",
+		metric.WithDescription("Number of upstream attempts per request by backend instance"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upstream attempts histogram: %w", err)
+	}
+
+	uploadBytes, err := meter.Int64Counter(
+		"http.request.body.received",
+		metric.WithDescription("Request body bytes received, counted as they are streamed to the backend"),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload bytes counter: %w", err)
+	}
+
+	activeUploads, err := meter.Int64UpDownCounter(
+		"http.request.uploads.active",
+		metric.WithDescription("Number of requests whose body is being received"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create active uploads counter: %w", err)
+	}
+
+	slowRequests, err := meter.Int64Counter(
+		"http.server.slow_requests",
+		metric.WithDescription("Number of requests exceeding the slow request threshold of their endpoint"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create slow requests counter: %w", err)
+	}
+
+	upstreamTiming, err := meter.Float64Histogram(
+		"http.upstream.phase.duration",
+		metric.WithDescription("Duration of the phases of upstream requests in milliseconds by backend host"),
+		metric.WithUnit("ms"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upstream timing histogram: %w", err)
+	}
+
+	limitRejections, err := meter.Int64Counter(
+		"http.upstream.concurrency_rejected",
+		metric.WithDescription("Number of upstream requests rejected by the adaptive concurrency limit by backend host"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create concurrency rejection counter: %w", err)
+	}
+
+	shedRequests, err := meter.Int64Counter(
+		"http.server.shed_requests",
+		metric.WithDescription("Number of requests shed by priority while the gateway is overloaded"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create shed requests counter: %w", err)
+	}
+
+	routeCache, err := meter.Int64Counter(
+		"http.server.route_cache",
+		metric.WithDescription("Number of route cache lookups by result (hit or miss)"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create route cache counter: %w", err)
+	}
+
+	experiments, err := meter.Int64Counter(
+		"http.server.experiment_assignments",
+		metric.WithDescription("Number of requests assigned to each experiment variant"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create experiment assignments counter: %w", err)
+	}
+
+	clientCanceled, err := meter.Int64Counter(
+		"http.server.client_canceled",
+		metric.WithDescription("Number of requests abandoned by the client before the response was complete"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client canceled counter: %w", err)
+	}
+
+	maskedFields, err := meter.Int64Counter(
+		"http.response.masked_fields",
+		metric.WithDescription("Number of sensitive response fields masked, hashed or dropped"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create masked fields counter: %w", err)
+	}
+
+	connAcquired, err := meter.Int64Counter(
+		"http.client.connection.acquisitions",
+		metric.WithDescription("Number of upstream requests by whether they reused an existing connection"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection acquisitions counter: %w", err)
+	}
+
+	connClosed, err := meter.Int64Counter(
+		"http.client.connection.closed",
+		metric.WithDescription("Number of upstream connections closed"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create closed connections counter: %w", err)
+	}
+
+	connOpen, err := meter.Int64UpDownCounter(
+		"http.client.connection.open",
+		metric.WithDescription("Number of open upstream connections"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create open connections counter: %w", err)
+	}
+
+	connIdle, err := meter.Int64UpDownCounter(
+		"http.client.connection.idle",
+		metric.WithDescription("Number of upstream connections waiting in the idle pool"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create idle connections counter: %w", err)
+	}
+
+	rejectedConns, err := meter.Int64Counter(
+		"http.server.connections.rejected",
+		metric.WithDescription("Number of client connections closed because of a connection limit"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rejected connections counter: %w", err)
+	}
+
+	certReloads, err := meter.Int64Counter(
+		"tls.certificate.reloads",
+		metric.WithDescription("Number of listener certificate reloads"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate reloads counter: %w", err)
+	}
+
+	authFailures, err := meter.Int64Counter(
+		"http.server.auth.failures",
+		metric.WithDescription("Number of requests failing authentication, counted by the auth lockouts"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create auth failures counter: %w", err)
+	}
+
+	rateLimited, err := meter.Int64Counter(
+		"http.server.rate_limited",
+		metric.WithDescription("Number of requests rejected by the rate limits of the endpoints"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rate limited requests counter: %w", err)
+	}
+
+	// Count the log lines dropped by the asynchronous log queue
+	_, err = meter.Int64ObservableCounter(
+		"log.dropped",
+		metric.WithDescription("Number of log lines dropped because the asynchronous log queue was full"),
+		metric.WithInt64Callback(func(ctx context.Context, observer metric.Int64Observer) error {
+			observer.Observe(logLinesDropped.Load())
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dropped logs counter: %w", err)
+	}
+
+	// Count the OTLP exports by outcome
+	if otlpExporter != nil {
+		_, err = meter.Int64ObservableCounter(
+			"otlp.exports",
+			metric.WithDescription("Number of metric exports over OTLP by outcome"),
+			metric.WithInt64Callback(func(ctx context.Context, observer metric.Int64Observer) error {
+				successes, failures := otlpExporter.Stats()
+				observer.Observe(successes, metric.WithAttributes(attribute.String("export.outcome", "success")))
+				observer.Observe(failures, metric.WithAttributes(attribute.String("export.outcome", "failure")))
+				return nil
+			}),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create export counter: %w", err)
+		}
+	}
 
 	return &TelemetryManager{
 		config:           config,
@@ -126,10 +389,54 @@ func NewTelemetryManager(config TelemetryConfig) (*TelemetryManager, error) {
 		requestCounter:   requestCounter,
 		latencyHistogram: latencyHistogram,
 		errorCounter:     errorCounter,
+		wafHitCounter:    wafHitCounter,
+		retryCounter:     retryCounter,
+		ejectionCounter:  ejectionCounter,
+		cacheCounter:     cacheCounter,
+		requestSize:      requestSize,
+		responseSize:     responseSize,
+		transferDuration: transferDuration,
+		upstreamAttempts: upstreamAttempts,
+		uploadBytes:      uploadBytes,
+		activeUploads:    activeUploads,
+		slowRequests:     slowRequests,
+		upstreamTiming:   upstreamTiming,
+		limitRejections:  limitRejections,
+		shedRequests:     shedRequests,
+		routeCache:       routeCache,
+		experiments:      experiments,
+		clientCanceled:   clientCanceled,
+		maskedFields:     maskedFields,
+		connAcquired:     connAcquired,
+		connClosed:       connClosed,
+		connOpen:         connOpen,
+		connIdle:         connIdle,
+		rejectedConns:    rejectedConns,
+		certReloads:      certReloads,
+		authFailures:     authFailures,
+		rateLimited:      rateLimited,
 		promHandler:      promHandler,
 	}, nil
 }
 
+// telemetryExporters returns whether the Prometheus and OTLP exporters are enabled
+func telemetryExporters(config TelemetryConfig) (prometheusEnabled, otlpEnabled bool, err error) {
+	if len(config.Exporters) == 0 {
+		return true, config.MetricsURL != "" || otlpEndpointFromEnv(), nil
+	}
+	for _, exporter := range config.Exporters {
+		switch exporter {
+		case exporterPrometheus:
+			prometheusEnabled = true
+		case exporterOTLP:
+			otlpEnabled = true
+		default:
+			return false, false, fmt.Errorf("invalid metrics exporter: %s (must be prometheus or otlp)", exporter)
+		}
+	}
+	return prometheusEnabled, otlpEnabled, nil
+}
+
 // RecordRequest records metrics for an HTTP request
 func (tm *TelemetryManager) RecordRequest(ctx context.Context, path, method string, statusCode int, durationMs float64) {
 	if !tm.config.Enabled {
@@ -139,20 +446,390 @@ func (tm *TelemetryManager) RecordRequest(ctx context.Context, path, method stri
 	// Create attributes
 	attrs := []attribute.KeyValue{
 		attribute.String("http.route", path),
-		attribute.String("http.method", method),
+		attribute.String("http.method", metricsMethod(method)),
 		attribute.Int("http.status_code", statusCode),
 	}
+	attrs = append(attrs, MetricAttributesFromContext(ctx)...)
 
 	// Record metrics
 	tm.requestCounter.Add(ctx, 1, metric.WithAttributes(attrs...))
 	tm.latencyHistogram.Record(ctx, durationMs, metric.WithAttributes(attrs...))
 
-	// Record errors (status code >= 400)
+	// Record errors (status code >= 400), labeled with the failure class if the backend did not answer.
+	// Requests canceled by the client are counted apart, they are not errors of the gateway or the backend.
+	attempts := UpstreamAttemptsFromContext(ctx)
+	if attempts != nil && attempts.FailureClass == FailureClientCanceled {
+		return
+	}
 	if statusCode >= 400 {
+		if attempts != nil && attempts.FailureClass != "" {
+			attrs = append(attrs, attribute.String("error.type", attempts.FailureClass))
+		}
 		tm.errorCounter.Add(ctx, 1, metric.WithAttributes(attrs...))
 	}
 }
 
+// RecordTransfer records the request and response body sizes and the response transfer duration of an HTTP request
+func (tm *TelemetryManager) RecordTransfer(ctx context.Context, path, method string, statusCode int, requestBytes, responseBytes int64, transferMs float64) {
+	if !tm.config.Enabled {
+		return
+	}
+
+	attrs := []attribute.KeyValue{
+		attribute.String("http.route", path),
+		attribute.String("http.method", metricsMethod(method)),
+		attribute.Int("http.status_code", statusCode),
+	}
+	attrs = append(attrs, MetricAttributesFromContext(ctx)...)
+
+	tm.requestSize.Record(ctx, requestBytes, metric.WithAttributes(attrs...))
+	tm.responseSize.Record(ctx, responseBytes, metric.WithAttributes(attrs...))
+	tm.transferDuration.Record(ctx, transferMs, metric.WithAttributes(attrs...))
+}
+
+// RecordUpstreamAttempts records the number of upstream attempts of a request and the backend instance that served it
+func (tm *TelemetryManager) RecordUpstreamAttempts(ctx context.Context, path, instance string, attempts int) {
+	if !tm.config.Enabled {
+		return
+	}
+
+	tm.upstreamAttempts.Record(ctx, int64(attempts), metric.WithAttributes(
+		attribute.String("http.route", path),
+		attribute.String("upstream.instance", instance),
+	))
+}
+
+// RecordUploadProgress records request body bytes received for a route
+func (tm *TelemetryManager) RecordUploadProgress(ctx context.Context, path string, n int64) {
+	if !tm.config.Enabled {
+		return
+	}
+	tm.uploadBytes.Add(ctx, n, metric.WithAttributes(attribute.String("http.route", path)))
+}
+
+// RecordActiveUpload records the start (delta 1) or end (delta -1) of a request body being received
+func (tm *TelemetryManager) RecordActiveUpload(ctx context.Context, path string, delta int64) {
+	if !tm.config.Enabled {
+		return
+	}
+	tm.activeUploads.Add(ctx, delta, metric.WithAttributes(attribute.String("http.route", path)))
+}
+
+// RecordUpstreamTiming records the phase durations of an upstream attempt by backend host. The connection
+// phases are only recorded for new connections.
+func (tm *TelemetryManager) RecordUpstreamTiming(ctx context.Context, instance string, timing UpstreamTiming) {
+	if !tm.config.Enabled {
+		return
+	}
+
+	phases := map[string]time.Duration{"ttfb": timing.TTFB}
+	if !timing.Reused {
+		phases["dns"] = timing.DNS
+		phases["connect"] = timing.Connect
+		phases["tls"] = timing.TLS
+	}
+	for phase, duration := range phases {
+		if duration <= 0 {
+			continue
+		}
+		tm.upstreamTiming.Record(ctx, float64(duration.Microseconds())/1000, metric.WithAttributes(
+			attribute.String("upstream.instance", instance),
+			attribute.String("upstream.phase", phase),
+		))
+	}
+}
+
+// RecordConnectionAcquired records an upstream request sent on a new or reused connection, which may
+// have been taken from the idle pool
+func (tm *TelemetryManager) RecordConnectionAcquired(ctx context.Context, path, instance string, reused, created, wasIdle bool) {
+	if !tm.config.Enabled {
+		return
+	}
+	attributes := metric.WithAttributes(attribute.String("http.route", path), attribute.String("upstream.instance", instance))
+	tm.connAcquired.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("http.route", path),
+		attribute.String("upstream.instance", instance),
+		attribute.Bool("connection.reused", reused),
+	))
+	if created {
+		tm.connOpen.Add(ctx, 1, attributes)
+	}
+	if wasIdle {
+		tm.connIdle.Add(ctx, -1, attributes)
+	}
+}
+
+// RecordConnectionIdle records an upstream connection entering (delta 1) or leaving (delta -1) the idle pool
+func (tm *TelemetryManager) RecordConnectionIdle(ctx context.Context, path, instance string, delta int64) {
+	if !tm.config.Enabled {
+		return
+	}
+	tm.connIdle.Add(ctx, delta, metric.WithAttributes(
+		attribute.String("http.route", path),
+		attribute.String("upstream.instance", instance),
+	))
+}
+
+// RecordConnectionClosed records a closed upstream connection, which may have been idle
+func (tm *TelemetryManager) RecordConnectionClosed(ctx context.Context, path, instance string, wasIdle bool) {
+	if !tm.config.Enabled {
+		return
+	}
+	attributes := metric.WithAttributes(attribute.String("http.route", path), attribute.String("upstream.instance", instance))
+	tm.connClosed.Add(ctx, 1, attributes)
+	tm.connOpen.Add(ctx, -1, attributes)
+	if wasIdle {
+		tm.connIdle.Add(ctx, -1, attributes)
+	}
+}
+
+// RecordSlowRequest records a request exceeding the slow request threshold of its endpoint
+func (tm *TelemetryManager) RecordSlowRequest(ctx context.Context, path, method string) {
+	if !tm.config.Enabled {
+		return
+	}
+	tm.slowRequests.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("http.route", path),
+		attribute.String("http.method", metricsMethod(method)),
+	))
+}
+
+// RecordConcurrencyRejected records an upstream request rejected by the adaptive concurrency limit
+func (tm *TelemetryManager) RecordConcurrencyRejected(ctx context.Context, route, instance string) {
+	if !tm.config.Enabled {
+		return
+	}
+	tm.limitRejections.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("http.route", route),
+		attribute.String("upstream.instance", instance),
+	))
+}
+
+// RecordShedRequest records a request shed while the gateway is overloaded
+func (tm *TelemetryManager) RecordShedRequest(ctx context.Context, path, priority string) {
+	if !tm.config.Enabled {
+		return
+	}
+	tm.shedRequests.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("http.route", path),
+		attribute.String("request.priority", priority),
+	))
+}
+
+// RecordCertificateReload records a reload of the certificates of a listener and whether it succeeded
+func (tm *TelemetryManager) RecordCertificateReload(ctx context.Context, listener string, success bool) {
+	if !tm.config.Enabled {
+		return
+	}
+	result := "success"
+	if !success {
+		result = "failure"
+	}
+	tm.certReloads.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("listener", listener),
+		attribute.String("reload.result", result),
+	))
+}
+
+// RecordAuthFailure records a request of a route failing authentication and whether it locked its client out
+func (tm *TelemetryManager) RecordAuthFailure(ctx context.Context, route string, lockout bool) {
+	if !tm.config.Enabled {
+		return
+	}
+	tm.authFailures.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("http.route", route),
+		attribute.Bool("auth.lockout", lockout),
+	))
+}
+
+// RecordRateLimited records a request of a route rejected by the rate limit budget, e.g. read or write
+func (tm *TelemetryManager) RecordRateLimited(ctx context.Context, route, budget string) {
+	if !tm.config.Enabled {
+		return
+	}
+	tm.rateLimited.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("http.route", route),
+		attribute.String("rate_limit.budget", budget),
+	))
+}
+
+// RecordRejectedConnection records a client connection closed because of a connection limit, e.g. per_ip
+func (tm *TelemetryManager) RecordRejectedConnection(ctx context.Context, limit string) {
+	if !tm.config.Enabled {
+		return
+	}
+	tm.rejectedConns.Add(ctx, 1, metric.WithAttributes(attribute.String("connection.limit", limit)))
+}
+
+// RecordClientCanceled records a request abandoned by the client while waiting for the backend (phase upstream)
+// or while the response was transferred (phase response)
+func (tm *TelemetryManager) RecordClientCanceled(ctx context.Context, path, method, phase string) {
+	if !tm.config.Enabled {
+		return
+	}
+	tm.clientCanceled.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("http.route", path),
+		attribute.String("http.method", metricsMethod(method)),
+		attribute.String("cancel.phase", phase),
+	))
+}
+
+// RecordMaskedFields records the sensitive fields of a response masked with an action
+func (tm *TelemetryManager) RecordMaskedFields(ctx context.Context, path, action string, count int64) {
+	if !tm.config.Enabled {
+		return
+	}
+	tm.maskedFields.Add(ctx, count, metric.WithAttributes(
+		attribute.String("http.route", path),
+		attribute.String("mask.action", action),
+	))
+}
+
+// RecordExperimentAssignment records a request assigned to an experiment variant
+func (tm *TelemetryManager) RecordExperimentAssignment(ctx context.Context, path, experiment, variant string) {
+	if !tm.config.Enabled {
+		return
+	}
+	tm.experiments.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("http.route", path),
+		attribute.String("experiment.name", experiment),
+		attribute.String("experiment.variant", variant),
+	))
+}
+
+// RecordRouteCacheResult records the result of a route cache lookup
+func (tm *TelemetryManager) RecordRouteCacheResult(ctx context.Context, hit bool) {
+	if !tm.config.Enabled {
+		return
+	}
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	tm.routeCache.Add(ctx, 1, metric.WithAttributes(attribute.String("cache.result", result)))
+}
+
+// RegisterBurnRateGauge exports the SLO burn rates returned by observe, keyed by route, as a gauge
+func (tm *TelemetryManager) RegisterBurnRateGauge(observe func() map[string]float64) error {
+	if !tm.config.Enabled {
+		return nil
+	}
+
+	_, err := tm.meter.Float64ObservableGauge(
+		"slo.burn_rate",
+		metric.WithDescription("Error budget burn rate of endpoints with an SLO over the SLO window"),
+		metric.WithFloat64Callback(func(ctx context.Context, observer metric.Float64Observer) error {
+			for route, burnRate := range observe() {
+				observer.Observe(burnRate, metric.WithAttributes(attribute.String("http.route", route)))
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create burn rate gauge: %w", err)
+	}
+	return nil
+}
+
+// RegisterCertificateExpiryGauge exports the days until expiry of the certificates returned by observe as a gauge
+func (tm *TelemetryManager) RegisterCertificateExpiryGauge(observe func() []CertificateStatus) error {
+	if !tm.config.Enabled {
+		return nil
+	}
+
+	_, err := tm.meter.Float64ObservableGauge(
+		"tls.certificate.expiry",
+		metric.WithDescription("Days until the listener and upstream certificates expire"),
+		metric.WithUnit("d"),
+		metric.WithFloat64Callback(func(ctx context.Context, observer metric.Float64Observer) error {
+			for _, cert := range observe() {
+				observer.Observe(cert.DaysUntilExpiry, metric.WithAttributes(
+					attribute.String("tls.certificate.kind", cert.Kind),
+					attribute.String("tls.certificate.name", cert.Name),
+				))
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create certificate expiry gauge: %w", err)
+	}
+	return nil
+}
+
+// metricAttributesKey is the context key for additional request metric attributes
+type metricAttributesKey struct{}
+
+// WithMetricAttributes returns a context carrying additional attributes for the request metrics
+func WithMetricAttributes(ctx context.Context, attrs ...attribute.KeyValue) context.Context {
+	existing := MetricAttributesFromContext(ctx)
+	combined := make([]attribute.KeyValue, 0, len(existing)+len(attrs))
+	combined = append(append(combined, existing...), attrs...)
+	return context.WithValue(ctx, metricAttributesKey{}, combined)
+}
+
+// MetricAttributesFromContext returns the additional request metric attributes stored in the context
+func MetricAttributesFromContext(ctx context.Context) []attribute.KeyValue {
+	attrs, _ := ctx.Value(metricAttributesKey{}).([]attribute.KeyValue)
+	return attrs
+}
+
+// RecordWAFHit records a request matched by a WAF rule
+func (tm *TelemetryManager) RecordWAFHit(ctx context.Context, rule, action, path string) {
+	if !tm.config.Enabled {
+		return
+	}
+
+	tm.wafHitCounter.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("waf.rule", rule),
+		attribute.String("waf.action", action),
+		attribute.String("http.route", path),
+	))
+}
+
+// RecordRetry records an upstream retry, or a retry rejected because the retry budget was exhausted
+func (tm *TelemetryManager) RecordRetry(ctx context.Context, path, reason string, allowed bool) {
+	if !tm.config.Enabled {
+		return
+	}
+
+	outcome := "retried"
+	if !allowed {
+		outcome = "budget_exhausted"
+	}
+
+	tm.retryCounter.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("http.route", path),
+		attribute.String("retry.reason", reason),
+		attribute.String("retry.outcome", outcome),
+	))
+}
+
+// RecordEjection records a backend instance ejected by outlier detection
+func (tm *TelemetryManager) RecordEjection(ctx context.Context, path, instance, reason string) {
+	if !tm.config.Enabled {
+		return
+	}
+
+	tm.ejectionCounter.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("http.route", path),
+		attribute.String("upstream.instance", instance),
+		attribute.String("ejection.reason", reason),
+	))
+}
+
+// RecordCacheResult records the result of a response cache lookup (hit, stale, miss, revalidated or bypass)
+func (tm *TelemetryManager) RecordCacheResult(ctx context.Context, path, result string) {
+	if !tm.config.Enabled {
+		return
+	}
+
+	tm.cacheCounter.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("http.route", path),
+		attribute.String("cache.result", result),
+	))
+}
+
 // Shutdown shuts down the telemetry manager
 func (tm *TelemetryManager) Shutdown(ctx context.Context) error {
 	if !tm.config.Enabled || tm.meterProvider == nil {
@@ -164,7 +841,7 @@ func (tm *TelemetryManager) Shutdown(ctx context.Context) error {
 // GetMetricsHandler returns an HTTP handler for metrics endpoint
 func (tm *TelemetryManager) GetMetricsHandler() http.Handler {
 	if !tm.config.Enabled || tm.promHandler == nil {
-		// Return a simple handler that returns 404 if telemetry is disabled
+		// Return a simple handler that returns 404 if telemetry or the Prometheus exporter is disabled
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Telemetry is disabled", http.StatusNotFound)
 		})
@@ -38,6 +38,63 @@ func TestNewTelemetryManager(t *testing.T) {
 	}
 }
 
+// TestTelemetryExporters tests that the Prometheus and OTLP exporters can be enabled independently
+func TestTelemetryExporters(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT", "")
+
+	tests := []struct {
+		name       string
+		config     TelemetryConfig
+		prometheus bool
+		otlp       bool
+	}{
+		{"default without metrics URL", TelemetryConfig{}, true, false},
+		{"default with metrics URL", TelemetryConfig{MetricsURL: "http://localhost:4318"}, true, true},
+		{"prometheus only", TelemetryConfig{MetricsURL: "http://localhost:4318", Exporters: []string{"prometheus"}}, true, false},
+		{"otlp only", TelemetryConfig{Exporters: []string{"otlp"}}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prometheusEnabled, otlpEnabled, err := telemetryExporters(tt.config)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if prometheusEnabled != tt.prometheus || otlpEnabled != tt.otlp {
+				t.Errorf("Expected prometheus=%v otlp=%v, got prometheus=%v otlp=%v", tt.prometheus, tt.otlp, prometheusEnabled, otlpEnabled)
+			}
+		})
+	}
+
+	if _, _, err := telemetryExporters(TelemetryConfig{Exporters: []string{"statsd"}}); err == nil {
+		t.Error("Expected error for invalid exporter")
+	}
+
+	// Prometheus only does not require a metrics URL
+	tm, err := NewTelemetryManager(TelemetryConfig{Enabled: true, ServiceName: "test-service"})
+	if err != nil {
+		t.Fatalf("Failed to create Prometheus-only TelemetryManager: %v", err)
+	}
+	defer tm.Shutdown(context.Background())
+	tm.RecordRequest(context.Background(), "/test", "GET", 200, 10)
+	rr := httptest.NewRecorder()
+	tm.GetMetricsHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected metrics endpoint status 200, got %d", rr.Code)
+	}
+
+	// OTLP only does not serve the Prometheus endpoint
+	tm, err = NewTelemetryManager(TelemetryConfig{Enabled: true, ServiceName: "test-service", MetricsURL: "http://localhost:4318", Exporters: []string{"otlp"}, ExportInterval: 60000})
+	if err != nil {
+		t.Fatalf("Failed to create OTLP-only TelemetryManager: %v", err)
+	}
+	rr = httptest.NewRecorder()
+	tm.GetMetricsHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected metrics endpoint status 404, got %d", rr.Code)
+	}
+}
+
 // TestTelemetryRecordRequest tests the RecordRequest method
 func TestTelemetryRecordRequest(t *testing.T) {
 	// Create a TelemetryManager with disabled telemetry (for safety in tests)
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultMaxQuotaTenants is the default number of tenants whose usage is tracked per day
+const defaultMaxQuotaTenants = 10000
+
+// QuotaLimits represents the daily limits of a tenant, 0 leaves a limit unlimited
+type QuotaLimits struct {
+	DailyRequests int64 `json:"daily_requests"`
+	// DailyRequestBytes and DailyResponseBytes limit the request and response body bytes per day
+	DailyRequestBytes  int64 `json:"daily_request_bytes"`
+	DailyResponseBytes int64 `json:"daily_response_bytes"`
+}
+
+// unlimited checks whether no limit is set
+func (l QuotaLimits) unlimited() bool {
+	return l.DailyRequests <= 0 && l.DailyRequestBytes <= 0 && l.DailyResponseBytes <= 0
+}
+
+// TenantQuotaConfig represents the daily request and byte quotas of the tenants of a multi-tenant deployment
+type TenantQuotaConfig struct {
+	// TenantHeader is the header the authentication identifies the tenant with, see callerIdentity
+	TenantHeader string `json:"tenant_header"`
+	// TenantClaim is the claim of the bearer token validated by jwt_auth identifying the tenant, used instead
+	// of TenantHeader
+	TenantClaim string `json:"tenant_claim"`
+	// Default are the limits of the tenants without their own limits
+	Default QuotaLimits `json:"default"`
+	// Tenants maps tenants to their own limits
+	Tenants map[string]QuotaLimits `json:"tenants"`
+	// MaxTenants is the number of tenants tracked per day, the requests of further tenants are rejected (default 10000)
+	MaxTenants int `json:"max_tenants"`
+}
+
+// enabled checks whether the tenants are identified
+func (c TenantQuotaConfig) enabled() bool {
+	return c.TenantHeader != "" || c.TenantClaim != ""
+}
+
+// TenantUsage reports the usage of a tenant during the current day
+type TenantUsage struct {
+	Tenant        string      `json:"tenant"`
+	Requests      int64       `json:"requests"`
+	RequestBytes  int64       `json:"request_bytes"`
+	ResponseBytes int64       `json:"response_bytes"`
+	Limits        QuotaLimits `json:"limits"`
+}
+
+// TenantQuotas enforces the daily quotas of the tenants. Usage is counted per UTC day and reset at midnight.
+type TenantQuotas struct {
+	config TenantQuotaConfig
+	now    func() time.Time
+
+	mu    sync.Mutex
+	day   string
+	usage map[string]*TenantUsage
+}
+
+// NewTenantQuotas creates a new TenantQuotas
+func NewTenantQuotas(config TenantQuotaConfig) *TenantQuotas {
+	if config.MaxTenants <= 0 {
+		config.MaxTenants = defaultMaxQuotaTenants
+	}
+	return &TenantQuotas{
+		config: config,
+		now:    time.Now,
+		usage:  make(map[string]*TenantUsage),
+	}
+}
+
+// tenant returns the tenant of a request identified by the authentication, empty if the request does not
+// identify one
+func (q *TenantQuotas) tenant(r *http.Request) string {
+	if q.config.TenantClaim != "" {
+		claims, _ := JWTClaimsFromContext(r.Context())
+		return claimString(claims[q.config.TenantClaim])
+	}
+	return callerIdentity(r, q.config.TenantHeader)
+}
+
+// limits returns the limits of a tenant
+func (q *TenantQuotas) limits(tenant string) QuotaLimits {
+	if limits, ok := q.config.Tenants[tenant]; ok {
+		return limits
+	}
+	return q.config.Default
+}
+
+// rotate resets the usage when the day changed, it must be called with the lock held
+func (q *TenantQuotas) rotate(now time.Time) {
+	if day := now.UTC().Format(time.DateOnly); day != q.day {
+		q.day = day
+		q.usage = make(map[string]*TenantUsage)
+	}
+}
+
+// admit counts a request of a tenant unless its quota is used up, returning the exceeded quota otherwise
+func (q *TenantQuotas) admit(tenant string, limits QuotaLimits, contentLength int64) string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.rotate(q.now())
+	usage, ok := q.usage[tenant]
+	if !ok {
+		if len(q.usage) >= q.config.MaxTenants {
+			return "max_tenants"
+		}
+		usage = &TenantUsage{Tenant: tenant}
+		q.usage[tenant] = usage
+	}
+
+	switch {
+	case limits.DailyRequests > 0 && usage.Requests >= limits.DailyRequests:
+		return "daily_requests"
+	case limits.DailyRequestBytes > 0 && usage.RequestBytes+max(contentLength, 0) > limits.DailyRequestBytes:
+		return "daily_request_bytes"
+	case limits.DailyResponseBytes > 0 && usage.ResponseBytes >= limits.DailyResponseBytes:
+		return "daily_response_bytes"
+	}
+	usage.Requests++
+	return ""
+}
+
+// record adds the body bytes of a served request to the usage of a tenant
+func (q *TenantQuotas) record(tenant string, requestBytes, responseBytes int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.rotate(q.now())
+	if usage, ok := q.usage[tenant]; ok {
+		usage.RequestBytes += requestBytes
+		usage.ResponseBytes += responseBytes
+	}
+}
+
+// Middleware rejects the requests of the tenants whose daily quota is used up with 429 and counts the body
+// bytes of the admitted requests. A request is admitted while the quota is not used up, so its response may
+// exceed the byte quota; the following requests are rejected until midnight UTC.
+func (q *TenantQuotas) Middleware(endpoint Endpoint, next http.Handler) http.Handler {
+	if q == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant := q.tenant(r)
+		limits := q.limits(tenant)
+		if tenant == "" || limits.unlimited() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if exceeded := q.admit(tenant, limits, r.ContentLength); exceeded != "" {
+			LogWarn("Tenant quota exceeded", map[string]interface{}{
+				"tenant": tenant,
+				"quota":  exceeded,
+				"path":   r.URL.Path,
+				"route":  endpoint.Path,
+			})
+			now := q.now().UTC()
+			midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+			w.Header().Set("Retry-After", strconv.Itoa(int(midnight.Sub(now).Seconds())+1))
+			http.Error(w, "Quota exceeded", http.StatusTooManyRequests)
+			return
+		}
+
+		// Count the body bytes of the request and the response
+		requestBody := &countingReadCloser{ReadCloser: http.NoBody}
+		if r.Body != nil && r.Body != http.NoBody {
+			requestBody.ReadCloser = r.Body
+			r.Body = requestBody
+		}
+		lrw := NewLoggingResponseWriter(w)
+		lrw.bodyLimit = 0
+		next.ServeHTTP(lrw, r)
+		q.record(tenant, requestBody.bytesRead, lrw.bytesWritten)
+	})
+}
+
+// Usage returns the usage of the tenants during the current day, sorted by tenant
+func (q *TenantQuotas) Usage() (string, []TenantUsage) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.rotate(q.now())
+	usage := make([]TenantUsage, 0, len(q.usage))
+	for tenant, tenantUsage := range q.usage {
+		entry := *tenantUsage
+		entry.Limits = q.limits(tenant)
+		usage = append(usage, entry)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		return usage[i].Tenant < usage[j].Tenant
+	})
+	return q.day, usage
+}
+
+// Reset resets the usage of a tenant during the current day, of all tenants if tenant is empty
+func (q *TenantQuotas) Reset(tenant string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if tenant == "" {
+		q.usage = make(map[string]*TenantUsage)
+		return
+	}
+	delete(q.usage, tenant)
+}
+
+// handleQuotas reports the usage of the tenant quotas (GET) and resets the usage of a tenant (DELETE ?tenant=)
+// or of all tenants
+func (g *Gateway) handleQuotas(w http.ResponseWriter, r *http.Request) {
+	if g.quotas == nil {
+		http.Error(w, "Tenant quotas are not configured", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		day, usage := g.quotas.Usage()
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"day":     day,
+			"tenants": usage,
+		})
+	case http.MethodDelete:
+		tenant := r.URL.Query().Get("tenant")
+		g.quotas.Reset(tenant)
+		LogAudit("Tenant quota usage reset", map[string]interface{}{"tenant": tenant})
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
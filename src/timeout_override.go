@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// TimeoutOverrideHeader is the header trusted callers send to request a longer timeout in milliseconds
+const TimeoutOverrideHeader = "X-Timeout-Ms"
+
+// TimeoutOverrideConfig represents the timeouts trusted callers may request with the X-Timeout-Ms header,
+// e.g. batch jobs that legitimately need longer deadlines
+type TimeoutOverrideConfig struct {
+	// MaxTimeout is the maximum timeout in milliseconds a caller may request, 0 disables overrides
+	MaxTimeout int `json:"max_timeout"`
+	// CallerHeader is the header the authentication identifies the caller with, see callerIdentity
+	CallerHeader string `json:"caller_header"`
+	// TrustedCallers are the callers allowed to override the timeout
+	TrustedCallers []string `json:"trusted_callers"`
+}
+
+// requested returns the timeout requested by a trusted caller, capped at the maximum
+func (c TimeoutOverrideConfig) requested(r *http.Request) (time.Duration, bool) {
+	if c.MaxTimeout <= 0 || c.CallerHeader == "" {
+		return 0, false
+	}
+	timeout, err := strconv.Atoi(r.Header.Get(TimeoutOverrideHeader))
+	if err != nil || timeout <= 0 {
+		return 0, false
+	}
+	caller := callerIdentity(r, c.CallerHeader)
+	if caller == "" || !containsString(c.TrustedCallers, caller) {
+		return 0, false
+	}
+	return time.Duration(min(timeout, c.MaxTimeout)) * time.Millisecond, true
+}
+
+// newOverrideTransport creates the transport of the requests with a timeout override, whose deadline
+// replaces the response header timeout of the endpoint
+func newOverrideTransport(transport *http.Transport) *http.Transport {
+	override := transport.Clone()
+	override.ResponseHeaderTimeout = 0
+	return override
+}
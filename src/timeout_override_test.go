@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestTimeoutOverride tests that only trusted callers can extend the endpoint timeout, up to the maximum
+func TestTimeoutOverride(t *testing.T) {
+	forwarded := make(chan string, 1)
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded <- r.Header.Get(TimeoutOverrideHeader)
+		time.Sleep(150 * time.Millisecond)
+	}))
+	defer backendServer.Close()
+
+	// The authentication identifies the caller by its bearer token
+	authenticate := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if caller, ok := bearerToken(r); ok {
+				r.Header.Set("X-Auth-Subject", caller)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	proxy := NewProxy(Endpoint{
+		Path:    "/batch",
+		Backend: backendServer.URL,
+		Timeout: 50,
+		TimeoutOverride: TimeoutOverrideConfig{
+			MaxTimeout:     1000,
+			CallerHeader:   "X-Auth-Subject",
+			TrustedCallers: []string{"batch-job"},
+		},
+	}, false, nil).Handler()
+	handler := CallerIdentityMiddleware([]string{"X-Auth-Subject"}, authenticate(proxy))
+
+	tests := []struct {
+		name     string
+		caller   string
+		timeout  string
+		expected int
+		honored  bool
+	}{
+		{"without override", "batch-job", "", http.StatusGatewayTimeout, false},
+		{"untrusted caller", "someone", "1000", http.StatusGatewayTimeout, false},
+		{"trusted caller", "batch-job", "1000", http.StatusOK, true},
+		{"override below the backend latency", "batch-job", "20", http.StatusGatewayTimeout, true},
+		{"caller header sent by the client", "", "1000", http.StatusGatewayTimeout, false},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/batch", nil)
+		if test.caller != "" {
+			req.Header.Set("Authorization", "Bearer "+test.caller)
+		} else {
+			req.Header.Set("X-Auth-Subject", "batch-job")
+		}
+		if test.timeout != "" {
+			req.Header.Set(TimeoutOverrideHeader, test.timeout)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != test.expected {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.expected, rr.Code)
+		}
+		select {
+		case header := <-forwarded:
+			if !test.honored && header != "" {
+				t.Errorf("%s: expected the header of a request not honored to be removed", test.name)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: expected the request to reach the backend", test.name)
+		}
+	}
+
+	// Requested timeouts are capped at the maximum
+	config := TimeoutOverrideConfig{MaxTimeout: 1000, CallerHeader: "X-Auth-Subject", TrustedCallers: []string{"batch-job"}}
+	req := httptest.NewRequest("GET", "/batch", nil)
+	req.Header.Set(TimeoutOverrideHeader, "60000")
+	CallerIdentityMiddleware([]string{"X-Auth-Subject"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Set("X-Auth-Subject", "batch-job")
+		if timeout, ok := config.requested(r); !ok || timeout != time.Second {
+			t.Errorf("expected the timeout to be capped at 1s, got %v", timeout)
+		}
+	})).ServeHTTP(httptest.NewRecorder(), req)
+}
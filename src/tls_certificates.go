@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultCertificateReloadInterval is the default interval in milliseconds at which the certificate files are
+// checked for changes
+const defaultCertificateReloadInterval = 10000
+
+// CertificateFiles represents a certificate and its private key
+type CertificateFiles struct {
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+}
+
+// CertificateStore serves the certificates of a TLS listener by SNI server name and reloads them atomically
+// when their files change on disk
+type CertificateStore struct {
+	name      string
+	config    TLSConfig
+	monitor   *CertificateMonitor
+	telemetry *TelemetryManager
+	current   atomic.Pointer[certificateSet]
+
+	mu       sync.Mutex
+	modTimes map[string]time.Time
+}
+
+// certificateSet is the set of certificates loaded from the files of a listener
+type certificateSet struct {
+	// byName maps the lower case server names, e.g. api.example.com or *.example.com, to their certificate
+	byName map[string]*tls.Certificate
+	// fallback is served to clients sending no or another server name, nil if cert_file is not set
+	fallback *tls.Certificate
+}
+
+// NewCertificateStore loads the certificates of a listener. The certificates are observed by the monitor,
+// if any, under the listener name.
+func NewCertificateStore(name string, config TLSConfig, monitor *CertificateMonitor, telemetry *TelemetryManager) (*CertificateStore, error) {
+	store := &CertificateStore{name: name, config: config, monitor: monitor, telemetry: telemetry}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// files returns the certificate and key files of the listener
+func (s *CertificateStore) files() []string {
+	var files []string
+	if s.config.CertFile != "" {
+		files = append(files, s.config.CertFile, s.config.KeyFile)
+	}
+	for _, certificate := range s.config.Certificates {
+		files = append(files, certificate.CertFile, certificate.KeyFile)
+	}
+	return files
+}
+
+// load loads the certificate files and replaces the served certificates, the caller must hold the lock.
+// The served certificates are kept if any file cannot be loaded.
+func (s *CertificateStore) load() error {
+	modTimes := make(map[string]time.Time)
+	for _, file := range s.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return fmt.Errorf("failed to read certificate: %w", err)
+		}
+		modTimes[file] = info.ModTime()
+	}
+
+	set := &certificateSet{byName: make(map[string]*tls.Certificate)}
+	if s.config.CertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(s.config.CertFile, s.config.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load certificate: %w", err)
+		}
+		set.fallback = &certificate
+	}
+	for serverName, files := range s.config.Certificates {
+		certificate, err := tls.LoadX509KeyPair(files.CertFile, files.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load certificate of %s: %w", serverName, err)
+		}
+		set.byName[strings.ToLower(serverName)] = &certificate
+	}
+
+	s.current.Store(set)
+	s.modTimes = modTimes
+	s.observe(set)
+	return nil
+}
+
+// observe reports the expiry of the loaded certificates to the certificate monitor
+func (s *CertificateStore) observe(set *certificateSet) {
+	if s.monitor == nil {
+		return
+	}
+	if set.fallback != nil && set.fallback.Leaf != nil {
+		s.monitor.Observe("listener", s.name, set.fallback.Leaf)
+	}
+	for serverName, certificate := range set.byName {
+		if certificate.Leaf != nil {
+			s.monitor.Observe("listener", s.name+" "+serverName, certificate.Leaf)
+		}
+	}
+}
+
+// changed reports whether any certificate file was modified since it was loaded, the caller must hold the lock
+func (s *CertificateStore) changed() bool {
+	for _, file := range s.files() {
+		info, err := os.Stat(file)
+		if err != nil || !info.ModTime().Equal(s.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload loads the certificates again if any of their files changed, or in any case with force, and reports
+// whether they were replaced. The served certificates are kept if the new files cannot be loaded, e.g. while
+// they are being written, so clients never see a certificate without its matching key.
+func (s *CertificateStore) Reload(force bool) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !force && !s.changed() {
+		return false, nil
+	}
+	err := s.load()
+	if err != nil {
+		LogError("Failed to reload listener certificates, serving the previous ones", err, map[string]interface{}{
+			"name": s.name,
+		})
+	} else {
+		LogInfo("Listener certificates reloaded", map[string]interface{}{
+			"name": s.name,
+		})
+	}
+	if s.telemetry != nil {
+		s.telemetry.RecordCertificateReload(context.Background(), s.name, err == nil)
+	}
+	return err == nil, err
+}
+
+// Watch reloads the certificates when their files change until done is closed, unless the reload interval
+// is negative
+func (s *CertificateStore) Watch(done <-chan struct{}) {
+	interval := s.config.ReloadInterval
+	if interval < 0 {
+		return
+	}
+	if interval == 0 {
+		interval = defaultCertificateReloadInterval
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			_, _ = s.Reload(false)
+		}
+	}
+}
+
+// GetCertificate returns the certificate of the server name requested by a client: the certificate of the
+// exact name, else of the wildcard name matching it, else the fallback certificate
+func (s *CertificateStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	set := s.current.Load()
+	serverName := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if serverName != "" {
+		if certificate, ok := set.byName[serverName]; ok {
+			return certificate, nil
+		}
+		if _, parent, ok := strings.Cut(serverName, "."); ok {
+			if certificate, ok := set.byName["*."+parent]; ok {
+				return certificate, nil
+			}
+		}
+	}
+	if set.fallback != nil {
+		return set.fallback, nil
+	}
+	if serverName == "" {
+		return nil, errors.New("no certificate for clients without a server name")
+	}
+	return nil, fmt.Errorf("no certificate for server name %s", serverName)
+}
+
+// TLSConfig returns the TLS configuration of a server selecting the certificates of the store
+func (s *CertificateStore) TLSConfig() *tls.Config {
+	return &tls.Config{GetCertificate: s.GetCertificate}
+}
+
+// CertificateReloadResult reports the reload of the certificates of a listener
+type CertificateReloadResult struct {
+	Listener string `json:"listener"`
+	Reloaded bool   `json:"reloaded"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ReloadCertificates reloads the certificates of all TLS listeners from their files, even if unchanged
+func (g *Gateway) ReloadCertificates() []CertificateReloadResult {
+	g.mu.Lock()
+	stores := append([]*CertificateStore(nil), g.certificateStores...)
+	g.mu.Unlock()
+
+	results := make([]CertificateReloadResult, 0, len(stores))
+	for _, store := range stores {
+		result := CertificateReloadResult{Listener: store.name}
+		var err error
+		if result.Reloaded, err = store.Reload(true); err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// handleCertificateReload reloads the certificates of the TLS listeners, answering 500 if any reload failed
+func (g *Gateway) handleCertificateReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	results := g.ReloadCertificates()
+	status := http.StatusOK
+	for _, result := range results {
+		if result.Error != "" {
+			status = http.StatusInternalServerError
+		}
+	}
+	writeJSON(w, status, results)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestCertificate writes a self-signed certificate for a name and its key to a directory
+func writeTestCertificate(t *testing.T, dir, name string) CertificateFiles {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := CertificateFiles{
+		CertFile: filepath.Join(dir, name+".crt"),
+		KeyFile:  filepath.Join(dir, name+".key"),
+	}
+	if err := os.WriteFile(files.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(files.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// TestCertificateStore tests the selection of the listener certificates by SNI and their reload
+func TestCertificateStore(t *testing.T) {
+	dir := t.TempDir()
+	fallback := writeTestCertificate(t, dir, "default.example.com")
+	config := TLSConfig{
+		CertFile: fallback.CertFile,
+		KeyFile:  fallback.KeyFile,
+		Certificates: map[string]CertificateFiles{
+			"api.example.com":    writeTestCertificate(t, dir, "api.example.com"),
+			"*.apps.example.com": writeTestCertificate(t, dir, "wildcard.apps.example.com"),
+		},
+	}
+	monitor := NewCertificateMonitor(CertificateMonitoringConfig{}, nil, nil)
+	store, err := NewCertificateStore("public", config, monitor, nil)
+	if err != nil {
+		t.Fatalf("NewCertificateStore() error = %v", err)
+	}
+	if certs := monitor.Certificates(); len(certs) != 3 {
+		t.Errorf("expected the 3 certificates to be monitored, got %+v", certs)
+	}
+
+	subject := func(serverName string) string {
+		certificate, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+		if err != nil {
+			t.Fatalf("GetCertificate(%q) error = %v", serverName, err)
+		}
+		return certificate.Leaf.Subject.CommonName
+	}
+	for serverName, expected := range map[string]string{
+		"API.example.com":         "api.example.com",
+		"shop.apps.example.com":   "wildcard.apps.example.com",
+		"a.shop.apps.example.com": "default.example.com",
+		"other.example.com":       "default.example.com",
+		"":                        "default.example.com",
+	} {
+		if actual := subject(serverName); actual != expected {
+			t.Errorf("expected the certificate of %s for %q, got %s", expected, serverName, actual)
+		}
+	}
+
+	// Unchanged files are not reloaded, rotated ones are
+	if reloaded, err := store.Reload(false); reloaded || err != nil {
+		t.Errorf("expected no reload, got %v %v", reloaded, err)
+	}
+	rotated := writeTestCertificate(t, t.TempDir(), "rotated.example.com")
+	for source, target := range map[string]string{rotated.CertFile: fallback.CertFile, rotated.KeyFile: fallback.KeyFile} {
+		data, err := os.ReadFile(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(target, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		later := time.Now().Add(time.Minute)
+		if err := os.Chtimes(target, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if reloaded, err := store.Reload(false); !reloaded || err != nil {
+		t.Fatalf("expected a reload, got %v %v", reloaded, err)
+	}
+	if actual := subject("other.example.com"); actual != "rotated.example.com" {
+		t.Errorf("expected the rotated certificate, got %s", actual)
+	}
+
+	// Invalid files keep the previous certificates
+	if err := os.WriteFile(fallback.KeyFile, []byte("invalid"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(2 * time.Minute)
+	_ = os.Chtimes(fallback.KeyFile, later, later)
+	if _, err := store.Reload(false); err == nil {
+		t.Error("expected an invalid key to fail the reload")
+	}
+	if actual := subject("other.example.com"); actual != "rotated.example.com" {
+		t.Errorf("expected the previous certificate to be kept, got %s", actual)
+	}
+
+	// Without a fallback, unknown names are rejected
+	store, err = NewCertificateStore("sni", TLSConfig{Certificates: config.Certificates}, nil, nil)
+	if err != nil {
+		t.Fatalf("NewCertificateStore() error = %v", err)
+	}
+	if _, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: "other.example.com"}); err == nil {
+		t.Error("expected no certificate for an unknown name")
+	}
+}
+
+// TestCertificateReloadEndpoint tests reloading the listener certificates through the admin API
+func TestCertificateReloadEndpoint(t *testing.T) {
+	dir := t.TempDir()
+	files := writeTestCertificate(t, dir, "gateway.example.com")
+	store, err := NewCertificateStore("public", TLSConfig{CertFile: files.CertFile, KeyFile: files.KeyFile}, nil, nil)
+	if err != nil {
+		t.Fatalf("NewCertificateStore() error = %v", err)
+	}
+	gateway := NewGateway(Config{}, nil)
+	gateway.certificateStores = []*CertificateStore{store}
+
+	rr := httptest.NewRecorder()
+	gateway.handleCertificateReload(rr, httptest.NewRequest("POST", "/admin/certificates/reload", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"reloaded":true`) {
+		t.Errorf("expected the certificates to be reloaded, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	if err := os.Remove(files.KeyFile); err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	gateway.handleCertificateReload(rr, httptest.NewRequest("POST", "/admin/certificates/reload", nil))
+	if rr.Code != http.StatusInternalServerError || !strings.Contains(rr.Body.String(), `"error"`) {
+		t.Errorf("expected the failed reload to be reported, got %d %s", rr.Code, rr.Body.String())
+	}
+	if _, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: "gateway.example.com"}); err != nil {
+		t.Errorf("expected the previous certificate to be served, got %v", err)
+	}
+}
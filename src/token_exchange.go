@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Token exchange modes
+const (
+	TokenExchangeModeExchange = "exchange"
+	TokenExchangeModeMint     = "mint"
+)
+
+// Default token exchange settings
+const (
+	defaultTokenExchangeTimeout = 5000
+	defaultMintedTokenLifetime  = 300000
+	maxExchangedTokens          = 10000
+	// exchangedTokenMargin is the time before their expiry exchanged tokens are not reused anymore
+	exchangedTokenMargin = 10 * time.Second
+)
+
+// RFC 8693 grant and token types
+const (
+	tokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+	accessTokenType        = "urn:ietf:params:oauth:token-type:access_token"
+)
+
+// ErrTokenExchangeRejected is returned when the security token service refuses to exchange a token
+var ErrTokenExchangeRejected = errors.New("token exchange rejected")
+
+// TokenExchangeConfig represents the replacement of the validated caller tokens with internal tokens
+type TokenExchangeConfig struct {
+	// Mode is exchange (RFC 8693 token exchange at the token URL) or mint (a new token signed by the
+	// gateway); empty forwards the caller token
+	Mode string `json:"mode"`
+	// TokenURL is the token endpoint of the security token service
+	TokenURL string `json:"token_url"`
+	// ClientID and ClientSecret authenticate the gateway at the token endpoint
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	// Audience is the audience requested for exchanged tokens and the aud claim of minted tokens
+	Audience string `json:"audience"`
+	// Scope is the scope requested for exchanged tokens
+	Scope string `json:"scope"`
+	// Timeout is the timeout in milliseconds of a token request (default 5000)
+	Timeout int `json:"timeout"`
+	// Issuer is the iss claim of minted tokens
+	Issuer string `json:"issuer"`
+	// SigningSecret is the shared secret minted tokens are signed with (HS256)
+	SigningSecret string `json:"signing_secret"`
+	// Lifetime is the lifetime in milliseconds of minted tokens, capped at the expiry of the caller token
+	// (default 300000)
+	Lifetime int `json:"lifetime"`
+	// Claims maps the claims of minted tokens to the caller claims they are copied from (default sub)
+	Claims map[string]string `json:"claims"`
+}
+
+// exchangedToken is an internal token obtained for a caller token
+type exchangedToken struct {
+	token   string
+	expires time.Time
+}
+
+// TokenExchanger obtains the internal tokens forwarded to the backends in place of the caller tokens
+type TokenExchanger struct {
+	config TokenExchangeConfig
+	client *http.Client
+	now    func() time.Time
+
+	mu     sync.Mutex
+	tokens map[string]exchangedToken
+}
+
+// NewTokenExchanger creates a new TokenExchanger
+func NewTokenExchanger(config TokenExchangeConfig, now func() time.Time) (*TokenExchanger, error) {
+	switch config.Mode {
+	case TokenExchangeModeExchange:
+		if config.TokenURL == "" {
+			return nil, errors.New("token exchange token_url is required")
+		}
+	case TokenExchangeModeMint:
+		if config.SigningSecret == "" {
+			return nil, errors.New("token exchange signing_secret is required to mint tokens")
+		}
+	default:
+		return nil, fmt.Errorf("invalid token exchange mode: %s (must be exchange or mint)", config.Mode)
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultTokenExchangeTimeout
+	}
+	if config.Lifetime <= 0 {
+		config.Lifetime = defaultMintedTokenLifetime
+	}
+	if len(config.Claims) == 0 {
+		config.Claims = map[string]string{"sub": "sub"}
+	}
+	return &TokenExchanger{
+		config: config,
+		client: &http.Client{Timeout: time.Duration(config.Timeout) * time.Millisecond},
+		now:    now,
+		tokens: make(map[string]exchangedToken),
+	}, nil
+}
+
+// Token returns the internal token of a validated caller token with the given claims
+func (e *TokenExchanger) Token(ctx context.Context, token string, claims map[string]interface{}) (string, error) {
+	if e.config.Mode == TokenExchangeModeMint {
+		return e.mint(claims)
+	}
+
+	// Reuse the token exchanged for the same caller token until shortly before it expires
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+	e.mu.Lock()
+	cached, ok := e.tokens[key]
+	e.mu.Unlock()
+	if ok && e.now().Add(exchangedTokenMargin).Before(cached.expires) {
+		return cached.token, nil
+	}
+
+	exchanged, err := e.exchange(ctx, token, claims)
+	if err != nil {
+		return "", err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.tokens) >= maxExchangedTokens {
+		e.evictExpired()
+	}
+	if len(e.tokens) < maxExchangedTokens {
+		e.tokens[key] = exchanged
+	}
+	return exchanged.token, nil
+}
+
+// evictExpired removes the expired exchanged tokens, the caller must hold the lock
+func (e *TokenExchanger) evictExpired() {
+	now := e.now()
+	for key, token := range e.tokens {
+		if !now.Add(exchangedTokenMargin).Before(token.expires) {
+			delete(e.tokens, key)
+		}
+	}
+}
+
+// exchange exchanges a caller token at the token endpoint of the security token service (RFC 8693)
+func (e *TokenExchanger) exchange(ctx context.Context, token string, claims map[string]interface{}) (exchangedToken, error) {
+	form := url.Values{
+		"grant_type":         {tokenExchangeGrantType},
+		"subject_token":      {token},
+		"subject_token_type": {accessTokenType},
+	}
+	if e.config.Audience != "" {
+		form.Set("audience", e.config.Audience)
+	}
+	if e.config.Scope != "" {
+		form.Set("scope", e.config.Scope)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return exchangedToken{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if e.config.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(e.config.ClientID), url.QueryEscape(e.config.ClientSecret))
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return exchangedToken{}, fmt.Errorf("token exchange request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized ||
+		resp.StatusCode == http.StatusForbidden:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return exchangedToken{}, fmt.Errorf("%w: status %d: %s", ErrTokenExchangeRejected, resp.StatusCode, body)
+	case resp.StatusCode != http.StatusOK:
+		return exchangedToken{}, fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+
+	var response struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil || response.AccessToken == "" {
+		return exchangedToken{}, errors.New("invalid token exchange response")
+	}
+
+	// Without an expiry, the exchanged token is reused until the caller token expires
+	expires := callerExpiry(claims)
+	if response.ExpiresIn > 0 {
+		expires = e.now().Add(time.Duration(response.ExpiresIn) * time.Second)
+	}
+	return exchangedToken{token: response.AccessToken, expires: expires}, nil
+}
+
+// mint signs a new internal token with the mapped claims of the caller token, expiring at the latest with it
+func (e *TokenExchanger) mint(claims map[string]interface{}) (string, error) {
+	now := e.now()
+	expires := now.Add(time.Duration(e.config.Lifetime) * time.Millisecond)
+	if callerExpires := callerExpiry(claims); callerExpires.Before(expires) {
+		expires = callerExpires
+	}
+
+	minted := map[string]interface{}{
+		"iat": now.Unix(),
+		"exp": expires.Unix(),
+	}
+	if e.config.Issuer != "" {
+		minted["iss"] = e.config.Issuer
+	}
+	if e.config.Audience != "" {
+		minted["aud"] = e.config.Audience
+	}
+	for claim, callerClaim := range e.config.Claims {
+		if value, ok := claims[callerClaim]; ok {
+			minted[claim] = value
+		}
+	}
+
+	payload, err := json.Marshal(minted)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signHS256([]byte(signed), e.config.SigningSecret)), nil
+}
+
+// callerExpiry returns the expiry of a validated caller token
+func callerExpiry(claims map[string]interface{}) time.Time {
+	exp, _ := claims["exp"].(float64)
+	return time.Unix(int64(exp), 0)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"net/http"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceContextPropagator reads and writes the W3C traceparent and tracestate headers
+var traceContextPropagator = propagation.TraceContext{}
+
+// TraceContextMiddleware continues the trace of the incoming request, or starts a new one,
+// with a new span for the gateway hop. The span context is stored in the request context
+// so logs can be correlated with traces and the trace is propagated to the backend.
+func TraceContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := traceContextPropagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		next.ServeHTTP(w, r.WithContext(newSpanContext(ctx)))
+	})
+}
+
+// newSpanContext returns a context with a new span that is a child of the span in the given context, if any
+func newSpanContext(ctx context.Context) context.Context {
+	parent := trace.SpanContextFromContext(ctx)
+
+	config := trace.SpanContextConfig{
+		TraceID:    parent.TraceID(),
+		TraceFlags: parent.TraceFlags(),
+		TraceState: parent.TraceState(),
+	}
+	if !parent.IsValid() {
+		_, _ = rand.Read(config.TraceID[:])
+		config.TraceFlags = trace.FlagsSampled
+	}
+	_, _ = rand.Read(config.SpanID[:])
+
+	return trace.ContextWithSpanContext(ctx, trace.NewSpanContext(config))
+}
+
+// InjectTraceContext writes the trace context of the request context to the request headers
+func InjectTraceContext(req *http.Request) {
+	traceContextPropagator.Inject(req.Context(), propagation.HeaderCarrier(req.Header))
+}
+
+// traceIDs returns the trace and span IDs stored in the context, or empty strings if there are none
+func traceIDs(ctx context.Context) (string, string) {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return "", ""
+	}
+	return spanContext.TraceID().String(), spanContext.SpanID().String()
+}
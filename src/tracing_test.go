@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestTraceContextPropagation tests that the gateway continues the incoming trace and propagates it to the backend
+func TestTraceContextPropagation(t *testing.T) {
+	var backendTraceparent string
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendTraceparent = r.Header.Get("traceparent")
+		_, _ = w.Write([]byte("OK"))
+	}))
+	defer backendServer.Close()
+
+	gateway := NewGateway(Config{
+		Endpoints: []Endpoint{{Path: "/api", Backend: backendServer.URL}},
+	}, nil)
+	gateway.RegisterEndpoints()
+
+	// Continue an incoming trace with a new span
+	req := httptest.NewRequest("GET", "/api", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	gateway.mux.ServeHTTP(httptest.NewRecorder(), req)
+
+	parts := strings.Split(backendTraceparent, "-")
+	if len(parts) != 4 {
+		t.Fatalf("Expected a traceparent header at the backend, got %q", backendTraceparent)
+	}
+	if parts[1] != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected the incoming trace ID, got %s", parts[1])
+	}
+	if parts[2] == "00f067aa0ba902b7" {
+		t.Error("Expected a new span ID for the gateway hop")
+	}
+
+	// Start a new trace without an incoming one
+	gateway.mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api", nil))
+	if parts := strings.Split(backendTraceparent, "-"); len(parts) != 4 || parts[1] == "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected a new trace, got %q", backendTraceparent)
+	}
+}
+
+// TestTraceIDs tests the extraction of trace and span IDs for log entries
+func TestTraceIDs(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api", nil)
+	if traceID, spanID := traceIDs(req.Context()); traceID != "" || spanID != "" {
+		t.Errorf("Expected no trace IDs, got %q %q", traceID, spanID)
+	}
+
+	ctx := newSpanContext(req.Context())
+	traceID, spanID := traceIDs(ctx)
+	if len(traceID) != 32 || len(spanID) != 16 {
+		t.Errorf("Expected trace and span IDs, got %q %q", traceID, spanID)
+	}
+}
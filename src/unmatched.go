@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultCustomResponseContentType is the content type of custom error responses if none is configured
+const defaultCustomResponseContentType = "text/plain; charset=utf-8"
+
+// CustomResponseConfig represents a custom body for responses generated by the gateway
+type CustomResponseConfig struct {
+	// Body is the response body (the standard body is used if empty)
+	Body string `json:"body"`
+	// ContentType is the content type of the body (default text/plain; charset=utf-8)
+	ContentType string `json:"content_type"`
+}
+
+// write writes the custom response, or the standard one if no body is configured
+func (c CustomResponseConfig) write(w http.ResponseWriter, status int, standardBody string) {
+	if c.Body == "" {
+		http.Error(w, standardBody, status)
+		return
+	}
+	contentType := c.ContentType
+	if contentType == "" {
+		contentType = defaultCustomResponseContentType
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(c.Body))
+}
+
+// catchAll serves the requests not matched by a static route: dynamic endpoints first, then the default
+// backend, otherwise the not found response
+type catchAll struct {
+	once           sync.Once
+	defaultBackend http.Handler
+}
+
+// registerCatchAll registers the catch-all route once
+func (g *Gateway) registerCatchAll() {
+	g.catchAll.once.Do(func() {
+		if g.servesRoot() {
+			LogWarn("The endpoint at / serves all unmatched requests, dynamic endpoints, the default backend and the not found response are not used", nil)
+			return
+		}
+		g.handle("/", http.HandlerFunc(g.serveUnmatched), nil)
+	})
+}
+
+// servesRoot checks whether an endpoint at / serves all requests no other endpoint matches
+func (g *Gateway) servesRoot() bool {
+	for _, endpoint := range g.config.Endpoints {
+		if endpoint.Host == "" && endpoint.Path == "/" {
+			return true
+		}
+	}
+	return false
+}
+
+// serveUnmatched serves a request not matched by a static route
+func (g *Gateway) serveUnmatched(w http.ResponseWriter, r *http.Request) {
+	if mux := g.dynamicMux.Load(); mux != nil {
+		if handler, pattern := mux.Handler(r); pattern != "" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+	}
+	if g.catchAll.defaultBackend != nil {
+		g.catchAll.defaultBackend.ServeHTTP(w, r)
+		return
+	}
+
+	// Count the requests answered with 404 in the unmatched route
+	startTime := time.Now()
+	lrw := NewLoggingResponseWriter(w)
+	lrw.bodyLimit = 0
+	g.config.NotFoundResponse.write(lrw, http.StatusNotFound, "404 page not found")
+	if g.telemetry != nil {
+		g.telemetry.RecordRequest(r.Context(), UnmatchedRoute, r.Method, lrw.statusCode, float64(time.Since(startTime).Milliseconds()))
+	}
+}
+
+// RegisterDefaultBackend forwards the requests not matched by any route to the default backend, and answers
+// them with the custom not found response otherwise
+func (g *Gateway) RegisterDefaultBackend() {
+	if g.config.DefaultBackend != "" {
+		_, g.catchAll.defaultBackend = g.newEndpointHandler(Endpoint{Path: "/", Backend: g.config.DefaultBackend, unmatched: true})
+		LogInfo("Default backend enabled", map[string]interface{}{
+			"backend": g.config.DefaultBackend,
+		})
+	}
+	// The catch-all also counts the requests answered with 404 in the unmatched route of the metrics
+	if g.config.DefaultBackend != "" || g.config.NotFoundResponse.Body != "" || (g.telemetry != nil && !g.servesRoot()) {
+		g.registerCatchAll()
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestDefaultBackend tests that unmatched requests are forwarded to the default backend
+func TestDefaultBackend(t *testing.T) {
+	monolith := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("monolith " + r.URL.Path))
+	}))
+	defer monolith.Close()
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("service"))
+	}))
+	defer service.Close()
+
+	gateway := NewGateway(Config{
+		Endpoints:      []Endpoint{{Path: "/orders/", Backend: service.URL, PathMode: PathModeReplace}},
+		DefaultBackend: monolith.URL,
+	}, nil)
+	gateway.RegisterEndpoints()
+	gateway.RegisterDefaultBackend()
+
+	for path, expected := range map[string]string{
+		"/orders/42":     "service",
+		"/legacy/report": "monolith /legacy/report",
+	} {
+		rr := httptest.NewRecorder()
+		gateway.mux.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusOK || rr.Body.String() != expected {
+			t.Errorf("%s: expected %q, got %d %q", path, expected, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+// TestCustomErrorResponses tests the custom 404 and 405 response bodies
+func TestCustomErrorResponses(t *testing.T) {
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backendServer.Close()
+
+	gateway := NewGateway(Config{
+		Endpoints:                []Endpoint{{Path: "/api", Method: "GET", Backend: backendServer.URL}},
+		NotFoundResponse:         CustomResponseConfig{Body: `{"error":"not_found"}`, ContentType: "application/json"},
+		MethodNotAllowedResponse: CustomResponseConfig{Body: `{"error":"method_not_allowed"}`, ContentType: "application/json"},
+	}, nil)
+	gateway.RegisterEndpoints()
+	gateway.RegisterDefaultBackend()
+
+	rr := httptest.NewRecorder()
+	gateway.mux.ServeHTTP(rr, httptest.NewRequest("GET", "/missing", nil))
+	if rr.Code != http.StatusNotFound || rr.Body.String() != `{"error":"not_found"}` || rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected the custom 404 response, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	gateway.mux.ServeHTTP(rr, httptest.NewRequest("DELETE", "/api", nil))
+	if rr.Code != http.StatusMethodNotAllowed || !strings.Contains(rr.Body.String(), "method_not_allowed") {
+		t.Errorf("expected the custom 405 response, got %d %q", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Allow") != "GET" {
+		t.Errorf("expected the Allow header to list the endpoint method, got %q", rr.Header().Get("Allow"))
+	}
+}
+
+// TestMethodNotAllowedOverrides tests the per-endpoint 405 response and the 405 handler
+func TestMethodNotAllowedOverrides(t *testing.T) {
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backendServer.Close()
+
+	gateway := NewGateway(Config{
+		Endpoints:                []Endpoint{{Path: "/api", Method: "GET", Backend: backendServer.URL, MethodNotAllowed: &CustomResponseConfig{Body: "read only"}}},
+		MethodNotAllowedResponse: CustomResponseConfig{Body: "global"},
+	}, nil)
+	gateway.RegisterEndpoints()
+
+	rr := httptest.NewRecorder()
+	gateway.mux.ServeHTTP(rr, httptest.NewRequest("DELETE", "/api", nil))
+	if rr.Code != http.StatusMethodNotAllowed || rr.Body.String() != "read only" {
+		t.Errorf("expected the endpoint 405 response, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	// The handler replaces the responses of the endpoints registered after it is set
+	gateway = NewGateway(Config{Endpoints: []Endpoint{{Path: "/upload", Method: "POST", Backend: backendServer.URL}}}, nil)
+	gateway.SetMethodNotAllowedHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		_, _ = w.Write([]byte("use " + w.Header().Get("Allow")))
+	}))
+	gateway.RegisterEndpoints()
+	rr = httptest.NewRecorder()
+	gateway.mux.ServeHTTP(rr, httptest.NewRequest("GET", "/upload", nil))
+	if rr.Code != http.StatusMethodNotAllowed || rr.Body.String() != "use POST" {
+		t.Errorf("expected the handler 405 response, got %d %q", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// defaultUpgrades are the protocols clients may upgrade to on the endpoints without an allowlist
+var defaultUpgrades = []string{"websocket"}
+
+// endpointUpgrades returns the protocols clients may upgrade the connections to an endpoint to
+func endpointUpgrades(endpoint Endpoint) []string {
+	if len(endpoint.Upgrades) == 0 {
+		return defaultUpgrades
+	}
+	return endpoint.Upgrades
+}
+
+// upgradeAllowed checks whether an offered protocol, e.g. websocket or HTTP/2.0, is in the allowlist, whose
+// entries match a protocol name with any version or a name and version exactly
+func upgradeAllowed(protocol string, allowed []string) bool {
+	name, _, _ := strings.Cut(protocol, "/")
+	for _, entry := range allowed {
+		if entry == "*" || strings.EqualFold(entry, protocol) || strings.EqualFold(entry, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterUpgrade removes the protocols the endpoint does not allow from the Upgrade header of an upstream
+// request. A request left without protocols is forwarded as a plain request, as a server may ignore an
+// upgrade; the allowed upgrades are spliced between the client and the backend connections once the
+// backend switches protocols.
+func filterUpgrade(endpoint Endpoint, req *http.Request) {
+	offered := req.Header.Values("Upgrade")
+	if len(offered) == 0 {
+		return
+	}
+
+	allowed := endpointUpgrades(endpoint)
+	var protocols, refused []string
+	for _, value := range offered {
+		for _, protocol := range strings.Split(value, ",") {
+			protocol = strings.TrimSpace(protocol)
+			if protocol == "" {
+				continue
+			}
+			if upgradeAllowed(protocol, allowed) {
+				protocols = append(protocols, protocol)
+			} else {
+				refused = append(refused, protocol)
+			}
+		}
+	}
+	if len(refused) == 0 {
+		return
+	}
+
+	LogInfo("Protocol upgrade refused", map[string]interface{}{
+		"path":      req.URL.Path,
+		"route":     endpoint.Path,
+		"protocols": strings.Join(refused, ", "),
+	})
+	if len(protocols) == 0 {
+		req.Header.Del("Upgrade")
+		return
+	}
+	req.Header.Set("Upgrade", strings.Join(protocols, ", "))
+}
+
+// validateUpgrades checks the upgrade protocol allowlist of an endpoint
+func validateUpgrades(upgrades []string) error {
+	for _, protocol := range upgrades {
+		if protocol == "" {
+			return errors.New("upgrades must not contain empty protocols")
+		}
+		if strings.ContainsAny(protocol, " \t,;") {
+			return fmt.Errorf("invalid upgrade protocol %q", protocol)
+		}
+	}
+	return nil
+}
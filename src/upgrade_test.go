@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestProtocolUpgrades tests that the allowed protocol upgrades are spliced to the backend and the others are
+// forwarded as plain requests
+func TestProtocolUpgrades(t *testing.T) {
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		protocol := r.Header.Get("Upgrade")
+		if protocol == "" {
+			http.Error(w, "upgrade required", http.StatusUpgradeRequired)
+			return
+		}
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Errorf("Hijack failed: %v", err)
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintf(brw, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: %s\r\n\r\n", protocol)
+		_ = brw.Flush()
+		line, _ := brw.ReadString('\n')
+		_, _ = brw.WriteString(protocol + " " + line)
+		_ = brw.Flush()
+	}))
+	defer backendServer.Close()
+
+	gateway := NewGateway(Config{
+		Endpoints: []Endpoint{
+			{Path: "/default", Backend: backendServer.URL},
+			{Path: "/tunnel", Backend: backendServer.URL, Upgrades: []string{"websocket", "spice"}, GenerateETag: true},
+		},
+		SecurityHeaders: SecurityHeadersConfig{Enabled: true},
+	}, nil)
+	gateway.RegisterEndpoints()
+	gatewayServer := httptest.NewServer(gateway.mux)
+	defer gatewayServer.Close()
+
+	upgrade := func(path, protocols string) (*http.Response, string) {
+		t.Helper()
+		conn, err := net.Dial("tcp", strings.TrimPrefix(gatewayServer.URL, "http://"))
+		if err != nil {
+			t.Fatalf("Dial failed: %v", err)
+		}
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+		fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: gateway\r\nConnection: Upgrade\r\nUpgrade: %s\r\n\r\n", path, protocols)
+		reader := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			t.Fatalf("Reading the response failed: %v", err)
+		}
+		if resp.StatusCode != http.StatusSwitchingProtocols {
+			return resp, ""
+		}
+		fmt.Fprintf(conn, "ping\n")
+		line, _ := reader.ReadString('\n')
+		return resp, line
+	}
+
+	if resp, line := upgrade("/tunnel", "spice"); resp.StatusCode != http.StatusSwitchingProtocols || line != "spice ping\n" {
+		t.Errorf("Expected the spice upgrade to be spliced, got %v %q", resp.StatusCode, line)
+	}
+	if resp, line := upgrade("/default", "websocket"); resp.StatusCode != http.StatusSwitchingProtocols || line != "websocket ping\n" {
+		t.Errorf("Expected websocket upgrades by default, got %v %q", resp.StatusCode, line)
+	}
+	if resp, _ := upgrade("/default", "spice"); resp.StatusCode != http.StatusUpgradeRequired {
+		t.Errorf("Expected the spice upgrade to be removed, got %v", resp.StatusCode)
+	}
+	if resp, line := upgrade("/tunnel", "h2c, spice/2"); resp.Header.Get("Upgrade") != "spice/2" || line != "spice/2 ping\n" {
+		t.Errorf("Expected only the allowed protocol to be offered, got %q %q", resp.Header.Get("Upgrade"), line)
+	}
+}
+
+// TestValidateUpgrades tests the validation of the upgrade protocol allowlists
+func TestValidateUpgrades(t *testing.T) {
+	if err := validateUpgrades([]string{"websocket", "HTTP/2.0", "*"}); err != nil {
+		t.Errorf("Expected valid upgrades, got %v", err)
+	}
+	for _, upgrades := range [][]string{{""}, {"websocket, spice"}} {
+		if err := validateUpgrades(upgrades); err == nil {
+			t.Errorf("Expected %q to be rejected", upgrades)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+)
+
+// UpstreamAttempts records the upstream attempts made for a request
+type UpstreamAttempts struct {
+	// Backend is the backend instance (host) that served the last attempt
+	Backend string
+	// Count is the number of attempts sent upstream
+	Count int
+	// RetryReasons lists why each retry happened, e.g. connection_error or status_503
+	RetryReasons []string
+	// Duration is the time spent waiting for the response headers of all attempts
+	Duration time.Duration
+	// Timing is the timing breakdown of the last attempt
+	Timing UpstreamTiming
+	// FailureClass is why the request got no response from the backend, e.g. timeout, empty if it got one
+	FailureClass string
+}
+
+// upstreamAttemptsKey is the context key for the upstream attempts of a request
+type upstreamAttemptsKey struct{}
+
+// WithUpstreamAttempts returns a context recording the upstream attempts of a request
+func WithUpstreamAttempts(ctx context.Context) (context.Context, *UpstreamAttempts) {
+	attempts := &UpstreamAttempts{}
+	return context.WithValue(ctx, upstreamAttemptsKey{}, attempts), attempts
+}
+
+// UpstreamAttemptsFromContext returns the upstream attempts recorded in the context, or nil
+func UpstreamAttemptsFromContext(ctx context.Context) *UpstreamAttempts {
+	attempts, _ := ctx.Value(upstreamAttemptsKey{}).(*UpstreamAttempts)
+	return attempts
+}
+
+// retried records the reason of a retry
+func (a *UpstreamAttempts) retried(reason string) {
+	if a != nil {
+		a.RetryReasons = append(a.RetryReasons, reason)
+	}
+}
+
+// attemptTransport is a round tripper recording each upstream attempt, its timing and the backend instance
+// it was sent to
+type attemptTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip records the attempt and sends the request
+func (t *attemptTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if attempts := UpstreamAttemptsFromContext(req.Context()); attempts != nil {
+		attempts.Backend = req.URL.Host
+		attempts.Count++
+		trace := newUpstreamTrace()
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace.clientTrace()))
+		defer func() {
+			attempts.Duration += time.Since(trace.start)
+			attempts.Timing = trace.result()
+		}()
+	}
+	return t.next.RoundTrip(req)
+}
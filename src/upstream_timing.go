@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// UpstreamTiming is the timing breakdown of an upstream attempt. The phases of establishing a connection
+// are zero when an idle connection was reused.
+type UpstreamTiming struct {
+	// DNS is the duration of the host name lookup
+	DNS time.Duration
+	// Connect is the duration of establishing the TCP connection
+	Connect time.Duration
+	// TLS is the duration of the TLS handshake
+	TLS time.Duration
+	// TTFB is the time from the start of the attempt to the first response byte
+	TTFB time.Duration
+	// Reused is set when an idle connection was reused
+	Reused bool
+}
+
+// fields returns the timing in milliseconds for logging
+func (t UpstreamTiming) fields() map[string]interface{} {
+	return map[string]interface{}{
+		"dns_ms":     float64(t.DNS.Microseconds()) / 1000,
+		"connect_ms": float64(t.Connect.Microseconds()) / 1000,
+		"tls_ms":     float64(t.TLS.Microseconds()) / 1000,
+		"ttfb_ms":    float64(t.TTFB.Microseconds()) / 1000,
+		"reused":     t.Reused,
+	}
+}
+
+// upstreamTrace records the timing of an upstream attempt with httptrace. The dial callbacks may run
+// concurrently and after the attempt has ended, so the timing is guarded by a mutex.
+type upstreamTrace struct {
+	mu           sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	timing       UpstreamTiming
+}
+
+// newUpstreamTrace creates an upstreamTrace for an attempt starting now
+func newUpstreamTrace() *upstreamTrace {
+	return &upstreamTrace{start: time.Now()}
+}
+
+// clientTrace returns the httptrace hooks recording the timing
+func (t *upstreamTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.timing.DNS = time.Since(t.dnsStart)
+		},
+		ConnectStart: func(string, string) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			// Keep the first of the parallel dials to several addresses
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(_, _ string, err error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if err == nil && t.timing.Connect == 0 {
+				t.timing.Connect = time.Since(t.connectStart)
+			}
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.timing.TLS = time.Since(t.tlsStart)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.timing.Reused = info.Reused
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.timing.TTFB = time.Since(t.start)
+		},
+	}
+}
+
+// result returns the recorded timing
+func (t *upstreamTrace) result() UpstreamTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.timing
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestUpstreamTiming tests that the timing of each attempt is recorded, with the connection phases
+// only for new connections
+func TestUpstreamTiming(t *testing.T) {
+	backendServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		_, _ = w.Write([]byte("OK"))
+	}))
+	defer backendServer.Close()
+
+	transport := &attemptTransport{next: backendServer.Client().Transport}
+	roundTrip := func() UpstreamTiming {
+		ctx, attempts := WithUpstreamAttempts(t.Context())
+		req, _ := http.NewRequestWithContext(ctx, "GET", backendServer.URL, nil)
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return attempts.Timing
+	}
+
+	timing := roundTrip()
+	if timing.Reused || timing.Connect <= 0 || timing.TLS <= 0 {
+		t.Errorf("expected the connect and TLS phases of a new connection, got %+v", timing)
+	}
+	if timing.TTFB < 10*time.Millisecond {
+		t.Errorf("expected the TTFB to include the backend latency, got %v", timing.TTFB)
+	}
+
+	timing = roundTrip()
+	if !timing.Reused || timing.Connect != 0 || timing.TLS != 0 || timing.TTFB <= 0 {
+		t.Errorf("expected only the TTFB of a reused connection, got %+v", timing)
+	}
+}
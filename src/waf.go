@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// WAF rule actions
+const (
+	WAFActionBlock  = "block"
+	WAFActionTarpit = "tarpit"
+)
+
+// Default WAF settings
+const (
+	defaultWAFMaxBodyBytes = 64 * 1024
+	defaultWAFTarpitDelay  = 10000
+)
+
+// WAFConfig represents the request filtering rules configuration
+type WAFConfig struct {
+	Enabled bool `json:"enabled"`
+	// MaxBodyBytes is the maximum number of body bytes inspected by body patterns
+	MaxBodyBytes int64     `json:"max_body_bytes"`
+	Rules        []WAFRule `json:"rules"`
+}
+
+// WAFRule represents a single request filtering rule.
+// All configured conditions must match for the rule to apply.
+type WAFRule struct {
+	Name           string            `json:"name"`
+	Methods        []string          `json:"methods"`
+	PathPattern    string            `json:"path_pattern"`
+	HeaderPatterns map[string]string `json:"header_patterns"`
+	BodyPattern    string            `json:"body_pattern"`
+	// MaxQueryParams matches requests with more query parameters than this value
+	MaxQueryParams int `json:"max_query_params"`
+	// MaxHeaders matches requests with more headers than this value
+	MaxHeaders int `json:"max_headers"`
+	// Action is either "block" (default) or "tarpit"
+	Action string `json:"action"`
+	// TarpitDelay is the delay in milliseconds applied before rejecting a tarpitted request
+	TarpitDelay int `json:"tarpit_delay"`
+}
+
+// compiledWAFRule is a WAFRule with its patterns compiled
+type compiledWAFRule struct {
+	rule    WAFRule
+	methods map[string]bool
+	path    *regexp.Regexp
+	headers map[string]*regexp.Regexp
+	body    *regexp.Regexp
+	hits    atomic.Int64
+}
+
+// WAF filters suspicious requests before they are proxied
+type WAF struct {
+	config    WAFConfig
+	rules     []*compiledWAFRule
+	telemetry *TelemetryManager
+}
+
+// NewWAF creates a new WAF and compiles its rules
+func NewWAF(config WAFConfig, telemetry *TelemetryManager) (*WAF, error) {
+	if config.MaxBodyBytes <= 0 {
+		config.MaxBodyBytes = defaultWAFMaxBodyBytes
+	}
+
+	waf := &WAF{config: config, telemetry: telemetry}
+	for i, rule := range config.Rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		if rule.Action == "" {
+			rule.Action = WAFActionBlock
+		}
+		if rule.Action != WAFActionBlock && rule.Action != WAFActionTarpit {
+			return nil, fmt.Errorf("invalid action %q for WAF rule %s", rule.Action, rule.Name)
+		}
+		if rule.Action == WAFActionTarpit && rule.TarpitDelay <= 0 {
+			rule.TarpitDelay = defaultWAFTarpitDelay
+		}
+
+		compiled := &compiledWAFRule{rule: rule, headers: make(map[string]*regexp.Regexp)}
+
+		if len(rule.Methods) > 0 {
+			compiled.methods = make(map[string]bool)
+			for _, method := range rule.Methods {
+				compiled.methods[strings.ToUpper(method)] = true
+			}
+		}
+
+		var err error
+		if rule.PathPattern != "" {
+			if compiled.path, err = regexp.Compile(rule.PathPattern); err != nil {
+				return nil, fmt.Errorf("invalid path pattern for WAF rule %s: %w", rule.Name, err)
+			}
+		}
+		for header, pattern := range rule.HeaderPatterns {
+			if compiled.headers[header], err = regexp.Compile(pattern); err != nil {
+				return nil, fmt.Errorf("invalid header pattern for WAF rule %s: %w", rule.Name, err)
+			}
+		}
+		if rule.BodyPattern != "" {
+			if compiled.body, err = regexp.Compile(rule.BodyPattern); err != nil {
+				return nil, fmt.Errorf("invalid body pattern for WAF rule %s: %w", rule.Name, err)
+			}
+		}
+
+		waf.rules = append(waf.rules, compiled)
+	}
+
+	return waf, nil
+}
+
+// Hits returns the number of requests matched by each rule
+func (w *WAF) Hits() map[string]int64 {
+	hits := make(map[string]int64, len(w.rules))
+	for _, rule := range w.rules {
+		hits[rule.rule.Name] = rule.hits.Load()
+	}
+	return hits
+}
+
+// Match returns the first rule matching the request, or nil if no rule matches.
+// The request body is restored so it can still be proxied.
+func (w *WAF) Match(r *http.Request) *WAFRule {
+	var body []byte
+	bodyRead := false
+
+	for _, rule := range w.rules {
+		if rule.methods != nil && !rule.methods[r.Method] {
+			continue
+		}
+		if rule.path != nil && !rule.path.MatchString(r.URL.Path) {
+			continue
+		}
+		if rule.rule.MaxQueryParams > 0 && len(r.URL.Query()) <= rule.rule.MaxQueryParams {
+			continue
+		}
+		if rule.rule.MaxHeaders > 0 && len(r.Header) <= rule.rule.MaxHeaders {
+			continue
+		}
+		if !rule.matchHeaders(r.Header) {
+			continue
+		}
+		if rule.body != nil {
+			if !bodyRead {
+				body = w.peekBody(r)
+				bodyRead = true
+			}
+			if !rule.body.Match(body) {
+				continue
+			}
+		}
+
+		rule.hits.Add(1)
+		return &rule.rule
+	}
+
+	return nil
+}
+
+// matchHeaders checks whether all header patterns of the rule match the request headers
+func (c *compiledWAFRule) matchHeaders(header http.Header) bool {
+	for name, pattern := range c.headers {
+		if !pattern.MatchString(header.Get(name)) {
+			return false
+		}
+	}
+	return true
+}
+
+// peekBody reads up to MaxBodyBytes of the request body and restores it for further processing
+func (w *WAF) peekBody(r *http.Request) []byte {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, w.config.MaxBodyBytes))
+	if err != nil {
+		LogError("Error reading request body for WAF inspection", err, map[string]interface{}{
+			"path": r.URL.Path,
+		})
+	}
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+
+	return body
+}
+
+// Middleware returns a gateway middleware that blocks or tarpits requests matching a rule
+func (w *WAF) Middleware(endpoint Endpoint, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rule := w.Match(r)
+		if rule == nil {
+			next.ServeHTTP(rw, r)
+			return
+		}
+
+		LogAudit("Request blocked by WAF rule", map[string]interface{}{
+			"rule":        rule.Name,
+			"action":      rule.Action,
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"remote_addr": r.RemoteAddr,
+			"user_agent":  r.UserAgent(),
+		})
+
+		if w.telemetry != nil {
+			w.telemetry.RecordWAFHit(r.Context(), rule.Name, rule.Action, metricsRoute(endpoint))
+		}
+
+		// Tarpit the request by delaying the rejection, unless the client goes away first
+		if rule.Action == WAFActionTarpit {
+			timer := time.NewTimer(time.Duration(rule.TarpitDelay) * time.Millisecond)
+			select {
+			case <-timer.C:
+			case <-r.Context().Done():
+				timer.Stop()
+				return
+			}
+		}
+
+		http.Error(rw, "Forbidden", http.StatusForbidden)
+	})
+}
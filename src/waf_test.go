@@ -0,0 +1,113 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestWAFMatch tests the Match method of the WAF class
+func TestWAFMatch(t *testing.T) {
+	waf, err := NewWAF(WAFConfig{
+		Enabled: true,
+		Rules: []WAFRule{
+			{Name: "admin-path", PathPattern: "^/admin"},
+			{Name: "bad-bot", HeaderPatterns: map[string]string{"User-Agent": "(?i)sqlmap"}},
+			{Name: "sql-injection", Methods: []string{"post"}, BodyPattern: "(?i)union\\s+select"},
+			{Name: "too-many-params", MaxQueryParams: 2},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create WAF: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		method    string
+		target    string
+		userAgent string
+		body      string
+		expected  string
+	}{
+		{name: "Clean request", method: "GET", target: "/api/users", expected: ""},
+		{name: "Path pattern", method: "GET", target: "/admin/users", expected: "admin-path"},
+		{name: "Header pattern", method: "GET", target: "/api/users", userAgent: "sqlmap/1.0", expected: "bad-bot"},
+		{name: "Body pattern", method: "POST", target: "/api/users", body: "x=1 UNION SELECT *", expected: "sql-injection"},
+		{name: "Body pattern wrong method", method: "PUT", target: "/api/users", body: "x=1 UNION SELECT *", expected: ""},
+		{name: "Too many query params", method: "GET", target: "/api/users?a=1&b=2&c=3", expected: "too-many-params"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.userAgent != "" {
+				req.Header.Set("User-Agent", tt.userAgent)
+			}
+
+			rule := waf.Match(req)
+			name := ""
+			if rule != nil {
+				name = rule.Name
+			}
+			if name != tt.expected {
+				t.Errorf("WAF.Match() = %q, want %q", name, tt.expected)
+			}
+
+			// The body must still be readable after inspection
+			body, _ := io.ReadAll(req.Body)
+			if string(body) != tt.body {
+				t.Errorf("Request body after inspection = %q, want %q", string(body), tt.body)
+			}
+		})
+	}
+
+	if hits := waf.Hits(); hits["admin-path"] != 1 || hits["sql-injection"] != 1 {
+		t.Errorf("WAF.Hits() = %v, want one hit for admin-path and sql-injection", hits)
+	}
+}
+
+// TestWAFInvalidRule tests that invalid rules are rejected
+func TestWAFInvalidRule(t *testing.T) {
+	if _, err := NewWAF(WAFConfig{Rules: []WAFRule{{PathPattern: "("}}}, nil); err == nil {
+		t.Error("Expected error for invalid path pattern")
+	}
+	if _, err := NewWAF(WAFConfig{Rules: []WAFRule{{Action: "drop"}}}, nil); err == nil {
+		t.Error("Expected error for invalid action")
+	}
+}
+
+// TestWAFMiddleware tests that the gateway rejects requests matched by a WAF rule
+func TestWAFMiddleware(t *testing.T) {
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("OK"))
+	}))
+	defer backendServer.Close()
+
+	waf, err := NewWAF(WAFConfig{
+		Enabled: true,
+		Rules:   []WAFRule{{Name: "tarpit", Action: WAFActionTarpit, TarpitDelay: 1, PathPattern: "secret"}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create WAF: %v", err)
+	}
+
+	gateway := NewGateway(Config{
+		Endpoints: []Endpoint{{Path: "/test/", Method: "GET", Backend: backendServer.URL}},
+	}, nil)
+	gateway.Use(waf.Middleware)
+	gateway.RegisterEndpoints()
+
+	rr := httptest.NewRecorder()
+	gateway.mux.ServeHTTP(rr, httptest.NewRequest("GET", "/test/secret", nil))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+
+	rr = httptest.NewRecorder()
+	gateway.mux.ServeHTTP(rr, httptest.NewRequest("GET", "/test/public", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+}
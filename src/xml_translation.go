@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default XML translation settings
+const (
+	defaultXMLRootElement     = "request"
+	defaultXMLAttributePrefix = "@"
+	defaultXMLTextKey         = "#text"
+	defaultXMLArrayItem       = "item"
+	maxTranslatedBodyBytes    = 10 * 1024 * 1024
+	soapEnvelopeNamespace     = "http://schemas.xmlsoap.org/soap/envelope/"
+)
+
+// XMLTranslationConfig represents the translation of JSON client requests into XML for the backend,
+// and of XML backend responses back into JSON
+type XMLTranslationConfig struct {
+	Enabled bool `json:"enabled"`
+	// RootElement is the name of the root element of translated requests (default request)
+	RootElement string `json:"root_element"`
+	// SOAPEnvelope wraps translated requests in a SOAP 1.1 envelope and unwraps the body of SOAP responses
+	SOAPEnvelope bool `json:"soap_envelope"`
+	// SOAPAction is the SOAPAction header of translated requests
+	SOAPAction string `json:"soap_action"`
+	// ArrayElements are the response elements always translated into JSON arrays, even if they occur once
+	ArrayElements []string `json:"array_elements"`
+	// ArrayItemElement is the name of the elements of JSON arrays without an element name, e.g. a top-level
+	// array (default item)
+	ArrayItemElement string `json:"array_item_element"`
+	// AttributePrefix marks the JSON keys translated into XML attributes, and the other way round (default @)
+	AttributePrefix string `json:"attribute_prefix"`
+	// TextKey is the JSON key of the text of elements with attributes or children (default #text)
+	TextKey string `json:"text_key"`
+	// InferTypes translates numeric and boolean element text into JSON numbers and booleans
+	InferTypes bool `json:"infer_types"`
+}
+
+// withDefaults returns the configuration with the defaults applied
+func (c XMLTranslationConfig) withDefaults() XMLTranslationConfig {
+	if c.RootElement == "" {
+		c.RootElement = defaultXMLRootElement
+	}
+	if c.AttributePrefix == "" {
+		c.AttributePrefix = defaultXMLAttributePrefix
+	}
+	if c.TextKey == "" {
+		c.TextKey = defaultXMLTextKey
+	}
+	if c.ArrayItemElement == "" {
+		c.ArrayItemElement = defaultXMLArrayItem
+	}
+	return c
+}
+
+// mediaTypeOf returns the media type of a Content-Type header
+func mediaTypeOf(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+// isXMLMediaType reports whether a media type is XML
+func isXMLMediaType(mediaType string) bool {
+	return mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml")
+}
+
+// translateRequestToXML replaces a JSON request body with its XML translation. Requests without a JSON body
+// are left unchanged, only their accepted content type is changed.
+func translateRequestToXML(r *http.Request, config XMLTranslationConfig) error {
+	config = config.withDefaults()
+
+	// The response is translated from XML, so it must not be compressed
+	r.Header.Set("Accept", "application/xml, text/xml")
+	r.Header.Del("Accept-Encoding")
+
+	if r.Body == nil || r.Body == http.NoBody || mediaTypeOf(r.Header.Get("Content-Type")) != "application/json" {
+		return nil
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return fmt.Errorf("invalid JSON request body: %w", err)
+	}
+
+	var body bytes.Buffer
+	body.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&body)
+	if err := encodeXMLDocument(encoder, document, config); err != nil {
+		return err
+	}
+	if err := encoder.Flush(); err != nil {
+		return err
+	}
+
+	translated := body.Bytes()
+	r.Body = io.NopCloser(bytes.NewReader(translated))
+	r.ContentLength = int64(len(translated))
+	r.TransferEncoding = nil
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(translated)), nil
+	}
+	if config.SOAPEnvelope {
+		r.Header.Set("Content-Type", "text/xml; charset=utf-8")
+		if config.SOAPAction != "" {
+			r.Header.Set("SOAPAction", strconv.Quote(config.SOAPAction))
+		}
+	} else {
+		r.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	}
+	return nil
+}
+
+// encodeXMLDocument writes a JSON document as the root element, wrapped in a SOAP envelope if configured
+func encodeXMLDocument(encoder *xml.Encoder, document interface{}, config XMLTranslationConfig) error {
+	if !config.SOAPEnvelope {
+		return encodeXMLRoot(encoder, document, config)
+	}
+
+	envelope := xml.StartElement{
+		Name: xml.Name{Local: "soap:Envelope"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns:soap"}, Value: soapEnvelopeNamespace}},
+	}
+	body := xml.StartElement{Name: xml.Name{Local: "soap:Body"}}
+	if err := encoder.EncodeToken(envelope); err != nil {
+		return err
+	}
+	if err := encoder.EncodeToken(body); err != nil {
+		return err
+	}
+	if err := encodeXMLRoot(encoder, document, config); err != nil {
+		return err
+	}
+	if err := encoder.EncodeToken(body.End()); err != nil {
+		return err
+	}
+	return encoder.EncodeToken(envelope.End())
+}
+
+// encodeXMLRoot writes a JSON document as the root element, a top-level array as its items
+func encodeXMLRoot(encoder *xml.Encoder, document interface{}, config XMLTranslationConfig) error {
+	if items, ok := document.([]interface{}); ok {
+		return encodeXMLNested(encoder, config.RootElement, items, config)
+	}
+	return encodeXMLElement(encoder, config.RootElement, document, config)
+}
+
+// encodeXMLElement writes a JSON value as an element: objects become child elements and attributes,
+// arrays repeated elements and other values text
+func encodeXMLElement(encoder *xml.Encoder, name string, value interface{}, config XMLTranslationConfig) error {
+	if items, ok := value.([]interface{}); ok {
+		for _, item := range items {
+			// Arrays of arrays have no element names for the inner arrays
+			if nested, ok := item.([]interface{}); ok {
+				if err := encodeXMLNested(encoder, name, nested, config); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := encodeXMLElement(encoder, name, item, config); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	object, isObject := value.(map[string]interface{})
+
+	// Sort the keys so the translation is deterministic
+	var keys []string
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if attribute, ok := strings.CutPrefix(key, config.AttributePrefix); ok && key != config.TextKey {
+			start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: attribute}, Value: xmlText(object[key])})
+		}
+	}
+
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+	switch {
+	case isObject:
+		for _, key := range keys {
+			if key == config.TextKey {
+				if err := encoder.EncodeToken(xml.CharData(xmlText(object[key]))); err != nil {
+					return err
+				}
+				continue
+			}
+			if strings.HasPrefix(key, config.AttributePrefix) {
+				continue
+			}
+			if err := encodeXMLElement(encoder, key, object[key], config); err != nil {
+				return err
+			}
+		}
+	case value != nil:
+		if err := encoder.EncodeToken(xml.CharData(xmlText(value))); err != nil {
+			return err
+		}
+	}
+	return encoder.EncodeToken(start.End())
+}
+
+// encodeXMLNested writes a nested array as an element with an item element per array item
+func encodeXMLNested(encoder *xml.Encoder, name string, items []interface{}, config XMLTranslationConfig) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, item := range items {
+		if err := encodeXMLElement(encoder, config.ArrayItemElement, item, config); err != nil {
+			return err
+		}
+	}
+	return encoder.EncodeToken(start.End())
+}
+
+// xmlText returns the text of a JSON scalar
+func xmlText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+}
+
+// xmlNode is a parsed XML element
+type xmlNode struct {
+	name     string
+	attrs    []xml.Attr
+	children []*xmlNode
+	text     strings.Builder
+}
+
+// translateResponseToJSON replaces an XML response body with its JSON translation
+func translateResponseToJSON(resp *http.Response, config XMLTranslationConfig) error {
+	config = config.withDefaults()
+	if !isXMLMediaType(mediaTypeOf(resp.Header.Get("Content-Type"))) {
+		return nil
+	}
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		return fmt.Errorf("cannot translate a response with content encoding %s", encoding)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxTranslatedBodyBytes+1))
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if len(data) > maxTranslatedBodyBytes {
+		return fmt.Errorf("XML response is larger than %d bytes", maxTranslatedBodyBytes)
+	}
+
+	var document interface{}
+	if len(bytes.TrimSpace(data)) > 0 {
+		root, err := parseXMLDocument(data)
+		if err != nil {
+			return fmt.Errorf("invalid XML response: %w", err)
+		}
+		// Unwrap the content of a SOAP body
+		if config.SOAPEnvelope && root.name == "Envelope" {
+			for _, child := range root.children {
+				if child.name == "Body" && len(child.children) > 0 {
+					root = child.children[0]
+				}
+			}
+		}
+		document = xmlNodeValue(root, config)
+	}
+
+	translated, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(translated))
+	resp.ContentLength = int64(len(translated))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(translated)))
+	resp.Header.Set("Content-Type", "application/json")
+	resp.Header.Del("ETag")
+	return nil
+}
+
+// parseXMLDocument parses the root element of an XML document
+func parseXMLDocument(data []byte) (*xmlNode, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var stack []*xmlNode
+	var root *xmlNode
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: t.Name.Local, attrs: t.Attr}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			} else if root == nil {
+				root = node
+			}
+			stack = append(stack, node)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		}
+	}
+	if root == nil {
+		return nil, fmt.Errorf("no root element")
+	}
+	return root, nil
+}
+
+// xmlNodeValue returns the JSON value of an element: text for elements with only text, otherwise an object
+// of the attributes, children and text
+func xmlNodeValue(node *xmlNode, config XMLTranslationConfig) interface{} {
+	text := strings.TrimSpace(node.text.String())
+
+	var attrs []xml.Attr
+	for _, attr := range node.attrs {
+		// Namespace declarations are not part of the data
+		if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+			continue
+		}
+		attrs = append(attrs, attr)
+	}
+	if len(attrs) == 0 && len(node.children) == 0 {
+		if text == "" {
+			return nil
+		}
+		return xmlScalar(text, config)
+	}
+
+	object := make(map[string]interface{})
+	for _, attr := range attrs {
+		object[config.AttributePrefix+attr.Name.Local] = xmlScalar(attr.Value, config)
+	}
+	for _, child := range node.children {
+		value := xmlNodeValue(child, config)
+		existing, exists := object[child.name]
+		switch {
+		case !exists && containsString(config.ArrayElements, child.name):
+			object[child.name] = []interface{}{value}
+		case !exists:
+			object[child.name] = value
+		default:
+			// Repeated elements become arrays
+			if items, ok := existing.([]interface{}); ok {
+				object[child.name] = append(items, value)
+			} else {
+				object[child.name] = []interface{}{existing, value}
+			}
+		}
+	}
+	if text != "" {
+		object[config.TextKey] = xmlScalar(text, config)
+	}
+	return object
+}
+
+// xmlScalar returns the JSON value of element or attribute text, inferring numbers and booleans if configured
+func xmlScalar(text string, config XMLTranslationConfig) interface{} {
+	if !config.InferTypes {
+		return text
+	}
+	if text == "true" || text == "false" {
+		return text == "true"
+	}
+	if _, err := strconv.ParseFloat(text, 64); err == nil && json.Valid([]byte(text)) {
+		return json.Number(text)
+	}
+	return text
+}
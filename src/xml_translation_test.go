@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestXMLTranslation tests that JSON requests reach the backend as XML and XML responses return as JSON
+func TestXMLTranslation(t *testing.T) {
+	var received, contentType, soapAction string
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+		contentType = r.Header.Get("Content-Type")
+		soapAction = r.Header.Get("SOAPAction")
+		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		_, _ = io.WriteString(w, `<?xml version="1.0"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Body>
+    <GetOrderResponse xmlns="urn:orders">
+      <order id="42">
+        <status>shipped</status>
+        <total>19.90</total>
+        <paid>true</paid>
+        <item>book</item>
+      </order>
+      <note lang="en">fragile</note>
+    </GetOrderResponse>
+  </soap:Body>
+</soap:Envelope>`)
+	}))
+	defer backendServer.Close()
+
+	handler := NewProxy(Endpoint{
+		Path:    "/orders",
+		Backend: backendServer.URL,
+		XMLTranslation: XMLTranslationConfig{
+			Enabled:       true,
+			RootElement:   "GetOrder",
+			SOAPEnvelope:  true,
+			SOAPAction:    "urn:orders/GetOrder",
+			ArrayElements: []string{"item"},
+			InferTypes:    true,
+		},
+	}, false, nil).Handler()
+
+	req := httptest.NewRequest("POST", "/orders", strings.NewReader(`{"@version":"2","id":42,"tags":["a","b"],"customer":{"name":"Ann & Bob"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	expectedXML := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+		`<GetOrder version="2"><customer><name>Ann &amp; Bob</name></customer><id>42</id><tags>a</tags><tags>b</tags></GetOrder>` +
+		`</soap:Body></soap:Envelope>`
+	if !strings.HasSuffix(received, expectedXML) {
+		t.Errorf("expected the backend to receive %s, got %s", expectedXML, received)
+	}
+	if contentType != "text/xml; charset=utf-8" || soapAction != `"urn:orders/GetOrder"` {
+		t.Errorf("expected SOAP request headers, got Content-Type %q and SOAPAction %q", contentType, soapAction)
+	}
+
+	if rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected a JSON response, got %s", rr.Header().Get("Content-Type"))
+	}
+	var response interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid JSON response %s: %v", rr.Body.String(), err)
+	}
+	expected := map[string]interface{}{
+		"order": map[string]interface{}{
+			"@id":    float64(42),
+			"status": "shipped",
+			"total":  19.9,
+			"paid":   true,
+			"item":   []interface{}{"book"},
+		},
+		"note": map[string]interface{}{"@lang": "en", "#text": "fragile"},
+	}
+	if !reflect.DeepEqual(response, expected) {
+		t.Errorf("expected response %v, got %v", expected, response)
+	}
+
+	// Invalid JSON is rejected before reaching the backend
+	received = ""
+	req = httptest.NewRequest("POST", "/orders", strings.NewReader(`{"id":`))
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest || received != "" {
+		t.Errorf("expected status 400 without a backend request, got %d", rr.Code)
+	}
+}